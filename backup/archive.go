@@ -0,0 +1,293 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// FormatVersion is the version of the archive format Dump writes. Restore
+// reads archives of this version and earlier.
+const FormatVersion = 1
+
+// formatName identifies an archive in its header entry
+const formatName = "jsondb-dump"
+
+// Entry names. Collection entries live under collections/<name>/.
+const (
+	headerEntry     = "header.json"
+	manifestEntry   = "manifest.json"
+	collectionsDir  = "collections"
+	metadataFile    = "metadata.json"
+	indexesFile     = "indexes.json"
+	documentsFile   = "documents.jsonl"
+	checksumPAXName = "JSONDB.sha256"
+)
+
+var (
+	// ErrInvalidArchive is returned for data that is not a well-formed archive
+	ErrInvalidArchive = errors.New("invalid archive")
+	// ErrChecksumMismatch is returned for an entry whose content does not
+	// match its checksum
+	ErrChecksumMismatch = errors.New("archive checksum mismatch")
+	// ErrUnsupportedVersion is returned for an archive written by a newer
+	// format version
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+)
+
+// header is the first entry of an archive
+type header struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manifest describes an archive. It is the archive's last entry.
+type Manifest struct {
+	Version     int                 `json:"version"`
+	CreatedAt   time.Time           `json:"created_at"`
+	Collections []CollectionSummary `json:"collections"`
+	Entries     []Entry             `json:"entries"` // Every entry before the manifest, in archive order
+}
+
+// CollectionSummary describes a collection in an archive
+type CollectionSummary struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Indexes   int    `json:"indexes"`
+}
+
+// Entry is a file in an archive with its checksum
+type Entry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Documents returns the number of documents in the archive
+func (m *Manifest) Documents() int {
+	n := 0
+	for _, c := range m.Collections {
+		n += c.Documents
+	}
+	return n
+}
+
+// archiveWriter writes entries to a tar stream, recording each one's
+// checksum for the manifest
+type archiveWriter struct {
+	tw       *tar.Writer
+	modTime  time.Time
+	manifest Manifest
+}
+
+// newArchiveWriter starts an archive with its header entry
+func newArchiveWriter(w io.Writer, now time.Time) (*archiveWriter, error) {
+	aw := &archiveWriter{
+		tw:       tar.NewWriter(w),
+		modTime:  now,
+		manifest: Manifest{Version: FormatVersion, CreatedAt: now, Collections: []CollectionSummary{}},
+	}
+	data, err := json.Marshal(header{Format: formatName, Version: FormatVersion, CreatedAt: now})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal archive header: %w", err)
+	}
+	if err := aw.write(headerEntry, data); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// write adds an entry, with its checksum in the entry's header so readers
+// can check it before using the content
+func (aw *archiveWriter) write(name string, data []byte) error {
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	hdr := &tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       name,
+		Mode:       0644,
+		Size:       int64(len(data)),
+		ModTime:    aw.modTime,
+		Format:     tar.FormatPAX,
+		PAXRecords: map[string]string{checksumPAXName: checksum},
+	}
+	if err := aw.tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	if _, err := aw.tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive entry %s: %w", name, err)
+	}
+	if name != manifestEntry {
+		aw.manifest.Entries = append(aw.manifest.Entries, Entry{Name: name, Size: int64(len(data)), SHA256: checksum})
+	}
+	return nil
+}
+
+// close writes the manifest and ends the archive
+func (aw *archiveWriter) close() (*Manifest, error) {
+	data, err := json.MarshalIndent(aw.manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := aw.write(manifestEntry, data); err != nil {
+		return nil, err
+	}
+	if err := aw.tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return &aw.manifest, nil
+}
+
+// archive is an archive read in full, its entries checked against their
+// checksums and the manifest
+type archive struct {
+	manifest Manifest
+	files    map[string][]byte // Entry content by name
+}
+
+// readArchive reads and checks a whole archive
+func readArchive(r io.Reader) (*archive, error) {
+	a := &archive{files: make(map[string][]byte)}
+	tr := tar.NewReader(r)
+	var entries []Entry
+	var manifest []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if manifest != nil {
+			return nil, fmt.Errorf("%w: entry %s after the manifest", ErrInvalidArchive, hdr.Name)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidArchive, hdr.Name, err)
+		}
+
+		if len(entries) == 0 {
+			if hdr.Name != headerEntry {
+				return nil, fmt.Errorf("%w: missing header", ErrInvalidArchive)
+			}
+			if err := checkHeader(data); err != nil {
+				return nil, err
+			}
+		}
+
+		sum := sha256.Sum256(data)
+		checksum := hex.EncodeToString(sum[:])
+		if expected := hdr.PAXRecords[checksumPAXName]; expected != checksum {
+			return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, hdr.Name)
+		}
+		if hdr.Name == manifestEntry {
+			manifest = data
+			continue
+		}
+		if _, dup := a.files[hdr.Name]; dup {
+			return nil, fmt.Errorf("%w: duplicate entry %s", ErrInvalidArchive, hdr.Name)
+		}
+		a.files[hdr.Name] = data
+		entries = append(entries, Entry{Name: hdr.Name, Size: int64(len(data)), SHA256: checksum})
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidArchive)
+	}
+	if err := json.Unmarshal(manifest, &a.manifest); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse manifest: %v", ErrInvalidArchive, err)
+	}
+	if len(a.manifest.Entries) != len(entries) {
+		return nil, fmt.Errorf("%w: manifest lists %d entries, archive has %d", ErrChecksumMismatch, len(a.manifest.Entries), len(entries))
+	}
+	for i, entry := range entries {
+		if a.manifest.Entries[i] != entry {
+			return nil, fmt.Errorf("%w: %s does not match the manifest", ErrChecksumMismatch, entry.Name)
+		}
+	}
+	return a, nil
+}
+
+// Verify reads a whole archive, checking every entry against its checksum
+// and the manifest, and returns the manifest
+func Verify(r io.Reader) (*Manifest, error) {
+	a, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	return &a.manifest, nil
+}
+
+// checkHeader checks an archive's header entry, rejecting archives of
+// newer format versions
+func checkHeader(data []byte) error {
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		return fmt.Errorf("%w: failed to parse header: %v", ErrInvalidArchive, err)
+	}
+	if h.Format != formatName {
+		return fmt.Errorf("%w: not a %s archive", ErrInvalidArchive, formatName)
+	}
+	if h.Version < 1 || h.Version > FormatVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, h.Version)
+	}
+	return nil
+}
+
+// collectionEntry returns the name of a collection's entry
+func collectionEntry(collection, file string) string {
+	return path.Join(collectionsDir, collection, file)
+}
+
+// documentLine is a line of a collection's documents entry
+type documentLine struct {
+	ID       string        `json:"id"`
+	Document core.Document `json:"document"`
+}
+
+// encodeDocuments encodes documents as JSON Lines in ID order
+func encodeDocuments(docs map[string]core.Document) ([]byte, error) {
+	ids := make([]string, 0, len(docs))
+	for id := range docs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, id := range ids {
+		if err := enc.Encode(documentLine{ID: id, Document: docs[id]}); err != nil {
+			return nil, fmt.Errorf("failed to encode document %s: %w", id, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDocuments decodes documents encoded by encodeDocuments
+func decodeDocuments(data []byte) (map[string]core.Document, error) {
+	docs := make(map[string]core.Document)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var line documentLine
+		if err := dec.Decode(&line); err != nil {
+			return nil, fmt.Errorf("%w: failed to decode document: %v", ErrInvalidArchive, err)
+		}
+		if line.ID == "" || line.Document == nil {
+			return nil, fmt.Errorf("%w: document without ID or content", ErrInvalidArchive)
+		}
+		docs[line.ID] = line.Document
+	}
+	return docs, nil
+}
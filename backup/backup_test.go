@@ -0,0 +1,327 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// openDB opens a database in dir
+func openDB(t *testing.T, dir string) *db.DB {
+	t.Helper()
+	database, err := db.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// populate fills a database with collections exercising every part of an
+// archive: documents, schema, defaults, encrypted fields, references and
+// each kind of index
+func populate(t *testing.T, database *db.DB) {
+	t.Helper()
+	users, _ := database.CreateCollection("users")
+	orders, _ := database.CreateCollection("orders")
+	database.CreateCollection("empty")
+
+	for _, doc := range []core.Document{
+		{"_id": "ada", "name": "Ada Lovelace", "born": 1815, "bio": "first programmer", "address": map[string]interface{}{"city": "London"}},
+		{"_id": "alan", "name": "Alan Turing", "born": 1912, "bio": "computing machinery", "tags": []interface{}{"math", "crypto"}},
+	} {
+		if _, err := users.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	if err := database.SetSchema("users", []byte(`{"type": "object", "required": ["name"]}`), schema.Strict); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	if err := database.SetDefaults("orders", core.Document{"status": "new"}); err != nil {
+		t.Fatalf("Failed to set defaults: %v", err)
+	}
+	if err := database.EncryptFields("orders", []string{"card"}, bytes.Repeat([]byte{1}, 32)); err != nil {
+		t.Fatalf("Failed to encrypt fields: %v", err)
+	}
+	if err := database.DeclareReference("orders", "user", "users", core.RefRestrict); err != nil {
+		t.Fatalf("Failed to declare reference: %v", err)
+	}
+	if _, err := orders.Insert(core.Document{"_id": "o1", "user": "ada", "total": 12.5, "card": "4111"}); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	indexes := database.Indexes()
+	for _, err := range []error{
+		indexes.CreateSecondaryIndex("users", "born", core.IndexOrdered),
+		indexes.CreateIndexWithOptions("users", "name", core.IndexHash, index.IndexOptions{CaseInsensitive: true}),
+		indexes.CreateUniqueIndex("users", "address.city"),
+		indexes.CreateTextIndex("users", "bio", index.TextOptions{MinTokenLength: 3}),
+		indexes.CreateCompositeIndex("orders", []string{"user", "total"}),
+	} {
+		if err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+}
+
+// snapshots returns a snapshot of every collection, by name
+func snapshots(t *testing.T, database *db.DB) map[string]*db.CollectionSnapshot {
+	t.Helper()
+	names, err := database.Collections()
+	if err != nil {
+		t.Fatalf("Failed to list collections: %v", err)
+	}
+	out := make(map[string]*db.CollectionSnapshot)
+	for _, name := range names {
+		s, err := database.Snapshot(name)
+		if err != nil {
+			t.Fatalf("Failed to snapshot %s: %v", name, err)
+		}
+		out[name] = s
+	}
+	return out
+}
+
+// compare checks that two snapshots hold the same documents, configuration
+// and index definitions
+func compare(t *testing.T, expected, got *db.CollectionSnapshot) {
+	t.Helper()
+	if !reflect.DeepEqual(expected.File.Documents, got.File.Documents) {
+		t.Errorf("Expected %s documents %v, got %v", expected.Name, expected.File.Documents, got.File.Documents)
+	}
+	e, g := expected.File.Metadata, got.File.Metadata
+	if !bytes.Equal(e.Schema, g.Schema) || e.SchemaMode != g.SchemaMode || !reflect.DeepEqual(e.Defaults, g.Defaults) ||
+		!reflect.DeepEqual(e.EncryptedFields, g.EncryptedFields) || !reflect.DeepEqual(e.References, g.References) ||
+		!e.CreatedAt.Equal(g.CreatedAt) {
+		t.Errorf("Expected %s metadata %+v, got %+v", expected.Name, e, g)
+	}
+	if !bytes.Equal(expected.Indexes, got.Indexes) {
+		t.Errorf("Expected %s indexes %s, got %s", expected.Name, expected.Indexes, got.Indexes)
+	}
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	populate(t, database)
+	before := snapshots(t, database)
+
+	var archive bytes.Buffer
+	manifest, err := Dump(context.Background(), database, &archive)
+	if err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+	if len(manifest.Collections) != 3 || manifest.Documents() != 3 || len(manifest.Entries) != 10 {
+		t.Errorf("Expected 3 collections, 3 documents and 10 entries, got %+v", manifest)
+	}
+	database.Close()
+
+	// Wipe the database and restore it from the archive alone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("Failed to wipe database: %v", err)
+	}
+	restoredDB := openDB(t, dir)
+	if _, err := Restore(context.Background(), restoredDB, bytes.NewReader(archive.Bytes()), RestoreOptions{}); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+
+	after := snapshots(t, restoredDB)
+	if len(after) != len(before) {
+		t.Fatalf("Expected %d collections, got %d", len(before), len(after))
+	}
+	for name, s := range before {
+		compare(t, s, after[name])
+	}
+
+	// The restored database works: indexes answer, references are enforced
+	// and the rules are back
+	if docs, err := restoredDB.Indexes().Range("users", "born", 1900, nil, true, false); err != nil || len(docs) != 1 {
+		t.Errorf("Expected the ordered index to find alan, got %v: %v", docs, err)
+	}
+	if docs, err := restoredDB.Indexes().SearchText("users", "bio", "machinery"); err != nil || len(docs) != 1 {
+		t.Errorf("Expected the text index to find alan, got %v: %v", docs, err)
+	}
+	users, _ := restoredDB.Collection("users")
+	if err := users.Delete("ada"); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Errorf("Expected the reference to be enforced, got %v", err)
+	}
+	if _, err := users.Insert(core.Document{"born": 1900}); err == nil {
+		t.Errorf("Expected the schema to be enforced")
+	}
+
+	// The restore survives reopening
+	restoredDB.Close()
+	reopened := openDB(t, dir)
+	for name, s := range snapshots(t, reopened) {
+		compare(t, before[name], s)
+	}
+}
+
+func TestRestoreOptions(t *testing.T) {
+	source := openDB(t, t.TempDir())
+	populate(t, source)
+	var archive bytes.Buffer
+	if _, err := Dump(context.Background(), source, &archive); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     RestoreOptions
+		expected []string
+	}{
+		{"all", RestoreOptions{}, []string{"empty", "orders", "users"}},
+		{"include", RestoreOptions{Include: []string{"users", "e*"}}, []string{"empty", "users"}},
+		{"exclude", RestoreOptions{Exclude: []string{"empty"}}, []string{"orders", "users"}},
+		{"include and exclude", RestoreOptions{Include: []string{"*s"}, Exclude: []string{"orders"}}, []string{"users"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := openDB(t, t.TempDir())
+			manifest, err := Restore(context.Background(), target, bytes.NewReader(archive.Bytes()), tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to restore: %v", err)
+			}
+			var names []string
+			for _, c := range manifest.Collections {
+				names = append(names, c.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+
+	// orders references users, which is neither restored nor present
+	target := openDB(t, t.TempDir())
+	_, err := Restore(context.Background(), target, bytes.NewReader(archive.Bytes()), RestoreOptions{Include: []string{"orders"}})
+	if !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected a dangling reference to fail, got %v", err)
+	}
+	if _, err := Restore(context.Background(), target, bytes.NewReader(archive.Bytes()), RestoreOptions{Include: []string{"["}}); err == nil {
+		t.Errorf("Expected an invalid pattern to fail")
+	}
+}
+
+func TestRestoreDrop(t *testing.T) {
+	source := openDB(t, t.TempDir())
+	populate(t, source)
+	var archive bytes.Buffer
+	if _, err := Dump(context.Background(), source, &archive); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+
+	target := openDB(t, t.TempDir())
+	users, _ := target.CreateCollection("users")
+	users.Insert(core.Document{"_id": "grace", "name": "Grace Hopper"})
+
+	_, err := Restore(context.Background(), target, bytes.NewReader(archive.Bytes()), RestoreOptions{})
+	if !errors.Is(err, ErrCollectionExists) {
+		t.Fatalf("Expected an existing collection to fail the restore, got %v", err)
+	}
+	if names, _ := target.Collections(); len(names) != 1 {
+		t.Errorf("Expected nothing to be restored, got %v", names)
+	}
+
+	if _, err := Restore(context.Background(), target, bytes.NewReader(archive.Bytes()), RestoreOptions{Drop: true}); err != nil {
+		t.Fatalf("Failed to restore with drop: %v", err)
+	}
+	if _, err := users.Get("grace"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected the existing collection to be replaced, got %v", err)
+	}
+	compare(t, snapshots(t, source)["users"], snapshots(t, target)["users"])
+}
+
+// rewrite copies an archive, passing each entry's header and content
+// through fn
+func rewrite(t *testing.T, archive []byte, fn func(hdr *tar.Header, data []byte) []byte) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(archive))
+	tw := tar.NewWriter(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read archive: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		data = fn(hdr, data)
+		hdr.Size = int64(len(data))
+		tw.WriteHeader(hdr)
+		tw.Write(data)
+	}
+	tw.Close()
+	return out.Bytes()
+}
+
+func TestRestoreCorruptArchive(t *testing.T) {
+	source := openDB(t, t.TempDir())
+	populate(t, source)
+	var buf bytes.Buffer
+	if _, err := Dump(context.Background(), source, &buf); err != nil {
+		t.Fatalf("Failed to dump: %v", err)
+	}
+	archive := buf.Bytes()
+
+	tests := []struct {
+		name     string
+		archive  []byte
+		expected error
+	}{
+		{"truncated", archive[:len(archive)/2], ErrInvalidArchive},
+		{"not an archive", []byte("hello"), ErrInvalidArchive},
+		{"tampered document", rewrite(t, archive, func(hdr *tar.Header, data []byte) []byte {
+			if strings.HasSuffix(hdr.Name, "users/"+documentsFile) {
+				return bytes.Replace(data, []byte("Ada"), []byte("Eve"), 1)
+			}
+			return data
+		}), ErrChecksumMismatch},
+		{"tampered entry checksum", rewrite(t, archive, func(hdr *tar.Header, data []byte) []byte {
+			// The entry matches its own checksum but not the manifest
+			if strings.HasSuffix(hdr.Name, "users/"+documentsFile) {
+				data = bytes.Replace(data, []byte("Ada"), []byte("Eve"), 1)
+				sum := sha256.Sum256(data)
+				hdr.PAXRecords = map[string]string{checksumPAXName: hex.EncodeToString(sum[:])}
+			}
+			return data
+		}), ErrChecksumMismatch},
+		{"newer version", rewrite(t, archive, func(hdr *tar.Header, data []byte) []byte {
+			if hdr.Name == headerEntry {
+				data, _ = json.Marshal(header{Format: formatName, Version: FormatVersion + 1})
+			}
+			return data
+		}), ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := openDB(t, t.TempDir())
+			_, err := Restore(context.Background(), target, bytes.NewReader(tt.archive), RestoreOptions{})
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, err)
+			}
+			if names, _ := target.Collections(); len(names) != 0 {
+				t.Errorf("Expected nothing to be restored, got %v", names)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// ErrCollectionExists is returned by Restore for a collection that already
+// exists when RestoreOptions.Drop is not set
+var ErrCollectionExists = errors.New("collection already exists")
+
+// RestoreOptions selects what Restore restores
+type RestoreOptions struct {
+	// Include restores only the collections matching one of these
+	// path.Match patterns; empty restores every collection
+	Include []string
+	// Exclude skips the collections matching one of these patterns
+	Exclude []string
+	// Drop replaces existing collections instead of failing with
+	// ErrCollectionExists
+	Drop bool
+}
+
+// Dump writes an archive of every collection of a database to w: the
+// documents of each as JSON Lines, its metadata (schema, defaults, encrypted
+// fields and references) and its index definitions, each entry with a
+// SHA-256 checksum. Every collection is taken from a consistent snapshot of
+// its own; collections are not consistent with each other. Encrypted fields
+// are archived encrypted. It returns the archive's manifest, and records
+// the dump as the database's last backup in db.Info.
+func Dump(ctx context.Context, d *db.DB, w io.Writer) (*Manifest, error) {
+	manifest, err := dump(ctx, d, w)
+	if err != nil {
+		return nil, err
+	}
+	d.RecordBackup(manifest.CreatedAt)
+	return manifest, nil
+}
+
+// dump writes the archive of Dump without recording it as a backup
+func dump(ctx context.Context, d *db.DB, w io.Writer) (*Manifest, error) {
+	names, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(names)
+
+	aw, err := newArchiveWriter(w, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		snapshot, err := d.Snapshot(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump %s: %w", name, err)
+		}
+		if err := writeCollection(aw, snapshot); err != nil {
+			return nil, fmt.Errorf("failed to dump %s: %w", name, err)
+		}
+	}
+	return aw.close()
+}
+
+// writeCollection writes the entries of a collection snapshot
+func writeCollection(aw *archiveWriter, snapshot *db.CollectionSnapshot) error {
+	metadata, err := json.MarshalIndent(snapshot.File.Metadata, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	documents, err := encodeDocuments(snapshot.File.Documents)
+	if err != nil {
+		return err
+	}
+	var defs []json.RawMessage
+	if err := json.Unmarshal(snapshot.Indexes, &defs); err != nil {
+		return fmt.Errorf("failed to parse index definitions: %w", err)
+	}
+
+	for _, entry := range []struct {
+		file string
+		data []byte
+	}{
+		{metadataFile, metadata},
+		{indexesFile, snapshot.Indexes},
+		{documentsFile, documents},
+	} {
+		if err := aw.write(collectionEntry(snapshot.Name, entry.file), entry.data); err != nil {
+			return err
+		}
+	}
+	aw.manifest.Collections = append(aw.manifest.Collections, CollectionSummary{
+		Name:      snapshot.Name,
+		Documents: len(snapshot.File.Documents),
+		Indexes:   len(defs),
+	})
+	return nil
+}
+
+// Restore restores the collections of an archive written by Dump into a
+// database, replacing their documents, metadata and indexes. The whole
+// archive is read and checked against its checksums before anything is
+// written. It returns a manifest of what was restored.
+func Restore(ctx context.Context, d *db.DB, r io.Reader, opts RestoreOptions) (*Manifest, error) {
+	a, err := readArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	existing, err := d.Collections()
+	if err != nil {
+		return nil, err
+	}
+
+	restored := a.manifest
+	restored.Collections = nil
+	var snapshots []*db.CollectionSnapshot
+	for _, summary := range a.manifest.Collections {
+		selected, err := opts.selects(summary.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !selected {
+			continue
+		}
+		if !opts.Drop && slices.Contains(existing, summary.Name) {
+			return nil, fmt.Errorf("failed to restore %s: %w", summary.Name, ErrCollectionExists)
+		}
+		snapshot, err := a.collection(summary.Name)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+		restored.Collections = append(restored.Collections, summary)
+	}
+
+	if err := d.Restore(snapshots); err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+// selects reports whether the options select a collection
+func (o RestoreOptions) selects(collection string) (bool, error) {
+	included, err := matchAny(o.Include, collection)
+	if err != nil {
+		return false, err
+	}
+	excluded, err := matchAny(o.Exclude, collection)
+	if err != nil {
+		return false, err
+	}
+	return (len(o.Include) == 0 || included) && !excluded, nil
+}
+
+// matchAny reports whether name matches one of patterns
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, fmt.Errorf("invalid collection pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// collection rebuilds a collection snapshot from the archive's entries
+func (a *archive) collection(name string) (*db.CollectionSnapshot, error) {
+	files := make(map[string][]byte)
+	for _, file := range []string{metadataFile, indexesFile, documentsFile} {
+		data, ok := a.files[collectionEntry(name, file)]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s has no %s", ErrInvalidArchive, name, file)
+		}
+		files[file] = data
+	}
+
+	var metadata storage.CollectionMetadata
+	if err := json.Unmarshal(files[metadataFile], &metadata); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse metadata of %s: %v", ErrInvalidArchive, name, err)
+	}
+	docs, err := decodeDocuments(files[documentsFile])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read documents of %s: %w", name, err)
+	}
+	return &db.CollectionSnapshot{
+		Name:    name,
+		File:    &storage.CollectionFile{Metadata: metadata, Documents: docs},
+		Indexes: files[indexesFile],
+	}, nil
+}
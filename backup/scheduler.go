@@ -0,0 +1,351 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// backupSuffix ends the name of every backup a Scheduler writes
+const backupSuffix = ".jdbdump"
+
+// backupTimeFormat is the timestamp in backup names, which sorts in time order
+const backupTimeFormat = "20060102T150405.000Z"
+
+// schedulerStallGrace is how long past due a scheduled backup may be
+// before the scheduler's health check reports its loop as stalled
+const schedulerStallGrace = time.Minute
+
+// ErrBackupRunning is returned by Scheduler.BackupNow while another backup
+// is in progress
+var ErrBackupRunning = errors.New("backup already running")
+
+// Retention is which backups a Scheduler keeps. A backup is kept if any
+// rule keeps it, and the zero Retention keeps every backup.
+type Retention struct {
+	Last   int // Keep the latest Last backups
+	Daily  int // Keep the latest backup of each of the latest Daily days with one
+	Weekly int // Keep the latest backup of each of the latest Weekly ISO weeks with one
+}
+
+// SchedulerOptions configures a Scheduler
+type SchedulerOptions struct {
+	// Schedule is when backups are taken, such as Every(time.Hour) or a
+	// ParseCron expression. Required.
+	Schedule Schedule
+
+	// Retention is which backups are kept after each new one
+	Retention Retention
+
+	// Prefix starts the name of every backup (default "backup"). Only
+	// backups with the prefix are subject to retention.
+	Prefix string
+
+	// OnSuccess is called after each verified backup
+	OnSuccess func(name string, manifest *Manifest)
+
+	// OnError is called when a backup or its cleanup fails
+	OnError func(err error)
+}
+
+// Status reports a Scheduler's progress
+type Status struct {
+	Running     bool      `json:"running"` // A backup is in progress
+	LastBackup  string    `json:"last_backup,omitempty"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+	Skipped     int       `json:"skipped"` // Scheduled backups skipped because one was still running
+	Next        time.Time `json:"next"`    // When the next scheduled backup is due; zero when stopped
+}
+
+// Scheduler takes backups of a database into a BackupTarget on a schedule,
+// keeping those its retention policy selects. It runs in the background
+// between Start and Stop, and stops when the database is closed.
+type Scheduler struct {
+	db     *db.DB
+	target BackupTarget
+	opts   SchedulerOptions
+
+	running sync.Mutex // Held while a backup runs
+
+	mu         sync.Mutex // Guards status and the loop state
+	status     Status
+	stop       chan struct{}
+	done       chan struct{}
+	unregister func() // Removes the health check registered by Start
+}
+
+// NewScheduler creates a scheduler taking backups of d into a target, such
+// as a FileTarget
+func NewScheduler(d *db.DB, target BackupTarget, opts SchedulerOptions) (*Scheduler, error) {
+	if opts.Schedule == nil {
+		return nil, errors.New("backup: schedule is required")
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = "backup"
+	}
+
+	s := &Scheduler{db: d, target: target, opts: opts}
+	d.OnClose(s.Stop)
+	return s, nil
+}
+
+// Start takes backups in the background until Stop is called or the
+// database is closed. A backup falling due while the previous one is still
+// running is skipped. While started, the scheduler's liveness is a health
+// check of the database.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	if s.stop != nil {
+		s.mu.Unlock()
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.unregister = s.db.RegisterHealthCheck("backup_scheduler:"+s.opts.Prefix, s.alive)
+	stop, done := s.stop, s.done
+	s.mu.Unlock()
+
+	go func() {
+		var wg sync.WaitGroup
+		defer close(done)
+		defer wg.Wait()
+
+		for {
+			next := s.opts.Schedule.Next(time.Now())
+			s.mu.Lock()
+			s.status.Next = next
+			s.mu.Unlock()
+			if next.IsZero() {
+				<-stop
+				return
+			}
+
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := s.BackupNow(context.Background()); errors.Is(err, ErrBackupRunning) {
+					s.mu.Lock()
+					s.status.Skipped++
+					s.mu.Unlock()
+				}
+			}()
+		}
+	}()
+}
+
+// Stop halts the background loop and waits for a running backup to finish
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	stop, done, unregister := s.stop, s.done, s.unregister
+	s.stop, s.done, s.unregister = nil, nil, nil
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	unregister()
+
+	s.mu.Lock()
+	s.status.Next = time.Time{}
+	s.mu.Unlock()
+}
+
+// Status returns the scheduler's progress
+func (s *Scheduler) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// alive is the scheduler's health check: a started scheduler fails it once
+// its loop has not started a due backup for schedulerStallGrace
+func (s *Scheduler) alive(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop == nil || s.status.Next.IsZero() {
+		return nil
+	}
+	if overdue := time.Since(s.status.Next); overdue > schedulerStallGrace {
+		return fmt.Errorf("backup loop stalled: backup due %s ago", overdue.Round(time.Second))
+	}
+	return nil
+}
+
+// BackupNow takes a backup, verifies it and applies the retention policy,
+// returning the backup's name. It fails with ErrBackupRunning, recording
+// nothing, if a backup is already running.
+func (s *Scheduler) BackupNow(ctx context.Context) (string, error) {
+	if !s.running.TryLock() {
+		return "", ErrBackupRunning
+	}
+	defer s.running.Unlock()
+
+	s.mu.Lock()
+	s.status.Running = true
+	s.mu.Unlock()
+
+	name, manifest, err := s.backup(ctx)
+	if err == nil {
+		s.succeeded(name, manifest)
+		err = s.prune(ctx)
+	}
+
+	s.mu.Lock()
+	s.status.Running = false
+	if err != nil {
+		s.status.LastError = err.Error()
+		s.status.LastErrorAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	if err != nil && s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+	return name, err
+}
+
+// succeeded records a successful backup
+func (s *Scheduler) succeeded(name string, manifest *Manifest) {
+	s.mu.Lock()
+	s.status.LastBackup = name
+	s.status.LastSuccess = manifest.CreatedAt
+	s.status.LastError = ""
+	s.mu.Unlock()
+
+	if s.opts.OnSuccess != nil {
+		s.opts.OnSuccess(name, manifest)
+	}
+}
+
+// backup streams a backup to the target, then reads it back and checks it
+// against the manifest Dump returned, deleting it if it does not match
+func (s *Scheduler) backup(ctx context.Context) (string, *Manifest, error) {
+	name := s.opts.Prefix + "-" + time.Now().UTC().Format(backupTimeFormat) + backupSuffix
+	manifest, err := BackupTo(ctx, s.db, s.target, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := s.verify(ctx, name, manifest); err != nil {
+		s.target.Delete(context.WithoutCancel(ctx), name)
+		return "", nil, fmt.Errorf("failed to verify backup %s: %w", name, err)
+	}
+	return name, manifest, nil
+}
+
+// verify reads back a stored archive and checks that it matches the
+// manifest it was written with
+func (s *Scheduler) verify(ctx context.Context, name string, expected *Manifest) error {
+	r, err := s.target.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	manifest, err := Verify(contextReader{ctx, r})
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(manifest.Entries, expected.Entries) {
+		return fmt.Errorf("%w: stored archive differs from its manifest", ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// prune deletes the backups the retention policy does not keep
+func (s *Scheduler) prune(ctx context.Context) error {
+	keys, err := s.target.List(ctx, s.opts.Prefix+"-")
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	var times []time.Time
+	for _, key := range keys {
+		if t, ok := s.backupTime(key); ok {
+			names = append(names, key)
+			times = append(times, t)
+		}
+	}
+
+	var errs []error
+	for i, keep := range retain(times, s.opts.Retention) {
+		if !keep {
+			if err := s.target.Delete(ctx, names[i]); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove old backup: %w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// backupTime returns the time in the name of a backup with the scheduler's
+// prefix
+func (s *Scheduler) backupTime(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, s.opts.Prefix+"-")
+	if !ok {
+		return time.Time{}, false
+	}
+	if stamp, ok = strings.CutSuffix(stamp, backupSuffix); !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(backupTimeFormat, stamp)
+	return t, err == nil
+}
+
+// retain reports which of the backups taken at times the policy keeps
+func retain(times []time.Time, r Retention) []bool {
+	keep := make([]bool, len(times))
+	if r == (Retention{}) {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+
+	// Visit the backups newest first
+	order := make([]int, len(times))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return times[b].Compare(times[a]) })
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for n, i := range order {
+		t := times[i].UTC()
+		day := t.Format("2006-01-02")
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%d", year, week)
+
+		if n < r.Last {
+			keep[i] = true
+		}
+		if !days[day] && len(days) < r.Daily {
+			days[day] = true
+			keep[i] = true
+		}
+		if !weeks[weekKey] && len(weeks) < r.Weekly {
+			weeks[weekKey] = true
+			keep[i] = true
+		}
+	}
+	return keep
+}
@@ -0,0 +1,324 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestParseCron(t *testing.T) {
+	// 2026-03-14 was a Saturday
+	from := time.Date(2026, 3, 14, 10, 30, 15, 0, time.UTC)
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2026, 3, 14, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 3, 14, 10, 45, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2026, 3, 15, 3, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"30 10,12 * * *", time.Date(2026, 3, 14, 12, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * 1-5", time.Date(2026, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)}, // The 13th or a Friday
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := ParseCron(tt.spec)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if got := schedule.Next(from); !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRetain(t *testing.T) {
+	day := func(d, h int) time.Time { return time.Date(2026, 3, d, h, 0, 0, 0, time.UTC) }
+	// Newest last: two a day from Monday the 2nd to Sunday the 15th
+	var times []time.Time
+	for d := 2; d <= 15; d++ {
+		times = append(times, day(d, 1), day(d, 13))
+	}
+	kept := func(keep []bool) []time.Time {
+		var out []time.Time
+		for i, k := range keep {
+			if k {
+				out = append(out, times[i])
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		expected  []time.Time
+	}{
+		{"last", Retention{Last: 3}, []time.Time{day(14, 13), day(15, 1), day(15, 13)}},
+		{"daily", Retention{Daily: 2}, []time.Time{day(14, 13), day(15, 13)}},
+		{"weekly", Retention{Weekly: 2}, []time.Time{day(8, 13), day(15, 13)}},
+		{"daily and weekly", Retention{Daily: 1, Weekly: 3}, []time.Time{day(8, 13), day(15, 13)}},
+		{"last and daily", Retention{Last: 2, Daily: 2}, []time.Time{day(14, 13), day(15, 1), day(15, 13)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := kept(retain(times, tt.retention)); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if got := kept(retain(times, Retention{})); len(got) != len(times) {
+		t.Errorf("Expected the zero retention to keep everything, got %d", len(got))
+	}
+}
+
+// fileTarget creates a FileTarget in dir
+func fileTarget(t *testing.T, dir string) *FileTarget {
+	t.Helper()
+	target, err := NewFileTarget(dir)
+	if err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+	return target
+}
+
+// backups returns the names of the backups in dir
+func backups(t *testing.T, dir string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, "*"+backupSuffix))
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	return names
+}
+
+func TestSchedulerBackupNow(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	populate(t, database)
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	var successes []string
+	s, err := NewScheduler(database, fileTarget(t, dir), SchedulerOptions{
+		Schedule:  Every(time.Hour),
+		Retention: Retention{Last: 2},
+		OnSuccess: func(name string, m *Manifest) { successes = append(successes, name) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	// Old backups of another prefix are left alone
+	os.WriteFile(filepath.Join(dir, "other-20200101T000000.000Z"+backupSuffix), nil, 0644)
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.BackupNow(context.Background()); err != nil {
+			t.Fatalf("Failed to back up: %v", err)
+		}
+		time.Sleep(2 * time.Millisecond) // Backup names have millisecond precision
+	}
+	if len(successes) != 3 {
+		t.Fatalf("Expected 3 successful backups, got %v", successes)
+	}
+	names := backups(t, dir)
+	if len(names) != 3 || filepath.Base(names[0]) != successes[1] || filepath.Base(names[1]) != successes[2] {
+		t.Fatalf("Expected the latest 2 backups and the other one, got %v", names)
+	}
+
+	status := s.Status()
+	if status.LastBackup != successes[2] || status.LastSuccess.IsZero() || status.LastError != "" || status.Running {
+		t.Errorf("Expected a successful status, got %+v", status)
+	}
+	if info, err := database.Info(); err != nil || info.LastBackup == nil || !info.LastBackup.Equal(status.LastSuccess) {
+		t.Errorf("Expected the backup to be recorded, got %v: %v", info, err)
+	}
+
+	// The backups restore
+	f, err := os.Open(names[1])
+	if err != nil {
+		t.Fatalf("Failed to open backup: %v", err)
+	}
+	defer f.Close()
+	target := openDB(t, t.TempDir())
+	if _, err := Restore(context.Background(), target, f, RestoreOptions{}); err != nil {
+		t.Fatalf("Failed to restore backup: %v", err)
+	}
+	compare(t, snapshots(t, database)["users"], snapshots(t, target)["users"])
+}
+
+func TestSchedulerErrors(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	populate(t, database)
+	dir := t.TempDir()
+
+	var errs []error
+	s, err := NewScheduler(database, fileTarget(t, dir), SchedulerOptions{
+		Schedule: Every(time.Hour),
+		OnError:  func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	// A backup that cannot be written is reported and leaves nothing behind
+	os.Chmod(dir, 0555)
+	defer os.Chmod(dir, 0755)
+	if os.WriteFile(filepath.Join(dir, "probe"), nil, 0644) == nil {
+		t.Skip("Directory permissions are not enforced")
+	}
+	if _, err := s.BackupNow(context.Background()); err == nil {
+		t.Fatalf("Expected the backup to fail")
+	}
+	status := s.Status()
+	if len(errs) != 1 || status.LastError == "" || status.LastErrorAt.IsZero() || !status.LastSuccess.IsZero() {
+		t.Errorf("Expected the failure to be reported, got %v and %+v", errs, status)
+	}
+
+	os.Chmod(dir, 0755)
+	if _, err := s.BackupNow(context.Background()); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if status := s.Status(); status.LastError != "" || status.LastSuccess.IsZero() {
+		t.Errorf("Expected the error to clear after a success, got %+v", status)
+	}
+}
+
+func TestSchedulerSkipsRunningBackup(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	s, err := NewScheduler(database, fileTarget(t, t.TempDir()), SchedulerOptions{Schedule: Every(5 * time.Millisecond)})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+
+	// Hold the backup slot as a long-running backup would
+	s.running.Lock()
+	if _, err := s.BackupNow(context.Background()); !errors.Is(err, ErrBackupRunning) {
+		t.Fatalf("Expected ErrBackupRunning, got %v", err)
+	}
+	s.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().Skipped < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	s.running.Unlock()
+	s.Stop()
+
+	status := s.Status()
+	if status.Skipped < 2 || status.LastError != "" || !status.Next.IsZero() {
+		t.Errorf("Expected skipped cycles without errors, got %+v", status)
+	}
+}
+
+func TestSchedulerStopsWithDB(t *testing.T) {
+	database, err := db.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"name": "Ada"})
+	dir := t.TempDir()
+
+	var mu sync.Mutex
+	count := 0
+	s, err := NewScheduler(database, fileTarget(t, dir), SchedulerOptions{
+		Schedule: Every(5 * time.Millisecond),
+		OnSuccess: func(string, *Manifest) {
+			mu.Lock()
+			count++
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	s.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().LastBackup == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := database.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+	mu.Lock()
+	after := count
+	mu.Unlock()
+	if after == 0 || !s.Status().Next.IsZero() {
+		t.Fatalf("Expected backups until the database closed, got %d and %+v", after, s.Status())
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if count != after || s.Status().LastError != "" {
+		t.Errorf("Expected no backups after closing, got %d more: %s", count-after, s.Status().LastError)
+	}
+}
+
+func TestSchedulerHealthCheck(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	s, err := NewScheduler(database, fileTarget(t, t.TempDir()), SchedulerOptions{Schedule: Every(time.Hour), Prefix: "nightly"})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	// checkStatus returns the status of the scheduler's check, or "" if it
+	// is not registered
+	checkStatus := func() db.HealthStatus {
+		t.Helper()
+		report, err := database.Health(context.Background(), db.HealthMinFreeSpace(0))
+		if err != nil {
+			t.Fatalf("Failed to check health: %v", err)
+		}
+		for _, check := range report.Checks {
+			if check.Name == "backup_scheduler:nightly" {
+				return check.Status
+			}
+		}
+		return ""
+	}
+
+	if status := checkStatus(); status != "" {
+		t.Errorf("Expected no check before the scheduler starts, got %s", status)
+	}
+	s.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status().Next.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if status := checkStatus(); status != db.HealthOK {
+		t.Errorf("Expected a running scheduler to pass, got %s", status)
+	}
+
+	// A loop that stopped scheduling leaves a backup long overdue
+	s.mu.Lock()
+	s.status.Next = time.Now().Add(-2 * schedulerStallGrace)
+	s.mu.Unlock()
+	if status := checkStatus(); status != db.HealthFailed {
+		t.Errorf("Expected a stalled scheduler to fail, got %s", status)
+	}
+
+	s.Stop()
+	if status := checkStatus(); status != "" {
+		t.Errorf("Expected the check removed once stopped, got %s", status)
+	}
+}
@@ -0,0 +1,224 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// ErrObjectNotFound is returned by BackupTarget.Get for a missing key
+var ErrObjectNotFound = errors.New("backup object not found")
+
+// BackupTarget stores backups as objects under slash-separated keys, as a
+// directory or an S3-compatible bucket does. Implementations must be safe
+// for concurrent use.
+type BackupTarget interface {
+	// Put stores the content of r under key, replacing any object there.
+	// The object must become visible only once r has been read to EOF
+	// without error: a Put that fails or whose ctx is done leaves no
+	// object, so a partial backup is never listed. size is the length of
+	// the content, or -1 when it is not known upfront, so adapters can
+	// choose between a single and a multipart upload. r must be consumed
+	// as a stream rather than buffered whole where the store allows it.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+
+	// Get opens the object under key, failing with an error wrapping
+	// ErrObjectNotFound if there is none
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// List returns the keys starting with prefix, in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+
+	// Delete removes the object under key. A missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// BackupTo streams an archive of a database, as written by Dump, to a
+// target under key. The archive is never held in memory whole; if the
+// dump or the upload fails, nothing is stored under key. Only a completed
+// upload is recorded as the database's last backup.
+func BackupTo(ctx context.Context, d *db.DB, target BackupTarget, key string) (*Manifest, error) {
+	pr, pw := io.Pipe()
+	type result struct {
+		manifest *Manifest
+		err      error
+	}
+	dumped := make(chan result, 1)
+	go func() {
+		manifest, err := dump(ctx, d, pw)
+		pw.CloseWithError(err)
+		dumped <- result{manifest, err}
+	}()
+
+	err := target.Put(ctx, key, pr, -1)
+	// Unblock the dump if the upload stopped reading early
+	pr.CloseWithError(errors.New("upload ended"))
+	res := <-dumped
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up to %s: %w", key, err)
+	}
+	if res.err != nil {
+		// The target committed an object without reading all of it
+		target.Delete(context.WithoutCancel(ctx), key)
+		return nil, fmt.Errorf("failed to back up to %s: %w", key, res.err)
+	}
+	d.RecordBackup(res.manifest.CreatedAt)
+	return res.manifest, nil
+}
+
+// RestoreFrom restores the archive stored under key in a target, as
+// Restore does
+func RestoreFrom(ctx context.Context, d *db.DB, target BackupTarget, key string, opts RestoreOptions) (*Manifest, error) {
+	r, err := target.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Restore(ctx, d, contextReader{ctx, r}, opts)
+}
+
+// contextReader is a reader failing with its context's error once the
+// context is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the underlying reader unless the context is done
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// FileTarget is a BackupTarget storing objects as files in a directory,
+// keys mapping to paths below it. Objects are written to hidden temporary
+// files and renamed into place once complete.
+type FileTarget struct {
+	dir string
+}
+
+// Ensure FileTarget satisfies the BackupTarget interface
+var _ BackupTarget = (*FileTarget)(nil)
+
+// NewFileTarget creates a target storing objects in dir, creating the
+// directory if needed
+func NewFileTarget(dir string) (*FileTarget, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &FileTarget{dir: dir}, nil
+}
+
+// path returns the file of a key, rejecting keys that would leave the
+// directory or name a temporary file
+func (t *FileTarget) path(key string) (string, error) {
+	if key == "" || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." || path.IsAbs(key) ||
+		strings.HasPrefix(path.Base(key), ".") {
+		return "", fmt.Errorf("invalid backup key %q", key)
+	}
+	return filepath.Join(t.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes r to a temporary file and renames it to key's file once all
+// of it is written and synced
+func (t *FileTarget) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	p, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create backup file: %w", err)
+	}
+
+	n, err := io.Copy(f, contextReader{ctx, r})
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("expected %d bytes, read %d", size, n)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("failed to write %s: %w", key, err)
+	}
+	return nil
+}
+
+// Get opens key's file
+func (t *FileTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := t.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	return f, nil
+}
+
+// List walks the directory for the keys starting with prefix, skipping
+// temporary files
+func (t *FileTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(t.dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Delete removes key's file
+func (t *FileTarget) Delete(ctx context.Context, key string) error {
+	p, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %w", key, err)
+	}
+	return nil
+}
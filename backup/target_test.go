@@ -0,0 +1,302 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// memTarget is an in-memory BackupTarget. Like an object store, it makes an
+// object visible only once its upload completes.
+type memTarget struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	aborted int // Uploads that failed and were discarded
+
+	// onChunk, if set, is called after each chunk an upload reads
+	onChunk func()
+}
+
+// Ensure memTarget satisfies the BackupTarget interface
+var _ BackupTarget = (*memTarget)(nil)
+
+// newMemTarget creates an empty memTarget
+func newMemTarget() *memTarget {
+	return &memTarget{objects: make(map[string][]byte)}
+}
+
+// Put reads r in chunks, as a multipart upload would, committing the object
+// only at EOF
+func (m *memTarget) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	var buf bytes.Buffer
+	chunk := make([]byte, 4096)
+	for {
+		if err := ctx.Err(); err != nil {
+			return m.abort(err)
+		}
+		n, err := r.Read(chunk)
+		buf.Write(chunk[:n])
+		if m.onChunk != nil && n > 0 {
+			m.onChunk()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return m.abort(err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return m.abort(err)
+	}
+	if size >= 0 && int64(buf.Len()) != size {
+		return m.abort(fmt.Errorf("expected %d bytes, read %d", size, buf.Len()))
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = buf.Bytes()
+	return nil
+}
+
+// abort counts a discarded upload
+func (m *memTarget) abort(err error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.aborted++
+	return err
+}
+
+func (m *memTarget) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memTarget) List(ctx context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m *memTarget) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// dataDir reads a closed database's directory: the name of every file, and
+// the content of collection and index files without their revisions, which
+// count rewrites rather than describe the data
+func dataDir(t *testing.T, dir string) map[string]interface{} {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read data directory: %v", err)
+	}
+	out := make(map[string]interface{})
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", entry.Name(), err)
+		}
+		switch {
+		case strings.HasSuffix(entry.Name(), ".idx.json"):
+			var file map[string]interface{}
+			json.Unmarshal(data, &file)
+			delete(file, "revision")
+			out[entry.Name()] = file
+		case strings.HasSuffix(entry.Name(), ".json"):
+			var file storage.CollectionFile
+			json.Unmarshal(data, &file)
+			file.Metadata.Revision = 0
+			out[entry.Name()] = file
+		default:
+			out[entry.Name()] = len(data)
+		}
+	}
+	return out
+}
+
+func TestRestoreFromTargetReproducesDataDir(t *testing.T) {
+	sourceDir := t.TempDir()
+	source, err := db.Open(sourceDir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	populate(t, source)
+	target := newMemTarget()
+	if _, err := BackupTo(context.Background(), source, target, "nightly/1.jdbdump"); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	source.Close()
+
+	restoredDir := t.TempDir()
+	restored, err := db.Open(restoredDir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := RestoreFrom(context.Background(), restored, target, "nightly/1.jdbdump", RestoreOptions{}); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	restored.Close()
+
+	expected, got := dataDir(t, sourceDir), dataDir(t, restoredDir)
+	if !reflect.DeepEqual(expected, got) {
+		t.Errorf("Expected the restored data directory to match:\n%v\ngot:\n%v", expected, got)
+	}
+
+	if _, err := RestoreFrom(context.Background(), restored, target, "missing", RestoreOptions{}); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+}
+
+func TestBackupToCancelledMidUpload(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	populate(t, database)
+	users, _ := database.Collection("users")
+	for i := 0; i < 500; i++ {
+		users.Insert(map[string]interface{}{"name": fmt.Sprintf("user %d", i), "bio": strings.Repeat("x", 100)})
+	}
+
+	targets := map[string]BackupTarget{"memory": newMemTarget(), "file": fileTarget(t, t.TempDir())}
+	for name, target := range targets {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var once sync.Once
+			reader := &cancellingTarget{BackupTarget: target, cancel: func() { once.Do(cancel) }}
+
+			if _, err := BackupTo(ctx, database, reader, "backup.jdbdump"); !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected the backup to be cancelled, got %v", err)
+			}
+			if reader.read == 0 {
+				t.Fatalf("Expected the upload to have started")
+			}
+			keys, err := target.List(context.Background(), "")
+			if err != nil || len(keys) != 0 {
+				t.Errorf("Expected no committed backup, got %v: %v", keys, err)
+			}
+			if ft, ok := target.(*FileTarget); ok {
+				if entries, _ := os.ReadDir(ft.dir); len(entries) != 0 {
+					t.Errorf("Expected no temporary files to be left, got %d", len(entries))
+				}
+			}
+		})
+	}
+
+	// A cancelled scheduled backup is an error, with nothing to prune or list
+	target := newMemTarget()
+	s, err := NewScheduler(database, target, SchedulerOptions{Schedule: Every(time.Hour)})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	target.onChunk = cancel
+	if _, err := s.BackupNow(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the backup to be cancelled, got %v", err)
+	}
+	if keys, _ := target.List(context.Background(), ""); len(keys) != 0 || target.aborted != 1 || s.Status().LastError == "" {
+		t.Errorf("Expected an aborted upload and a reported error, got %v, %d and %+v", keys, target.aborted, s.Status())
+	}
+}
+
+// cancellingTarget cancels a context once an upload has read some data
+type cancellingTarget struct {
+	BackupTarget
+	cancel func()
+	read   int
+}
+
+func (c *cancellingTarget) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	return c.BackupTarget.Put(ctx, key, readFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if c.read += n; c.read > 0 {
+			c.cancel()
+		}
+		return n, err
+	}), size)
+}
+
+// readFunc is an io.Reader calling a function
+type readFunc func(p []byte) (int, error)
+
+func (f readFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestFileTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := fileTarget(t, dir)
+	ctx := context.Background()
+
+	for _, key := range []string{"b.jdbdump", "daily/a.jdbdump", "daily/b.jdbdump"} {
+		if err := target.Put(ctx, key, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Fatalf("Failed to put %s: %v", key, err)
+		}
+	}
+	keys, err := target.List(ctx, "daily/")
+	if err != nil || !reflect.DeepEqual(keys, []string{"daily/a.jdbdump", "daily/b.jdbdump"}) {
+		t.Errorf("Expected the daily keys, got %v: %v", keys, err)
+	}
+
+	r, err := target.Get(ctx, "daily/a.jdbdump")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "daily/a.jdbdump" {
+		t.Errorf("Expected the stored content, got %q", data)
+	}
+
+	if err := target.Delete(ctx, "daily/a.jdbdump"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := target.Delete(ctx, "daily/a.jdbdump"); err != nil {
+		t.Errorf("Expected deleting a missing key to succeed, got %v", err)
+	}
+	if _, err := target.Get(ctx, "daily/a.jdbdump"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("Expected ErrObjectNotFound, got %v", err)
+	}
+
+	// A short upload commits nothing
+	if err := target.Put(ctx, "short.jdbdump", strings.NewReader("abc"), 10); err == nil {
+		t.Errorf("Expected a size mismatch to fail")
+	}
+	if keys, _ := target.List(ctx, "short"); len(keys) != 0 {
+		t.Errorf("Expected no object, got %v", keys)
+	}
+
+	for _, key := range []string{"", "../escape", "/abs", "a/../b", ".hidden"} {
+		if err := target.Put(ctx, key, strings.NewReader(""), 0); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package benchmark
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/fixtures"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+var (
+	sizesFlag      = flag.String("bench.sizes", "1000,10000,100000", "comma-separated fixture sizes")
+	goroutinesFlag = flag.String("bench.goroutines", "1,4,16", "comma-separated goroutine counts for concurrent workloads")
+)
+
+// parseInts parses a comma-separated list of positive integers
+func parseInts(b *testing.B, list string) []int {
+	b.Helper()
+	var ints []int
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			b.Fatalf("Invalid count %q in %q", s, list)
+		}
+		ints = append(ints, n)
+	}
+	return ints
+}
+
+// BenchmarkWorkloads runs every workload at each fixture size, for example:
+//
+//	go test ./benchmark -run '^$' -bench 'Workloads/size=10000/' -bench.goroutines 8
+func BenchmarkWorkloads(b *testing.B) {
+	for _, size := range parseInts(b, *sizesFlag) {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			database, err := db.Open(b.TempDir())
+			if err != nil {
+				b.Fatalf("Failed to open database: %v", err)
+			}
+			defer database.Close()
+			f, err := Setup(database, "bench", size)
+			if err != nil {
+				b.Fatalf("Failed to set up fixture: %v", err)
+			}
+
+			for _, w := range Workloads() {
+				if !w.Concurrent {
+					b.Run(w.Name, func(b *testing.B) { benchmarkWorkload(b, f, w, 1) })
+					continue
+				}
+				for _, n := range parseInts(b, *goroutinesFlag) {
+					b.Run(fmt.Sprintf("%s/goroutines=%d", w.Name, n), func(b *testing.B) { benchmarkWorkload(b, f, w, n) })
+				}
+			}
+		})
+	}
+}
+
+// benchmarkWorkload runs b.N operations of a workload, reporting throughput,
+// latency and allocations
+func benchmarkWorkload(b *testing.B, f *Fixture, w Workload, concurrency int) {
+	if w.Setup != nil {
+		if err := w.Setup(f); err != nil {
+			b.Fatalf("Failed to set up %s: %v", w.Name, err)
+		}
+	}
+	if w.Teardown != nil {
+		defer w.Teardown(f)
+	}
+	w.Setup, w.Teardown = nil, nil
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	r, err := Run(f, w, Config{Ops: b.N, Concurrency: concurrency, Seed: 1})
+	b.StopTimer()
+	if err != nil {
+		b.Fatalf("Failed to run %s: %v", w.Name, err)
+	}
+	b.ReportMetric(r.OpsPerSec, "ops/s")
+	b.ReportMetric(float64(r.P99)/float64(time.Microsecond), "p99-µs")
+	b.ReportMetric(r.AllocsPerOp, "allocs/op")
+	b.ReportMetric(r.BytesPerOp, "B/op")
+}
+
+func TestRun(t *testing.T) {
+	database, err := db.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	f, err := Setup(database, "bench", 50)
+	if err != nil {
+		t.Fatalf("Failed to set up fixture: %v", err)
+	}
+	if _, err := Setup(database, "bench", 50); !errors.Is(err, db.ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+
+	// Every workload runs, leaving the fixture as it found it
+	for _, w := range Workloads() {
+		r, err := Run(f, w, Config{Ops: 20, Concurrency: 3})
+		if err != nil {
+			t.Fatalf("Failed to run %s: %v", w.Name, err)
+		}
+		concurrency := 1
+		if w.Concurrent {
+			concurrency = 3
+		}
+		if r.Ops != 20 || r.Concurrency != concurrency || r.OpsPerSec <= 0 || r.P99 < r.P50 {
+			t.Errorf("Expected 20 operations on %d goroutines for %s, got %+v", concurrency, w.Name, r)
+		}
+		if count, _ := f.Collection.Count(core.Query{}); count != 50 {
+			t.Errorf("Expected %s to keep 50 documents, got %d", w.Name, count)
+		}
+	}
+	if indexes, _ := database.Indexes().ListIndexes("bench"); len(indexes) > 1 {
+		t.Errorf("Expected the indexed query to drop its index, got %v", indexes)
+	}
+
+	r, err := Run(f, Workloads()[0], Config{Duration: 20 * time.Millisecond})
+	if err != nil || r.Ops == 0 || r.Elapsed < 20*time.Millisecond {
+		t.Errorf("Expected a timed run, got %+v, %v", r, err)
+	}
+	if _, err := Run(f, Workloads()[0], Config{}); err == nil {
+		t.Errorf("Expected an error without an operation count or duration")
+	}
+}
+
+// BenchmarkWriteCoalescing runs the write workloads with every write going
+// to disk and with writes coalesced for 50ms
+func BenchmarkWriteCoalescing(b *testing.B) {
+	modes := []struct {
+		name string
+		opts []db.Option
+	}{
+		{"direct", nil},
+		{"coalesced", []db.Option{db.WithStorageOptions(storage.WithWriteCoalescing(50*time.Millisecond, 0))}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			database, err := db.Open(b.TempDir(), mode.opts...)
+			if err != nil {
+				b.Fatalf("Failed to open database: %v", err)
+			}
+			defer database.Close()
+			f, err := Setup(database, "bench", 1000)
+			if err != nil {
+				b.Fatalf("Failed to set up fixture: %v", err)
+			}
+			for _, w := range Workloads() {
+				if strings.HasPrefix(w.Name, "write/") {
+					b.Run(w.Name, func(b *testing.B) { benchmarkWorkload(b, f, w, 1) })
+				}
+			}
+		})
+	}
+}
+
+// generatedUser is the template of the documents BenchmarkInsertGenerated
+// inserts
+var generatedUser = core.Document{
+	"_id":   "{{uuid}}",
+	"name":  "user {{seq}}",
+	"age":   "{{randInt 18 90}}",
+	"plan":  `{{oneof "free" "pro" "team"}}`,
+	"email": "user{{seq}}@example.com",
+}
+
+// BenchmarkInsertGenerated inserts batches of batchSize new documents made
+// by a fixtures.Generator, so the collection grows as it runs
+func BenchmarkInsertGenerated(b *testing.B) {
+	database, err := db.Open(b.TempDir())
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	users, err := database.CreateCollection("users")
+	if err != nil {
+		b.Fatalf("Failed to create collection: %v", err)
+	}
+	g, err := fixtures.NewGenerator(generatedUser, 1)
+	if err != nil {
+		b.Fatalf("Failed to create generator: %v", err)
+	}
+	batches := make([][]core.Document, b.N)
+	for i := range batches {
+		batches[i] = g.Generate(batchSize)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, docs := range batches {
+		err := users.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			writes := make(map[core.DocumentID]core.Document, len(docs))
+			for _, doc := range docs {
+				writes[core.DocumentID(doc["_id"].(string))] = doc
+			}
+			return writes, nil
+		})
+		if err != nil {
+			b.Fatalf("Failed to insert batch: %v", err)
+		}
+	}
+}
+
+// BenchmarkPreparedQuery runs an indexed query with a regular expression,
+// built, validated and planned on every run or prepared once with the
+// indexed value as a parameter
+func BenchmarkPreparedQuery(b *testing.B) {
+	database, err := db.Open(b.TempDir())
+	if err != nil {
+		b.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	f, err := Setup(database, "bench", 10000)
+	if err != nil {
+		b.Fatalf("Failed to set up fixture: %v", err)
+	}
+	if err := createGroupIndex(f); err != nil {
+		b.Fatalf("Failed to create index: %v", err)
+	}
+
+	build := func(group interface{}) core.Query {
+		return core.Query{Collection: "bench", Filters: []core.Filter{
+			{Field: "group", Operator: core.OpEqual, Value: group},
+			{Field: "name", Operator: core.OpRegex, Value: `^user \d+5$`},
+		}}
+	}
+	group := func(i int) string { return fmt.Sprintf("g%02d", i%groups) }
+
+	b.Run("built", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := database.Executor().Execute(build(group(i))); err != nil {
+				b.Fatalf("Failed to execute query: %v", err)
+			}
+		}
+	})
+	b.Run("prepared", func(b *testing.B) {
+		prepared, err := database.Executor().Prepare(build(core.Param("group")))
+		if err != nil {
+			b.Fatalf("Failed to prepare query: %v", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := prepared.Execute(map[string]interface{}{"group": group(i)}); err != nil {
+				b.Fatalf("Failed to execute query: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,126 @@
+package benchmark
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+var largeMBFlag = flag.Int("bench.large-mb", 200, "size in MB of the collection BenchmarkLargeScan reads")
+
+// largePadding makes the documents of the large collection about 1 KB each
+var largePadding = strings.Repeat("x", 800)
+
+// writeLargeCollection writes a collection file of about mb megabytes
+// straight to dir, rather than through an engine that would rewrite it per
+// batch, returning the number of documents
+func writeLargeCollection(b *testing.B, dir, collection string, mb int) int {
+	b.Helper()
+	doc := Document(0)
+	doc["padding"] = largePadding
+	sample, _ := json.Marshal(doc)
+	n := mb << 20 / len(sample)
+
+	f, err := os.Create(filepath.Join(dir, collection+".json"))
+	if err != nil {
+		b.Fatalf("Failed to create collection file: %v", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	meta, _ := json.Marshal(storage.CollectionMetadata{Collection: collection, Version: 1, DocumentCount: n, Revision: 1})
+	fmt.Fprintf(w, `{"metadata":%s,"documents":{`, meta)
+	for i := 0; i < n; i++ {
+		doc := Document(i)
+		doc["padding"] = largePadding
+		data, err := json.Marshal(doc)
+		if err != nil {
+			b.Fatalf("Failed to marshal document: %v", err)
+		}
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		fmt.Fprintf(w, "%q:%s", DocID(i), data)
+	}
+	w.WriteString("}}")
+	if err := w.Flush(); err != nil {
+		b.Fatalf("Failed to write collection file: %v", err)
+	}
+	return n
+}
+
+// resetPeakRSS frees what it can and resets the process's peak resident
+// set size, reporting whether peakRSS can be measured
+func resetPeakRSS() bool {
+	debug.FreeOSMemory()
+	return os.WriteFile("/proc/self/clear_refs", []byte("5"), 0) == nil
+}
+
+// peakRSS returns the process's peak resident set size in bytes since it
+// was last reset
+func peakRSS() (int64, bool) {
+	data, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if rest, ok := strings.CutPrefix(line, "VmHWM:"); ok {
+			kb, err := strconv.ParseInt(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(rest), "kB")), 10, 64)
+			return kb << 10, err == nil
+		}
+	}
+	return 0, false
+}
+
+// BenchmarkLargeScan scans a collection of -bench.large-mb megabytes read
+// into a buffer and mapped, reporting the peak RSS of each:
+//
+//	go test ./benchmark -run '^$' -bench LargeScan -benchtime 5x
+func BenchmarkLargeScan(b *testing.B) {
+	dir := b.TempDir()
+	n := writeLargeCollection(b, dir, "large", *largeMBFlag)
+
+	modes := []struct {
+		name string
+		opts []storage.Option
+	}{
+		{"readfile", nil},
+		{"mmap", []storage.Option{storage.WithMmapReads()}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			engine, err := storage.NewFileStorageEngine(dir, append(mode.opts, storage.WithReadOnly())...)
+			if err != nil {
+				b.Fatalf("Failed to create engine: %v", err)
+			}
+			defer engine.Close()
+
+			measured := resetPeakRSS()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				count := 0
+				err := engine.ScanCollection("large", func(core.DocumentID, core.Document) bool {
+					count++
+					return true
+				})
+				if err != nil || count != n {
+					b.Fatalf("Failed to scan %d documents, got %d: %v", n, count, err)
+				}
+			}
+			b.StopTimer()
+			if rss, ok := peakRSS(); measured && ok {
+				b.ReportMetric(float64(rss)/(1<<20), "peak-rss-MB")
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config controls how long a workload runs
+type Config struct {
+	// Ops is the number of operations to run, shared by the goroutines.
+	// If zero, the workload runs for Duration.
+	Ops      int
+	Duration time.Duration
+	// Concurrency is the number of goroutines of concurrent workloads,
+	// defaulting to GOMAXPROCS
+	Concurrency int
+	Seed        uint64
+}
+
+// Result is the outcome of running a workload
+type Result struct {
+	Workload    string        `json:"workload"`
+	Size        int           `json:"size"`
+	Concurrency int           `json:"concurrency"`
+	Ops         int           `json:"ops"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	OpsPerSec   float64       `json:"ops_per_sec"`
+	P50         time.Duration `json:"p50_ns"`
+	P99         time.Duration `json:"p99_ns"`
+	AllocsPerOp float64       `json:"allocs_per_op"`
+	BytesPerOp  float64       `json:"bytes_per_op"`
+}
+
+// Key identifies the workload, size and concurrency of a result, for
+// comparing runs
+func (r Result) Key() string {
+	return fmt.Sprintf("%s/%d/c%d", r.Workload, r.Size, r.Concurrency)
+}
+
+// Run runs a workload against a fixture, failing on the first operation
+// that fails
+func Run(f *Fixture, w Workload, cfg Config) (Result, error) {
+	if cfg.Ops <= 0 && cfg.Duration <= 0 {
+		return Result{}, fmt.Errorf("missing operation count or duration - unable to run %s", w.Name)
+	}
+	workers := 1
+	if w.Concurrent {
+		workers = cfg.Concurrency
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+	}
+
+	if w.Setup != nil {
+		if err := w.Setup(f); err != nil {
+			return Result{}, fmt.Errorf("failed to set up %s: %w", w.Name, err)
+		}
+	}
+
+	// Operations are numbered across the goroutines; a run for a duration
+	// stops handing them out once it is over
+	var next atomic.Int64
+	var deadline time.Time
+	take := func() (int, bool) {
+		i := int(next.Add(1) - 1)
+		if cfg.Ops > 0 {
+			return i, i < cfg.Ops
+		}
+		return i, time.Now().Before(deadline)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		latencies = make([][]time.Duration, workers)
+		errs      = make([]error, workers)
+		failed    atomic.Bool
+		before    runtime.MemStats
+		after     runtime.MemStats
+	)
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	deadline = start.Add(cfg.Duration)
+	for g := 0; g < workers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(cfg.Seed, uint64(g)))
+			for !failed.Load() {
+				i, ok := take()
+				if !ok {
+					return
+				}
+				opStart := time.Now()
+				if err := w.Op(f, rng, i); err != nil {
+					errs[g] = fmt.Errorf("operation %d of %s failed: %w", i, w.Name, err)
+					failed.Store(true)
+					return
+				}
+				latencies[g] = append(latencies[g], time.Since(opStart))
+			}
+		}(g)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	if w.Teardown != nil {
+		if err := w.Teardown(f); err != nil {
+			errs = append(errs, fmt.Errorf("failed to tear down %s: %w", w.Name, err))
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	all := slices.Concat(latencies...)
+	slices.Sort(all)
+	result := Result{
+		Workload:    w.Name,
+		Size:        f.Size,
+		Concurrency: workers,
+		Ops:         len(all),
+		Elapsed:     elapsed,
+		P50:         percentile(all, 50),
+		P99:         percentile(all, 99),
+	}
+	if len(all) > 0 {
+		result.OpsPerSec = float64(len(all)) / elapsed.Seconds()
+		result.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(len(all))
+		result.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(len(all))
+	}
+	return result, nil
+}
+
+// percentile returns the p-th percentile of sorted latencies, or zero if
+// there are none
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)]
+}
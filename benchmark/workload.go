@@ -0,0 +1,196 @@
+package benchmark
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// seedBatchSize is the number of documents Setup writes per batch
+const seedBatchSize = 10000
+
+// groups is the number of distinct values of the group field, so a query on
+// one group matches 1% of the collection
+const groups = 100
+
+// Fixture is a collection seeded for running workloads. Workloads update
+// documents in place rather than adding them, so a fixture keeps its size
+// and can be shared by the workloads run on it.
+type Fixture struct {
+	DB         *db.DB
+	Collection *db.Collection
+	Size       int
+}
+
+// Setup creates a collection of size documents for running workloads,
+// failing if it already exists
+func Setup(database *db.DB, collection string, size int) (*Fixture, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid fixture size %d", size)
+	}
+	names, err := database.Collections()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	if slices.Contains(names, collection) {
+		return nil, fmt.Errorf("%w: %s", db.ErrCollectionExists, collection)
+	}
+	coll, err := database.CreateCollection(collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fixture collection: %w", err)
+	}
+
+	for start := 0; start < size; start += seedBatchSize {
+		end := min(start+seedBatchSize, size)
+		err := coll.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			writes := make(map[core.DocumentID]core.Document, end-start)
+			for i := start; i < end; i++ {
+				writes[DocID(i)] = Document(i)
+			}
+			return writes, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed fixture: %w", err)
+		}
+	}
+	return &Fixture{DB: database, Collection: coll, Size: size}, nil
+}
+
+// DocID returns the ID of the i-th document of a fixture
+func DocID(i int) core.DocumentID {
+	return core.DocumentID(fmt.Sprintf("doc%08d", i))
+}
+
+// Document returns the i-th document of a fixture
+func Document(i int) core.Document {
+	return core.Document{
+		"_id":   string(DocID(i)),
+		"n":     float64(i),
+		"group": fmt.Sprintf("g%02d", i%groups),
+		"name":  fmt.Sprintf("user %d", i),
+		"tags":  []interface{}{"bench", fmt.Sprintf("t%d", i%7)},
+		"profile": map[string]interface{}{
+			"score":  float64(i%1000) / 10,
+			"active": i%2 == 0,
+		},
+	}
+}
+
+// OpFunc runs the i-th operation of a workload. Each goroutine has its own
+// rng.
+type OpFunc func(f *Fixture, rng *rand.Rand, i int) error
+
+// Workload is a benchmarked operation run repeatedly against a fixture
+type Workload struct {
+	Name string
+	// Concurrent workloads run on Config.Concurrency goroutines; the
+	// others run on one
+	Concurrent bool
+	// Setup and Teardown, if set, run before and after the timed
+	// operations, to add and remove what the workload needs
+	Setup    func(f *Fixture) error
+	Teardown func(f *Fixture) error
+	Op       OpFunc
+}
+
+// batchSize is the number of documents written per operation by the batch
+// workload
+const batchSize = 100
+
+// Workloads returns the standard workloads, in report order
+func Workloads() []Workload {
+	return []Workload{
+		{Name: "write/sequential", Op: sequentialWrite},
+		{Name: "write/random", Op: randomWrite},
+		{Name: fmt.Sprintf("write/batch-%d", batchSize), Op: batchWrite},
+		{Name: "read/random", Op: randomRead},
+		{Name: "mixed/read-heavy", Op: mixed(90)},
+		{Name: "scan", Op: scan},
+		{Name: "query/unindexed", Op: groupQuery},
+		{Name: "query/indexed", Setup: createGroupIndex, Teardown: dropGroupIndex, Op: groupQuery},
+		{Name: "mixed/concurrent", Concurrent: true, Op: mixed(80)},
+	}
+}
+
+// update returns a changed copy of the i-th document
+func update(i int, rng *rand.Rand) core.Document {
+	doc := Document(i)
+	doc["n"] = rng.Float64()
+	return doc
+}
+
+// sequentialWrite updates the documents in ID order
+func sequentialWrite(f *Fixture, rng *rand.Rand, i int) error {
+	n := i % f.Size
+	return f.Collection.Update(DocID(n), update(n, rng))
+}
+
+// randomWrite updates a random document
+func randomWrite(f *Fixture, rng *rand.Rand, _ int) error {
+	n := rng.IntN(f.Size)
+	return f.Collection.Update(DocID(n), update(n, rng))
+}
+
+// batchWrite updates batchSize random documents in one batch
+func batchWrite(f *Fixture, rng *rand.Rand, _ int) error {
+	return f.Collection.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document, batchSize)
+		for j := 0; j < batchSize; j++ {
+			n := rng.IntN(f.Size)
+			writes[DocID(n)] = update(n, rng)
+		}
+		return writes, nil
+	})
+}
+
+// randomRead reads a random document
+func randomRead(f *Fixture, rng *rand.Rand, _ int) error {
+	_, err := f.Collection.Get(DocID(rng.IntN(f.Size)))
+	return err
+}
+
+// mixed returns an operation reading a random document readPercent percent
+// of the time and updating one otherwise
+func mixed(readPercent int) OpFunc {
+	return func(f *Fixture, rng *rand.Rand, i int) error {
+		if rng.IntN(100) < readPercent {
+			return randomRead(f, rng, i)
+		}
+		return randomWrite(f, rng, i)
+	}
+}
+
+// scan reads every document of the fixture
+func scan(f *Fixture, _ *rand.Rand, _ int) error {
+	n := 0
+	err := f.DB.Storage().ScanCollection(f.Collection.Name(), func(core.DocumentID, core.Document) bool {
+		n++
+		return true
+	})
+	if err == nil && n != f.Size {
+		err = fmt.Errorf("scanned %d documents, expected %d", n, f.Size)
+	}
+	return err
+}
+
+// groupQuery finds the documents of a random group
+func groupQuery(f *Fixture, rng *rand.Rand, _ int) error {
+	_, err := f.Collection.Find(core.Query{Filters: []core.Filter{
+		{Field: "group", Operator: core.OpEqual, Value: fmt.Sprintf("g%02d", rng.IntN(groups))},
+	}})
+	return err
+}
+
+// createGroupIndex indexes the field groupQuery filters on
+func createGroupIndex(f *Fixture) error {
+	return f.DB.Indexes().CreateSecondaryIndex(f.Collection.Name(), "group", core.IndexHash)
+}
+
+// dropGroupIndex removes the index createGroupIndex adds, so the workloads
+// that follow do not maintain it
+func dropGroupIndex(f *Fixture) error {
+	return f.DB.Indexes().DropIndex(f.Collection.Name(), "group")
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/benchmark"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// collectionPrefix starts the names of the collections workloads run on,
+// which are dropped afterwards
+const collectionPrefix = "jsondb_bench_"
+
+// options are the parsed command line
+type options struct {
+	dir        string
+	sizes      []int
+	goroutines []int
+	duration   time.Duration
+	ops        int
+	workloads  *regexp.Regexp
+	baseline   string
+	out        string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs a command line and returns the exit code
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("jsondb-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	sizes := fs.String("sizes", "1000,10000,100000", "comma-separated collection `sizes`")
+	goroutines := fs.String("goroutines", "1,4,16", "comma-separated goroutine `counts` for concurrent workloads")
+	duration := fs.Duration("duration", 2*time.Second, "how long to run each workload")
+	ops := fs.Int("ops", 0, "run each workload for this many operations instead of -duration")
+	workloads := fs.String("workloads", "", "run only the workloads matching this `regexp`")
+	baseline := fs.String("baseline", "", "compare with the results saved by -out in this `file`")
+	out := fs.String("out", "", "save the results as JSON to this `file`")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: jsondb-bench [options] [directory]")
+		fmt.Fprintln(stderr, "\nRuns the benchmark workloads against scratch collections in directory,\ndefaulting to a temporary one, and prints a table of the results.")
+		fmt.Fprintln(stderr, "\nOptions:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	opts := options{dir: fs.Arg(0), duration: *duration, ops: *ops, baseline: *baseline, out: *out}
+	var err error
+	if opts.sizes, err = parseCounts(*sizes); err == nil {
+		opts.goroutines, err = parseCounts(*goroutines)
+	}
+	if err == nil {
+		opts.workloads, err = regexp.Compile(*workloads)
+	}
+	if err == nil && opts.ops <= 0 && opts.duration <= 0 {
+		err = fmt.Errorf("-duration or -ops must be positive")
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "jsondb-bench: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	if err := bench(opts, stdout, stderr); err != nil {
+		fmt.Fprintf(stderr, "jsondb-bench: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseCounts parses a comma-separated list of positive integers
+func parseCounts(list string) ([]int, error) {
+	var counts []int
+	for _, s := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid count %q in %q", s, list)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+// bench runs the workloads at each size and writes the results
+func bench(opts options, stdout, stderr io.Writer) error {
+	var baseline []benchmark.Result
+	if opts.baseline != "" {
+		data, err := os.ReadFile(opts.baseline)
+		if err != nil {
+			return fmt.Errorf("failed to read baseline: %w", err)
+		}
+		if err := json.Unmarshal(data, &baseline); err != nil {
+			return fmt.Errorf("failed to parse baseline %s: %w", opts.baseline, err)
+		}
+	}
+
+	dir := opts.dir
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "jsondb-bench-")
+		if err != nil {
+			return fmt.Errorf("failed to create data directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+	database, err := db.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var results []benchmark.Result
+	for _, size := range opts.sizes {
+		sized, err := benchSize(database, opts, size, stderr)
+		results = append(results, sized...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.out != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode results: %w", err)
+		}
+		if err := os.WriteFile(opts.out, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write results: %w", err)
+		}
+	}
+	return writeResults(stdout, results, baseline)
+}
+
+// benchSize runs the workloads on a scratch collection of size documents,
+// dropping it afterwards
+func benchSize(database *db.DB, opts options, size int, stderr io.Writer) (results []benchmark.Result, err error) {
+	name := fmt.Sprintf("%s%d", collectionPrefix, size)
+	fmt.Fprintf(stderr, "seeding %d documents...\n", size)
+	f, err := benchmark.Setup(database, name, size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if dropErr := database.DropCollection(name); err == nil {
+			err = dropErr
+		}
+	}()
+
+	cfg := benchmark.Config{Ops: opts.ops, Duration: opts.duration, Seed: 1}
+	for _, w := range benchmark.Workloads() {
+		if !opts.workloads.MatchString(w.Name) {
+			continue
+		}
+		concurrency := []int{1}
+		if w.Concurrent {
+			concurrency = opts.goroutines
+		}
+		for _, n := range concurrency {
+			fmt.Fprintf(stderr, "running %s on %d documents with %d goroutines...\n", w.Name, size, n)
+			cfg.Concurrency = n
+			r, err := benchmark.Run(f, w, cfg)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+// writeResults writes results as a table, with each result's change in
+// throughput from the baseline result of the same workload, size and
+// concurrency when there is one
+func writeResults(w io.Writer, results, baseline []benchmark.Result) error {
+	base := make(map[string]benchmark.Result, len(baseline))
+	for _, r := range baseline {
+		base[r.Key()] = r
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "WORKLOAD\tSIZE\tGOROUTINES\tOPS/S\tP50\tP99\tALLOCS/OP\tB/OP"
+	if baseline != nil {
+		header += "\tBASELINE OPS/S\tCHANGE"
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%.0f\t%.0f", r.Workload, r.Size, r.Concurrency, r.OpsPerSec, round(r.P50), round(r.P99), r.AllocsPerOp, r.BytesPerOp)
+		if baseline != nil {
+			if b, ok := base[r.Key()]; ok && b.OpsPerSec > 0 {
+				fmt.Fprintf(tw, "\t%.1f\t%+.1f%%", b.OpsPerSec, (r.OpsPerSec/b.OpsPerSec-1)*100)
+			} else {
+				fmt.Fprint(tw, "\t-\t-")
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// round shortens a latency to three significant digits
+func round(d time.Duration) time.Duration {
+	for unit := time.Nanosecond; unit < time.Second; unit *= 10 {
+		if d < 1000*unit {
+			return d.Round(unit)
+		}
+	}
+	return d.Round(time.Millisecond)
+}
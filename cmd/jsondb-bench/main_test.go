@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/benchmark"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(t.TempDir(), "results.json")
+	args := []string{"-sizes", "20,30", "-goroutines", "1,2", "-ops", "5", "-workloads", "read/|concurrent", "-out", out, dir}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 7 || !strings.HasPrefix(lines[0], "WORKLOAD") || strings.Contains(lines[0], "CHANGE") {
+		t.Errorf("Expected a header and 6 results, got:\n%s", stdout.String())
+	}
+
+	var results []benchmark.Result
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatalf("Failed to parse results: %v", err)
+	}
+	var keys []string
+	for _, r := range results {
+		keys = append(keys, r.Key())
+	}
+	expected := "read/random/20/c1 mixed/concurrent/20/c1 mixed/concurrent/20/c2 read/random/30/c1 mixed/concurrent/30/c1 mixed/concurrent/30/c2"
+	if got := strings.Join(keys, " "); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+
+	// The scratch collections are gone
+	database, err := db.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if names, _ := database.Collections(); len(names) != 0 {
+		t.Errorf("Expected the scratch collections dropped, got %v", names)
+	}
+	database.Close()
+
+	// A run compares with the saved one where they overlap
+	stdout.Reset()
+	args = []string{"-sizes", "20,40", "-ops", "5", "-workloads", "read/", "-baseline", out}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected exit code %d, got %d: %s", exitOK, code, stderr.String())
+	}
+	lines = strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], "CHANGE") || !strings.HasSuffix(lines[1], "%") || !strings.HasSuffix(lines[2], "-") {
+		t.Errorf("Expected a comparison with the first result only, got:\n%s", stdout.String())
+	}
+}
+
+func TestBenchUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"help", []string{"-h"}, exitOK},
+		{"bad size", []string{"-sizes", "10,x"}, exitUsage},
+		{"bad goroutines", []string{"-goroutines", "0"}, exitUsage},
+		{"bad regexp", []string{"-workloads", "("}, exitUsage},
+		{"no limit", []string{"-duration", "0"}, exitUsage},
+		{"two directories", []string{"a", "b"}, exitUsage},
+		{"missing baseline", []string{"-sizes", "10", "-ops", "1", "-baseline", filepath.Join(t.TempDir(), "missing.json")}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(tt.args, &stdout, &stderr); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/backup"
+)
+
+// Flags of the restore command
+var (
+	restoreInclude string
+	restoreExclude string
+	restoreDrop    bool
+)
+
+// restoreFlags defines the flags of the restore command
+func restoreFlags(fs *flag.FlagSet) {
+	fs.StringVar(&restoreInclude, "include", "", "restore only the collections matching these comma-separated `patterns`")
+	fs.StringVar(&restoreExclude, "exclude", "", "skip the collections matching these comma-separated `patterns`")
+	fs.BoolVar(&restoreDrop, "drop", false, "replace existing collections instead of failing")
+}
+
+// runDump writes an archive of the database to a file, or stdout for -.
+// The file is written under a temporary name and renamed once complete.
+func runDump(e *env, args []string) error {
+	if args[1] == "-" {
+		_, err := backup.Dump(context.Background(), e.db, e.stdout)
+		return err
+	}
+
+	tmp := args[1] + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	manifest, err := backup.Dump(context.Background(), e.db, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, args[1])
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	fmt.Fprintf(e.stdout, "dumped %d collections (%d documents) to %s\n", len(manifest.Collections), manifest.Documents(), args[1])
+	return nil
+}
+
+// runRestore restores the collections of an archive read from a file, or
+// stdin for -
+func runRestore(e *env, args []string) error {
+	var in io.Reader = e.stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	opts := backup.RestoreOptions{Include: splitList(restoreInclude), Exclude: splitList(restoreExclude), Drop: restoreDrop}
+	manifest, err := backup.Restore(context.Background(), e.db, in, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "restored %d collections (%d documents)\n", len(manifest.Collections), manifest.Documents())
+	return nil
+}
+
+// splitList splits a comma-separated flag value, nil when empty
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/qlang"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// Flags of the query command
+var (
+	querySort   string
+	queryLimit  int
+	queryFormat string
+)
+
+// queryFlags defines the flags of the query command
+func queryFlags(fs *flag.FlagSet) {
+	fs.StringVar(&querySort, "sort", "", "comma-separated `fields` to sort by, each descending with a - prefix")
+	fs.IntVar(&queryLimit, "limit", 0, "return at most `n` documents")
+	fs.StringVar(&queryFormat, "format", "table", "output `format`: table, json or jsonl")
+}
+
+// runList lists the collections with their document counts and sizes
+func runList(e *env, _ []string) error {
+	names, err := e.db.Collections()
+	if err != nil {
+		return err
+	}
+	slices.Sort(names)
+
+	rows := [][]string{{"NAME", "DOCUMENTS", "SIZE"}}
+	for _, name := range names {
+		docs, size, err := collectionStats(e, name)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []string{name, strconv.Itoa(docs), formatSize(size)})
+	}
+	return writeTable(e.stdout, rows)
+}
+
+// runGet prints a document as indented JSON
+func runGet(e *env, args []string) error {
+	c, err := e.db.Collection(args[0])
+	if err != nil {
+		return err
+	}
+	doc, err := c.Get(core.DocumentID(args[1]))
+	if err != nil {
+		return err
+	}
+	return writeJSON(e.stdout, doc)
+}
+
+// runPut creates or replaces a document, stored with its ID under the ID
+// key, creating the collection if needed
+func runPut(e *env, args []string) error {
+	data := []byte(args[2])
+	if args[2] == "-" {
+		var err error
+		if data, err = io.ReadAll(e.stdin); err != nil {
+			return fmt.Errorf("failed to read document: %w", err)
+		}
+	}
+	var doc core.Document
+	if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+		if err == nil {
+			err = errors.New("not a JSON object")
+		}
+		return fmt.Errorf("%w: invalid document: %w", errUsage, err)
+	}
+
+	c, err := e.db.CreateCollection(args[0])
+	if err != nil {
+		return err
+	}
+	id := core.DocumentID(args[1])
+	doc[core.DefaultIDKey] = string(id)
+	return c.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{id: doc}, nil
+	})
+}
+
+// runDelete deletes a document
+func runDelete(e *env, args []string) error {
+	c, err := e.db.Collection(args[0])
+	if err != nil {
+		return err
+	}
+	return c.Delete(core.DocumentID(args[1]))
+}
+
+// runQuery prints the documents matching a JSON filter, a WHERE condition
+// or a SELECT statement on the collection
+func runQuery(e *env, args []string) error {
+	c, err := e.db.Collection(args[0])
+	if err != nil {
+		return err
+	}
+	q, count, err := parseQuery(c.Name(), args[1])
+	if err != nil {
+		return err
+	}
+	if count {
+		n, err := c.Count(q)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout, n)
+		return nil
+	}
+
+	docs, err := find(context.Background(), c, q)
+	if err != nil {
+		return err
+	}
+	return writeDocuments(e.stdout, queryFormat, docs)
+}
+
+// find returns the documents matching a query, each holding its ID under
+// the ID key. Unsorted results are ordered by ID, so output is stable. It
+// stops with ctx's error once ctx is done.
+func find(ctx context.Context, c *db.Collection, q core.Query) ([]core.Document, error) {
+	limit, offset := q.Limit, q.Offset
+	if q.Sort == nil {
+		q.Limit, q.Offset = 0, 0
+	}
+	q.IDField = core.DefaultIDKey
+	cur, err := c.Iter(q)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+
+	var docs []core.Document
+	for cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		id, doc := cur.Doc()
+		doc = doc.Clone()
+		doc[core.DefaultIDKey] = string(id)
+		docs = append(docs, doc)
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	if q.Sort == nil {
+		slices.SortFunc(docs, func(a, b core.Document) int {
+			return strings.Compare(a[core.DefaultIDKey].(string), b[core.DefaultIDKey].(string))
+		})
+		docs = docs[min(offset, len(docs)):]
+		if limit > 0 {
+			docs = docs[:min(limit, len(docs))]
+		}
+	}
+	return docs, nil
+}
+
+// parseQuery builds the query of the query command, applying --sort and
+// --limit, and reports whether it counts matches
+func parseQuery(collection, input string) (core.Query, bool, error) {
+	var q core.Query
+	var count bool
+	input = strings.TrimSpace(input)
+	if strings.HasPrefix(input, "{") {
+		var err error
+		if q, err = parseFilter(collection, input); err != nil {
+			return core.Query{}, false, err
+		}
+	} else {
+		if !isSelect(input) {
+			input = fmt.Sprintf("SELECT * FROM %q WHERE %s", collection, input)
+		}
+		stmt, err := qlang.Parse(input)
+		if err != nil {
+			return core.Query{}, false, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		if stmt.Query.Collection != collection {
+			return core.Query{}, false, fmt.Errorf("%w: statement selects from %s, not %s", errUsage, stmt.Query.Collection, collection)
+		}
+		q, count = stmt.Query, stmt.Count
+	}
+
+	if querySort != "" {
+		q.Sort, q.SortBy = nil, nil
+		for _, field := range strings.Split(querySort, ",") {
+			option := core.SortOption{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+			if q.Sort == nil {
+				q.Sort = &option
+			} else {
+				q.SortBy = append(q.SortBy, option)
+			}
+		}
+	}
+	if queryLimit > 0 {
+		q.Limit = queryLimit
+	}
+	return q, count, nil
+}
+
+// parseFilter builds a query from a filter in the query.ParseFilter syntax.
+// An empty filter matches every document.
+func parseFilter(collection, filter string) (core.Query, error) {
+	if strings.TrimSpace(filter) == "" {
+		return core.Query{Collection: collection}, nil
+	}
+	data, err := json.Marshal(map[string]json.RawMessage{"filter": json.RawMessage(filter)})
+	if err != nil {
+		return core.Query{}, fmt.Errorf("%w: invalid filter: %w", errUsage, err)
+	}
+	q, err := query.ParseQuery(collection, data)
+	if err != nil {
+		return core.Query{}, fmt.Errorf("%w: %w", errUsage, err)
+	}
+	return q, nil
+}
+
+// isSelect reports whether input is a SELECT statement
+func isSelect(input string) bool {
+	return len(input) >= 6 && strings.EqualFold(input[:6], "select")
+}
+
+// Flags of the export command
+var (
+	exportCanonical bool
+	exportPretty    bool
+)
+
+// exportFlags defines the flags of the export command
+func exportFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&exportCanonical, "canonical", false, "write the canonical form, which only changes when the documents do, for version control")
+	fs.BoolVar(&exportPretty, "pretty", false, "write the canonical form with each document indented")
+}
+
+// runExport writes a collection to stdout as JSON Lines
+func runExport(e *env, args []string) error {
+	c, err := e.db.Collection(args[0])
+	if err != nil {
+		return err
+	}
+	switch {
+	case exportPretty:
+		_, err = c.ExportCanonical(e.stdout, db.ExportPretty())
+	case exportCanonical:
+		_, err = c.ExportCanonical(e.stdout)
+	default:
+		_, err = c.ExportJSONL(e.stdout)
+	}
+	return err
+}
+
+// Flags of the import command
+var (
+	importMongo     bool
+	importUnixDates bool
+)
+
+// importFlags defines the flags of the import command
+func importFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&importMongo, "mongo", false, "read mongoexport output, converting MongoDB Extended JSON")
+	fs.BoolVar(&importUnixDates, "unix-dates", false, "with -mongo, import dates as Unix milliseconds instead of RFC 3339 strings")
+}
+
+// runImport reads JSON Lines documents from a file or stdin into a
+// collection, creating it if needed. With -mongo, lines that cannot be
+// converted are listed and skipped.
+func runImport(e *env, args []string) error {
+	in := e.stdin
+	if len(args) == 2 && args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return fmt.Errorf("failed to open input: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	c, err := e.db.CreateCollection(args[0])
+	if err != nil {
+		return err
+	}
+	if importMongo {
+		return importMongoExport(e, c, in)
+	}
+	n, err := c.ImportJSONL(in)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "imported %d documents into %s\n", n, c.Name())
+	return nil
+}
+
+// importMongoExport imports mongoexport output, reporting skipped lines
+func importMongoExport(e *env, c *db.Collection, in io.Reader) error {
+	var opts []db.MongoImportOption
+	if importUnixDates {
+		opts = append(opts, db.MongoDatesAsUnixMillis())
+	}
+	report, err := c.ImportMongoExport(in, opts...)
+	for _, problem := range report.Problems {
+		fmt.Fprintf(e.stdout, "skipped %v\n", problem)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "imported %d documents into %s\n", report.Imported, c.Name())
+	return nil
+}
+
+// runCreateCollection creates a collection, failing if it exists
+func runCreateCollection(e *env, args []string) error {
+	names, err := e.db.Collections()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(names, args[0]) {
+		return fmt.Errorf("collection already exists: %s", args[0])
+	}
+	_, err = e.db.CreateCollection(args[0])
+	return err
+}
+
+// runDropCollection deletes a collection
+func runDropCollection(e *env, args []string) error {
+	return e.db.DropCollection(args[0])
+}
+
+// statsAdvice is the -advice flag of the stats command
+var statsAdvice bool
+
+// statsFlags defines the flags of the stats command
+func statsFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&statsAdvice, "advice", false, "estimate the write amplification of each collection and advise on those past the default thresholds")
+}
+
+// runStats prints totals over the database, or the statistics and indexes
+// of one collection
+func runStats(e *env, args []string) error {
+	if statsAdvice {
+		return adviceReport(e, args)
+	}
+	if len(args) == 1 {
+		return collectionStatsReport(e, args[0])
+	}
+
+	names, err := e.db.Collections()
+	if err != nil {
+		return err
+	}
+	var docs, indexes int
+	var size int64
+	for _, name := range names {
+		n, bytes, err := collectionStats(e, name)
+		if err != nil {
+			return err
+		}
+		infos, err := e.db.Indexes().ListIndexes(name)
+		if err != nil {
+			return err
+		}
+		docs, size, indexes = docs+n, size+bytes, indexes+len(infos)
+	}
+	return writeTable(e.stdout, [][]string{
+		{"collections", strconv.Itoa(len(names))},
+		{"documents", strconv.Itoa(docs)},
+		{"size", formatSize(size)},
+		{"indexes", strconv.Itoa(indexes)},
+	})
+}
+
+// collectionStatsReport prints a collection's statistics and indexes
+func collectionStatsReport(e *env, name string) error {
+	c, err := e.db.Collection(name)
+	if err != nil {
+		return err
+	}
+	docs, size, err := collectionStats(e, c.Name())
+	if err != nil {
+		return err
+	}
+	infos, err := e.db.Indexes().ListIndexes(c.Name())
+	if err != nil {
+		return err
+	}
+	err = writeTable(e.stdout, [][]string{
+		{"collection", c.Name()},
+		{"documents", strconv.Itoa(docs)},
+		{"size", formatSize(size)},
+		{"indexes", strconv.Itoa(len(infos))},
+	})
+	if err != nil || len(infos) == 0 {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout)
+	rows := [][]string{{"INDEX", "KIND", "FIELDS", "UNIQUE", "ENTRIES"}}
+	for _, info := range infos {
+		rows = append(rows, []string{info.Name, info.Kind.String(), strings.Join(info.Fields, ","), strconv.FormatBool(info.Unique), strconv.Itoa(info.DocumentCount)})
+	}
+	return writeTable(e.stdout, rows)
+}
+
+// adviceReport prints the estimated write amplification of the given
+// collections, or of all of them, and the advice for those past
+// storage.DefaultAdviceThresholds
+func adviceReport(e *env, names []string) error {
+	if len(names) == 0 {
+		var err error
+		if names, err = e.db.Collections(); err != nil {
+			return err
+		}
+		slices.Sort(names)
+	}
+
+	rows := [][]string{{"COLLECTION", "DOCUMENTS", "SIZE", "AMPLIFICATION"}}
+	var advice []storage.Advice
+	for _, name := range names {
+		c, err := e.db.Collection(name)
+		if err != nil {
+			return err
+		}
+		stats, err := e.db.Storage().EstimateWrites(c.Name())
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []string{name, strconv.Itoa(stats.Documents), formatSize(stats.FileBytes), strconv.FormatFloat(stats.Amplification(), 'f', 1, 64)})
+		advice = append(advice, storage.Advise(stats, storage.DefaultAdviceThresholds)...)
+	}
+	if err := writeTable(e.stdout, rows); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(e.stdout)
+	if len(advice) == 0 {
+		fmt.Fprintln(e.stdout, "no collection is past the advice thresholds")
+	}
+	for _, a := range advice {
+		fmt.Fprintln(e.stdout, a)
+	}
+	return nil
+}
+
+// collectionStats returns the number of documents in a collection and the
+// size of its file
+func collectionStats(e *env, name string) (int, int64, error) {
+	docs, err := e.db.Storage().CountDocuments(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := e.db.Storage().CollectionSize(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return docs, size, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Flags of the describe command
+var (
+	describeSample int
+	describeFormat string
+)
+
+// describeFlags defines the flags of the describe command
+func describeFlags(fs *flag.FlagSet) {
+	fs.IntVar(&describeSample, "sample", 0, "infer from a random sample of `n` documents instead of all of them")
+	fs.StringVar(&describeFormat, "format", "table", "output `format`: table, json, or schema for a draft JSON Schema")
+}
+
+// runDescribe prints the structure inferred from a collection's documents
+func runDescribe(e *env, args []string) error {
+	if describeFormat != "table" && describeFormat != "json" && describeFormat != "schema" {
+		return fmt.Errorf("%w: unknown format %q", errUsage, describeFormat)
+	}
+	report, err := e.db.InferSchema(args[0], describeSample)
+	if err != nil {
+		return err
+	}
+
+	switch describeFormat {
+	case "json":
+		return writeJSON(e.stdout, report)
+	case "schema":
+		data, err := report.Draft()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "%s\n", data)
+		return nil
+	}
+
+	fmt.Fprintf(e.stdout, "%s: %d of %d documents\n\n", report.Collection, report.Documents, report.Total)
+	rows := [][]string{{"FIELD", "TYPES", "PRESENCE", "RANGE", "FORMATS", "EXAMPLES"}}
+	for _, f := range report.Fields {
+		var valueRange string
+		if f.Min != nil {
+			valueRange = formatNumber(*f.Min) + ".." + formatNumber(*f.Max)
+		}
+		var examples []string
+		for _, example := range f.Examples {
+			data, _ := json.Marshal(example)
+			examples = append(examples, string(data))
+		}
+		rows = append(rows, []string{
+			f.Path, formatCounts(f.Types), fmt.Sprintf("%.0f%%", f.Presence),
+			valueRange, formatCounts(f.Formats), strings.Join(examples, ", "),
+		})
+	}
+	return writeTable(e.stdout, rows)
+}
+
+// formatCounts formats counts by name as "name:n", sorted by name
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for i, name := range names {
+		names[i] = name + ":" + strconv.Itoa(counts[name])
+	}
+	return strings.Join(names, " ")
+}
+
+// formatNumber formats a number without a needless exponent or fraction
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
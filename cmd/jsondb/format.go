@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// writeTable writes rows as aligned columns
+func writeTable(w io.Writer, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// writeJSON writes a value as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode output: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// writeDocuments writes documents in a format: table, json or jsonl
+func writeDocuments(w io.Writer, format string, docs []core.Document) error {
+	switch format {
+	case "table":
+		return writeTable(w, documentRows(docs))
+	case "json":
+		if docs == nil {
+			docs = []core.Document{}
+		}
+		return writeJSON(w, docs)
+	case "jsonl":
+		for _, doc := range docs {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return fmt.Errorf("failed to encode output: %w", err)
+			}
+			fmt.Fprintf(w, "%s\n", data)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown format %q", errUsage, format)
+	}
+}
+
+// documentRows lays documents out as a table with a column per top-level
+// field, the ID first and the others sorted. Strings are written as they
+// are, other values as JSON, and missing fields are left blank.
+func documentRows(docs []core.Document) [][]string {
+	var columns []string
+	for _, doc := range docs {
+		for key := range doc {
+			if key != core.DefaultIDKey && !slices.Contains(columns, key) {
+				columns = append(columns, key)
+			}
+		}
+	}
+	slices.Sort(columns)
+	columns = append([]string{core.DefaultIDKey}, columns...)
+
+	header := []string{"ID"}
+	for _, column := range columns[1:] {
+		header = append(header, strings.ToUpper(column))
+	}
+	rows := [][]string{header}
+	for _, doc := range docs {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = formatValue(doc[column])
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// formatValue formats a field value for a table cell
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// formatSize formats a byte count with a binary unit
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
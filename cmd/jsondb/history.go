@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// historySize is the number of lines of shell history kept
+const historySize = 1000
+
+// fileHistory is the shell's input history, persisted to a file one line
+// per entry. It implements term.History.
+type fileHistory struct {
+	path    string
+	entries []string // Oldest first
+}
+
+// historyPath returns the history file: $JSONDB_HISTORY, or .jsondb_history
+// in the home directory
+func historyPath() string {
+	if path := os.Getenv("JSONDB_HISTORY"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".jsondb_history")
+}
+
+// loadHistory reads the last historySize entries of a history file. A
+// missing file starts an empty history, and an empty path keeps history in
+// memory only.
+func loadHistory(path string) (*fileHistory, error) {
+	h := &fileHistory{path: path}
+	if path == "" {
+		return h, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	if len(h.entries) > historySize {
+		h.entries = h.entries[len(h.entries)-historySize:]
+		data := strings.Join(h.entries, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			return nil, fmt.Errorf("failed to trim history: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// Add records an entry and appends it to the history file. Blank entries
+// and repeats of the last entry are skipped.
+func (h *fileHistory) Add(entry string) {
+	if strings.TrimSpace(entry) == "" || (len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry) {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > historySize {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return
+	}
+
+	// History is a convenience, so failing to persist it is not an error
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, entry)
+}
+
+// Len returns the number of entries
+func (h *fileHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns an entry, 0 being the most recent
+func (h *fileHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// Exit codes
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitNotFound = 3 // The collection or document does not exist
+)
+
+// errUsage is wrapped by errors in the command line itself
+var errUsage = errors.New("usage")
+
+// env is what a command runs with
+type env struct {
+	db     *db.DB // nil for offline commands
+	dir    string
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+// command is a subcommand
+type command struct {
+	name     string
+	args     string // Argument synopsis
+	nargs    [2]int // Minimum and maximum number of arguments
+	summary  string
+	readOnly bool // Opens the database read-only, so it can run against a directory in use
+	dirArg   int  // Position, counting from 1, of an argument naming the database directory; 0 if none
+	offline  bool // Runs on the directory without opening the database, so it works on one that fails to open
+	flags    func(fs *flag.FlagSet)
+	run      func(e *env, args []string) error
+}
+
+// commands are the subcommands, in help order
+var commands = []command{
+	{name: "ls", nargs: [2]int{0, 0}, summary: "list collections with their document counts and sizes", readOnly: true, run: runList},
+	{name: "get", args: "<collection> <id>", nargs: [2]int{2, 2}, summary: "print a document", readOnly: true, run: runGet},
+	{name: "put", args: "<collection> <id> <json|->", nargs: [2]int{3, 3}, summary: "create or replace a document, reading it from stdin for -", run: runPut},
+	{name: "del", args: "<collection> <id>", nargs: [2]int{2, 2}, summary: "delete a document", run: runDelete},
+	{name: "query", args: "<collection> <filter json|SQL>", nargs: [2]int{2, 2}, summary: "print the documents matching a filter, a WHERE condition or a SELECT statement", readOnly: true, flags: queryFlags, run: runQuery},
+	{name: "export", args: "<collection>", nargs: [2]int{1, 1}, summary: "write a collection to stdout as JSON Lines, or in canonical form with -canonical", readOnly: true, flags: exportFlags, run: runExport},
+	{name: "import", args: "<collection> [file|-]", nargs: [2]int{1, 2}, summary: "read JSON Lines documents, or mongoexport output with -mongo, into a collection", flags: importFlags, run: runImport},
+	{name: "describe", args: "<collection>", nargs: [2]int{1, 1}, summary: "print the fields of a collection's documents with their types, or a draft schema", readOnly: true, flags: describeFlags, run: runDescribe},
+	{name: "create-collection", args: "<name>", nargs: [2]int{1, 1}, summary: "create a collection", run: runCreateCollection},
+	{name: "drop-collection", args: "<name>", nargs: [2]int{1, 1}, summary: "delete a collection and its indexes", run: runDropCollection},
+	{name: "stats", args: "[collection]", nargs: [2]int{0, 1}, summary: "print database or collection statistics, or write amplification advice with -advice", readOnly: true, flags: statsFlags, run: runStats},
+	{name: "shell", args: "[directory]", nargs: [2]int{0, 1}, summary: "query the database interactively", readOnly: true, dirArg: 1, run: runShell},
+	{name: "dump", args: "<directory> <file|->", nargs: [2]int{2, 2}, summary: "archive every collection with its metadata and indexes", readOnly: true, dirArg: 1, run: runDump},
+	{name: "restore", args: "<file|-> <directory>", nargs: [2]int{2, 2}, summary: "restore the collections of an archive written by dump", dirArg: 2, flags: restoreFlags, run: runRestore},
+	{name: "verify", args: "[directory]", nargs: [2]int{0, 1}, summary: "audit the data files of a database that is not in use, optionally repairing them", dirArg: 1, offline: true, flags: verifyFlags, run: runVerify},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs a command line and returns the exit code
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("jsondb", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	dir := global.String("dir", envOr("JSONDB_DIR", "."), "database `directory`, defaulting to $JSONDB_DIR when set")
+	global.Usage = func() { usage(global, stderr) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if global.NArg() == 0 {
+		usage(global, stderr)
+		return exitUsage
+	}
+
+	name := global.Arg(0)
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == name {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "jsondb: unknown command %q\n", name)
+		usage(global, stderr)
+		return exitUsage
+	}
+
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: jsondb %s %s\n", cmd.name, cmd.args)
+		fs.PrintDefaults()
+	}
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	if err := parseInterspersed(fs, global.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if n := fs.NArg(); n < cmd.nargs[0] || n > cmd.nargs[1] {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if cmd.dirArg > 0 && fs.NArg() >= cmd.dirArg {
+		*dir = fs.Arg(cmd.dirArg - 1)
+	}
+
+	if cmd.offline {
+		err := cmd.run(&env{dir: *dir, stdin: stdin, stdout: stdout}, fs.Args())
+		if err != nil {
+			fmt.Fprintf(stderr, "jsondb: %v\n", err)
+			return exitCode(err)
+		}
+		return exitOK
+	}
+
+	opts := []db.Option{db.WithAutoCreate(false)}
+	if cmd.readOnly {
+		opts = append(opts, db.WithReadOnly())
+	}
+	database, err := db.Open(*dir, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "jsondb: %v\n", err)
+		return exitError
+	}
+
+	err = cmd.run(&env{db: database, dir: *dir, stdin: stdin, stdout: stdout}, fs.Args())
+	if closeErr := database.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "jsondb: %v\n", err)
+		if errors.Is(err, errUsage) {
+			fs.Usage()
+		}
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// exitCode returns the exit code of a command's error
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, core.ErrDocumentNotFound), errors.Is(err, db.ErrCollectionNotFound):
+		return exitNotFound
+	default:
+		return exitError
+	}
+}
+
+// parseInterspersed parses flags wherever they appear among the arguments,
+// so options may follow positional arguments
+func parseInterspersed(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// usage prints the command summary
+func usage(global *flag.FlagSet, w io.Writer) {
+	fmt.Fprintln(w, "usage: jsondb [-dir directory] <command> [arguments]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nOptions:")
+	global.PrintDefaults()
+	fmt.Fprintf(w, "\nExit status is %d on success, %d on errors, %d for usage errors and %d when\nthe collection or document does not exist.\n", exitOK, exitError, exitUsage, exitNotFound)
+}
+
+// envOr returns an environment variable's value, or def when it is unset
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// sizes matches formatted sizes, which vary with the timestamps of files
+// written during a test
+var sizes = regexp.MustCompile(`\d+(\.\d)? [KMGTPE]?i?B`)
+
+// fixture is a database read commands run against in place, which they
+// must leave untouched
+const fixture = "testdata/db"
+
+// copyFixture copies the fixture database into a temporary directory for
+// commands that write
+func copyFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	entries, err := os.ReadDir(fixture)
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(fixture, entry.Name()))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, entry.Name()), data, 0644); err != nil {
+			t.Fatalf("Failed to copy fixture: %v", err)
+		}
+	}
+	return dir
+}
+
+// checkGolden compares output with testdata/<name>.golden, rewriting the
+// file instead with -update
+func checkGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("Output differs from %s:\n%s\nexpected:\n%s", path, output, expected)
+	}
+}
+
+func TestReadCommands(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"ls", []string{"ls"}, exitOK},
+		{"get", []string{"get", "users", "grace"}, exitOK},
+		{"query_table", []string{"query", "users", `{"born": {"$gt": 1900}}`, "--sort", "-born"}, exitOK},
+		{"query_json", []string{"query", "--format", "json", "users", "name LIKE 'A%'"}, exitOK},
+		{"query_jsonl", []string{"query", "users", "SELECT name FROM users ORDER BY born", "--limit", "2", "--format", "jsonl"}, exitOK},
+		{"query_count", []string{"query", "users", "SELECT COUNT(*) FROM users WHERE born < 1900"}, exitOK},
+		{"export", []string{"export", "users"}, exitOK},
+		{"export_canonical", []string{"export", "--canonical", "users"}, exitOK},
+		{"export_pretty", []string{"export", "users", "--pretty"}, exitOK},
+		{"stats", []string{"stats"}, exitOK},
+		{"stats_collection", []string{"stats", "users"}, exitOK},
+		{"stats_advice", []string{"stats", "--advice"}, exitOK},
+		{"describe", []string{"describe", "users"}, exitOK},
+		{"describe_schema", []string{"describe", "users", "--format", "schema"}, exitOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"-dir", fixture}, tt.args...), nil, &stdout, &stderr)
+			if code != tt.code {
+				t.Fatalf("Expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+			checkGolden(t, tt.name, stdout.Bytes())
+		})
+	}
+
+	// Read commands open the database read-only, so they write nothing
+	entries, _ := os.ReadDir(fixture)
+	if len(entries) != 3 {
+		t.Errorf("Expected the fixture to be left untouched, got %d files", len(entries))
+	}
+}
+
+func TestWriteCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps [][]string // Commands run in order, the last one's output checked
+		stdin string
+	}{
+		{"put", [][]string{{"put", "users", "edsger", `{"name": "Edsger Dijkstra", "born": 1930}`}, {"get", "users", "edsger"}}, ""},
+		{"put_stdin", [][]string{{"put", "orders", "o2", "-"}, {"export", "orders"}}, `{"user": "alan", "total": 3}`},
+		{"del", [][]string{{"del", "users", "ada"}, {"ls"}}, ""},
+		{"import", [][]string{{"import", "people", "-"}, {"query", "people", "{}"}}, "{\"_id\": \"p1\", \"name\": \"Barbara\"}\n\n{\"_id\": \"p2\", \"name\": \"John\"}\n"},
+		{"import_mongo", [][]string{{"import", "people", "-", "-mongo"}}, "{\"_id\": {\"$oid\": \"5f43a1b2c3d4e5f601234567\"}, \"joined\": {\"$date\": \"2020-08-24T11:22:33Z\"}}\n{\"_id\": \"p2\", \"ratio\": {\"$numberDouble\": \"NaN\"}}\n"},
+		{"collections", [][]string{{"create-collection", "logs"}, {"drop-collection", "orders"}, {"ls"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := copyFixture(t)
+			var stdout, stderr bytes.Buffer
+			for _, step := range tt.steps {
+				stdout.Reset()
+				if code := run(append([]string{"-dir", dir}, step...), strings.NewReader(tt.stdin), &stdout, &stderr); code != exitOK {
+					t.Fatalf("Expected %v to succeed, got exit code %d: %s", step, code, stderr.String())
+				}
+			}
+			checkGolden(t, tt.name, sizes.ReplaceAll(stdout.Bytes(), []byte("<size>")))
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"missing document", []string{"get", "users", "nobody"}, exitNotFound},
+		{"missing collection", []string{"query", "ghosts", "{}"}, exitNotFound},
+		{"delete missing document", []string{"del", "users", "nobody"}, exitNotFound},
+		{"drop missing collection", []string{"drop-collection", "ghosts"}, exitNotFound},
+		{"existing collection", []string{"create-collection", "users"}, exitError},
+		{"drop collection", []string{"drop-collection", "orders"}, exitOK},
+		{"no command", nil, exitUsage},
+		{"unknown command", []string{"frobnicate"}, exitUsage},
+		{"missing argument", []string{"get", "users"}, exitUsage},
+		{"invalid filter", []string{"query", "users", `{"born": {"$bogus": 1}}`}, exitUsage},
+		{"invalid statement", []string{"query", "users", "born >"}, exitUsage},
+		{"other collection", []string{"query", "users", "SELECT * FROM orders"}, exitUsage},
+		{"unknown format", []string{"query", "users", "{}", "--format", "xml"}, exitUsage},
+		{"invalid document", []string{"put", "users", "x", "[1]"}, exitUsage},
+		{"invalid import", []string{"import", "users", filepath.Join("testdata", "ls.golden")}, exitError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"-dir", copyFixture(t)}, tt.args...), strings.NewReader(""), &stdout, &stderr)
+			if code != tt.code {
+				t.Errorf("Expected exit code %d, got %d: %s", tt.code, code, stderr.String())
+			}
+		})
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "out.jdbdump")
+	target := filepath.Join(t.TempDir(), "db")
+	steps := []struct {
+		args     []string
+		code     int
+		expected string // Expected output, if checked
+	}{
+		{[]string{"dump", fixture, archive}, exitOK, "dumped 2 collections (4 documents) to " + archive + "\n"},
+		{[]string{"restore", archive, target, "--include", "users"}, exitOK, "restored 1 collections (3 documents)\n"},
+		{[]string{"restore", archive, target}, exitError, ""},
+		{[]string{"restore", "--drop", archive, target}, exitOK, "restored 2 collections (4 documents)\n"},
+		{[]string{"restore", filepath.Join("testdata", "ls.golden"), target}, exitError, ""},
+	}
+	for _, step := range steps {
+		var stdout, stderr bytes.Buffer
+		if code := run(step.args, nil, &stdout, &stderr); code != step.code {
+			t.Fatalf("Expected %v to exit with %d, got %d: %s", step.args, step.code, code, stderr.String())
+		}
+		if step.expected != "" && stdout.String() != step.expected {
+			t.Errorf("Expected %q from %v, got %q", step.expected, step.args, stdout.String())
+		}
+	}
+
+	// The restored database matches the original, indexes included
+	for _, args := range [][]string{{"export", "users"}, {"export", "orders"}, {"stats", "users"}} {
+		var original, restored, stderr bytes.Buffer
+		run(append([]string{"-dir", fixture}, args...), nil, &original, &stderr)
+		run(append([]string{"-dir", target}, args...), nil, &restored, &stderr)
+		o, r := sizes.ReplaceAllString(original.String(), "<size>"), sizes.ReplaceAllString(restored.String(), "<size>")
+		if o == "" || o != r {
+			t.Errorf("Expected %v to match the original:\n%s\ngot:\n%s", args, o, r)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	dir := copyFixture(t)
+	os.WriteFile(filepath.Join(dir, "users.json.tmp"), []byte("{"), 0644)
+	os.WriteFile(filepath.Join(dir, "ghosts.json"), []byte("{"), 0644)
+
+	steps := []struct {
+		args     []string
+		code     int
+		expected []string // Lines the output must contain
+	}{
+		{[]string{"verify", fixture}, exitOK, []string{"verified 2 collections (4 documents): 0 errors, 0 warnings, 0 repaired"}},
+		{[]string{"verify", dir}, exitError, []string{"orphan_file", "users.json.tmp", "repair: safe", "corrupt_collection", "ghosts.json", "repair: destructive", "1 errors, 1 warnings, 0 repaired"}},
+		{[]string{"verify", dir, "--repair"}, exitError, []string{"1 errors, 1 warnings, 1 repaired"}},
+		{[]string{"verify", dir, "--repair", "--allow-destructive"}, exitOK, []string{"1 errors, 0 warnings, 1 repaired"}},
+		{[]string{"verify", dir, "--format", "json"}, exitOK, []string{`"collections": 2`, `"issues": []`}},
+		{[]string{"verify", dir, "--allow-destructive"}, exitUsage, nil},
+	}
+	for _, step := range steps {
+		var stdout, stderr bytes.Buffer
+		if code := run(step.args, nil, &stdout, &stderr); code != step.code {
+			t.Fatalf("Expected %v to exit with %d, got %d: %s", step.args, step.code, code, stderr.String())
+		}
+		for _, s := range step.expected {
+			if !strings.Contains(stdout.String(), s) {
+				t.Errorf("Expected %q in the output of %v, got:\n%s", s, step.args, stdout.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"golang.org/x/term"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/qlang"
+)
+
+// Prompts of the shell, the second for the lines of an unfinished statement
+const (
+	shellPrompt        = "jsondb> "
+	continuationPrompt = "   ...> "
+)
+
+// sampleSize is the number of documents sampled for field completion and \d
+const sampleSize = 100
+
+// Control keys read in raw mode
+const (
+	keyCtrlC = 3
+	keyCtrlU = 21 // Deletes the line in term.Terminal
+)
+
+// shellHelp describes the shell's input
+const shellHelp = `Statements end with ; and may span lines:
+  SELECT * | COUNT(*) | field, ... FROM collection [WHERE ...] [ORDER BY ...] [LIMIT n] [OFFSET n];
+  collection [filter];    documents matching a filter, e.g. users {"age": {"$gt": 30}};
+Meta-commands:
+  \d [collection]   list collections, or describe one with a sampled schema
+  \json             toggle JSON output
+  \timing           toggle statement timing
+  \?                show this help
+  \q                quit
+Ctrl-C cancels a running statement, Tab completes collection and field names.
+`
+
+// lineReader reads the shell's input one line at a time
+type lineReader interface {
+	ReadLine() (string, error)
+	SetPrompt(prompt string)
+}
+
+// scannerReader reads lines from a non-terminal input, without prompts
+type scannerReader struct {
+	*bufio.Scanner
+}
+
+// ReadLine returns the next line, or io.EOF at the end of the input
+func (r scannerReader) ReadLine() (string, error) {
+	if !r.Scan() {
+		if err := r.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.Text(), nil
+}
+
+// SetPrompt does nothing, as input that is not a terminal gets no prompts
+func (r scannerReader) SetPrompt(string) {}
+
+// shell is an interactive session on a database
+type shell struct {
+	env    *env // Its stdout is the shell's output
+	json   bool // Results are printed as JSON instead of tables
+	timing bool // Statements are followed by how long they took
+
+	fields map[string][]string // Sampled field paths, by collection
+
+	interrupted atomic.Bool // Set by Ctrl-C at the prompt
+	cooked, raw func()      // Take the terminal out of and back into raw mode; nil without one
+}
+
+// runShell runs the interactive shell, reading statements from a terminal
+// with line editing, history and completion, or else line by line
+func runShell(e *env, _ []string) error {
+	s := &shell{env: e, fields: make(map[string][]string)}
+	if f, ok := e.stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		history, err := loadHistory(historyPath())
+		if err != nil {
+			return err
+		}
+		return s.runTerminal(f, history)
+	}
+	return s.run(scannerReader{bufio.NewScanner(e.stdin)})
+}
+
+// runTerminal runs the shell on a terminal, which is in raw mode except
+// while a statement runs, so Ctrl-C then raises SIGINT
+func (s *shell) runTerminal(f *os.File, history term.History) error {
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	in := &interruptReader{r: f, interrupted: &s.interrupted}
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, s.env.stdout}, shellPrompt)
+	t.History = history
+	t.AutoCompleteCallback = s.complete
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		t.SetSize(width, height)
+	}
+
+	s.env.stdout = t
+	s.cooked = func() { term.Restore(fd, state) }
+	s.raw = func() { term.MakeRaw(fd) }
+	fmt.Fprintln(t, `Type \? for help, \q to quit.`)
+	return s.run(t)
+}
+
+// run reads and executes statements and meta-commands until the input ends
+// or \q
+func (s *shell) run(lines lineReader) error {
+	var pending strings.Builder
+	for {
+		if pending.Len() == 0 {
+			lines.SetPrompt(shellPrompt)
+		} else {
+			lines.SetPrompt(continuationPrompt)
+		}
+		line, err := lines.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return err
+		}
+
+		// Ctrl-C at the prompt discards the unfinished statement
+		if s.interrupted.Swap(false) {
+			pending.Reset()
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if pending.Len() == 0 {
+			if trimmed == "" {
+				continue
+			}
+			if strings.HasPrefix(trimmed, `\`) {
+				if quit := s.meta(trimmed); quit {
+					return nil
+				}
+				continue
+			}
+		}
+
+		pending.WriteString(line)
+		pending.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			input := strings.TrimSuffix(strings.TrimSpace(pending.String()), ";")
+			pending.Reset()
+			s.runStatement(input)
+		}
+	}
+}
+
+// runStatement executes a statement, cancelling it on Ctrl-C
+func (s *shell) runStatement(input string) {
+	if s.cooked != nil {
+		s.cooked()
+		defer s.raw()
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	start := time.Now()
+	s.report(s.execute(ctx, input))
+	if s.timing {
+		fmt.Fprintf(s.env.stdout, "Time: %.3f ms\n", float64(time.Since(start).Microseconds())/1000)
+	}
+}
+
+// execute runs a SELECT statement or a collection name followed by an
+// optional filter, printing the results
+func (s *shell) execute(ctx context.Context, input string) error {
+	name, q, count, err := parseStatement(input)
+	if err != nil {
+		return err
+	}
+	c, err := s.env.db.Collection(name)
+	if err != nil {
+		return err
+	}
+
+	if count {
+		n, err := c.Count(q)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.env.stdout, n)
+		return nil
+	}
+
+	docs, err := find(ctx, c, q)
+	if err != nil {
+		return err
+	}
+	if s.json {
+		return writeDocuments(s.env.stdout, "json", docs)
+	}
+	if err := writeTable(s.env.stdout, documentRows(docs)); err != nil {
+		return err
+	}
+	if len(docs) == 1 {
+		fmt.Fprintln(s.env.stdout, "(1 row)")
+	} else {
+		fmt.Fprintf(s.env.stdout, "(%d rows)\n", len(docs))
+	}
+	return nil
+}
+
+// parseStatement parses a SELECT statement, or a collection name followed
+// by an optional filter in the query.ParseFilter syntax, returning the
+// collection, the query and whether it counts matches
+func parseStatement(input string) (string, core.Query, bool, error) {
+	if isSelect(input) {
+		stmt, err := qlang.Parse(input)
+		if err != nil {
+			return "", core.Query{}, false, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		return stmt.Query.Collection, stmt.Query, stmt.Count, nil
+	}
+
+	name, filter := input, ""
+	if i := strings.IndexFunc(input, unicode.IsSpace); i >= 0 {
+		name, filter = input[:i], input[i:]
+	}
+	q, err := parseFilter(name, filter)
+	return name, q, false, err
+}
+
+// meta runs a meta-command, reporting whether it quits the shell
+func (s *shell) meta(line string) bool {
+	out := s.env.stdout
+	args := strings.Fields(line)
+	switch args[0] {
+	case `\q`:
+		return true
+	case `\json`:
+		s.json = !s.json
+		fmt.Fprintf(out, "JSON output is %s.\n", onOff(s.json))
+	case `\timing`:
+		s.timing = !s.timing
+		fmt.Fprintf(out, "Timing is %s.\n", onOff(s.timing))
+	case `\d`:
+		if len(args) == 1 {
+			s.report(runList(s.env, nil))
+		} else {
+			s.report(s.describe(args[1]))
+		}
+	case `\?`, `\h`:
+		fmt.Fprint(out, shellHelp)
+	default:
+		fmt.Fprintf(out, "unknown command %s, \\? for help\n", args[0])
+	}
+	return false
+}
+
+// describe prints a collection's statistics and indexes, and the fields of
+// a sample of its documents with the types they hold
+func (s *shell) describe(name string) error {
+	if err := collectionStatsReport(s.env, name); err != nil {
+		return err
+	}
+	c, err := s.env.db.Collection(name)
+	if err != nil {
+		return err
+	}
+	docs, err := find(context.Background(), c, core.Query{Limit: sampleSize})
+	if err != nil {
+		return err
+	}
+
+	types := make(map[string][]string)
+	present := make(map[string]int)
+	for _, doc := range docs {
+		walkFields(doc, "", func(path string, v interface{}) {
+			present[path]++
+			if t := jsonType(v); !slices.Contains(types[path], t) {
+				types[path] = append(types[path], t)
+			}
+		})
+	}
+	paths := make([]string, 0, len(types))
+	for path := range types {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	fmt.Fprintf(s.env.stdout, "\nSchema sampled from %d documents:\n", len(docs))
+	rows := [][]string{{"FIELD", "TYPES", "PRESENT"}}
+	for _, path := range paths {
+		slices.Sort(types[path])
+		rows = append(rows, []string{path, strings.Join(types[path], ","), fmt.Sprintf("%d/%d", present[path], len(docs))})
+	}
+	return writeTable(s.env.stdout, rows)
+}
+
+// report prints an error, without the usage prefix of command-line errors
+func (s *shell) report(err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, context.Canceled):
+		fmt.Fprintln(s.env.stdout, "cancelled")
+	default:
+		fmt.Fprintf(s.env.stdout, "error: %s\n", strings.TrimPrefix(err.Error(), errUsage.Error()+": "))
+	}
+}
+
+// complete completes the word before the cursor on Tab with a collection
+// name, or a field sampled from the collections the line names, up to the
+// longest prefix the candidates share
+func (s *shell) complete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	start := pos
+	for start > 0 && isWordByte(line[start-1]) {
+		start--
+	}
+	prefix := line[start:pos]
+	if prefix == "" {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, candidate := range s.candidates(line) {
+		if strings.HasPrefix(candidate, prefix) && !slices.Contains(matches, candidate) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completion := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if completion == prefix {
+		return "", 0, false
+	}
+	return line[:start] + completion + line[pos:], start + len(completion), true
+}
+
+// candidates returns the collection names, and the fields sampled from the
+// collections a line names
+func (s *shell) candidates(line string) []string {
+	names, err := s.env.db.Collections()
+	if err != nil {
+		return nil
+	}
+	candidates := slices.Clone(names)
+	words := strings.FieldsFunc(line, func(r rune) bool { return r > unicode.MaxASCII || !isWordByte(byte(r)) })
+	for _, name := range names {
+		if slices.Contains(words, name) {
+			candidates = append(candidates, s.sampleFields(name)...)
+		}
+	}
+	return candidates
+}
+
+// sampleFields returns the field paths of a sample of a collection's
+// documents, sampled once per session
+func (s *shell) sampleFields(name string) []string {
+	if fields, ok := s.fields[name]; ok {
+		return fields
+	}
+	var fields []string
+	if c, err := s.env.db.Collection(name); err == nil {
+		if docs, err := find(context.Background(), c, core.Query{Limit: sampleSize}); err == nil {
+			for _, doc := range docs {
+				walkFields(doc, "", func(path string, _ interface{}) {
+					if !slices.Contains(fields, path) {
+						fields = append(fields, path)
+					}
+				})
+			}
+		}
+	}
+	s.fields[name] = fields
+	return fields
+}
+
+// walkFields calls fn with the dotted path and value of every field of a
+// document, nested objects included
+func walkFields(doc map[string]interface{}, prefix string, fn func(path string, v interface{})) {
+	for key, v := range doc {
+		path := prefix + key
+		fn(path, v)
+		if nested, ok := v.(map[string]interface{}); ok {
+			walkFields(nested, path+".", fn)
+		}
+	}
+}
+
+// jsonType names the JSON type of a value
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return "number"
+	}
+}
+
+// isWordByte reports whether a byte can be part of a completed word
+func isWordByte(b byte) bool {
+	return b == '_' || b == '.' || b == '-' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// onOff describes a toggle
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// interruptReader reads a raw-mode terminal, turning Ctrl-C into a cleared
+// line, so term.Terminal returns it instead of ending input, and recording
+// the interrupt
+type interruptReader struct {
+	r           io.Reader
+	interrupted *atomic.Bool
+	pending     []byte
+}
+
+// Read reads from the terminal with Ctrl-C replaced
+func (r *interruptReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		buf := make([]byte, len(p))
+		n, err := r.r.Read(buf)
+		for _, b := range buf[:n] {
+			if b == keyCtrlC {
+				r.interrupted.Store(true)
+				r.pending = append(r.pending, keyCtrlU, '\r')
+				continue
+			}
+			r.pending = append(r.pending, b)
+		}
+		if len(r.pending) == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// openShell opens a shell on the fixture database, writing to out
+func openShell(t *testing.T, out *bytes.Buffer) *shell {
+	t.Helper()
+	database, err := db.Open(fixture, db.WithReadOnly(), db.WithAutoCreate(false))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return &shell{env: &env{db: database, stdout: out}, fields: make(map[string][]string)}
+}
+
+func TestShell(t *testing.T) {
+	script := strings.Join([]string{
+		`\d`,
+		`\d users`,
+		`SELECT name, born FROM users`,
+		`  WHERE born > 1900`,
+		`  ORDER BY born;`,
+		`users {"born": {"$lt": 1900}};`,
+		`SELECT COUNT(*) FROM users;`,
+		`\json`,
+		`orders;`,
+		`\json`,
+		`SELECT * FROM users WHERE;`,
+		`ghosts;`,
+		`\nope`,
+		`\q`,
+		`users;`,
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"shell", fixture}, strings.NewReader(script), &stdout, &stderr); code != exitOK {
+		t.Fatalf("Expected the shell to exit cleanly, got %d: %s", code, stderr.String())
+	}
+	checkGolden(t, "shell", stdout.Bytes())
+}
+
+func TestShellTiming(t *testing.T) {
+	var out bytes.Buffer
+	s := openShell(t, &out)
+	s.run(scannerReader{bufio.NewScanner(strings.NewReader("\\timing\nusers;\n"))})
+	if !strings.Contains(out.String(), "Timing is on.") || !strings.Contains(out.String(), "Time: ") {
+		t.Errorf("Expected statement timing, got %q", out.String())
+	}
+}
+
+func TestShellCancel(t *testing.T) {
+	var out bytes.Buffer
+	s := openShell(t, &out)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := s.execute(ctx, "users"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected a cancelled statement, got %v", err)
+	}
+	s.report(context.Canceled)
+	if out.String() != "cancelled\n" {
+		t.Errorf("Expected the cancellation to be reported, got %q", out.String())
+	}
+}
+
+func TestShellInterrupt(t *testing.T) {
+	var out bytes.Buffer
+	s := openShell(t, &out)
+
+	// Ctrl-C at the prompt clears the line and discards the unfinished statement
+	in := &interruptReader{r: strings.NewReader("SELECT *\x03"), interrupted: &s.interrupted}
+	buf := make([]byte, 64)
+	n, _ := in.Read(buf)
+	if got := string(buf[:n]); got != "SELECT *\x15\r" {
+		t.Errorf("Expected Ctrl-C to become a cleared line, got %q", got)
+	}
+	if !s.interrupted.Load() {
+		t.Errorf("Expected the interrupt to be recorded")
+	}
+
+	lines := &interruptingReader{lines: []string{"SELECT * FROM users", "", "orders;"}, at: 1, interrupted: &s.interrupted}
+	if err := s.run(lines); err != nil {
+		t.Fatalf("Failed to run: %v", err)
+	}
+	if strings.Contains(out.String(), "error") || !strings.Contains(out.String(), "(1 row)") {
+		t.Errorf("Expected only the statement after the interrupt to run, got %q", out.String())
+	}
+}
+
+// interruptingReader returns lines, recording an interrupt with the line at
+// index at
+type interruptingReader struct {
+	lines       []string
+	at          int
+	interrupted *atomic.Bool
+	next        int
+}
+
+func (r *interruptingReader) ReadLine() (string, error) {
+	if r.next == len(r.lines) {
+		return "", io.EOF
+	}
+	if r.next == r.at {
+		r.interrupted.Store(true)
+	}
+	r.next++
+	return r.lines[r.next-1], nil
+}
+
+func (r *interruptingReader) SetPrompt(string) {}
+
+func TestShellComplete(t *testing.T) {
+	var out bytes.Buffer
+	s := openShell(t, &out)
+
+	tests := []struct {
+		line     string
+		pos      int    // Cursor position, -1 for the end of the line
+		expected string // Empty when nothing completes
+	}{
+		{"SELECT * FROM us", -1, "SELECT * FROM users"},
+		{"SELECT * FROM o", -1, "SELECT * FROM orders"},
+		{"SELECT na FROM users", 9, "SELECT name FROM users"},
+		{`users {"addr`, -1, `users {"address`},
+		{`users {"address.c`, -1, `users {"address.city`},
+		{"SELECT * FROM users WHERE b", -1, "SELECT * FROM users WHERE born"},
+		{"SELECT na FROM orders", 9, ""},
+		{"SELECT * FROM x", -1, ""},
+		{"SELECT ", -1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			pos := tt.pos
+			if pos < 0 {
+				pos = len(tt.line)
+			}
+			line, newPos, ok := s.complete(tt.line, pos, '\t')
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("Expected no completion, got %q", line)
+				}
+				return
+			}
+			if !ok || line != tt.expected || newPos != pos+len(tt.expected)-len(tt.line) {
+				t.Errorf("Expected %q, got %q at %d (%v)", tt.expected, line, newPos, ok)
+			}
+		})
+	}
+	if _, _, ok := s.complete("SELECT * FROM us", 16, 'x'); ok {
+		t.Errorf("Expected only Tab to complete")
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	var lines []string
+	for i := 0; i < historySize+5; i++ {
+		lines = append(lines, fmt.Sprintf("SELECT %d;", i))
+	}
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+
+	h, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Failed to load history: %v", err)
+	}
+	if h.Len() != historySize || h.At(0) != lines[len(lines)-1] || h.At(historySize-1) != lines[5] {
+		t.Fatalf("Expected the last %d entries, got %d from %q", historySize, h.Len(), h.At(h.Len()-1))
+	}
+
+	h.Add("users;")
+	h.Add("users;")
+	h.Add("  ")
+	reloaded, err := loadHistory(path)
+	if err != nil {
+		t.Fatalf("Failed to reload history: %v", err)
+	}
+	if reloaded.Len() != historySize || reloaded.At(0) != "users;" || reloaded.At(1) != lines[len(lines)-1] {
+		t.Errorf("Expected the entry to be persisted once, got %q, %q", reloaded.At(0), reloaded.At(1))
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// Flags of the verify command
+var (
+	verifyRepair      bool
+	verifyDestructive bool
+	verifyIndexDir    string
+	verifyFormat      string
+)
+
+// verifyFlags defines the flags of the verify command
+func verifyFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&verifyRepair, "repair", false, "fix the issues that can be fixed without losing data")
+	fs.BoolVar(&verifyDestructive, "allow-destructive", false, "with -repair, also fix the issues that discard unreadable data")
+	fs.StringVar(&verifyIndexDir, "index-dir", "", "index `directory`, if not the database directory")
+	fs.StringVar(&verifyFormat, "format", "table", "output `format`: table or json")
+}
+
+// runVerify audits the database directory, failing if errors remain
+func runVerify(e *env, _ []string) error {
+	if verifyFormat != "table" && verifyFormat != "json" {
+		return fmt.Errorf("%w: unknown format %q", errUsage, verifyFormat)
+	}
+	if verifyDestructive && !verifyRepair {
+		return fmt.Errorf("%w: -allow-destructive needs -repair", errUsage)
+	}
+
+	report, err := db.VerifyDataDir(e.dir, db.VerifyOptions{IndexDir: verifyIndexDir, Repair: verifyRepair, AllowDestructive: verifyDestructive})
+	if err != nil {
+		return err
+	}
+
+	if verifyFormat == "json" {
+		if report.Issues == nil {
+			report.Issues = []storage.Issue{}
+		}
+		if err := writeJSON(e.stdout, report); err != nil {
+			return err
+		}
+	} else if err := writeIssues(e, report); err != nil {
+		return err
+	}
+
+	if n := report.Unrepaired(storage.SeverityError); n > 0 {
+		return fmt.Errorf("%d errors left unrepaired", n)
+	}
+	return nil
+}
+
+// writeIssues writes the issues of a report as a table followed by a summary
+func writeIssues(e *env, report storage.VerifyReport) error {
+	repaired := 0
+	if len(report.Issues) > 0 {
+		rows := [][]string{{"SEVERITY", "KIND", "FILE", "STATUS", "MESSAGE"}}
+		for _, issue := range report.Issues {
+			path := issue.Path
+			if rel, err := filepath.Rel(report.Dir, issue.Path); err == nil {
+				path = rel
+			}
+			status := "repair: " + string(issue.Repair)
+			switch {
+			case issue.Repaired:
+				status = "repaired"
+				repaired++
+			case issue.RepairErr != "":
+				status = "repair failed: " + issue.RepairErr
+			}
+			rows = append(rows, []string{string(issue.Severity), string(issue.Kind), path, status, issue.Message})
+		}
+		if err := writeTable(e.stdout, rows); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(e.stdout, "verified %d collections (%d documents): %d errors, %d warnings, %d repaired\n",
+		report.Collections, report.Documents, count(report, storage.SeverityError), count(report, storage.SeverityWarning), repaired)
+	return err
+}
+
+// count returns the number of issues of a severity, repaired or not
+func count(report storage.VerifyReport, severity storage.Severity) int {
+	n := 0
+	for _, issue := range report.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,63 @@
+package core
+
+import "fmt"
+
+// indexedWriter is implemented by index managers that write through to storage
+// themselves, so that constraint checks and the write happen under one lock
+type indexedWriter interface {
+	WriteIndexed(collection string, docID DocumentID, doc Document) error
+	DeleteIndexed(collection string, docID DocumentID) error
+}
+
+// WriteDocument stores a document and updates the collection's indexes
+func (c *Collection) WriteDocument(docID DocumentID, doc Document) error {
+	if w, ok := c.Indexes.(indexedWriter); ok {
+		return w.WriteIndexed(c.Name, docID, doc)
+	}
+
+	if err := c.Storage.WriteDocument(c.Name, docID, doc); err != nil {
+		return err
+	}
+
+	if c.Indexes == nil {
+		return nil
+	}
+
+	op := OpInsert
+	if _, err := c.Indexes.LookupPrimary(c.Name, docID); err == nil {
+		op = OpUpdate
+	}
+	return c.Indexes.UpdateIndexes(c.Name, docID, doc, op)
+}
+
+// ReadDocument retrieves a document by ID, served from the primary index when available
+func (c *Collection) ReadDocument(docID DocumentID) (Document, error) {
+	if c.Indexes != nil {
+		return c.Indexes.LookupPrimary(c.Name, docID)
+	}
+	return c.Storage.ReadDocument(c.Name, docID)
+}
+
+// DeleteDocument removes a document from storage and from the collection's indexes
+func (c *Collection) DeleteDocument(docID DocumentID) error {
+	if w, ok := c.Indexes.(indexedWriter); ok {
+		return w.DeleteIndexed(c.Name, docID)
+	}
+
+	if err := c.Storage.DeleteDocument(c.Name, docID); err != nil {
+		return err
+	}
+
+	if c.Indexes == nil {
+		return nil
+	}
+	return c.Indexes.UpdateIndexes(c.Name, docID, nil, OpDelete)
+}
+
+// FindBy returns documents whose field equals value using a secondary index
+func (c *Collection) FindBy(field string, value interface{}) ([]Document, error) {
+	if c.Indexes == nil {
+		return nil, fmt.Errorf("collection %s has no index manager", c.Name)
+	}
+	return c.Indexes.LookupSecondary(c.Name, field, value)
+}
@@ -0,0 +1,77 @@
+package core
+
+// Clone returns a deep copy of the document. Nested objects and arrays are
+// copied; other values are shared, which is safe for JSON scalars.
+func (d Document) Clone() Document {
+	if d == nil {
+		return nil
+	}
+	return cloneValue(map[string]interface{}(d)).(map[string]interface{})
+}
+
+// cloneValue deep-copies JSON objects and arrays
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			out[key] = cloneValue(element)
+		}
+		return out
+	case Document:
+		return Document(cloneValue(map[string]interface{}(v)).(map[string]interface{}))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			out[i] = cloneValue(element)
+		}
+		return out
+	}
+	return value
+}
+
+// MergePatch returns a copy of the document with a JSON merge patch (RFC 7386)
+// applied: a null in the patch removes the field, objects merge recursively
+// and any other value replaces the field. The document itself is unchanged.
+func (d Document) MergePatch(patch Document) Document {
+	out := d.Clone()
+	if out == nil {
+		out = Document{}
+	}
+	mergeObject(out, patch)
+	return out
+}
+
+// mergeObject applies a merge patch to target in place
+func mergeObject(target, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(target, key)
+			continue
+		}
+
+		patchObject, ok := asObject(value)
+		if !ok {
+			target[key] = cloneValue(value)
+			continue
+		}
+
+		targetObject, ok := asObject(target[key])
+		if !ok {
+			targetObject = make(map[string]interface{})
+		}
+		mergeObject(targetObject, patchObject)
+		target[key] = targetObject
+	}
+}
+
+// asObject returns a value as a JSON object, if it is one
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case Document:
+		return v, true
+	}
+	return nil, false
+}
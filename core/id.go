@@ -0,0 +1,150 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultIDKey is the document key generated IDs are written under
+const DefaultIDKey = "_id"
+
+// defaultIDAttempts is how many IDs are generated before giving up on collisions
+const defaultIDAttempts = 3
+
+// ErrIDCollision is returned when every generated ID is already taken
+var ErrIDCollision = errors.New("generated document ID already exists")
+
+// IDGenerator returns a new document ID
+type IDGenerator func() DocumentID
+
+// NewUUID returns a random (version 4) UUID
+func NewUUID() DocumentID {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	s := hex.EncodeToString(b[:])
+	return DocumentID(s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32])
+}
+
+// crockford is the ULID alphabet, which sorts in the same order as the values it encodes
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULIDGenerator returns a generator of ULIDs: a millisecond timestamp
+// followed by randomness, so IDs sort by creation time. IDs created within
+// the same millisecond increment the random part, so IDs from one generator
+// always sort in the order they were generated.
+func NewULIDGenerator() IDGenerator {
+	var mu sync.Mutex
+	var lastMs uint64
+	var hi uint16 // Top 16 of the 80 random bits
+	var lo uint64 // Bottom 64 random bits
+
+	return func() DocumentID {
+		mu.Lock()
+		defer mu.Unlock()
+
+		ms := uint64(time.Now().UnixMilli())
+		if ms <= lastMs {
+			// Same millisecond, or the clock went back: stay monotonic
+			ms = lastMs
+			lo++
+			if lo == 0 {
+				hi++
+			}
+		} else {
+			var b [10]byte
+			rand.Read(b[:])
+			hi = binary.BigEndian.Uint16(b[:2])
+			lo = binary.BigEndian.Uint64(b[2:])
+		}
+		lastMs = ms
+		return DocumentID(encodeULID(ms, hi, lo))
+	}
+}
+
+// encodeULID encodes a 48-bit timestamp and 80 random bits as 26 characters
+func encodeULID(ms uint64, hi uint16, lo uint64) string {
+	var out [26]byte
+
+	// 10 characters of timestamp, 5 bits each, the first holding 3 bits
+	for i := 9; i >= 0; i-- {
+		out[i] = crockford[ms&0x1f]
+		ms >>= 5
+	}
+
+	// 16 characters of randomness
+	for i := 25; i >= 10; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | uint64(hi&0x1f)<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// NewULID returns a ULID from a shared generator
+var NewULID = NewULIDGenerator()
+
+// IDOptions configures how inserts choose document IDs
+type IDOptions struct {
+	Generator   IDGenerator // Defaults to NewULID
+	Key         string      // Document key holding the ID; defaults to DefaultIDKey
+	MaxAttempts int         // Generated IDs tried before ErrIDCollision; defaults to 3
+}
+
+// InsertBatch returns a BatchFunc inserting doc under the ID held in its ID
+// key, or else under a generated ID written into that key, storing the ID
+// used in *id. Running it as a batch checks for collisions under the write
+// lock: a taken ID held by the document fails with ErrDocumentExists, and a
+// taken generated ID is replaced by another.
+func (o IDOptions) InsertBatch(doc Document, id *DocumentID) BatchFunc {
+	key, gen, attempts := o.Key, o.Generator, o.MaxAttempts
+	if key == "" {
+		key = DefaultIDKey
+	}
+	if gen == nil {
+		gen = NewULID
+	}
+	if attempts <= 0 {
+		attempts = defaultIDAttempts
+	}
+
+	return func(docs map[DocumentID]Document) (map[DocumentID]Document, error) {
+		if doc == nil {
+			return nil, fmt.Errorf("missing document - unable to insert")
+		}
+
+		doc = doc.Clone()
+		switch v := doc[key].(type) {
+		case nil:
+		case string:
+			if v == "" {
+				break
+			}
+			if _, taken := docs[DocumentID(v)]; taken {
+				return nil, fmt.Errorf("failed to insert %s: %w", v, ErrDocumentExists)
+			}
+			*id = DocumentID(v)
+			return map[DocumentID]Document{*id: doc}, nil
+		default:
+			return nil, fmt.Errorf("document key %s holds %T, not a string ID", key, v)
+		}
+
+		for i := 0; i < attempts; i++ {
+			candidate := gen()
+			if _, taken := docs[candidate]; candidate == "" || taken {
+				continue
+			}
+			doc[key] = string(candidate)
+			*id = candidate
+			return map[DocumentID]Document{candidate: doc}, nil
+		}
+		return nil, fmt.Errorf("failed to insert after %d attempts: %w", attempts, ErrIDCollision)
+	}
+}
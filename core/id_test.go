@@ -0,0 +1,96 @@
+package core
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"testing"
+)
+
+func TestNewUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[DocumentID]bool)
+	for i := 0; i < 100; i++ {
+		id := NewUUID()
+		if !pattern.MatchString(string(id)) {
+			t.Fatalf("Invalid UUIDv4 %s", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate UUID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestULIDsSortInGenerationOrder(t *testing.T) {
+	gen := NewULIDGenerator()
+
+	// Many IDs share a millisecond, so the random part must increase
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = string(gen())
+		if len(ids[i]) != 26 {
+			t.Fatalf("Expected 26 characters, got %q", ids[i])
+		}
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatal("Expected ULIDs in generation order")
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] == ids[i-1] {
+			t.Fatalf("Duplicate ULID %s", ids[i])
+		}
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	tests := []struct {
+		ms       uint64
+		hi       uint16
+		lo       uint64
+		expected string
+	}{
+		{0, 0, 0, "00000000000000000000000000"},
+		{1, 0, 1, "00000000010000000000000001"},
+		{1<<48 - 1, 1<<16 - 1, 1<<64 - 1, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{0, 1, 0, "0000000000000G000000000000"}, // Bit 64 of the random part
+	}
+	for _, tt := range tests {
+		if got := encodeULID(tt.ms, tt.hi, tt.lo); got != tt.expected {
+			t.Errorf("encodeULID(%d, %d, %d) = %s, expected %s", tt.ms, tt.hi, tt.lo, got, tt.expected)
+		}
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	docs := map[DocumentID]Document{"taken": {}}
+
+	var id DocumentID
+	writes, err := IDOptions{}.InsertBatch(Document{"_id": "mine"}, &id)(docs)
+	if err != nil || id != "mine" || writes["mine"] == nil {
+		t.Errorf("Expected the document's own ID, got %s %v (%v)", id, writes, err)
+	}
+
+	if _, err := (IDOptions{}).InsertBatch(Document{"_id": "taken"}, &id)(docs); !errors.Is(err, ErrDocumentExists) {
+		t.Errorf("Expected ErrDocumentExists, got %v", err)
+	}
+	if _, err := (IDOptions{}).InsertBatch(Document{"_id": 7}, &id)(docs); err == nil {
+		t.Errorf("Expected error for a non-string ID")
+	}
+
+	// A generated collision is retried
+	candidates := []DocumentID{"taken", "fresh"}
+	gen := func() DocumentID {
+		next := candidates[0]
+		candidates = candidates[1:]
+		return next
+	}
+	doc := Document{"name": "x"}
+	writes, err = IDOptions{Generator: gen, Key: "id"}.InsertBatch(doc, &id)(docs)
+	if err != nil || id != "fresh" || writes["fresh"]["id"] != "fresh" {
+		t.Errorf("Expected the retried ID, got %s %v (%v)", id, writes, err)
+	}
+	if _, ok := doc["id"]; ok {
+		t.Errorf("Expected the caller's document to be left unchanged")
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// LockPollInterval is how often a lock held by someone else is retried by
+// waits that honour a context
+const LockPollInterval = 2 * time.Millisecond
+
+// TryLocker is a lock that can be attempted without blocking, like sync.Mutex
+type TryLocker interface {
+	sync.Locker
+	TryLock() bool
+}
+
+// LockContext acquires mu, giving up with the cause of ctx once it is done. A
+// context that can never be done waits like mu.Lock.
+func LockContext(ctx context.Context, mu TryLocker) error {
+	if ctx.Done() == nil {
+		mu.Lock()
+		return nil
+	}
+	return PollContext(ctx, mu.TryLock)
+}
+
+// PollContext calls try every LockPollInterval until it succeeds, giving up
+// with the cause of ctx once it is done
+func PollContext(ctx context.Context, try func() bool) error {
+	ticker := time.NewTicker(LockPollInterval)
+	defer ticker.Stop()
+
+	for !try() {
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
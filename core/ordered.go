@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Field is a key and its value in an OrderedDocument
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedDocument is a document that keeps the order of its keys, for
+// collections whose files are diffed by people. Objects nested in it are
+// OrderedDocuments too when decoded by UnmarshalJSON; Document converts it
+// to the map every filter, projection and index works on.
+type OrderedDocument []Field
+
+// FieldReader reads the top-level fields of a document, whichever its
+// representation
+type FieldReader interface {
+	Get(key string) (interface{}, bool)
+	Keys() []string
+}
+
+var (
+	_ FieldReader = Document(nil)
+	_ FieldReader = OrderedDocument(nil)
+)
+
+// Get returns the value of a key
+func (d Document) Get(key string) (interface{}, bool) {
+	value, ok := d[key]
+	return value, ok
+}
+
+// Keys returns the keys of the document, sorted
+func (d Document) Keys() []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Get returns the value of a key
+func (d OrderedDocument) Get(key string) (interface{}, bool) {
+	for _, f := range d {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Keys returns the keys of the document, in order
+func (d OrderedDocument) Keys() []string {
+	keys := make([]string, len(d))
+	for i, f := range d {
+		keys[i] = f.Key
+	}
+	return keys
+}
+
+// Set replaces the value of a key where it stands, or appends the key
+func (d *OrderedDocument) Set(key string, value interface{}) {
+	for i := range *d {
+		if (*d)[i].Key == key {
+			(*d)[i].Value = value
+			return
+		}
+	}
+	*d = append(*d, Field{key, value})
+}
+
+// Delete removes a key, reporting whether it was present
+func (d *OrderedDocument) Delete(key string) bool {
+	for i := range *d {
+		if (*d)[i].Key == key {
+			*d = append((*d)[:i], (*d)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Document returns the document as a map, converting nested
+// OrderedDocuments too
+func (d OrderedDocument) Document() Document {
+	if d == nil {
+		return nil
+	}
+	return Document(unorderValue(d).(map[string]interface{}))
+}
+
+// unorderValue converts the OrderedDocuments in a value to maps
+func unorderValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case OrderedDocument:
+		out := make(map[string]interface{}, len(v))
+		for _, f := range v {
+			out[f.Key] = unorderValue(f.Value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			out[i] = unorderValue(element)
+		}
+		return out
+	}
+	return value
+}
+
+// OrderDocument returns a document as an OrderedDocument whose keys follow
+// their order in order, at every level; keys order lacks come after, sorted.
+// Array elements follow the element of order at the same position.
+func OrderDocument(doc Document, order OrderedDocument) OrderedDocument {
+	if doc == nil {
+		return nil
+	}
+	return orderObject(doc, order)
+}
+
+// orderObject orders the keys of an object as in order
+func orderObject(obj map[string]interface{}, order OrderedDocument) OrderedDocument {
+	out := make(OrderedDocument, 0, len(obj))
+	seen := make(map[string]bool, len(order))
+	for _, f := range order {
+		if value, ok := obj[f.Key]; ok && !seen[f.Key] {
+			seen[f.Key] = true
+			out = append(out, Field{f.Key, orderValue(value, f.Value)})
+		}
+	}
+
+	rest := make([]string, 0, len(obj)-len(out))
+	for key := range obj {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		out = append(out, Field{key, orderValue(obj[key], nil)})
+	}
+	return out
+}
+
+// orderValue orders the objects within a value as those within order
+func orderValue(value, order interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		o, _ := order.(OrderedDocument)
+		return orderObject(v, o)
+	case Document:
+		o, _ := order.(OrderedDocument)
+		return orderObject(v, o)
+	case OrderedDocument:
+		return orderObject(unorderValue(v).(map[string]interface{}), v)
+	case []interface{}:
+		o, _ := order.([]interface{})
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			var elementOrder interface{}
+			if i < len(o) {
+				elementOrder = o[i]
+			}
+			out[i] = orderValue(element, elementOrder)
+		}
+		return out
+	}
+	return value
+}
+
+// MarshalJSON encodes the document with its keys in order
+func (d OrderedDocument) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range d {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal field %s: %w", f.Key, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes a JSON object keeping the order of its keys, and
+// of the keys of the objects nested in it. Numbers decode to float64 as
+// they do into a Document; a repeated key keeps its first position and
+// last value.
+func (d *OrderedDocument) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		*d = nil
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("cannot unmarshal %v into an ordered document", tok)
+	}
+	obj, err := decodeOrderedObject(dec)
+	if err != nil {
+		return err
+	}
+	*d = obj
+	return nil
+}
+
+// decodeOrderedObject decodes the rest of an object whose opening brace was
+// read
+func decodeOrderedObject(dec *json.Decoder) (OrderedDocument, error) {
+	obj := OrderedDocument{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected an object key, got %v", tok)
+		}
+		value, err := decodeOrderedValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(key, value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// decodeOrderedValue decodes the next value, objects as OrderedDocuments
+func decodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		return decodeOrderedObject(dec)
+	case '[':
+		arr := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("unexpected delimiter %v", delim)
+}
@@ -0,0 +1,110 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestOrderedDocumentRoundTrip verifies keys keep their order at every level
+func TestOrderedDocumentRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"zeta":1,"alpha":"a","mid":true,"nil":null}`, ""},
+		{`{"server":{"port":8080,"host":"localhost"},"b":[{"y":1,"x":2},3,"s"],"a":[]}`, ""},
+		{`{"z": {"2": "two", "1": "one"}, "a": 1.50}`, `{"z":{"2":"two","1":"one"},"a":1.5}`},
+		{`{"b": 1, "a": 2, "b": 3}`, `{"b":3,"a":2}`},
+	}
+	for _, tt := range tests {
+		var doc OrderedDocument
+		if err := json.Unmarshal([]byte(tt.input), &doc); err != nil {
+			t.Fatalf("Failed to unmarshal %s: %v", tt.input, err)
+		}
+		data, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		expected := tt.expected
+		if expected == "" {
+			expected = tt.input
+		}
+		if string(data) != expected {
+			t.Errorf("Expected %s, got %s", expected, data)
+		}
+	}
+
+	var doc OrderedDocument
+	if err := json.Unmarshal([]byte(`[1, 2]`), &doc); err == nil {
+		t.Errorf("Expected an error for an array")
+	}
+}
+
+// TestOrderedDocumentAccessors verifies Get, Set, Delete and Keys keep order
+func TestOrderedDocumentAccessors(t *testing.T) {
+	doc := OrderedDocument{{"b", 1}, {"a", 2}}
+	doc.Set("c", 3)
+	doc.Set("b", 10)
+	if got := doc.Keys(); !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+		t.Errorf("Expected [b a c], got %v", got)
+	}
+	if value, ok := doc.Get("b"); !ok || value != 10 {
+		t.Errorf("Expected b to be replaced in place, got %v", value)
+	}
+	if !doc.Delete("a") || doc.Delete("a") {
+		t.Errorf("Expected a to be deleted once")
+	}
+	if got := doc.Keys(); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("Expected [b c], got %v", got)
+	}
+
+	var reader FieldReader = Document{"z": 1, "y": 2}
+	if got := reader.Keys(); !reflect.DeepEqual(got, []string{"y", "z"}) {
+		t.Errorf("Expected a document's keys sorted, got %v", got)
+	}
+}
+
+// TestOrderDocument verifies documents follow an order, new keys sorted after
+func TestOrderDocument(t *testing.T) {
+	order := OrderedDocument{
+		{"name", nil},
+		{"server", OrderedDocument{{"port", nil}, {"host", nil}}},
+		{"items", []interface{}{OrderedDocument{{"b", nil}, {"a", nil}}}},
+		{"gone", nil},
+	}
+	doc := Document{
+		"server": map[string]interface{}{"host": "h", "tls": true, "port": 1.0},
+		"name":   "n",
+		"new2":   1.0,
+		"new1":   2.0,
+		"items":  []interface{}{map[string]interface{}{"a": 1.0, "b": 2.0}, map[string]interface{}{"d": 1.0, "c": 2.0}},
+	}
+
+	got, err := json.Marshal(OrderDocument(doc, order))
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	expected := `{"name":"n","server":{"port":1,"host":"h","tls":true},"items":[{"b":2,"a":1},{"c":2,"d":1}],"new1":2,"new2":1}`
+	if string(got) != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	if !reflect.DeepEqual(OrderDocument(doc, order).Document(), doc) {
+		t.Errorf("Expected ordering to keep the content")
+	}
+}
+
+// TestGetPathOrdered verifies paths descend into ordered documents
+func TestGetPathOrdered(t *testing.T) {
+	doc := Document{"server": OrderedDocument{{"port", 8080}, {"tags", []interface{}{OrderedDocument{{"k", "v"}}}}}}
+	if value, ok := GetPath(doc, "server.port"); !ok || value != 8080 {
+		t.Errorf("Expected 8080, got %v", value)
+	}
+	if value, ok := GetPath(doc, "server.tags.0.k"); !ok || value != "v" {
+		t.Errorf("Expected v, got %v", value)
+	}
+	if _, ok := GetPath(doc, "server.missing"); ok {
+		t.Errorf("Expected a missing key not to resolve")
+	}
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Field paths address nested values with dot notation: "address.city" is the
+// "city" key of the "address" object, and "tags.0" is the first element of the
+// "tags" array. A field name containing a literal dot is written with the dot
+// escaped by a backslash, so "version\.major" is the top-level key
+// "version.major". A literal backslash is written as "\\".
+
+// SplitPath splits a dotted field path into its unescaped segments
+func SplitPath(path string) []string {
+	if !strings.ContainsAny(path, `.\`) {
+		return []string{path}
+	}
+
+	var segments []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '\\' && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case c == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return append(segments, current.String())
+}
+
+// EscapePathSegment escapes a field name so it can be used as one path segment
+func EscapePathSegment(name string) string {
+	if !strings.ContainsAny(name, `.\`) {
+		return name
+	}
+	return strings.NewReplacer(`\`, `\\`, `.`, `\.`).Replace(name)
+}
+
+// GetPath resolves a dotted field path within a document. It reports false
+// when any segment along the way is missing, indexes past the end of an array
+// or descends into a scalar.
+func GetPath(doc Document, path string) (interface{}, bool) {
+	if !strings.ContainsAny(path, `.\`) {
+		value, ok := doc[path]
+		return value, ok
+	}
+
+	var current interface{} = map[string]interface{}(doc)
+	for _, segment := range SplitPath(path) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case Document:
+			value, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case OrderedDocument:
+			value, ok := node.Get(segment)
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
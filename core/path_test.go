@@ -0,0 +1,83 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitPath verifies dotted paths and escaped dots are split correctly
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"name", []string{"name"}},
+		{"address.city", []string{"address", "city"}},
+		{"a.b.c", []string{"a", "b", "c"}},
+		{`version\.major`, []string{"version.major"}},
+		{`meta.version\.major.x`, []string{"meta", "version.major", "x"}},
+		{`back\\slash.x`, []string{`back\slash`, "x"}},
+	}
+
+	for _, tt := range tests {
+		if got := SplitPath(tt.path); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("SplitPath(%q) = %q, expected %q", tt.path, got, tt.expected)
+		}
+	}
+}
+
+// TestEscapePathSegment verifies escaped names round-trip through SplitPath
+func TestEscapePathSegment(t *testing.T) {
+	for _, name := range []string{"plain", "a.b", `c\d`, `.\.`} {
+		if got := SplitPath(EscapePathSegment(name)); !reflect.DeepEqual(got, []string{name}) {
+			t.Errorf("Expected %q to round-trip, got %q", name, got)
+		}
+	}
+}
+
+// TestGetPath verifies nested maps, arrays and missing segments
+func TestGetPath(t *testing.T) {
+	doc := Document{
+		"name": "Alice",
+		"address": map[string]interface{}{
+			"city": "Berlin",
+			"geo": map[string]interface{}{
+				"country": map[string]interface{}{"code": "DE"},
+			},
+		},
+		"tags":          []interface{}{"go", "db"},
+		"orders":        []interface{}{map[string]interface{}{"sku": "A1"}, map[string]interface{}{"sku": "B2"}},
+		"version.major": 3,
+		"nothing":       nil,
+	}
+
+	tests := []struct {
+		path     string
+		expected interface{}
+		found    bool
+	}{
+		{"name", "Alice", true},
+		{"address.city", "Berlin", true},
+		{"address.geo.country.code", "DE", true},
+		{"tags.0", "go", true},
+		{"tags.1", "db", true},
+		{"orders.1.sku", "B2", true},
+		{`version\.major`, 3, true},
+		{"nothing", nil, true},
+		{"missing", nil, false},
+		{"address.zip", nil, false},
+		{"address.city.name", nil, false},
+		{"tags.2", nil, false},
+		{"tags.-1", nil, false},
+		{"tags.first", nil, false},
+		{"nothing.deeper", nil, false},
+		{"version.major", nil, false},
+	}
+
+	for _, tt := range tests {
+		value, found := GetPath(doc, tt.path)
+		if found != tt.found || !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("GetPath(%q) = (%v, %v), expected (%v, %v)", tt.path, value, found, tt.expected, tt.found)
+		}
+	}
+}
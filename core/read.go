@@ -0,0 +1,25 @@
+package core
+
+import "time"
+
+// ReadPreference selects how a read trades freshness for speed
+type ReadPreference int
+
+const (
+	// ReadFresh reads what is stored: documents cached by the storage
+	// engine are served only after checking the collection file has not
+	// changed since they were loaded
+	ReadFresh ReadPreference = iota
+	// ReadCached serves cached documents without touching the disk or
+	// waiting on locks, even if the collection file has changed since
+	ReadCached
+)
+
+// ReadOptions configure a read. The zero value reads fresh.
+type ReadOptions struct {
+	Preference ReadPreference
+	// MaxStaleness bounds how long ago cached documents may have been
+	// checked against the collection file for ReadCached to serve them;
+	// older ones are refreshed first. 0 serves them however old.
+	MaxStaleness time.Duration
+}
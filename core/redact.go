@@ -0,0 +1,238 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RedactAction is what a redaction rule does to the values at its path
+type RedactAction int
+
+const (
+	// RedactDrop removes the field
+	RedactDrop RedactAction = iota
+	// RedactHash replaces the value with a salted hash of it, the same for
+	// equal values and salts so redacted documents can still be joined
+	RedactHash
+	// RedactMask replaces the value with one of the same type and shape,
+	// such as "j***@***.com" for "jane@example.com"
+	RedactMask
+)
+
+// redactActionNames maps redaction actions to their persisted names
+var redactActionNames = map[RedactAction]string{
+	RedactDrop: "drop",
+	RedactHash: "hash",
+	RedactMask: "mask",
+}
+
+// String returns the name of the redaction action
+func (a RedactAction) String() string {
+	if name, ok := redactActionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("RedactAction(%d)", int(a))
+}
+
+// MarshalText encodes the redaction action by name
+func (a RedactAction) MarshalText() ([]byte, error) {
+	name, ok := redactActionNames[a]
+	if !ok {
+		return nil, fmt.Errorf("unknown redaction action: %d", int(a))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes a redaction action from its name
+func (a *RedactAction) UnmarshalText(text []byte) error {
+	for action, name := range redactActionNames {
+		if name == string(text) {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown redaction action: %s", text)
+}
+
+// RedactRule redacts the values at a field path. A path segment that is
+// not an array index applies to every element of an array it meets, so
+// "addresses.street" covers the street of each address.
+type RedactRule struct {
+	Path   string       `json:"path"`
+	Action RedactAction `json:"action"`
+}
+
+// Redaction is how a collection's documents are redacted before leaving
+// the database, such as in exports for third parties. It is plain data, so
+// it can be stored with the collection and changed by operators.
+type Redaction struct {
+	Rules []RedactRule `json:"rules"`
+	// Salt keys the hashes of RedactHash; exports redacted with the same
+	// salt hash equal values alike
+	Salt string `json:"salt,omitempty"`
+	// ExemptRoles are the API key roles the HTTP API serves documents to
+	// unredacted
+	ExemptRoles []string `json:"exempt_roles,omitempty"`
+}
+
+// Validate checks that every rule has a path and a known action
+func (r Redaction) Validate() error {
+	for _, rule := range r.Rules {
+		if rule.Path == "" {
+			return fmt.Errorf("missing path in redaction rule")
+		}
+		if _, ok := redactActionNames[rule.Action]; !ok {
+			return fmt.Errorf("unknown redaction action %d for %s", int(rule.Action), rule.Path)
+		}
+	}
+	return nil
+}
+
+// Exempts reports whether documents are served unredacted to a role
+func (r Redaction) Exempts(role string) bool {
+	for _, exempt := range r.ExemptRoles {
+		if exempt == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactDocument returns a copy of doc with the rules of r applied in
+// order; doc itself is not changed. Paths that do not resolve are skipped.
+func RedactDocument(doc Document, r Redaction) (Document, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	out := doc.Clone()
+	for _, rule := range r.Rules {
+		redactPath(map[string]interface{}(out), SplitPath(rule.Path), rule.Action, r.Salt)
+	}
+	return out, nil
+}
+
+// redactPath applies an action to the values at the remaining segments of
+// a path below node
+func redactPath(node interface{}, segments []string, action RedactAction, salt string) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		value, ok := n[segments[0]]
+		if !ok {
+			return
+		}
+		if len(segments) > 1 {
+			redactPath(value, segments[1:], action, salt)
+			return
+		}
+		if action == RedactDrop {
+			delete(n, segments[0])
+			return
+		}
+		n[segments[0]] = redactValue(value, action, salt)
+	case Document:
+		redactPath(map[string]interface{}(n), segments, action, salt)
+	case []interface{}:
+		i, err := strconv.Atoi(segments[0])
+		if err != nil {
+			for _, element := range n {
+				redactPath(element, segments, action, salt)
+			}
+			return
+		}
+		if i < 0 || i >= len(n) {
+			return
+		}
+		if len(segments) > 1 {
+			redactPath(n[i], segments[1:], action, salt)
+			return
+		}
+		if action == RedactDrop {
+			// Removing the element would renumber the rest
+			n[i] = nil
+			return
+		}
+		n[i] = redactValue(n[i], action, salt)
+	}
+}
+
+// redactValue returns the hashed or masked form of a value. Arrays are
+// redacted element by element.
+func redactValue(value interface{}, action RedactAction, salt string) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			out[i] = redactValue(element, action, salt)
+		}
+		return out
+	case nil:
+		return nil
+	}
+	if action == RedactHash {
+		return hashValue(value, salt)
+	}
+	return maskValue(value)
+}
+
+// hashValue returns the hex HMAC-SHA256, keyed by salt, of a value's JSON
+// encoding, in which object keys are sorted
+func hashValue(value interface{}, salt string) string {
+	data, _ := json.Marshal(value)
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// maskValue returns a value of the same type with its content hidden:
+// strings keep their first character and punctuation, numbers become 0,
+// booleans false and objects have each value masked
+func maskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		return maskString(v)
+	case bool:
+		return false
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			out[key] = redactValue(element, RedactMask, "")
+		}
+		return out
+	case Document:
+		return Document(maskValue(map[string]interface{}(v)).(map[string]interface{}))
+	}
+	if _, ok := ToFloat64(value); ok {
+		return float64(0)
+	}
+	return nil
+}
+
+// maskString masks a string, as "j***@***.com" for an email address and
+// "J*** ***-*****" for "Jane Doe-Smith"
+func maskString(s string) string {
+	if local, domain, ok := strings.Cut(s, "@"); ok && local != "" && domain != "" && !strings.Contains(domain, "@") {
+		first, _ := utf8.DecodeRuneInString(local)
+		masked := string(first) + "***@***"
+		if dot := strings.LastIndex(domain, "."); dot >= 0 {
+			masked += domain[dot:]
+		}
+		return masked
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteByte('*')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
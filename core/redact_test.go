@@ -0,0 +1,139 @@
+package core
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// redactFixture returns a document with nested objects and arrays of
+// objects
+func redactFixture() Document {
+	return Document{
+		"name":  "Jane Doe-Smith",
+		"email": "jane@example.com",
+		"age":   float64(41),
+		"vip":   true,
+		"address": map[string]interface{}{
+			"street": "12 Main St.",
+			"city":   "Berlin",
+		},
+		"contacts": []interface{}{
+			map[string]interface{}{"email": "bob@mail.co.uk", "phone": "+49 30 1234"},
+			map[string]interface{}{"email": "eve@corp.io"},
+			"not an object",
+		},
+		"tags": []interface{}{"a", "b"},
+	}
+}
+
+// TestRedactDocument verifies each action on top-level and nested paths,
+// arrays of objects and array indexes
+func TestRedactDocument(t *testing.T) {
+	const salt = "pepper"
+	tests := []struct {
+		name     string
+		rule     RedactRule
+		path     []string // Where the result is read
+		expected interface{}
+		dropped  bool
+	}{
+		{"drop top level", RedactRule{"email", RedactDrop}, []string{"email"}, nil, true},
+		{"drop nested", RedactRule{"address.street", RedactDrop}, []string{"address", "street"}, nil, true},
+		{"drop in array of objects", RedactRule{"contacts.phone", RedactDrop}, []string{"contacts", "0", "phone"}, nil, true},
+		{"drop array element", RedactRule{"tags.1", RedactDrop}, []string{"tags"}, []interface{}{"a", nil}, false},
+		{"hash string", RedactRule{"email", RedactHash}, []string{"email"}, hashValue("jane@example.com", salt), false},
+		{"hash number", RedactRule{"age", RedactHash}, []string{"age"}, hashValue(float64(41), salt), false},
+		{"hash object", RedactRule{"address", RedactHash}, []string{"address"}, hashValue(map[string]interface{}{"city": "Berlin", "street": "12 Main St."}, salt), false},
+		{"hash in array of objects", RedactRule{"contacts.email", RedactHash}, []string{"contacts", "1", "email"}, hashValue("eve@corp.io", salt), false},
+		{"hash array", RedactRule{"tags", RedactHash}, []string{"tags"}, []interface{}{hashValue("a", salt), hashValue("b", salt)}, false},
+		{"mask email", RedactRule{"email", RedactMask}, []string{"email"}, "j***@***.com", false},
+		{"mask name", RedactRule{"name", RedactMask}, []string{"name"}, "J*** ***-*****", false},
+		{"mask number", RedactRule{"age", RedactMask}, []string{"age"}, float64(0), false},
+		{"mask bool", RedactRule{"vip", RedactMask}, []string{"vip"}, false, false},
+		{"mask object", RedactRule{"address", RedactMask}, []string{"address"}, map[string]interface{}{"street": "1* **** **.", "city": "B*****"}, false},
+		{"mask in array of objects", RedactRule{"contacts.email", RedactMask}, []string{"contacts", "0", "email"}, "b***@***.uk", false},
+		{"mask array index", RedactRule{"contacts.1.email", RedactMask}, []string{"contacts", "1", "email"}, "e***@***.io", false},
+		{"missing path", RedactRule{"address.zip", RedactDrop}, []string{"address"}, map[string]interface{}{"street": "12 Main St.", "city": "Berlin"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := redactFixture()
+			redacted, err := RedactDocument(original, Redaction{Rules: []RedactRule{tt.rule}, Salt: salt})
+			if err != nil {
+				t.Fatalf("Failed to redact: %v", err)
+			}
+			got, found := getSegments(redacted, tt.path)
+			if tt.dropped {
+				if found {
+					t.Errorf("Expected %v dropped, got %v", tt.path, got)
+				}
+			} else if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, got)
+			}
+			if !reflect.DeepEqual(original, redactFixture()) {
+				t.Errorf("Expected the original document untouched, got %v", original)
+			}
+		})
+	}
+}
+
+// getSegments reads the value at split path segments
+func getSegments(doc Document, segments []string) (interface{}, bool) {
+	path := ""
+	for i, segment := range segments {
+		if i > 0 {
+			path += "."
+		}
+		path += EscapePathSegment(segment)
+	}
+	return GetPath(doc, path)
+}
+
+// TestRedactHashIsStable verifies equal values hash alike under one salt,
+// so redacted exports can be joined, and differently under another
+func TestRedactHashIsStable(t *testing.T) {
+	rules := []RedactRule{{Path: "email", Action: RedactHash}, {Path: "contacts.email", Action: RedactHash}}
+	a, _ := RedactDocument(Document{"email": "x@y.z"}, Redaction{Rules: rules, Salt: "s1"})
+	b, _ := RedactDocument(Document{"contacts": []interface{}{map[string]interface{}{"email": "x@y.z"}}}, Redaction{Rules: rules, Salt: "s1"})
+	c, _ := RedactDocument(Document{"email": "x@y.z"}, Redaction{Rules: rules, Salt: "s2"})
+
+	hash := a["email"]
+	if other := b["contacts"].([]interface{})[0].(map[string]interface{})["email"]; other != hash {
+		t.Errorf("Expected equal values to hash alike, got %v and %v", hash, other)
+	}
+	if c["email"] == hash {
+		t.Errorf("Expected another salt to hash differently")
+	}
+	if hash == "x@y.z" || len(hash.(string)) != 64 {
+		t.Errorf("Expected a hex SHA-256 hash, got %v", hash)
+	}
+}
+
+// TestRedactionValidate verifies rules need a path and a known action, and
+// that actions round-trip through JSON by name
+func TestRedactionValidate(t *testing.T) {
+	if err := (Redaction{Rules: []RedactRule{{Action: RedactMask}}}).Validate(); err == nil {
+		t.Errorf("Expected an error for a rule without a path")
+	}
+	if _, err := RedactDocument(Document{}, Redaction{Rules: []RedactRule{{Path: "x", Action: RedactAction(9)}}}); err == nil {
+		t.Errorf("Expected an error for an unknown action")
+	}
+
+	var r Redaction
+	data := `{"rules": [{"path": "email", "action": "mask"}, {"path": "ssn", "action": "drop"}], "salt": "s", "exempt_roles": ["admin"]}`
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		t.Fatalf("Failed to decode redaction: %v", err)
+	}
+	expected := Redaction{Rules: []RedactRule{{"email", RedactMask}, {"ssn", RedactDrop}}, Salt: "s", ExemptRoles: []string{"admin"}}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, r)
+	}
+	if !r.Exempts("admin") || r.Exempts("user") {
+		t.Errorf("Expected only admin exempt")
+	}
+	if err := json.Unmarshal([]byte(`{"rules": [{"path": "x", "action": "shred"}]}`), &r); err == nil {
+		t.Errorf("Expected an error for an unknown action name")
+	}
+}
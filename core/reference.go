@@ -0,0 +1,59 @@
+package core
+
+import "fmt"
+
+// RefAction is what deleting a referenced document does to the documents
+// referencing it
+type RefAction int
+
+const (
+	// RefRestrict makes deleting a referenced document fail
+	RefRestrict RefAction = iota
+	// RefCascade deletes the referencing documents along with it
+	RefCascade
+	// RefSetNull sets the referencing field of the referencing documents to null
+	RefSetNull
+)
+
+// refActionNames maps reference actions to their persisted names
+var refActionNames = map[RefAction]string{
+	RefRestrict: "restrict",
+	RefCascade:  "cascade",
+	RefSetNull:  "set_null",
+}
+
+// String returns the name of the reference action
+func (a RefAction) String() string {
+	if name, ok := refActionNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("RefAction(%d)", int(a))
+}
+
+// MarshalText encodes the reference action by name
+func (a RefAction) MarshalText() ([]byte, error) {
+	name, ok := refActionNames[a]
+	if !ok {
+		return nil, fmt.Errorf("unknown reference action: %d", int(a))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes a reference action from its name
+func (a *RefAction) UnmarshalText(text []byte) error {
+	for action, name := range refActionNames {
+		if name == string(text) {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown reference action: %s", text)
+}
+
+// Reference declares that a field of a collection's documents holds the ID
+// of a document in another collection
+type Reference struct {
+	Field    string    `json:"field"`     // Referencing field path
+	To       string    `json:"to"`        // Referenced collection
+	OnDelete RefAction `json:"on_delete"` // What deleting a referenced document does
+}
@@ -0,0 +1,28 @@
+package core
+
+import "context"
+
+// RevisionChange is the revision a write found a collection at and the one
+// it left it at. They are equal for a write that changed nothing.
+type RevisionChange struct {
+	From uint64
+	To   uint64
+}
+
+// revisionsKey is the context key of the map set by WithRevisions
+type revisionsKey struct{}
+
+// WithRevisions returns a context under which storage engines that track
+// revisions record in revisions, by collection, the change each write made.
+// Writes sharing the map must not run concurrently.
+func WithRevisions(ctx context.Context, revisions map[string]RevisionChange) context.Context {
+	return context.WithValue(ctx, revisionsKey{}, revisions)
+}
+
+// RecordRevision records the revision change of a write to collection in the
+// map ctx holds, if any
+func RecordRevision(ctx context.Context, collection string, from, to uint64) {
+	if revisions, ok := ctx.Value(revisionsKey{}).(map[string]RevisionChange); ok {
+		revisions[collection] = RevisionChange{From: from, To: to}
+	}
+}
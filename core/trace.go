@@ -0,0 +1,24 @@
+package core
+
+import (
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Span attribute keys shared by the traced packages
+const (
+	AttrCollection = "db.collection.name"
+	AttrDocumentID = "db.document.id"
+	AttrDocuments  = "db.documents"
+	AttrIndex      = "db.index"
+	AttrBytes      = "db.bytes"
+)
+
+// EndSpan ends span, marking it failed with err unless err is nil
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
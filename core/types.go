@@ -1,5 +1,16 @@
 package core
 
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDocumentNotFound is returned when a requested document does not exist
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrDocumentExists is returned when inserting a document whose ID is taken
+var ErrDocumentExists = errors.New("document already exists")
+
 // Document represents a JSON document stored in the database
 type Document map[string]interface{}
 
@@ -16,17 +27,140 @@ type Collection struct {
 // Query represents a database query with filters and options
 type Query struct {
 	Collection string
-	Filters    []Filter
-	Sort       *SortOption
+	Filters    []Filter     // Implicitly ANDed, and ANDed with Where
+	Where      *FilterNode  // Optional boolean filter tree
+	Sort       *SortOption  // Primary sort key, kept for single-field sorts
+	SortBy     []SortOption // Further sort keys, applied in order after Sort
 	Limit      int
 	Offset     int
+	Projection []string // Field paths to keep; all others are dropped
+	Exclude    []string // Field paths to drop; cannot be combined with Projection
+	IDField    string   // Key holding the document ID in projected results; defaults to DefaultIDField
+
+	// Read makes a query that reads the collection from storage serve it
+	// from the storage engine's cache with ReadCached, where the engine has
+	// one. Queries otherwise read the collection as stored.
+	Read ReadOptions
 }
 
+// DefaultIDField is the key projected results carry the document ID under
+const DefaultIDField = "id"
+
+// DocumentIDField is a pseudo-field that filters on the document ID itself
+// rather than on a field stored in the document
+const DocumentIDField = "$id"
+
 // Filter represents a query filter condition
 type Filter struct {
 	Field    string
 	Operator FilterOperator
-	Value    interface{}
+	Value    interface{} // A []interface{} for OpIn and OpNotIn, a string for string matching
+
+	// CaseInsensitive makes the string matching operators (OpContains,
+	// OpHasPrefix, OpHasSuffix and OpRegex) ignore case
+	CaseInsensitive bool
+
+	// MatchMissing makes documents without the field match the negative
+	// operators OpNotEqual and OpNotIn. By default a missing field matches no
+	// operator at all.
+	MatchMissing bool
+
+	// ValueType selects how values are compared. ValueDateTime compares
+	// RFC3339 strings and unix seconds as instants.
+	ValueType ValueType
+}
+
+// Param is a placeholder for a filter value, bound by name each time a
+// prepared query runs. Queries run without preparing reject it.
+type Param string
+
+// ValueType is a comparison mode for filter values
+type ValueType int
+
+const (
+	// ValueAuto compares values by their dynamic type. Two strings that both
+	// parse as RFC3339 timestamps compare as instants.
+	ValueAuto ValueType = iota
+	// ValueDateTime compares values as instants: RFC3339 strings, unix
+	// seconds and time.Time values. Values that are none of these never
+	// match, except under the negative operators.
+	ValueDateTime
+)
+
+// valueTypeNames maps value types to their encoded names
+var valueTypeNames = map[ValueType]string{
+	ValueAuto:     "auto",
+	ValueDateTime: "datetime",
+}
+
+// String returns the name of the value type
+func (v ValueType) String() string {
+	if name, ok := valueTypeNames[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("ValueType(%d)", int(v))
+}
+
+// MarshalText encodes the value type by name
+func (v ValueType) MarshalText() ([]byte, error) {
+	name, ok := valueTypeNames[v]
+	if !ok {
+		return nil, fmt.Errorf("unknown value type: %d", int(v))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes a value type from its name
+func (v *ValueType) UnmarshalText(text []byte) error {
+	for valueType, name := range valueTypeNames {
+		if name == string(text) {
+			*v = valueType
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown value type: %s", text)
+}
+
+// LogicOperator defines how a FilterNode combines its children
+type LogicOperator int
+
+const (
+	// LogicLeaf nodes evaluate their Filter
+	LogicLeaf LogicOperator = iota
+	// LogicAnd nodes match when every child matches
+	LogicAnd
+	// LogicOr nodes match when any child matches
+	LogicOr
+	// LogicNot nodes match when their single child does not
+	LogicNot
+)
+
+// FilterNode is a node of a boolean filter tree: a leaf holding a single
+// Filter, or a group combining child nodes
+type FilterNode struct {
+	Logic    LogicOperator
+	Filter   *Filter      // Set for LogicLeaf nodes
+	Children []FilterNode // Set for LogicAnd, LogicOr and LogicNot nodes
+}
+
+// Leaf returns a filter tree node matching a single filter
+func Leaf(f Filter) FilterNode {
+	return FilterNode{Logic: LogicLeaf, Filter: &f}
+}
+
+// And returns a filter tree node matching when every child matches
+func And(children ...FilterNode) FilterNode {
+	return FilterNode{Logic: LogicAnd, Children: children}
+}
+
+// Or returns a filter tree node matching when any child matches
+func Or(children ...FilterNode) FilterNode {
+	return FilterNode{Logic: LogicOr, Children: children}
+}
+
+// Not returns a filter tree node matching when child does not
+func Not(child FilterNode) FilterNode {
+	return FilterNode{Logic: LogicNot, Children: []FilterNode{child}}
 }
 
 // FilterOperator defines comparison operators
@@ -38,14 +172,82 @@ const (
 	OpLessThan
 	OpGreaterThanOrEqual
 	OpLessThanOrEqual
+	OpNotEqual
+	OpIn
+	OpNotIn
+	OpContains
+	OpHasPrefix
+	OpHasSuffix
+	OpRegex
+	OpExists // Value true matches present fields, false matches absent ones
+	OpIsNull // Matches fields present with an explicit null; Value false inverts
 )
 
+// filterOperatorNames maps filter operators to their encoded names
+var filterOperatorNames = map[FilterOperator]string{
+	OpEqual:              "eq",
+	OpGreaterThan:        "gt",
+	OpLessThan:           "lt",
+	OpGreaterThanOrEqual: "gte",
+	OpLessThanOrEqual:    "lte",
+	OpNotEqual:           "ne",
+	OpIn:                 "in",
+	OpNotIn:              "nin",
+	OpContains:           "contains",
+	OpHasPrefix:          "prefix",
+	OpHasSuffix:          "suffix",
+	OpRegex:              "regex",
+	OpExists:             "exists",
+	OpIsNull:             "isnull",
+}
+
+// String returns the name of the filter operator
+func (o FilterOperator) String() string {
+	if name, ok := filterOperatorNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("FilterOperator(%d)", int(o))
+}
+
+// MarshalText encodes the filter operator by name
+func (o FilterOperator) MarshalText() ([]byte, error) {
+	name, ok := filterOperatorNames[o]
+	if !ok {
+		return nil, fmt.Errorf("unknown filter operator: %d", int(o))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes a filter operator from its name
+func (o *FilterOperator) UnmarshalText(text []byte) error {
+	for op, name := range filterOperatorNames {
+		if name == string(text) {
+			*o = op
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown filter operator: %s", text)
+}
+
 // SortOption defines sorting configuration
 type SortOption struct {
-	Field      string
+	Field      string // May be a dotted path into nested documents
 	Descending bool
+
+	// MissingFirst sorts documents without the field before all others. By
+	// default they sort last, whatever the direction.
+	MissingFirst bool
 }
 
+// BatchFunc receives the current documents of a collection, which it must
+// not modify, and returns the writes to apply atomically. A nil document in
+// the writes deletes that document.
+type BatchFunc func(docs map[DocumentID]Document) (map[DocumentID]Document, error)
+
+// MultiBatchFunc is the multi-collection form of BatchFunc: it receives the
+// current documents of each collection and returns writes keyed by collection
+type MultiBatchFunc func(docs map[string]map[DocumentID]Document) (map[string]map[DocumentID]Document, error)
+
 // Transaction represents an ACID transaction
 type Transaction struct {
 	ID         string
@@ -78,7 +280,8 @@ type StorageEngine interface {
 	// ReadDocument retrieves a document by ID
 	ReadDocument(collection string, docID DocumentID) (Document, error)
 
-	// DeleteDocument removes a document from storage
+	// DeleteDocument removes a document from storage, or returns
+	// ErrDocumentNotFound
 	DeleteDocument(collection string, docID DocumentID) error
 
 	// ScanCollection iterates over all documents in a collection
@@ -99,8 +302,8 @@ type IndexManager interface {
 	// CreatePrimaryIndex builds the primary key index
 	CreatePrimaryIndex(collection string) error
 
-	// CreateSecondaryIndex builds an index on a field
-	CreateSecondaryIndex(collection string, field string) error
+	// CreateSecondaryIndex builds an index of the given kind on a field
+	CreateSecondaryIndex(collection string, field string, kind IndexKind) error
 
 	// LookupPrimary performs O(1) lookup by primary key
 	LookupPrimary(collection string, docID DocumentID) (Document, error)
@@ -108,6 +311,9 @@ type IndexManager interface {
 	// LookupSecondary finds documents matching a field value
 	LookupSecondary(collection string, field string, value interface{}) ([]Document, error)
 
+	// LookupSecondaryIDs finds the IDs of documents matching a field value
+	LookupSecondaryIDs(collection string, field string, value interface{}) ([]DocumentID, error)
+
 	// UpdateIndexes updates all indexes after a write operation
 	UpdateIndexes(collection string, docID DocumentID, doc Document, op OperationType) error
 
@@ -119,4 +325,76 @@ type IndexManager interface {
 
 	// RebuildIndexes reconstructs indexes from storage
 	RebuildIndexes(collection string) error
+
+	// ListIndexes describes the secondary indexes of a collection
+	ListIndexes(collection string) ([]IndexInfo, error)
+
+	// DropIndex removes a secondary index by name
+	DropIndex(collection string, name string) error
+}
+
+// IndexInfo describes a secondary index
+type IndexInfo struct {
+	Name            string
+	Fields          []string
+	Kind            IndexKind
+	Unique          bool
+	Sparse          bool  // Documents with a missing or null field are not indexed
+	CaseInsensitive bool  // String values are matched case-insensitively
+	DocumentCount   int   // Documents with at least one entry in the index
+	SizeBytes       int64 // Rough in-memory size estimate
+	Stale           bool  // Storage has changed without the index being updated
+}
+
+// IndexKind selects the data structure backing a secondary index
+type IndexKind int
+
+const (
+	// IndexHash answers equality lookups in O(1)
+	IndexHash IndexKind = iota
+	// IndexOrdered keeps values sorted to answer range queries and ordered scans
+	IndexOrdered
+	// IndexComposite orders documents by a tuple of field values for multi-field lookups
+	IndexComposite
+	// IndexText maps word tokens to documents for full-text search
+	IndexText
+	// IndexExpiry keeps documents in order of an expiry time for purging them when due
+	IndexExpiry
+)
+
+// indexKindNames maps index kinds to their persisted names
+var indexKindNames = map[IndexKind]string{
+	IndexHash:      "hash",
+	IndexOrdered:   "ordered",
+	IndexComposite: "composite",
+	IndexText:      "text",
+	IndexExpiry:    "expiry",
+}
+
+// String returns the name of the index kind
+func (k IndexKind) String() string {
+	if name, ok := indexKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("IndexKind(%d)", int(k))
+}
+
+// MarshalText encodes the index kind by name
+func (k IndexKind) MarshalText() ([]byte, error) {
+	name, ok := indexKindNames[k]
+	if !ok {
+		return nil, fmt.Errorf("unknown index kind: %d", int(k))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes an index kind from its name
+func (k *IndexKind) UnmarshalText(text []byte) error {
+	for kind, name := range indexKindNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown index kind: %s", text)
 }
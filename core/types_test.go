@@ -1,6 +1,9 @@
 package core
 
 import (
+	"encoding/json"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -53,6 +56,46 @@ func TestFilterOperators(t *testing.T) {
 	}
 }
 
+// TestFilterOperatorNames verifies filter operators encode by name and round-trip
+func TestFilterOperatorNames(t *testing.T) {
+	for op := OpEqual; op <= OpIsNull; op++ {
+		text, err := op.MarshalText()
+		if err != nil {
+			t.Fatalf("Failed to marshal %d: %v", int(op), err)
+		}
+		var decoded FilterOperator
+		if err := decoded.UnmarshalText(text); err != nil || decoded != op {
+			t.Errorf("Expected %s to round-trip, got %v (%v)", text, decoded, err)
+		}
+	}
+
+	data, _ := json.Marshal(Filter{Field: "age", Operator: OpGreaterThanOrEqual, Value: 18})
+	if !strings.Contains(string(data), `"Operator":"gte"`) {
+		t.Errorf("Expected operator encoded by name, got %s", data)
+	}
+	if _, err := FilterOperator(99).MarshalText(); err == nil {
+		t.Errorf("Expected error for an unknown operator")
+	}
+}
+
+// TestValueTypeNames verifies value types encode by name and round-trip
+func TestValueTypeNames(t *testing.T) {
+	for _, valueType := range []ValueType{ValueAuto, ValueDateTime} {
+		text, err := valueType.MarshalText()
+		if err != nil {
+			t.Fatalf("Failed to marshal %d: %v", int(valueType), err)
+		}
+		var decoded ValueType
+		if err := decoded.UnmarshalText(text); err != nil || decoded != valueType {
+			t.Errorf("Expected %s to round-trip, got %v (%v)", text, decoded, err)
+		}
+	}
+
+	if err := new(ValueType).UnmarshalText([]byte("date")); err == nil {
+		t.Errorf("Expected error for an unknown value type")
+	}
+}
+
 // TestOperationTypes verifies OperationType constants
 func TestOperationTypes(t *testing.T) {
 	tests := []struct {
@@ -123,3 +166,66 @@ func TestTransactionCreation(t *testing.T) {
 		t.Error("Expected transaction to not be committed")
 	}
 }
+
+// TestDocumentClone verifies Clone deep-copies nested objects and arrays
+func TestDocumentClone(t *testing.T) {
+	doc := Document{
+		"name":    "original",
+		"address": map[string]interface{}{"city": "Berlin"},
+		"tags":    []interface{}{"a", map[string]interface{}{"k": "v"}},
+	}
+
+	clone := doc.Clone()
+	clone["name"] = "changed"
+	clone["address"].(map[string]interface{})["city"] = "Paris"
+	clone["tags"].([]interface{})[1].(map[string]interface{})["k"] = "changed"
+
+	if doc["name"] != "original" {
+		t.Errorf("Expected top-level field to be unchanged, got %v", doc["name"])
+	}
+	if doc["address"].(map[string]interface{})["city"] != "Berlin" {
+		t.Errorf("Expected nested object to be unchanged")
+	}
+	if doc["tags"].([]interface{})[1].(map[string]interface{})["k"] != "v" {
+		t.Errorf("Expected object inside array to be unchanged")
+	}
+
+	if Document(nil).Clone() != nil {
+		t.Errorf("Expected nil document to clone to nil")
+	}
+}
+
+// TestDocumentMergePatch verifies merge patch semantics and that the source is unchanged
+func TestDocumentMergePatch(t *testing.T) {
+	doc := Document{
+		"status":  "open",
+		"owner":   "alice",
+		"address": map[string]interface{}{"city": "Berlin", "zip": "10115"},
+		"tags":    []interface{}{"a"},
+	}
+
+	patched := doc.MergePatch(Document{
+		"status":  "archived",
+		"owner":   nil,
+		"address": map[string]interface{}{"zip": nil, "street": "Main"},
+		"tags":    []interface{}{"b"},
+		"meta":    map[string]interface{}{"by": "bot", "gone": nil},
+	})
+
+	expected := Document{
+		"status":  "archived",
+		"address": map[string]interface{}{"city": "Berlin", "street": "Main"},
+		"tags":    []interface{}{"b"},
+		"meta":    map[string]interface{}{"by": "bot"},
+	}
+	if !reflect.DeepEqual(patched, expected) {
+		t.Errorf("Expected %v, got %v", expected, patched)
+	}
+	if doc["status"] != "open" || doc["address"].(map[string]interface{})["zip"] != "10115" {
+		t.Errorf("Expected source document to be unchanged, got %v", doc)
+	}
+
+	if got := Document(nil).MergePatch(Document{"a": 1}); !reflect.DeepEqual(got, Document{"a": 1}) {
+		t.Errorf("Expected patch of nil document to create one, got %v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// ToFloat64 converts any Go numeric type, including json.Number, to float64
+func ToFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Time formats a timestamp in the canonical form documents should store:
+// RFC3339 in UTC with nanoseconds when present
+func Time(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// ToTime converts a time.Time, an RFC3339 string or a number of unix seconds,
+// possibly fractional, to a time
+func ToTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	}
+
+	f, ok := ToFloat64(value)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) || math.Abs(f) > maxUnixSeconds {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*1e9)).UTC(), true
+}
+
+// maxUnixSeconds bounds the unix seconds ToTime accepts to those a float64
+// holds exactly
+const maxUnixSeconds = 1 << 53
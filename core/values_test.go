@@ -0,0 +1,59 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+// TestTime verifies timestamps are written in canonical UTC form
+func TestTime(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	tests := []struct {
+		in       time.Time
+		expected string
+	}{
+		{time.Date(2024, 1, 1, 10, 0, 0, 0, berlin), "2024-01-01T09:00:00Z"},
+		{time.Date(2024, 1, 1, 9, 0, 0, 500000000, time.UTC), "2024-01-01T09:00:00.5Z"},
+	}
+
+	for _, tt := range tests {
+		if got := Time(tt.in); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+// TestToTime verifies the values accepted as timestamps
+func TestToTime(t *testing.T) {
+	instant := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected time.Time
+		ok       bool
+	}{
+		{"utc string", "2024-01-01T09:00:00Z", instant, true},
+		{"offset string", "2024-01-01T11:00:00+02:00", instant, true},
+		{"unix seconds", float64(instant.Unix()), instant, true},
+		{"unix seconds as int64", instant.Unix(), instant, true},
+		{"fractional seconds", float64(instant.Unix()) + 0.25, instant.Add(250 * time.Millisecond), true},
+		{"time value", instant, instant, true},
+		{"date only", "2024-01-01", time.Time{}, false},
+		{"not a date", "yesterday", time.Time{}, false},
+		{"bool", true, time.Time{}, false},
+		{"nil", nil, time.Time{}, false},
+		{"huge number", 1e300, time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToTime(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok %v, got %v", tt.ok, ok)
+			}
+			if ok && !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
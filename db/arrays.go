@@ -0,0 +1,227 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// ErrNotArray is returned by the array operations for a field that holds a
+// value other than an array, or a path through a value that is not an object
+var ErrNotArray = errors.New("field is not an array")
+
+// PushOptions configures PushToArrayWithOptions
+type PushOptions struct {
+	// MaxLength keeps only the last MaxLength elements after the push, as
+	// for a capped activity feed; 0 keeps every element
+	MaxLength int
+}
+
+// PushToArray appends values to an array field of a document. Like the
+// other array operations it reads, changes and writes the document under
+// the collection's write lock, so concurrent pushes are never lost. The
+// field is a dotted path; a missing field, with any objects above it, is
+// created as an array, and one holding anything but an array fails with
+// ErrNotArray. Values are stored as their JSON encoding decodes, and the
+// indexes on the field, multikey ones included, are updated with the write.
+// A collection with a security policy fails with ErrNoPrincipal; use the
+// Scope array operations.
+func (d *DB) PushToArray(collection string, docID core.DocumentID, field string, values ...interface{}) error {
+	return d.PushToArrayWithOptions(collection, docID, field, values, PushOptions{})
+}
+
+// PushToArrayWithOptions appends values to an array field of a document
+// like PushToArray, configured by opts
+func (d *DB) PushToArrayWithOptions(collection string, docID core.DocumentID, field string, values []interface{}, opts PushOptions) error {
+	c, err := d.Collection(collection)
+	if err != nil {
+		return err
+	}
+	return c.pushToArray(docID, field, values, opts)
+}
+
+// PullFromArray removes the elements of an array field of a document equal
+// to match, as filters compare values, and returns how many it removed. A
+// missing field removes nothing. See PushToArray for the field.
+func (d *DB) PullFromArray(collection string, docID core.DocumentID, field string, match interface{}) (int, error) {
+	c, err := d.Collection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return c.pullFromArray(docID, field, match)
+}
+
+// AddToSet appends the values not already in an array field of a document,
+// as filters compare values, so 1 and "1" are different elements, and
+// returns how many it appended. See PushToArray for the field.
+func (d *DB) AddToSet(collection string, docID core.DocumentID, field string, values ...interface{}) (int, error) {
+	c, err := d.Collection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return c.addToSet(docID, field, values)
+}
+
+// PushToArray is DB.PushToArray on behalf of the scope's principal, which
+// sees only the documents the collection's security policy lets it
+func (s *Scope) PushToArray(collection string, docID core.DocumentID, field string, values ...interface{}) error {
+	return s.PushToArrayWithOptions(collection, docID, field, values, PushOptions{})
+}
+
+// PushToArrayWithOptions is DB.PushToArrayWithOptions on behalf of the
+// scope's principal
+func (s *Scope) PushToArrayWithOptions(collection string, docID core.DocumentID, field string, values []interface{}, opts PushOptions) error {
+	c, err := s.Collection(collection)
+	if err != nil {
+		return err
+	}
+	return c.pushToArray(docID, field, values, opts)
+}
+
+// PullFromArray is DB.PullFromArray on behalf of the scope's principal
+func (s *Scope) PullFromArray(collection string, docID core.DocumentID, field string, match interface{}) (int, error) {
+	c, err := s.Collection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return c.pullFromArray(docID, field, match)
+}
+
+// AddToSet is DB.AddToSet on behalf of the scope's principal
+func (s *Scope) AddToSet(collection string, docID core.DocumentID, field string, values ...interface{}) (int, error) {
+	c, err := s.Collection(collection)
+	if err != nil {
+		return 0, err
+	}
+	return c.addToSet(docID, field, values)
+}
+
+// pushToArray appends values to an array field through the handle, as
+// PushToArrayWithOptions does
+func (c *Collection) pushToArray(docID core.DocumentID, field string, values []interface{}, opts PushOptions) error {
+	if opts.MaxLength < 0 {
+		return fmt.Errorf("invalid push max length: %d", opts.MaxLength)
+	}
+	elements, err := jsonValues(values...)
+	if err != nil {
+		return fmt.Errorf("failed to push to %s/%s: %w", c.name, docID, err)
+	}
+	return c.mutateArray(docID, field, func(array []interface{}, _ bool) ([]interface{}, bool) {
+		array = append(array, elements...)
+		if opts.MaxLength > 0 && len(array) > opts.MaxLength {
+			array = array[len(array)-opts.MaxLength:]
+		}
+		return array, true
+	})
+}
+
+// pullFromArray removes elements from an array field through the handle,
+// as PullFromArray does
+func (c *Collection) pullFromArray(docID core.DocumentID, field string, match interface{}) (int, error) {
+	matches, err := jsonValues(match)
+	if err != nil {
+		return 0, fmt.Errorf("failed to pull from %s/%s: %w", c.name, docID, err)
+	}
+	var removed int
+	err = c.mutateArray(docID, field, func(array []interface{}, exists bool) ([]interface{}, bool) {
+		removed = 0
+		kept := make([]interface{}, 0, len(array))
+		for _, element := range array {
+			if query.ValuesEqual(element, matches[0]) {
+				removed++
+				continue
+			}
+			kept = append(kept, element)
+		}
+		return kept, exists && removed > 0
+	})
+	return removed, err
+}
+
+// addToSet appends missing values to an array field through the handle, as
+// AddToSet does
+func (c *Collection) addToSet(docID core.DocumentID, field string, values []interface{}) (int, error) {
+	elements, err := jsonValues(values...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add to %s/%s: %w", c.name, docID, err)
+	}
+	var added int
+	err = c.mutateArray(docID, field, func(array []interface{}, exists bool) ([]interface{}, bool) {
+		added = 0
+		for _, element := range elements {
+			if !containsValue(array, element) {
+				array = append(array, element)
+				added++
+			}
+		}
+		return array, !exists || added > 0
+	})
+	return added, err
+}
+
+// mutateArray replaces the array at a field of a document with what fn
+// makes of it, as one write. fn receives a copy of the array, nil if the
+// field is missing, and whether it exists, and reports whether to write.
+func (c *Collection) mutateArray(docID core.DocumentID, field string, fn func(array []interface{}, exists bool) ([]interface{}, bool)) error {
+	collection := c.name
+	if docID == "" || field == "" {
+		return fmt.Errorf("missing ID or field - unable to change an array of %s", collection)
+	}
+	if err := c.db.rulesFor(collection).checkQuery(core.Query{Filters: []core.Filter{{Field: field}}}); err != nil {
+		return fmt.Errorf("failed to change %s/%s: %w", collection, docID, err)
+	}
+
+	return c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		existing, exists := docs[docID]
+		if !exists {
+			return nil, fmt.Errorf("failed to change %s/%s: %w", collection, docID, core.ErrDocumentNotFound)
+		}
+		doc := existing.Clone()
+		parent, name, err := fieldSlot(doc, field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to change %s/%s: %w: %w", collection, docID, ErrNotArray, err)
+		}
+
+		value, found := parent[name]
+		array, isArray := value.([]interface{})
+		if found && !isArray {
+			return nil, fmt.Errorf("failed to change %s/%s: %w: %s holds a %T", collection, docID, ErrNotArray, field, value)
+		}
+		array, write := fn(array, found)
+		if !write {
+			return nil, nil
+		}
+		if array == nil {
+			array = []interface{}{}
+		}
+		parent[name] = array
+		return map[core.DocumentID]core.Document{docID: doc}, nil
+	})
+}
+
+// containsValue reports whether an array holds an element equal to value
+func containsValue(array []interface{}, value interface{}) bool {
+	for _, element := range array {
+		if query.ValuesEqual(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonValues returns values as their JSON encoding decodes, the form
+// documents read from disk hold
+func jsonValues(values ...interface{}) ([]interface{}, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+	var decoded []interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode values: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ExportPretty makes ExportCanonical indent each document over several
+// lines, two spaces per level, rather than writing it on one line. It has no
+// effect on ExportJSONL.
+func ExportPretty() ExportOption {
+	return func(s *exportSettings) {
+		s.pretty = true
+	}
+}
+
+// ExportCanonical writes the collection's documents to w as ExportJSONL
+// does, in a form that only changes when the documents do, for keeping
+// exports under version control: documents in ID order, object keys sorted
+// at every level, no HTML escaping, and RFC 3339 timestamps normalized to
+// UTC. Collection metadata is never exported. With ExportPretty, documents
+// are indented. It returns the number of documents written.
+func (c *Collection) ExportCanonical(w io.Writer, opts ...ExportOption) (int, error) {
+	settings := exportOptions(opts)
+	return c.export(w, settings, func(doc core.Document) ([]byte, error) {
+		return encodeCanonical(doc, settings.pretty)
+	})
+}
+
+// encodeCanonical encodes a document in canonical form, without a trailing
+// newline
+func encodeCanonical(doc core.Document, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	// Maps are encoded with their keys sorted
+	if err := enc.Encode(canonicalValue(doc)); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// canonicalValue returns a copy of a document value with its timestamps
+// normalized to UTC
+func canonicalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case core.Document:
+		return canonicalValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = canonicalValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, value := range v {
+			out[i] = canonicalValue(value)
+		}
+		return out
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return t.UTC().Format(time.RFC3339Nano)
+		}
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// CollectionDiff is what changed between two exports of a collection, each
+// list sorted by ID
+type CollectionDiff struct {
+	Added   []core.DocumentID // In the second export only
+	Removed []core.DocumentID // In the first export only
+	Changed []DocumentChange
+}
+
+// DocumentChange is a document in both exports whose fields differ
+type DocumentChange struct {
+	ID     core.DocumentID
+	Fields []string // Dotted paths of the fields that differ, sorted
+}
+
+// Empty reports whether the exports hold the same documents
+func (d CollectionDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// diffSettings holds the settings of DiffCollections
+type diffSettings struct {
+	idKey string
+}
+
+// DiffOption configures DiffCollections
+type DiffOption func(*diffSettings)
+
+// DiffIDKey reads document IDs from key, for exports of a database opened
+// WithIDKey. The default is "_id".
+func DiffIDKey(key string) DiffOption {
+	return func(s *diffSettings) {
+		s.idKey = key
+	}
+}
+
+// DiffCollections compares two exports of a collection, as written by
+// ExportCanonical in either layout or by ExportJSONL, reporting the
+// documents added, removed and changed from a to b. Documents are compared
+// in canonical form, so formatting and timestamp offsets are not changes.
+func DiffCollections(a, b io.Reader, opts ...DiffOption) (CollectionDiff, error) {
+	settings := diffSettings{idKey: core.DefaultIDKey}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	before, err := readExport(a, settings.idKey)
+	if err != nil {
+		return CollectionDiff{}, err
+	}
+	after, err := readExport(b, settings.idKey)
+	if err != nil {
+		return CollectionDiff{}, err
+	}
+
+	var diff CollectionDiff
+	for id, doc := range after {
+		old, exists := before[id]
+		if !exists {
+			diff.Added = append(diff.Added, id)
+			continue
+		}
+		var fields []string
+		diffFields("", old, doc, &fields)
+		if len(fields) > 0 {
+			sort.Strings(fields)
+			diff.Changed = append(diff.Changed, DocumentChange{ID: id, Fields: fields})
+		}
+	}
+	for id := range before {
+		if _, exists := after[id]; !exists {
+			diff.Removed = append(diff.Removed, id)
+		}
+	}
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i] < diff.Added[j] })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i] < diff.Removed[j] })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].ID < diff.Changed[j].ID })
+	return diff, nil
+}
+
+// readExport reads the documents of an export by ID, in canonical form.
+// Numbers are kept as written, so they compare exactly.
+func readExport(r io.Reader, idKey string) (map[core.DocumentID]interface{}, error) {
+	docs := make(map[core.DocumentID]interface{})
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	for n := 1; ; n++ {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); errors.Is(err, io.EOF) {
+			return docs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read export document %d: %w", n, err)
+		}
+
+		id, _ := doc[idKey].(string)
+		if id == "" {
+			return nil, fmt.Errorf("failed to read export document %d: missing string ID under %s", n, idKey)
+		}
+		if _, exists := docs[core.DocumentID(id)]; exists {
+			return nil, fmt.Errorf("failed to read export document %d: duplicate ID %s", n, id)
+		}
+		docs[core.DocumentID(id)] = canonicalValue(doc)
+	}
+}
+
+// diffFields appends the paths under path at which a and b differ, recursing
+// into objects; arrays and other values differ as a whole
+func diffFields(path string, a, b interface{}, fields *[]string) {
+	am, aIsObject := a.(map[string]interface{})
+	bm, bIsObject := b.(map[string]interface{})
+	if !aIsObject || !bIsObject {
+		if !reflect.DeepEqual(a, b) {
+			*fields = append(*fields, path)
+		}
+		return
+	}
+
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	for key, av := range am {
+		if bv, exists := bm[key]; exists {
+			diffFields(join(key), av, bv, fields)
+		} else {
+			*fields = append(*fields, join(key))
+		}
+	}
+	for key := range bm {
+		if _, exists := am[key]; !exists {
+			*fields = append(*fields, join(key))
+		}
+	}
+}
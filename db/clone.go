@@ -0,0 +1,198 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// defaultCloneBatchSize is how many documents CloneCollection writes at a
+// time unless CloneBatchSize is given
+const defaultCloneBatchSize = 1000
+
+// ErrCollectionExists is returned by CloneCollection for a destination that
+// already exists, unless CloneOverwrite is given, and by
+// CreateCollectionWithSpec
+var ErrCollectionExists = errors.New("collection already exists")
+
+// cloneOptions holds the settings applied by CloneOption
+type cloneOptions struct {
+	overwrite   bool
+	definitions bool
+	batchSize   int
+	progress    func(copied, total int)
+}
+
+// CloneOption configures CloneCollection
+type CloneOption func(*cloneOptions)
+
+// CloneOverwrite drops the destination first if it exists
+func CloneOverwrite() CloneOption {
+	return func(o *cloneOptions) {
+		o.overwrite = true
+	}
+}
+
+// CloneDefinitions copies the source's schema, defaults, encrypted fields,
+// redaction, key order setting, custom metadata and secondary index
+// definitions along with its documents. The key of encrypted fields carries over too.
+func CloneDefinitions() CloneOption {
+	return func(o *cloneOptions) {
+		o.definitions = true
+	}
+}
+
+// CloneBatchSize sets how many documents are written at a time (default 1000)
+func CloneBatchSize(n int) CloneOption {
+	return func(o *cloneOptions) {
+		o.batchSize = n
+	}
+}
+
+// CloneProgress makes fn observe a clone, called after each batch with the
+// documents copied so far and the number to copy
+func CloneProgress(fn func(copied, total int)) CloneOption {
+	return func(o *cloneOptions) {
+		o.progress = fn
+	}
+}
+
+// CloneCollection copies the documents of src matching q, reshaped by its
+// projection, into a new collection dst; a nil q copies every document. The
+// copy is of a snapshot of src, so writes to src while it runs are either
+// all in it or not at all. Documents are copied as stored, encrypted fields
+// still encrypted, and their writes run no hooks or field rules. Queries
+// with a sort, limit or offset are rejected, as are filters on encrypted
+// fields. A dst that exists fails with ErrCollectionExists unless
+// CloneOverwrite is given; a clone that fails part way leaves dst behind.
+func (d *DB) CloneCollection(src, dst string, q *core.Query, opts ...CloneOption) error {
+	o := cloneOptions{batchSize: defaultCloneBatchSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batchSize <= 0 {
+		return fmt.Errorf("invalid clone batch size: %d", o.batchSize)
+	}
+	if src == dst {
+		return fmt.Errorf("unable to clone %s onto itself", src)
+	}
+	if err := validateName(dst); err != nil {
+		return err
+	}
+
+	var filter core.Query
+	if q != nil {
+		filter = *q
+	}
+	rules := d.rulesFor(src)
+	if err := rules.checkQuery(filter); err != nil {
+		return err
+	}
+	matcher, err := query.NewMatcher(filter)
+	if err != nil {
+		return fmt.Errorf("failed to clone %s: %w", src, err)
+	}
+
+	snapshot, err := d.Snapshot(src)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, 0, len(snapshot.File.Documents))
+	for id := range snapshot.File.Documents {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	matches := make(map[core.DocumentID]core.Document)
+	for _, id := range ids {
+		if doc, ok := matcher.Match(core.DocumentID(id), snapshot.File.Documents[id]); ok {
+			matches[core.DocumentID(id)] = doc
+		}
+	}
+
+	if err := d.createClone(dst, o.overwrite); err != nil {
+		return err
+	}
+	if o.definitions {
+		if err := d.cloneDefinitions(snapshot, dst, rules); err != nil {
+			return fmt.Errorf("failed to clone definitions of %s: %w", src, err)
+		}
+	}
+
+	matched := sortedIDs(matches)
+	for start := 0; start < len(matched); start += o.batchSize {
+		end := min(start+o.batchSize, len(matched))
+		batch := make(map[core.DocumentID]core.Document, end-start)
+		for _, id := range matched[start:end] {
+			batch[id] = matches[id]
+		}
+		if err := d.indexes.ApplyBatch(dst, func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			return batch, nil
+		}); err != nil {
+			return fmt.Errorf("failed to clone %s into %s: %w", src, dst, err)
+		}
+		if o.progress != nil {
+			o.progress(end, len(matched))
+		}
+	}
+	return nil
+}
+
+// createClone creates the destination of a clone, dropping it first if it
+// exists and overwrite is set
+func (d *DB) createClone(dst string, overwrite bool) error {
+	d.mu.Lock()
+	_, exists := d.collections[dst]
+	d.mu.Unlock()
+
+	if exists {
+		if !overwrite {
+			return fmt.Errorf("failed to clone into %s: %w", dst, ErrCollectionExists)
+		}
+		if err := d.DropCollection(dst); err != nil {
+			return err
+		}
+	}
+	_, err := d.CreateCollection(dst)
+	return err
+}
+
+// cloneDefinitions gives the destination of a clone the configuration and
+// index definitions of a snapshot, and the field rules of its source
+func (d *DB) cloneDefinitions(snapshot *CollectionSnapshot, dst string, rules fieldRules) error {
+	metadata := snapshot.File.Metadata
+	if err := d.storage.SetSchema(dst, metadata.Schema, metadata.SchemaMode); err != nil {
+		return err
+	}
+	if err := d.storage.SetDefaults(dst, metadata.Defaults); err != nil {
+		return err
+	}
+	if err := d.storage.SetEncryptedFields(dst, metadata.EncryptedFields); err != nil {
+		return err
+	}
+	if err := d.storage.SetRedaction(dst, metadata.Redaction); err != nil {
+		return err
+	}
+	if err := d.storage.SetPreserveKeyOrder(dst, metadata.PreserveKeyOrder); err != nil {
+		return err
+	}
+	if err := d.storage.SetCollectionMeta(dst, metadata.Custom); err != nil {
+		return err
+	}
+	if err := d.indexes.RestoreDefinitions(dst, snapshot.Indexes); err != nil {
+		return err
+	}
+	if err := d.loadRules(dst); err != nil {
+		return err
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	cloned := d.rules[dst]
+	cloned.cipher = rules.cipher
+	d.rules[dst] = cloned
+	return nil
+}
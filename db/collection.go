@@ -0,0 +1,217 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// Collection is a handle on one collection of a DB. Writes keep the
+// collection's indexes up to date.
+type Collection struct {
+	name      string
+	db        *DB
+	coll      *core.Collection
+	principal *Principal // Who the handle acts on behalf of; nil outside a Scope
+}
+
+// Name returns the collection's name
+func (c *Collection) Name() string {
+	return c.name
+}
+
+// Insert stores a new document and returns its ID. The ID is taken from the
+// document's ID key ("_id" unless configured with WithIDKey) or generated and
+// written into that key, so it round-trips. Inserting an ID that is taken
+// fails with core.ErrDocumentExists.
+func (c *Collection) Insert(doc core.Document) (core.DocumentID, error) {
+	if doc == nil {
+		return "", fmt.Errorf("missing document - unable to insert into %s", c.name)
+	}
+
+	var id core.DocumentID
+	if err := c.apply(c.db.opts.ids.InsertBatch(doc, &id)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Get returns a document by ID, or core.ErrDocumentNotFound
+func (c *Collection) Get(id core.DocumentID) (core.Document, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	doc, err := c.coll.ReadDocument(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkVisible(id, doc); err != nil {
+		return nil, err
+	}
+	c.db.storage.RecordRead(c.name, id)
+	return c.db.rulesFor(c.name).readable(doc.Clone())
+}
+
+// Update replaces an existing document, failing with core.ErrDocumentNotFound
+// if there is none
+func (c *Collection) Update(id core.DocumentID, doc core.Document) error {
+	if id == "" || doc == nil {
+		return fmt.Errorf("missing document or ID - unable to update %s", c.name)
+	}
+	return c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		if _, exists := docs[id]; !exists {
+			return nil, fmt.Errorf("failed to update %s/%s: %w", c.name, id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: doc.Clone()}, nil
+	})
+}
+
+// Delete removes a document, failing with core.ErrDocumentNotFound if there
+// is none
+func (c *Collection) Delete(id core.DocumentID) error {
+	return c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		if _, exists := docs[id]; !exists {
+			return nil, fmt.Errorf("failed to delete %s/%s: %w", c.name, id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: nil}, nil
+	})
+}
+
+// Find returns the documents matching a query. The query's collection is
+// set to this collection.
+func (c *Collection) Find(q core.Query) ([]core.Document, error) {
+	return c.FindContext(context.Background(), q)
+}
+
+// FindContext is Find, traced as a child of the span in ctx when the
+// database is opened WithTracer
+func (c *Collection) FindContext(ctx context.Context, q core.Query) ([]core.Document, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	rules := c.db.rulesFor(c.name)
+	if err := rules.checkQuery(q); err != nil {
+		return nil, err
+	}
+	q, err := c.secure(q)
+	if err != nil {
+		return nil, err
+	}
+	q.Collection = c.name
+	docs, err := c.db.query.ExecuteContext(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if docs[i], err = rules.readable(doc); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// Count returns the number of documents matching a query, ignoring its
+// limit and offset
+func (c *Collection) Count(q core.Query) (int, error) {
+	if err := c.db.check(); err != nil {
+		return 0, err
+	}
+	if err := c.db.rulesFor(c.name).checkQuery(q); err != nil {
+		return 0, err
+	}
+	q, err := c.secure(q)
+	if err != nil {
+		return 0, err
+	}
+	q.Collection = c.name
+	return c.db.query.ExecuteCount(q)
+}
+
+// Batch applies the writes fn returns atomically: fn receives the
+// collection's documents as stored, with encrypted fields still wrapped, and
+// returns the documents to write, a nil document deleting. It must not
+// modify the documents it receives. The writes go through the collection's
+// field rules, references and hooks like any other.
+func (c *Collection) Batch(fn core.BatchFunc) error {
+	return c.apply(fn)
+}
+
+// apply runs a checked write as a batch, so the check and the write happen
+// under one lock, applying the collection's field rules and references and
+// running its hooks
+func (c *Collection) apply(fn core.BatchFunc) error {
+	return c.applyContext(context.Background(), fn)
+}
+
+// applyContext is apply passing ctx through to storage
+func (c *Collection) applyContext(ctx context.Context, fn core.BatchFunc) error {
+	if err := c.db.check(); err != nil {
+		return err
+	}
+	filter, err := c.rowFilter()
+	if err != nil {
+		return err
+	}
+
+	hooks := c.db.hooks.forCollection(c.name)
+	rules := c.db.rulesFor(c.name)
+	var events []hookEvent
+	ticket, ticketed := uint64(0), false
+
+	// Defaults come first so hooks see them, computed fields after hooks so
+	// they reflect what hooks changed, and encryption last
+	prepare := func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		visible := docs
+		if filter != nil {
+			visible = filter.visible(docs)
+		}
+		writes, err := fn(visible)
+		if err != nil {
+			return nil, err
+		}
+		rules.applyDefaults(docs, writes)
+		if err := hooks.before(ctx, c.name, docs, writes); err != nil {
+			return nil, err
+		}
+		if err := rules.applyComputed(c.name, writes); err != nil {
+			return nil, err
+		}
+		if filter != nil {
+			if err := filter.checkWrites(c.name, docs, writes); err != nil {
+				return nil, err
+			}
+		}
+		if hooks.hasAfter() {
+			events = hooks.events(c.name, docs, writes)
+			ticket, ticketed = c.db.hooks.ticket(), true
+		}
+		if err := rules.encrypt(writes); err != nil {
+			return nil, err
+		}
+		return writes, nil
+	}
+
+	// References widen the batch to the collections they involve
+	if refs, scope := c.db.referenceScope(c.name); scope == nil {
+		err = c.db.indexes.ApplyBatchContext(ctx, c.name, prepare)
+	} else {
+		err = c.db.indexes.ApplyMultiBatchLookup(ctx, scope, func(docs map[string]map[core.DocumentID]core.Document, lookup index.LookupFunc) (map[string]map[core.DocumentID]core.Document, error) {
+			writes, err := prepare(docs[c.name])
+			if err != nil {
+				return nil, err
+			}
+			return enforceReferences(c.name, refs, docs, writes, lookup)
+		})
+	}
+
+	// A ticket is dispatched even when the write failed, so later ones run
+	if ticketed {
+		if err != nil {
+			events = nil
+		}
+		c.db.hooks.dispatch(ctx, ticket, events)
+	}
+	return err
+}
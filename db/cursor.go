@@ -0,0 +1,73 @@
+package db
+
+import (
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// Cursor iterates over the documents matching a query one at a time. It
+// must be closed when iteration stops early.
+type Cursor struct {
+	cur   *query.Cursor
+	rules fieldRules
+	id    core.DocumentID
+	doc   core.Document
+	err   error
+}
+
+// Iter runs a query like Find but returns a cursor, so results can be
+// consumed as they are found and the query abandoned by closing it. The
+// query's collection is set to this collection.
+func (c *Collection) Iter(q core.Query) (*Cursor, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	rules := c.db.rulesFor(c.name)
+	if err := rules.checkQuery(q); err != nil {
+		return nil, err
+	}
+	q, err := c.secure(q)
+	if err != nil {
+		return nil, err
+	}
+	q.Collection = c.name
+
+	cur, err := c.db.query.ExecuteIter(q)
+	if err != nil {
+		return nil, err
+	}
+	return &Cursor{cur: cur, rules: rules}, nil
+}
+
+// Next advances the cursor, reporting false when there are no more results
+// or an error occurred
+func (c *Cursor) Next() bool {
+	if c.err != nil || !c.cur.Next() {
+		return false
+	}
+	id, doc := c.cur.Doc()
+	if doc, c.err = c.rules.readable(doc); c.err != nil {
+		c.cur.Close()
+		return false
+	}
+	c.id, c.doc = id, doc
+	return true
+}
+
+// Doc returns the current document and its ID
+func (c *Cursor) Doc() (core.DocumentID, core.Document) {
+	return c.id, c.doc
+}
+
+// Err returns the error that ended iteration, if any
+func (c *Cursor) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.cur.Err()
+}
+
+// Close stops iteration
+func (c *Cursor) Close() error {
+	return c.cur.Close()
+}
@@ -0,0 +1,483 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+	"github.com/HakashiKatake/Go-Json-Database/txn"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrCollectionNotFound is returned for a collection that does not exist
+	// when collections are not created automatically
+	ErrCollectionNotFound = errors.New("collection not found")
+	// ErrClosed is returned when using a closed database
+	ErrClosed = errors.New("database closed")
+)
+
+// DB is a database of JSON document collections stored in one directory. It
+// wires together the storage engine, the index manager, the query executor
+// and the transaction manager.
+type DB struct {
+	storage *storage.FileStorageEngine
+	indexes *index.FileIndexManager
+	query   *query.Executor
+	txns    *txn.TransactionManager
+	hooks   *hookRegistry
+	opts    options
+
+	mu          sync.Mutex
+	collections map[string]*Collection
+	closed      bool
+	onClose     []func() // Run by Close, last registered first
+
+	rulesMu sync.RWMutex
+	rules   map[string]fieldRules
+	refs    map[string][]core.Reference // Declared references, by referencing collection
+
+	policiesMu sync.RWMutex
+	policies   map[string]PolicyFunc // Row-level security, by collection
+
+	namespacesMu sync.Mutex
+	namespaces   map[string]*DB // Opened namespaces, by name
+
+	healthMu     sync.Mutex
+	healthChecks []*healthCheck // Added with RegisterHealthCheck
+
+	backupMu   sync.Mutex
+	lastBackup time.Time // Set by RecordBackup
+}
+
+// options holds the settings applied by Option
+type options struct {
+	autoCreate bool
+	indexDir   string
+	ids        core.IDOptions
+	log        Logger
+	tracer     trace.TracerProvider
+	oplog      bool
+	readOnly   bool
+	sortBudget int64
+	storage    []storage.Option
+}
+
+// Option configures Open
+type Option func(*options)
+
+// WithAutoCreate sets whether Collection creates missing collections (the
+// default) or fails with ErrCollectionNotFound
+func WithAutoCreate(enabled bool) Option {
+	return func(o *options) {
+		o.autoCreate = enabled
+	}
+}
+
+// WithIndexDir stores index files in dir instead of the data directory
+func WithIndexDir(dir string) Option {
+	return func(o *options) {
+		o.indexDir = dir
+	}
+}
+
+// WithIDGenerator sets how Collection.Insert generates IDs for documents
+// without one, such as core.NewUUID. The default is core.NewULID, whose IDs
+// sort by creation time.
+func WithIDGenerator(gen core.IDGenerator) Option {
+	return func(o *options) {
+		o.ids.Generator = gen
+	}
+}
+
+// WithIDKey sets the document key Collection.Insert reads and writes IDs
+// under, instead of core.DefaultIDKey
+func WithIDKey(key string) Option {
+	return func(o *options) {
+		o.ids.Key = key
+	}
+}
+
+// WithLogger logs errors reported by after hooks to l
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// WithTracer traces storage reads and writes, queries run through
+// Collection.FindContext and commits through Txn.CommitContext with tracers
+// from tp, each span a child of the span in the context passed in
+func WithTracer(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp
+	}
+}
+
+// WithOplog enables the storage engine's durable operation log, so watchers
+// can resume after the last change they saw
+func WithOplog() Option {
+	return func(o *options) {
+		o.oplog = true
+	}
+}
+
+// WithReadOnly opens the database without writing to its directory, so it
+// can be inspected while another process uses it. Writes fail with
+// storage.ErrReadOnly, indexes are rebuilt in memory when their files are
+// stale, and Close persists nothing. The directory must exist.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// WithIDField makes name the document key IDs are kept under, for inserts
+// as WithIDKey and for the storage engine as storage.WithIDField, so every
+// write, import and export agrees on it. An empty name means
+// core.DefaultIDKey.
+func WithIDField(name string) Option {
+	return func(o *options) {
+		if name == "" {
+			name = core.DefaultIDKey
+		}
+		o.ids.Key = name
+		o.storage = append(o.storage, storage.WithIDField(name))
+	}
+}
+
+// WithSortBudget bounds the memory sorted Collection.Iter queries hold to
+// about bytes, beyond which they sort on disk in temporary files in the data
+// directory, or the system's temporary directory when read-only (see
+// query.Executor.SetSortBudget). Find always sorts in memory.
+func WithSortBudget(bytes int64) Option {
+	return func(o *options) {
+		o.sortBudget = bytes
+	}
+}
+
+// WithStorageOptions configures the storage engine, such as its sync mode.
+// WithReadOnly and WithTracer given to Open take precedence.
+func WithStorageOptions(opts ...storage.Option) Option {
+	return func(o *options) {
+		o.storage = append(o.storage, opts...)
+	}
+}
+
+// Open opens the database in path, creating the directory if needed, and
+// loads the indexes of its existing collections
+func Open(path string, opts ...Option) (*DB, error) {
+	path = filepath.Clean(path)
+	o := options{autoCreate: true, indexDir: path}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	engineOpts := append([]storage.Option(nil), o.storage...)
+	if o.tracer != nil {
+		engineOpts = append(engineOpts, storage.WithTracer(o.tracer))
+	}
+	if o.readOnly {
+		engineOpts = append(engineOpts, storage.WithReadOnly())
+	} else if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	}
+
+	engine, err := storage.NewFileStorageEngine(path, engineOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	if o.oplog {
+		if err := engine.EnableOplog(); err != nil {
+			engine.Close()
+			return nil, err
+		}
+	}
+	return open(engine, o)
+}
+
+// open opens a database on a storage engine, loading the indexes of its
+// existing collections. The engine is closed if opening fails.
+func open(engine *storage.FileStorageEngine, o options) (*DB, error) {
+	indexes, err := index.NewFileIndexManager(engine, o.indexDir)
+	if err != nil {
+		engine.Close()
+		return nil, fmt.Errorf("failed to open indexes: %w", err)
+	}
+
+	d := &DB{
+		storage:     engine,
+		indexes:     indexes,
+		query:       query.NewExecutor(engine, indexes),
+		txns:        txn.NewTransactionManager(engine, indexes),
+		hooks:       newHookRegistry(o.log),
+		opts:        o,
+		collections: make(map[string]*Collection),
+		rules:       make(map[string]fieldRules),
+		refs:        make(map[string][]core.Reference),
+		namespaces:  make(map[string]*DB),
+	}
+	d.query.SetTracerProvider(o.tracer)
+	d.txns.SetTracerProvider(o.tracer)
+	if o.readOnly {
+		d.query.SetSortBudget(o.sortBudget, "")
+	} else {
+		d.query.SetSortBudget(o.sortBudget, engine.Dir())
+	}
+
+	names, err := engine.ListCollections()
+	if err != nil {
+		engine.Close()
+		return nil, err
+	}
+	for _, name := range names {
+		if err := indexes.LoadIndexes(name); err != nil {
+			engine.Close()
+			return nil, fmt.Errorf("failed to load indexes for %s: %w", name, err)
+		}
+		d.collections[name] = d.handle(name)
+		if err := d.loadRules(name); err != nil {
+			engine.Close()
+			return nil, err
+		}
+	}
+	if err := d.loadReferences(); err != nil {
+		engine.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// handle creates the handle of a collection
+func (d *DB) handle(name string) *Collection {
+	return &Collection{
+		name: name,
+		db:   d,
+		coll: &core.Collection{Name: name, Storage: d.storage, Indexes: d.indexes},
+	}
+}
+
+// Collection returns the handle of a collection, creating the collection on
+// first use unless WithAutoCreate(false) was given
+func (d *DB) Collection(name string) (*Collection, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if c, ok := d.collections[name]; ok {
+		return c, nil
+	}
+	if !d.opts.autoCreate {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	return d.create(name)
+}
+
+// CreateCollection creates a collection, returning its handle. Creating a
+// collection that already exists is not an error.
+func (d *DB) CreateCollection(name string) (*Collection, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if c, ok := d.collections[name]; ok {
+		return c, nil
+	}
+	return d.create(name)
+}
+
+// DropCollection deletes a collection with its documents, configuration and
+// indexes, failing with ErrCollectionNotFound if it does not exist and with
+// ErrReferenceViolation while another collection declares references to it.
+// Handles on the collection must not be used afterwards.
+func (d *DB) DropCollection(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	if _, ok := d.collections[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	for from, refs := range d.refs {
+		for _, ref := range refs {
+			if ref.To == name && from != name {
+				return fmt.Errorf("failed to drop collection %s: %w: referenced by %s.%s", name, ErrReferenceViolation, from, ref.Field)
+			}
+		}
+	}
+
+	if err := d.storage.DropCollection(name); err != nil {
+		return err
+	}
+	delete(d.collections, name)
+	delete(d.rules, name)
+	delete(d.refs, name)
+	if err := d.indexes.DropIndexes(name); err != nil {
+		return fmt.Errorf("failed to drop indexes of %s: %w", name, err)
+	}
+	return nil
+}
+
+// create creates a collection and loads its indexes. Callers must hold d.mu.
+func (d *DB) create(name string) (*Collection, error) {
+	if err := d.storage.CreateCollection(name); err != nil {
+		return nil, fmt.Errorf("failed to create collection %s: %w", name, err)
+	}
+	if err := d.indexes.LoadIndexes(name); err != nil {
+		return nil, fmt.Errorf("failed to load indexes for %s: %w", name, err)
+	}
+
+	c := d.handle(name)
+	d.collections[name] = c
+	return c, nil
+}
+
+// Collections returns the names of the database's collections
+func (d *DB) Collections() ([]string, error) {
+	return d.storage.ListCollections()
+}
+
+// SetSchema sets the JSON Schema every write to a collection must satisfy.
+// Writes that break it fail with a *schema.ValidationError. An empty schema
+// removes it.
+func (d *DB) SetSchema(collection string, data []byte, mode schema.Mode) error {
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	return d.storage.SetSchema(collection, data, mode)
+}
+
+// ValidateCollection checks a collection's documents against its schema,
+// returning a ValidationError for each invalid one
+func (d *DB) ValidateCollection(collection string) ([]*schema.ValidationError, error) {
+	if _, err := d.Collection(collection); err != nil {
+		return nil, err
+	}
+	return d.storage.ValidateCollection(collection)
+}
+
+// Begin starts a transaction across the database's collections. Its writes
+// do not run hooks or apply defaults and computed fields.
+func (d *DB) Begin(opts ...txn.Option) *txn.Txn {
+	return d.txns.Begin(opts...)
+}
+
+// Storage returns the storage engine, for inspecting collection files
+func (d *DB) Storage() *storage.FileStorageEngine {
+	return d.storage
+}
+
+// Indexes returns the index manager, for creating and inspecting indexes
+func (d *DB) Indexes() *index.FileIndexManager {
+	return d.indexes
+}
+
+// Executor returns the query executor, for queries beyond the Collection helpers
+func (d *DB) Executor() *query.Executor {
+	return d.query
+}
+
+// check returns ErrClosed once the database is closed
+func (d *DB) check() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	return nil
+}
+
+// OnClose registers fn to be run when the database is closed, before
+// anything is closed, so background work such as scheduled backups can
+// stop while the database is still usable. Functions run last registered
+// first.
+func (d *DB) OnClose(fn func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.onClose = append(d.onClose, fn)
+}
+
+// Flush writes the coalesced writes of a database opened with
+// storage.WithWriteCoalescing to disk; see FileStorageEngine.Flush
+func (d *DB) Flush() error {
+	if err := d.check(); err != nil {
+		return err
+	}
+	return d.storage.Flush()
+}
+
+// Close runs the OnClose functions, persists the indexes of every
+// collection unless the database is read-only, closes the opened
+// namespaces and closes the storage engine. Closing twice is a no-op.
+func (d *DB) Close() error {
+	// The OnClose functions may still use the database, so they run
+	// without d.mu held
+	d.mu.Lock()
+	onClose := d.onClose
+	d.onClose = nil
+	d.mu.Unlock()
+	for i := len(onClose) - 1; i >= 0; i-- {
+		onClose[i]()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+
+	errs := []error{d.closeNamespaces()}
+	if !d.opts.readOnly {
+		for name := range d.collections {
+			if err := d.indexes.PersistIndexes(name); err != nil {
+				errs = append(errs, fmt.Errorf("failed to persist indexes for %s: %w", name, err))
+			}
+		}
+	}
+	if err := d.storage.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to close storage: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// validateName rejects collection names that are empty or not a plain file name
+func validateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid collection name %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// encryptedKey is the key of the object wrapping an encrypted value
+const encryptedKey = "$enc"
+
+var (
+	// ErrEncryptedField is returned for a query that filters or sorts on an
+	// encrypted field, which would compare ciphertexts
+	ErrEncryptedField = errors.New("field is encrypted")
+	// ErrEncryptionKey is returned when writing a plaintext value to an
+	// encrypted field without the collection's key, or when a value cannot
+	// be decrypted with it
+	ErrEncryptionKey = errors.New("encryption key missing or wrong")
+)
+
+// fieldCipher encrypts and decrypts the encrypted fields of a collection
+type fieldCipher struct {
+	fields []string
+	aead   cipher.AEAD // nil when the key was not given
+}
+
+// EncryptFields makes a collection store the values at the given dotted
+// field paths encrypted with AES-GCM under key, which must be 16, 24 or 32
+// bytes long. An encrypted value is stored as {"$enc": "<base64>"} and
+// decrypted by Get and Find. Paths descend through nested objects only.
+//
+// The field list is stored with the collection but the key never is, so
+// after Open the same call supplies the key again. Until then reads return
+// the wrapped values and writing plaintext to an encrypted field fails with
+// ErrEncryptionKey. Encryption is randomized, so queries cannot filter or
+// sort on encrypted fields and fail with ErrEncryptedField. Documents
+// written before the call stay plaintext until rewritten or until
+// ReencryptCollection runs. The collection's schema sees the wrapped values.
+// An empty field list, with any key, stops encrypting new writes.
+func (d *DB) EncryptFields(collection string, fields []string, key []byte) error {
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("missing field - unable to encrypt fields of %s", collection)
+		}
+	}
+	var aead cipher.AEAD
+	if len(fields) > 0 {
+		var err error
+		if aead, err = newAEAD(key); err != nil {
+			return err
+		}
+	}
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	if err := d.storage.SetEncryptedFields(collection, fields); err != nil {
+		return fmt.Errorf("failed to set encrypted fields of %s: %w", collection, err)
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	rules := d.rules[collection]
+	rules.cipher = nil
+	if len(fields) > 0 {
+		rules.cipher = &fieldCipher{fields: append([]string(nil), fields...), aead: aead}
+	}
+	d.rules[collection] = rules
+	return nil
+}
+
+// ReencryptCollection rotates the key of a collection's encrypted fields in
+// one atomic batch: values encrypted under oldKey are encrypted again under
+// newKey, and plaintext values are encrypted for the first time, so oldKey
+// may be nil when no value is encrypted yet. Later writes use newKey.
+func (d *DB) ReencryptCollection(collection string, oldKey, newKey []byte) error {
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	current := d.rulesFor(collection).cipher
+	if current == nil {
+		return fmt.Errorf("collection %s has no encrypted fields", collection)
+	}
+
+	var err error
+	from := &fieldCipher{fields: current.fields}
+	if oldKey != nil {
+		if from.aead, err = newAEAD(oldKey); err != nil {
+			return err
+		}
+	}
+	to := &fieldCipher{fields: current.fields}
+	if to.aead, err = newAEAD(newKey); err != nil {
+		return err
+	}
+
+	if err := d.check(); err != nil {
+		return err
+	}
+	err = d.indexes.ApplyBatch(collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document, len(docs))
+		for docID, doc := range docs {
+			plain := doc.Clone()
+			if err := from.decrypt(plain); err != nil {
+				return nil, fmt.Errorf("failed to decrypt %s/%s: %w", collection, docID, err)
+			}
+			if err := to.encrypt(plain); err != nil {
+				return nil, err
+			}
+			writes[docID] = plain
+		}
+		return writes, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt %s: %w", collection, err)
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	rules := d.rules[collection]
+	rules.cipher = to
+	d.rules[collection] = rules
+	return nil
+}
+
+// newAEAD creates the AES-GCM cipher for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt replaces the plaintext values of the encrypted fields of doc with
+// wrapped ciphertexts. Values already wrapped are kept.
+func (f *fieldCipher) encrypt(doc core.Document) error {
+	for _, field := range f.fields {
+		parent, name, ok := fieldParent(doc, field)
+		if !ok {
+			continue
+		}
+		value := parent[name]
+		if _, wrapped := unwrap(value); wrapped {
+			continue
+		}
+		if f.aead == nil {
+			return fmt.Errorf("failed to encrypt %s: %w", field, ErrEncryptionKey)
+		}
+
+		plaintext, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s for encryption: %w", field, err)
+		}
+		nonce := make([]byte, f.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("failed to generate nonce: %w", err)
+		}
+		sealed := f.aead.Seal(nonce, nonce, plaintext, []byte(field))
+		parent[name] = map[string]interface{}{encryptedKey: base64.StdEncoding.EncodeToString(sealed)}
+	}
+	return nil
+}
+
+// decrypt replaces the wrapped values of the encrypted fields of doc with
+// their plaintexts
+func (f *fieldCipher) decrypt(doc core.Document) error {
+	for _, field := range f.fields {
+		parent, name, ok := fieldParent(doc, field)
+		if !ok {
+			continue
+		}
+		encoded, wrapped := unwrap(parent[name])
+		if !wrapped {
+			continue
+		}
+		if f.aead == nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field, ErrEncryptionKey)
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < f.aead.NonceSize() {
+			return fmt.Errorf("failed to decrypt %s: malformed ciphertext", field)
+		}
+		nonce, ciphertext := sealed[:f.aead.NonceSize()], sealed[f.aead.NonceSize():]
+		plaintext, err := f.aead.Open(nil, nonce, ciphertext, []byte(field))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", field, ErrEncryptionKey)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(plaintext, &value); err != nil {
+			return fmt.Errorf("failed to decode decrypted %s: %w", field, err)
+		}
+		parent[name] = value
+	}
+	return nil
+}
+
+// checkQuery rejects a query that filters or sorts on an encrypted field
+func (f *fieldCipher) checkQuery(q core.Query) error {
+	fields := make([]string, 0, len(q.Filters)+len(q.SortBy)+1)
+	for _, filter := range q.Filters {
+		fields = append(fields, filter.Field)
+	}
+	if q.Where != nil {
+		fields = appendTreeFields(fields, *q.Where)
+	}
+	if q.Sort != nil {
+		fields = append(fields, q.Sort.Field)
+	}
+	for _, sort := range q.SortBy {
+		fields = append(fields, sort.Field)
+	}
+
+	for _, field := range fields {
+		for _, encrypted := range f.fields {
+			if field == encrypted || strings.HasPrefix(field, encrypted+".") {
+				return fmt.Errorf("cannot query %s: %w", field, ErrEncryptedField)
+			}
+		}
+	}
+	return nil
+}
+
+// appendTreeFields appends the fields a filter tree tests
+func appendTreeFields(fields []string, node core.FilterNode) []string {
+	if node.Filter != nil {
+		fields = append(fields, node.Filter.Field)
+	}
+	for _, child := range node.Children {
+		fields = appendTreeFields(fields, child)
+	}
+	return fields
+}
+
+// unwrap returns the ciphertext of a wrapped value
+func unwrap(value interface{}) (string, bool) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		if doc, isDoc := value.(core.Document); isDoc {
+			obj, ok = doc, true
+		}
+	}
+	if !ok || len(obj) != 1 {
+		return "", false
+	}
+	encoded, ok := obj[encryptedKey].(string)
+	return encoded, ok
+}
+
+// fieldParent returns the object holding the value at a dotted path and the
+// value's key, if the path leads through objects to an existing value
+func fieldParent(doc core.Document, path string) (map[string]interface{}, string, bool) {
+	segments := core.SplitPath(path)
+	parent := map[string]interface{}(doc)
+	for _, segment := range segments[:len(segments)-1] {
+		switch next := parent[segment].(type) {
+		case map[string]interface{}:
+			parent = next
+		case core.Document:
+			parent = next
+		default:
+			return nil, "", false
+		}
+	}
+
+	name := segments[len(segments)-1]
+	if _, ok := parent[name]; !ok {
+		return nil, "", false
+	}
+	return parent, name, true
+}
+
+// readable decrypts the encrypted fields of a document read from a
+// collection, if the collection's key is known
+func (r fieldRules) readable(doc core.Document) (core.Document, error) {
+	if r.cipher == nil || r.cipher.aead == nil {
+		return doc, nil
+	}
+	if err := r.cipher.decrypt(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// encrypt encrypts the encrypted fields of the documents a batch writes
+func (r fieldRules) encrypt(writes map[core.DocumentID]core.Document) error {
+	if r.cipher == nil {
+		return nil
+	}
+	for docID, doc := range writes {
+		if doc == nil {
+			continue
+		}
+		if err := r.cipher.encrypt(doc); err != nil {
+			return fmt.Errorf("failed to write %s: %w", docID, err)
+		}
+	}
+	return nil
+}
+
+// checkQuery rejects a query on the encrypted fields of a collection
+func (r fieldRules) checkQuery(q core.Query) error {
+	if r.cipher == nil {
+		return nil
+	}
+	return r.cipher.checkQuery(q)
+}
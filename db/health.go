@@ -0,0 +1,214 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// defaultHealthSample is how many collections Health checks unless
+	// HealthFull or HealthSample is given
+	defaultHealthSample = 16
+
+	// defaultMinFreeSpace is the free space below which Health reports the
+	// disk as failing unless HealthMinFreeSpace is given
+	defaultMinFreeSpace = 64 << 20
+)
+
+// HealthStatus is the outcome of a health check, or of all of them
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthFailed   HealthStatus = "failed"
+	HealthSkipped  HealthStatus = "skipped"  // The check does not apply, such as writability of a read-only database
+	HealthDegraded HealthStatus = "degraded" // A report with a failed check
+)
+
+// HealthCheck is the outcome of one check
+type HealthCheck struct {
+	Name    string        `json:"name"`
+	Status  HealthStatus  `json:"status"`
+	Latency time.Duration `json:"latency_ns"`
+	Detail  string        `json:"detail,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// HealthReport is the result of Health. Status is HealthOK unless a check
+// failed, which makes it HealthDegraded.
+type HealthReport struct {
+	Status    HealthStatus  `json:"status"`
+	CheckedAt time.Time     `json:"checked_at"`
+	Latency   time.Duration `json:"latency_ns"`
+	Checks    []HealthCheck `json:"checks"`
+}
+
+// healthOptions holds the settings applied by HealthOption
+type healthOptions struct {
+	full         bool
+	sample       int
+	minFreeSpace uint64
+}
+
+// HealthOption configures Health
+type HealthOption func(*healthOptions)
+
+// HealthFull checks every collection and index file instead of a sample
+func HealthFull() HealthOption {
+	return func(o *healthOptions) {
+		o.full = true
+	}
+}
+
+// HealthSample sets how many collections, picked at random, have their
+// files checked (default 16)
+func HealthSample(n int) HealthOption {
+	return func(o *healthOptions) {
+		o.sample = n
+	}
+}
+
+// HealthMinFreeSpace sets the free space in bytes below which the disk
+// check fails (default 64 MiB)
+func HealthMinFreeSpace(bytes uint64) HealthOption {
+	return func(o *healthOptions) {
+		o.minFreeSpace = bytes
+	}
+}
+
+// healthCheck is a check registered with RegisterHealthCheck
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// RegisterHealthCheck adds a check run by every Health call, such as the
+// liveness of a background task. A check fails by returning an error. The
+// returned function removes the check, for tasks that stop; calling it
+// again does nothing.
+func (d *DB) RegisterHealthCheck(name string, check func(ctx context.Context) error) (unregister func()) {
+	c := &healthCheck{name, check}
+	d.healthMu.Lock()
+	defer d.healthMu.Unlock()
+	d.healthChecks = append(d.healthChecks, c)
+	return func() {
+		d.healthMu.Lock()
+		defer d.healthMu.Unlock()
+		d.healthChecks = slices.DeleteFunc(d.healthChecks, func(registered *healthCheck) bool {
+			return registered == c
+		})
+	}
+}
+
+// Health checks that the database works rather than merely that it is
+// open: that the data directory accepts writes, that collection and index
+// files parse, that the disk has free space, and the checks added with
+// RegisterHealthCheck. Collection and index files are sampled unless
+// HealthFull is given. A failed check degrades the report rather than
+// returning an error; Health fails only once the database is closed or
+// ctx is done.
+func (d *DB) Health(ctx context.Context, opts ...HealthOption) (HealthReport, error) {
+	o := healthOptions{sample: defaultHealthSample, minFreeSpace: defaultMinFreeSpace}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := d.check(); err != nil {
+		return HealthReport{}, err
+	}
+
+	start := time.Now()
+	report := HealthReport{Status: HealthOK, CheckedAt: start.UTC()}
+	run := func(name string, fn func() (string, error)) {
+		checkStart := time.Now()
+		detail, err := fn()
+		check := HealthCheck{Name: name, Status: HealthOK, Latency: time.Since(checkStart), Detail: detail}
+		switch {
+		case errors.Is(err, errHealthSkipped):
+			check.Status = HealthSkipped
+		case err != nil:
+			check.Status = HealthFailed
+			check.Error = err.Error()
+			report.Status = HealthDegraded
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	run("data_dir_writable", func() (string, error) {
+		if d.opts.readOnly {
+			return "read-only", errHealthSkipped
+		}
+		return "", d.storage.ProbeWritable()
+	})
+
+	names, err := d.storage.ListCollections()
+	if err != nil {
+		run("collections", func() (string, error) { return "", err })
+	} else {
+		names = sampleNames(names, o)
+		run("collections", func() (string, error) {
+			return fmt.Sprintf("%d checked", len(names)), d.checkEach(ctx, names, d.storage.CheckCollection)
+		})
+		run("indexes", func() (string, error) {
+			return fmt.Sprintf("%d checked", len(names)), d.checkEach(ctx, names, d.indexes.CheckIndexFile)
+		})
+	}
+
+	run("disk_space", func() (string, error) {
+		free, err := d.storage.FreeSpace()
+		if err != nil {
+			return "", err
+		}
+		detail := fmt.Sprintf("%d bytes free", free)
+		if free < o.minFreeSpace {
+			return detail, fmt.Errorf("free space below %d bytes", o.minFreeSpace)
+		}
+		return detail, nil
+	})
+
+	d.healthMu.Lock()
+	checks := append([]*healthCheck(nil), d.healthChecks...)
+	d.healthMu.Unlock()
+	for _, c := range checks {
+		run(c.name, func() (string, error) { return "", c.check(ctx) })
+	}
+
+	if err := ctx.Err(); err != nil {
+		return HealthReport{}, err
+	}
+	report.Latency = time.Since(start)
+	return report, nil
+}
+
+// errHealthSkipped is returned by a check that does not apply
+var errHealthSkipped = errors.New("health check skipped")
+
+// checkEach runs a check on each collection until ctx is done, joining the
+// failures
+func (d *DB) checkEach(ctx context.Context, names []string, check func(string) error) error {
+	var errs []error
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := check(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sampleNames returns the collections to check: all of them in full mode,
+// otherwise up to the sample size picked at random, sorted
+func sampleNames(names []string, o healthOptions) []string {
+	if !o.full && o.sample < len(names) {
+		rand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+		names = names[:max(o.sample, 0)]
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// GetAsOf returns a document as it was at t, reconstructed from the oplog,
+// failing with core.ErrDocumentNotFound if it did not exist then. The
+// database must be opened WithOplog; moments before the oldest oplog entry
+// fail with storage.ErrHistoryUnavailable.
+func (c *Collection) GetAsOf(id core.DocumentID, t time.Time) (core.Document, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	doc, err := c.db.storage.ReadDocumentAsOf(c.name, id, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkVisible(id, doc); err != nil {
+		return nil, err
+	}
+	return c.db.rulesFor(c.name).readable(doc)
+}
+
+// FindAsOf runs a query against the collection as it was at t, as GetAsOf
+// reads it. Indexes describe the present, so the query scans.
+func (c *Collection) FindAsOf(q core.Query, t time.Time) ([]core.Document, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	rules := c.db.rulesFor(c.name)
+	if err := rules.checkQuery(q); err != nil {
+		return nil, err
+	}
+	q, err := c.secure(q)
+	if err != nil {
+		return nil, err
+	}
+	q.Collection = c.name
+	docs, err := query.NewExecutor(c.db.storage.AsOf(t), nil).ExecuteContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if docs[i], err = rules.readable(doc); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
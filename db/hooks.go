@@ -0,0 +1,305 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrHookPanic is wrapped by the error reported for a hook that panicked
+var ErrHookPanic = errors.New("hook panicked")
+
+// maxHookErrors bounds the after-hook errors kept for HookErrors
+const maxHookErrors = 100
+
+// BeforeWriteHook runs before a document is inserted or updated. It may
+// modify doc, or return a replacement; returning nil keeps doc. Returning an
+// error aborts the write.
+type BeforeWriteHook func(ctx context.Context, docID core.DocumentID, doc core.Document) (core.Document, error)
+
+// BeforeDeleteHook runs before a document is deleted, with its current
+// contents. Returning an error aborts the delete.
+type BeforeDeleteHook func(ctx context.Context, docID core.DocumentID, doc core.Document) error
+
+// AfterWriteHook runs after a document was inserted or updated, with the
+// document as stored
+type AfterWriteHook func(ctx context.Context, docID core.DocumentID, doc core.Document) error
+
+// AfterDeleteHook runs after a document was deleted, with its last contents
+type AfterDeleteHook func(ctx context.Context, docID core.DocumentID, doc core.Document) error
+
+// collectionHooks are the hooks registered for one collection
+type collectionHooks struct {
+	beforeWrite  []BeforeWriteHook
+	beforeDelete []BeforeDeleteHook
+	afterWrite   []AfterWriteHook
+	afterDelete  []AfterDeleteHook
+}
+
+// hookEvent is a committed change waiting for its after hooks
+type hookEvent struct {
+	collection string
+	docID      core.DocumentID
+	doc        core.Document
+	deleted    bool
+	hooks      collectionHooks
+}
+
+// hookRegistry holds the hooks of a DB and dispatches after hooks in commit
+// order. Each write that may fire after hooks takes a ticket while it holds
+// the write lock; whichever writer finds the next ticket ready runs the
+// queued events, so a hook that itself writes queues its events instead of
+// waiting on its caller.
+type hookRegistry struct {
+	mu           sync.RWMutex
+	byCollection map[string]*collectionHooks
+
+	dispatchMu  sync.Mutex
+	next        uint64 // Next ticket to hand out
+	due         uint64 // Next ticket to dispatch
+	pending     map[uint64][]hookEvent
+	dispatching bool
+
+	errMu sync.Mutex
+	errs  []error
+	log   Logger
+}
+
+// newHookRegistry creates an empty registry that logs after-hook errors to
+// log, if set
+func newHookRegistry(log Logger) *hookRegistry {
+	return &hookRegistry{
+		byCollection: make(map[string]*collectionHooks),
+		pending:      make(map[uint64][]hookEvent),
+		log:          log,
+	}
+}
+
+// OnBeforeWrite registers a hook run before every insert or update of a
+// collection's documents made through a Collection handle. Hooks run in
+// registration order while the collection is locked, each seeing the
+// previous one's document, so they must not use the DB themselves.
+func (d *DB) OnBeforeWrite(collection string, hook BeforeWriteHook) {
+	d.hooks.register(collection, func(h *collectionHooks) { h.beforeWrite = append(h.beforeWrite, hook) })
+}
+
+// OnBeforeDelete registers a hook run before every delete of a collection's
+// documents made through a Collection handle, under the same rules as
+// OnBeforeWrite
+func (d *DB) OnBeforeDelete(collection string, hook BeforeDeleteHook) {
+	d.hooks.register(collection, func(h *collectionHooks) { h.beforeDelete = append(h.beforeDelete, hook) })
+}
+
+// OnAfterWrite registers a hook run after every committed insert or update
+// of a collection's documents made through a Collection handle. After hooks
+// run outside the write lock, in commit order across the DB and in
+// registration order per change, and may write to the DB. Their errors do
+// not undo the write; they are logged and kept for HookErrors.
+func (d *DB) OnAfterWrite(collection string, hook AfterWriteHook) {
+	d.hooks.register(collection, func(h *collectionHooks) { h.afterWrite = append(h.afterWrite, hook) })
+}
+
+// OnAfterDelete registers a hook run after every committed delete of a
+// collection's documents made through a Collection handle, under the same
+// rules as OnAfterWrite
+func (d *DB) OnAfterDelete(collection string, hook AfterDeleteHook) {
+	d.hooks.register(collection, func(h *collectionHooks) { h.afterDelete = append(h.afterDelete, hook) })
+}
+
+// HookErrors returns the errors after hooks reported since the last call,
+// oldest first, keeping at most the latest 100
+func (d *DB) HookErrors() []error {
+	d.hooks.errMu.Lock()
+	defer d.hooks.errMu.Unlock()
+
+	errs := d.hooks.errs
+	d.hooks.errs = nil
+	return errs
+}
+
+// register updates the hooks of a collection
+func (r *hookRegistry) register(collection string, add func(*collectionHooks)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.byCollection[collection]
+	if !ok {
+		h = &collectionHooks{}
+		r.byCollection[collection] = h
+	}
+	add(h)
+}
+
+// forCollection returns a copy of a collection's hooks
+func (r *hookRegistry) forCollection(collection string) collectionHooks {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if h, ok := r.byCollection[collection]; ok {
+		return *h
+	}
+	return collectionHooks{}
+}
+
+// hasAfter reports whether any after hooks are registered
+func (h collectionHooks) hasAfter() bool {
+	return len(h.afterWrite) > 0 || len(h.afterDelete) > 0
+}
+
+// before runs the before hooks on a batch's writes in ID order, updating
+// the writes in place. docs holds the documents before the batch.
+func (h collectionHooks) before(ctx context.Context, collection string, docs, writes map[core.DocumentID]core.Document) error {
+	for _, docID := range sortedIDs(writes) {
+		doc := writes[docID]
+		if doc == nil {
+			existing, exists := docs[docID]
+			if !exists {
+				continue
+			}
+			for _, hook := range h.beforeDelete {
+				err := callHook(collection, docID, "before-delete", func() error {
+					return hook(ctx, docID, existing.Clone())
+				})
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		for _, hook := range h.beforeWrite {
+			err := callHook(collection, docID, "before-write", func() error {
+				replaced, err := hook(ctx, docID, doc)
+				if replaced != nil {
+					doc = replaced
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		writes[docID] = doc
+	}
+	return nil
+}
+
+// events returns the after-hook events of a batch's final writes in ID order
+func (h collectionHooks) events(collection string, docs, writes map[core.DocumentID]core.Document) []hookEvent {
+	var events []hookEvent
+	for _, docID := range sortedIDs(writes) {
+		doc := writes[docID]
+		if doc == nil {
+			if existing, exists := docs[docID]; exists {
+				events = append(events, hookEvent{collection: collection, docID: docID, doc: existing, deleted: true, hooks: h})
+			}
+			continue
+		}
+		events = append(events, hookEvent{collection: collection, docID: docID, doc: doc.Clone(), hooks: h})
+	}
+	return events
+}
+
+// sortedIDs returns the IDs of a batch's writes in order
+func sortedIDs(writes map[core.DocumentID]core.Document) []core.DocumentID {
+	ids := make([]core.DocumentID, 0, len(writes))
+	for docID := range writes {
+		ids = append(ids, docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// ticket hands out the next dispatch position. Callers must hold the write
+// lock, so tickets follow commit order.
+func (r *hookRegistry) ticket() uint64 {
+	r.dispatchMu.Lock()
+	defer r.dispatchMu.Unlock()
+
+	t := r.next
+	r.next++
+	return t
+}
+
+// dispatch queues a ticket's events, which are empty for a failed write,
+// and runs every ready ticket's after hooks unless another caller already is
+func (r *hookRegistry) dispatch(ctx context.Context, ticket uint64, events []hookEvent) {
+	r.dispatchMu.Lock()
+	r.pending[ticket] = events
+	if r.dispatching {
+		r.dispatchMu.Unlock()
+		return
+	}
+	r.dispatching = true
+
+	for {
+		ready, ok := r.pending[r.due]
+		if !ok {
+			break
+		}
+		delete(r.pending, r.due)
+		r.due++
+
+		r.dispatchMu.Unlock()
+		for _, event := range ready {
+			r.after(ctx, event)
+		}
+		r.dispatchMu.Lock()
+	}
+
+	r.dispatching = false
+	r.dispatchMu.Unlock()
+}
+
+// after runs the after hooks of one event, reporting their errors
+func (r *hookRegistry) after(ctx context.Context, event hookEvent) {
+	if event.deleted {
+		for _, hook := range event.hooks.afterDelete {
+			r.report(callHook(event.collection, event.docID, "after-delete", func() error {
+				return hook(ctx, event.docID, event.doc.Clone())
+			}))
+		}
+		return
+	}
+	for _, hook := range event.hooks.afterWrite {
+		r.report(callHook(event.collection, event.docID, "after-write", func() error {
+			return hook(ctx, event.docID, event.doc.Clone())
+		}))
+	}
+}
+
+// report logs and keeps an after-hook error
+func (r *hookRegistry) report(err error) {
+	if err == nil {
+		return
+	}
+	if r.log != nil {
+		r.log.Error("%v", err)
+	}
+
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+
+	r.errs = append(r.errs, err)
+	if len(r.errs) > maxHookErrors {
+		r.errs = r.errs[len(r.errs)-maxHookErrors:]
+	}
+}
+
+// callHook runs a hook, turning a panic into an error wrapping ErrHookPanic
+func callHook(collection string, docID core.DocumentID, phase string, run func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%s hook for %s/%s: %w: %v", phase, collection, docID, ErrHookPanic, p)
+		}
+	}()
+
+	if err := run(); err != nil {
+		return fmt.Errorf("%s hook for %s/%s: %w", phase, collection, docID, err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrNotNumeric is returned by IncrementField for a field that holds a value
+// other than a number, or a path through a value that is not an object
+var ErrNotNumeric = errors.New("field is not numeric")
+
+// IncrementField adds delta to a numeric field of a document and returns
+// the field's new value. The read, the addition and the write happen under
+// the collection's write lock, so concurrent increments are never lost. The
+// field is a dotted path; a field that is missing, with any objects above
+// it, is created at zero, and one holding anything but a number fails with
+// ErrNotNumeric. Encrypted fields fail with ErrEncryptedField. A collection
+// with a security policy fails with ErrNoPrincipal; use Scope.IncrementField.
+func (d *DB) IncrementField(collection string, docID core.DocumentID, field string, delta float64) (float64, error) {
+	values, err := d.IncrementFields(collection, docID, map[string]float64{field: delta})
+	if err != nil {
+		return 0, err
+	}
+	return values[field], nil
+}
+
+// DecrementField subtracts delta from a numeric field of a document, like
+// IncrementField with -delta
+func (d *DB) DecrementField(collection string, docID core.DocumentID, field string, delta float64) (float64, error) {
+	return d.IncrementField(collection, docID, field, -delta)
+}
+
+// IncrementFields adds the deltas to the fields of a document they are
+// keyed by, in one write, and returns the new values by field. The fields
+// follow the rules of IncrementField, and if any of them fails none is
+// changed.
+func (d *DB) IncrementFields(collection string, docID core.DocumentID, deltas map[string]float64) (map[string]float64, error) {
+	c, err := d.Collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return c.incrementFields(docID, deltas)
+}
+
+// IncrementField is DB.IncrementField on behalf of the scope's principal,
+// which sees only the documents the collection's security policy lets it
+func (s *Scope) IncrementField(collection string, docID core.DocumentID, field string, delta float64) (float64, error) {
+	values, err := s.IncrementFields(collection, docID, map[string]float64{field: delta})
+	if err != nil {
+		return 0, err
+	}
+	return values[field], nil
+}
+
+// DecrementField is DB.DecrementField on behalf of the scope's principal
+func (s *Scope) DecrementField(collection string, docID core.DocumentID, field string, delta float64) (float64, error) {
+	return s.IncrementField(collection, docID, field, -delta)
+}
+
+// IncrementFields is DB.IncrementFields on behalf of the scope's principal
+func (s *Scope) IncrementFields(collection string, docID core.DocumentID, deltas map[string]float64) (map[string]float64, error) {
+	c, err := s.Collection(collection)
+	if err != nil {
+		return nil, err
+	}
+	return c.incrementFields(docID, deltas)
+}
+
+// incrementFields adds the deltas to the fields of a document through the
+// handle, as IncrementFields does
+func (c *Collection) incrementFields(docID core.DocumentID, deltas map[string]float64) (map[string]float64, error) {
+	collection := c.name
+	if docID == "" || len(deltas) == 0 {
+		return nil, fmt.Errorf("missing ID or fields - unable to increment %s", collection)
+	}
+
+	fields := make([]string, 0, len(deltas))
+	for field := range deltas {
+		if field == "" {
+			return nil, fmt.Errorf("missing field - unable to increment %s/%s", collection, docID)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	rules := c.db.rulesFor(collection)
+	for _, field := range fields {
+		if err := rules.checkQuery(core.Query{Filters: []core.Filter{{Field: field}}}); err != nil {
+			return nil, fmt.Errorf("failed to increment %s/%s: %w", collection, docID, err)
+		}
+	}
+
+	values := make(map[string]float64, len(fields))
+	err := c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		existing, exists := docs[docID]
+		if !exists {
+			return nil, fmt.Errorf("failed to increment %s/%s: %w", collection, docID, core.ErrDocumentNotFound)
+		}
+		doc := existing.Clone()
+		for _, field := range fields {
+			value, err := incrementPath(doc, field, deltas[field])
+			if err != nil {
+				return nil, fmt.Errorf("failed to increment %s/%s: %w", collection, docID, err)
+			}
+			values[field] = value
+		}
+		return map[core.DocumentID]core.Document{docID: doc}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// incrementPath adds delta to the number at a dotted path of doc, creating
+// the objects on the way and the number at zero if they are missing
+func incrementPath(doc core.Document, path string, delta float64) (float64, error) {
+	parent, name, err := fieldSlot(doc, path)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrNotNumeric, err)
+	}
+
+	var current float64
+	if value, exists := parent[name]; exists {
+		number, ok := core.ToFloat64(value)
+		switch {
+		case value == nil:
+			return 0, fmt.Errorf("%w: %s is null", ErrNotNumeric, path)
+		case !ok:
+			return 0, fmt.Errorf("%w: %s holds a %T", ErrNotNumeric, path, value)
+		}
+		current = number
+	}
+	parent[name] = current + delta
+	return current + delta, nil
+}
+
+// fieldSlot returns the object that holds, or is to hold, the value at a
+// dotted path of doc and the value's key, creating the objects on the way
+// that are missing. A path through a value that is not an object fails.
+func fieldSlot(doc core.Document, path string) (map[string]interface{}, string, error) {
+	segments := core.SplitPath(path)
+	parent := map[string]interface{}(doc)
+	for _, segment := range segments[:len(segments)-1] {
+		switch next := parent[segment].(type) {
+		case map[string]interface{}:
+			parent = next
+		case core.Document:
+			parent = next
+		case nil:
+			if _, exists := parent[segment]; exists {
+				return nil, "", fmt.Errorf("%s passes through null", path)
+			}
+			created := make(map[string]interface{})
+			parent[segment] = created
+			parent = created
+		default:
+			return nil, "", fmt.Errorf("%s passes through a %T", path, next)
+		}
+	}
+	return parent, segments[len(segments)-1], nil
+}
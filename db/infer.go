@@ -0,0 +1,61 @@
+package db
+
+import (
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// InferSchema reports the structure of a collection's documents: for each
+// field path the types found, how many documents hold it, examples, the
+// range of its numbers and the formats of its strings. It reads every
+// document, or a uniform sample of sampleSize of them if sampleSize is
+// positive, as Find returns them, and fails with ErrCollectionNotFound if
+// the collection does not exist. It sees every document, whatever the
+// collection's security policy. The report's Draft is a starting point for
+// SetSchema.
+func (d *DB) InferSchema(collection string, sampleSize int) (schema.Report, error) {
+	d.mu.Lock()
+	c, ok := d.collections[collection]
+	closed := d.closed
+	d.mu.Unlock()
+	if closed {
+		return schema.Report{}, ErrClosed
+	}
+	if !ok {
+		return schema.Report{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+	}
+
+	cur, err := c.as(SystemPrincipal).Iter(core.Query{})
+	if err != nil {
+		return schema.Report{}, err
+	}
+	defer cur.Close()
+
+	in := schema.NewInferrer(0)
+	var sample []core.Document // Reservoir of sampleSize documents
+	total := 0
+	for cur.Next() {
+		_, doc := cur.Doc()
+		total++
+		switch {
+		case sampleSize <= 0:
+			in.Add(doc)
+		case len(sample) < sampleSize:
+			sample = append(sample, doc)
+		default:
+			if j := rand.IntN(total); j < sampleSize {
+				sample[j] = doc
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return schema.Report{}, fmt.Errorf("failed to infer schema of %s: %w", collection, err)
+	}
+	for _, doc := range sample {
+		in.Add(doc)
+	}
+	return in.Report(collection, total), nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// Info is a snapshot of a database for support and dashboards, as returned
+// by DB.Info. Its JSON fields are stable: new ones may be added, existing
+// ones keep their name and meaning.
+type Info struct {
+	Dir      string        `json:"dir"`
+	ReadOnly bool          `json:"read_only"`
+	OpenedAt time.Time     `json:"opened_at"`
+	Uptime   time.Duration `json:"uptime_ns"`
+
+	Collections []CollectionInfo `json:"collections"` // Ordered by name
+	Documents   int              `json:"documents"`   // Across all collections
+	DataBytes   int64            `json:"data_bytes"`  // Collection files across all collections
+	IndexBytes  int64            `json:"index_bytes"` // Estimated in-memory size of the secondary indexes
+
+	Oplog        OplogInfo `json:"oplog"`
+	JournalBytes int64     `json:"journal_bytes"` // Batch journal, present only while a multi-collection batch commits
+	Watchers     int       `json:"watchers"`      // Active Watch subscriptions
+	SchemaCache  CacheInfo `json:"schema_cache"`  // Compiled JSON Schemas reused by writes
+
+	LastBackup *time.Time `json:"last_backup"` // Null until a backup completes while the database is open
+}
+
+// CollectionInfo describes a collection in Info
+type CollectionInfo struct {
+	Name           string      `json:"name"`
+	Documents      int         `json:"documents"`
+	FileBytes      int64       `json:"file_bytes"`
+	IndexFileBytes int64       `json:"index_file_bytes"` // Persisted indexes; 0 until first persisted
+	Indexes        []IndexInfo `json:"indexes"`          // Ordered by name
+
+	// WriteAmplification is the bytes written per byte of documents changed
+	// since the database opened, 0 before any change (see storage.WriteStats)
+	WriteAmplification float64 `json:"write_amplification"`
+}
+
+// IndexInfo describes a secondary index in Info
+type IndexInfo struct {
+	Name      string   `json:"name"`
+	Fields    []string `json:"fields"`
+	Kind      string   `json:"kind"`
+	Unique    bool     `json:"unique"`
+	Documents int      `json:"documents"`  // Documents with at least one entry
+	SizeBytes int64    `json:"size_bytes"` // Rough in-memory size estimate
+}
+
+// OplogInfo describes the oplog in Info
+type OplogInfo struct {
+	Enabled bool   `json:"enabled"`
+	Bytes   int64  `json:"bytes"`
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// CacheInfo reports the lookups of a cache in Info
+type CacheInfo struct {
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // Hits over lookups; 0 before any lookup
+}
+
+// Info returns a snapshot of the database: uptime, collections with their
+// document counts, file sizes and indexes, the oplog, watchers, caches and
+// the last backup. It is gathered from counters, the in-memory indexes and
+// file sizes without reading any collection, and takes no lock a writer
+// holds for long, so it is cheap enough to poll.
+func (d *DB) Info() (*Info, error) {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil, ErrClosed
+	}
+	names := make([]string, 0, len(d.collections))
+	for name := range d.collections {
+		names = append(names, name)
+	}
+	d.mu.Unlock()
+	sort.Strings(names)
+
+	stats, err := d.storage.Stats()
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{
+		Dir:          d.storage.Dir(),
+		ReadOnly:     d.opts.readOnly,
+		OpenedAt:     stats.OpenedAt,
+		Uptime:       time.Since(stats.OpenedAt),
+		Collections:  make([]CollectionInfo, 0, len(names)),
+		Oplog:        OplogInfo{Enabled: stats.OplogEnabled, Bytes: stats.OplogBytes, LastSeq: stats.OplogLastSeq},
+		JournalBytes: stats.JournalBytes,
+		Watchers:     stats.Watchers,
+		SchemaCache:  CacheInfo{Hits: stats.SchemaCacheHits, Misses: stats.SchemaCacheMisses},
+	}
+	if lookups := stats.SchemaCacheHits + stats.SchemaCacheMisses; lookups > 0 {
+		info.SchemaCache.HitRate = float64(stats.SchemaCacheHits) / float64(lookups)
+	}
+
+	for _, name := range names {
+		size, err := d.storage.CollectionSize(name)
+		if err != nil {
+			return nil, err
+		}
+		c := CollectionInfo{Name: name, FileBytes: size, Indexes: []IndexInfo{}, WriteAmplification: d.storage.WriteStats(name).Amplification()}
+		if summary, ok := d.indexes.Summary(name); ok {
+			c.Documents = summary.Documents
+			c.IndexFileBytes = summary.FileBytes
+			for _, idx := range summary.Indexes {
+				c.Indexes = append(c.Indexes, IndexInfo{
+					Name:      idx.Name,
+					Fields:    idx.Fields,
+					Kind:      idx.Kind.String(),
+					Unique:    idx.Unique,
+					Documents: idx.DocumentCount,
+					SizeBytes: idx.SizeBytes,
+				})
+				info.IndexBytes += idx.SizeBytes
+			}
+		}
+		info.Collections = append(info.Collections, c)
+		info.Documents += c.Documents
+		info.DataBytes += c.FileBytes
+	}
+
+	d.backupMu.Lock()
+	if !d.lastBackup.IsZero() {
+		at := d.lastBackup
+		info.LastBackup = &at
+	}
+	d.backupMu.Unlock()
+	return info, nil
+}
+
+// RecordBackup notes that a backup of the database completed at t, for
+// Info. Backups taken with the backup package are recorded automatically.
+func (d *DB) RecordBackup(t time.Time) {
+	d.backupMu.Lock()
+	defer d.backupMu.Unlock()
+	if t.After(d.lastBackup) {
+		d.lastBackup = t
+	}
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// importBatchSize is the number of documents ImportJSONL writes per batch
+const importBatchSize = 1000
+
+// idKey returns the document key IDs are stored under
+func (d *DB) idKey() string {
+	if d.opts.ids.Key != "" {
+		return d.opts.ids.Key
+	}
+	return core.DefaultIDKey
+}
+
+// exportSettings holds the settings of ExportJSONL and ExportCanonical
+type exportSettings struct {
+	redacted bool
+	pretty   bool
+}
+
+// ExportOption configures ExportJSONL and ExportCanonical
+type ExportOption func(*exportSettings)
+
+// ExportRedacted applies the collection's redaction, set with
+// SetRedaction, to the exported documents. Their IDs are written as they
+// are. Without a redaction the documents are exported whole.
+func ExportRedacted() ExportOption {
+	return func(s *exportSettings) {
+		s.redacted = true
+	}
+}
+
+// exportOptions applies export options to the default settings
+func exportOptions(opts []ExportOption) exportSettings {
+	var settings exportSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings
+}
+
+// ExportJSONL writes the collection's documents to w as JSON Lines, one
+// document per line in ID order, each holding its ID under the ID key.
+// Encrypted fields are written decrypted. It returns the number of
+// documents written.
+func (c *Collection) ExportJSONL(w io.Writer, opts ...ExportOption) (int, error) {
+	return c.export(w, exportOptions(opts), func(doc core.Document) ([]byte, error) {
+		return json.Marshal(doc)
+	})
+}
+
+// export writes the collection's documents to w in ID order, each encoded
+// by encode and followed by a newline
+func (c *Collection) export(w io.Writer, settings exportSettings, encode func(core.Document) ([]byte, error)) (int, error) {
+	var redaction *core.Redaction
+	if settings.redacted {
+		var err error
+		if redaction, err = c.db.Redaction(c.name); err != nil {
+			return 0, err
+		}
+	}
+
+	cur, err := c.Iter(core.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close()
+
+	docs := make(map[core.DocumentID]core.Document)
+	for cur.Next() {
+		id, doc := cur.Doc()
+		docs[id] = doc
+	}
+	if err := cur.Err(); err != nil {
+		return 0, fmt.Errorf("failed to export %s: %w", c.name, err)
+	}
+
+	key := c.db.idKey()
+	out := bufio.NewWriter(w)
+	for i, id := range sortedIDs(docs) {
+		doc := docs[id]
+		if redaction == nil {
+			doc = doc.Clone()
+		} else if doc, err = core.RedactDocument(doc, *redaction); err != nil {
+			return i, fmt.Errorf("failed to export %s/%s: %w", c.name, id, err)
+		}
+		doc[key] = string(id)
+		data, err := encode(doc)
+		if err != nil {
+			return i, fmt.Errorf("failed to export %s/%s: %w", c.name, id, err)
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	if err := out.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to export %s: %w", c.name, err)
+	}
+	return len(docs), nil
+}
+
+// ImportJSONL reads JSON Lines documents from r into the collection, as
+// written by ExportJSONL. A document holding an ID under the ID key
+// replaces the document with that ID; one without gets a generated ID.
+// Blank lines are skipped. Documents are written in batches through the
+// collection's field rules, references and hooks, so a failure leaves the
+// batches before it written. It returns the number of documents imported.
+func (c *Collection) ImportJSONL(r io.Reader) (int, error) {
+	key := c.db.idKey()
+	im := &importer{c: c}
+	err := readLines(r, func(line int, data []byte) error {
+		var doc core.Document
+		if err := json.Unmarshal(data, &doc); err != nil || doc == nil {
+			if err == nil {
+				err = fmt.Errorf("not a JSON object")
+			}
+			return fmt.Errorf("failed to import line %d: %w", line, err)
+		}
+
+		id, isString := doc[key].(string)
+		switch {
+		case isString && id != "":
+			return im.add(core.DocumentID(id), doc)
+		case doc[key] == nil || isString:
+			if err := im.flush(); err != nil {
+				return err
+			}
+			if err := im.insert(doc); err != nil {
+				return fmt.Errorf("failed to import line %d: %w", line, err)
+			}
+			return nil
+		default:
+			return fmt.Errorf("failed to import line %d: document key %s holds %T, not a string ID", line, key, doc[key])
+		}
+	})
+	if err == nil {
+		err = im.flush()
+	}
+	return im.imported, err
+}
+
+// readLines passes the non-blank lines of r to fn with their line numbers,
+// stopping at the first error
+func readLines(r io.Reader, fn func(line int, data []byte) error) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := fn(line, data); err != nil {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read line %d: %w", line, readErr)
+		}
+	}
+}
+
+// importer writes imported documents to a collection in batches
+type importer struct {
+	c        *Collection
+	batch    map[core.DocumentID]core.Document
+	imported int
+}
+
+// add queues a document for the next batch, writing the batch once full
+func (im *importer) add(id core.DocumentID, doc core.Document) error {
+	if im.batch == nil {
+		im.batch = make(map[core.DocumentID]core.Document)
+	}
+	im.batch[id] = doc
+	if len(im.batch) >= importBatchSize {
+		return im.flush()
+	}
+	return nil
+}
+
+// insert writes a document without an ID at once, under a generated one.
+// Callers flush first to keep the order of the input.
+func (im *importer) insert(doc core.Document) error {
+	if _, err := im.c.Insert(doc); err != nil {
+		return err
+	}
+	im.imported++
+	return nil
+}
+
+// flush writes the queued documents
+func (im *importer) flush() error {
+	if len(im.batch) == 0 {
+		return nil
+	}
+	writes := im.batch
+	im.batch = nil
+	err := im.c.apply(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return writes, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import into %s: %w", im.c.name, err)
+	}
+	im.imported += len(writes)
+	return nil
+}
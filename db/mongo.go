@@ -0,0 +1,229 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// mongoIDKey is the key MongoDB keeps document IDs under
+const mongoIDKey = "_id"
+
+// ImportReport describes the outcome of ImportMongoExport
+type ImportReport struct {
+	Imported int             // Documents written
+	Problems []ImportProblem // Lines skipped, in input order
+}
+
+// ImportProblem is a line ImportMongoExport skipped because it could not
+// be converted
+type ImportProblem struct {
+	Line int
+	Err  error
+}
+
+// Error describes the problem with its line number
+func (p ImportProblem) Error() string {
+	return fmt.Sprintf("line %d: %v", p.Line, p.Err)
+}
+
+// mongoImport holds the settings of ImportMongoExport
+type mongoImport struct {
+	unixDates bool
+}
+
+// MongoImportOption configures ImportMongoExport
+type MongoImportOption func(*mongoImport)
+
+// MongoDatesAsUnixMillis converts $date values to milliseconds since the
+// Unix epoch instead of RFC 3339 strings
+func MongoDatesAsUnixMillis() MongoImportOption {
+	return func(m *mongoImport) {
+		m.unixDates = true
+	}
+}
+
+// ImportMongoExport reads the JSON Lines output of mongoexport from r into
+// the collection, converting the Extended JSON wrappers MongoDB writes in
+// both its relaxed and canonical modes: $oid becomes its hex string, $date
+// an RFC 3339 string in UTC (or Unix milliseconds with
+// MongoDatesAsUnixMillis), and $numberInt, $numberLong, $numberDouble and
+// $numberDecimal a json.Number holding the exact digits. Each document is
+// stored under its _id, which must be a string, number or ObjectId; one
+// without gets a generated ID. Lines that are not JSON objects or hold
+// values that cannot be converted, such as binary data or NaN, are skipped
+// and listed in the report. Documents are written as ImportJSONL writes
+// them, and an error is returned only when a write or the read fails.
+func (c *Collection) ImportMongoExport(r io.Reader, opts ...MongoImportOption) (ImportReport, error) {
+	var m mongoImport
+	for _, opt := range opts {
+		opt(&m)
+	}
+
+	var report ImportReport
+	key := c.db.idKey()
+	im := &importer{c: c}
+	err := readLines(r, func(line int, data []byte) error {
+		id, doc, err := m.convertLine(data)
+		if err != nil {
+			report.Problems = append(report.Problems, ImportProblem{Line: line, Err: err})
+			return nil
+		}
+		if key != mongoIDKey {
+			delete(doc, mongoIDKey)
+		}
+		if id == "" {
+			if err := im.flush(); err != nil {
+				return err
+			}
+			if err := im.insert(doc); err != nil {
+				return fmt.Errorf("failed to import line %d: %w", line, err)
+			}
+			return nil
+		}
+		doc[key] = string(id)
+		return im.add(id, doc)
+	})
+	if err == nil {
+		err = im.flush()
+	}
+	report.Imported = im.imported
+	return report, err
+}
+
+// convertLine parses a mongoexport line, returning its _id, empty if it
+// has none, and the converted document
+func (m mongoImport) convertLine(data []byte) (core.DocumentID, core.Document, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+		if err == nil {
+			err = fmt.Errorf("not a JSON object")
+		}
+		return "", nil, err
+	}
+	converted, err := m.convert(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	doc := core.Document(converted.(map[string]interface{}))
+
+	var id string
+	switch v := doc[mongoIDKey].(type) {
+	case nil:
+	case string:
+		id = v
+	case json.Number:
+		id = v.String()
+	case float64:
+		id = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", nil, fmt.Errorf("%s holds %T, not a string, number or ObjectId", mongoIDKey, v)
+	}
+	return core.DocumentID(id), doc, nil
+}
+
+// convert replaces the Extended JSON wrappers in a value with plain values
+func (m mongoImport) convert(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key := range v {
+			if strings.HasPrefix(key, "$") {
+				return m.convertWrapper(v)
+			}
+		}
+		for key, element := range v {
+			converted, err := m.convert(element)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			v[key] = converted
+		}
+		return v, nil
+	case []interface{}:
+		for i, element := range v {
+			converted, err := m.convert(element)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			v[i] = converted
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+// convertWrapper converts an object holding an Extended JSON type
+func (m mongoImport) convertWrapper(wrapper map[string]interface{}) (interface{}, error) {
+	if len(wrapper) != 1 {
+		return nil, fmt.Errorf("unsupported Extended JSON object with keys %s", strings.Join(slices.Sorted(maps.Keys(wrapper)), ", "))
+	}
+	for kind, value := range wrapper {
+		switch kind {
+		case "$oid":
+			if s, ok := value.(string); ok {
+				return s, nil
+			}
+		case "$date":
+			return m.convertDate(value)
+		case "$numberInt", "$numberLong", "$numberDouble", "$numberDecimal":
+			if s, ok := value.(string); ok {
+				return mongoNumber(kind, s)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported Extended JSON type %s", kind)
+		}
+		return nil, fmt.Errorf("invalid %s value %v", kind, value)
+	}
+	return nil, nil
+}
+
+// convertDate converts the value of a $date: an ISO 8601 string in relaxed
+// mode, a $numberLong of milliseconds in canonical mode, or a number
+func (m mongoImport) convertDate(value interface{}) (interface{}, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid $date value %q", v)
+		}
+		t = parsed
+	case float64:
+		t = time.UnixMilli(int64(v))
+	case map[string]interface{}:
+		s, ok := v["$numberLong"].(string)
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if !ok || len(v) != 1 || err != nil {
+			return nil, fmt.Errorf("invalid $date value %v", v)
+		}
+		t = time.UnixMilli(ms)
+	default:
+		return nil, fmt.Errorf("invalid $date value %v", v)
+	}
+
+	if m.unixDates {
+		return json.Number(strconv.FormatInt(t.UnixMilli(), 10)), nil
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
+
+// mongoNumber converts the string of a numeric wrapper to a json.Number,
+// failing for values JSON cannot hold, such as NaN and Infinity
+func mongoNumber(kind, s string) (json.Number, error) {
+	if s == "" || !(s[0] == '-' || s[0] >= '0' && s[0] <= '9') || !json.Valid([]byte(s)) {
+		return "", fmt.Errorf("%s value %q is not a JSON number", kind, s)
+	}
+	if kind == "$numberInt" || kind == "$numberLong" {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return "", fmt.Errorf("invalid %s value %q", kind, s)
+		}
+	}
+	return json.Number(s), nil
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// Namespace returns a database scoped to a namespace, such as a tenant. Its
+// collections, indexes, schemas, hooks and references are its own, stored
+// under tenants/<name>/ of the database directory, so the same collection
+// name refers to different collections in different namespaces. It takes
+// the options the database was opened with, and index files follow the
+// index directory. Calling Namespace again returns the same database until
+// it is closed; closing the database closes its namespaces.
+func (d *DB) Namespace(name string) (*DB, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+
+	d.namespacesMu.Lock()
+	defer d.namespacesMu.Unlock()
+
+	if ns, ok := d.namespaces[name]; ok && ns.check() == nil {
+		return ns, nil
+	}
+
+	engine, err := d.storage.Namespace(name)
+	if err != nil {
+		return nil, err
+	}
+	o := d.opts
+	o.indexDir = filepath.Join(d.opts.indexDir, storage.NamespaceDir, name)
+	ns, err := open(engine, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open namespace %s: %w", name, err)
+	}
+
+	d.namespaces[name] = ns
+	return ns, nil
+}
+
+// ListNamespaces returns the names of the database's namespaces, sorted
+func (d *DB) ListNamespaces() ([]string, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	return d.storage.ListNamespaces()
+}
+
+// DropNamespace closes a namespace and deletes its collections and index
+// files, failing with storage.ErrNamespaceNotFound if it does not exist
+func (d *DB) DropNamespace(name string) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	d.namespacesMu.Lock()
+	defer d.namespacesMu.Unlock()
+
+	if ns, ok := d.namespaces[name]; ok {
+		if err := ns.Close(); err != nil {
+			return fmt.Errorf("failed to close namespace %s: %w", name, err)
+		}
+		delete(d.namespaces, name)
+	}
+	if err := d.storage.DropNamespace(name); err != nil {
+		return err
+	}
+	if d.opts.indexDir != d.storage.Dir() {
+		if err := os.RemoveAll(filepath.Join(d.opts.indexDir, storage.NamespaceDir, name)); err != nil {
+			return fmt.Errorf("failed to remove indexes of namespace %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// closeNamespaces closes the opened namespaces
+func (d *DB) closeNamespaces() error {
+	d.namespacesMu.Lock()
+	defer d.namespacesMu.Unlock()
+
+	var errs []error
+	for name, ns := range d.namespaces {
+		if err := ns.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close namespace %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// SetPreserveKeyOrder sets whether a collection keeps the keys of its
+// documents in the order they were written, for files people diff. Plain
+// writes keep the order of a document's existing keys and add new ones
+// after them, sorted; PutOrdered sets the order.
+func (d *DB) SetPreserveKeyOrder(collection string, enabled bool) error {
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	if err := d.storage.SetPreserveKeyOrder(collection, enabled); err != nil {
+		return fmt.Errorf("failed to set key order of %s: %w", collection, err)
+	}
+	return nil
+}
+
+// GetOrdered is Get with the document's keys in their stored order, or
+// sorted if the collection does not preserve key order
+func (c *Collection) GetOrdered(id core.DocumentID) (core.OrderedDocument, error) {
+	if err := c.db.check(); err != nil {
+		return nil, err
+	}
+	stored, err := c.db.storage.ReadOrderedDocument(c.name, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkVisible(id, stored.Document()); err != nil {
+		return nil, err
+	}
+	doc, err := c.db.rulesFor(c.name).readable(stored.Document())
+	if err != nil {
+		return nil, err
+	}
+	return core.OrderDocument(doc, stored), nil
+}
+
+// PutOrdered inserts or replaces a document, keeping the order of its keys
+// if the collection preserves key order. Fields added by defaults or
+// computed fields come after the document's own, sorted.
+func (c *Collection) PutOrdered(id core.DocumentID, doc core.OrderedDocument) error {
+	if id == "" || doc == nil {
+		return fmt.Errorf("missing document or ID - unable to put into %s", c.name)
+	}
+	ctx := storage.WithKeyOrder(context.Background(), c.name, id, doc)
+	return c.applyContext(ctx, func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{id: doc.Document()}, nil
+	})
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Page is one page of a query's results with the metadata to navigate the
+// rest
+type Page struct {
+	Items      []core.Document
+	TotalItems int
+	TotalPages int
+	Page       int // 1-based; for keyset pages, the page the first item falls on
+	PerPage    int
+	HasNext    bool
+	HasPrev    bool
+}
+
+// Paginate returns page (counting from 1) of the documents matching a query,
+// perPage at a time, in the query's order. The query's Limit and Offset are
+// replaced. The items and the totals come from one pass over the query's
+// index or the collection, so they agree even under concurrent writes. A
+// page beyond the end has no items but correct totals.
+func (c *Collection) Paginate(q core.Query, page, perPage int) (Page, error) {
+	if page < 1 {
+		return Page{}, fmt.Errorf("invalid page: %d", page)
+	}
+	if perPage <= 0 {
+		return Page{}, fmt.Errorf("invalid page size: %d", perPage)
+	}
+	q.Offset, q.Limit = (page-1)*perPage, perPage
+	p, err := c.paginate(q, "", perPage)
+	if err != nil {
+		return Page{}, err
+	}
+	p.Page = page
+	return p, nil
+}
+
+// PaginateAfter returns the perPage documents matching a query that follow
+// afterID in the query's order, or the first perPage when afterID is empty.
+// Unlike Paginate, documents inserted before the cursor do not shift later
+// pages. Without a sort afterID need not exist; with one it must, or
+// core.ErrDocumentNotFound is returned.
+func (c *Collection) PaginateAfter(q core.Query, afterID core.DocumentID, perPage int) (Page, error) {
+	if perPage <= 0 {
+		return Page{}, fmt.Errorf("invalid page size: %d", perPage)
+	}
+	q.Offset, q.Limit = 0, perPage
+	return c.paginate(q, afterID, perPage)
+}
+
+// paginate runs a paging query and builds its page
+func (c *Collection) paginate(q core.Query, afterID core.DocumentID, perPage int) (Page, error) {
+	if err := c.db.check(); err != nil {
+		return Page{}, err
+	}
+	rules := c.db.rulesFor(c.name)
+	if err := rules.checkQuery(q); err != nil {
+		return Page{}, err
+	}
+	q, err := c.secure(q)
+	if err != nil {
+		return Page{}, err
+	}
+	q.Collection = c.name
+
+	w, err := c.db.query.ExecuteWindow(q, afterID)
+	if err != nil {
+		return Page{}, err
+	}
+	for i, doc := range w.Docs {
+		if w.Docs[i], err = rules.readable(doc); err != nil {
+			return Page{}, err
+		}
+	}
+
+	return Page{
+		Items:      w.Docs,
+		TotalItems: w.Total,
+		TotalPages: (w.Total + perPage - 1) / perPage,
+		Page:       w.Before/perPage + 1,
+		PerPage:    perPage,
+		HasNext:    w.Before+len(w.Docs) < w.Total,
+		HasPrev:    w.Before > 0,
+	}, nil
+}
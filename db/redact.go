@@ -0,0 +1,39 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// SetRedaction sets how a collection's documents are redacted when they
+// leave the database through ExportJSONL with ExportRedacted or the HTTP
+// API. It is stored with the collection, so operators can change it without
+// code, and never touches the documents themselves. A redaction without
+// rules removes it.
+func (d *DB) SetRedaction(collection string, redaction core.Redaction) error {
+	if err := redaction.Validate(); err != nil {
+		return fmt.Errorf("failed to set redaction of %s: %w", collection, err)
+	}
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+
+	var stored *core.Redaction
+	if len(redaction.Rules) > 0 {
+		stored = &redaction
+	}
+	if err := d.storage.SetRedaction(collection, stored); err != nil {
+		return fmt.Errorf("failed to set redaction of %s: %w", collection, err)
+	}
+	return nil
+}
+
+// Redaction returns the redaction of a collection, or nil if it has none
+func (d *DB) Redaction(collection string) (*core.Redaction, error) {
+	redaction, err := d.storage.Redaction(collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get redaction of %s: %w", collection, err)
+	}
+	return redaction, nil
+}
@@ -0,0 +1,301 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// ErrReferenceViolation is returned for a write that would leave a
+// reference to a document that does not exist, or for deleting a document a
+// restricting reference still points at
+var ErrReferenceViolation = errors.New("reference violation")
+
+// DeclareReference declares that field of the documents in from holds the
+// ID of a document in to. Writes through Collection handles then fail with
+// ErrReferenceViolation when the field names a document to does not have,
+// and deleting a document of to restricts, cascades to or nulls the field
+// of the documents referencing it, in the same atomic batch. Cascades
+// follow further references, but do not run hooks. A missing or null field
+// references nothing.
+//
+// The reference is stored with from and checked again on Open. A hash index
+// on the field is created if missing, so deletes find referencing documents
+// without scanning. Declaring a reference on a field again replaces it;
+// existing documents must already satisfy it.
+func (d *DB) DeclareReference(from, field, to string, onDelete core.RefAction) error {
+	if field == "" {
+		return fmt.Errorf("missing field - unable to declare reference from %s", from)
+	}
+	if _, err := onDelete.MarshalText(); err != nil {
+		return err
+	}
+	for _, name := range []string{from, to} {
+		if _, err := d.Collection(name); err != nil {
+			return err
+		}
+	}
+	if err := d.ensureReferenceIndex(from, field); err != nil {
+		return err
+	}
+
+	ref := core.Reference{Field: field, To: to, OnDelete: onDelete}
+	var refs []core.Reference
+
+	// Check existing documents and register under the batch's locks, so no
+	// write slips in between
+	err := d.indexes.ApplyMultiBatchLookup(context.Background(), []string{from, to}, func(docs map[string]map[core.DocumentID]core.Document, _ index.LookupFunc) (map[string]map[core.DocumentID]core.Document, error) {
+		for _, docID := range sortedIDs(docs[from]) {
+			if err := checkReference(docs, nil, from, docID, docs[from][docID], ref); err != nil {
+				return nil, err
+			}
+		}
+
+		d.rulesMu.Lock()
+		defer d.rulesMu.Unlock()
+
+		for _, existing := range d.refs[from] {
+			if existing.Field != field {
+				refs = append(refs, existing)
+			}
+		}
+		refs = append(refs, ref)
+		d.refs[from] = refs
+		return nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to declare reference %s.%s: %w", from, field, err)
+	}
+
+	if err := d.storage.SetReferences(from, refs); err != nil {
+		return fmt.Errorf("failed to store reference %s.%s: %w", from, field, err)
+	}
+	return nil
+}
+
+// References returns the references a collection's documents make
+func (d *DB) References(collection string) []core.Reference {
+	d.rulesMu.RLock()
+	defer d.rulesMu.RUnlock()
+
+	return append([]core.Reference(nil), d.refs[collection]...)
+}
+
+// loadReferences loads the references stored with the collections, checking
+// that the referenced collections exist and the referencing fields are
+// indexed
+func (d *DB) loadReferences() error {
+	for from := range d.collections {
+		refs, err := d.storage.References(from)
+		if err != nil {
+			return fmt.Errorf("failed to load references of %s: %w", from, err)
+		}
+		for _, ref := range refs {
+			if _, exists := d.collections[ref.To]; !exists {
+				return fmt.Errorf("invalid reference %s.%s: %w: %s", from, ref.Field, ErrCollectionNotFound, ref.To)
+			}
+			if err := d.ensureReferenceIndex(from, ref.Field); err != nil {
+				return err
+			}
+		}
+		if len(refs) > 0 {
+			d.refs[from] = refs
+		}
+	}
+	return nil
+}
+
+// ensureReferenceIndex creates a hash index on a referencing field unless
+// the field has an index
+func (d *DB) ensureReferenceIndex(collection, field string) error {
+	infos, err := d.indexes.ListIndexes(collection)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if info.Name == field && len(info.Fields) == 1 {
+			return nil
+		}
+	}
+	if err := d.indexes.CreateSecondaryIndex(collection, field, core.IndexHash); err != nil {
+		return fmt.Errorf("failed to index reference %s.%s: %w", collection, field, err)
+	}
+	return nil
+}
+
+// referenceScope returns the collections a write to collection needs in
+// its batch: collection itself, the ones it references and, following
+// cascades, the ones referencing it. It returns nil when no reference
+// involves collection.
+func (d *DB) referenceScope(collection string) (map[string][]core.Reference, []string) {
+	d.rulesMu.RLock()
+	defer d.rulesMu.RUnlock()
+
+	scope := map[string]bool{collection: true}
+	for _, ref := range d.refs[collection] {
+		scope[ref.To] = true
+	}
+	for queue := []string{collection}; len(queue) > 0; queue = queue[1:] {
+		for from, refs := range d.refs {
+			for _, ref := range refs {
+				if ref.To != queue[0] {
+					continue
+				}
+				if !scope[from] && ref.OnDelete == core.RefCascade {
+					queue = append(queue, from)
+				}
+				scope[from] = true
+			}
+		}
+	}
+	if len(scope) == 1 && len(d.refs[collection]) == 0 {
+		return nil, nil
+	}
+
+	refs := make(map[string][]core.Reference, len(d.refs))
+	for from, fromRefs := range d.refs {
+		refs[from] = fromRefs
+	}
+	names := make([]string, 0, len(scope))
+	for name := range scope {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return refs, names
+}
+
+// enforceReferences applies the delete actions of a collection's writes and
+// checks the references the batch writes, returning every collection's
+// writes
+func enforceReferences(collection string, refs map[string][]core.Reference, docs map[string]map[core.DocumentID]core.Document, writes map[core.DocumentID]core.Document, lookup index.LookupFunc) (map[string]map[core.DocumentID]core.Document, error) {
+	all := map[string]map[core.DocumentID]core.Document{collection: writes}
+	froms := make([]string, 0, len(refs))
+	for from := range refs {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+
+	type deletion struct {
+		collection string
+		docID      core.DocumentID
+	}
+	var queue []deletion
+	for _, docID := range sortedIDs(writes) {
+		if _, exists := docs[collection][docID]; exists && writes[docID] == nil {
+			queue = append(queue, deletion{collection, docID})
+		}
+	}
+
+	// Deletes first, so the documents they change are known before the
+	// written references are checked
+	for ; len(queue) > 0; queue = queue[1:] {
+		deleted := queue[0]
+		for _, from := range froms {
+			for _, ref := range refs[from] {
+				if ref.To != deleted.collection {
+					continue
+				}
+				ids, err := referencing(docs, all, lookup, from, ref.Field, deleted.docID)
+				if err != nil {
+					return nil, err
+				}
+				for _, docID := range ids {
+					switch ref.OnDelete {
+					case core.RefRestrict:
+						return nil, fmt.Errorf("%w: %s/%s is referenced by %s/%s", ErrReferenceViolation, deleted.collection, deleted.docID, from, docID)
+					case core.RefCascade:
+						if all[from] == nil {
+							all[from] = make(map[core.DocumentID]core.Document)
+						}
+						all[from][docID] = nil
+						queue = append(queue, deletion{from, docID})
+					case core.RefSetNull:
+						doc := currentDocument(docs, all, from, docID).Clone()
+						if parent, name, ok := fieldParent(doc, ref.Field); ok {
+							parent[name] = nil
+						}
+						if all[from] == nil {
+							all[from] = make(map[core.DocumentID]core.Document)
+						}
+						all[from][docID] = doc
+					}
+				}
+			}
+		}
+	}
+
+	for _, from := range froms {
+		for _, docID := range sortedIDs(all[from]) {
+			for _, ref := range refs[from] {
+				if err := checkReference(docs, all, from, docID, all[from][docID], ref); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return all, nil
+}
+
+// checkReference checks that a document written to from references an
+// existing document. References the write leaves unchanged are not checked
+// again.
+func checkReference(docs, writes map[string]map[core.DocumentID]core.Document, from string, docID core.DocumentID, doc core.Document, ref core.Reference) error {
+	if doc == nil {
+		return nil
+	}
+	value, ok := core.GetPath(doc, ref.Field)
+	if !ok || value == nil {
+		return nil
+	}
+	if writes != nil {
+		if old, exists := docs[from][docID]; exists {
+			if oldValue, _ := core.GetPath(old, ref.Field); reflect.DeepEqual(oldValue, value) {
+				return nil
+			}
+		}
+	}
+
+	id, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("%w: %s/%s field %s holds %T, not a document ID", ErrReferenceViolation, from, docID, ref.Field, value)
+	}
+	if currentDocument(docs, writes, ref.To, core.DocumentID(id)) == nil {
+		return fmt.Errorf("%w: %s/%s references missing %s/%s", ErrReferenceViolation, from, docID, ref.To, id)
+	}
+	return nil
+}
+
+// referencing returns the IDs of the documents of from whose field holds a
+// document ID, as of the batch's writes so far
+func referencing(docs, writes map[string]map[core.DocumentID]core.Document, lookup index.LookupFunc, from, field string, target core.DocumentID) ([]core.DocumentID, error) {
+	candidates, err := lookup(from, field, string(target))
+	if errors.Is(err, index.ErrIndexNotFound) {
+		candidates, err = sortedIDs(docs[from]), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []core.DocumentID
+	for _, docID := range candidates {
+		doc := currentDocument(docs, writes, from, docID)
+		if value, ok := core.GetPath(doc, field); ok && value == string(target) {
+			ids = append(ids, docID)
+		}
+	}
+	return ids, nil
+}
+
+// currentDocument returns a document as the batch's writes so far leave it,
+// or nil if it does not exist
+func currentDocument(docs, writes map[string]map[core.DocumentID]core.Document, collection string, docID core.DocumentID) core.Document {
+	if doc, written := writes[collection][docID]; written {
+		return doc
+	}
+	return docs[collection][docID]
+}
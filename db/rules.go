@@ -0,0 +1,148 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ComputeFunc derives a field's value from the rest of a document
+type ComputeFunc func(doc core.Document) interface{}
+
+// computedField is a field set by a ComputeFunc on every write
+type computedField struct {
+	field string
+	fn    ComputeFunc
+}
+
+// fieldRules are the defaults, computed fields and encrypted fields of one
+// collection
+type fieldRules struct {
+	defaults core.Document
+	computed []computedField
+	cipher   *fieldCipher // nil without encrypted fields
+}
+
+// SetDefaults sets the values inserts into a collection take for top-level
+// fields they lack. Updates never get defaults, so a field an update leaves
+// out stays absent. The defaults are stored with the collection and applied
+// before schema validation. An empty document removes them.
+func (d *DB) SetDefaults(collection string, defaults core.Document) error {
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	if err := d.storage.SetDefaults(collection, defaults); err != nil {
+		return fmt.Errorf("failed to set defaults of %s: %w", collection, err)
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	rules := d.rules[collection]
+	rules.defaults = nil
+	if len(defaults) > 0 {
+		rules.defaults = defaults.Clone()
+	}
+	d.rules[collection] = rules
+	return nil
+}
+
+// SetComputed makes fn set a field on every insert and update of a
+// collection, after defaults and before-write hooks, in the order the
+// fields were first set. A nil fn removes the field's rule. Computed fields
+// are not stored with the collection, so they must be set again after Open.
+func (d *DB) SetComputed(collection, field string, fn ComputeFunc) {
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	rules := d.rules[collection]
+	computed := make([]computedField, 0, len(rules.computed)+1)
+	replaced := false
+	for _, c := range rules.computed {
+		if c.field != field {
+			computed = append(computed, c)
+			continue
+		}
+		if fn != nil {
+			computed = append(computed, computedField{field: field, fn: fn})
+		}
+		replaced = true
+	}
+	if !replaced && fn != nil {
+		computed = append(computed, computedField{field: field, fn: fn})
+	}
+	rules.computed = computed
+	d.rules[collection] = rules
+}
+
+// loadRules loads the field rules stored with a collection. The key of its
+// encrypted fields is not stored, so they stay encrypted until EncryptFields.
+func (d *DB) loadRules(collection string) error {
+	defaults, err := d.storage.Defaults(collection)
+	if err != nil {
+		return fmt.Errorf("failed to load defaults of %s: %w", collection, err)
+	}
+	encrypted, err := d.storage.EncryptedFields(collection)
+	if err != nil {
+		return fmt.Errorf("failed to load encrypted fields of %s: %w", collection, err)
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	rules := fieldRules{defaults: defaults}
+	if len(encrypted) > 0 {
+		rules.cipher = &fieldCipher{fields: encrypted}
+	}
+	d.rules[collection] = rules
+	return nil
+}
+
+// rulesFor returns the field rules of a collection
+func (d *DB) rulesFor(collection string) fieldRules {
+	d.rulesMu.RLock()
+	defer d.rulesMu.RUnlock()
+
+	return d.rules[collection]
+}
+
+// applyDefaults fills in the defaults of documents a batch inserts, which
+// are those missing from docs
+func (r fieldRules) applyDefaults(docs, writes map[core.DocumentID]core.Document) {
+	if len(r.defaults) == 0 {
+		return
+	}
+	for docID, doc := range writes {
+		if _, exists := docs[docID]; exists || doc == nil {
+			continue
+		}
+		for field, value := range r.defaults.Clone() {
+			if _, ok := doc[field]; !ok {
+				doc[field] = value
+			}
+		}
+	}
+}
+
+// applyComputed sets the computed fields of every document a batch writes
+func (r fieldRules) applyComputed(collection string, writes map[core.DocumentID]core.Document) error {
+	if len(r.computed) == 0 {
+		return nil
+	}
+	for _, docID := range sortedIDs(writes) {
+		doc := writes[docID]
+		if doc == nil {
+			continue
+		}
+		for _, c := range r.computed {
+			err := callHook(collection, docID, "computed "+c.field, func() error {
+				doc[c.field] = c.fn(doc)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+var (
+	// ErrPolicyViolation is returned when a write through a Scope would
+	// leave a document its principal's policy does not let it see
+	ErrPolicyViolation = errors.New("document violates security policy")
+
+	// ErrNoPrincipal is returned when a collection with a security policy
+	// is used through a handle without a principal
+	ErrNoPrincipal = errors.New("collection has a security policy and needs a principal")
+)
+
+// Principal is who a Scope acts on behalf of, such as the holder of an API
+// key. Policies decide what it may see from its attributes.
+type Principal struct {
+	ID         string
+	Roles      []string
+	Attributes map[string]string // Such as "tenant_id"
+
+	system bool
+}
+
+// SystemPrincipal bypasses every security policy. It is the only principal
+// that does.
+var SystemPrincipal = Principal{ID: "system", system: true}
+
+// IsSystem reports whether the principal is SystemPrincipal
+func (p Principal) IsSystem() bool {
+	return p.system
+}
+
+// PolicyFunc returns the filter the documents a principal may see must
+// match
+type PolicyFunc func(principal Principal) core.FilterNode
+
+// RegisterPolicy secures a collection with row-level security: its
+// documents are only reachable through a Scope, whose principal sees those
+// matching the filter fn returns for it. The filter is ANDed into every
+// query, documents read by ID that fail it are reported as not found, so
+// their existence does not leak, as are those writes would replace or
+// delete. Writes that would leave a document failing it fail with
+// ErrPolicyViolation. Handles without a principal fail with ErrNoPrincipal,
+// and only SystemPrincipal bypasses the policy.
+// Documents are matched as stored, so the filter cannot use encrypted
+// fields. The policy guards collection handles and the counter and array
+// operations, which the DB methods fail with ErrNoPrincipal and Scope has
+// variants of, but not the storage engine, indexes or executor beneath them,
+// nor DB methods working on whole collections, such as CloneCollection,
+// Snapshot and Watch. Maintenance such as the TTL purge sees every document.
+// Policies are not stored with the collection, so they must be registered
+// again after Open. A nil fn removes the policy.
+func (d *DB) RegisterPolicy(collection string, fn PolicyFunc) {
+	d.policiesMu.Lock()
+	defer d.policiesMu.Unlock()
+
+	if fn == nil {
+		delete(d.policies, collection)
+		return
+	}
+	if d.policies == nil {
+		d.policies = make(map[string]PolicyFunc)
+	}
+	d.policies[collection] = fn
+}
+
+// HasPolicy reports whether a collection has a security policy
+func (d *DB) HasPolicy(collection string) bool {
+	return d.policyFor(collection) != nil
+}
+
+// policyFor returns the security policy of a collection, or nil if it has
+// none
+func (d *DB) policyFor(collection string) PolicyFunc {
+	d.policiesMu.RLock()
+	defer d.policiesMu.RUnlock()
+	return d.policies[collection]
+}
+
+// Scope is a database acting on behalf of a principal, returned by
+// WithPrincipal
+type Scope struct {
+	db        *DB
+	principal Principal
+}
+
+// WithPrincipal returns a scope whose collection handles act on behalf of
+// principal, as the collections' security policies allow
+func (d *DB) WithPrincipal(principal Principal) *Scope {
+	return &Scope{db: d, principal: principal}
+}
+
+// Principal returns who the scope acts on behalf of
+func (s *Scope) Principal() Principal {
+	return s.principal
+}
+
+// Collection returns a handle on a collection acting on behalf of the
+// scope's principal, as DB.Collection does
+func (s *Scope) Collection(name string) (*Collection, error) {
+	c, err := s.db.Collection(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.as(s.principal), nil
+}
+
+// as returns a copy of the handle acting on behalf of principal.
+// Maintenance, such as the TTL purge, acts as SystemPrincipal.
+func (c *Collection) as(principal Principal) *Collection {
+	return &Collection{name: c.name, db: c.db, coll: c.coll, principal: &principal}
+}
+
+// rowFilter is the filter a collection handle's documents must match
+type rowFilter struct {
+	node    core.FilterNode
+	matcher *query.Matcher
+}
+
+// rowFilter returns the filter the policy of the handle's collection sets
+// for its principal, or nil if it may see every document
+func (c *Collection) rowFilter() (*rowFilter, error) {
+	policy := c.db.policyFor(c.name)
+	if policy == nil {
+		return nil, nil
+	}
+	if c.principal == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoPrincipal, c.name)
+	}
+	if c.principal.system {
+		return nil, nil
+	}
+
+	node := policy(*c.principal)
+	matcher, err := query.NewMatcher(core.Query{Where: &node})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply security policy of %s: %w", c.name, err)
+	}
+	return &rowFilter{node: node, matcher: matcher}, nil
+}
+
+// secure restricts a query to the documents the handle may see
+func (c *Collection) secure(q core.Query) (core.Query, error) {
+	filter, err := c.rowFilter()
+	if err != nil || filter == nil {
+		return q, err
+	}
+	where := filter.node
+	if q.Where != nil {
+		where = core.And(*q.Where, filter.node)
+	}
+	q.Where = &where
+	return q, nil
+}
+
+// checkVisible fails with core.ErrDocumentNotFound if the handle may not
+// see a document it read by ID
+func (c *Collection) checkVisible(id core.DocumentID, doc core.Document) error {
+	filter, err := c.rowFilter()
+	if err != nil || filter == nil {
+		return err
+	}
+	if !filter.matches(id, doc) {
+		return fmt.Errorf("%w: %s", core.ErrDocumentNotFound, id)
+	}
+	return nil
+}
+
+// matches reports whether a document passes the filter
+func (f *rowFilter) matches(id core.DocumentID, doc core.Document) bool {
+	_, ok := f.matcher.Match(id, doc)
+	return ok
+}
+
+// visible returns the documents of docs the filter lets through
+func (f *rowFilter) visible(docs map[core.DocumentID]core.Document) map[core.DocumentID]core.Document {
+	visible := make(map[core.DocumentID]core.Document, len(docs))
+	for id, doc := range docs {
+		if f.matches(id, doc) {
+			visible[id] = doc
+		}
+	}
+	return visible
+}
+
+// checkWrites fails with core.ErrDocumentNotFound if writes would replace
+// or delete a document the filter hides, as if it were missing so its
+// existence does not leak, and with ErrPolicyViolation if they would leave
+// one it hides
+func (f *rowFilter) checkWrites(collection string, docs, writes map[core.DocumentID]core.Document) error {
+	for id, doc := range writes {
+		if old, exists := docs[id]; exists && !f.matches(id, old) {
+			return fmt.Errorf("%w: %s/%s", core.ErrDocumentNotFound, collection, id)
+		}
+		if doc != nil && !f.matches(id, doc) {
+			return fmt.Errorf("%w: %s/%s", ErrPolicyViolation, collection, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// CollectionSnapshot is a collection's documents, configuration and index
+// definitions as of one moment
+type CollectionSnapshot struct {
+	Name    string
+	File    *storage.CollectionFile // Stored documents and metadata; encrypted fields stay encrypted
+	Indexes json.RawMessage         // Secondary index definitions, as index.FileIndexManager.Definitions
+}
+
+// Snapshot takes a consistent snapshot of a collection, failing with
+// ErrCollectionNotFound if it does not exist
+func (d *DB) Snapshot(name string) (*CollectionSnapshot, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+	if _, ok := d.collections[name]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	file, err := d.storage.SnapshotCollection(name)
+	if err != nil {
+		return nil, err
+	}
+	indexes, err := d.indexes.Definitions(name)
+	if err != nil {
+		return nil, err
+	}
+	return &CollectionSnapshot{Name: name, File: file, Indexes: indexes}, nil
+}
+
+// Restore replaces collections with snapshots, creating the ones that do not
+// exist, and rebuilds their indexes. The references of the snapshots must
+// target collections that exist or are restored along with them. Writes
+// made by Restore run no hooks and are not seen by watchers.
+func (d *DB) Restore(snapshots []*CollectionSnapshot) error {
+	restored := make(map[string]bool, len(snapshots))
+	for _, s := range snapshots {
+		if err := validateName(s.Name); err != nil {
+			return err
+		}
+		restored[s.Name] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+	for _, s := range snapshots {
+		for _, ref := range s.File.Metadata.References {
+			if _, exists := d.collections[ref.To]; !exists && !restored[ref.To] {
+				return fmt.Errorf("failed to restore %s: invalid reference %s.%s: %w: %s", s.Name, s.Name, ref.Field, ErrCollectionNotFound, ref.To)
+			}
+		}
+	}
+
+	for _, s := range snapshots {
+		if err := d.storage.RestoreCollection(s.Name, s.File); err != nil {
+			return err
+		}
+		if err := d.indexes.RestoreDefinitions(s.Name, s.Indexes); err != nil {
+			return fmt.Errorf("failed to restore indexes of %s: %w", s.Name, err)
+		}
+		if _, ok := d.collections[s.Name]; !ok {
+			d.collections[s.Name] = d.handle(s.Name)
+		}
+		if err := d.loadRules(s.Name); err != nil {
+			return err
+		}
+	}
+
+	d.rulesMu.Lock()
+	defer d.rulesMu.Unlock()
+
+	for _, s := range snapshots {
+		refs := s.File.Metadata.References
+		for _, ref := range refs {
+			if err := d.ensureReferenceIndex(s.Name, ref.Field); err != nil {
+				return err
+			}
+		}
+		delete(d.refs, s.Name)
+		if len(refs) > 0 {
+			d.refs[s.Name] = refs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// ErrInvalidSpec is returned by CreateCollectionWithSpec for a spec it
+// cannot apply
+var ErrInvalidSpec = errors.New("invalid collection spec")
+
+// CollectionSpec is the configuration of a collection, created in one call
+// by CreateCollectionWithSpec and captured from an existing collection by
+// ExportSpec. It encodes to JSON, so a spec exported in one environment can
+// be replayed in another.
+type CollectionSpec struct {
+	Name       string          `json:"name"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	SchemaMode schema.Mode     `json:"schema_mode,omitempty"`
+	Indexes    []IndexSpec     `json:"indexes,omitempty"`
+	// TTLField is the field of the collection's expiration index, as set by
+	// EnableTTL; empty for none
+	TTLField string `json:"ttl_field,omitempty"`
+	// IDField is the document key IDs are kept under. It is set for the
+	// whole database by WithIDField, so a spec naming another key is
+	// rejected; empty accepts the database's.
+	IDField          string                 `json:"id_field,omitempty"`
+	Defaults         core.Document          `json:"defaults,omitempty"`
+	Redaction        *core.Redaction        `json:"redaction,omitempty"`
+	PreserveKeyOrder bool                   `json:"preserve_key_order,omitempty"`
+	Meta             map[string]interface{} `json:"meta,omitempty"`
+}
+
+// IndexSpec defines a secondary index of a CollectionSpec. Composite
+// indexes take two or more fields and no options; unique indexes must be
+// hash indexes; Text applies only to text indexes. Expiration indexes are
+// given as the spec's TTLField.
+type IndexSpec struct {
+	Fields               []string           `json:"fields"`
+	Kind                 core.IndexKind     `json:"kind"`
+	Unique               bool               `json:"unique,omitempty"`
+	RejectDuplicateNulls bool               `json:"unique_nulls,omitempty"`
+	Sparse               bool               `json:"sparse,omitempty"`
+	CaseInsensitive      bool               `json:"case_insensitive,omitempty"`
+	Text                 *index.TextOptions `json:"text,omitempty"`
+}
+
+// validate checks an index spec before anything is created
+func (s IndexSpec) validate() error {
+	for _, field := range s.Fields {
+		if field == "" {
+			return fmt.Errorf("%w: index with an empty field", ErrInvalidSpec)
+		}
+	}
+	options := s.Unique || s.RejectDuplicateNulls || s.Sparse || s.CaseInsensitive
+	switch {
+	case s.Kind == core.IndexComposite && (len(s.Fields) < 2 || options || s.Text != nil):
+		return fmt.Errorf("%w: composite index needs two or more fields and no options", ErrInvalidSpec)
+	case s.Kind != core.IndexComposite && len(s.Fields) != 1:
+		return fmt.Errorf("%w: %s index needs one field, got %v", ErrInvalidSpec, s.Kind, s.Fields)
+	case s.Kind == core.IndexExpiry:
+		return fmt.Errorf("%w: expiry index on %s must be given as the TTL field", ErrInvalidSpec, s.Fields[0])
+	case s.Kind == core.IndexText && options:
+		return fmt.Errorf("%w: text index on %s takes only text options", ErrInvalidSpec, s.Fields[0])
+	case s.Kind != core.IndexText && s.Text != nil:
+		return fmt.Errorf("%w: text options on %s index %s", ErrInvalidSpec, s.Kind, s.Fields[0])
+	case s.Unique && s.Kind != core.IndexHash:
+		return fmt.Errorf("%w: unique index on %s must be a hash index", ErrInvalidSpec, s.Fields[0])
+	case s.RejectDuplicateNulls && !s.Unique:
+		return fmt.Errorf("%w: rejecting duplicate nulls on %s needs a unique index", ErrInvalidSpec, s.Fields[0])
+	case s.Kind != core.IndexHash && s.Kind != core.IndexOrdered && s.Kind != core.IndexComposite && s.Kind != core.IndexText:
+		return fmt.Errorf("%w: unknown index kind %s", ErrInvalidSpec, s.Kind)
+	}
+	return nil
+}
+
+// create builds the index on a collection
+func (s IndexSpec) create(indexes *index.FileIndexManager, collection string) error {
+	opts := index.IndexOptions{Sparse: s.Sparse, CaseInsensitive: s.CaseInsensitive}
+	switch {
+	case s.Kind == core.IndexComposite:
+		return indexes.CreateCompositeIndex(collection, s.Fields)
+	case s.Kind == core.IndexText:
+		var text index.TextOptions
+		if s.Text != nil {
+			text = *s.Text
+		}
+		return indexes.CreateTextIndex(collection, s.Fields[0], text)
+	case s.Unique:
+		return indexes.CreateUniqueIndexWithOptions(collection, s.Fields[0], index.UniqueOptions{IndexOptions: opts, RejectDuplicateNulls: s.RejectDuplicateNulls})
+	}
+	return indexes.CreateIndexWithOptions(collection, s.Fields[0], s.Kind, opts)
+}
+
+// CreateCollectionWithSpec creates a collection configured by a spec. The
+// spec is checked first, failing with ErrInvalidSpec, and a collection that
+// exists fails with ErrCollectionExists. If any part of the configuration
+// then fails, such as a schema that does not compile, the collection is
+// dropped again, so it is either created whole or not at all.
+func (d *DB) CreateCollectionWithSpec(spec CollectionSpec) error {
+	if err := validateName(spec.Name); err != nil {
+		return err
+	}
+	if spec.IDField != "" && spec.IDField != d.idKey() {
+		return fmt.Errorf("%w: ID field %s, but the database keeps IDs under %s", ErrInvalidSpec, spec.IDField, d.idKey())
+	}
+	for _, idx := range spec.Indexes {
+		if err := idx.validate(); err != nil {
+			return err
+		}
+	}
+	if spec.Redaction != nil {
+		if err := spec.Redaction.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidSpec, err)
+		}
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	if _, exists := d.collections[spec.Name]; exists {
+		d.mu.Unlock()
+		return fmt.Errorf("failed to create collection %s: %w", spec.Name, ErrCollectionExists)
+	}
+	_, err := d.create(spec.Name)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := d.applySpec(spec); err != nil {
+		if dropErr := d.DropCollection(spec.Name); dropErr != nil {
+			return errors.Join(fmt.Errorf("failed to create collection %s: %w", spec.Name, err), dropErr)
+		}
+		return fmt.Errorf("failed to create collection %s: %w", spec.Name, err)
+	}
+	return nil
+}
+
+// applySpec configures a new collection as its spec says
+func (d *DB) applySpec(spec CollectionSpec) error {
+	if len(spec.Schema) > 0 {
+		if err := d.SetSchema(spec.Name, spec.Schema, spec.SchemaMode); err != nil {
+			return err
+		}
+	}
+	if len(spec.Defaults) > 0 {
+		if err := d.SetDefaults(spec.Name, spec.Defaults); err != nil {
+			return err
+		}
+	}
+	if spec.Redaction != nil {
+		if err := d.SetRedaction(spec.Name, *spec.Redaction); err != nil {
+			return err
+		}
+	}
+	if spec.PreserveKeyOrder {
+		if err := d.SetPreserveKeyOrder(spec.Name, true); err != nil {
+			return err
+		}
+	}
+	if len(spec.Meta) > 0 {
+		if err := d.storage.SetCollectionMeta(spec.Name, spec.Meta); err != nil {
+			return err
+		}
+	}
+	for _, idx := range spec.Indexes {
+		if err := idx.create(d.indexes, spec.Name); err != nil {
+			return err
+		}
+	}
+	if spec.TTLField != "" {
+		if err := d.EnableTTL(spec.Name, spec.TTLField); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportSpec captures the configuration of a collection as a spec that
+// CreateCollectionWithSpec recreates, without its documents. References
+// and encrypted fields are not part of a spec: they involve other
+// collections and a key.
+func (d *DB) ExportSpec(collection string) (CollectionSpec, error) {
+	if _, err := d.Collection(collection); err != nil {
+		return CollectionSpec{}, err
+	}
+	metadata, err := d.storage.GetCollectionMeta(collection)
+	if err != nil {
+		return CollectionSpec{}, fmt.Errorf("failed to export spec of %s: %w", collection, err)
+	}
+	spec := CollectionSpec{
+		Name:             collection,
+		Schema:           metadata.Schema,
+		SchemaMode:       metadata.SchemaMode,
+		IDField:          d.idKey(),
+		Defaults:         metadata.Defaults,
+		Redaction:        metadata.Redaction,
+		PreserveKeyOrder: metadata.PreserveKeyOrder,
+		Meta:             metadata.Custom,
+	}
+
+	// Index definitions encode with the keys of IndexSpec
+	data, err := d.indexes.Definitions(collection)
+	if err != nil {
+		return CollectionSpec{}, fmt.Errorf("failed to export spec of %s: %w", collection, err)
+	}
+	var defs []IndexSpec
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return CollectionSpec{}, fmt.Errorf("failed to export spec of %s: %w", collection, err)
+	}
+	for _, def := range defs {
+		if def.Kind == core.IndexExpiry {
+			spec.TTLField = def.Fields[0]
+			continue
+		}
+		spec.Indexes = append(spec.Indexes, def)
+	}
+	return spec, nil
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// InsertStruct inserts v, encoded through encoding/json so json tags apply,
+// and returns its ID. A field tagged with the collection's ID key ("_id" by
+// default) supplies the ID; left empty, an ID is generated.
+func InsertStruct[T any](c *Collection, v T) (core.DocumentID, error) {
+	doc, err := toDocument(v)
+	if err != nil {
+		return "", err
+	}
+	return c.Insert(doc)
+}
+
+// GetStruct returns a document decoded into a T
+func GetStruct[T any](c *Collection, id core.DocumentID) (T, error) {
+	var v T
+	doc, err := c.Get(id)
+	if err != nil {
+		return v, err
+	}
+	return fromDocument[T](doc)
+}
+
+// FindStruct returns the documents matching a query decoded into Ts
+func FindStruct[T any](c *Collection, q core.Query) ([]T, error) {
+	docs, err := c.Find(q)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]T, 0, len(docs))
+	for _, doc := range docs {
+		v, err := fromDocument[T](doc)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// UpdateStruct merges v into an existing document as a JSON merge patch,
+// with core.Document.MergePatch, failing with core.ErrDocumentNotFound if
+// there is none. Keys v encodes overwrite the stored ones, nested objects
+// are merged the same way, and keys encoded as null, such as nil pointers
+// without omitempty, are removed. Keys v does not encode, such as fields the
+// struct does not declare or omitempty fields holding zero values, keep
+// their stored values. Use Update to replace a document outright.
+func UpdateStruct[T any](c *Collection, id core.DocumentID, v T) error {
+	patch, err := toDocument(v)
+	if err != nil {
+		return err
+	}
+	return c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		existing, exists := docs[id]
+		if !exists {
+			return nil, fmt.Errorf("failed to update %s/%s: %w", c.name, id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: existing.MergePatch(patch)}, nil
+	})
+}
+
+// toDocument encodes a value as a document through encoding/json
+func toDocument(v interface{}) (core.Document, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %T: %w", v, err)
+	}
+
+	var doc core.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode %T as a document: %w", v, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("failed to encode %T: not a JSON object", v)
+	}
+	return doc, nil
+}
+
+// fromDocument decodes a document into a T through encoding/json
+func fromDocument[T any](doc core.Document) (T, error) {
+	var v T
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return v, fmt.Errorf("failed to decode document: %w", err)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("failed to decode document into %T: %w", v, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// EnableTTL makes the documents of a collection expire at the time their
+// field ("" for index.DefaultExpiryField) holds, as an RFC3339 timestamp or
+// unix seconds, by building an expiration index on it. Expired documents
+// are removed by PurgeExpired or StartTTLPurge, not hidden from reads
+// before then. The index is persisted like any other, so this is needed
+// once per collection.
+func (d *DB) EnableTTL(collection, field string) error {
+	if _, err := d.Collection(collection); err != nil {
+		return err
+	}
+	if err := d.indexes.CreateExpiryIndex(collection, field); err != nil {
+		return fmt.Errorf("failed to enable TTL on %s: %w", collection, err)
+	}
+	return nil
+}
+
+// NextExpiry returns when the next document of a collection expires, and
+// false if none has an expiry. It fails with index.ErrIndexNotFound unless
+// EnableTTL was called for the collection.
+func (d *DB) NextExpiry(collection string) (time.Time, bool, error) {
+	if err := d.check(); err != nil {
+		return time.Time{}, false, err
+	}
+	return d.indexes.NextExpiry(collection)
+}
+
+// PurgeExpired deletes the documents of the collection expiring at or
+// before now in one atomic batch, returning how many it deleted. The
+// expiration index yields the due documents without visiting the others,
+// so the work beyond the write itself follows the number expiring. The
+// deletes run delete hooks and reference actions as Delete does.
+func (c *Collection) PurgeExpired(now time.Time) (int, error) {
+	if err := c.db.check(); err != nil {
+		return 0, err
+	}
+	field, err := c.db.indexes.ExpiryField(c.name)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := c.db.indexes.ExpiredIDs(c.name, now)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	purged := 0
+	err = c.apply(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		// Documents may have been deleted or given a later expiry since
+		// the index was read
+		writes := make(map[core.DocumentID]core.Document, len(ids))
+		for _, id := range ids {
+			doc, exists := docs[id]
+			if !exists {
+				continue
+			}
+			value, _ := core.GetPath(doc, field)
+			if at, ok := core.ToTime(value); ok && !at.After(now) {
+				writes[id] = nil
+			}
+		}
+		purged = len(writes)
+		return writes, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired documents of %s: %w", c.name, err)
+	}
+	return purged, nil
+}
+
+// PurgeExpired runs Collection.PurgeExpired on every collection with an
+// expiration index, returning how many documents it deleted in all. It
+// acts as SystemPrincipal, so security policies hide no expired document.
+func (d *DB) PurgeExpired(now time.Time) (int, error) {
+	names, err := d.Collections()
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	var errs []error
+	for _, name := range names {
+		at, ok, err := d.indexes.NextExpiry(name)
+		if errors.Is(err, index.ErrIndexNotFound) || (err == nil && (!ok || at.After(now))) {
+			continue
+		}
+		c, err := d.Collection(name)
+		if err == nil {
+			var n int
+			n, err = c.as(SystemPrincipal).PurgeExpired(now)
+			total += n
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// StartTTLPurge runs PurgeExpired every interval in the background until
+// the returned function is called or the database is closed. A failed
+// purge is logged to the WithLogger logger and fails the "ttl_purge"
+// health check until a purge succeeds.
+func (d *DB) StartTTLPurge(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	var mu sync.Mutex
+	var lastErr error
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				_, err := d.PurgeExpired(now)
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				if err != nil && d.opts.log != nil {
+					d.opts.log.Error("%v", err)
+				}
+				mu.Lock()
+				lastErr = err
+				mu.Unlock()
+			}
+		}
+	}()
+
+	unregister := d.RegisterHealthCheck("ttl_purge", func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastErr
+	})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			unregister()
+		})
+	}
+	d.OnClose(stop)
+	return stop
+}
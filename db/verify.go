@@ -0,0 +1,142 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// indexFileSuffix marks the index files of collections
+const indexFileSuffix = ".idx.json"
+
+// VerifyOptions configures VerifyDataDir
+type VerifyOptions struct {
+	IndexDir         string // Directory of the index files, if not the database directory
+	Repair           bool   // Fix the issues that can be fixed without losing data
+	AllowDestructive bool   // Let Repair also fix the issues that lose data
+}
+
+// VerifyDataDir audits a database directory without opening it, so it works
+// on one that fails to open. It runs the checks of storage.VerifyDataDir and
+// checks every index file against its collection. Rebuilding a stale or
+// corrupt index file from its collection, and removing the index file of a
+// collection that does not exist, are safe repairs; removing an index file
+// that does not parse loses its index definitions, so it is destructive.
+// The directory must not be open in any process while it runs.
+func VerifyDataDir(path string, opts VerifyOptions) (storage.VerifyReport, error) {
+	path = filepath.Clean(path)
+	if _, err := os.Stat(path); err != nil {
+		return storage.VerifyReport{Dir: path}, fmt.Errorf("failed to verify %s: %w", path, err)
+	}
+	indexDir := opts.IndexDir
+	if indexDir == "" {
+		indexDir = path
+	}
+
+	storageOpts := storage.VerifyOptions{Repair: opts.Repair, AllowDestructive: opts.AllowDestructive}
+	storageOpts.Collection = func(namespace, collection string, file *storage.CollectionFile) []storage.Issue {
+		idxPath := filepath.Join(namespaceDir(indexDir, namespace), collection+indexFileSuffix)
+		if _, err := os.Stat(idxPath); err != nil {
+			return nil
+		}
+		docs := make(map[core.DocumentID]core.Document, len(file.Documents))
+		for id, doc := range file.Documents {
+			docs[core.DocumentID(id)] = doc
+		}
+
+		err := index.VerifyIndexFile(idxPath, docs, file.Metadata.Revision)
+		if err == nil {
+			return nil
+		}
+		issue := storage.Issue{Severity: storage.SeverityWarning, Kind: storage.IssueCorruptIndex, Path: idxPath, Collection: collection, Message: err.Error(), Repair: storage.RepairSafe}
+		fix := func() error { return index.RebuildIndexFile(idxPath, collection, docs, file.Metadata.Revision) }
+		switch {
+		case errors.Is(err, index.ErrIndexStale):
+			issue.Severity, issue.Kind = storage.SeverityInfo, storage.IssueStaleIndex
+		case !errors.Is(err, index.ErrIndexCorrupt):
+			issue.Severity, issue.Repair = storage.SeverityError, storage.RepairNone
+		case !validJSON(idxPath):
+			// The index definitions are lost with the file
+			issue.Repair, fix = storage.RepairDestructive, func() error { return os.Remove(idxPath) }
+		}
+		return []storage.Issue{storageOpts.Fix(issue, fix)}
+	}
+
+	report, err := storage.VerifyDataDir(path, storageOpts)
+	if err != nil {
+		return report, err
+	}
+
+	namespaces := []string{""}
+	entries, _ := os.ReadDir(filepath.Join(path, storage.NamespaceDir))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			namespaces = append(namespaces, entry.Name())
+		}
+	}
+	for _, namespace := range namespaces {
+		issues, err := verifyIndexDir(namespaceDir(path, namespace), namespaceDir(indexDir, namespace), indexDir != path, storageOpts)
+		if err != nil {
+			return report, err
+		}
+		for _, issue := range issues {
+			issue.Namespace = namespace
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	return report, nil
+}
+
+// validJSON reports whether a file holds valid JSON
+func validJSON(path string) bool {
+	data, err := os.ReadFile(path)
+	return err == nil && json.Valid(data)
+}
+
+// namespaceDir returns the directory of a namespace under dir, or dir for
+// the empty namespace
+func namespaceDir(dir, namespace string) string {
+	if namespace == "" {
+		return dir
+	}
+	return filepath.Join(dir, storage.NamespaceDir, namespace)
+}
+
+// verifyIndexDir reports the index files of collections that do not exist
+// and, when the index directory is separate, its leftover temporary files
+func verifyIndexDir(dataDir, indexDir string, separate bool, opts storage.VerifyOptions) ([]storage.Issue, error) {
+	entries, err := os.ReadDir(indexDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index directory: %w", err)
+	}
+
+	var issues []storage.Issue
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(indexDir, name)
+		remove := func() error { return os.Remove(path) }
+		switch {
+		case entry.IsDir():
+		case strings.HasSuffix(name, indexFileSuffix):
+			collection := strings.TrimSuffix(name, indexFileSuffix)
+			if _, err := os.Stat(filepath.Join(dataDir, collection+".json")); errors.Is(err, os.ErrNotExist) {
+				issues = append(issues, opts.Fix(storage.Issue{Severity: storage.SeverityWarning, Kind: storage.IssueOrphanFile, Path: path,
+					Collection: collection, Message: "index file of a collection that does not exist", Repair: storage.RepairSafe}, remove))
+			}
+		case separate && strings.HasSuffix(name, ".tmp"):
+			issues = append(issues, opts.Fix(storage.Issue{Severity: storage.SeverityWarning, Kind: storage.IssueOrphanFile, Path: path,
+				Message: "temporary file of an interrupted write", Repair: storage.RepairSafe}, remove))
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrVersionConflict is returned by writes conditioned on a document's
+// version when the document is at another one
+var ErrVersionConflict = errors.New("version conflict")
+
+// Version returns the version of a document as stored: a hash of its
+// content, which changes whenever the document is written with different
+// content. Batch functions receive documents as stored, so a version read
+// with GetVersion can be checked inside a Batch to write only if the
+// document is unchanged.
+func Version(doc core.Document) string {
+	// Maps marshal with sorted keys, so equal documents hash the same
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// GetVersion returns a document by ID together with its Version, or
+// core.ErrDocumentNotFound
+func (c *Collection) GetVersion(id core.DocumentID) (core.Document, string, error) {
+	if err := c.db.check(); err != nil {
+		return nil, "", err
+	}
+	stored, err := c.coll.ReadDocument(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := c.checkVisible(id, stored); err != nil {
+		return nil, "", err
+	}
+	c.db.storage.RecordRead(c.name, id)
+	doc, err := c.db.rulesFor(c.name).readable(stored.Clone())
+	if err != nil {
+		return nil, "", err
+	}
+	return doc, Version(stored), nil
+}
@@ -0,0 +1,18 @@
+package db
+
+import (
+	"context"
+
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// Watch subscribes to the changes committed to a collection, or to every
+// collection if collection is empty, until ctx is done or the database is
+// closed. See storage.FileStorageEngine.Watch; documents are delivered as
+// stored, with encrypted fields still wrapped.
+func (d *DB) Watch(ctx context.Context, collection string, opts storage.WatchOptions) (*storage.Watcher, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	return d.storage.Watch(ctx, collection, opts)
+}
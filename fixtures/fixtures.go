@@ -0,0 +1,222 @@
+package fixtures
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// maxLineSize is the longest line of a JSONL fixture file
+const maxLineSize = 16 << 20
+
+// LoadOption configures LoadFixtures
+type LoadOption func(*loadConfig)
+
+type loadConfig struct {
+	truncate bool
+	idKey    string
+}
+
+// Truncate deletes the documents of each fixture collection before loading
+// it, so the collection holds exactly the fixture's documents
+func Truncate() LoadOption {
+	return func(c *loadConfig) {
+		c.truncate = true
+	}
+}
+
+// WithIDKey reads document IDs from key instead of core.DefaultIDKey
+func WithIDKey(key string) LoadOption {
+	return func(c *loadConfig) {
+		c.idKey = key
+	}
+}
+
+// fixtureDocument is a document of a fixture file and its ID
+type fixtureDocument struct {
+	id  core.DocumentID
+	doc core.Document
+}
+
+// LoadFixtures installs the fixture files of a directory into an engine.
+// Each <collection>.json file holds an array of documents or an object of
+// documents by ID, and each <collection>.jsonl file one document per line;
+// other files are ignored. Collections are created if missing and loaded in
+// name order, and documents in file order. A document's ID is its ID key,
+// else its object key, else <collection>-<n> for the n-th document of the
+// file, so loading the same fixtures again writes the same documents.
+func LoadFixtures(engine core.StorageEngine, dir string, opts ...LoadOption) error {
+	cfg := loadConfig{idKey: core.DefaultIDKey}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read fixture directory: %w", err)
+	}
+	files := make(map[string][]string)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".json" && ext != ".jsonl") {
+			continue
+		}
+		collection := strings.TrimSuffix(entry.Name(), ext)
+		files[collection] = append(files[collection], entry.Name())
+	}
+	collections := make([]string, 0, len(files))
+	for collection := range files {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	existing, err := engine.ListCollections()
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %w", err)
+	}
+	for _, collection := range collections {
+		var docs []fixtureDocument
+		for _, name := range files[collection] {
+			loaded, err := readFixtureFile(filepath.Join(dir, name), collection, cfg.idKey)
+			if err != nil {
+				return err
+			}
+			docs = append(docs, loaded...)
+		}
+
+		if !slices.Contains(existing, collection) {
+			if err := engine.CreateCollection(collection); err != nil {
+				return fmt.Errorf("failed to create collection %s: %w", collection, err)
+			}
+		} else if cfg.truncate {
+			if err := truncate(engine, collection); err != nil {
+				return err
+			}
+		}
+		for _, d := range docs {
+			if err := engine.WriteDocument(collection, d.id, d.doc); err != nil {
+				return fmt.Errorf("failed to write fixture document %s/%s: %w", collection, d.id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// readFixtureFile reads the documents of a fixture file
+func readFixtureFile(path, collection, idKey string) ([]fixtureDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture file: %w", err)
+	}
+
+	var docs []fixtureDocument
+	add := func(doc core.Document, key string) error {
+		id, err := fixtureID(doc, idKey, key, collection, len(docs)+1)
+		if err != nil {
+			return fmt.Errorf("invalid document %d of %s: %w", len(docs)+1, path, err)
+		}
+		docs = append(docs, fixtureDocument{id: id, doc: doc})
+		return nil
+	}
+
+	if filepath.Ext(path) == ".jsonl" {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, maxLineSize)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			var doc core.Document
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				return nil, fmt.Errorf("failed to parse line %d of %s: %w", line, path, err)
+			}
+			if err := add(doc, ""); err != nil {
+				return nil, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read fixture file: %w", err)
+		}
+		return docs, nil
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var list []core.Document
+		if err := json.Unmarshal(trimmed, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		for _, doc := range list {
+			if err := add(doc, ""); err != nil {
+				return nil, err
+			}
+		}
+		return docs, nil
+	}
+
+	var byID map[string]core.Document
+	if err := json.Unmarshal(trimmed, &byID); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	keys := make([]string, 0, len(byID))
+	for key := range byID {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := add(byID[key], key); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// fixtureID returns the ID of the n-th document of a fixture file, found
+// under key in an object of documents by ID
+func fixtureID(doc core.Document, idKey, key, collection string, n int) (core.DocumentID, error) {
+	if doc == nil {
+		return "", fmt.Errorf("not an object")
+	}
+	switch id := doc[idKey].(type) {
+	case string:
+		if id != "" {
+			return core.DocumentID(id), nil
+		}
+	case float64:
+		return core.DocumentID(strconv.FormatFloat(id, 'f', -1, 64)), nil
+	case nil:
+	default:
+		return "", fmt.Errorf("%s is neither a string nor a number", idKey)
+	}
+	if key != "" {
+		return core.DocumentID(key), nil
+	}
+	return core.DocumentID(fmt.Sprintf("%s-%d", collection, n)), nil
+}
+
+// truncate deletes every document of a collection
+func truncate(engine core.StorageEngine, collection string) error {
+	var ids []core.DocumentID
+	err := engine.ScanCollection(collection, func(id core.DocumentID, _ core.Document) bool {
+		ids = append(ids, id)
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to scan collection %s: %w", collection, err)
+	}
+	for _, id := range ids {
+		if err := engine.DeleteDocument(collection, id); err != nil {
+			return fmt.Errorf("failed to truncate collection %s: %w", collection, err)
+		}
+	}
+	return nil
+}
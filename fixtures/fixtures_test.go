@@ -0,0 +1,198 @@
+package fixtures
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// checkGolden compares output with testdata/<name>.golden, rewriting the
+// file instead with -update
+func checkGolden(t *testing.T, name string, output []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, output, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("Output differs from %s:\n%s\nexpected:\n%s", path, output, expected)
+	}
+}
+
+// memEngine is a minimal in-memory StorageEngine
+type memEngine struct {
+	collections map[string]map[core.DocumentID]core.Document
+}
+
+func newMemEngine() *memEngine {
+	return &memEngine{collections: make(map[string]map[core.DocumentID]core.Document)}
+}
+
+func (m *memEngine) WriteDocument(collection string, id core.DocumentID, doc core.Document) error {
+	m.collections[collection][id] = doc
+	return nil
+}
+
+func (m *memEngine) ReadDocument(collection string, id core.DocumentID) (core.Document, error) {
+	if doc, ok := m.collections[collection][id]; ok {
+		return doc, nil
+	}
+	return nil, core.ErrDocumentNotFound
+}
+
+func (m *memEngine) DeleteDocument(collection string, id core.DocumentID) error {
+	if _, ok := m.collections[collection][id]; !ok {
+		return core.ErrDocumentNotFound
+	}
+	delete(m.collections[collection], id)
+	return nil
+}
+
+func (m *memEngine) ScanCollection(collection string, fn func(core.DocumentID, core.Document) bool) error {
+	for id, doc := range m.collections[collection] {
+		if !fn(id, doc) {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *memEngine) CreateCollection(name string) error {
+	m.collections[name] = make(map[core.DocumentID]core.Document)
+	return nil
+}
+
+func (m *memEngine) ListCollections() ([]string, error) {
+	var names []string
+	for name := range m.collections {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *memEngine) Close() error { return nil }
+
+// dump returns the documents of an engine's collections as indented JSON
+func dump(t *testing.T, engine core.StorageEngine) []byte {
+	t.Helper()
+	names, err := engine.ListCollections()
+	if err != nil {
+		t.Fatalf("Failed to list collections: %v", err)
+	}
+	sort.Strings(names)
+	all := make(map[string]map[core.DocumentID]core.Document)
+	for _, name := range names {
+		all[name] = make(map[core.DocumentID]core.Document)
+		engine.ScanCollection(name, func(id core.DocumentID, doc core.Document) bool {
+			all[name][id] = doc
+			return true
+		})
+	}
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal collections: %v", err)
+	}
+	return append(data, '\n')
+}
+
+// engines returns an engine of each implementation LoadFixtures is tested
+// against
+func engines(t *testing.T) map[string]core.StorageEngine {
+	engine, err := storage.NewFileStorageEngine(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	return map[string]core.StorageEngine{"file": engine, "memory": newMemEngine()}
+}
+
+func TestLoadFixtures(t *testing.T) {
+	for name, engine := range engines(t) {
+		t.Run(name, func(t *testing.T) {
+			// Loading again writes the same documents
+			for i := 0; i < 2; i++ {
+				if err := LoadFixtures(engine, "testdata/load"); err != nil {
+					t.Fatalf("Failed to load fixtures: %v", err)
+				}
+				checkGolden(t, "load", dump(t, engine))
+			}
+		})
+	}
+}
+
+func TestLoadFixturesTruncate(t *testing.T) {
+	for name, engine := range engines(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := LoadFixtures(engine, "testdata/load"); err != nil {
+				t.Fatalf("Failed to load fixtures: %v", err)
+			}
+			engine.WriteDocument("users", "extra", core.Document{"name": "Extra"})
+
+			if err := LoadFixtures(engine, "testdata/load"); err != nil {
+				t.Fatalf("Failed to load fixtures: %v", err)
+			}
+			if _, err := engine.ReadDocument("users", "extra"); err != nil {
+				t.Errorf("Expected a document outside the fixtures to be kept, got %v", err)
+			}
+
+			if err := LoadFixtures(engine, "testdata/load", Truncate()); err != nil {
+				t.Fatalf("Failed to load fixtures: %v", err)
+			}
+			if _, err := engine.ReadDocument("users", "extra"); err == nil {
+				t.Errorf("Expected truncation to delete a document outside the fixtures")
+			}
+			checkGolden(t, "load", dump(t, engine))
+		})
+	}
+}
+
+func TestLoadFixturesIDKey(t *testing.T) {
+	engine := newMemEngine()
+	if err := LoadFixtures(engine, "testdata/load", WithIDKey("user")); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	if _, err := engine.ReadDocument("orders", "grace"); err != nil {
+		t.Errorf("Expected orders under their user, got %v", err)
+	}
+}
+
+func TestLoadFixturesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"malformed json", "a.json", `[{"x": 1}`},
+		{"malformed line", "a.jsonl", "{\"x\": 1}\nnope\n"},
+		{"non-object document", "a.json", `[1, 2]`},
+		{"invalid id", "a.jsonl", `{"_id": true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			os.WriteFile(filepath.Join(dir, tt.file), []byte(tt.content), 0644)
+			if err := LoadFixtures(newMemEngine(), dir); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+	if err := LoadFixtures(newMemEngine(), "testdata/missing"); err == nil {
+		t.Errorf("Expected an error for a missing directory")
+	}
+}
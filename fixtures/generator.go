@@ -0,0 +1,304 @@
+package fixtures
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrInvalidTemplate is returned by NewGenerator for a template with a
+// malformed placeholder
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// Generator produces documents from a template. String values of the
+// template may hold placeholders, expanded afresh for each document:
+//
+//	{{seq}}              the document's number, from 1
+//	{{uuid}}             a random version 4 UUID
+//	{{randInt 1 100}}    a random integer between the bounds, inclusive
+//	{{oneof "a" "b"}}    one of the JSON scalars given, at random
+//
+// A string that is a single placeholder becomes the placeholder's value,
+// so "{{randInt 1 100}}" gives a number; placeholders within other text are
+// formatted into it. Keys are not expanded. A Generator is deterministic
+// for a seed and is not safe for concurrent use.
+type Generator struct {
+	template interface{}
+	rng      *rand.Rand
+	seq      int
+}
+
+// placeholder is a parsed {{...}} of a template
+type placeholder struct {
+	fn   string
+	args []interface{}
+}
+
+// templateObject is a template object, its keys sorted so placeholders
+// draw from the generator's source in a fixed order
+type templateObject struct {
+	keys   []string
+	values []interface{}
+}
+
+// templateString is a template string with placeholders, alternating
+// literal text and placeholders
+type templateString struct {
+	parts []interface{} // string or placeholder
+}
+
+// NewGenerator parses a template for generating documents seeded by seed
+func NewGenerator(template core.Document, seed uint64) (*Generator, error) {
+	compiled, err := compileValue(map[string]interface{}(template))
+	if err != nil {
+		return nil, err
+	}
+	return &Generator{template: compiled, rng: rand.New(rand.NewPCG(seed, seed))}, nil
+}
+
+// Next returns the next document
+func (g *Generator) Next() core.Document {
+	g.seq++
+	return core.Document(g.expand(g.template).(map[string]interface{}))
+}
+
+// Generate returns the next n documents
+func (g *Generator) Generate(n int) []core.Document {
+	docs := make([]core.Document, n)
+	for i := range docs {
+		docs[i] = g.Next()
+	}
+	return docs
+}
+
+// compileValue parses the placeholders of a template value
+func compileValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case core.Document:
+		return compileValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := templateObject{keys: make([]string, 0, len(v))}
+		for key := range v {
+			out.keys = append(out.keys, key)
+		}
+		sort.Strings(out.keys)
+		for _, key := range out.keys {
+			compiled, err := compileValue(v[key])
+			if err != nil {
+				return nil, err
+			}
+			out.values = append(out.values, compiled)
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			compiled, err := compileValue(element)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = compiled
+		}
+		return out, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		return compileString(v)
+	}
+	return value, nil
+}
+
+// compileString parses a string holding placeholders
+func compileString(s string) (interface{}, error) {
+	var t templateString
+	for rest := s; rest != ""; {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			t.parts = append(t.parts, rest)
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unterminated placeholder in %q", ErrInvalidTemplate, s)
+		}
+		p, err := parsePlaceholder(rest[start+2 : start+end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v in %q", ErrInvalidTemplate, err, s)
+		}
+		if start > 0 {
+			t.parts = append(t.parts, rest[:start])
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[start+end+2:]
+	}
+	if len(t.parts) == 1 {
+		if p, ok := t.parts[0].(placeholder); ok {
+			return p, nil
+		}
+	}
+	return t, nil
+}
+
+// parsePlaceholder parses the inside of a placeholder, a function name
+// followed by JSON arguments
+func parsePlaceholder(s string) (placeholder, error) {
+	tokens, err := splitArgs(s)
+	if err != nil {
+		return placeholder{}, err
+	}
+	if len(tokens) == 0 {
+		return placeholder{}, fmt.Errorf("empty placeholder")
+	}
+	p := placeholder{fn: tokens[0]}
+	for _, token := range tokens[1:] {
+		var arg interface{}
+		if err := json.Unmarshal([]byte(token), &arg); err != nil {
+			return placeholder{}, fmt.Errorf("invalid argument %s of %s", token, p.fn)
+		}
+		p.args = append(p.args, arg)
+	}
+
+	switch p.fn {
+	case "seq", "uuid":
+		if len(p.args) != 0 {
+			return placeholder{}, fmt.Errorf("%s takes no arguments", p.fn)
+		}
+	case "randInt":
+		if len(p.args) != 2 {
+			return placeholder{}, fmt.Errorf("randInt takes a minimum and a maximum")
+		}
+		lo, ok1 := p.args[0].(float64)
+		hi, ok2 := p.args[1].(float64)
+		if !ok1 || !ok2 || lo != float64(int64(lo)) || hi != float64(int64(hi)) || lo > hi {
+			return placeholder{}, fmt.Errorf("randInt bounds must be integers, the minimum first")
+		}
+	case "oneof":
+		if len(p.args) == 0 {
+			return placeholder{}, fmt.Errorf("oneof takes at least one value")
+		}
+		for _, arg := range p.args {
+			switch arg.(type) {
+			case map[string]interface{}, []interface{}:
+				return placeholder{}, fmt.Errorf("oneof takes strings, numbers, booleans or null")
+			}
+		}
+	default:
+		return placeholder{}, fmt.Errorf("unknown function %s", p.fn)
+	}
+	return p, nil
+}
+
+// splitArgs splits a placeholder into space-separated tokens, keeping
+// quoted strings whole
+func splitArgs(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch {
+		case s[i] == ' ' || s[i] == '\t':
+			i++
+		case s[i] == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, s[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && s[j] != ' ' && s[j] != '\t' {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// expand returns a value of the template with its placeholders expanded
+func (g *Generator) expand(value interface{}) interface{} {
+	switch v := value.(type) {
+	case templateObject:
+		out := make(map[string]interface{}, len(v.keys))
+		for i, key := range v.keys {
+			out[key] = g.expand(v.values[i])
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			out[i] = g.expand(element)
+		}
+		return out
+	case placeholder:
+		return g.eval(v)
+	case templateString:
+		var b strings.Builder
+		for _, part := range v.parts {
+			if p, ok := part.(placeholder); ok {
+				b.WriteString(format(g.eval(p)))
+			} else {
+				b.WriteString(part.(string))
+			}
+		}
+		return b.String()
+	}
+	return value
+}
+
+// eval returns the value of a placeholder
+func (g *Generator) eval(p placeholder) interface{} {
+	switch p.fn {
+	case "seq":
+		return float64(g.seq)
+	case "uuid":
+		return g.uuid()
+	case "randInt":
+		lo, hi := int64(p.args[0].(float64)), int64(p.args[1].(float64))
+		return float64(lo + g.rng.Int64N(hi-lo+1))
+	default: // oneof
+		return p.args[g.rng.IntN(len(p.args))]
+	}
+}
+
+// uuid returns a version 4 UUID drawn from the generator's source
+func (g *Generator) uuid() string {
+	var b [16]byte
+	for i := 0; i < len(b); i += 8 {
+		n := g.rng.Uint64()
+		for j := 0; j < 8; j++ {
+			b[i+j] = byte(n >> (8 * j))
+		}
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
+
+// format formats a placeholder's value within text
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
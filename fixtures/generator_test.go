@@ -0,0 +1,91 @@
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// loadTemplate reads testdata/template.json
+func loadTemplate(t *testing.T) core.Document {
+	t.Helper()
+	data, err := os.ReadFile("testdata/template.json")
+	if err != nil {
+		t.Fatalf("Failed to read template: %v", err)
+	}
+	var template core.Document
+	if err := json.Unmarshal(data, &template); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	return template
+}
+
+func TestGenerator(t *testing.T) {
+	g, err := NewGenerator(loadTemplate(t), 1)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+	data, err := json.MarshalIndent(g.Generate(5), "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal documents: %v", err)
+	}
+	checkGolden(t, "generate", append(data, '\n'))
+
+	// A seed always gives the same documents, and another seed others
+	again, _ := NewGenerator(loadTemplate(t), 1)
+	other, _ := NewGenerator(loadTemplate(t), 2)
+	first, second, third := again.Generate(20), g.Generate(0), other.Generate(20)
+	if len(second) != 0 {
+		t.Errorf("Expected no documents, got %d", len(second))
+	}
+	fresh, _ := NewGenerator(loadTemplate(t), 1)
+	if !reflect.DeepEqual(first, fresh.Generate(20)) || reflect.DeepEqual(first, third) {
+		t.Errorf("Expected documents determined by the seed")
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for i, doc := range first {
+		if doc["n"] != float64(i+1) || doc["_id"] != fmt.Sprintf("user-%d", i+1) {
+			t.Errorf("Expected document %d numbered, got %v and %v", i+1, doc["n"], doc["_id"])
+		}
+		if age := doc["age"].(float64); age < 18 || age > 90 {
+			t.Errorf("Expected an age between 18 and 90, got %v", age)
+		}
+		if !uuid.MatchString(doc["token"].(string)) {
+			t.Errorf("Expected a version 4 UUID, got %v", doc["token"])
+		}
+		if _, ok := doc["active"].(bool); !ok {
+			t.Errorf("Expected a boolean, got %v", doc["active"])
+		}
+	}
+}
+
+func TestGeneratorErrors(t *testing.T) {
+	tests := []string{
+		"{{seq",
+		"{{}}",
+		"{{seq 1}}",
+		"{{nope}}",
+		"{{randInt 1}}",
+		"{{randInt 5 1}}",
+		"{{randInt 1.5 3}}",
+		"{{oneof}}",
+		`{{oneof "a}}`,
+		"{{oneof [1]}}",
+		"{{oneof bare}}",
+	}
+	for _, tt := range tests {
+		t.Run(tt, func(t *testing.T) {
+			template := core.Document{"nested": []interface{}{map[string]interface{}{"x": tt}}}
+			if _, err := NewGenerator(template, 1); !errors.Is(err, ErrInvalidTemplate) {
+				t.Errorf("Expected ErrInvalidTemplate, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+	"github.com/HakashiKatake/Go-Json-Database/txn"
+)
+
+var (
+	// errInvalidArgument is wrapped by errors in the request itself
+	errInvalidArgument = errors.New("invalid argument")
+	// errCollectionExists is returned when creating a collection that exists
+	errCollectionExists = errors.New("collection already exists")
+)
+
+// errorCodes maps errors to status codes, the first match winning
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{errInvalidArgument, codes.InvalidArgument},
+	{db.ErrEncryptedField, codes.InvalidArgument},
+	{schema.ErrSchemaValidation, codes.InvalidArgument},
+	{core.ErrDocumentNotFound, codes.NotFound},
+	{db.ErrCollectionNotFound, codes.NotFound},
+	{storage.ErrNamespaceNotFound, codes.NotFound},
+	{core.ErrDocumentExists, codes.AlreadyExists},
+	{core.ErrIDCollision, codes.AlreadyExists},
+	{errCollectionExists, codes.AlreadyExists},
+	{index.ErrUniqueConstraintViolation, codes.AlreadyExists},
+	{db.ErrVersionConflict, codes.FailedPrecondition},
+	{db.ErrReferenceViolation, codes.FailedPrecondition},
+	{txn.ErrTxnConflict, codes.Aborted},
+	{storage.ErrReadOnly, codes.PermissionDenied},
+	{db.ErrPolicyViolation, codes.PermissionDenied},
+	{db.ErrNoPrincipal, codes.PermissionDenied},
+	{storage.ErrWatcherDropped, codes.ResourceExhausted},
+	{db.ErrClosed, codes.Unavailable},
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+
+// toStatus converts an error into a status error with the matching code
+func toStatus(err error) error {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return status.Error(e.code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,303 @@
+package grpcserver
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative database.proto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// server implements the Database service on a database
+type server struct {
+	UnimplementedDatabaseServer
+	db *db.DB
+}
+
+// NewServer returns the Database service of a database, to be registered on
+// a grpc.Server with RegisterDatabaseServer. Errors are returned with the
+// status code matching them: NOT_FOUND for missing documents and
+// collections, ALREADY_EXISTS for conflicts and FAILED_PRECONDITION when a
+// document is not at the version a write expects.
+func NewServer(d *db.DB) DatabaseServer {
+	return &server{db: d}
+}
+
+// ListCollections returns the names of the collections
+func (s *server) ListCollections(ctx context.Context, req *ListCollectionsRequest) (*ListCollectionsResponse, error) {
+	names, err := s.db.Collections()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &ListCollectionsResponse{Collections: names}, nil
+}
+
+// CreateCollection creates a collection, failing if it exists
+func (s *server) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*CreateCollectionResponse, error) {
+	names, err := s.db.Collections()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if slices.Contains(names, req.Name) {
+		return nil, toStatus(fmt.Errorf("%w: %s", errCollectionExists, req.Name))
+	}
+	if _, err := s.db.CreateCollection(req.Name); err != nil {
+		return nil, toStatus(err)
+	}
+	return &CreateCollectionResponse{Name: req.Name}, nil
+}
+
+// GetDocument reads a document with its version
+func (s *server) GetDocument(ctx context.Context, req *GetDocumentRequest) (*Document, error) {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return readDocument(c, core.DocumentID(req.Id))
+}
+
+// PutDocument stores a document under its ID, conditionally on its version
+func (s *server) PutDocument(ctx context.Context, req *PutDocumentRequest) (*Document, error) {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	doc := core.Document(req.Document.AsMap())
+
+	id := core.DocumentID(req.Id)
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		current, exists := docs[id]
+		if err := checkVersion(req.IfMatch, req.IfNoneMatch, current, exists); err != nil {
+			return nil, err
+		}
+		return map[core.DocumentID]core.Document{id: doc}, nil
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return readDocument(c, id)
+}
+
+// PatchDocument merges a JSON merge patch into a document, conditionally on
+// its version
+func (s *server) PatchDocument(ctx context.Context, req *PatchDocumentRequest) (*Document, error) {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	patch := req.Patch.AsMap()
+
+	id := core.DocumentID(req.Id)
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		doc, exists := docs[id]
+		if err := checkVersion(req.IfMatch, false, doc, exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("failed to patch %s/%s: %w", c.Name(), id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: doc.MergePatch(patch)}, nil
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return readDocument(c, id)
+}
+
+// DeleteDocument deletes a document, conditionally on its version
+func (s *server) DeleteDocument(ctx context.Context, req *DeleteDocumentRequest) (*DeleteDocumentResponse, error) {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	id := core.DocumentID(req.Id)
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		doc, exists := docs[id]
+		if err := checkVersion(req.IfMatch, false, doc, exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("failed to delete %s/%s: %w", c.Name(), id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: nil}, nil
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &DeleteDocumentResponse{}, nil
+}
+
+// Query streams the documents matching a query as they are found, stopping
+// as soon as the client cancels
+func (s *server) Query(req *QueryRequest, stream grpc.ServerStreamingServer[Document]) error {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return toStatus(err)
+	}
+	q, err := parseQuery(c.Name(), req)
+	if err != nil {
+		return toStatus(err)
+	}
+
+	cur, err := c.Iter(q)
+	if err != nil {
+		return toStatus(err)
+	}
+	defer cur.Close()
+
+	ctx := stream.Context()
+	for cur.Next() {
+		if err := ctx.Err(); err != nil {
+			return toStatus(err)
+		}
+		id, doc := cur.Doc()
+		fields, err := toStruct(doc)
+		if err != nil {
+			return toStatus(err)
+		}
+		if err := stream.Send(&Document{Id: string(id), Fields: fields}); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return toStatus(err)
+	}
+	return nil
+}
+
+// Watch streams the changes committed to a collection until the client
+// cancels, sending headers once subscribed. A client too slow to keep up
+// gets RESOURCE_EXHAUSTED.
+func (s *server) Watch(req *WatchRequest, stream grpc.ServerStreamingServer[ChangeEvent]) error {
+	c, err := s.db.Collection(req.Collection)
+	if err != nil {
+		return toStatus(err)
+	}
+	// Changes are streamed from the oplog, which security policies do not
+	// filter
+	if s.db.HasPolicy(c.Name()) {
+		return toStatus(fmt.Errorf("%w: unable to watch %s, which has a security policy", db.ErrNoPrincipal, c.Name()))
+	}
+	watcher, err := s.db.Watch(stream.Context(), c.Name(), storage.WatchOptions{AfterSeq: req.AfterSeq})
+	if err != nil {
+		return toStatus(err)
+	}
+	// Headers tell the client the watch is established
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for entry := range watcher.C {
+		event := &ChangeEvent{
+			Operation: operations[entry.Op],
+			Seq:       entry.Seq,
+			Id:        string(entry.DocID),
+		}
+		if entry.Document != nil {
+			if event.Document, err = toStruct(entry.Document); err != nil {
+				return toStatus(err)
+			}
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+	if err := watcher.Err(); err != nil {
+		return toStatus(err)
+	}
+	return toStatus(db.ErrClosed)
+}
+
+// operations maps operations to their change event operation
+var operations = map[core.OperationType]ChangeEvent_Operation{
+	core.OpInsert: ChangeEvent_INSERT,
+	core.OpUpdate: ChangeEvent_UPDATE,
+	core.OpDelete: ChangeEvent_DELETE,
+}
+
+// checkVersion fails with db.ErrVersionConflict unless a document is at the
+// version ifMatch expects, if set, and does not exist when ifNoneMatch is
+func checkVersion(ifMatch string, ifNoneMatch bool, current core.Document, exists bool) error {
+	if ifMatch != "" {
+		if !exists {
+			return fmt.Errorf("%w: document does not exist", db.ErrVersionConflict)
+		}
+		if version := db.Version(current); version != ifMatch {
+			return fmt.Errorf("%w: document is at %s", db.ErrVersionConflict, version)
+		}
+	}
+	if ifNoneMatch && exists {
+		return fmt.Errorf("%w: document exists", db.ErrVersionConflict)
+	}
+	return nil
+}
+
+// parseQuery builds the query of a request, its filter in the
+// query.ParseFilter syntax
+func parseQuery(collection string, req *QueryRequest) (core.Query, error) {
+	q := core.Query{Collection: collection}
+	if req.Filter != nil {
+		filter, err := protojson.Marshal(req.Filter)
+		if err != nil {
+			return core.Query{}, fmt.Errorf("%w: %w", errInvalidArgument, err)
+		}
+		data, _ := json.Marshal(map[string]json.RawMessage{"filter": filter})
+		if q, err = query.ParseQuery(collection, data); err != nil {
+			return core.Query{}, fmt.Errorf("%w: %w", errInvalidArgument, err)
+		}
+	}
+
+	for _, key := range req.Sort {
+		option := core.SortOption{Field: key.Field, Descending: key.Descending}
+		if q.Sort == nil {
+			q.Sort = &option
+		} else {
+			q.SortBy = append(q.SortBy, option)
+		}
+	}
+	q.Limit, q.Offset = int(req.Limit), int(req.Skip)
+	q.Projection, q.Exclude = req.Projection, req.Exclude
+	if len(q.Projection) > 0 && len(q.Exclude) > 0 {
+		return core.Query{}, fmt.Errorf("%w: projection cannot be combined with exclude", errInvalidArgument)
+	}
+	return q, nil
+}
+
+// readDocument reads a document with its version
+func readDocument(c *db.Collection, id core.DocumentID) (*Document, error) {
+	doc, version, err := c.GetVersion(id)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	fields, err := toStruct(doc)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &Document{Id: string(id), Fields: fields, Version: version}, nil
+}
+
+// toStruct converts a document through its JSON encoding, so any value
+// encoding/json accepts converts
+func toStruct(doc core.Document) (*structpb.Struct, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	s := &structpb.Struct{}
+	if err := protojson.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to encode document: %w", err)
+	}
+	return s, nil
+}
@@ -0,0 +1,319 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// setupTestClient serves a database over an in-memory connection and
+// returns a client of it. Options are added to the grpc.Server.
+func setupTestClient(t *testing.T, database *db.DB, opts ...grpc.ServerOption) DatabaseClient {
+	t.Helper()
+	l := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	RegisterDatabaseServer(srv, NewServer(database))
+	go srv.Serve(l)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return l.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+		database.Close()
+	})
+	return NewDatabaseClient(conn)
+}
+
+// openDB opens a database in a temporary directory
+func openDB(t *testing.T, opts ...db.Option) *db.DB {
+	t.Helper()
+	database, err := db.Open(t.TempDir(), append([]db.Option{db.WithAutoCreate(false)}, opts...)...)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return database
+}
+
+// newStruct converts a map for a request, failing the test if it cannot
+func newStruct(t *testing.T, m map[string]interface{}) *structpb.Struct {
+	t.Helper()
+	s, err := structpb.NewStruct(m)
+	if err != nil {
+		t.Fatalf("Failed to create struct: %v", err)
+	}
+	return s
+}
+
+func TestDocumentRPCs(t *testing.T) {
+	client := setupTestClient(t, openDB(t))
+	ctx := context.Background()
+
+	if _, err := client.CreateCollection(ctx, &CreateCollectionRequest{Name: "users"}); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	created, err := client.PutDocument(ctx, &PutDocumentRequest{
+		Collection:  "users",
+		Id:          "ada",
+		Document:    newStruct(t, map[string]interface{}{"name": "Ada", "age": 36}),
+		IfNoneMatch: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to put document: %v", err)
+	}
+	if created.Id != "ada" || created.Version == "" || created.Fields.Fields["name"].GetStringValue() != "Ada" {
+		t.Fatalf("Unexpected document: %v", created)
+	}
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+		code codes.Code
+	}{
+		{"get", func() (interface{}, error) {
+			return client.GetDocument(ctx, &GetDocumentRequest{Collection: "users", Id: "ada"})
+		}, codes.OK},
+		{"list collections", func() (interface{}, error) {
+			return client.ListCollections(ctx, &ListCollectionsRequest{})
+		}, codes.OK},
+		{"create existing collection", func() (interface{}, error) {
+			return client.CreateCollection(ctx, &CreateCollectionRequest{Name: "users"})
+		}, codes.AlreadyExists},
+		{"create-only put on existing", func() (interface{}, error) {
+			return client.PutDocument(ctx, &PutDocumentRequest{Collection: "users", Id: "ada", Document: newStruct(t, nil), IfNoneMatch: true})
+		}, codes.FailedPrecondition},
+		{"stale put", func() (interface{}, error) {
+			return client.PutDocument(ctx, &PutDocumentRequest{Collection: "users", Id: "ada", Document: newStruct(t, nil), IfMatch: "stale"})
+		}, codes.FailedPrecondition},
+		{"stale patch", func() (interface{}, error) {
+			return client.PatchDocument(ctx, &PatchDocumentRequest{Collection: "users", Id: "ada", Patch: newStruct(t, nil), IfMatch: "stale"})
+		}, codes.FailedPrecondition},
+		{"stale delete", func() (interface{}, error) {
+			return client.DeleteDocument(ctx, &DeleteDocumentRequest{Collection: "users", Id: "ada", IfMatch: "stale"})
+		}, codes.FailedPrecondition},
+		{"patch", func() (interface{}, error) {
+			return client.PatchDocument(ctx, &PatchDocumentRequest{
+				Collection: "users",
+				Id:         "ada",
+				Patch:      newStruct(t, map[string]interface{}{"age": nil, "city": "London"}),
+				IfMatch:    created.Version,
+			})
+		}, codes.OK},
+		{"patch missing", func() (interface{}, error) {
+			return client.PatchDocument(ctx, &PatchDocumentRequest{Collection: "users", Id: "nobody", Patch: newStruct(t, nil)})
+		}, codes.NotFound},
+		{"get missing", func() (interface{}, error) {
+			return client.GetDocument(ctx, &GetDocumentRequest{Collection: "users", Id: "nobody"})
+		}, codes.NotFound},
+		{"missing collection", func() (interface{}, error) {
+			return client.GetDocument(ctx, &GetDocumentRequest{Collection: "ghosts", Id: "g1"})
+		}, codes.NotFound},
+		{"delete", func() (interface{}, error) {
+			return client.DeleteDocument(ctx, &DeleteDocumentRequest{Collection: "users", Id: "ada"})
+		}, codes.OK},
+		{"delete missing", func() (interface{}, error) {
+			return client.DeleteDocument(ctx, &DeleteDocumentRequest{Collection: "users", Id: "ada"})
+		}, codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.call()
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("Expected %v, got %v", tt.code, err)
+			}
+			if tt.name == "patch" {
+				doc := resp.(*Document)
+				if _, hasAge := doc.Fields.Fields["age"]; hasAge || doc.Fields.Fields["city"].GetStringValue() != "London" {
+					t.Errorf("Expected the patch to be merged, got %v", doc.Fields)
+				}
+			}
+		})
+	}
+}
+
+// receiveAll reads a stream to its end
+func receiveAll[T any](t *testing.T, stream grpc.ServerStreamingClient[T]) ([]*T, error) {
+	t.Helper()
+	var out []*T
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, msg)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	database := openDB(t)
+	users, _ := database.CreateCollection("users")
+	for i, name := range []string{"Ada", "Grace", "Alan", "Edsger"} {
+		users.Insert(core.Document{"_id": fmt.Sprintf("u%d", i), "name": name, "age": 30 + i*5})
+	}
+	client := setupTestClient(t, database)
+
+	stream, err := client.Query(context.Background(), &QueryRequest{
+		Collection: "users",
+		Filter:     newStruct(t, map[string]interface{}{"age": map[string]interface{}{"$gte": 35}}),
+		Sort:       []*SortKey{{Field: "age", Descending: true}},
+		Limit:      2,
+		Projection: []string{"name"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	docs, err := receiveAll(t, stream)
+	if err != nil {
+		t.Fatalf("Failed to receive results: %v", err)
+	}
+	if len(docs) != 2 || docs[0].Id != "u3" || docs[1].Id != "u2" {
+		t.Fatalf("Expected u3 and u2, got %v", docs)
+	}
+	if _, hasAge := docs[0].Fields.Fields["age"]; hasAge || docs[0].Fields.Fields["name"].GetStringValue() != "Edsger" {
+		t.Errorf("Expected the projection to apply, got %v", docs[0].Fields)
+	}
+
+	invalid := []*QueryRequest{
+		{Collection: "users", Filter: newStruct(t, map[string]interface{}{"age": map[string]interface{}{"$bogus": 1}})},
+		{Collection: "users", Projection: []string{"name"}, Exclude: []string{"age"}},
+	}
+	for _, req := range invalid {
+		stream, err := client.Query(context.Background(), req)
+		if err == nil {
+			_, err = receiveAll(t, stream)
+		}
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Expected %v to be invalid, got %v", req, err)
+		}
+	}
+}
+
+func TestQueryStopsOnCancel(t *testing.T) {
+	database := openDB(t)
+	items, _ := database.CreateCollection("items")
+	items.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document)
+		for i := 0; i < 5000; i++ {
+			writes[core.DocumentID(fmt.Sprintf("i%d", i))] = core.Document{"n": i, "pad": "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"}
+		}
+		return writes, nil
+	})
+
+	returned := make(chan error, 1)
+	client := setupTestClient(t, database, grpc.StreamInterceptor(
+		func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			err := handler(srv, ss)
+			returned <- err
+			return err
+		}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Query(ctx, &QueryRequest{Collection: "items"})
+	if err != nil {
+		t.Fatalf("Failed to query: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Failed to receive the first result: %v", err)
+	}
+	cancel()
+
+	select {
+	case err := <-returned:
+		if err == nil {
+			t.Errorf("Expected the query to be interrupted")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Expected the query to stop after cancellation")
+	}
+	if _, err := items.Insert(core.Document{"n": -1}); err != nil {
+		t.Errorf("Expected writes to proceed after the query stopped: %v", err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	database := openDB(t, db.WithOplog())
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"_id": "ada", "name": "Ada"})
+	client := setupTestClient(t, database)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := client.Watch(ctx, &WatchRequest{Collection: "users", AfterSeq: 0})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	// The stream is open once the server sends headers
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	users.Update("ada", core.Document{"_id": "ada", "name": "Ada Lovelace"})
+	users.Delete("ada")
+
+	expected := []struct {
+		op  ChangeEvent_Operation
+		seq uint64
+	}{{ChangeEvent_UPDATE, 2}, {ChangeEvent_DELETE, 3}}
+	for _, exp := range expected {
+		event, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Failed to receive change: %v", err)
+		}
+		if event.Operation != exp.op || event.Seq != exp.seq || event.Id != "ada" {
+			t.Errorf("Expected %v at %d, got %v", exp.op, exp.seq, event)
+		}
+	}
+
+	// Resuming replays the missed changes
+	resumed, err := client.Watch(ctx, &WatchRequest{Collection: "users", AfterSeq: 1})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	event, err := resumed.Recv()
+	if err != nil || event.Seq != 2 || event.Document.Fields["name"].GetStringValue() != "Ada Lovelace" {
+		t.Errorf("Expected the update to be replayed, got %v, %v", event, err)
+	}
+}
+
+func TestWatchRefusesSecuredCollections(t *testing.T) {
+	database := openDB(t, db.WithOplog())
+	orders, _ := database.CreateCollection("orders")
+	orders.Insert(core.Document{"_id": "a1", "tenant_id": "acme"})
+	database.RegisterPolicy("orders", func(p db.Principal) core.FilterNode {
+		return core.Leaf(core.Filter{Field: "tenant_id", Operator: core.OpEqual, Value: p.Attributes["tenant_id"]})
+	})
+	client := setupTestClient(t, database)
+
+	stream, err := client.Watch(context.Background(), &WatchRequest{Collection: "orders"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied watching a collection with a security policy, got %v", err)
+	}
+	if _, err := client.GetDocument(context.Background(), &GetDocumentRequest{Collection: "orders", Id: "a1"}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Expected PermissionDenied getting without a principal, got %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package index
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// batchApplier is implemented by storage engines that can apply several
+// writes to a collection atomically (FileStorageEngine does)
+type batchApplier interface {
+	ApplyBatchContext(ctx context.Context, collection string, fn core.BatchFunc) error
+}
+
+// idFieldSyncer is implemented by storage engines that keep an ID field in
+// documents in step with their IDs (FileStorageEngine does)
+type idFieldSyncer interface {
+	SyncIDFields(collection string, writes map[core.DocumentID]core.Document) error
+}
+
+// syncIDFields has the storage engine, if it keeps ID fields, update the
+// documents of a batch before they are indexed, so the indexes hold them as
+// stored
+func (m *FileIndexManager) syncIDFields(collection string, writes map[core.DocumentID]core.Document) error {
+	if syncer, ok := m.storage.(idFieldSyncer); ok {
+		return syncer.SyncIDFields(collection, writes)
+	}
+	return nil
+}
+
+// ApplyBatch applies a batch of writes through to storage and updates the
+// indexes, holding the index lock across both. A batch that would leave a
+// unique index with duplicate values fails with ErrUniqueConstraintViolation
+// and leaves storage untouched.
+func (m *FileIndexManager) ApplyBatch(collection string, fn core.BatchFunc) error {
+	return m.ApplyBatchContext(context.Background(), collection, fn)
+}
+
+// ApplyBatchContext is ApplyBatch passing ctx through to storage
+func (m *FileIndexManager) ApplyBatchContext(ctx context.Context, collection string, fn core.BatchFunc) error {
+	batcher, ok := m.storage.(batchApplier)
+	if !ok {
+		return fmt.Errorf("storage engine does not support batch writes")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx, indexed := m.indexes[collection]
+	var undo map[core.DocumentID]core.Document
+	revisions := make(map[string]core.RevisionChange, 1)
+	err := batcher.ApplyBatchContext(core.WithRevisions(ctx, revisions), collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes, err := fn(docs)
+		if err != nil || !indexed {
+			return writes, err
+		}
+		if err := m.syncIDFields(collection, writes); err != nil {
+			return nil, err
+		}
+
+		undo = idx.applyBatch(writes)
+		if err := idx.checkBatchUnique(collection); err != nil {
+			idx.applyBatch(undo)
+			undo = nil
+			return nil, err
+		}
+		return writes, nil
+	})
+	if err != nil {
+		if undo != nil {
+			idx.applyBatch(undo)
+		}
+		return err
+	}
+
+	if indexed {
+		idx.advanceRevision(revisions[collection])
+	}
+	return nil
+}
+
+// applyBatch applies writes to the indexes, a nil document deleting, and
+// returns the writes that restore the previous state. Callers must hold m.mu.
+func (idx *collectionIndexes) applyBatch(writes map[core.DocumentID]core.Document) map[core.DocumentID]core.Document {
+	undo := make(map[core.DocumentID]core.Document, len(writes))
+	for docID, doc := range writes {
+		undo[docID] = idx.primary[docID]
+		if doc == nil {
+			idx.apply(docID, nil, core.OpDelete)
+		} else {
+			idx.apply(docID, doc, core.OpUpdate)
+		}
+	}
+	return undo
+}
+
+// checkBatchUnique verifies that no unique index holds a duplicate value.
+// Callers must hold m.mu.
+func (idx *collectionIndexes) checkBatchUnique(collection string) error {
+	for name, fi := range idx.secondary {
+		h, ok := fi.(*hashIndex)
+		if !ok || !h.unique {
+			continue
+		}
+		if key, ids, dup := h.duplicate(); dup {
+			return fmt.Errorf("%w: %s.%s value %s is held by %v", ErrUniqueConstraintViolation, collection, name, key, ids)
+		}
+	}
+	return nil
+}
+
+// multiBatchApplier is implemented by storage engines that can apply writes
+// to several collections atomically (FileStorageEngine does)
+type multiBatchApplier interface {
+	ApplyMultiBatchContext(ctx context.Context, collections []string, fn core.MultiBatchFunc) error
+}
+
+// ApplyMultiBatch is ApplyBatch across several collections. A unique index
+// violation in any collection fails the whole batch and leaves storage
+// untouched.
+func (m *FileIndexManager) ApplyMultiBatch(collections []string, fn core.MultiBatchFunc) error {
+	return m.ApplyMultiBatchContext(context.Background(), collections, fn)
+}
+
+// ApplyMultiBatchContext is ApplyMultiBatch giving up while waiting for the
+// index or storage locks once ctx is done
+func (m *FileIndexManager) ApplyMultiBatchContext(ctx context.Context, collections []string, fn core.MultiBatchFunc) error {
+	return m.ApplyMultiBatchLookup(ctx, collections, func(docs map[string]map[core.DocumentID]core.Document, _ LookupFunc) (map[string]map[core.DocumentID]core.Document, error) {
+		return fn(docs)
+	})
+}
+
+// LookupFunc finds the IDs of documents whose indexed field holds a value,
+// like LookupSecondaryIDs
+type LookupFunc func(collection, field string, value interface{}) ([]core.DocumentID, error)
+
+// LookupBatchFunc is a MultiBatchFunc that can also look up documents
+// through the secondary indexes
+type LookupBatchFunc func(docs map[string]map[core.DocumentID]core.Document, lookup LookupFunc) (map[string]map[core.DocumentID]core.Document, error)
+
+// ApplyMultiBatchLookup is ApplyMultiBatchContext for batches that find
+// documents through the indexes instead of scanning. The lookups see the
+// indexes as they were when the batch started, which the batch's locks keep
+// in step with the documents it receives.
+func (m *FileIndexManager) ApplyMultiBatchLookup(ctx context.Context, collections []string, fn LookupBatchFunc) error {
+	batcher, ok := m.storage.(multiBatchApplier)
+	if !ok {
+		return fmt.Errorf("storage engine does not support multi-collection batch writes")
+	}
+
+	if err := core.LockContext(ctx, &m.mu); err != nil {
+		return fmt.Errorf("failed to lock indexes of %v: %w", collections, err)
+	}
+	defer m.mu.Unlock()
+
+	undo := make(map[string]map[core.DocumentID]core.Document)
+	rollback := func() {
+		for collection, writes := range undo {
+			m.indexes[collection].applyBatch(writes)
+		}
+		undo = nil
+	}
+
+	lookup := func(collection, field string, value interface{}) ([]core.DocumentID, error) {
+		_, fi, err := m.getFieldIndex(collection, field)
+		if err != nil {
+			return nil, err
+		}
+		return fi.lookup(value), nil
+	}
+
+	revisions := make(map[string]core.RevisionChange, len(collections))
+	err := batcher.ApplyMultiBatchContext(core.WithRevisions(ctx, revisions), collections, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		writes, err := fn(docs, lookup)
+		if err != nil {
+			return writes, err
+		}
+
+		for collection, collWrites := range writes {
+			idx, indexed := m.indexes[collection]
+			if !indexed {
+				continue
+			}
+			if err := m.syncIDFields(collection, collWrites); err != nil {
+				rollback()
+				return nil, err
+			}
+			undo[collection] = idx.applyBatch(collWrites)
+			if err := idx.checkBatchUnique(collection); err != nil {
+				rollback()
+				return nil, err
+			}
+		}
+		return writes, nil
+	})
+	if err != nil {
+		rollback()
+		return err
+	}
+
+	for collection := range undo {
+		m.indexes[collection].advanceRevision(revisions[collection])
+	}
+	return nil
+}
+
+// WriteBatch applies a batch of writes to a collection through indexes when
+// it supports batches, which updates them under the same lock, or else
+// through storage followed by an index update per write. indexes may be nil.
+func WriteBatch(ctx context.Context, storage core.StorageEngine, indexes core.IndexManager, collection string, fn core.BatchFunc) error {
+	if batcher, ok := indexes.(batchApplier); ok {
+		if err := batcher.ApplyBatchContext(ctx, collection, fn); err != nil {
+			return fmt.Errorf("failed to apply batch to %s: %w", collection, err)
+		}
+		return nil
+	}
+
+	batcher, ok := storage.(batchApplier)
+	if !ok {
+		return fmt.Errorf("storage engine does not support batch writes")
+	}
+
+	var applied map[core.DocumentID]core.Document
+	err := batcher.ApplyBatchContext(ctx, collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes, err := fn(docs)
+		applied = writes
+		return writes, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply batch to %s: %w", collection, err)
+	}
+	return updateIndexes(indexes, collection, applied)
+}
+
+// WriteMultiBatch is WriteBatch across several collections, applied
+// atomically
+func WriteMultiBatch(ctx context.Context, storage core.StorageEngine, indexes core.IndexManager, collections []string, fn core.MultiBatchFunc) error {
+	if batcher, ok := indexes.(multiBatchApplier); ok {
+		if err := batcher.ApplyMultiBatchContext(ctx, collections, fn); err != nil {
+			return fmt.Errorf("failed to apply batch to %v: %w", collections, err)
+		}
+		return nil
+	}
+
+	batcher, ok := storage.(multiBatchApplier)
+	if !ok {
+		return fmt.Errorf("storage engine does not support multi-collection batch writes")
+	}
+
+	var applied map[string]map[core.DocumentID]core.Document
+	revisions := make(map[string]core.RevisionChange, len(collections))
+	err := batcher.ApplyMultiBatchContext(core.WithRevisions(ctx, revisions), collections, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		writes, err := fn(docs)
+		applied = writes
+		return writes, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply batch to %v: %w", collections, err)
+	}
+	for collection, writes := range applied {
+		if err := updateIndexes(indexes, collection, writes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndexes brings indexes, if set, up to date with writes already
+// applied to storage, a nil document deleting
+func updateIndexes(indexes core.IndexManager, collection string, writes map[core.DocumentID]core.Document) error {
+	if indexes == nil {
+		return nil
+	}
+	for docID, doc := range writes {
+		op := core.OpUpdate
+		if doc == nil {
+			op = core.OpDelete
+		}
+		if err := indexes.UpdateIndexes(collection, docID, doc, op); err != nil {
+			return fmt.Errorf("failed to update indexes for %s/%s: %w", collection, docID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// batchOf returns a BatchFunc that applies fixed writes
+func batchOf(writes map[core.DocumentID]core.Document) core.BatchFunc {
+	return func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return writes, nil
+	}
+}
+
+func TestApplyBatchUpdatesIndexes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateSecondaryIndex("users", "status", core.IndexHash)
+	users.WriteDocument("u1", core.Document{"status": "active"})
+	users.WriteDocument("u2", core.Document{"status": "active"})
+	users.WriteDocument("u3", core.Document{"status": "active"})
+
+	err := manager.ApplyBatch("users", batchOf(map[core.DocumentID]core.Document{
+		"u1": {"status": "archived"},
+		"u2": nil,
+		"u4": {"status": "archived"},
+	}))
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+
+	ids, _ := manager.LookupSecondaryIDs("users", "status", "archived")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"u1", "u4"}) {
+		t.Errorf("Expected [u1 u4] archived, got %v", ids)
+	}
+	ids, _ = manager.LookupSecondaryIDs("users", "status", "active")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"u3"}) {
+		t.Errorf("Expected [u3] active, got %v", ids)
+	}
+	if _, err := manager.LookupPrimary("users", "u2"); err == nil {
+		t.Errorf("Expected deleted document to leave the primary index")
+	}
+
+	infos, _ := manager.ListIndexes("users")
+	if infos[0].Stale {
+		t.Errorf("Expected indexes to be fresh after a batch")
+	}
+}
+
+func TestApplyBatchUniqueConstraint(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndex("users", "email")
+	users.WriteDocument("u1", core.Document{"email": "a@example.com"})
+	users.WriteDocument("u2", core.Document{"email": "b@example.com"})
+
+	// Swapping values within one batch never leaves a duplicate behind
+	err := manager.ApplyBatch("users", batchOf(map[core.DocumentID]core.Document{
+		"u1": {"email": "b@example.com"},
+		"u2": {"email": "a@example.com"},
+	}))
+	if err != nil {
+		t.Fatalf("Expected swap to succeed, got %v", err)
+	}
+
+	revision, _ := engine.CollectionRevision("users")
+	err = manager.ApplyBatch("users", batchOf(map[core.DocumentID]core.Document{
+		"u1": {"email": "c@example.com"},
+		"u3": {"email": "c@example.com"},
+	}))
+	if !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Fatalf("Expected ErrUniqueConstraintViolation, got %v", err)
+	}
+
+	// Neither storage nor the indexes see any of the rejected batch
+	if after, _ := engine.CollectionRevision("users"); after != revision {
+		t.Errorf("Expected revision %d after rejected batch, got %d", revision, after)
+	}
+	ids, _ := manager.LookupSecondaryIDs("users", "email", "b@example.com")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"u1"}) {
+		t.Errorf("Expected u1 to keep its value, got %v", ids)
+	}
+	if ids, _ := manager.LookupSecondaryIDs("users", "email", "c@example.com"); len(ids) != 0 {
+		t.Errorf("Expected rejected value not to be indexed, got %v", ids)
+	}
+}
+
+func TestApplyMultiBatchUniqueConstraint(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	orders := &core.Collection{Name: "orders", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndex("users", "email")
+	manager.CreateSecondaryIndex("orders", "user", core.IndexHash)
+	users.WriteDocument("u1", core.Document{"email": "a@example.com"})
+	orders.WriteDocument("o1", core.Document{"user": "u1"})
+
+	batch := func(email string) core.MultiBatchFunc {
+		return func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+			return map[string]map[core.DocumentID]core.Document{
+				"users":  {"u2": {"email": email}},
+				"orders": {"o2": {"user": "u2"}},
+			}, nil
+		}
+	}
+
+	// A violation in one collection rejects the writes to every collection
+	err := manager.ApplyMultiBatch([]string{"users", "orders"}, batch("a@example.com"))
+	if !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Fatalf("Expected ErrUniqueConstraintViolation, got %v", err)
+	}
+	if ids, _ := manager.LookupSecondaryIDs("orders", "user", "u2"); len(ids) != 0 {
+		t.Errorf("Expected rejected order not to be indexed, got %v", ids)
+	}
+	if _, err := engine.ReadDocument("orders", "o2"); err == nil {
+		t.Errorf("Expected rejected order not to be written")
+	}
+
+	if err := manager.ApplyMultiBatch([]string{"users", "orders"}, batch("b@example.com")); err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	ids, _ := manager.LookupSecondaryIDs("orders", "user", "u2")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"o2"}) {
+		t.Errorf("Expected [o2], got %v", ids)
+	}
+	ids, _ = manager.LookupSecondaryIDs("users", "email", "b@example.com")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"u2"}) {
+		t.Errorf("Expected [u2], got %v", ids)
+	}
+}
+
+func TestWriteMultiBatchWithoutBatchIndexes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	manager.CreateSecondaryIndex("orders", "user", core.IndexHash)
+	engine.WriteDocument("orders", "o1", core.Document{"user": "u1"})
+	manager.UpdateIndexes("orders", "o1", core.Document{"user": "u1"}, core.OpInsert)
+
+	// Hiding the batch methods makes the writes go through storage first
+	indexes := struct{ core.IndexManager }{manager}
+	err := WriteMultiBatch(context.Background(), engine, indexes, []string{"orders"}, func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		return map[string]map[core.DocumentID]core.Document{"orders": {"o1": nil, "o2": {"user": "u2"}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+
+	if ids, _ := manager.LookupSecondaryIDs("orders", "user", "u1"); len(ids) != 0 {
+		t.Errorf("Expected the deleted order to be unindexed, got %v", ids)
+	}
+	if ids, _ := manager.LookupSecondaryIDs("orders", "user", "u2"); !reflect.DeepEqual(ids, []core.DocumentID{"o2"}) {
+		t.Errorf("Expected [o2], got %v", ids)
+	}
+	if _, err := engine.ReadDocument("orders", "o2"); err != nil {
+		t.Errorf("Expected o2 to be written, got %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// compositeSeparator joins field names to form a composite index name
+const compositeSeparator = ","
+
+// compositeName returns the name of a composite index over fields
+func compositeName(fields []string) string {
+	return strings.Join(fields, compositeSeparator)
+}
+
+// compositeEntry is a single (value tuple, document) pair in a composite index
+type compositeEntry struct {
+	keys  []sortKey
+	docID core.DocumentID
+}
+
+// compositeIndex keeps documents sorted by a tuple of field values so that
+// lookups on any leading subset of the fields are a contiguous range.
+//
+// A document missing one of the indexed fields is indexed with null in that
+// position, so it is still found by lookups on the leading fields it does
+// have. As a consequence, looking up null matches both explicit nulls and
+// missing fields. Documents missing every indexed field are not indexed.
+type compositeIndex struct {
+	name      string
+	keyFields []string
+	entries   []compositeEntry
+}
+
+// newCompositeIndex creates an empty composite index over fields
+func newCompositeIndex(fields []string) *compositeIndex {
+	return &compositeIndex{
+		name:      compositeName(fields),
+		keyFields: append([]string(nil), fields...),
+	}
+}
+
+// kind returns the index kind
+func (c *compositeIndex) kind() core.IndexKind {
+	return core.IndexComposite
+}
+
+// fields returns the indexed fields in key order
+func (c *compositeIndex) fields() []string {
+	return c.keyFields
+}
+
+// comparePrefix compares the leading len(prefix) keys of a tuple against prefix
+func comparePrefix(keys, prefix []sortKey) int {
+	for i := range prefix {
+		if cmp := compareSortKeys(keys[i], prefix[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareCompositeEntries orders entries by tuple, breaking ties by document ID
+func compareCompositeEntries(a, b compositeEntry) int {
+	if cmp := comparePrefix(a.keys, b.keys); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(string(a.docID), string(b.docID))
+}
+
+// stats returns the number of indexed documents and a rough size in bytes
+func (c *compositeIndex) stats() (int, int64) {
+	var size int64
+	for _, e := range c.entries {
+		size += int64(len(e.docID)) + sliceEntryOverhead
+		for _, key := range e.keys {
+			size += int64(len(key.str)) + sliceEntryOverhead
+		}
+	}
+	return len(c.entries), size
+}
+
+// entrySet returns every (tuple, document) pair keyed by its encoding
+func (c *compositeIndex) entrySet() map[string]core.DocumentID {
+	set := make(map[string]core.DocumentID, len(c.entries))
+	for _, e := range c.entries {
+		set[fmt.Sprintf("%v\x00%s", e.keys, e.docID)] = e.docID
+	}
+	return set
+}
+
+// entryFor builds the tuple for a document, reporting false if no field is present
+func (c *compositeIndex) entryFor(docID core.DocumentID, doc core.Document) (compositeEntry, bool) {
+	keys := make([]sortKey, len(c.keyFields))
+	present := false
+	for i, field := range c.keyFields {
+		value, ok := core.GetPath(doc, field)
+		if ok {
+			present = true
+		}
+		keys[i] = newSortKey(value)
+	}
+	return compositeEntry{keys: keys, docID: docID}, present
+}
+
+// search returns the position of the first entry not less than e
+func (c *compositeIndex) search(e compositeEntry) int {
+	return sort.Search(len(c.entries), func(i int) bool {
+		return compareCompositeEntries(c.entries[i], e) >= 0
+	})
+}
+
+// add inserts a document at its sorted position
+func (c *compositeIndex) add(docID core.DocumentID, doc core.Document) {
+	e, ok := c.entryFor(docID, doc)
+	if !ok {
+		return
+	}
+
+	i := c.search(e)
+	c.entries = append(c.entries, compositeEntry{})
+	copy(c.entries[i+1:], c.entries[i:])
+	c.entries[i] = e
+}
+
+// remove drops a document from the index using its previously indexed state
+func (c *compositeIndex) remove(docID core.DocumentID, doc core.Document) {
+	e, ok := c.entryFor(docID, doc)
+	if !ok {
+		return
+	}
+
+	i := c.search(e)
+	if i < len(c.entries) && compareCompositeEntries(c.entries[i], e) == 0 {
+		c.entries = append(c.entries[:i], c.entries[i+1:]...)
+	}
+}
+
+// lookup matches on the leading field. A []interface{} value is treated as a
+// tuple of leading field values.
+func (c *compositeIndex) lookup(value interface{}) []core.DocumentID {
+	if values, ok := value.([]interface{}); ok {
+		return c.lookupPrefix(values)
+	}
+	return c.lookupPrefix([]interface{}{value})
+}
+
+// lookupPrefix returns documents whose leading fields equal values, ordered by
+// the full tuple and then document ID
+func (c *compositeIndex) lookupPrefix(values []interface{}) []core.DocumentID {
+	prefix := make([]sortKey, len(values))
+	for i, v := range values {
+		prefix[i] = newSortKey(v)
+	}
+
+	start := sort.Search(len(c.entries), func(i int) bool {
+		return comparePrefix(c.entries[i].keys, prefix) >= 0
+	})
+
+	var ids []core.DocumentID
+	for i := start; i < len(c.entries) && comparePrefix(c.entries[i].keys, prefix) == 0; i++ {
+		ids = append(ids, c.entries[i].docID)
+	}
+	return ids
+}
@@ -0,0 +1,148 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+var tenantFields = []string{"tenant_id", "status"}
+
+func seedTickets(t *testing.T, manager *FileIndexManager, engine core.StorageEngine) {
+	tickets := []core.Document{
+		{"id": "t1", "tenant_id": "acme", "status": "open"},
+		{"id": "t2", "tenant_id": "acme", "status": "closed"},
+		{"id": "t3", "tenant_id": "acme", "status": "open"},
+		{"id": "t4", "tenant_id": "globex", "status": "open"},
+		{"id": "t5", "tenant_id": "acme"},                     // missing status
+		{"id": "t6", "tenant_id": "acme", "status": nil},      // explicit null
+		{"id": "t7", "title": "no indexed fields at all"},     // not indexed
+		{"id": "t8", "tenant_id": "initech", "status": "new"}, // single tenant
+	}
+	for _, doc := range tickets {
+		engine.WriteDocument("tickets", core.DocumentID(doc["id"].(string)), doc)
+	}
+
+	if err := manager.CreateCompositeIndex("tickets", tenantFields); err != nil {
+		t.Fatalf("Failed to create composite index: %v", err)
+	}
+}
+
+func TestCompositeLookupFullKey(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedTickets(t, manager, engine)
+
+	docs, err := manager.LookupComposite("tickets", tenantFields, []interface{}{"acme", "open"})
+	if err != nil {
+		t.Fatalf("Composite lookup failed: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"t1", "t3"}) {
+		t.Errorf("Expected [t1 t3], got %v", got)
+	}
+
+	ids, err := manager.LookupCompositeIDs("tickets", tenantFields, []interface{}{"acme", "open"})
+	if err != nil {
+		t.Fatalf("Composite ID lookup failed: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []core.DocumentID{"t1", "t3"}) {
+		t.Errorf("Expected [t1 t3], got %v", ids)
+	}
+}
+
+func TestCompositeLookupPrefix(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedTickets(t, manager, engine)
+
+	docs, err := manager.LookupComposite("tickets", tenantFields, []interface{}{"acme"})
+	if err != nil {
+		t.Fatalf("Composite lookup failed: %v", err)
+	}
+
+	// Ordered by tuple: null/missing status first, then "closed", then "open"
+	if got, expected := docIDs(docs), []string{"t5", "t6", "t2", "t1", "t3"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestCompositeMissingFieldsIndexedAsNull(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedTickets(t, manager, engine)
+
+	docs, _ := manager.LookupComposite("tickets", tenantFields, []interface{}{"acme", nil})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"t5", "t6"}) {
+		t.Errorf("Expected missing and null status to match null, got %v", got)
+	}
+
+	// A document with none of the fields is not indexed
+	docs, _ = manager.LookupComposite("tickets", tenantFields, []interface{}{nil})
+	if len(docs) != 0 {
+		t.Errorf("Expected no documents with null tenant, got %v", docIDs(docs))
+	}
+}
+
+func TestCompositeUpdateIndexes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedTickets(t, manager, engine)
+
+	manager.UpdateIndexes("tickets", "t1", core.Document{"id": "t1", "tenant_id": "acme", "status": "closed"}, core.OpUpdate)
+	manager.UpdateIndexes("tickets", "t3", nil, core.OpDelete)
+
+	docs, _ := manager.LookupComposite("tickets", tenantFields, []interface{}{"acme", "open"})
+	if len(docs) != 0 {
+		t.Errorf("Expected no open acme tickets, got %v", docIDs(docs))
+	}
+
+	docs, _ = manager.LookupComposite("tickets", tenantFields, []interface{}{"acme", "closed"})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"t1", "t2"}) {
+		t.Errorf("Expected [t1 t2], got %v", got)
+	}
+}
+
+func TestCompositeLookupValidation(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedTickets(t, manager, engine)
+
+	if _, err := manager.LookupComposite("tickets", tenantFields, nil); err == nil {
+		t.Errorf("Expected error for empty values")
+	}
+	if _, err := manager.LookupComposite("tickets", tenantFields, []interface{}{"a", "b", "c"}); err == nil {
+		t.Errorf("Expected error for too many values")
+	}
+	if _, err := manager.LookupComposite("tickets", []string{"status", "tenant_id"}, []interface{}{"open"}); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for a different field order, got %v", err)
+	}
+	if err := manager.CreateCompositeIndex("tickets", []string{"status"}); err == nil {
+		t.Errorf("Expected error for a single-field composite index")
+	}
+}
+
+func TestCompositePersistAndRebuild(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedTickets(t, manager, engine)
+	manager.PersistIndexes("tickets")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("tickets"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	docs, err := reloaded.LookupComposite("tickets", tenantFields, []interface{}{"acme", "open"})
+	if err != nil {
+		t.Fatalf("Expected composite index after reload: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"t1", "t3"}) {
+		t.Errorf("Expected [t1 t3] after reload, got %v", got)
+	}
+
+	// A stale file still carries the definition into the rebuild
+	engine.WriteDocument("tickets", "t9", core.Document{"id": "t9", "tenant_id": "acme", "status": "open"})
+	rebuilt, _ := NewFileIndexManager(engine, tempDir)
+	if err := rebuilt.LoadIndexes("tickets"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	docs, _ = rebuilt.LookupComposite("tickets", tenantFields, []interface{}{"acme", "open"})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"t1", "t3", "t9"}) {
+		t.Errorf("Expected [t1 t3 t9] after rebuild, got %v", got)
+	}
+}
@@ -0,0 +1,267 @@
+package index
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// DefaultExpiryField is the field an expiration index reads unless given
+// another
+const DefaultExpiryField = "_expiresAt"
+
+// expiryEntry is a document and the time it expires
+type expiryEntry struct {
+	at    time.Time
+	docID core.DocumentID
+}
+
+// expiryIndex is a min-heap of documents by expiry time. Each document's
+// position in the heap is tracked so that updating or removing its expiry
+// costs O(log n) and the heap never holds stale entries.
+type expiryIndex struct {
+	field   string
+	entries []expiryEntry
+	pos     map[core.DocumentID]int // Heap position of each entry
+}
+
+// newExpiryIndex creates an empty expiration index on a field
+func newExpiryIndex(field string) *expiryIndex {
+	return &expiryIndex{field: field, pos: make(map[core.DocumentID]int)}
+}
+
+// kind returns the index kind
+func (x *expiryIndex) kind() core.IndexKind {
+	return core.IndexExpiry
+}
+
+// fields returns the indexed field
+func (x *expiryIndex) fields() []string {
+	return []string{x.field}
+}
+
+// expiry returns when a document expires: its field as a core.ToTime value,
+// an RFC3339 timestamp or unix seconds. Documents without one never expire.
+func (x *expiryIndex) expiry(doc core.Document) (time.Time, bool) {
+	value, ok := core.GetPath(doc, x.field)
+	if !ok {
+		return time.Time{}, false
+	}
+	return core.ToTime(value)
+}
+
+// add indexes a document that has an expiry
+func (x *expiryIndex) add(docID core.DocumentID, doc core.Document) {
+	at, ok := x.expiry(doc)
+	if !ok {
+		return
+	}
+	if i, exists := x.pos[docID]; exists {
+		x.entries[i].at = at
+		heap.Fix(x, i)
+		return
+	}
+	heap.Push(x, expiryEntry{at: at, docID: docID})
+}
+
+// remove drops a document from the heap
+func (x *expiryIndex) remove(docID core.DocumentID, _ core.Document) {
+	if i, exists := x.pos[docID]; exists {
+		heap.Remove(x, i)
+	}
+}
+
+// lookup returns the IDs of documents expiring exactly at a time
+func (x *expiryIndex) lookup(value interface{}) []core.DocumentID {
+	at, ok := core.ToTime(value)
+	if !ok {
+		return nil
+	}
+	set := make(map[core.DocumentID]struct{})
+	x.visitDue(at, func(e expiryEntry) {
+		if e.at.Equal(at) {
+			set[e.docID] = struct{}{}
+		}
+	})
+	return sortedIDs(set)
+}
+
+// entrySet returns every (expiry, document) pair keyed by its encoding
+func (x *expiryIndex) entrySet() map[string]core.DocumentID {
+	set := make(map[string]core.DocumentID, len(x.entries))
+	for _, e := range x.entries {
+		set[fmt.Sprintf("%d\x00%s", e.at.UnixNano(), e.docID)] = e.docID
+	}
+	return set
+}
+
+// stats returns the number of indexed documents and a rough size in bytes
+func (x *expiryIndex) stats() (int, int64) {
+	var size int64
+	for _, e := range x.entries {
+		size += int64(len(e.docID))*2 + sliceEntryOverhead + mapEntryOverhead
+	}
+	return len(x.entries), size
+}
+
+// next returns the earliest expiry, if any document has one
+func (x *expiryIndex) next() (time.Time, bool) {
+	if len(x.entries) == 0 {
+		return time.Time{}, false
+	}
+	return x.entries[0].at, true
+}
+
+// due returns the IDs of documents expiring at or before now, earliest
+// first, and how many heap entries were visited to find them. Only due
+// entries and their immediate children are visited, so the cost follows
+// the number due rather than the size of the heap.
+func (x *expiryIndex) due(now time.Time) ([]expiryEntry, int) {
+	var due []expiryEntry
+	visited := x.visitDue(now, func(e expiryEntry) {
+		due = append(due, e)
+	})
+	sort.Slice(due, func(i, j int) bool { return expiryLess(due[i], due[j]) })
+	return due, visited
+}
+
+// visitDue calls fn with each entry expiring at or before now, walking
+// down the heap from its root and pruning at the first entry that is not
+// due, and returns the number of entries visited
+func (x *expiryIndex) visitDue(now time.Time, fn func(expiryEntry)) int {
+	visited := 0
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(x.entries) {
+			continue
+		}
+		visited++
+		if x.entries[i].at.After(now) {
+			continue
+		}
+		fn(x.entries[i])
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return visited
+}
+
+// expiryLess orders entries by expiry, breaking ties by document ID
+func expiryLess(a, b expiryEntry) bool {
+	if !a.at.Equal(b.at) {
+		return a.at.Before(b.at)
+	}
+	return a.docID < b.docID
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface
+
+func (x *expiryIndex) Len() int { return len(x.entries) }
+
+func (x *expiryIndex) Less(i, j int) bool { return expiryLess(x.entries[i], x.entries[j]) }
+
+func (x *expiryIndex) Swap(i, j int) {
+	x.entries[i], x.entries[j] = x.entries[j], x.entries[i]
+	x.pos[x.entries[i].docID] = i
+	x.pos[x.entries[j].docID] = j
+}
+
+func (x *expiryIndex) Push(e any) {
+	entry := e.(expiryEntry)
+	x.pos[entry.docID] = len(x.entries)
+	x.entries = append(x.entries, entry)
+}
+
+func (x *expiryIndex) Pop() any {
+	last := x.entries[len(x.entries)-1]
+	x.entries = x.entries[:len(x.entries)-1]
+	delete(x.pos, last.docID)
+	return last
+}
+
+// CreateExpiryIndex builds an expiration index on a field ("" for
+// DefaultExpiryField), ordering the collection's documents by when they
+// expire. A collection has at most one, so creating it replaces any other.
+// Like other secondary indexes its definition is persisted and it is
+// rebuilt from the documents on load, including when the index file is
+// missing or stale.
+func (m *FileIndexManager) CreateExpiryIndex(collection string, field string) error {
+	if field == "" {
+		field = DefaultExpiryField
+	}
+	if err := m.createIndex(collection, indexDefinition{Name: field, Fields: []string{field}, Kind: core.IndexExpiry}); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, fi := range m.indexes[collection].secondary {
+		if fi.kind() == core.IndexExpiry && name != field {
+			delete(m.indexes[collection].secondary, name)
+			m.version.Add(1)
+		}
+	}
+	return nil
+}
+
+// expiryIndexOf returns a collection's expiration index. Callers must hold m.mu.
+func (m *FileIndexManager) expiryIndexOf(collection string) (*expiryIndex, error) {
+	if idx, exists := m.indexes[collection]; exists {
+		for _, fi := range idx.secondary {
+			if x, ok := fi.(*expiryIndex); ok {
+				return x, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: expiration index on %s", ErrIndexNotFound, collection)
+}
+
+// ExpiryField returns the field of a collection's expiration index,
+// failing with ErrIndexNotFound if it has none
+func (m *FileIndexManager) ExpiryField(collection string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	x, err := m.expiryIndexOf(collection)
+	if err != nil {
+		return "", err
+	}
+	return x.field, nil
+}
+
+// NextExpiry returns the earliest expiry of a collection's documents, and
+// false if none has one. It fails with ErrIndexNotFound without an
+// expiration index.
+func (m *FileIndexManager) NextExpiry(collection string) (time.Time, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	x, err := m.expiryIndexOf(collection)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	at, ok := x.next()
+	return at, ok, nil
+}
+
+// ExpiredIDs returns the IDs of documents expiring at or before now,
+// earliest first, without visiting those that expire later
+func (m *FileIndexManager) ExpiredIDs(collection string, now time.Time) ([]core.DocumentID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	x, err := m.expiryIndexOf(collection)
+	if err != nil {
+		return nil, err
+	}
+	due, _ := x.due(now)
+	ids := make([]core.DocumentID, len(due))
+	for i, e := range due {
+		ids[i] = e.docID
+	}
+	return ids, nil
+}
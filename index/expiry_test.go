@@ -0,0 +1,230 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+var expiryBase = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestExpiryIndexDueVisitsOnlyDueEntries(t *testing.T) {
+	const n = 5000
+	x := newExpiryIndex(DefaultExpiryField)
+	expires := make(map[core.DocumentID]time.Time, n)
+	rng := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < n; i++ {
+		docID := core.DocumentID(fmt.Sprintf("doc_%04d", i))
+		at := expiryBase.Add(time.Duration(rng.IntN(n)) * time.Second)
+		expires[docID] = at
+		x.add(docID, core.Document{DefaultExpiryField: core.Time(at)})
+	}
+	// Documents without an expiry are not indexed
+	x.add("forever", core.Document{"name": "forever"})
+
+	removed := 0
+	for now := expiryBase; removed < n; now = now.Add(250 * time.Second) {
+		due, visited := x.due(now)
+
+		var want []core.DocumentID
+		for docID, at := range expires {
+			if !at.After(now) {
+				want = append(want, docID)
+			}
+		}
+		if len(due) != len(want) {
+			t.Fatalf("Expected %d documents due at %s, got %d", len(want), now, len(due))
+		}
+		for i, e := range due {
+			if e.at.After(now) {
+				t.Fatalf("Expected only due documents, got %s expiring at %s", e.docID, e.at)
+			}
+			if i > 0 && expiryLess(e, due[i-1]) {
+				t.Fatalf("Expected due documents earliest first, got %s before %s", due[i-1].docID, e.docID)
+			}
+		}
+		if visited > 2*len(due)+1 {
+			t.Errorf("Expected at most %d entries visited for %d due, got %d", 2*len(due)+1, len(due), visited)
+		}
+
+		for _, e := range due {
+			x.remove(e.docID, nil)
+			delete(expires, e.docID)
+		}
+		removed += len(due)
+	}
+	if x.Len() != 0 {
+		t.Errorf("Expected an empty index, got %d entries", x.Len())
+	}
+}
+
+func TestExpiryIndexTracksUpdates(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	for i, offset := range []time.Duration{time.Hour, 2 * time.Hour, 3 * time.Hour} {
+		docID := core.DocumentID(fmt.Sprintf("s%d", i+1))
+		doc := core.Document{"id": string(docID), DefaultExpiryField: core.Time(expiryBase.Add(offset))}
+		if err := engine.WriteDocument("sessions", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	if err := manager.CreateExpiryIndex("sessions", ""); err != nil {
+		t.Fatalf("Failed to create expiry index: %v", err)
+	}
+
+	steps := []struct {
+		name    string
+		docID   core.DocumentID
+		doc     core.Document
+		op      core.OperationType
+		next    time.Time
+		hasNext bool
+	}{
+		{"extended", "s1", core.Document{DefaultExpiryField: core.Time(expiryBase.Add(5 * time.Hour))}, core.OpUpdate, expiryBase.Add(2 * time.Hour), true},
+		{"unix seconds", "s4", core.Document{DefaultExpiryField: float64(expiryBase.Add(time.Minute).Unix())}, core.OpInsert, expiryBase.Add(time.Minute), true},
+		{"expiry removed", "s4", core.Document{"name": "kept"}, core.OpUpdate, expiryBase.Add(2 * time.Hour), true},
+		{"deleted", "s2", nil, core.OpDelete, expiryBase.Add(3 * time.Hour), true},
+		{"invalid expiry", "s3", core.Document{DefaultExpiryField: "tomorrow"}, core.OpUpdate, expiryBase.Add(5 * time.Hour), true},
+		{"last deleted", "s1", nil, core.OpDelete, time.Time{}, false},
+	}
+	for _, step := range steps {
+		if err := manager.UpdateIndexes("sessions", step.docID, step.doc, step.op); err != nil {
+			t.Fatalf("Failed to update indexes: %v", err)
+		}
+		next, ok, err := manager.NextExpiry("sessions")
+		if err != nil {
+			t.Fatalf("Failed to get next expiry: %v", err)
+		}
+		if ok != step.hasNext || !next.Equal(step.next) {
+			t.Errorf("%s: expected next expiry %s (%v), got %s (%v)", step.name, step.next, step.hasNext, next, ok)
+		}
+	}
+}
+
+func TestExpiredIDs(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	err := engine.ApplyBatch("sessions", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document)
+		for i := 0; i < 2000; i++ {
+			docID := core.DocumentID(fmt.Sprintf("s%04d", i))
+			writes[docID] = core.Document{"id": string(docID), DefaultExpiryField: core.Time(expiryBase.Add(time.Duration(i) * time.Minute))}
+		}
+		return writes, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write documents: %v", err)
+	}
+
+	if _, err := manager.ExpiredIDs("sessions", expiryBase); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound without an expiry index, got %v", err)
+	}
+	if err := manager.CreateExpiryIndex("sessions", ""); err != nil {
+		t.Fatalf("Failed to create expiry index: %v", err)
+	}
+
+	ids, err := manager.ExpiredIDs("sessions", expiryBase.Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to get expired IDs: %v", err)
+	}
+	if want := []core.DocumentID{"s0000", "s0001", "s0002"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+
+	field, err := manager.ExpiryField("sessions")
+	if err != nil || field != DefaultExpiryField {
+		t.Errorf("Expected expiry field %s, got %q (%v)", DefaultExpiryField, field, err)
+	}
+}
+
+func TestExpiryIndexRebuiltOnLoad(t *testing.T) {
+	manager, engine, dir := setupTestManager(t)
+	for i := 0; i < 3; i++ {
+		docID := core.DocumentID(fmt.Sprintf("s%d", i))
+		doc := core.Document{"id": string(docID), "expires": core.Time(expiryBase.Add(time.Duration(i+1) * time.Hour))}
+		if err := engine.WriteDocument("sessions", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	if err := manager.CreateExpiryIndex("sessions", "expires"); err != nil {
+		t.Fatalf("Failed to create expiry index: %v", err)
+	}
+	if err := manager.PersistIndexes("sessions"); err != nil {
+		t.Fatalf("Failed to persist indexes: %v", err)
+	}
+
+	// A write the index file misses makes it stale, so it is rebuilt from
+	// a scan with the persisted definitions
+	if err := engine.WriteDocument("sessions", "early", core.Document{"id": "early", "expires": core.Time(expiryBase)}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	reloaded, err := NewFileIndexManager(engine, dir)
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	var rebuilt error
+	reloaded.SetRebuildHandler(func(_ string, reason error) { rebuilt = reason })
+	if err := reloaded.LoadIndexes("sessions"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	if !errors.Is(rebuilt, ErrIndexStale) {
+		t.Errorf("Expected a rebuild of the stale index file, got %v", rebuilt)
+	}
+
+	next, ok, err := reloaded.NextExpiry("sessions")
+	if err != nil || !ok || !next.Equal(expiryBase) {
+		t.Errorf("Expected next expiry %s, got %s (%v, %v)", expiryBase, next, ok, err)
+	}
+	infos, err := reloaded.ListIndexes("sessions")
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Kind != core.IndexExpiry || infos[0].DocumentCount != 4 {
+		t.Errorf("Expected one expiry index over 4 documents, got %+v", infos)
+	}
+
+	// Without its index file the index is gone until it is created again
+	if err := os.Remove(reloaded.getIndexPath("sessions")); err != nil {
+		t.Fatalf("Failed to remove index file: %v", err)
+	}
+	fresh, err := NewFileIndexManager(engine, dir)
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := fresh.LoadIndexes("sessions"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	if _, _, err := fresh.NextExpiry("sessions"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+}
+
+func TestCreateExpiryIndexReplacesOther(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	if err := engine.WriteDocument("sessions", "s1", core.Document{"id": "s1", "a": core.Time(expiryBase), "b": core.Time(expiryBase.Add(time.Hour))}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	for _, field := range []string{"a", "b"} {
+		if err := manager.CreateExpiryIndex("sessions", field); err != nil {
+			t.Fatalf("Failed to create expiry index: %v", err)
+		}
+	}
+
+	infos, err := manager.ListIndexes("sessions")
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"b"}) {
+		t.Errorf("Expected only the index on b, got %v", names)
+	}
+}
@@ -0,0 +1,208 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// hashIndex maps an encoded field value to the set of documents holding it
+type hashIndex struct {
+	field       string
+	entries     map[string]map[core.DocumentID]struct{}
+	opts        IndexOptions
+	unique      bool // Each value may be held by at most one document
+	uniqueNulls bool // Explicit nulls count as values for uniqueness
+}
+
+// newHashIndex creates an empty hash index on a field
+func newHashIndex(field string) *hashIndex {
+	return &hashIndex{
+		field:   field,
+		entries: make(map[string]map[core.DocumentID]struct{}),
+	}
+}
+
+// kind returns the index kind
+func (h *hashIndex) kind() core.IndexKind {
+	return core.IndexHash
+}
+
+// fields returns the indexed field
+func (h *hashIndex) fields() []string {
+	return []string{h.field}
+}
+
+// keys returns the encoded keys a document is indexed under. An array value is
+// multikey: each distinct element gets its own key, and an empty array is not
+// indexed at all.
+func (h *hashIndex) keys(doc core.Document) []string {
+	value, ok := core.GetPath(doc, h.field)
+	if !ok || h.opts.skips(value) {
+		return nil
+	}
+
+	value = h.opts.normalize(value)
+	elements, isArray := value.([]interface{})
+	if !isArray {
+		return []string{valueKey(value)}
+	}
+
+	keys := make([]string, 0, len(elements))
+	seen := make(map[string]struct{}, len(elements))
+	for _, element := range elements {
+		key := valueKey(element)
+		if _, dup := seen[key]; !dup {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// add indexes a document under its field value, if present
+func (h *hashIndex) add(docID core.DocumentID, doc core.Document) {
+	for _, key := range h.keys(doc) {
+		ids, exists := h.entries[key]
+		if !exists {
+			ids = make(map[core.DocumentID]struct{})
+			h.entries[key] = ids
+		}
+		ids[docID] = struct{}{}
+	}
+}
+
+// remove drops a document from the index using its previously indexed state
+func (h *hashIndex) remove(docID core.DocumentID, doc core.Document) {
+	for _, key := range h.keys(doc) {
+		if ids, exists := h.entries[key]; exists {
+			delete(ids, docID)
+			if len(ids) == 0 {
+				delete(h.entries, key)
+			}
+		}
+	}
+}
+
+// lookup returns the IDs of documents whose field equals value, or whose
+// array field contains it
+func (h *hashIndex) lookup(value interface{}) []core.DocumentID {
+	return sortedIDs(h.entries[valueKey(h.opts.normalize(value))])
+}
+
+// lookupAll returns the IDs of documents matching every one of values
+func (h *hashIndex) lookupAll(values []interface{}) []core.DocumentID {
+	if len(values) == 0 {
+		return nil
+	}
+
+	matches := make(map[core.DocumentID]struct{})
+	for docID := range h.entries[valueKey(h.opts.normalize(values[0]))] {
+		matches[docID] = struct{}{}
+	}
+	for _, value := range values[1:] {
+		ids := h.entries[valueKey(h.opts.normalize(value))]
+		for docID := range matches {
+			if _, ok := ids[docID]; !ok {
+				delete(matches, docID)
+			}
+		}
+	}
+	return sortedIDs(matches)
+}
+
+// stats returns the number of indexed documents and a rough size in bytes
+func (h *hashIndex) stats() (int, int64) {
+	docs := make(map[core.DocumentID]struct{})
+	var size int64
+	for key, ids := range h.entries {
+		size += int64(len(key)) + mapEntryOverhead
+		for docID := range ids {
+			docs[docID] = struct{}{}
+			size += int64(len(docID)) + mapEntryOverhead
+		}
+	}
+	return len(docs), size
+}
+
+// entrySet returns every (value, document) pair keyed by its encoding
+func (h *hashIndex) entrySet() map[string]core.DocumentID {
+	set := make(map[string]core.DocumentID)
+	for key, ids := range h.entries {
+		for docID := range ids {
+			set[key+"\x00"+string(docID)] = docID
+		}
+	}
+	return set
+}
+
+// conflict returns a document other than docID already holding doc's value
+// for a unique index. Missing fields never conflict, and nulls only conflict
+// when uniqueNulls is set. For array values every element must be unused.
+func (h *hashIndex) conflict(docID core.DocumentID, doc core.Document) (core.DocumentID, bool) {
+	if !h.unique {
+		return "", false
+	}
+
+	for _, key := range h.keys(doc) {
+		if key == valueKey(nil) && !h.uniqueNulls {
+			continue
+		}
+		for _, other := range sortedIDs(h.entries[key]) {
+			if other != docID {
+				return other, true
+			}
+		}
+	}
+	return "", false
+}
+
+// duplicate returns an indexed value held by more than one document, if any,
+// ignoring nulls unless uniqueNulls is set
+func (h *hashIndex) duplicate() (string, []core.DocumentID, bool) {
+	keys := make([]string, 0, len(h.entries))
+	for key, ids := range h.entries {
+		if len(ids) > 1 && (key != valueKey(nil) || h.uniqueNulls) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", nil, false
+	}
+
+	sort.Strings(keys)
+	return keys[0], sortedIDs(h.entries[keys[0]]), true
+}
+
+// valueKey encodes a field value so that values comparing equal share a key.
+// All numeric types collapse to their float64 form, so 25, int64(25) and the
+// float64(25) produced by JSON decoding are the same key.
+func valueKey(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "s:" + v
+	case bool:
+		return "b:" + strconv.FormatBool(v)
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return "n:" + strconv.FormatFloat(f, 'g', -1, 64)
+		}
+		return "s:" + v.String()
+	}
+
+	if f, ok := core.ToFloat64(value); ok {
+		return "n:" + strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	// Composite values are keyed by their JSON encoding
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("?:%v", value)
+	}
+	return "j:" + string(data)
+}
@@ -0,0 +1,202 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Approximate per-entry memory overheads used by index size estimates
+const (
+	mapEntryOverhead   = 48
+	sliceEntryOverhead = 64
+)
+
+// ListIndexes describes the secondary indexes loaded for a collection, ordered
+// by name. A collection without loaded indexes has none.
+func (m *FileIndexManager) ListIndexes(collection string) ([]core.IndexInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return []core.IndexInfo{}, nil
+	}
+	stale, err := m.stale(collection, idx)
+	if err != nil {
+		return nil, err
+	}
+	return idx.infos(stale), nil
+}
+
+// IndexesStale reports whether writes that bypassed the manager have left
+// the indexes of a collection behind its storage, as ListIndexes marks them
+// without describing each index
+func (m *FileIndexManager) IndexesStale(collection string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return false, nil
+	}
+	return m.stale(collection, idx)
+}
+
+// stale compares the revision the indexes reflect with the collection's,
+// when the storage engine tracks them. Callers must hold m.mu.
+func (m *FileIndexManager) stale(collection string, idx *collectionIndexes) (bool, error) {
+	if _, ok := m.storage.(revisioner); !ok {
+		return false, nil
+	}
+	revision, err := m.collectionRevision(collection)
+	if err != nil {
+		return false, err
+	}
+	return revision != idx.revision, nil
+}
+
+// IndexVersion returns a number that changes whenever indexes are created,
+// dropped, loaded or rebuilt, so query plans made while it holds still
+// apply. Writes that bypass the manager, leaving indexes stale, do not
+// change it; IndexesStale reports those.
+func (m *FileIndexManager) IndexVersion() uint64 {
+	return m.version.Load()
+}
+
+// infos describes the secondary indexes, ordered by name
+func (idx *collectionIndexes) infos(stale bool) []core.IndexInfo {
+	infos := make([]core.IndexInfo, 0, len(idx.secondary))
+	for _, def := range idx.definitions() {
+		docs, size := idx.secondary[def.Name].stats()
+		infos = append(infos, core.IndexInfo{
+			Name:            def.Name,
+			Fields:          def.Fields,
+			Kind:            def.Kind,
+			Unique:          def.Unique,
+			Sparse:          def.Sparse,
+			CaseInsensitive: def.CaseInsensitive,
+			DocumentCount:   docs,
+			SizeBytes:       size,
+			Stale:           stale,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// IndexSummary describes the indexes loaded for a collection
+type IndexSummary struct {
+	Documents int              // Entries of the primary index
+	Indexes   []core.IndexInfo // Secondary indexes, ordered by name, without staleness
+	FileBytes int64            // Size of the persisted index file, 0 if there is none
+}
+
+// Summary describes a collection's loaded indexes from memory and the size
+// of its index file, never reading storage, so it is cheap enough to call
+// often. It reports false for a collection without loaded indexes.
+func (m *FileIndexManager) Summary(collection string) (IndexSummary, bool) {
+	m.mu.RLock()
+	idx, exists := m.indexes[collection]
+	var summary IndexSummary
+	if exists {
+		summary = IndexSummary{Documents: len(idx.primary), Indexes: idx.infos(false)}
+	}
+	m.mu.RUnlock()
+	if !exists {
+		return IndexSummary{}, false
+	}
+
+	if info, err := os.Stat(m.getIndexPath(collection)); err == nil {
+		summary.FileBytes = info.Size()
+	}
+	return summary, true
+}
+
+// DropIndex removes a secondary index. If the collection's indexes have been
+// persisted, the index file is rewritten without it.
+func (m *FileIndexManager) DropIndex(collection string, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return fmt.Errorf("%w: %s.%s", ErrIndexNotFound, collection, name)
+	}
+	if _, exists := idx.secondary[name]; !exists {
+		return fmt.Errorf("%w: %s.%s", ErrIndexNotFound, collection, name)
+	}
+
+	delete(idx.secondary, name)
+	m.version.Add(1)
+
+	if _, err := os.Stat(m.getIndexPath(collection)); err == nil {
+		if err := m.persist(collection, idx); err != nil {
+			return fmt.Errorf("failed to persist indexes after drop: %w", err)
+		}
+	}
+	return nil
+}
+
+// DropIndexes removes every index of a collection, in memory and on disk,
+// for a collection being dropped. A collection without indexes is not an
+// error.
+func (m *FileIndexManager) DropIndexes(collection string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.indexes, collection)
+	m.version.Add(1)
+	if err := os.Remove(m.getIndexPath(collection)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove index file: %w", err)
+	}
+	return nil
+}
+
+// Definitions returns a collection's secondary index definitions as JSON,
+// for recreating the indexes elsewhere with RestoreDefinitions
+func (m *FileIndexManager) Definitions(collection string) (json.RawMessage, error) {
+	defs := m.knownDefinitions(collection)
+	if defs == nil {
+		defs = []indexDefinition{}
+	}
+	data, err := json.Marshal(defs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal index definitions: %w", err)
+	}
+	return data, nil
+}
+
+// RestoreDefinitions replaces a collection's secondary indexes with
+// definitions returned by Definitions, building them from storage and
+// persisting them
+func (m *FileIndexManager) RestoreDefinitions(collection string, data json.RawMessage) error {
+	var defs []indexDefinition
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return fmt.Errorf("failed to parse index definitions: %w", err)
+	}
+
+	revision, err := m.collectionRevision(collection)
+	if err != nil {
+		return err
+	}
+	docs, err := m.scanCollection(collection)
+	if err != nil {
+		return err
+	}
+	idx, err := newCollectionIndexes(docs, defs)
+	if err != nil {
+		return fmt.Errorf("failed to build indexes of %s: %w", collection, err)
+	}
+	idx.revision = revision
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.indexes[collection] = idx
+	m.version.Add(1)
+	return m.persist(collection, idx)
+}
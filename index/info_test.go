@@ -0,0 +1,168 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func setupListedIndexes(t *testing.T) (*FileIndexManager, core.StorageEngine, string) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedUsers(t, engine, 10)
+	engine.WriteDocument("users", "user_100", core.Document{"id": "user_100", "email": "a@example.com"})
+
+	manager.CreateSecondaryIndex("users", "age", core.IndexOrdered)
+	manager.CreateUniqueIndex("users", "email")
+	manager.CreateTextIndex("users", "name", TextOptions{})
+	manager.CreateCompositeIndex("users", []string{"age", "name"})
+	return manager, engine, tempDir
+}
+
+func indexNames(infos []core.IndexInfo) []string {
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestListIndexes(t *testing.T) {
+	manager, _, _ := setupListedIndexes(t)
+
+	infos, err := manager.ListIndexes("users")
+	if err != nil {
+		t.Fatalf("Failed to list indexes: %v", err)
+	}
+	if got := indexNames(infos); !reflect.DeepEqual(got, []string{"age", "age,name", "email", "name"}) {
+		t.Fatalf("Unexpected index names: %v", got)
+	}
+
+	byName := make(map[string]core.IndexInfo)
+	for _, info := range infos {
+		byName[info.Name] = info
+		if info.SizeBytes <= 0 {
+			t.Errorf("Expected a positive size estimate for %s", info.Name)
+		}
+		if info.Stale {
+			t.Errorf("Expected %s to be fresh", info.Name)
+		}
+	}
+
+	if info := byName["age"]; info.Kind != core.IndexOrdered || info.DocumentCount != 10 {
+		t.Errorf("Unexpected age index info: %+v", info)
+	}
+	if info := byName["email"]; info.Kind != core.IndexHash || !info.Unique || info.DocumentCount != 1 {
+		t.Errorf("Unexpected email index info: %+v", info)
+	}
+	if info := byName["name"]; info.Kind != core.IndexText || info.DocumentCount != 10 {
+		t.Errorf("Unexpected name index info: %+v", info)
+	}
+	if info := byName["age,name"]; info.Kind != core.IndexComposite || !reflect.DeepEqual(info.Fields, []string{"age", "name"}) {
+		t.Errorf("Unexpected composite index info: %+v", info)
+	}
+
+	if infos, err := manager.ListIndexes("unindexed"); err != nil || len(infos) != 0 {
+		t.Errorf("Expected no indexes for an unindexed collection, got %v, %v", infos, err)
+	}
+}
+
+func TestListIndexesReportsStaleness(t *testing.T) {
+	manager, engine, _ := setupListedIndexes(t)
+
+	// A write straight to storage bypasses the index manager
+	engine.WriteDocument("users", "user_200", core.Document{"age": 99})
+	infos, _ := manager.ListIndexes("users")
+	if !infos[0].Stale {
+		t.Errorf("Expected indexes to be stale after a direct storage write")
+	}
+
+	manager.RebuildIndexes("users")
+	infos, _ = manager.ListIndexes("users")
+	if infos[0].Stale {
+		t.Errorf("Expected indexes to be fresh after a rebuild")
+	}
+
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	users.WriteDocument("user_201", core.Document{"age": 30})
+	infos, _ = manager.ListIndexes("users")
+	if infos[0].Stale {
+		t.Errorf("Expected indexes to stay fresh after an indexed write")
+	}
+}
+
+func TestIndexedWriteKeepsBypassStale(t *testing.T) {
+	manager, engine, _ := setupListedIndexes(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+
+	// An indexed write after a bypass must not mark the bypass as indexed
+	engine.WriteDocument("users", "user_200", core.Document{"age": 99})
+	if err := users.WriteDocument("user_201", core.Document{"age": 30}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if stale, err := manager.IndexesStale("users"); err != nil || !stale {
+		t.Errorf("Expected indexes to stay stale after an indexed write, got %v, %v", stale, err)
+	}
+
+	err := manager.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{"user_202": {"age": 31}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	if err := users.DeleteDocument("user_201"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if stale, err := manager.IndexesStale("users"); err != nil || !stale {
+		t.Errorf("Expected indexes to stay stale after indexed writes, got %v, %v", stale, err)
+	}
+	if docs, _ := manager.LookupSecondary("users", "age", 99); len(docs) != 0 {
+		t.Errorf("Expected the bypassed document to stay unindexed, got %v", docs)
+	}
+}
+
+func TestDropIndex(t *testing.T) {
+	manager, _, _ := setupListedIndexes(t)
+
+	if err := manager.DropIndex("users", "age"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	if _, err := manager.LookupSecondary("users", "age", 20); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected dropped index to be gone, got %v", err)
+	}
+
+	infos, _ := manager.ListIndexes("users")
+	if got := indexNames(infos); !reflect.DeepEqual(got, []string{"age,name", "email", "name"}) {
+		t.Errorf("Unexpected index names after drop: %v", got)
+	}
+
+	if err := manager.DropIndex("users", "age"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound dropping a missing index, got %v", err)
+	}
+	if err := manager.DropIndex("unindexed", "age"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for an unindexed collection, got %v", err)
+	}
+}
+
+func TestDropIndexConsistentAfterRestart(t *testing.T) {
+	manager, engine, tempDir := setupListedIndexes(t)
+	manager.PersistIndexes("users")
+
+	// Dropping after persisting rewrites the index file
+	manager.DropIndex("users", "email")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	before, _ := manager.ListIndexes("users")
+	after, _ := reloaded.ListIndexes("users")
+	if !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected identical indexes after restart:\nbefore %+v\nafter  %+v", before, after)
+	}
+	if _, err := reloaded.LookupSecondary("users", "email", "a@example.com"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected dropped index to stay dropped after restart, got %v", err)
+	}
+}
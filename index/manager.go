@@ -0,0 +1,832 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+// indexFileSuffix is appended to the collection name to form the index file name
+const indexFileSuffix = ".idx.json"
+
+var (
+	// ErrIndexNotFound is returned when a lookup targets an index that was never created
+	ErrIndexNotFound = errors.New("index not found")
+
+	// ErrIndexStale is returned when a persisted index no longer matches its collection
+	ErrIndexStale = errors.New("index is stale")
+
+	// ErrIndexKindMismatch is returned when an operation needs a different kind of index
+	ErrIndexKindMismatch = errors.New("index kind does not support operation")
+
+	// ErrIndexCorrupt is returned when a persisted index does not match its own checksum
+	ErrIndexCorrupt = errors.New("index file is corrupt")
+)
+
+// revisioner is implemented by storage engines that track a per-collection
+// revision counter (FileStorageEngine does). It lets LoadIndexes detect stale
+// index files without scanning the collection.
+type revisioner interface {
+	CollectionRevision(collection string) (uint64, error)
+}
+
+// fieldIndex is implemented by every secondary index structure
+type fieldIndex interface {
+	// kind returns the index kind
+	kind() core.IndexKind
+
+	// fields returns the indexed fields in key order
+	fields() []string
+
+	// add indexes a document
+	add(docID core.DocumentID, doc core.Document)
+
+	// remove drops a document using its previously indexed state
+	remove(docID core.DocumentID, doc core.Document)
+
+	// lookup returns the IDs of documents whose field equals value
+	lookup(value interface{}) []core.DocumentID
+
+	// entrySet returns every index entry encoded as a string, mapped to its document
+	entrySet() map[string]core.DocumentID
+
+	// stats returns the number of indexed documents and a rough size in bytes
+	stats() (docs int, size int64)
+}
+
+// FileIndexManager implements the IndexManager interface with in-memory
+// indexes that are persisted as JSON files next to the collections
+type FileIndexManager struct {
+	storage   core.StorageEngine
+	indexDir  string
+	mu        sync.RWMutex
+	indexes   map[string]*collectionIndexes // Indexes per collection
+	onRebuild func(collection string, reason error)
+	version   atomic.Uint64 // Bumped whenever a collection's indexes are created, dropped or replaced
+}
+
+// collectionIndexes holds every index defined on a single collection
+type collectionIndexes struct {
+	primary   map[core.DocumentID]core.Document
+	secondary map[string]fieldIndex // Secondary indexes keyed by name
+	revision  uint64                // Storage revision the indexes reflect
+}
+
+// indexDefinition describes a secondary index so it can be recreated
+type indexDefinition struct {
+	Name        string         `json:"name"`
+	Fields      []string       `json:"fields"`
+	Kind        core.IndexKind `json:"kind"`
+	Unique      bool           `json:"unique,omitempty"`
+	UniqueNulls bool           `json:"unique_nulls,omitempty"` // Reject duplicate nulls in a unique index
+	Text        *TextOptions   `json:"text,omitempty"`         // Tokenizer settings of a text index
+
+	Sparse          bool `json:"sparse,omitempty"`
+	CaseInsensitive bool `json:"case_insensitive,omitempty"`
+}
+
+// options returns the creation flags recorded in a definition
+func (def indexDefinition) options() IndexOptions {
+	return IndexOptions{Sparse: def.Sparse, CaseInsensitive: def.CaseInsensitive}
+}
+
+// indexFile is the on-disk representation of a collection's indexes. Only the
+// primary index is stored in full; secondary indexes are stored as definitions
+// and rebuilt from the primary index on load.
+type indexFile struct {
+	Collection    string                            `json:"collection"`
+	Revision      uint64                            `json:"revision"`
+	Checksum      string                            `json:"checksum"` // Content hash of Primary
+	DocumentCount int                               `json:"document_count"`
+	Primary       map[core.DocumentID]core.Document `json:"primary"`
+	Indexes       []indexDefinition                 `json:"indexes"`
+}
+
+// Ensure FileIndexManager satisfies the IndexManager interface
+var _ core.IndexManager = (*FileIndexManager)(nil)
+
+// NewFileIndexManager creates an index manager backed by the given storage engine.
+// Index files are written to indexDir, which may be the storage data directory.
+func NewFileIndexManager(storage core.StorageEngine, indexDir string) (*FileIndexManager, error) {
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+
+	return &FileIndexManager{
+		storage:  storage,
+		indexDir: indexDir,
+		indexes:  make(map[string]*collectionIndexes),
+	}, nil
+}
+
+// SetRebuildHandler registers fn to be called whenever LoadIndexes discards a
+// missing, stale or corrupt index file and rebuilds from storage instead
+func (m *FileIndexManager) SetRebuildHandler(fn func(collection string, reason error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onRebuild = fn
+}
+
+// getIndexPath returns the file path for a collection's indexes
+func (m *FileIndexManager) getIndexPath(collection string) string {
+	return filepath.Join(m.indexDir, collection+indexFileSuffix)
+}
+
+// newFieldIndex creates an empty secondary index of the given kind
+func newFieldIndex(def indexDefinition) (fieldIndex, error) {
+	switch def.Kind {
+	case core.IndexHash, core.IndexOrdered:
+		if len(def.Fields) != 1 {
+			return nil, fmt.Errorf("%s index %s must have exactly one field", def.Kind, def.Name)
+		}
+		if def.Kind == core.IndexHash {
+			h := newHashIndex(def.Fields[0])
+			h.opts = def.options()
+			h.unique = def.Unique
+			h.uniqueNulls = def.UniqueNulls
+			return h, nil
+		}
+		if def.Unique {
+			return nil, fmt.Errorf("unique index %s must be a hash index", def.Name)
+		}
+		o := newOrderedIndex(def.Fields[0])
+		o.opts = def.options()
+		return o, nil
+	case core.IndexComposite:
+		if len(def.Fields) < 2 {
+			return nil, fmt.Errorf("composite index %s needs at least two fields", def.Name)
+		}
+		return newCompositeIndex(def.Fields), nil
+	case core.IndexText:
+		if len(def.Fields) != 1 {
+			return nil, fmt.Errorf("text index %s must have exactly one field", def.Name)
+		}
+		var opts TextOptions
+		if def.Text != nil {
+			opts = *def.Text
+		}
+		return newTextIndex(def.Fields[0], opts), nil
+	case core.IndexExpiry:
+		if len(def.Fields) != 1 {
+			return nil, fmt.Errorf("expiry index %s must have exactly one field", def.Name)
+		}
+		return newExpiryIndex(def.Fields[0]), nil
+	}
+	return nil, fmt.Errorf("unknown index kind: %d", def.Kind)
+}
+
+// buildFieldIndex creates a secondary index and indexes every document
+func buildFieldIndex(def indexDefinition, docs map[core.DocumentID]core.Document) (fieldIndex, error) {
+	fi, err := newFieldIndex(def)
+	if err != nil {
+		return nil, err
+	}
+	for docID, doc := range docs {
+		fi.add(docID, doc)
+	}
+	return fi, nil
+}
+
+// newCollectionIndexes builds a primary index over docs plus the given secondary indexes
+func newCollectionIndexes(docs map[core.DocumentID]core.Document, defs []indexDefinition) (*collectionIndexes, error) {
+	idx := &collectionIndexes{
+		primary:   docs,
+		secondary: make(map[string]fieldIndex),
+	}
+	for _, def := range defs {
+		fi, err := buildFieldIndex(def, docs)
+		if err != nil {
+			return nil, err
+		}
+		idx.secondary[def.Name] = fi
+	}
+	return idx, nil
+}
+
+// definitions returns the secondary index definitions, ordered by name
+func (idx *collectionIndexes) definitions() []indexDefinition {
+	defs := make([]indexDefinition, 0, len(idx.secondary))
+	for name, fi := range idx.secondary {
+		def := indexDefinition{Name: name, Fields: fi.fields(), Kind: fi.kind()}
+		switch fi := fi.(type) {
+		case *hashIndex:
+			def.Unique = fi.unique
+			def.UniqueNulls = fi.uniqueNulls
+			def.Sparse = fi.opts.Sparse
+			def.CaseInsensitive = fi.opts.CaseInsensitive
+		case *orderedIndex:
+			def.Sparse = fi.opts.Sparse
+			def.CaseInsensitive = fi.opts.CaseInsensitive
+		case *textIndex:
+			opts := fi.opts
+			def.Text = &opts
+		}
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Name < defs[j].Name })
+	return defs
+}
+
+// scanCollection reads every document of a collection from storage
+func (m *FileIndexManager) scanCollection(collection string) (map[core.DocumentID]core.Document, error) {
+	docs := make(map[core.DocumentID]core.Document)
+	err := m.storage.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		docs[docID] = doc
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan collection %s: %w", collection, err)
+	}
+	return docs, nil
+}
+
+// CreatePrimaryIndex builds the primary key index
+func (m *FileIndexManager) CreatePrimaryIndex(collection string) error {
+	// Read the revision first so a concurrent write can only make it look stale
+	revision, err := m.collectionRevision(collection)
+	if err != nil {
+		return err
+	}
+
+	docs, err := m.scanCollection(collection)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Refresh the primary index and keep existing secondary indexes in sync with it
+	var defs []indexDefinition
+	if existing, exists := m.indexes[collection]; exists {
+		defs = existing.definitions()
+	}
+
+	idx, err := newCollectionIndexes(docs, defs)
+	if err != nil {
+		return err
+	}
+	idx.revision = revision
+	m.indexes[collection] = idx
+	m.version.Add(1)
+	return nil
+}
+
+// CreateSecondaryIndex builds an index of the given kind on a field, creating
+// the primary index if needed. Recreating an index replaces it. The field may
+// be a dotted path into nested documents (see core.GetPath); documents where
+// the path does not resolve are not indexed.
+func (m *FileIndexManager) CreateSecondaryIndex(collection string, field string, kind core.IndexKind) error {
+	if field == "" {
+		return fmt.Errorf("missing field - unable to create index on %s", collection)
+	}
+	switch kind {
+	case core.IndexComposite:
+		return fmt.Errorf("composite indexes are created with CreateCompositeIndex")
+	case core.IndexText:
+		return m.CreateTextIndex(collection, field, TextOptions{})
+	case core.IndexExpiry:
+		return m.CreateExpiryIndex(collection, field)
+	}
+
+	return m.CreateIndexWithOptions(collection, field, kind, IndexOptions{})
+}
+
+// CreateIndexWithOptions builds a hash or ordered index on a field with the
+// given flags. Recreating an index replaces it, including its flags.
+func (m *FileIndexManager) CreateIndexWithOptions(collection string, field string, kind core.IndexKind, opts IndexOptions) error {
+	if field == "" {
+		return fmt.Errorf("missing field - unable to create index on %s", collection)
+	}
+	if kind != core.IndexHash && kind != core.IndexOrdered {
+		return fmt.Errorf("index options are not supported for %s indexes", kind)
+	}
+
+	return m.createIndex(collection, indexDefinition{
+		Name:            field,
+		Fields:          []string{field},
+		Kind:            kind,
+		Sparse:          opts.Sparse,
+		CaseInsensitive: opts.CaseInsensitive,
+	})
+}
+
+// CreateCompositeIndex builds an index over the ordered tuple of several
+// fields. It is named after its fields joined by commas, e.g. "tenant_id,status".
+func (m *FileIndexManager) CreateCompositeIndex(collection string, fields []string) error {
+	if len(fields) < 2 {
+		return fmt.Errorf("composite index on %s needs at least two fields", collection)
+	}
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("missing field - unable to create index on %s", collection)
+		}
+	}
+
+	return m.createIndex(collection, indexDefinition{Name: compositeName(fields), Fields: fields, Kind: core.IndexComposite})
+}
+
+// createIndex builds a secondary index from the primary index, creating the
+// primary index first if needed
+func (m *FileIndexManager) createIndex(collection string, def indexDefinition) error {
+	m.mu.RLock()
+	_, exists := m.indexes[collection]
+	m.mu.RUnlock()
+
+	if !exists {
+		if err := m.CreatePrimaryIndex(collection); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := m.indexes[collection]
+	fi, err := buildFieldIndex(def, idx.primary)
+	if err != nil {
+		return err
+	}
+	if h, ok := fi.(*hashIndex); ok && h.unique {
+		if key, ids, dup := h.duplicate(); dup {
+			return fmt.Errorf("%w: %s.%s value %s is held by %v", ErrUniqueConstraintViolation, collection, def.Name, key, ids)
+		}
+	}
+	idx.secondary[def.Name] = fi
+	m.version.Add(1)
+	return nil
+}
+
+// LookupPrimary performs O(1) lookup by primary key. The returned document is
+// shared with the index and must not be modified.
+func (m *FileIndexManager) LookupPrimary(collection string, docID core.DocumentID) (core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return nil, fmt.Errorf("%w: primary index on %s", ErrIndexNotFound, collection)
+	}
+
+	doc, exists := idx.primary[docID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
+	}
+
+	return doc, nil
+}
+
+// getFieldIndex returns the secondary index on a field. Callers must hold m.mu.
+func (m *FileIndexManager) getFieldIndex(collection string, field string) (*collectionIndexes, fieldIndex, error) {
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s.%s", ErrIndexNotFound, collection, field)
+	}
+
+	fi, exists := idx.secondary[field]
+	if !exists {
+		return nil, nil, fmt.Errorf("%w: %s.%s", ErrIndexNotFound, collection, field)
+	}
+
+	return idx, fi, nil
+}
+
+// documents resolves document IDs through the primary index
+func (idx *collectionIndexes) documents(ids []core.DocumentID) []core.Document {
+	docs := make([]core.Document, 0, len(ids))
+	for _, docID := range ids {
+		docs = append(docs, idx.primary[docID])
+	}
+	return docs
+}
+
+// LookupSecondary finds documents matching a field value. Hash indexes return
+// documents ordered by ID and match array fields containing the value.
+func (m *FileIndexManager) LookupSecondary(collection string, field string, value interface{}) ([]core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.documents(fi.lookup(value)), nil
+}
+
+// LookupSecondaryIDs finds the IDs of documents matching a field value, in
+// the same order as LookupSecondary
+func (m *FileIndexManager) LookupSecondaryIDs(collection string, field string, value interface{}) ([]core.DocumentID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return fi.lookup(value), nil
+}
+
+// ContainsAll finds documents whose array field contains every one of values,
+// ordered by ID. A scalar field matches when it equals the single value given.
+// Requires a hash index on the field.
+func (m *FileIndexManager) ContainsAll(collection string, field string, values []interface{}) ([]core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return nil, err
+	}
+
+	h, ok := fi.(*hashIndex)
+	if !ok {
+		return nil, fmt.Errorf("%w: contains-all on %s index %s.%s", ErrIndexKindMismatch, fi.kind(), collection, field)
+	}
+
+	return idx.documents(h.lookupAll(values)), nil
+}
+
+// LookupComposite finds documents through a composite index over fields,
+// matching the leading len(values) fields. Supplying fewer values than fields
+// is a prefix match. Results are ordered by the indexed tuple, then document ID.
+func (m *FileIndexManager) LookupComposite(collection string, fields []string, values []interface{}) ([]core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, ids, err := m.lookupComposite(collection, fields, values)
+	if err != nil {
+		return nil, err
+	}
+	return idx.documents(ids), nil
+}
+
+// LookupCompositeIDs is LookupComposite returning document IDs
+func (m *FileIndexManager) LookupCompositeIDs(collection string, fields []string, values []interface{}) ([]core.DocumentID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ids, err := m.lookupComposite(collection, fields, values)
+	return ids, err
+}
+
+// lookupComposite resolves a prefix match through a composite index. Callers must hold m.mu.
+func (m *FileIndexManager) lookupComposite(collection string, fields []string, values []interface{}) (*collectionIndexes, []core.DocumentID, error) {
+	if len(values) == 0 || len(values) > len(fields) {
+		return nil, nil, fmt.Errorf("composite lookup needs between 1 and %d values, got %d", len(fields), len(values))
+	}
+
+	idx, fi, err := m.getFieldIndex(collection, compositeName(fields))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	composite, ok := fi.(*compositeIndex)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: composite lookup on %s index %s", ErrIndexKindMismatch, fi.kind(), compositeName(fields))
+	}
+
+	return idx, composite.lookupPrefix(values), nil
+}
+
+// Range returns documents whose field value lies between min and max, in
+// ascending value order. A nil bound leaves that side open. Requires an
+// ordered index on the field.
+func (m *FileIndexManager) Range(collection string, field string, min, max interface{}, includeMin, includeMax bool) ([]core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, ids, err := m.rangeIDs(collection, field, min, max, includeMin, includeMax)
+	if err != nil {
+		return nil, err
+	}
+	return idx.documents(ids), nil
+}
+
+// RangeIDs is Range returning document IDs
+func (m *FileIndexManager) RangeIDs(collection string, field string, min, max interface{}, includeMin, includeMax bool) ([]core.DocumentID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ids, err := m.rangeIDs(collection, field, min, max, includeMin, includeMax)
+	return ids, err
+}
+
+// rangeIDs resolves a range through an ordered index. Callers must hold m.mu.
+func (m *FileIndexManager) rangeIDs(collection string, field string, min, max interface{}, includeMin, includeMax bool) (*collectionIndexes, []core.DocumentID, error) {
+	idx, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ordered, ok := fi.(*orderedIndex)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: range on %s index %s.%s", ErrIndexKindMismatch, fi.kind(), collection, field)
+	}
+
+	var minKey, maxKey *sortKey
+	if min != nil {
+		k := ordered.keyFor(min)
+		minKey = &k
+	}
+	if max != nil {
+		k := ordered.keyFor(max)
+		maxKey = &k
+	}
+
+	return idx, ordered.rangeIDs(minKey, maxKey, includeMin, includeMax), nil
+}
+
+// Ascend calls fn for every indexed document in field value order until fn
+// returns false. Documents missing the field are not visited. Requires an
+// ordered index on the field.
+func (m *FileIndexManager) Ascend(collection string, field string, descending bool, fn func(core.DocumentID, core.Document) bool) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return err
+	}
+
+	ordered, ok := fi.(*orderedIndex)
+	if !ok {
+		return fmt.Errorf("%w: ordered scan on %s index %s.%s", ErrIndexKindMismatch, fi.kind(), collection, field)
+	}
+
+	ordered.ascend(descending, func(docID core.DocumentID) bool {
+		return fn(docID, idx.primary[docID])
+	})
+	return nil
+}
+
+// sortedIDs returns the members of an ID set in ascending order
+func sortedIDs(set map[core.DocumentID]struct{}) []core.DocumentID {
+	ids := make([]core.DocumentID, 0, len(set))
+	for docID := range set {
+		ids = append(ids, docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// UpdateIndexes updates all indexes after a write operation. Collections
+// without indexes are ignored. The revision the write produced is unknown
+// here, so the indexes keep the revision they reflect and look stale until
+// rebuilt; writers that go through the manager keep them current.
+func (m *FileIndexManager) UpdateIndexes(collection string, docID core.DocumentID, doc core.Document, op core.OperationType) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch op {
+	case core.OpInsert, core.OpUpdate, core.OpDelete:
+	default:
+		return fmt.Errorf("unknown operation type: %d", op)
+	}
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return nil
+	}
+
+	idx.apply(docID, doc, op)
+	return nil
+}
+
+// advanceRevision records that the indexes reflect the revision a write left
+// their collection at, as recorded under core.WithRevisions. They advance
+// only from the revision they reflect, so a write that bypassed them leaves
+// them stale. Callers must hold m.mu.
+func (idx *collectionIndexes) advanceRevision(change core.RevisionChange) {
+	if change.From == idx.revision {
+		idx.revision = change.To
+	}
+}
+
+// apply replaces the indexed state of a document. Callers must hold m.mu.
+func (idx *collectionIndexes) apply(docID core.DocumentID, doc core.Document, op core.OperationType) {
+	// Remove entries for the previous version of the document
+	if old, exists := idx.primary[docID]; exists {
+		for _, fi := range idx.secondary {
+			fi.remove(docID, old)
+		}
+	}
+
+	if op == core.OpDelete {
+		delete(idx.primary, docID)
+		return
+	}
+
+	idx.primary[docID] = doc
+	for _, fi := range idx.secondary {
+		fi.add(docID, doc)
+	}
+}
+
+// PersistIndexes writes indexes to disk
+func (m *FileIndexManager) PersistIndexes(collection string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrIndexNotFound, collection)
+	}
+	return m.persist(collection, idx)
+}
+
+// persist writes a collection's indexes to its index file, tagged with the
+// revision they reflect. Callers must hold m.mu.
+func (m *FileIndexManager) persist(collection string, idx *collectionIndexes) error {
+	return writeIndexFile(m.getIndexPath(collection), collection, idx)
+}
+
+// writeIndexFile writes a collection's indexes to an index file
+func writeIndexFile(path, collection string, idx *collectionIndexes) error {
+	checksum, err := contentChecksum(idx.primary)
+	if err != nil {
+		return err
+	}
+
+	file := indexFile{
+		Collection:    collection,
+		Revision:      idx.revision,
+		Checksum:      checksum,
+		DocumentCount: len(idx.primary),
+		Primary:       idx.primary,
+		Indexes:       idx.definitions(),
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal index file: %w", err)
+	}
+
+	return fsutil.WriteFileAtomic(path, data)
+}
+
+// LoadIndexes reads indexes from disk. A missing, stale or corrupt index
+// file is rebuilt from storage instead, and the rebuild handler is notified.
+func (m *FileIndexManager) LoadIndexes(collection string) error {
+	file, err := m.readIndexFile(collection)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, ErrIndexStale) || errors.Is(err, ErrIndexCorrupt) {
+			if err := m.RebuildIndexes(collection); err != nil {
+				return err
+			}
+			m.mu.RLock()
+			onRebuild := m.onRebuild
+			m.mu.RUnlock()
+			if onRebuild != nil {
+				onRebuild(collection, err)
+			}
+			return nil
+		}
+		return err
+	}
+
+	if file.Primary == nil {
+		file.Primary = make(map[core.DocumentID]core.Document)
+	}
+
+	idx, err := newCollectionIndexes(file.Primary, file.Indexes)
+	if err != nil {
+		return err
+	}
+	idx.revision = file.Revision
+
+	m.mu.Lock()
+	m.indexes[collection] = idx
+	m.version.Add(1)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// readIndexFile reads and validates a persisted index file. It returns
+// ErrIndexCorrupt when the file does not match its checksum and ErrIndexStale
+// when the collection has changed since the index was persisted.
+func (m *FileIndexManager) readIndexFile(collection string) (*indexFile, error) {
+	data, err := os.ReadFile(m.getIndexPath(collection))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse index file: %v", ErrIndexCorrupt, err)
+	}
+
+	checksum, err := contentChecksum(file.Primary)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != file.Checksum {
+		return nil, fmt.Errorf("%w: %s checksum mismatch", ErrIndexCorrupt, collection)
+	}
+
+	stale, err := m.isStale(collection, &file)
+	if err != nil {
+		return nil, err
+	}
+	if stale {
+		return nil, fmt.Errorf("%w: %s", ErrIndexStale, collection)
+	}
+
+	return &file, nil
+}
+
+// isStale compares a persisted index against the current collection state.
+// Revisions are compared when the storage engine tracks them; otherwise the
+// collection's content checksum is compared.
+func (m *FileIndexManager) isStale(collection string, file *indexFile) (bool, error) {
+	if r, ok := m.storage.(revisioner); ok {
+		revision, err := r.CollectionRevision(collection)
+		if err != nil {
+			return false, err
+		}
+		return revision != file.Revision, nil
+	}
+
+	docs, err := m.scanCollection(collection)
+	if err != nil {
+		return false, err
+	}
+	checksum, err := contentChecksum(docs)
+	if err != nil {
+		return false, err
+	}
+
+	return checksum != file.Checksum, nil
+}
+
+// collectionRevision returns the storage revision of a collection, or 0 when
+// the storage engine does not track revisions
+func (m *FileIndexManager) collectionRevision(collection string) (uint64, error) {
+	if r, ok := m.storage.(revisioner); ok {
+		return r.CollectionRevision(collection)
+	}
+	return 0, nil
+}
+
+// RebuildIndexes reconstructs indexes from storage, keeping the secondary
+// index definitions that exist in memory or on disk
+func (m *FileIndexManager) RebuildIndexes(collection string) error {
+	defs := m.knownDefinitions(collection)
+
+	revision, err := m.collectionRevision(collection)
+	if err != nil {
+		return err
+	}
+
+	docs, err := m.scanCollection(collection)
+	if err != nil {
+		return err
+	}
+
+	idx, err := newCollectionIndexes(docs, defs)
+	if err != nil {
+		return err
+	}
+	idx.revision = revision
+
+	m.mu.Lock()
+	m.indexes[collection] = idx
+	m.version.Add(1)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// knownDefinitions returns the secondary index definitions for a collection,
+// falling back to the persisted index file when nothing is loaded in memory
+func (m *FileIndexManager) knownDefinitions(collection string) []indexDefinition {
+	m.mu.RLock()
+	idx, exists := m.indexes[collection]
+	if exists {
+		defs := idx.definitions()
+		m.mu.RUnlock()
+		return defs
+	}
+	m.mu.RUnlock()
+
+	// Only the definitions are needed, so staleness does not matter here
+	data, err := os.ReadFile(m.getIndexPath(collection))
+	if err != nil {
+		return nil
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil
+	}
+	return file.Indexes
+}
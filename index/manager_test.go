@@ -0,0 +1,270 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func setupTestManager(t *testing.T) (*FileIndexManager, *storage.FileStorageEngine, string) {
+	tempDir, err := os.MkdirTemp("", "index_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	engine, err := storage.NewFileStorageEngine(tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	manager, err := NewFileIndexManager(engine, tempDir)
+	if err != nil {
+		engine.Close()
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+
+	t.Cleanup(func() {
+		engine.Close()
+		os.RemoveAll(tempDir)
+	})
+
+	return manager, engine, tempDir
+}
+
+func seedUsers(t *testing.T, engine core.StorageEngine, n int) {
+	for i := 0; i < n; i++ {
+		docID := core.DocumentID(fmt.Sprintf("user_%03d", i))
+		doc := core.Document{
+			"id":   string(docID),
+			"name": fmt.Sprintf("User %d", i),
+			"age":  20 + i%5,
+		}
+		if err := engine.WriteDocument("users", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestCreatePrimaryIndexAndLookup(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 10)
+
+	if _, err := manager.LookupPrimary("users", "user_001"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound before index creation, got %v", err)
+	}
+
+	if err := manager.CreatePrimaryIndex("users"); err != nil {
+		t.Fatalf("Failed to create primary index: %v", err)
+	}
+
+	doc, err := manager.LookupPrimary("users", "user_003")
+	if err != nil {
+		t.Fatalf("Failed to lookup document: %v", err)
+	}
+	if doc["name"] != "User 3" {
+		t.Errorf("Expected 'User 3', got %v", doc["name"])
+	}
+
+	if _, err := manager.LookupPrimary("users", "missing"); err == nil {
+		t.Errorf("Expected error for missing document")
+	}
+}
+
+func TestSecondaryIndexLookup(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 10)
+
+	if err := manager.CreateSecondaryIndex("users", "age", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create secondary index: %v", err)
+	}
+
+	// Stored as float64, queried as int
+	docs, err := manager.LookupSecondary("users", "age", 22)
+	if err != nil {
+		t.Fatalf("Failed to lookup secondary index: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents with age 22, got %d", len(docs))
+	}
+	if docs[0]["id"] != "user_002" || docs[1]["id"] != "user_007" {
+		t.Errorf("Expected documents ordered by ID, got %v, %v", docs[0]["id"], docs[1]["id"])
+	}
+
+	if _, err := manager.LookupSecondary("users", "name", "User 1"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound for unindexed field, got %v", err)
+	}
+}
+
+func TestUpdateIndexes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 5)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+
+	// Update moves the document to a new bucket
+	updated := core.Document{"id": "user_000", "name": "User 0", "age": 99}
+	if err := manager.UpdateIndexes("users", "user_000", updated, core.OpUpdate); err != nil {
+		t.Fatalf("Failed to update indexes: %v", err)
+	}
+
+	if docs, _ := manager.LookupSecondary("users", "age", 20); len(docs) != 0 {
+		t.Errorf("Expected stale entry to be removed, got %d documents", len(docs))
+	}
+	if docs, _ := manager.LookupSecondary("users", "age", 99); len(docs) != 1 {
+		t.Errorf("Expected updated document under new value, got %d documents", len(docs))
+	}
+
+	// Insert
+	inserted := core.Document{"id": "user_100", "age": 99}
+	manager.UpdateIndexes("users", "user_100", inserted, core.OpInsert)
+	if docs, _ := manager.LookupSecondary("users", "age", 99); len(docs) != 2 {
+		t.Errorf("Expected 2 documents after insert, got %d", len(docs))
+	}
+
+	// Delete
+	manager.UpdateIndexes("users", "user_000", nil, core.OpDelete)
+	if _, err := manager.LookupPrimary("users", "user_000"); err == nil {
+		t.Errorf("Expected deleted document to be gone from primary index")
+	}
+	if docs, _ := manager.LookupSecondary("users", "age", 99); len(docs) != 1 {
+		t.Errorf("Expected 1 document after delete, got %d", len(docs))
+	}
+}
+
+func TestPersistAndLoadIndexes(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedUsers(t, engine, 10)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+
+	if err := manager.PersistIndexes("users"); err != nil {
+		t.Fatalf("Failed to persist indexes: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "users.idx.json")); err != nil {
+		t.Fatalf("Index file was not written: %v", err)
+	}
+
+	// Index files must not show up as collections
+	collections, _ := engine.ListCollections()
+	if len(collections) != 1 || collections[0] != "users" {
+		t.Errorf("Expected only the users collection, got %v", collections)
+	}
+
+	reloaded, err := NewFileIndexManager(engine, tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	if _, err := reloaded.LookupPrimary("users", "user_009"); err != nil {
+		t.Errorf("Expected loaded primary index to contain user_009: %v", err)
+	}
+	if docs, _ := reloaded.LookupSecondary("users", "age", 24); len(docs) != 2 {
+		t.Errorf("Expected 2 documents with age 24 after reload, got %d", len(docs))
+	}
+}
+
+func TestReadIndexFileDetectsStaleness(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 3)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+	manager.PersistIndexes("users")
+
+	if _, err := manager.readIndexFile("users"); err != nil {
+		t.Fatalf("Expected fresh index file, got %v", err)
+	}
+
+	// A write the index manager never saw makes the persisted index stale
+	engine.WriteDocument("users", "user_999", core.Document{"age": 20})
+
+	if _, err := manager.readIndexFile("users"); !errors.Is(err, ErrIndexStale) {
+		t.Errorf("Expected ErrIndexStale, got %v", err)
+	}
+}
+
+func TestLoadIndexesRebuildsStaleIndex(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedUsers(t, engine, 3)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+	manager.PersistIndexes("users")
+
+	engine.WriteDocument("users", "user_999", core.Document{"age": 20})
+	engine.DeleteDocument("users", "user_001")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	if _, err := reloaded.LookupPrimary("users", "user_999"); err != nil {
+		t.Errorf("Expected rebuilt index to contain user_999: %v", err)
+	}
+	if _, err := reloaded.LookupPrimary("users", "user_001"); err == nil {
+		t.Errorf("Expected rebuilt index to drop user_001")
+	}
+
+	// Secondary definitions survive the rebuild
+	docs, err := reloaded.LookupSecondary("users", "age", 20)
+	if err != nil {
+		t.Fatalf("Expected secondary index after rebuild: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("Expected 2 documents with age 20, got %d", len(docs))
+	}
+}
+
+func TestLoadIndexesRebuildsMissingIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 4)
+
+	if err := manager.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	if _, err := manager.LookupPrimary("users", "user_003"); err != nil {
+		t.Errorf("Expected primary index to be built from storage: %v", err)
+	}
+}
+
+func TestCollectionEndToEnd(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	manager.CreateSecondaryIndex("users", "email", core.IndexHash)
+
+	users := core.Collection{Name: "users", Storage: engine, Indexes: manager}
+
+	if err := users.WriteDocument("u1", core.Document{"email": "a@example.com"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	users.WriteDocument("u2", core.Document{"email": "b@example.com"})
+	users.WriteDocument("u1", core.Document{"email": "c@example.com"})
+
+	doc, err := users.ReadDocument("u1")
+	if err != nil || doc["email"] != "c@example.com" {
+		t.Errorf("Expected updated u1, got %v (%v)", doc, err)
+	}
+
+	if docs, _ := users.FindBy("email", "a@example.com"); len(docs) != 0 {
+		t.Errorf("Expected old email to be unindexed, got %v", docs)
+	}
+
+	if err := users.DeleteDocument("u2"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if docs, _ := users.FindBy("email", "b@example.com"); len(docs) != 0 {
+		t.Errorf("Expected deleted document to be unindexed, got %v", docs)
+	}
+
+	// Persisted after the writes, the index is fresh on reload
+	manager.PersistIndexes("users")
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if _, err := reloaded.readIndexFile("users"); err != nil {
+		t.Errorf("Expected index to be fresh after collection writes, got %v", err)
+	}
+}
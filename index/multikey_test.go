@@ -0,0 +1,118 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedPosts(t *testing.T, manager *FileIndexManager, engine core.StorageEngine) {
+	posts := map[core.DocumentID]core.Document{
+		"p1": {"tags": []interface{}{"go", "db"}},
+		"p2": {"tags": []interface{}{"go", "go", "web"}}, // duplicate element
+		"p3": {"tags": []interface{}{"db", 42.0, true, nil}},
+		"p4": {"tags": []interface{}{}},
+		"p5": {"tags": "go"}, // scalar
+		"p6": {"title": "untagged"},
+	}
+	for docID, doc := range posts {
+		doc["id"] = string(docID)
+		if err := engine.WriteDocument("posts", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+
+	if err := manager.CreateSecondaryIndex("posts", "tags", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+}
+
+func TestMultikeyLookupMatchesAnyElement(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedPosts(t, manager, engine)
+
+	tests := []struct {
+		value    interface{}
+		expected []string
+	}{
+		{"go", []string{"p1", "p2", "p5"}},
+		{"db", []string{"p1", "p3"}},
+		{42, []string{"p3"}},
+		{true, []string{"p3"}},
+		{nil, []string{"p3"}},
+		{"rust", []string{}},
+	}
+
+	for _, tt := range tests {
+		docs, err := manager.LookupSecondary("posts", "tags", tt.value)
+		if err != nil {
+			t.Fatalf("Lookup failed: %v", err)
+		}
+		if got := docIDs(docs); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Lookup %v: expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestMultikeyUpdateRemovesStaleElements(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedPosts(t, manager, engine)
+
+	manager.UpdateIndexes("posts", "p1", core.Document{"id": "p1", "tags": []interface{}{"db", "rust"}}, core.OpUpdate)
+	manager.UpdateIndexes("posts", "p2", core.Document{"id": "p2", "tags": []interface{}{}}, core.OpUpdate)
+
+	docs, _ := manager.LookupSecondary("posts", "tags", "go")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p5"}) {
+		t.Errorf("Expected only p5 tagged go, got %v", got)
+	}
+	docs, _ = manager.LookupSecondary("posts", "tags", "rust")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Errorf("Expected p1 tagged rust, got %v", got)
+	}
+	if _, exists := manager.indexes["posts"].secondary["tags"].(*hashIndex).entries[valueKey("web")]; exists {
+		t.Errorf("Expected empty entry for removed element to be dropped")
+	}
+}
+
+func TestMultikeyContainsAll(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedPosts(t, manager, engine)
+
+	docs, err := manager.ContainsAll("posts", "tags", []interface{}{"go", "db"})
+	if err != nil {
+		t.Fatalf("ContainsAll failed: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Errorf("Expected [p1], got %v", got)
+	}
+
+	docs, _ = manager.ContainsAll("posts", "tags", []interface{}{"go"})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p1", "p2", "p5"}) {
+		t.Errorf("Expected [p1 p2 p5], got %v", got)
+	}
+
+	if docs, _ := manager.ContainsAll("posts", "tags", nil); len(docs) != 0 {
+		t.Errorf("Expected no documents for empty values, got %d", len(docs))
+	}
+
+	manager.CreateSecondaryIndex("posts", "title", core.IndexOrdered)
+	if _, err := manager.ContainsAll("posts", "title", []interface{}{"x"}); !errors.Is(err, ErrIndexKindMismatch) {
+		t.Errorf("Expected ErrIndexKindMismatch, got %v", err)
+	}
+}
+
+func TestMultikeyUniqueIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	manager.CreateUniqueIndex("accounts", "emails")
+
+	manager.WriteIndexed("accounts", "a1", core.Document{"emails": []interface{}{"a@example.com", "a@example.com"}})
+	err := manager.WriteIndexed("accounts", "a2", core.Document{"emails": []interface{}{"b@example.com", "a@example.com"}})
+	if !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected shared element to violate the unique index, got %v", err)
+	}
+	if _, err := engine.ReadDocument("accounts", "a2"); err == nil {
+		t.Errorf("Expected rejected document not to be stored")
+	}
+}
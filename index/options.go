@@ -0,0 +1,39 @@
+package index
+
+import "strings"
+
+// IndexOptions are flags set when a hash or ordered index is created. They are
+// persisted with the index definition so a reloaded index behaves identically.
+type IndexOptions struct {
+	// Sparse excludes documents whose field is missing or null, so only
+	// documents with an actual value are indexed
+	Sparse bool
+
+	// CaseInsensitive lowercases string values, including array elements,
+	// when indexing and looking up
+	CaseInsensitive bool
+}
+
+// normalize applies the case-insensitive option to a field or lookup value
+func (o IndexOptions) normalize(value interface{}) interface{} {
+	if !o.CaseInsensitive {
+		return value
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.ToLower(v)
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for i, element := range v {
+			normalized[i] = o.normalize(element)
+		}
+		return normalized
+	}
+	return value
+}
+
+// skips reports whether a resolved field value is left out of the index
+func (o IndexOptions) skips(value interface{}) bool {
+	return o.Sparse && value == nil
+}
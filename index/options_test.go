@@ -0,0 +1,137 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestSparseIndexExcludesMissingAndNull(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"id": "u1", "nickname": "al"})
+	engine.WriteDocument("users", "u2", core.Document{"id": "u2", "nickname": nil})
+	engine.WriteDocument("users", "u3", core.Document{"id": "u3"})
+
+	manager.CreateSecondaryIndex("users", "nickname", core.IndexOrdered)
+	manager.CreateIndexWithOptions("sparse", "nickname", core.IndexOrdered, IndexOptions{Sparse: true})
+	for _, docID := range []core.DocumentID{"u1", "u2", "u3"} {
+		doc, _ := engine.ReadDocument("users", docID)
+		manager.UpdateIndexes("sparse", docID, doc, core.OpInsert)
+	}
+
+	dense, _ := manager.Range("users", "nickname", nil, nil, true, true)
+	if got := docIDs(dense); !reflect.DeepEqual(got, []string{"u2", "u1"}) {
+		t.Errorf("Expected dense index to hold the explicit null, got %v", got)
+	}
+
+	sparse, _ := manager.Range("sparse", "nickname", nil, nil, true, true)
+	if got := docIDs(sparse); !reflect.DeepEqual(got, []string{"u1"}) {
+		t.Errorf("Expected sparse index to hold only real values, got %v", got)
+	}
+
+	// Setting the value later brings the document into the sparse index
+	manager.UpdateIndexes("sparse", "u3", core.Document{"id": "u3", "nickname": "zed"}, core.OpUpdate)
+	sparse, _ = manager.Range("sparse", "nickname", nil, nil, true, true)
+	if got := docIDs(sparse); !reflect.DeepEqual(got, []string{"u1", "u3"}) {
+		t.Errorf("Expected [u1 u3], got %v", got)
+	}
+}
+
+func TestSparseUniqueIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+
+	opts := UniqueOptions{IndexOptions: IndexOptions{Sparse: true}, RejectDuplicateNulls: true}
+	if err := manager.CreateUniqueIndexWithOptions("users", "referral_code", opts); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	for i, doc := range []core.Document{{}, {}, {"referral_code": nil}, {"referral_code": nil}, {"referral_code": "R1"}} {
+		if err := users.WriteDocument(core.DocumentID(fmt.Sprintf("u%d", i)), doc); err != nil {
+			t.Errorf("Expected write of %v to succeed, got %v", doc, err)
+		}
+	}
+
+	if err := users.WriteDocument("dup", core.Document{"referral_code": "R1"}); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected duplicate referral code to be rejected, got %v", err)
+	}
+}
+
+func TestCaseInsensitiveIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"id": "u1", "email": "alice@example.com", "aliases": []interface{}{"Ally", "AL"}})
+	engine.WriteDocument("users", "u2", core.Document{"id": "u2", "email": "BOB@example.com"})
+
+	manager.CreateIndexWithOptions("users", "email", core.IndexHash, IndexOptions{CaseInsensitive: true})
+	manager.CreateIndexWithOptions("users", "aliases", core.IndexHash, IndexOptions{CaseInsensitive: true})
+
+	docs, _ := manager.LookupSecondary("users", "email", "Alice@Example.com")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"u1"}) {
+		t.Errorf("Expected [u1], got %v", got)
+	}
+	docs, _ = manager.LookupSecondary("users", "aliases", "ally")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"u1"}) {
+		t.Errorf("Expected case-insensitive array match, got %v", got)
+	}
+
+	manager.CreateIndexWithOptions("users", "email", core.IndexOrdered, IndexOptions{CaseInsensitive: true})
+	docs, _ = manager.Range("users", "email", "A", "C", true, false)
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"u1", "u2"}) {
+		t.Errorf("Expected case-insensitive range [u1 u2], got %v", got)
+	}
+}
+
+func TestCaseInsensitiveUniqueIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndexWithOptions("users", "email", UniqueOptions{IndexOptions: IndexOptions{CaseInsensitive: true}})
+
+	users.WriteDocument("u1", core.Document{"email": "alice@example.com"})
+	if err := users.WriteDocument("u2", core.Document{"email": "ALICE@example.com"}); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected differently cased email to be rejected, got %v", err)
+	}
+	if err := users.WriteDocument("u1", core.Document{"email": "Alice@Example.com"}); err != nil {
+		t.Errorf("Expected holder to change case of its own value, got %v", err)
+	}
+}
+
+func TestIndexOptionsSurviveReload(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"id": "u1", "email": "alice@example.com"})
+	engine.WriteDocument("users", "u2", core.Document{"id": "u2", "email": nil})
+
+	manager.CreateUniqueIndexWithOptions("users", "email", UniqueOptions{
+		IndexOptions:         IndexOptions{Sparse: true, CaseInsensitive: true},
+		RejectDuplicateNulls: true,
+	})
+	manager.PersistIndexes("users")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	docs, _ := reloaded.LookupSecondary("users", "email", "ALICE@EXAMPLE.COM")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"u1"}) {
+		t.Errorf("Expected case-insensitive lookup after reload, got %v", got)
+	}
+	if docs, _ := reloaded.LookupSecondary("users", "email", nil); len(docs) != 0 {
+		t.Errorf("Expected sparse index after reload, got %v", docIDs(docs))
+	}
+	if err := reloaded.WriteIndexed("users", "u3", core.Document{"email": "Alice@example.com"}); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected unique constraint after reload, got %v", err)
+	}
+	if err := reloaded.WriteIndexed("users", "u4", core.Document{"email": nil}); err != nil {
+		t.Errorf("Expected sparse unique index to allow nulls after reload, got %v", err)
+	}
+}
+
+func TestIndexOptionsRejectUnsupportedKinds(t *testing.T) {
+	manager, _, _ := setupTestManager(t)
+	if err := manager.CreateIndexWithOptions("users", "bio", core.IndexText, IndexOptions{Sparse: true}); err == nil {
+		t.Errorf("Expected error for options on a text index")
+	}
+}
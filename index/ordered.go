@@ -0,0 +1,253 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Value classes in ascending sort order. Values of different classes never
+// compare equal; a field holding both numbers and strings sorts every number
+// before every string.
+const (
+	classNull = iota
+	classBool
+	classNumber
+	classTime
+	classString
+	classOther
+)
+
+// sortKey is the comparable form of a field value
+type sortKey struct {
+	class int
+	num   float64
+	t     time.Time
+	str   string
+}
+
+// newSortKey classifies a value. Strings that parse as RFC3339 timestamps are
+// ordered as instants, so "2024-01-01T10:00:00+02:00" sorts before
+// "2024-01-01T09:00:00Z".
+func newSortKey(value interface{}) sortKey {
+	switch v := value.(type) {
+	case nil:
+		return sortKey{class: classNull}
+	case bool:
+		if v {
+			return sortKey{class: classBool, num: 1}
+		}
+		return sortKey{class: classBool}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return sortKey{class: classTime, t: t, str: v}
+		}
+		return sortKey{class: classString, str: v}
+	}
+
+	if f, ok := core.ToFloat64(value); ok {
+		return sortKey{class: classNumber, num: f}
+	}
+
+	data, _ := json.Marshal(value)
+	return sortKey{class: classOther, str: string(data)}
+}
+
+// compareSortKeys returns -1, 0 or 1 as a sorts before, equal to or after b
+func compareSortKeys(a, b sortKey) int {
+	if a.class != b.class {
+		if a.class < b.class {
+			return -1
+		}
+		return 1
+	}
+
+	switch a.class {
+	case classBool, classNumber:
+		switch {
+		case a.num < b.num:
+			return -1
+		case a.num > b.num:
+			return 1
+		}
+		return 0
+	case classTime:
+		return a.t.Compare(b.t)
+	case classString, classOther:
+		return strings.Compare(a.str, b.str)
+	}
+	return 0
+}
+
+// orderedEntry is a single (value, document) pair in an ordered index
+type orderedEntry struct {
+	key   sortKey
+	docID core.DocumentID
+}
+
+// orderedIndex keeps entries sorted by field value, then document ID
+type orderedIndex struct {
+	field   string
+	opts    IndexOptions
+	entries []orderedEntry
+}
+
+// newOrderedIndex creates an empty ordered index on a field
+func newOrderedIndex(field string) *orderedIndex {
+	return &orderedIndex{field: field}
+}
+
+// kind returns the index kind
+func (o *orderedIndex) kind() core.IndexKind {
+	return core.IndexOrdered
+}
+
+// fields returns the indexed field
+func (o *orderedIndex) fields() []string {
+	return []string{o.field}
+}
+
+// compareEntries orders entries by key, breaking ties by document ID
+func compareEntries(a, b orderedEntry) int {
+	if c := compareSortKeys(a.key, b.key); c != 0 {
+		return c
+	}
+	return strings.Compare(string(a.docID), string(b.docID))
+}
+
+// search returns the position of the first entry not less than e
+func (o *orderedIndex) search(e orderedEntry) int {
+	return sort.Search(len(o.entries), func(i int) bool {
+		return compareEntries(o.entries[i], e) >= 0
+	})
+}
+
+// entryFor resolves a document's entry, reporting false if it is not indexed
+func (o *orderedIndex) entryFor(docID core.DocumentID, doc core.Document) (orderedEntry, bool) {
+	value, ok := core.GetPath(doc, o.field)
+	if !ok || o.opts.skips(value) {
+		return orderedEntry{}, false
+	}
+	return orderedEntry{key: o.keyFor(value), docID: docID}, true
+}
+
+// keyFor returns the sort key of a field or lookup value
+func (o *orderedIndex) keyFor(value interface{}) sortKey {
+	return newSortKey(o.opts.normalize(value))
+}
+
+// add inserts a document at its sorted position, if the field is present
+func (o *orderedIndex) add(docID core.DocumentID, doc core.Document) {
+	e, ok := o.entryFor(docID, doc)
+	if !ok {
+		return
+	}
+
+	i := o.search(e)
+	o.entries = append(o.entries, orderedEntry{})
+	copy(o.entries[i+1:], o.entries[i:])
+	o.entries[i] = e
+}
+
+// remove drops a document from the index using its previously indexed state
+func (o *orderedIndex) remove(docID core.DocumentID, doc core.Document) {
+	e, ok := o.entryFor(docID, doc)
+	if !ok {
+		return
+	}
+
+	i := o.search(e)
+	if i < len(o.entries) && compareEntries(o.entries[i], e) == 0 {
+		o.entries = append(o.entries[:i], o.entries[i+1:]...)
+	}
+}
+
+// lookup returns the IDs of documents whose field equals value
+func (o *orderedIndex) lookup(value interface{}) []core.DocumentID {
+	key := o.keyFor(value)
+	return o.rangeIDs(&key, &key, true, true)
+}
+
+// stats returns the number of indexed documents and a rough size in bytes
+func (o *orderedIndex) stats() (int, int64) {
+	var size int64
+	for _, e := range o.entries {
+		size += int64(len(e.key.str)+len(e.docID)) + sliceEntryOverhead
+	}
+	return len(o.entries), size
+}
+
+// entrySet returns every (value, document) pair keyed by its encoding
+func (o *orderedIndex) entrySet() map[string]core.DocumentID {
+	set := make(map[string]core.DocumentID, len(o.entries))
+	for _, e := range o.entries {
+		set[fmt.Sprintf("%v\x00%s", e.key, e.docID)] = e.docID
+	}
+	return set
+}
+
+// rangeIDs returns document IDs with values between min and max in ascending
+// value order. A nil bound is open on that side but stays within the class
+// of the other bound, so a range above a number holds no strings. With both
+// bounds nil, every entry is in range.
+func (o *orderedIndex) rangeIDs(min, max *sortKey, includeMin, includeMax bool) []core.DocumentID {
+	start := 0
+	if min == nil && max != nil {
+		start = sort.Search(len(o.entries), func(i int) bool {
+			return o.entries[i].key.class >= max.class
+		})
+	}
+	if min != nil {
+		start = sort.Search(len(o.entries), func(i int) bool {
+			c := compareSortKeys(o.entries[i].key, *min)
+			if includeMin {
+				return c >= 0
+			}
+			return c > 0
+		})
+	}
+
+	end := len(o.entries)
+	if max == nil && min != nil {
+		end = sort.Search(len(o.entries), func(i int) bool {
+			return o.entries[i].key.class > min.class
+		})
+	}
+	if max != nil {
+		end = sort.Search(len(o.entries), func(i int) bool {
+			c := compareSortKeys(o.entries[i].key, *max)
+			if includeMax {
+				return c > 0
+			}
+			return c >= 0
+		})
+	}
+
+	var ids []core.DocumentID
+	for i := start; i < end; i++ {
+		ids = append(ids, o.entries[i].docID)
+	}
+	return ids
+}
+
+// ascend calls fn for each entry in value order until fn returns false
+func (o *orderedIndex) ascend(descending bool, fn func(core.DocumentID) bool) {
+	if descending {
+		for i := len(o.entries) - 1; i >= 0; i-- {
+			if !fn(o.entries[i].docID) {
+				return
+			}
+		}
+		return
+	}
+
+	for _, e := range o.entries {
+		if !fn(e.docID) {
+			return
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// docIDs extracts the "id" field of each document
+func docIDs(docs []core.Document) []string {
+	ids := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, fmt.Sprint(doc["id"]))
+	}
+	return ids
+}
+
+func seedScores(t *testing.T, manager *FileIndexManager, engine core.StorageEngine) {
+	scores := map[string]interface{}{
+		"a": 10, "b": 20, "c": 20, "d": 30, "e": 40,
+	}
+	for id, score := range scores {
+		engine.WriteDocument("scores", core.DocumentID(id), core.Document{"id": id, "score": score})
+	}
+	if err := manager.CreateSecondaryIndex("scores", "score", core.IndexOrdered); err != nil {
+		t.Fatalf("Failed to create ordered index: %v", err)
+	}
+}
+
+func TestOrderedRangeBoundaries(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedScores(t, manager, engine)
+
+	tests := []struct {
+		name     string
+		min, max interface{}
+		incMin   bool
+		incMax   bool
+		expected []string
+	}{
+		{"inclusive both", 20, 30, true, true, []string{"b", "c", "d"}},
+		{"exclusive min", 20, 30, false, true, []string{"d"}},
+		{"exclusive max", 20, 30, true, false, []string{"b", "c"}},
+		{"exclusive both", 20, 30, false, false, []string{}},
+		{"open min", nil, 20, false, true, []string{"a", "b", "c"}},
+		{"open max", 30, nil, true, false, []string{"d", "e"}},
+		{"unbounded", nil, nil, false, false, []string{"a", "b", "c", "d", "e"}},
+		{"empty range", 50, 60, true, true, []string{}},
+		{"between values", 11, 19, true, true, []string{}},
+		{"float bound", 19.5, 20.0, true, true, []string{"b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := manager.Range("scores", "score", tt.min, tt.max, tt.incMin, tt.incMax)
+			if err != nil {
+				t.Fatalf("Range failed: %v", err)
+			}
+			if got := docIDs(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOrderedIndexEqualityLookup(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedScores(t, manager, engine)
+
+	docs, err := manager.LookupSecondary("scores", "score", 20)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("Expected [b c], got %v", got)
+	}
+}
+
+func TestOrderedIndexMixedTypes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+
+	values := map[string]interface{}{
+		"null":   nil,
+		"false":  false,
+		"true":   true,
+		"num":    5,
+		"time1":  "2024-01-01T10:00:00+02:00", // 08:00Z
+		"time2":  "2024-01-01T09:00:00Z",
+		"str":    "apple",
+		"str2":   "banana",
+		"object": map[string]interface{}{"k": "v"},
+	}
+	for id, v := range values {
+		engine.WriteDocument("mixed", core.DocumentID(id), core.Document{"id": id, "v": v})
+	}
+	// Missing field is not indexed
+	engine.WriteDocument("mixed", "missing", core.Document{"id": "missing"})
+
+	manager.CreateSecondaryIndex("mixed", "v", core.IndexOrdered)
+
+	var order []string
+	manager.Ascend("mixed", "v", false, func(docID core.DocumentID, doc core.Document) bool {
+		order = append(order, string(docID))
+		return true
+	})
+
+	expected := []string{"null", "false", "true", "num", "time1", "time2", "str", "str2", "object"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected order %v, got %v", expected, order)
+	}
+
+	// A string range only covers strings, not numbers or timestamps
+	docs, _ := manager.Range("mixed", "v", "a", "z", true, true)
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"str", "str2"}) {
+		t.Errorf("Expected string range [str str2], got %v", got)
+	}
+
+	// Timestamps compare as instants across offsets, and an open bound stays
+	// within the class of the other
+	docs, _ = manager.Range("mixed", "v", "2024-01-01T08:30:00Z", nil, true, false)
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"time2"}) {
+		t.Errorf("Expected time range [time2], got %v", got)
+	}
+	docs, _ = manager.Range("mixed", "v", nil, 10, false, true)
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"num"}) {
+		t.Errorf("Expected number range [num], got %v", got)
+	}
+	docs, _ = manager.Range("mixed", "v", "b", nil, true, false)
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"str2"}) {
+		t.Errorf("Expected string range [str2], got %v", got)
+	}
+}
+
+func TestOrderedIndexDescendingIteration(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedScores(t, manager, engine)
+
+	var order []string
+	err := manager.Ascend("scores", "score", true, func(docID core.DocumentID, doc core.Document) bool {
+		order = append(order, string(docID))
+		return len(order) < 3
+	})
+	if err != nil {
+		t.Fatalf("Ascend failed: %v", err)
+	}
+
+	// Ties are broken by document ID in ascending order, so descending visits c before b
+	if expected := []string{"e", "d", "c"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected %v, got %v", expected, order)
+	}
+}
+
+func TestOrderedIndexMaintainsOrderOnMutation(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedScores(t, manager, engine)
+
+	manager.UpdateIndexes("scores", "a", core.Document{"id": "a", "score": 35}, core.OpUpdate)
+	manager.UpdateIndexes("scores", "f", core.Document{"id": "f", "score": 15}, core.OpInsert)
+	manager.UpdateIndexes("scores", "d", nil, core.OpDelete)
+
+	docs, _ := manager.Range("scores", "score", nil, nil, false, false)
+	if got, expected := docIDs(docs), []string{"f", "b", "c", "a", "e"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestRangeRequiresOrderedIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 3)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+
+	if _, err := manager.Range("users", "age", 1, 2, true, true); !errors.Is(err, ErrIndexKindMismatch) {
+		t.Errorf("Expected ErrIndexKindMismatch, got %v", err)
+	}
+}
+
+func TestOrderedIndexPersistence(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedScores(t, manager, engine)
+	manager.PersistIndexes("scores")
+
+	if _, err := os.Stat(manager.getIndexPath("scores")); err != nil {
+		t.Fatalf("Index file was not written: %v", err)
+	}
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("scores"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	docs, err := reloaded.Range("scores", "score", 20, 30, true, true)
+	if err != nil {
+		t.Fatalf("Expected ordered index after reload: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"b", "c", "d"}) {
+		t.Errorf("Expected [b c d], got %v", got)
+	}
+}
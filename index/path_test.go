@@ -0,0 +1,108 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedAddresses(t *testing.T, engine core.StorageEngine) {
+	docs := map[core.DocumentID]core.Document{
+		"p1": {
+			"address": map[string]interface{}{
+				"city": "Berlin",
+				"geo":  map[string]interface{}{"country": map[string]interface{}{"code": "DE"}},
+			},
+			"orders": []interface{}{map[string]interface{}{"sku": "A1"}, map[string]interface{}{"sku": "B2"}},
+		},
+		"p2": {
+			"address": map[string]interface{}{
+				"city": "Munich",
+				"geo":  map[string]interface{}{"country": map[string]interface{}{"code": "DE"}},
+			},
+			"orders": []interface{}{map[string]interface{}{"sku": "B2"}},
+		},
+		"p3": {
+			"address": map[string]interface{}{
+				"city": "Paris",
+				"geo":  map[string]interface{}{"country": map[string]interface{}{"code": "FR"}},
+			},
+		},
+		"p4": {"address": "unknown"},
+		"p5": {"name": "no address"},
+	}
+	for docID, doc := range docs {
+		if err := engine.WriteDocument("people", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestNestedFieldIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedAddresses(t, engine)
+
+	if err := manager.CreateSecondaryIndex("people", "address.geo.country.code", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create nested index: %v", err)
+	}
+
+	docs, err := manager.LookupSecondary("people", "address.geo.country.code", "DE")
+	if err != nil {
+		t.Fatalf("Nested lookup failed: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("Expected 2 German addresses, got %d", len(docs))
+	}
+
+	// Documents where the path does not resolve are not indexed
+	if docs, _ := manager.LookupSecondary("people", "address.geo.country.code", nil); len(docs) != 0 {
+		t.Errorf("Expected unresolved paths not to be indexed as null, got %d", len(docs))
+	}
+}
+
+func TestNestedFieldArrayOfObjects(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedAddresses(t, engine)
+
+	if err := manager.CreateSecondaryIndex("people", "orders.0.sku", core.IndexOrdered); err != nil {
+		t.Fatalf("Failed to create nested index: %v", err)
+	}
+
+	var ids []core.DocumentID
+	manager.Ascend("people", "orders.0.sku", false, func(docID core.DocumentID, doc core.Document) bool {
+		ids = append(ids, docID)
+		return true
+	})
+	if !reflect.DeepEqual(ids, []core.DocumentID{"p1", "p2"}) {
+		t.Errorf("Expected [p1 p2] ordered by first SKU, got %v", ids)
+	}
+}
+
+func TestNestedFieldUpdateIndexes(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedAddresses(t, engine)
+	manager.CreateSecondaryIndex("people", "address.city", core.IndexHash)
+
+	moved := core.Document{"address": map[string]interface{}{"city": "Berlin"}}
+	manager.UpdateIndexes("people", "p2", moved, core.OpUpdate)
+
+	if docs, _ := manager.LookupSecondary("people", "address.city", "Munich"); len(docs) != 0 {
+		t.Errorf("Expected stale nested entry to be removed, got %d", len(docs))
+	}
+	if docs, _ := manager.LookupSecondary("people", "address.city", "Berlin"); len(docs) != 2 {
+		t.Errorf("Expected 2 documents in Berlin, got %d", len(docs))
+	}
+}
+
+func TestEscapedDotFieldIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("releases", "r1", core.Document{"version.major": 1})
+	engine.WriteDocument("releases", "r2", core.Document{"version": map[string]interface{}{"major": 1}})
+
+	manager.CreateSecondaryIndex("releases", `version\.major`, core.IndexHash)
+	docs, _ := manager.LookupSecondary("releases", `version\.major`, 1)
+	if len(docs) != 1 || docs[0]["version.major"] == nil {
+		t.Errorf("Expected only the literal dotted key to match, got %v", docs)
+	}
+}
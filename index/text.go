@@ -0,0 +1,240 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// EnglishStopWords is a small list of common English words for TextOptions.StopWords
+var EnglishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "by", "for", "from", "in",
+	"is", "it", "of", "on", "or", "that", "the", "to", "was", "with",
+}
+
+// TextOptions configures tokenization for a text index
+type TextOptions struct {
+	MinTokenLength int      `json:"min_token_length,omitempty"` // Shorter tokens are dropped; 0 keeps all
+	StopWords      []string `json:"stop_words,omitempty"`       // Tokens never indexed or searched
+}
+
+// textIndex is an inverted index from lowercase word tokens to the documents
+// containing them, with the number of occurrences per document
+type textIndex struct {
+	field     string
+	opts      TextOptions
+	stopWords map[string]struct{}
+	postings  map[string]map[core.DocumentID]int
+}
+
+// newTextIndex creates an empty text index on a field
+func newTextIndex(field string, opts TextOptions) *textIndex {
+	stopWords := make(map[string]struct{}, len(opts.StopWords))
+	for _, word := range opts.StopWords {
+		stopWords[strings.ToLower(word)] = struct{}{}
+	}
+
+	return &textIndex{
+		field:     field,
+		opts:      opts,
+		stopWords: stopWords,
+		postings:  make(map[string]map[core.DocumentID]int),
+	}
+}
+
+// kind returns the index kind
+func (x *textIndex) kind() core.IndexKind {
+	return core.IndexText
+}
+
+// fields returns the indexed field
+func (x *textIndex) fields() []string {
+	return []string{x.field}
+}
+
+// tokenize lowercases text and splits it on anything that is not a letter or
+// digit, dropping stop words and tokens below the minimum length
+func (x *textIndex) tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	tokens := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < x.opts.MinTokenLength {
+			continue
+		}
+		if _, stop := x.stopWords[word]; stop {
+			continue
+		}
+		tokens = append(tokens, word)
+	}
+	return tokens
+}
+
+// termFrequencies counts the tokens of a document's field, which must be a string
+func (x *textIndex) termFrequencies(doc core.Document) map[string]int {
+	value, ok := core.GetPath(doc, x.field)
+	if !ok {
+		return nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, token := range x.tokenize(text) {
+		counts[token]++
+	}
+	return counts
+}
+
+// add indexes the tokens of a document
+func (x *textIndex) add(docID core.DocumentID, doc core.Document) {
+	for token, count := range x.termFrequencies(doc) {
+		docs, exists := x.postings[token]
+		if !exists {
+			docs = make(map[core.DocumentID]int)
+			x.postings[token] = docs
+		}
+		docs[docID] = count
+	}
+}
+
+// remove drops a document from the index using its previously indexed state
+func (x *textIndex) remove(docID core.DocumentID, doc core.Document) {
+	for token := range x.termFrequencies(doc) {
+		if docs, exists := x.postings[token]; exists {
+			delete(docs, docID)
+			if len(docs) == 0 {
+				delete(x.postings, token)
+			}
+		}
+	}
+}
+
+// lookup returns the IDs of documents containing every token of a string value
+func (x *textIndex) lookup(value interface{}) []core.DocumentID {
+	query, ok := value.(string)
+	if !ok {
+		return nil
+	}
+
+	var ids []core.DocumentID
+	for _, hit := range x.search(query) {
+		ids = append(ids, hit.docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// stats returns the number of indexed documents and a rough size in bytes
+func (x *textIndex) stats() (int, int64) {
+	docs := make(map[core.DocumentID]struct{})
+	var size int64
+	for token, postings := range x.postings {
+		size += int64(len(token)) + mapEntryOverhead
+		for docID := range postings {
+			docs[docID] = struct{}{}
+			size += int64(len(docID)) + mapEntryOverhead
+		}
+	}
+	return len(docs), size
+}
+
+// entrySet returns every (token, document, count) posting keyed by its encoding
+func (x *textIndex) entrySet() map[string]core.DocumentID {
+	set := make(map[string]core.DocumentID)
+	for token, postings := range x.postings {
+		for docID, count := range postings {
+			set[fmt.Sprintf("%s\x00%s\x00%d", token, docID, count)] = docID
+		}
+	}
+	return set
+}
+
+// textHit is a search result with its score
+type textHit struct {
+	docID core.DocumentID
+	score int
+}
+
+// search returns documents containing every query token, highest summed term
+// frequency first and ties broken by ID. A query with no usable tokens matches
+// nothing.
+func (x *textIndex) search(query string) []textHit {
+	tokens := x.tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	scores := make(map[core.DocumentID]int)
+	for docID, count := range x.postings[tokens[0]] {
+		scores[docID] = count
+	}
+	for _, token := range tokens[1:] {
+		docs := x.postings[token]
+		for docID := range scores {
+			count, ok := docs[docID]
+			if !ok {
+				delete(scores, docID)
+				continue
+			}
+			scores[docID] += count
+		}
+	}
+
+	hits := make([]textHit, 0, len(scores))
+	for docID, score := range scores {
+		hits = append(hits, textHit{docID: docID, score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].docID < hits[j].docID
+	})
+	return hits
+}
+
+// CreateTextIndex builds a full-text index on a string field. Recreating the
+// index replaces it, which is how tokenizer options are changed.
+func (m *FileIndexManager) CreateTextIndex(collection string, field string, opts TextOptions) error {
+	if field == "" {
+		return fmt.Errorf("missing field - unable to create index on %s", collection)
+	}
+	if opts.MinTokenLength < 0 {
+		return fmt.Errorf("invalid minimum token length: %d", opts.MinTokenLength)
+	}
+
+	return m.createIndex(collection, indexDefinition{Name: field, Fields: []string{field}, Kind: core.IndexText, Text: &opts})
+}
+
+// SearchText returns documents whose field contains every word of query,
+// ranked by how often the words occur. Requires a text index on the field.
+func (m *FileIndexManager) SearchText(collection string, field string, query string) ([]core.Document, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	idx, fi, err := m.getFieldIndex(collection, field)
+	if err != nil {
+		return nil, err
+	}
+
+	text, ok := fi.(*textIndex)
+	if !ok {
+		return nil, fmt.Errorf("%w: text search on %s index %s.%s", ErrIndexKindMismatch, fi.kind(), collection, field)
+	}
+
+	hits := text.search(query)
+	ids := make([]core.DocumentID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.docID
+	}
+	return idx.documents(ids), nil
+}
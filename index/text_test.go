@@ -0,0 +1,147 @@
+package index
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedProducts(t *testing.T, manager *FileIndexManager, engine core.StorageEngine, opts TextOptions) {
+	products := map[core.DocumentID]core.Document{
+		"p1": {"description": "Fast JSON database written in Go"},
+		"p2": {"description": "A database for JSON documents. JSON everywhere, json!"},
+		"p3": {"description": "Go tooling for the web"},
+		"p4": {"description": "Schnelle Datenbank für Größen und Maße"},
+		"p5": {"description": 42},
+		"p6": {"name": "no description"},
+	}
+	for docID, doc := range products {
+		doc["id"] = string(docID)
+		if err := engine.WriteDocument("products", docID, doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+
+	if err := manager.CreateTextIndex("products", "description", opts); err != nil {
+		t.Fatalf("Failed to create text index: %v", err)
+	}
+}
+
+func TestSearchTextRanksByTermFrequency(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{})
+
+	docs, err := manager.SearchText("products", "description", "json")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p2", "p1"}) {
+		t.Errorf("Expected [p2 p1] ranked by frequency, got %v", got)
+	}
+}
+
+func TestSearchTextMultiWordAndCase(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{})
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"JSON Database", []string{"p2", "p1"}},
+		{"go DATABASE", []string{"p1"}},
+		{"go web", []string{"p3"}},
+		{"go rust", []string{}},
+		{"größen MASSE", []string{}},
+		{"GRÖSSEN", []string{}},
+		{"GRÖßEN maße", []string{"p4"}},
+		{"  ...  ", []string{}},
+	}
+
+	for _, tt := range tests {
+		docs, err := manager.SearchText("products", "description", tt.query)
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if got := docIDs(docs); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Query %q: expected %v, got %v", tt.query, tt.expected, got)
+		}
+	}
+}
+
+func TestSearchTextOptions(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{MinTokenLength: 3, StopWords: EnglishStopWords})
+
+	// "go" is below the minimum length and "for" is a stop word, so both queries have no tokens
+	for _, query := range []string{"go", "for"} {
+		if docs, _ := manager.SearchText("products", "description", query); len(docs) != 0 {
+			t.Errorf("Query %q: expected no results, got %v", query, docIDs(docs))
+		}
+	}
+
+	// Dropped query tokens do not restrict the results
+	docs, _ := manager.SearchText("products", "description", "the web")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p3"}) {
+		t.Errorf("Expected [p3], got %v", got)
+	}
+
+	if err := manager.CreateTextIndex("products", "description", TextOptions{MinTokenLength: -1}); err == nil {
+		t.Errorf("Expected error for negative minimum token length")
+	}
+}
+
+func TestSearchTextUpdates(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{})
+
+	manager.UpdateIndexes("products", "p1", core.Document{"id": "p1", "description": "Fast key value store"}, core.OpUpdate)
+	manager.UpdateIndexes("products", "p2", nil, core.OpDelete)
+
+	if docs, _ := manager.SearchText("products", "description", "json"); len(docs) != 0 {
+		t.Errorf("Expected removed tokens not to match, got %v", docIDs(docs))
+	}
+	docs, _ := manager.SearchText("products", "description", "fast store")
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Errorf("Expected [p1], got %v", got)
+	}
+	if _, exists := manager.indexes["products"].secondary["description"].(*textIndex).postings["json"]; exists {
+		t.Errorf("Expected empty posting list to be dropped")
+	}
+}
+
+func TestTextIndexPersistence(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{MinTokenLength: 3})
+	manager.PersistIndexes("products")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("products"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+
+	docs, err := reloaded.SearchText("products", "description", "json")
+	if err != nil {
+		t.Fatalf("Expected text index after reload: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"p2", "p1"}) {
+		t.Errorf("Expected [p2 p1] after reload, got %v", got)
+	}
+
+	// Tokenizer options survive the round trip
+	if docs, _ := reloaded.SearchText("products", "description", "go"); len(docs) != 0 {
+		t.Errorf("Expected minimum token length to persist, got %v", docIDs(docs))
+	}
+}
+
+func TestSearchTextRequiresTextIndex(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedProducts(t, manager, engine, TextOptions{})
+	manager.CreateSecondaryIndex("products", "name", core.IndexHash)
+
+	if _, err := manager.SearchText("products", "name", "x"); !errors.Is(err, ErrIndexKindMismatch) {
+		t.Errorf("Expected ErrIndexKindMismatch, got %v", err)
+	}
+}
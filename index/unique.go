@@ -0,0 +1,139 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrUniqueConstraintViolation is returned when a write would give a unique
+// index value to a second document
+var ErrUniqueConstraintViolation = errors.New("unique constraint violation")
+
+// UniqueOptions configures a unique index
+type UniqueOptions struct {
+	IndexOptions
+
+	// RejectDuplicateNulls treats an explicit null as a value, so at most one
+	// document may hold it. Documents missing the field are always allowed.
+	// Has no effect on a sparse index, which never indexes nulls.
+	RejectDuplicateNulls bool
+}
+
+// CreateUniqueIndex builds a hash index on a field that rejects writes giving
+// an already used value to a different document. Any number of documents may
+// hold null or omit the field.
+func (m *FileIndexManager) CreateUniqueIndex(collection string, field string) error {
+	return m.CreateUniqueIndexWithOptions(collection, field, UniqueOptions{})
+}
+
+// CreateUniqueIndexWithOptions builds a unique index with the given options.
+// It fails with ErrUniqueConstraintViolation if existing documents already
+// hold duplicate values.
+func (m *FileIndexManager) CreateUniqueIndexWithOptions(collection string, field string, opts UniqueOptions) error {
+	if field == "" {
+		return fmt.Errorf("missing field - unable to create index on %s", collection)
+	}
+
+	return m.createIndex(collection, indexDefinition{
+		Name:            field,
+		Fields:          []string{field},
+		Kind:            core.IndexHash,
+		Unique:          true,
+		UniqueNulls:     opts.RejectDuplicateNulls,
+		Sparse:          opts.Sparse,
+		CaseInsensitive: opts.CaseInsensitive,
+	})
+}
+
+// checkUnique verifies a write against every unique index. Callers must hold m.mu.
+func (idx *collectionIndexes) checkUnique(collection string, docID core.DocumentID, doc core.Document) error {
+	for name, fi := range idx.secondary {
+		h, ok := fi.(*hashIndex)
+		if !ok {
+			continue
+		}
+		if other, conflict := h.conflict(docID, doc); conflict {
+			value, _ := core.GetPath(doc, h.field)
+			return fmt.Errorf("%w: %s.%s value %v is already used by document %s", ErrUniqueConstraintViolation, collection, name, value, other)
+		}
+	}
+	return nil
+}
+
+// WriteIndexed writes a document through to storage and updates the indexes,
+// holding the index lock across both so that unique constraints cannot be
+// raced. A write violating a unique index fails with
+// ErrUniqueConstraintViolation and leaves storage untouched.
+func (m *FileIndexManager) WriteIndexed(collection string, docID core.DocumentID, doc core.Document) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writes := map[core.DocumentID]core.Document{docID: doc}
+	if err := m.syncIDFields(collection, writes); err != nil {
+		return err
+	}
+	doc = writes[docID]
+
+	idx, indexed := m.indexes[collection]
+	if indexed {
+		if err := idx.checkUnique(collection, docID, doc); err != nil {
+			return err
+		}
+	}
+
+	revisions := make(map[string]core.RevisionChange, 1)
+	if err := m.writeDocument(core.WithRevisions(context.Background(), revisions), collection, docID, doc); err != nil {
+		return err
+	}
+
+	if indexed {
+		idx.apply(docID, doc, core.OpUpdate)
+		idx.advanceRevision(revisions[collection])
+	}
+	return nil
+}
+
+// DeleteIndexed deletes a document from storage and the indexes under the index lock
+func (m *FileIndexManager) DeleteIndexed(collection string, docID core.DocumentID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revisions := make(map[string]core.RevisionChange, 1)
+	if err := m.deleteDocument(core.WithRevisions(context.Background(), revisions), collection, docID); err != nil {
+		return err
+	}
+
+	if idx, indexed := m.indexes[collection]; indexed {
+		idx.apply(docID, nil, core.OpDelete)
+		idx.advanceRevision(revisions[collection])
+	}
+	return nil
+}
+
+// contextWriter is implemented by storage engines whose single-document
+// writes take a context, through which they report revision changes
+type contextWriter interface {
+	WriteDocumentContext(ctx context.Context, collection string, docID core.DocumentID, doc core.Document) error
+	DeleteDocumentContext(ctx context.Context, collection string, docID core.DocumentID) error
+}
+
+// writeDocument writes a document to storage, passing ctx through when the
+// engine takes one
+func (m *FileIndexManager) writeDocument(ctx context.Context, collection string, docID core.DocumentID, doc core.Document) error {
+	if w, ok := m.storage.(contextWriter); ok {
+		return w.WriteDocumentContext(ctx, collection, docID, doc)
+	}
+	return m.storage.WriteDocument(collection, docID, doc)
+}
+
+// deleteDocument deletes a document from storage, passing ctx through when
+// the engine takes one
+func (m *FileIndexManager) deleteDocument(ctx context.Context, collection string, docID core.DocumentID) error {
+	if w, ok := m.storage.(contextWriter); ok {
+		return w.DeleteDocumentContext(ctx, collection, docID)
+	}
+	return m.storage.DeleteDocument(collection, docID)
+}
@@ -0,0 +1,160 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestUniqueIndexRejectsDuplicate(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+
+	if err := manager.CreateUniqueIndex("users", "email"); err != nil {
+		t.Fatalf("Failed to create unique index: %v", err)
+	}
+	if err := users.WriteDocument("u1", core.Document{"email": "a@example.com"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	revision, _ := engine.CollectionRevision("users")
+	err := users.WriteDocument("u2", core.Document{"email": "a@example.com"})
+	if !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Fatalf("Expected ErrUniqueConstraintViolation, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "email") || !strings.Contains(err.Error(), "u1") {
+		t.Errorf("Expected error to name the field and conflicting ID, got %v", err)
+	}
+
+	// The collection file must be left untouched
+	if after, _ := engine.CollectionRevision("users"); after != revision {
+		t.Errorf("Expected revision %d after rejected write, got %d", revision, after)
+	}
+	if _, err := engine.ReadDocument("users", "u2"); err == nil {
+		t.Errorf("Expected rejected document not to be stored")
+	}
+
+	// Rewriting the holder with the same value is not a conflict
+	if err := users.WriteDocument("u1", core.Document{"email": "a@example.com", "name": "A"}); err != nil {
+		t.Errorf("Expected update of the holder to succeed, got %v", err)
+	}
+}
+
+func TestUniqueIndexReleasesValueOnChange(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndex("users", "email")
+
+	users.WriteDocument("u1", core.Document{"email": "a@example.com"})
+	users.WriteDocument("u1", core.Document{"email": "b@example.com"})
+	if err := users.WriteDocument("u2", core.Document{"email": "a@example.com"}); err != nil {
+		t.Errorf("Expected released value to be reusable, got %v", err)
+	}
+
+	users.DeleteDocument("u1")
+	if err := users.WriteDocument("u3", core.Document{"email": "b@example.com"}); err != nil {
+		t.Errorf("Expected value of deleted document to be reusable, got %v", err)
+	}
+}
+
+func TestUniqueIndexNulls(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndex("users", "email")
+
+	for i, doc := range []core.Document{{"email": nil}, {"email": nil}, {}, {}} {
+		if err := users.WriteDocument(core.DocumentID(fmt.Sprintf("u%d", i)), doc); err != nil {
+			t.Errorf("Expected null or missing values to be allowed, got %v", err)
+		}
+	}
+
+	manager.CreateUniqueIndexWithOptions("strict", "email", UniqueOptions{RejectDuplicateNulls: true})
+	strict := &core.Collection{Name: "strict", Storage: engine, Indexes: manager}
+	if err := strict.WriteDocument("s1", core.Document{"email": nil}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := strict.WriteDocument("s2", core.Document{"email": nil}); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected duplicate null to be rejected, got %v", err)
+	}
+	if err := strict.WriteDocument("s3", core.Document{}); err != nil {
+		t.Errorf("Expected missing field to be allowed, got %v", err)
+	}
+}
+
+func TestCreateUniqueIndexOverDuplicates(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"email": "a@example.com"})
+	engine.WriteDocument("users", "u2", core.Document{"email": "a@example.com"})
+
+	if err := manager.CreateUniqueIndex("users", "email"); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected ErrUniqueConstraintViolation over existing duplicates, got %v", err)
+	}
+	if _, err := manager.LookupSecondary("users", "email", "a@example.com"); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected failed unique index not to be installed, got %v", err)
+	}
+}
+
+func TestUniqueIndexSurvivesReload(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	manager.CreateUniqueIndex("users", "email")
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	users.WriteDocument("u1", core.Document{"email": "a@example.com"})
+	manager.PersistIndexes("users")
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	users.Indexes = reloaded
+	if err := users.WriteDocument("u2", core.Document{"email": "a@example.com"}); !errors.Is(err, ErrUniqueConstraintViolation) {
+		t.Errorf("Expected constraint after reload, got %v", err)
+	}
+}
+
+func TestUniqueIndexConcurrentInserts(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	users := &core.Collection{Name: "users", Storage: engine, Indexes: manager}
+	manager.CreateUniqueIndex("users", "email")
+
+	const writers = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	wins, violations := 0, 0
+
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := users.WriteDocument(core.DocumentID(fmt.Sprintf("u%02d", i)), core.Document{"email": "race@example.com"})
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				wins++
+			case errors.Is(err, ErrUniqueConstraintViolation):
+				violations++
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if wins != 1 || violations != writers-1 {
+		t.Errorf("Expected exactly one winner, got %d wins and %d violations", wins, violations)
+	}
+
+	stored := 0
+	engine.ScanCollection("users", func(core.DocumentID, core.Document) bool {
+		stored++
+		return true
+	})
+	if stored != 1 {
+		t.Errorf("Expected exactly one stored document, got %d", stored)
+	}
+}
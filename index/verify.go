@@ -0,0 +1,243 @@
+package index
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// primaryIndexName names the primary index in verification reports
+const primaryIndexName = "_primary"
+
+// IndexDiscrepancy is a single mismatch between an index and the stored documents
+type IndexDiscrepancy struct {
+	Index  string          // Index name, or "_primary" for the primary index
+	DocID  core.DocumentID // Affected document
+	Reason string          // What is wrong with the entry
+}
+
+// VerifyReport is the result of VerifyIndexes
+type VerifyReport struct {
+	Collection    string
+	Discrepancies []IndexDiscrepancy
+	Repaired      bool // The indexes were rebuilt to fix the discrepancies
+}
+
+// contentChecksum hashes documents in ID order using their JSON encoding, so
+// values that encode identically (25 and 25.0) hash identically
+func contentChecksum(docs map[core.DocumentID]core.Document) (string, error) {
+	ids := make([]core.DocumentID, 0, len(docs))
+	for docID := range docs {
+		ids = append(ids, docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	hash := sha256.New()
+	for _, docID := range ids {
+		data, err := json.Marshal(docs[docID])
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal document %s: %w", docID, err)
+		}
+		fmt.Fprintf(hash, "%d:%s%d:", len(docID), docID, len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// VerifyIndexes cross-checks every index entry of a collection against the
+// stored documents. With repair set, the indexes are rebuilt from storage when
+// any discrepancy is found; otherwise they are left untouched.
+func (m *FileIndexManager) VerifyIndexes(collection string, repair bool) (*VerifyReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx, exists := m.indexes[collection]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, collection)
+	}
+
+	revision, err := m.collectionRevision(collection)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := m.scanCollection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	expected, err := newCollectionIndexes(docs, idx.definitions())
+	if err != nil {
+		return nil, err
+	}
+	expected.revision = revision
+
+	report := &VerifyReport{Collection: collection}
+	report.Discrepancies = append(report.Discrepancies, comparePrimary(idx.primary, docs)...)
+	for _, def := range idx.definitions() {
+		report.Discrepancies = append(report.Discrepancies,
+			compareIndexEntries(def.Name, idx.secondary[def.Name].entrySet(), expected.secondary[def.Name].entrySet())...)
+	}
+	sort.SliceStable(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if a.Index != b.Index {
+			return a.Index < b.Index
+		}
+		return a.DocID < b.DocID
+	})
+
+	if repair && len(report.Discrepancies) > 0 {
+		m.indexes[collection] = expected
+		m.version.Add(1)
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+// comparePrimary reports documents missing from, extra in or different in the primary index
+func comparePrimary(indexed, stored map[core.DocumentID]core.Document) []IndexDiscrepancy {
+	var found []IndexDiscrepancy
+	for docID, doc := range stored {
+		indexedDoc, exists := indexed[docID]
+		if !exists {
+			found = append(found, IndexDiscrepancy{Index: primaryIndexName, DocID: docID, Reason: "document missing from index"})
+			continue
+		}
+		if !sameJSON(indexedDoc, doc) {
+			found = append(found, IndexDiscrepancy{Index: primaryIndexName, DocID: docID, Reason: "indexed document differs from storage"})
+		}
+	}
+	for docID := range indexed {
+		if _, exists := stored[docID]; !exists {
+			found = append(found, IndexDiscrepancy{Index: primaryIndexName, DocID: docID, Reason: "index entry for deleted document"})
+		}
+	}
+	return found
+}
+
+// compareIndexEntries reports entries missing from or extra in a secondary index,
+// at most once per document and reason
+func compareIndexEntries(name string, actual, expected map[string]core.DocumentID) []IndexDiscrepancy {
+	type problem struct {
+		docID  core.DocumentID
+		reason string
+	}
+	seen := make(map[problem]struct{})
+
+	var found []IndexDiscrepancy
+	report := func(docID core.DocumentID, reason string) {
+		p := problem{docID, reason}
+		if _, dup := seen[p]; !dup {
+			seen[p] = struct{}{}
+			found = append(found, IndexDiscrepancy{Index: name, DocID: docID, Reason: reason})
+		}
+	}
+
+	for entry, docID := range expected {
+		if _, exists := actual[entry]; !exists {
+			report(docID, "entry missing from index")
+		}
+	}
+	for entry, docID := range actual {
+		if _, exists := expected[entry]; !exists {
+			report(docID, "index entry does not match document")
+		}
+	}
+	return found
+}
+
+// sameJSON reports whether two documents have the same JSON encoding
+func sameJSON(a, b core.Document) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+// CheckIndexFile reads a collection's persisted index file and checks it
+// against its checksum, failing with ErrIndexCorrupt if it does not match
+// or cannot be parsed. A missing file is not an error, and neither is a
+// stale one, since LoadIndexes rebuilds both.
+func (m *FileIndexManager) CheckIndexFile(collection string) error {
+	data, err := os.ReadFile(m.getIndexPath(collection))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrIndexCorrupt, collection, err)
+	}
+	checksum, err := contentChecksum(file.Primary)
+	if err != nil {
+		return err
+	}
+	if checksum != file.Checksum {
+		return fmt.Errorf("%w: %s checksum mismatch", ErrIndexCorrupt, collection)
+	}
+	return nil
+}
+
+// VerifyIndexFile checks an index file against the documents and revision
+// of its collection without loading it. It fails with ErrIndexCorrupt if the
+// file cannot be parsed, does not match its checksum or, at the collection's
+// revision, holds other documents, and with ErrIndexStale if it was
+// persisted at another revision. LoadIndexes rebuilds the file in both cases.
+func VerifyIndexFile(path string, docs map[core.DocumentID]core.Document, revision uint64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexCorrupt, err)
+	}
+	checksum, err := contentChecksum(file.Primary)
+	if err != nil {
+		return err
+	}
+	if checksum != file.Checksum {
+		return fmt.Errorf("%w: checksum mismatch", ErrIndexCorrupt)
+	}
+	if file.Revision != revision {
+		return fmt.Errorf("%w: persisted at revision %d, collection at %d", ErrIndexStale, file.Revision, revision)
+	}
+	if discrepancies := comparePrimary(file.Primary, docs); len(discrepancies) > 0 {
+		return fmt.Errorf("%w: %d documents differ from the collection at the same revision", ErrIndexCorrupt, len(discrepancies))
+	}
+	if _, err := newCollectionIndexes(file.Primary, file.Indexes); err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexCorrupt, err)
+	}
+	return nil
+}
+
+// RebuildIndexFile rewrites an index file from the documents and revision
+// of its collection, keeping the index definitions it holds, for repairs
+// made without loading it. It fails with ErrIndexCorrupt if the definitions
+// cannot be read.
+func RebuildIndexFile(path, collection string, docs map[core.DocumentID]core.Document, revision uint64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read index file: %w", err)
+	}
+	var file indexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexCorrupt, err)
+	}
+
+	idx, err := newCollectionIndexes(docs, file.Indexes)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrIndexCorrupt, err)
+	}
+	idx.revision = revision
+	return writeIndexFile(path, collection, idx)
+}
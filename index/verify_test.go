@@ -0,0 +1,145 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestLoadIndexesRebuildsCorruptIndex(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedUsers(t, engine, 5)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+	manager.PersistIndexes("users")
+
+	// Tamper with a document inside the index file without touching the checksum
+	path := manager.getIndexPath("users")
+	data, _ := os.ReadFile(path)
+	var file indexFile
+	json.Unmarshal(data, &file)
+	file.Primary["user_001"]["age"] = 99
+	data, _ = json.Marshal(file)
+	os.WriteFile(path, data, 0644)
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	var reasons []error
+	reloaded.SetRebuildHandler(func(collection string, reason error) {
+		reasons = append(reasons, reason)
+	})
+
+	if err := reloaded.LoadIndexes("users"); err != nil {
+		t.Fatalf("Failed to load indexes: %v", err)
+	}
+	if len(reasons) != 1 || !errors.Is(reasons[0], ErrIndexCorrupt) {
+		t.Fatalf("Expected one rebuild for a corrupt index, got %v", reasons)
+	}
+	if docs, _ := reloaded.LookupSecondary("users", "age", 99); len(docs) != 0 {
+		t.Errorf("Expected tampered value to be gone after rebuild")
+	}
+}
+
+func TestLoadIndexesReportsStaleRebuild(t *testing.T) {
+	manager, engine, tempDir := setupTestManager(t)
+	seedUsers(t, engine, 5)
+	manager.CreatePrimaryIndex("users")
+	manager.PersistIndexes("users")
+
+	// Simulate a crash between a data write and PersistIndexes
+	engine.WriteDocument("users", "user_999", core.Document{"id": "user_999"})
+
+	reloaded, _ := NewFileIndexManager(engine, tempDir)
+	var reasons []error
+	reloaded.SetRebuildHandler(func(collection string, reason error) {
+		reasons = append(reasons, reason)
+	})
+	reloaded.LoadIndexes("users")
+
+	if len(reasons) != 1 || !errors.Is(reasons[0], ErrIndexStale) {
+		t.Fatalf("Expected one rebuild for a stale index, got %v", reasons)
+	}
+	if _, err := reloaded.LookupPrimary("users", "user_999"); err != nil {
+		t.Errorf("Expected rebuilt index to contain the new document: %v", err)
+	}
+
+	// A fresh index file loads without a rebuild
+	reasons = nil
+	reloaded.PersistIndexes("users")
+	reloaded.LoadIndexes("users")
+	if len(reasons) != 0 {
+		t.Errorf("Expected no rebuild for a fresh index, got %v", reasons)
+	}
+}
+
+func TestVerifyIndexesCleanCollection(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 5)
+	manager.CreateSecondaryIndex("users", "age", core.IndexOrdered)
+	manager.CreateTextIndex("users", "name", TextOptions{})
+
+	report, err := manager.VerifyIndexes("users", false)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(report.Discrepancies) != 0 || report.Repaired {
+		t.Errorf("Expected a clean report, got %+v", report)
+	}
+
+	if _, err := manager.VerifyIndexes("unindexed", false); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound, got %v", err)
+	}
+}
+
+func TestVerifyIndexesDryRunAndRepair(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	seedUsers(t, engine, 5)
+	manager.CreateSecondaryIndex("users", "age", core.IndexHash)
+
+	// Storage changes the index manager never hears about
+	engine.WriteDocument("users", "user_001", core.Document{"id": "user_001", "age": 77})
+	engine.WriteDocument("users", "user_100", core.Document{"id": "user_100", "age": 20})
+	engine.DeleteDocument("users", "user_002")
+
+	report, err := manager.VerifyIndexes("users", false)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	expected := map[IndexDiscrepancy]bool{
+		{Index: "_primary", DocID: "user_001", Reason: "indexed document differs from storage"}: true,
+		{Index: "_primary", DocID: "user_002", Reason: "index entry for deleted document"}:      true,
+		{Index: "_primary", DocID: "user_100", Reason: "document missing from index"}:           true,
+		{Index: "age", DocID: "user_001", Reason: "entry missing from index"}:                   true,
+		{Index: "age", DocID: "user_001", Reason: "index entry does not match document"}:        true,
+		{Index: "age", DocID: "user_002", Reason: "index entry does not match document"}:        true,
+		{Index: "age", DocID: "user_100", Reason: "entry missing from index"}:                   true,
+	}
+	if len(report.Discrepancies) != len(expected) {
+		t.Fatalf("Expected %d discrepancies, got %+v", len(expected), report.Discrepancies)
+	}
+	for _, d := range report.Discrepancies {
+		if !expected[d] {
+			t.Errorf("Unexpected discrepancy: %+v", d)
+		}
+	}
+
+	// Dry run leaves the index as it was
+	if docs, _ := manager.LookupSecondary("users", "age", 77); len(docs) != 0 {
+		t.Errorf("Expected dry run not to modify the index")
+	}
+
+	report, _ = manager.VerifyIndexes("users", true)
+	if !report.Repaired {
+		t.Errorf("Expected repair to be reported")
+	}
+	if docs, _ := manager.LookupSecondary("users", "age", 77); len(docs) != 1 {
+		t.Errorf("Expected repaired index to reflect storage")
+	}
+
+	report, _ = manager.VerifyIndexes("users", false)
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("Expected no discrepancies after repair, got %+v", report.Discrepancies)
+	}
+}
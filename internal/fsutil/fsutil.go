@@ -0,0 +1,59 @@
+// Package fsutil holds the file writing helpers shared by the storage engine
+// and the index manager, so both replace their files the same way.
+package fsutil
+
+import (
+	"fmt"
+	"os"
+)
+
+// WriteFileAtomic writes data to path using temp file + fsync + rename
+func WriteFileAtomic(path string, data []byte) error {
+	return ReplaceFile(path, data, true)
+}
+
+// ReplaceFile writes data to path using temp file + rename, fsyncing the
+// temp file first if sync is set
+func ReplaceFile(path string, data []byte, sync bool) error {
+	tempPath := path + ".tmp"
+	if err := WriteFile(tempPath, data, sync); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes data to path, fsyncing it if sync is set, removing the
+// file on failure
+func WriteFile(path string, data []byte, sync bool) error {
+	tempFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(path)
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	if sync {
+		if err := tempFile.Sync(); err != nil {
+			tempFile.Close()
+			os.Remove(path)
+			return fmt.Errorf("failed to sync temp file: %w", err)
+		}
+	}
+
+	if err := tempFile.Close(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomicReplacesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(path, []byte(content)); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(data) != content {
+			t.Errorf("Expected %q, got %q", content, data)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected no temp file left behind, got %v", err)
+	}
+}
+
+func TestReplaceFileFailureLeavesTarget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.json")
+	if err := os.WriteFile(path, []byte("kept"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// A directory in the way of the temp file makes the write fail
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := ReplaceFile(path, []byte("lost"), false); err == nil {
+		t.Fatalf("Expected the write to fail")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "kept" {
+		t.Errorf("Expected the target to be untouched, got %q", data)
+	}
+}
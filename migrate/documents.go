@@ -0,0 +1,70 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// batchSize is how many documents ForEachDocument writes per atomic batch
+const batchSize = 500
+
+// TransformFunc rewrites one document for ForEachDocument. It may modify
+// doc and return it, return a new document, or return nil to delete it.
+type TransformFunc func(docID core.DocumentID, doc core.Document) (core.Document, error)
+
+// ForEachDocument passes every document of a collection through transform
+// in ID order, writing the results in atomic batches of 500. A failure
+// stops at the batch it happens in, leaving earlier batches written, so
+// transforms should be safe to run again on documents they already
+// changed. Documents are seen as stored, with encrypted fields wrapped.
+func ForEachDocument(ctx context.Context, c *db.Collection, transform TransformFunc) error {
+	var ids []core.DocumentID
+	err := c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		ids = sortedIDs(docs)
+		return nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(ids); start += batchSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := ids[start:min(start+batchSize, len(ids))]
+
+		err := c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			writes := make(map[core.DocumentID]core.Document, len(chunk))
+			for _, docID := range chunk {
+				doc, exists := docs[docID]
+				if !exists {
+					continue
+				}
+				out, err := transform(docID, doc.Clone())
+				if err != nil {
+					return nil, fmt.Errorf("failed to transform %s/%s: %w", c.Name(), docID, err)
+				}
+				writes[docID] = out
+			}
+			return writes, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedIDs returns the IDs of a collection's documents in order
+func sortedIDs(docs map[core.DocumentID]core.Document) []core.DocumentID {
+	ids := make([]core.DocumentID, 0, len(docs))
+	for docID := range docs {
+		ids = append(ids, docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
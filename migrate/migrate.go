@@ -0,0 +1,242 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// Collection is the collection recording applied migrations
+const Collection = "_migrations"
+
+var (
+	// ErrHistoryMismatch is returned when the applied migrations are not a
+	// prefix of the registered ones, because a migration was added below an
+	// applied one, or one that was applied was renamed, renumbered or removed
+	ErrHistoryMismatch = errors.New("migration history does not match registered migrations")
+	// ErrNoDown is returned when rolling back a migration without a down function
+	ErrNoDown = errors.New("migration has no down function")
+)
+
+// Func migrates a database one way
+type Func func(ctx context.Context, d *db.DB) error
+
+// Migration is one registered migration
+type Migration struct {
+	Version int
+	Name    string
+	Up      Func
+	Down    Func // Optional; MigrateDown fails with ErrNoDown without it
+}
+
+// MigrationStatus is the state of one registered migration
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time // Zero unless applied
+}
+
+// Error reports the migration that failed, which stopped the run
+type Error struct {
+	Version int
+	Name    string
+	Err     error
+}
+
+// Error describes the failed migration
+func (e *Error) Error() string {
+	return fmt.Sprintf("migration %d (%s) failed: %v", e.Version, e.Name, e.Err)
+}
+
+// Unwrap returns the migration's error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Migrator holds an ordered set of migrations
+type Migrator struct {
+	migrations []Migration
+}
+
+// New creates a Migrator without migrations
+func New() *Migrator {
+	return &Migrator{}
+}
+
+// defaultMigrator holds the migrations of the package-level functions
+var defaultMigrator = New()
+
+// Register adds a migration to the package-level Migrator
+func Register(version int, name string, up, down Func) error {
+	return defaultMigrator.Register(version, name, up, down)
+}
+
+// MigrateUp applies the pending migrations of the package-level Migrator
+func MigrateUp(ctx context.Context, d *db.DB) ([]int, error) {
+	return defaultMigrator.MigrateUp(ctx, d)
+}
+
+// MigrateDown rolls back migrations of the package-level Migrator
+func MigrateDown(ctx context.Context, d *db.DB, target int) ([]int, error) {
+	return defaultMigrator.MigrateDown(ctx, d, target)
+}
+
+// Status reports the migrations of the package-level Migrator
+func Status(d *db.DB) ([]MigrationStatus, error) {
+	return defaultMigrator.Status(d)
+}
+
+// Register adds a migration. Versions must be positive and unique; they
+// order the migrations whatever the order of registration.
+func (m *Migrator) Register(version int, name string, up, down Func) error {
+	if version <= 0 {
+		return fmt.Errorf("invalid migration version %d", version)
+	}
+	if up == nil {
+		return fmt.Errorf("missing up function - unable to register migration %d", version)
+	}
+	for _, existing := range m.migrations {
+		if existing.Version == version {
+			return fmt.Errorf("migration %d is already registered as %s", version, existing.Name)
+		}
+	}
+
+	m.migrations = append(m.migrations, Migration{Version: version, Name: name, Up: up, Down: down})
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return nil
+}
+
+// MigrateUp applies the pending migrations in version order and returns the
+// versions it applied. Each is recorded once it succeeds; the first failure
+// stops the run with an *Error. A history that does not match the
+// registered migrations is refused with ErrHistoryMismatch before anything
+// runs.
+func (m *Migrator) MigrateUp(ctx context.Context, d *db.DB) ([]int, error) {
+	history, records, err := m.history(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	for i, migration := range m.migrations[len(records):] {
+		if err := ctx.Err(); err != nil {
+			return applied, err
+		}
+		if err := migration.Up(ctx, d); err != nil {
+			return applied, &Error{Version: migration.Version, Name: migration.Name, Err: err}
+		}
+
+		_, err := history.Insert(core.Document{
+			"_id":        string(recordID(migration.Version)),
+			"version":    migration.Version,
+			"name":       migration.Name,
+			"applied_at": time.Now().UTC().Format(time.RFC3339Nano),
+			"checksum":   m.checksum(len(records) + i + 1),
+		})
+		if err != nil {
+			return applied, &Error{Version: migration.Version, Name: migration.Name, Err: fmt.Errorf("failed to record migration: %w", err)}
+		}
+		applied = append(applied, migration.Version)
+	}
+	return applied, nil
+}
+
+// MigrateDown rolls back the applied migrations above target, newest first,
+// and returns the versions it rolled back. A target of 0 rolls back all.
+func (m *Migrator) MigrateDown(ctx context.Context, d *db.DB, target int) ([]int, error) {
+	history, records, err := m.history(d)
+	if err != nil {
+		return nil, err
+	}
+
+	var rolledBack []int
+	for i := len(records) - 1; i >= 0 && m.migrations[i].Version > target; i-- {
+		migration := m.migrations[i]
+		if err := ctx.Err(); err != nil {
+			return rolledBack, err
+		}
+		if migration.Down == nil {
+			return rolledBack, &Error{Version: migration.Version, Name: migration.Name, Err: ErrNoDown}
+		}
+		if err := migration.Down(ctx, d); err != nil {
+			return rolledBack, &Error{Version: migration.Version, Name: migration.Name, Err: err}
+		}
+		if err := history.Delete(recordID(migration.Version)); err != nil {
+			return rolledBack, &Error{Version: migration.Version, Name: migration.Name, Err: fmt.Errorf("failed to unrecord migration: %w", err)}
+		}
+		rolledBack = append(rolledBack, migration.Version)
+	}
+	return rolledBack, nil
+}
+
+// Status reports every registered migration in version order, failing with
+// ErrHistoryMismatch like MigrateUp
+func (m *Migrator) Status(d *db.DB) ([]MigrationStatus, error) {
+	_, records, err := m.history(d)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if i < len(records) {
+			statuses[i].Applied = true
+			statuses[i].AppliedAt, _ = time.Parse(time.RFC3339Nano, fmt.Sprint(records[i]["applied_at"]))
+		}
+	}
+	return statuses, nil
+}
+
+// history returns the migrations collection and its records in version
+// order, checking that they match the first registered migrations
+func (m *Migrator) history(d *db.DB) (*db.Collection, []core.Document, error) {
+	history, err := d.CreateCollection(Collection)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := history.Find(core.Query{Sort: &core.SortOption{Field: "version"}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read migration history: %w", err)
+	}
+
+	if len(records) > len(m.migrations) {
+		return nil, nil, fmt.Errorf("%w: %d migrations applied, %d registered", ErrHistoryMismatch, len(records), len(m.migrations))
+	}
+	for i, record := range records {
+		migration := m.migrations[i]
+		version, _ := core.ToFloat64(record["version"])
+		if int(version) != migration.Version || record["name"] != migration.Name {
+			return nil, nil, fmt.Errorf("%w: applied migration %v (%v) where %d (%s) is registered", ErrHistoryMismatch, record["version"], record["name"], migration.Version, migration.Name)
+		}
+		if record["checksum"] != m.checksum(i+1) {
+			return nil, nil, fmt.Errorf("%w: migrations up to %d changed since they were applied", ErrHistoryMismatch, migration.Version)
+		}
+	}
+	return history, records, nil
+}
+
+// checksum hashes the versions and names of the first n migrations, so a
+// record detects any change to the list it was applied with
+func (m *Migrator) checksum(n int) string {
+	h := sha256.New()
+	for _, migration := range m.migrations[:n] {
+		fmt.Fprintf(h, "%d:%s\n", migration.Version, migration.Name)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordID is the ID of a migration's record, which sorts by version
+func recordID(version int) core.DocumentID {
+	return core.DocumentID(fmt.Sprintf("%010d", version))
+}
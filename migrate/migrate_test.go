@@ -0,0 +1,198 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// openDB opens a database in a temporary directory
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// recorder returns a migration that appends its name to log
+func recorder(log *[]string, name string) Func {
+	return func(ctx context.Context, d *db.DB) error {
+		*log = append(*log, name)
+		return nil
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	database := openDB(t)
+	var log []string
+
+	m := New()
+	m.Register(2, "second", recorder(&log, "up 2"), recorder(&log, "down 2"))
+	m.Register(1, "first", recorder(&log, "up 1"), recorder(&log, "down 1"))
+	if err := m.Register(1, "again", recorder(&log, "up"), nil); err == nil {
+		t.Errorf("Expected error registering a duplicate version")
+	}
+
+	applied, err := m.MigrateUp(context.Background(), database)
+	if err != nil {
+		t.Fatalf("Failed to migrate up: %v", err)
+	}
+	if !reflect.DeepEqual(applied, []int{1, 2}) || !reflect.DeepEqual(log, []string{"up 1", "up 2"}) {
+		t.Errorf("Expected versions 1 and 2 in order, got %v and %v", applied, log)
+	}
+
+	// Nothing is pending any more
+	if applied, _ := m.MigrateUp(context.Background(), database); len(applied) != 0 {
+		t.Errorf("Expected nothing to apply, got %v", applied)
+	}
+
+	statuses, err := m.Status(database)
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Errorf("Expected %d to be applied, got %+v", status.Version, status)
+		}
+	}
+
+	log = nil
+	rolledBack, err := m.MigrateDown(context.Background(), database, 0)
+	if err != nil {
+		t.Fatalf("Failed to migrate down: %v", err)
+	}
+	if !reflect.DeepEqual(rolledBack, []int{2, 1}) || !reflect.DeepEqual(log, []string{"down 2", "down 1"}) {
+		t.Errorf("Expected versions 2 and 1 rolled back, got %v and %v", rolledBack, log)
+	}
+	if statuses, _ := m.Status(database); statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("Expected nothing applied, got %+v", statuses)
+	}
+}
+
+func TestMigrateUpStopsAtFailure(t *testing.T) {
+	database := openDB(t)
+	var log []string
+	broken := errors.New("broken")
+
+	m := New()
+	m.Register(1, "first", recorder(&log, "up 1"), nil)
+	m.Register(2, "fails", func(ctx context.Context, d *db.DB) error { return broken }, nil)
+	m.Register(3, "third", recorder(&log, "up 3"), nil)
+
+	applied, err := m.MigrateUp(context.Background(), database)
+	var migrationErr *Error
+	if !errors.As(err, &migrationErr) || migrationErr.Version != 2 || !errors.Is(err, broken) {
+		t.Fatalf("Expected migration 2 to fail, got %v", err)
+	}
+	if !reflect.DeepEqual(applied, []int{1}) || !reflect.DeepEqual(log, []string{"up 1"}) {
+		t.Errorf("Expected only version 1 applied, got %v and %v", applied, log)
+	}
+
+	if _, err := m.MigrateDown(context.Background(), database, 0); !errors.Is(err, ErrNoDown) {
+		t.Errorf("Expected ErrNoDown, got %v", err)
+	}
+}
+
+func TestHistoryMismatch(t *testing.T) {
+	noop := func(ctx context.Context, d *db.DB) error { return nil }
+
+	tests := []struct {
+		name     string
+		register func(m *Migrator)
+	}{
+		{"renamed", func(m *Migrator) {
+			m.Register(1, "first", noop, nil)
+			m.Register(3, "renamed", noop, nil)
+		}},
+		{"inserted below applied", func(m *Migrator) {
+			m.Register(1, "first", noop, nil)
+			m.Register(2, "late", noop, nil)
+			m.Register(3, "third", noop, nil)
+		}},
+		{"removed", func(m *Migrator) {
+			m.Register(1, "first", noop, nil)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database := openDB(t)
+			original := New()
+			original.Register(1, "first", noop, nil)
+			original.Register(3, "third", noop, nil)
+			if _, err := original.MigrateUp(context.Background(), database); err != nil {
+				t.Fatalf("Failed to migrate up: %v", err)
+			}
+
+			changed := New()
+			tt.register(changed)
+			if _, err := changed.MigrateUp(context.Background(), database); !errors.Is(err, ErrHistoryMismatch) {
+				t.Errorf("Expected ErrHistoryMismatch from MigrateUp, got %v", err)
+			}
+			if _, err := changed.Status(database); !errors.Is(err, ErrHistoryMismatch) {
+				t.Errorf("Expected ErrHistoryMismatch from Status, got %v", err)
+			}
+		})
+	}
+}
+
+func TestForEachDocument(t *testing.T) {
+	database := openDB(t)
+	users, _ := database.Collection("users")
+	for i := 0; i < 1200; i++ {
+		users.Insert(core.Document{"_id": fmt.Sprintf("u%04d", i), "fullname": fmt.Sprintf("User %d", i)})
+	}
+
+	m := New()
+	m.Register(1, "rename fullname to name", func(ctx context.Context, d *db.DB) error {
+		users, err := d.Collection("users")
+		if err != nil {
+			return err
+		}
+		return ForEachDocument(ctx, users, func(docID core.DocumentID, doc core.Document) (core.Document, error) {
+			if docID == "u0007" {
+				return nil, nil
+			}
+			doc["name"] = doc["fullname"]
+			delete(doc, "fullname")
+			return doc, nil
+		})
+	}, nil)
+
+	if _, err := m.MigrateUp(context.Background(), database); err != nil {
+		t.Fatalf("Failed to migrate up: %v", err)
+	}
+
+	if n, _ := users.Count(core.Query{}); n != 1199 {
+		t.Errorf("Expected 1199 users, got %d", n)
+	}
+	if n, _ := users.Count(core.Query{Filters: []core.Filter{{Field: "fullname", Operator: core.OpExists, Value: true}}}); n != 0 {
+		t.Errorf("Expected no fullname fields left, got %d", n)
+	}
+	if doc, _ := users.Get("u1100"); doc["name"] != "User 1100" {
+		t.Errorf("Expected the renamed field, got %v", doc)
+	}
+
+	// A failing transform stops at its batch
+	err := ForEachDocument(context.Background(), users, func(docID core.DocumentID, doc core.Document) (core.Document, error) {
+		if docID == "u0600" {
+			return nil, errors.New("bad document")
+		}
+		doc["touched"] = true
+		return doc, nil
+	})
+	if err == nil {
+		t.Fatalf("Expected the transform error")
+	}
+	if n, _ := users.Count(core.Query{Filters: []core.Filter{{Field: "touched", Operator: core.OpEqual, Value: true}}}); n != 500 {
+		t.Errorf("Expected only the first batch written, got %d", n)
+	}
+}
@@ -0,0 +1,237 @@
+package qlang
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Pos is a position in the input, counted from line 1, column 1
+type Pos struct {
+	Line   int
+	Column int
+}
+
+// SyntaxError reports invalid input at a position
+type SyntaxError struct {
+	Pos
+	Msg string
+}
+
+// Error formats the error with its position
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// tokenKind classifies tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokString
+	tokNumber
+	tokComma
+	tokLParen
+	tokRParen
+	tokStar
+	tokOperator
+)
+
+// keywords are matched case-insensitively and stored upper-cased
+var keywords = map[string]bool{
+	"SELECT": true, "FROM": true, "WHERE": true, "AND": true, "OR": true,
+	"NOT": true, "IN": true, "LIKE": true, "IS": true, "NULL": true,
+	"TRUE": true, "FALSE": true, "ORDER": true, "BY": true, "ASC": true,
+	"DESC": true, "LIMIT": true, "OFFSET": true, "COUNT": true,
+}
+
+// token is one lexical token
+type token struct {
+	kind tokenKind
+	text string // Keywords upper-cased, strings unquoted
+	pos  Pos
+}
+
+// describe names a token for error messages
+func (t token) describe() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of input"
+	case tokString:
+		return fmt.Sprintf("string '%s'", t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// lexer splits input into tokens
+type lexer struct {
+	input []rune
+	off   int
+	pos   Pos
+}
+
+// tokenize returns every token of the input, ending with tokEOF
+func tokenize(input string) ([]token, error) {
+	l := &lexer{input: []rune(input), pos: Pos{Line: 1, Column: 1}}
+
+	var tokens []token
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokEOF {
+			return tokens, nil
+		}
+	}
+}
+
+// peek returns the rune at offset n from the current one, or 0 past the end
+func (l *lexer) peek(n int) rune {
+	if l.off+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.off+n]
+}
+
+// advance consumes one rune, tracking the position
+func (l *lexer) advance() rune {
+	r := l.input[l.off]
+	l.off++
+	if r == '\n' {
+		l.pos.Line++
+		l.pos.Column = 1
+	} else {
+		l.pos.Column++
+	}
+	return r
+}
+
+// next scans the next token
+func (l *lexer) next() (token, error) {
+	for l.off < len(l.input) && unicode.IsSpace(l.peek(0)) {
+		l.advance()
+	}
+
+	start := l.pos
+	if l.off >= len(l.input) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	r := l.peek(0)
+	switch {
+	case r == ',':
+		l.advance()
+		return token{kind: tokComma, text: ",", pos: start}, nil
+	case r == '(':
+		l.advance()
+		return token{kind: tokLParen, text: "(", pos: start}, nil
+	case r == ')':
+		l.advance()
+		return token{kind: tokRParen, text: ")", pos: start}, nil
+	case r == '*':
+		l.advance()
+		return token{kind: tokStar, text: "*", pos: start}, nil
+	case r == '\'':
+		return l.quoted('\'', tokString, start)
+	case r == '"' || r == '`':
+		return l.quoted(r, tokIdent, start)
+	case strings.ContainsRune("=<>!", r):
+		return l.operator(start)
+	case unicode.IsDigit(r) || ((r == '-' || r == '.') && unicode.IsDigit(l.peek(1))):
+		return l.number(start), nil
+	case isIdentStart(r):
+		return l.identifier(start), nil
+	}
+	return token{}, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+// quoted scans a quoted string or identifier; a doubled quote escapes itself
+func (l *lexer) quoted(quote rune, kind tokenKind, start Pos) (token, error) {
+	l.advance()
+
+	var b strings.Builder
+	for {
+		if l.off >= len(l.input) {
+			return token{}, &SyntaxError{Pos: start, Msg: "unterminated quoted text"}
+		}
+		r := l.advance()
+		if r == quote {
+			if l.peek(0) != quote {
+				break
+			}
+			l.advance()
+		}
+		b.WriteRune(r)
+	}
+
+	if kind == tokIdent && b.Len() == 0 {
+		return token{}, &SyntaxError{Pos: start, Msg: "empty quoted identifier"}
+	}
+	return token{kind: kind, text: b.String(), pos: start}, nil
+}
+
+// operator scans a comparison operator
+func (l *lexer) operator(start Pos) (token, error) {
+	first := l.advance()
+	second := l.peek(0)
+
+	text := string(first)
+	switch {
+	case first == '<' && (second == '=' || second == '>'),
+		first == '>' && second == '=',
+		first == '!' && second == '=',
+		first == '=' && second == '=':
+		text += string(l.advance())
+	case first == '!':
+		return token{}, &SyntaxError{Pos: start, Msg: "unexpected character '!'"}
+	}
+	return token{kind: tokOperator, text: text, pos: start}, nil
+}
+
+// number scans a decimal number with optional sign, fraction and exponent
+func (l *lexer) number(start Pos) token {
+	var b strings.Builder
+	if l.peek(0) == '-' {
+		b.WriteRune(l.advance())
+	}
+	for unicode.IsDigit(l.peek(0)) || l.peek(0) == '.' {
+		b.WriteRune(l.advance())
+	}
+	if (l.peek(0) == 'e' || l.peek(0) == 'E') && (unicode.IsDigit(l.peek(1)) || ((l.peek(1) == '-' || l.peek(1) == '+') && unicode.IsDigit(l.peek(2)))) {
+		b.WriteRune(l.advance())
+		b.WriteRune(l.advance())
+		for unicode.IsDigit(l.peek(0)) {
+			b.WriteRune(l.advance())
+		}
+	}
+	return token{kind: tokNumber, text: b.String(), pos: start}
+}
+
+// identifier scans a field name, collection name or keyword. Dots separate
+// path segments and a leading $ allows pseudo-fields such as $id.
+func (l *lexer) identifier(start Pos) token {
+	var b strings.Builder
+	for l.off < len(l.input) && isIdentPart(l.peek(0)) {
+		b.WriteRune(l.advance())
+	}
+
+	text := b.String()
+	if upper := strings.ToUpper(text); keywords[upper] {
+		return token{kind: tokKeyword, text: upper, pos: start}
+	}
+	return token{kind: tokIdent, text: text, pos: start}
+}
+
+// isIdentStart reports whether r can start an identifier
+func isIdentStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+// isIdentPart reports whether r can continue an identifier
+func isIdentPart(r rune) bool {
+	return isIdentStart(r) || unicode.IsDigit(r) || r == '.'
+}
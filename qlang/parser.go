@@ -0,0 +1,459 @@
+package qlang
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// Statement is a parsed SELECT statement
+type Statement struct {
+	Query core.Query
+	Count bool // SELECT COUNT(*): the statement returns the number of matches
+}
+
+// comparisons maps comparison operators to filter operators
+var comparisons = map[string]core.FilterOperator{
+	"=":  core.OpEqual,
+	"==": core.OpEqual,
+	"!=": core.OpNotEqual,
+	"<>": core.OpNotEqual,
+	"<":  core.OpLessThan,
+	"<=": core.OpLessThanOrEqual,
+	">":  core.OpGreaterThan,
+	">=": core.OpGreaterThanOrEqual,
+}
+
+// parser builds a Statement from tokens
+type parser struct {
+	tokens []token
+	off    int
+}
+
+// Parse parses a statement of the supported SELECT subset:
+//
+//	SELECT * | COUNT(*) | field, ... FROM collection
+//	  [WHERE condition] [ORDER BY field [ASC|DESC], ...] [LIMIT n] [OFFSET n]
+//
+// Conditions combine predicates with AND, OR, NOT and parentheses. Predicates
+// compare a field with a literal (=, !=, <>, <, <=, >, >=), test membership
+// with [NOT] IN (...), match patterns with [NOT] LIKE, where % matches any
+// run of characters and _ any single one, or test IS [NOT] NULL. Literals
+// are 'strings', numbers, TRUE, FALSE and NULL. Keywords are
+// case-insensitive; field names are dotted paths, quoted with "" or “ when
+// they are not plain identifiers.
+//
+// Errors are *SyntaxError values carrying the line and column.
+func Parse(input string) (*Statement, error) {
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// peek returns the current token
+func (p *parser) peek() token {
+	return p.tokens[p.off]
+}
+
+// advance consumes the current token
+func (p *parser) advance() token {
+	tok := p.tokens[p.off]
+	if tok.kind != tokEOF {
+		p.off++
+	}
+	return tok
+}
+
+// isKeyword reports whether the current token is the keyword
+func (p *parser) isKeyword(keyword string) bool {
+	tok := p.peek()
+	return tok.kind == tokKeyword && tok.text == keyword
+}
+
+// acceptKeyword consumes the keyword if it is the current token
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.advance()
+		return true
+	}
+	return false
+}
+
+// expectKeyword consumes the keyword or fails
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return p.errorf("expected %s, found %s", keyword, p.peek().describe())
+	}
+	return nil
+}
+
+// expect consumes a token of the kind or fails
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	if p.peek().kind != kind {
+		return token{}, p.errorf("expected %s, found %s", what, p.peek().describe())
+	}
+	return p.advance(), nil
+}
+
+// errorf reports an error at the current token
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return p.errorAt(p.peek(), format, args...)
+}
+
+// errorAt reports an error at a token
+func (p *parser) errorAt(tok token, format string, args ...interface{}) error {
+	return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// statement parses a whole SELECT statement
+func (p *parser) statement() (*Statement, error) {
+	if err := p.expectKeyword("SELECT"); err != nil {
+		return nil, err
+	}
+
+	stmt := &Statement{}
+	if err := p.selectList(stmt); err != nil {
+		return nil, err
+	}
+
+	if err := p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	collection, err := p.expect(tokIdent, "collection name")
+	if err != nil {
+		return nil, err
+	}
+	stmt.Query.Collection = collection.text
+
+	if p.acceptKeyword("WHERE") {
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		query.SetFilter(&stmt.Query, node)
+	}
+
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if err := p.orderBy(&stmt.Query); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.acceptKeyword("LIMIT") {
+		if stmt.Query.Limit, err = p.count(); err != nil {
+			return nil, err
+		}
+	}
+	if p.acceptKeyword("OFFSET") {
+		if stmt.Query.Offset, err = p.count(); err != nil {
+			return nil, err
+		}
+	}
+
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.errorAt(tok, "unexpected %s", tok.describe())
+	}
+	return stmt, nil
+}
+
+// selectList parses *, COUNT(*) or a list of fields
+func (p *parser) selectList(stmt *Statement) error {
+	if p.peek().kind == tokStar {
+		p.advance()
+		return nil
+	}
+
+	if p.acceptKeyword("COUNT") {
+		for _, step := range []struct {
+			kind tokenKind
+			what string
+		}{{tokLParen, "("}, {tokStar, "*"}, {tokRParen, ")"}} {
+			if _, err := p.expect(step.kind, step.what); err != nil {
+				return err
+			}
+		}
+		stmt.Count = true
+		return nil
+	}
+
+	for {
+		field, err := p.expect(tokIdent, "field name")
+		if err != nil {
+			return err
+		}
+		stmt.Query.Projection = append(stmt.Query.Projection, field.text)
+
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.advance()
+	}
+}
+
+// orderBy parses a list of sort keys
+func (p *parser) orderBy(q *core.Query) error {
+	for {
+		field, err := p.expect(tokIdent, "field name")
+		if err != nil {
+			return err
+		}
+
+		key := core.SortOption{Field: field.text}
+		if p.acceptKeyword("DESC") {
+			key.Descending = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+
+		if q.Sort == nil {
+			q.Sort = &key
+		} else {
+			q.SortBy = append(q.SortBy, key)
+		}
+
+		if p.peek().kind != tokComma {
+			return nil
+		}
+		p.advance()
+	}
+}
+
+// count parses a non-negative integer
+func (p *parser) count() (int, error) {
+	tok, err := p.expect(tokNumber, "number")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok.text)
+	if err != nil || n < 0 {
+		return 0, p.errorAt(tok, "expected a non-negative integer, found %s", tok.describe())
+	}
+	return n, nil
+}
+
+// or parses conditions joined by OR
+func (p *parser) or() (core.FilterNode, error) {
+	node, err := p.and()
+	if err != nil {
+		return core.FilterNode{}, err
+	}
+
+	children := []core.FilterNode{node}
+	for p.acceptKeyword("OR") {
+		node, err := p.and()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return core.Or(children...), nil
+}
+
+// and parses conditions joined by AND
+func (p *parser) and() (core.FilterNode, error) {
+	node, err := p.unary()
+	if err != nil {
+		return core.FilterNode{}, err
+	}
+
+	children := []core.FilterNode{node}
+	for p.acceptKeyword("AND") {
+		node, err := p.unary()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		children = append(children, node)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+	return core.And(children...), nil
+}
+
+// unary parses NOT, a parenthesized condition or a predicate
+func (p *parser) unary() (core.FilterNode, error) {
+	if p.acceptKeyword("NOT") {
+		node, err := p.unary()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		return core.Not(node), nil
+	}
+
+	if p.peek().kind == tokLParen {
+		p.advance()
+		node, err := p.or()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		if _, err := p.expect(tokRParen, ")"); err != nil {
+			return core.FilterNode{}, err
+		}
+		return node, nil
+	}
+
+	return p.predicate()
+}
+
+// predicate parses a condition on one field
+func (p *parser) predicate() (core.FilterNode, error) {
+	field, err := p.expect(tokIdent, "field name")
+	if err != nil {
+		return core.FilterNode{}, err
+	}
+
+	if tok := p.peek(); tok.kind == tokOperator {
+		p.advance()
+		valueTok := p.peek()
+		value, err := p.literal()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		if value == nil {
+			return core.FilterNode{}, p.errorAt(valueTok, "comparison with NULL; use IS NULL or IS NOT NULL")
+		}
+		return core.Leaf(core.Filter{Field: field.text, Operator: comparisons[tok.text], Value: value}), nil
+	}
+
+	if p.acceptKeyword("IS") {
+		negate := p.acceptKeyword("NOT")
+		if err := p.expectKeyword("NULL"); err != nil {
+			return core.FilterNode{}, err
+		}
+		return core.Leaf(core.Filter{Field: field.text, Operator: core.OpIsNull, Value: !negate}), nil
+	}
+
+	negate := p.acceptKeyword("NOT")
+	var node core.FilterNode
+	switch {
+	case p.acceptKeyword("IN"):
+		values, err := p.list()
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		op := core.OpIn
+		if negate {
+			op, negate = core.OpNotIn, false
+		}
+		node = core.Leaf(core.Filter{Field: field.text, Operator: op, Value: values})
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.expect(tokString, "pattern string")
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		node = core.Leaf(likeFilter(field.text, pattern.text))
+	default:
+		return core.FilterNode{}, p.errorf("expected comparison, IN, LIKE or IS after %s, found %s", field.text, p.peek().describe())
+	}
+
+	if negate {
+		return core.Not(node), nil
+	}
+	return node, nil
+}
+
+// list parses a parenthesized list of literals
+func (p *parser) list() ([]interface{}, error) {
+	if _, err := p.expect(tokLParen, "("); err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{}
+	for {
+		value, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		if p.peek().kind != tokComma {
+			break
+		}
+		p.advance()
+	}
+
+	if _, err := p.expect(tokRParen, ")"); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// literal parses a string, number, boolean or NULL. Numbers are float64, as
+// in decoded documents.
+func (p *parser) literal() (interface{}, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == tokString:
+		p.advance()
+		return tok.text, nil
+	case tok.kind == tokNumber:
+		p.advance()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorAt(tok, "invalid number %s", tok.text)
+		}
+		return f, nil
+	case tok.kind == tokKeyword && (tok.text == "TRUE" || tok.text == "FALSE"):
+		p.advance()
+		return tok.text == "TRUE", nil
+	case tok.kind == tokKeyword && tok.text == "NULL":
+		p.advance()
+		return nil, nil
+	}
+	return nil, p.errorf("expected a value, found %s", tok.describe())
+}
+
+// likeFilter translates a LIKE pattern into the cheapest equivalent filter:
+// an equality, prefix, suffix or substring match, or an anchored regular
+// expression for anything else
+func likeFilter(field, pattern string) core.Filter {
+	inner := strings.Trim(pattern, "%")
+	if !strings.ContainsAny(inner, "%_") {
+		leading, trailing := strings.HasPrefix(pattern, "%"), strings.HasSuffix(pattern, "%")
+		switch {
+		case leading && trailing:
+			return core.Filter{Field: field, Operator: core.OpContains, Value: inner}
+		case trailing:
+			return core.Filter{Field: field, Operator: core.OpHasPrefix, Value: inner}
+		case leading:
+			return core.Filter{Field: field, Operator: core.OpHasSuffix, Value: inner}
+		default:
+			return core.Filter{Field: field, Operator: core.OpEqual, Value: inner}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return core.Filter{Field: field, Operator: core.OpRegex, Value: "(?s)" + b.String()}
+}
@@ -0,0 +1,209 @@
+package qlang
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func leaf(field string, op core.FilterOperator, value interface{}) core.FilterNode {
+	return core.Leaf(core.Filter{Field: field, Operator: op, Value: value})
+}
+
+func where(node core.FilterNode) *core.FilterNode {
+	return &node
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Statement
+	}{
+		{
+			name:     "select all",
+			input:    "SELECT * FROM users",
+			expected: Statement{Query: core.Query{Collection: "users"}},
+		},
+		{
+			name:  "full statement",
+			input: "SELECT name, email FROM users WHERE age >= 18 AND status = 'active' ORDER BY name DESC LIMIT 10",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Projection: []string{"name", "email"},
+				Filters: []core.Filter{
+					{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: 18.0},
+					{Field: "status", Operator: core.OpEqual, Value: "active"},
+				},
+				Sort:  &core.SortOption{Field: "name", Descending: true},
+				Limit: 10,
+			}},
+		},
+		{
+			name:  "lowercase keywords, multiple sort keys and offset",
+			input: "select * from users order by city, age desc, name asc limit 5 offset 10",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Sort:       &core.SortOption{Field: "city"},
+				SortBy:     []core.SortOption{{Field: "age", Descending: true}, {Field: "name"}},
+				Limit:      5,
+				Offset:     10,
+			}},
+		},
+		{
+			name:  "or binds looser than and",
+			input: "SELECT * FROM users WHERE a = 1 AND b = 2 OR NOT c = 3",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Where: where(core.Or(
+					core.And(leaf("a", core.OpEqual, 1.0), leaf("b", core.OpEqual, 2.0)),
+					core.Not(leaf("c", core.OpEqual, 3.0)),
+				)),
+			}},
+		},
+		{
+			name:  "parentheses",
+			input: "SELECT * FROM users WHERE a = 1 AND (b = 2 OR c <> 3)",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Where: where(core.And(
+					leaf("a", core.OpEqual, 1.0),
+					core.Or(leaf("b", core.OpEqual, 2.0), leaf("c", core.OpNotEqual, 3.0)),
+				)),
+			}},
+		},
+		{
+			name:  "in, not in and null tests",
+			input: "SELECT * FROM users WHERE role IN ('admin', 'owner') AND tier NOT IN (1, 2) AND deleted IS NULL AND email IS NOT NULL",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Filters: []core.Filter{
+					{Field: "role", Operator: core.OpIn, Value: []interface{}{"admin", "owner"}},
+					{Field: "tier", Operator: core.OpNotIn, Value: []interface{}{1.0, 2.0}},
+					{Field: "deleted", Operator: core.OpIsNull, Value: true},
+					{Field: "email", Operator: core.OpIsNull, Value: false},
+				},
+			}},
+		},
+		{
+			name:  "literals",
+			input: "SELECT * FROM users WHERE active = TRUE AND banned != false AND score > -1.5e2 AND name = 'O''Brien'",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Filters: []core.Filter{
+					{Field: "active", Operator: core.OpEqual, Value: true},
+					{Field: "banned", Operator: core.OpNotEqual, Value: false},
+					{Field: "score", Operator: core.OpGreaterThan, Value: -150.0},
+					{Field: "name", Operator: core.OpEqual, Value: "O'Brien"},
+				},
+			}},
+		},
+		{
+			name:  "quoted and dotted fields",
+			input: "SELECT \"first name\", address.city FROM `user list` WHERE $id = 'u1' AND \"a b.c\" < 3",
+			expected: Statement{Query: core.Query{
+				Collection: "user list",
+				Projection: []string{"first name", "address.city"},
+				Filters: []core.Filter{
+					{Field: core.DocumentIDField, Operator: core.OpEqual, Value: "u1"},
+					{Field: "a b.c", Operator: core.OpLessThan, Value: 3.0},
+				},
+			}},
+		},
+		{
+			name:     "count",
+			input:    "SELECT COUNT(*) FROM users WHERE age > 30",
+			expected: Statement{Count: true, Query: core.Query{Collection: "users", Filters: []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 30.0}}}},
+		},
+		{
+			name:  "not like",
+			input: "SELECT * FROM users WHERE name NOT LIKE 'A%'",
+			expected: Statement{Query: core.Query{
+				Collection: "users",
+				Where:      where(core.Not(leaf("name", core.OpHasPrefix, "A"))),
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stmt, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if !reflect.DeepEqual(*stmt, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *stmt)
+			}
+		})
+	}
+}
+
+func TestParseLike(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected core.Filter
+	}{
+		{"abc", core.Filter{Field: "f", Operator: core.OpEqual, Value: "abc"}},
+		{"abc%", core.Filter{Field: "f", Operator: core.OpHasPrefix, Value: "abc"}},
+		{"%abc", core.Filter{Field: "f", Operator: core.OpHasSuffix, Value: "abc"}},
+		{"%abc%", core.Filter{Field: "f", Operator: core.OpContains, Value: "abc"}},
+		{"%", core.Filter{Field: "f", Operator: core.OpContains, Value: ""}},
+		{"a_c", core.Filter{Field: "f", Operator: core.OpRegex, Value: "(?s)^a.c$"}},
+		{"a%c.d", core.Filter{Field: "f", Operator: core.OpRegex, Value: `(?s)^a.*c\.d$`}},
+	}
+
+	for _, tt := range tests {
+		stmt, err := Parse("SELECT * FROM t WHERE f LIKE '" + tt.pattern + "'")
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.pattern, err)
+		}
+		if !reflect.DeepEqual(stmt.Query.Filters, []core.Filter{tt.expected}) {
+			t.Errorf("Expected %q to compile to %+v, got %+v", tt.pattern, tt.expected, stmt.Query.Filters)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+	}{
+		{"", 1, 1},
+		{"UPDATE users", 1, 1},
+		{"SELECT FROM users", 1, 8},
+		{"SELECT * users", 1, 10},
+		{"SELECT * FROM", 1, 14},
+		{"SELECT * FROM users WHERE", 1, 26},
+		{"SELECT * FROM users WHERE age", 1, 30},
+		{"SELECT * FROM users WHERE age = NULL", 1, 33},
+		{"SELECT * FROM users WHERE age >", 1, 32},
+		{"SELECT * FROM users WHERE (age > 1", 1, 35},
+		{"SELECT * FROM users WHERE age IN 1", 1, 34},
+		{"SELECT * FROM users WHERE name LIKE 5", 1, 37},
+		{"SELECT * FROM users WHERE name = 'open", 1, 34},
+		{"SELECT * FROM users WHERE a ! 1", 1, 29},
+		{"SELECT * FROM users WHERE a = 1.2.3", 1, 31},
+		{"SELECT * FROM users LIMIT -1", 1, 27},
+		{"SELECT * FROM users LIMIT 1.5", 1, 27},
+		{"SELECT * FROM users ORDER name", 1, 27},
+		{"SELECT COUNT(name) FROM users", 1, 14},
+		{"SELECT * FROM users LIMIT 1 extra", 1, 29},
+		{"SELECT *\nFROM users\nWHERE age >= 18\n  AND status = ;", 4, 16},
+		{"SELECT * FROM users WHERE a = 1 # comment", 1, 33},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Expected a syntax error for %q, got %v", tt.input, err)
+			continue
+		}
+		if syntaxErr.Line != tt.line || syntaxErr.Column != tt.column {
+			t.Errorf("Expected error for %q at %d:%d, got %v", tt.input, tt.line, tt.column, err)
+		}
+	}
+}
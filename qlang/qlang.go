@@ -0,0 +1,29 @@
+package qlang
+
+import (
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// CountField is the key of the single document returned for SELECT COUNT(*)
+const CountField = "count"
+
+// Run parses a statement and executes it. A field list projects results,
+// which carry the document ID under core.DefaultIDField. SELECT COUNT(*)
+// returns one document holding the number of matches under CountField;
+// ORDER BY, LIMIT and OFFSET do not affect it.
+func Run(executor *query.Executor, input string) ([]core.Document, error) {
+	stmt, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if stmt.Count {
+		count, err := executor.ExecuteCount(stmt.Query)
+		if err != nil {
+			return nil, err
+		}
+		return []core.Document{{CountField: count}}, nil
+	}
+	return executor.Execute(stmt.Query)
+}
@@ -0,0 +1,84 @@
+package qlang
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func setupExecutor(t *testing.T) *query.Executor {
+	engine, err := storage.NewFileStorageEngine(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	users := []core.Document{
+		{"name": "Alice", "email": "alice@example.com", "age": 30, "status": "active"},
+		{"name": "Bob", "email": "bob@example.com", "age": 17, "status": "active"},
+		{"name": "Carol", "email": "carol@example.org", "age": 45, "status": "inactive"},
+		{"name": "Dave", "email": "dave@example.com", "age": 22, "status": "active"},
+	}
+	for _, doc := range users {
+		if err := engine.WriteDocument("users", core.DocumentID(doc["name"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	return query.NewExecutor(engine, nil)
+}
+
+func TestRun(t *testing.T) {
+	executor := setupExecutor(t)
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []core.Document
+	}{
+		{
+			name:  "projection, filter and sort",
+			input: "SELECT name, email FROM users WHERE age >= 18 AND status = 'active' ORDER BY name DESC LIMIT 10",
+			expected: []core.Document{
+				{"id": "Dave", "name": "Dave", "email": "dave@example.com"},
+				{"id": "Alice", "name": "Alice", "email": "alice@example.com"},
+			},
+		},
+		{
+			name:  "like and or",
+			input: "SELECT name FROM users WHERE email LIKE '%.org' OR name LIKE 'B_b' ORDER BY age",
+			expected: []core.Document{
+				{"id": "Bob", "name": "Bob"},
+				{"id": "Carol", "name": "Carol"},
+			},
+		},
+		{
+			name:     "count",
+			input:    "SELECT COUNT(*) FROM users WHERE status IN ('active') AND NOT age < 18",
+			expected: []core.Document{{CountField: 2}},
+		},
+		{
+			name:     "offset",
+			input:    "SELECT name FROM users ORDER BY age LIMIT 1 OFFSET 2",
+			expected: []core.Document{{"id": "Alice", "name": "Alice"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := Run(executor, tt.input)
+			if err != nil {
+				t.Fatalf("Failed to run: %v", err)
+			}
+			if !reflect.DeepEqual(docs, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, docs)
+			}
+		})
+	}
+
+	if _, err := Run(executor, "SELECT * FROM users WHERE name LIKE"); err == nil {
+		t.Errorf("Expected a syntax error")
+	}
+}
@@ -0,0 +1,189 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// AggregateFunc names an aggregate function
+type AggregateFunc string
+
+const (
+	AggCount AggregateFunc = "count" // Matching documents, or documents where Field is present
+	AggSum   AggregateFunc = "sum"
+	AggAvg   AggregateFunc = "avg"
+	AggMin   AggregateFunc = "min"
+	AggMax   AggregateFunc = "max"
+)
+
+// AggregateSpec describes one aggregate to compute. Sum, avg, min and max
+// skip documents where the field is missing or not a number.
+type AggregateSpec struct {
+	Function AggregateFunc
+	Field    string // Dotted path; optional for count
+	Name     string // Result key; defaults to "function(field)", or "count" for a plain count
+}
+
+// key returns the result key of the aggregate
+func (s AggregateSpec) key() string {
+	switch {
+	case s.Name != "":
+		return s.Name
+	case s.Field == "":
+		return string(s.Function)
+	}
+	return fmt.Sprintf("%s(%s)", s.Function, s.Field)
+}
+
+// accumulator folds values into one aggregate
+type accumulator struct {
+	spec  AggregateSpec
+	count int
+	sum   float64
+	best  float64
+}
+
+// add folds one document into the aggregate
+func (a *accumulator) add(doc core.Document) {
+	if a.spec.Function == AggCount {
+		if a.spec.Field == "" {
+			a.count++
+		} else if _, found := core.GetPath(doc, a.spec.Field); found {
+			a.count++
+		}
+		return
+	}
+
+	value, found := core.GetPath(doc, a.spec.Field)
+	if !found {
+		return
+	}
+	n, ok := core.ToFloat64(value)
+	if !ok {
+		return
+	}
+
+	switch {
+	case a.count == 0,
+		a.spec.Function == AggMin && n < a.best,
+		a.spec.Function == AggMax && n > a.best:
+		a.best = n
+	}
+	a.count++
+	a.sum += n
+}
+
+// result returns the aggregate value. Averages, minimums and maximums over
+// no values are nil.
+func (a *accumulator) result() interface{} {
+	switch a.spec.Function {
+	case AggCount:
+		return a.count
+	case AggSum:
+		return a.sum
+	}
+	if a.count == 0 {
+		return nil
+	}
+	if a.spec.Function == AggAvg {
+		return a.sum / float64(a.count)
+	}
+	return a.best
+}
+
+// Aggregate computes aggregates over the documents of a collection matching
+// q, which may be nil to aggregate every document. Offset and Limit, if set,
+// restrict the documents aggregated as they would restrict Execute's
+// results. Counts are ints; every other numeric result is a float64, matching
+// how the storage engine decodes numbers.
+func (e *Executor) Aggregate(collection string, q *core.Query, aggs []AggregateSpec) (map[string]interface{}, error) {
+	query, err := queryFor(collection, q)
+	if err != nil {
+		return nil, err
+	}
+	accs, err := newAccumulators(aggs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.forEachMatch(query, func(doc core.Document) {
+		for _, acc := range accs {
+			acc.add(doc)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aggregateResults(accs), nil
+}
+
+// queryFor returns the query to aggregate over a collection; q may be nil
+func queryFor(collection string, q *core.Query) (core.Query, error) {
+	if q == nil {
+		return core.Query{Collection: collection}, nil
+	}
+	if q.Collection != "" && q.Collection != collection {
+		return core.Query{}, fmt.Errorf("query targets collection %s, not %s", q.Collection, collection)
+	}
+	query := *q
+	query.Collection = collection
+	return query, nil
+}
+
+// forEachMatch calls fn for every document a query returns. Without Offset or
+// Limit the matches are streamed rather than collected and sorted.
+func (e *Executor) forEachMatch(q core.Query, fn func(core.Document)) error {
+	if q.Offset != 0 || q.Limit != 0 {
+		results, err := e.run(q)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			fn(r.doc)
+		}
+		return nil
+	}
+
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return err
+	}
+	return e.scanMatches(q.Collection, compiled, func(_ core.DocumentID, doc core.Document) bool {
+		fn(doc)
+		return true
+	})
+}
+
+// aggregateResults returns the values of accumulators keyed by aggregate name
+func aggregateResults(accs []*accumulator) map[string]interface{} {
+	out := make(map[string]interface{}, len(accs))
+	for _, acc := range accs {
+		out[acc.spec.key()] = acc.result()
+	}
+	return out
+}
+
+// newAccumulators validates aggregate specs and prepares their accumulators
+func newAccumulators(aggs []AggregateSpec) ([]*accumulator, error) {
+	accs := make([]*accumulator, 0, len(aggs))
+	seen := make(map[string]bool, len(aggs))
+	for _, spec := range aggs {
+		switch spec.Function {
+		case AggCount:
+		case AggSum, AggAvg, AggMin, AggMax:
+			if spec.Field == "" {
+				return nil, fmt.Errorf("missing field for %s aggregate", spec.Function)
+			}
+		default:
+			return nil, fmt.Errorf("unknown aggregate function: %q", spec.Function)
+		}
+
+		if seen[spec.key()] {
+			return nil, fmt.Errorf("duplicate aggregate name: %s", spec.key())
+		}
+		seen[spec.key()] = true
+		accs = append(accs, &accumulator{spec: spec})
+	}
+	return accs, nil
+}
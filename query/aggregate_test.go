@@ -0,0 +1,115 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedOrders(t *testing.T, engine core.StorageEngine) {
+	orders := []core.Document{
+		{"id": "o1", "status": "paid", "total": 10, "shipping": map[string]interface{}{"cost": 2.5}},
+		{"id": "o2", "status": "paid", "total": 20.5, "shipping": map[string]interface{}{"cost": 0}},
+		{"id": "o3", "status": "paid", "total": int64(4)},
+		{"id": "o4", "status": "open", "total": "n/a"},
+		{"id": "o5", "status": "open", "total": nil},
+		{"id": "o6", "status": "open"},
+	}
+	for _, doc := range orders {
+		if err := engine.WriteDocument("orders", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedOrders(t, engine)
+
+	aggs := []AggregateSpec{
+		{Function: AggCount},
+		{Function: AggCount, Field: "total"},
+		{Function: AggSum, Field: "total"},
+		{Function: AggAvg, Field: "total"},
+		{Function: AggMin, Field: "total"},
+		{Function: AggMax, Field: "total", Name: "largest"},
+		{Function: AggSum, Field: "shipping.cost"},
+	}
+
+	got, err := executor.Aggregate("orders", nil, aggs)
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	expected := map[string]interface{}{
+		"count":              6,
+		"count(total)":       5, // Present, even if null or not a number
+		"sum(total)":         34.5,
+		"avg(total)":         11.5,
+		"min(total)":         4.0,
+		"largest":            20.5,
+		"sum(shipping.cost)": 2.5,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// A query narrows the documents, and a window applies in sort order
+	paid := &core.Query{
+		Filters: []core.Filter{{Field: "status", Operator: core.OpEqual, Value: "paid"}},
+		Sort:    &core.SortOption{Field: "total", Descending: true},
+		Limit:   2,
+	}
+	got, _ = executor.Aggregate("orders", paid, []AggregateSpec{{Function: AggSum, Field: "total"}, {Function: AggCount}})
+	if got["sum(total)"] != 30.5 || got["count"] != 2 {
+		t.Errorf("Expected the two largest paid orders, got %v", got)
+	}
+}
+
+func TestAggregateEmpty(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedOrders(t, engine)
+
+	none := &core.Query{Filters: []core.Filter{{Field: "status", Operator: core.OpEqual, Value: "refunded"}}}
+	got, err := executor.Aggregate("orders", none, []AggregateSpec{
+		{Function: AggCount},
+		{Function: AggSum, Field: "total"},
+		{Function: AggAvg, Field: "total"},
+		{Function: AggMin, Field: "total"},
+		{Function: AggMax, Field: "total"},
+	})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	expected := map[string]interface{}{"count": 0, "sum(total)": 0.0, "avg(total)": nil, "min(total)": nil, "max(total)": nil}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Only non-numeric values behave like no values
+	open := &core.Query{Filters: []core.Filter{{Field: "status", Operator: core.OpEqual, Value: "open"}}}
+	got, _ = executor.Aggregate("orders", open, []AggregateSpec{{Function: AggAvg, Field: "total"}})
+	if got["avg(total)"] != nil {
+		t.Errorf("Expected a nil average, got %v", got["avg(total)"])
+	}
+}
+
+func TestAggregateValidation(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	tests := []struct {
+		name string
+		q    *core.Query
+		aggs []AggregateSpec
+	}{
+		{"unknown function", nil, []AggregateSpec{{Function: "median", Field: "total"}}},
+		{"missing field", nil, []AggregateSpec{{Function: AggSum}}},
+		{"duplicate name", nil, []AggregateSpec{{Function: AggCount}, {Function: AggSum, Field: "total", Name: "count"}}},
+		{"other collection", &core.Query{Collection: "users"}, []AggregateSpec{{Function: AggCount}}},
+	}
+	for _, tt := range tests {
+		if _, err := executor.Aggregate("orders", tt.q, tt.aggs); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
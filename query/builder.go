@@ -0,0 +1,189 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// operatorSymbols maps the symbolic operators accepted by Builder to filter
+// operators. Operator names such as "gte" or "prefix" are accepted as well.
+var operatorSymbols = map[string]core.FilterOperator{
+	"=":      core.OpEqual,
+	"==":     core.OpEqual,
+	"!=":     core.OpNotEqual,
+	"<>":     core.OpNotEqual,
+	">":      core.OpGreaterThan,
+	"<":      core.OpLessThan,
+	">=":     core.OpGreaterThanOrEqual,
+	"<=":     core.OpLessThanOrEqual,
+	"not in": core.OpNotIn,
+}
+
+// ParseOperator resolves a symbolic or named filter operator such as ">=",
+// "gte" or "not in"
+func ParseOperator(op string) (core.FilterOperator, error) {
+	normalized := strings.ToLower(strings.Join(strings.Fields(op), " "))
+	if operator, ok := operatorSymbols[normalized]; ok {
+		return operator, nil
+	}
+
+	var operator core.FilterOperator
+	if err := operator.UnmarshalText([]byte(normalized)); err != nil {
+		return 0, err
+	}
+	return operator, nil
+}
+
+// Builder assembles a core.Query step by step. Errors are collected and
+// reported by Build, so calls can be chained freely.
+//
+// Where conditions are ANDed and OrWhere starts a new alternative, so
+// Where(a).Where(b).OrWhere(c) matches (a AND b) OR c. Queries without
+// OrWhere use plain Filters, which the planner can push down to indexes.
+type Builder struct {
+	q      core.Query
+	groups [][]core.Filter
+	err    error
+}
+
+// New starts a query on a collection
+func New(collection string) *Builder {
+	return &Builder{q: core.Query{Collection: collection}}
+}
+
+// Where adds a condition ANDed with the current alternative
+func (b *Builder) Where(field, op string, value interface{}) *Builder {
+	if len(b.groups) == 0 {
+		b.groups = append(b.groups, nil)
+	}
+	b.add(field, op, value)
+	return b
+}
+
+// OrWhere starts a new alternative with a condition
+func (b *Builder) OrWhere(field, op string, value interface{}) *Builder {
+	if len(b.groups) == 0 {
+		b.setErr(fmt.Errorf("missing Where before OrWhere on %s", field))
+		return b
+	}
+	b.groups = append(b.groups, nil)
+	b.add(field, op, value)
+	return b
+}
+
+// add appends a condition to the last alternative
+func (b *Builder) add(field, op string, value interface{}) {
+	operator, err := ParseOperator(op)
+	if err != nil {
+		b.setErr(fmt.Errorf("invalid condition on %s: %w", field, err))
+		return
+	}
+
+	last := len(b.groups) - 1
+	b.groups[last] = append(b.groups[last], core.Filter{Field: field, Operator: operator, Value: value})
+}
+
+// Sort adds an ascending sort key
+func (b *Builder) Sort(field string) *Builder {
+	if b.q.Sort == nil {
+		b.q.Sort = &core.SortOption{Field: field}
+	} else {
+		b.q.SortBy = append(b.q.SortBy, core.SortOption{Field: field})
+	}
+	return b
+}
+
+// Desc makes the most recently added sort key descending
+func (b *Builder) Desc() *Builder {
+	switch {
+	case len(b.q.SortBy) > 0:
+		b.q.SortBy[len(b.q.SortBy)-1].Descending = true
+	case b.q.Sort != nil:
+		b.q.Sort.Descending = true
+	default:
+		b.setErr(fmt.Errorf("missing sort key before Desc"))
+	}
+	return b
+}
+
+// Limit caps the number of results
+func (b *Builder) Limit(n int) *Builder {
+	b.q.Limit = n
+	return b
+}
+
+// Offset skips leading results
+func (b *Builder) Offset(n int) *Builder {
+	b.q.Offset = n
+	return b
+}
+
+// Project keeps only the given field paths in results
+func (b *Builder) Project(fields ...string) *Builder {
+	b.q.Projection = append(b.q.Projection, fields...)
+	return b
+}
+
+// Exclude drops the given field paths from results
+func (b *Builder) Exclude(fields ...string) *Builder {
+	b.q.Exclude = append(b.q.Exclude, fields...)
+	return b
+}
+
+// Build returns the query, or the first error recorded while building it or
+// found validating it
+func (b *Builder) Build() (core.Query, error) {
+	if b.err != nil {
+		return core.Query{}, b.err
+	}
+
+	q := b.q
+	q.SortBy = append([]core.SortOption(nil), b.q.SortBy...)
+	if b.q.Sort != nil {
+		sort := *b.q.Sort
+		q.Sort = &sort
+	}
+
+	switch len(b.groups) {
+	case 0:
+	case 1:
+		q.Filters = append([]core.Filter(nil), b.groups[0]...)
+	default:
+		alternatives := make([]core.FilterNode, len(b.groups))
+		for i, group := range b.groups {
+			alternatives[i] = conjunction(group)
+		}
+		where := core.Or(alternatives...)
+		q.Where = &where
+	}
+
+	if _, err := validateQuery(q); err != nil {
+		return core.Query{}, err
+	}
+	if _, err := compileProjection(q); err != nil {
+		return core.Query{}, err
+	}
+	return q, nil
+}
+
+// conjunction returns a node matching every filter
+func conjunction(filters []core.Filter) core.FilterNode {
+	if len(filters) == 1 {
+		return core.Leaf(filters[0])
+	}
+
+	leaves := make([]core.FilterNode, len(filters))
+	for i, f := range filters {
+		leaves[i] = core.Leaf(f)
+	}
+	return core.And(leaves...)
+}
+
+// setErr records the first error
+func (b *Builder) setErr(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,138 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestBuilderMatchesHandBuiltQueries(t *testing.T) {
+	adult := core.Filter{Field: "age", Operator: core.OpGreaterThan, Value: 18}
+	active := core.Filter{Field: "status", Operator: core.OpEqual, Value: "active"}
+	admin := core.Filter{Field: "role", Operator: core.OpIn, Value: []interface{}{"admin", "owner"}}
+
+	tests := []struct {
+		name     string
+		builder  *Builder
+		expected core.Query
+	}{
+		{
+			name:     "collection only",
+			builder:  New("users"),
+			expected: core.Query{Collection: "users"},
+		},
+		{
+			name:     "anded conditions",
+			builder:  New("users").Where("age", ">", 18).Where("status", "=", "active"),
+			expected: core.Query{Collection: "users", Filters: []core.Filter{adult, active}},
+		},
+		{
+			name:     "operator names",
+			builder:  New("users").Where("age", "gt", 18).Where("status", "eq", "active"),
+			expected: core.Query{Collection: "users", Filters: []core.Filter{adult, active}},
+		},
+		{
+			name:    "every symbol",
+			builder: New("users").Where("a", "==", 1).Where("b", "!=", 1).Where("c", "<>", 1).Where("d", "<", 1).Where("e", "<=", 1).Where("f", ">=", 1).Where("g", "NOT  IN", []interface{}{1}),
+			expected: core.Query{Collection: "users", Filters: []core.Filter{
+				{Field: "a", Operator: core.OpEqual, Value: 1},
+				{Field: "b", Operator: core.OpNotEqual, Value: 1},
+				{Field: "c", Operator: core.OpNotEqual, Value: 1},
+				{Field: "d", Operator: core.OpLessThan, Value: 1},
+				{Field: "e", Operator: core.OpLessThanOrEqual, Value: 1},
+				{Field: "f", Operator: core.OpGreaterThanOrEqual, Value: 1},
+				{Field: "g", Operator: core.OpNotIn, Value: []interface{}{1}},
+			}},
+		},
+		{
+			name:    "or where",
+			builder: New("users").Where("age", ">", 18).Where("status", "=", "active").OrWhere("role", "in", []interface{}{"admin", "owner"}),
+			expected: func() core.Query {
+				where := core.Or(core.And(core.Leaf(adult), core.Leaf(active)), core.Leaf(admin))
+				return core.Query{Collection: "users", Where: &where}
+			}(),
+		},
+		{
+			name:    "sort, window and projection",
+			builder: New("users").Where("age", ">", 18).Sort("name").Desc().Sort("age").Limit(10).Offset(20).Project("name", "email"),
+			expected: core.Query{
+				Collection: "users",
+				Filters:    []core.Filter{adult},
+				Sort:       &core.SortOption{Field: "name", Descending: true},
+				SortBy:     []core.SortOption{{Field: "age"}},
+				Limit:      10,
+				Offset:     20,
+				Projection: []string{"name", "email"},
+			},
+		},
+		{
+			name:     "exclude",
+			builder:  New("users").Exclude("password"),
+			expected: core.Query{Collection: "users", Exclude: []string{"password"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := tt.builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to build query: %v", err)
+			}
+			if !reflect.DeepEqual(q, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, q)
+			}
+		})
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+	}{
+		{"unknown operator", New("users").Where("age", "~", 18)},
+		{"or without where", New("users").OrWhere("age", ">", 18)},
+		{"desc without sort", New("users").Desc()},
+		{"missing collection", New("").Where("age", ">", 18)},
+		{"negative limit", New("users").Limit(-1)},
+		{"invalid in value", New("users").Where("role", "in", "admin")},
+		{"invalid regex", New("users").Where("name", "regex", "(")},
+		{"projection with exclude", New("users").Project("name").Exclude("email")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.builder.Build(); err == nil {
+				t.Errorf("Expected error")
+			}
+		})
+	}
+}
+
+func TestBuilderExecutes(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	built, err := New("people").Where("age", ">=", 30).OrWhere("city", "=", "Paris").Sort("age").Desc().Build()
+	if err != nil {
+		t.Fatalf("Failed to build query: %v", err)
+	}
+
+	where := core.Or(
+		core.Leaf(core.Filter{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: 30}),
+		core.Leaf(core.Filter{Field: "city", Operator: core.OpEqual, Value: "Paris"}),
+	)
+	expected, err := executor.Execute(core.Query{Collection: "people", Where: &where, Sort: &core.SortOption{Field: "age", Descending: true}})
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+
+	docs, err := executor.Execute(built)
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	if len(docs) == 0 || !reflect.DeepEqual(docs, expected) {
+		t.Errorf("Expected %v, got %v", expected, docs)
+	}
+}
@@ -0,0 +1,155 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrIncomparable is returned when two values have no defined order, such as
+// a number and a string. Filters treat it as a non-match rather than failing
+// the query.
+var ErrIncomparable = errors.New("values are not comparable")
+
+// Type classes in ascending sort order, used to order mixed-type sort keys
+const (
+	classMissing = iota
+	classNull
+	classBool
+	classNumber
+	classTime // Strings holding RFC3339 timestamps
+	classString
+	classOther
+)
+
+// classOf returns the type class of a value
+func classOf(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return classNull
+	case bool:
+		return classBool
+	case string:
+		if _, ok := parseTimestamp(v); ok {
+			return classTime
+		}
+		return classString
+	}
+	if _, ok := core.ToFloat64(value); ok {
+		return classNumber
+	}
+	return classOther
+}
+
+// parseTimestamp parses an RFC3339 string, cheaply rejecting strings that
+// cannot be one
+func parseTimestamp(s string) (time.Time, bool) {
+	if len(s) < len("2006-01-02T15:04:05Z") || s[4] != '-' {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
+
+// compareValues orders two values of the same kind: numbers numerically
+// across all Go numeric types and json.Number, strings lexicographically by
+// byte unless both are RFC3339 timestamps, which compare as instants, and
+// false before true. Any other combination is ErrIncomparable.
+func compareValues(a, b interface{}) (int, error) {
+	if fa, ok := core.ToFloat64(a); ok {
+		fb, ok := core.ToFloat64(b)
+		if !ok {
+			return 0, ErrIncomparable
+		}
+		switch {
+		case fa < fb:
+			return -1, nil
+		case fa > fb:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	switch va := a.(type) {
+	case string:
+		if vb, ok := b.(string); ok {
+			if ta, ok := parseTimestamp(va); ok {
+				if tb, ok := parseTimestamp(vb); ok {
+					return ta.Compare(tb), nil
+				}
+			}
+			return strings.Compare(va, vb), nil
+		}
+	case bool:
+		if vb, ok := b.(bool); ok {
+			switch {
+			case va == vb:
+				return 0, nil
+			case !va:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+	return 0, ErrIncomparable
+}
+
+// ValuesEqual reports whether two values are equal as filters compare them:
+// numbers numerically across Go types, RFC3339 timestamps as instants and
+// other values only within their own type, so 1 never equals "1". Nulls
+// equal only nulls; arrays and objects are equal when their JSON encodings
+// are.
+func ValuesEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if cmp, err := compareValues(a, b); err == nil {
+		return cmp == 0
+	}
+	if classOf(a) != classOther || classOf(b) != classOther {
+		return false
+	}
+
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(dataA) == string(dataB)
+}
+
+// compareForSort totally orders field values for sorting. Values of different
+// type classes order missing < null < bool < number < timestamp < string <
+// other, timestamps order as instants, and values of class other order by
+// JSON encoding.
+func compareForSort(a interface{}, aFound bool, b interface{}, bFound bool) int {
+	classA, classB := classMissing, classMissing
+	if aFound {
+		classA = classOf(a)
+	}
+	if bFound {
+		classB = classOf(b)
+	}
+	if classA != classB {
+		if classA < classB {
+			return -1
+		}
+		return 1
+	}
+
+	switch classA {
+	case classMissing, classNull:
+		return 0
+	case classOther:
+		dataA, _ := json.Marshal(a)
+		dataB, _ := json.Marshal(b)
+		return strings.Compare(string(dataA), string(dataB))
+	}
+
+	cmp, _ := compareValues(a, b)
+	return cmp
+}
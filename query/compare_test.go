@@ -0,0 +1,91 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     interface{}
+		expected int
+		err      error
+	}{
+		{"int vs float64", 2, 2.0, 0, nil},
+		{"int64 vs float64", int64(3), 2.5, 1, nil},
+		{"json.Number vs int", json.Number("10"), 11, -1, nil},
+		{"uint8 vs float32", uint8(7), float32(7), 0, nil},
+		{"strings", "apple", "banana", -1, nil},
+		{"strings are byte-wise", "Zebra", "apple", -1, nil},
+		{"bools", false, true, -1, nil},
+		{"equal bools", true, true, 0, nil},
+		{"number vs string", 1, "1", 0, ErrIncomparable},
+		{"string vs number", "1", 1, 0, ErrIncomparable},
+		{"bool vs number", true, 1, 0, ErrIncomparable},
+		{"null", nil, nil, 0, ErrIncomparable},
+		{"arrays", []interface{}{1}, []interface{}{1}, 0, ErrIncomparable},
+		{"timestamps with offsets", "2024-01-01T10:00:00+02:00", "2024-01-01T09:00:00Z", -1, nil},
+		{"equal instants", "2024-01-01T11:00:00+02:00", "2024-01-01T09:00:00.000Z", 0, nil},
+		{"invalid timestamp is a string", "2024-01-01T25:00:00Z", "2024-01-01T09:00:00Z", 1, nil},
+		{"timestamp vs unix seconds", "2024-01-01T09:00:00Z", 1704099600, 0, ErrIncomparable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmp, err := compareValues(tt.a, tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error %v, got %v", tt.err, err)
+			}
+			if err == nil && cmp != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, cmp)
+			}
+		})
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     interface{}
+		expected bool
+	}{
+		{"int vs float64", 25, 25.0, true},
+		{"json.Number", json.Number("1.5"), 1.5, true},
+		{"strings", "a", "a", true},
+		{"different strings", "a", "A", false},
+		{"number vs string", 1, "1", false},
+		{"null vs null", nil, nil, true},
+		{"null vs value", nil, 0, false},
+		{"arrays", []interface{}{"a", 1.0}, []interface{}{"a", 1}, true},
+		{"different arrays", []interface{}{"a"}, []interface{}{"b"}, false},
+		{"objects", map[string]interface{}{"k": 1}, map[string]interface{}{"k": 1.0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValuesEqual(tt.a, tt.b); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompareForSortOrdersTypeClasses(t *testing.T) {
+	ordered := []interface{}{
+		nil, false, true, -1, 2.5,
+		"2024-01-01T10:00:00+02:00", "2024-01-01T09:00:00Z",
+		"a", "b", []interface{}{1},
+	}
+
+	// A missing value sorts before everything
+	if cmp := compareForSort(nil, false, nil, true); cmp != -1 {
+		t.Errorf("Expected missing before null, got %d", cmp)
+	}
+	for i := 0; i < len(ordered)-1; i++ {
+		if cmp := compareForSort(ordered[i], true, ordered[i+1], true); cmp != -1 {
+			t.Errorf("Expected %v before %v, got %d", ordered[i], ordered[i+1], cmp)
+		}
+	}
+}
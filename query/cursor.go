@@ -0,0 +1,168 @@
+package query
+
+import (
+	"errors"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Cursor iterates over query results one document at a time. A cursor must
+// be closed when iteration stops early; reaching the end closes it
+// implicitly, and Close is always safe to call.
+type Cursor struct {
+	proj *projection
+	cur  result
+	err  error
+
+	// Buffered results, used when the query is sorted
+	buffered []result
+	pos      int
+
+	// Externally sorted results, used when a sorted query exceeds the
+	// executor's sort budget
+	spilled *spillStream
+
+	// Streamed results, produced by a scan running in its own goroutine
+	items   chan result
+	done    chan struct{}
+	scanErr error // Set by the scan goroutine before items is closed
+	closed  bool
+}
+
+// ExecuteIter runs a query and returns a cursor over its results. Unsorted
+// queries stream: documents are filtered as the cursor advances, in scan
+// order rather than ID order, and Offset skips matches without keeping them.
+// Sorted queries collect and sort every match before the first result,
+// spilling to disk beyond the sort budget (see SetSortBudget).
+func (e *Executor) ExecuteIter(q core.Query) (*Cursor, error) {
+	proj, err := compileProjection(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sortKeys(q)) > 0 {
+		if e.sortBudget > 0 {
+			results, spilled, err := e.sortIter(q)
+			if err != nil {
+				return nil, err
+			}
+			return &Cursor{proj: proj, buffered: results, spilled: spilled, closed: spilled == nil}, nil
+		}
+		results, err := e.run(q)
+		if err != nil {
+			return nil, err
+		}
+		return &Cursor{proj: proj, buffered: results, closed: true}, nil
+	}
+
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cursor{
+		proj:  proj,
+		items: make(chan result),
+		done:  make(chan struct{}),
+	}
+	go c.stream(e, q, compiled)
+	return c, nil
+}
+
+// stream feeds matching documents to the cursor until the scan ends, the
+// limit is reached or the cursor is closed
+func (c *Cursor) stream(e *Executor, q core.Query, compiled *compiledQuery) {
+	defer close(c.items)
+
+	skipped, sent := 0, 0
+	c.scanErr = e.scanMatches(q.Collection, compiled, func(docID core.DocumentID, doc core.Document) bool {
+		if skipped < q.Offset {
+			skipped++
+			return true
+		}
+
+		select {
+		case c.items <- result{id: docID, doc: doc}:
+		case <-c.done:
+			return false
+		}
+		sent++
+		return q.Limit == 0 || sent < q.Limit
+	})
+}
+
+// Next advances the cursor, reporting false when there are no more results
+// or an error occurred
+func (c *Cursor) Next() bool {
+	if c.spilled != nil {
+		if c.closed {
+			return false
+		}
+		r, ok, err := c.spilled.next()
+		if !ok {
+			c.err = errors.Join(err, c.spilled.sorter.close())
+			c.closed = true
+			return false
+		}
+		c.setCurrent(r)
+		return true
+	}
+	if c.items == nil {
+		if c.pos >= len(c.buffered) {
+			return false
+		}
+		c.setCurrent(c.buffered[c.pos])
+		c.pos++
+		return true
+	}
+
+	if c.closed {
+		return false
+	}
+	r, ok := <-c.items
+	if !ok {
+		c.err = c.scanErr
+		c.closed = true
+		return false
+	}
+	c.setCurrent(r)
+	return true
+}
+
+// setCurrent makes r the current result, applying the projection
+func (c *Cursor) setCurrent(r result) {
+	if c.proj != nil {
+		r.doc = c.proj.apply(r.id, r.doc)
+	}
+	c.cur = r
+}
+
+// Doc returns the current document and its ID
+func (c *Cursor) Doc() (core.DocumentID, core.Document) {
+	return c.cur.id, c.cur.doc
+}
+
+// Err returns the error that ended iteration, if any
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close stops iteration, waits for the underlying scan to finish, which
+// releases any storage locks it holds, and removes the run files of an
+// external sort
+func (c *Cursor) Close() error {
+	c.buffered = nil
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if c.spilled != nil {
+		return c.spilled.sorter.close()
+	}
+
+	close(c.done)
+	for range c.items {
+		// Drain until the scan goroutine exits
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func collect(t *testing.T, cursor *Cursor) []string {
+	var got []string
+	for cursor.Next() {
+		docID, doc := cursor.Doc()
+		if doc["id"] != nil && doc["id"] != string(docID) {
+			t.Errorf("Expected document %s, got %v", docID, doc)
+		}
+		got = append(got, string(docID))
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatalf("Cursor failed: %v", err)
+	}
+	return got
+}
+
+func TestCursorMatchesExecute(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	queries := []core.Query{
+		{Filters: []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}}},
+		{Sort: &core.SortOption{Field: "name", Descending: true}, Offset: 1, Limit: 3},
+		{Projection: []string{"name"}, Sort: &core.SortOption{Field: "age"}},
+	}
+
+	for i, q := range queries {
+		q.Collection = "people"
+		docs, err := executor.Execute(q)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		cursor, err := executor.ExecuteIter(q)
+		if err != nil {
+			t.Fatalf("ExecuteIter failed: %v", err)
+		}
+		got := collect(t, cursor)
+		cursor.Close()
+
+		expected := ids(docs)
+		if q.Sort == nil {
+			// Unsorted cursors stream in scan order
+			sort.Strings(got)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("Query %d: expected %v, got %v", i, expected, got)
+		}
+	}
+}
+
+func TestCursorStreamingOffsetAndLimit(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	cursor, err := executor.ExecuteIter(core.Query{Collection: "people", Offset: 2, Limit: 3})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	defer cursor.Close()
+
+	if got := collect(t, cursor); len(got) != 3 {
+		t.Errorf("Expected 3 results, got %v", got)
+	}
+
+	cursor, _ = executor.ExecuteIter(core.Query{Collection: "people", Offset: 10})
+	if got := collect(t, cursor); len(got) != 0 {
+		t.Errorf("Expected no results past the end, got %v", got)
+	}
+}
+
+func TestCursorCloseEarly(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	for i := 0; i < 100; i++ {
+		engine.WriteDocument("rows", core.DocumentID(fmt.Sprintf("r%03d", i)), core.Document{"n": i})
+	}
+
+	before := runtime.NumGoroutine()
+	cursor, err := executor.ExecuteIter(core.Query{Collection: "rows"})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if !cursor.Next() {
+			t.Fatalf("Expected result %d, cursor ended: %v", i, cursor.Err())
+		}
+	}
+	if err := cursor.Close(); err != nil {
+		t.Fatalf("Failed to close cursor: %v", err)
+	}
+	if cursor.Next() {
+		t.Errorf("Expected no results after Close")
+	}
+	cursor.Close()
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected the scan goroutine to exit, goroutines went from %d to %d", before, after)
+	}
+
+	// The scan's read lock must be released, so a write can proceed
+	written := make(chan error, 1)
+	go func() {
+		written <- engine.WriteDocument("rows", "r999", core.Document{"n": 999})
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write blocked after closing the cursor")
+	}
+}
+
+func TestOpenCursorDoesNotBlockWrites(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	for i := 0; i < 10; i++ {
+		engine.WriteDocument("rows", core.DocumentID(fmt.Sprintf("r%03d", i)), core.Document{"n": i})
+	}
+
+	cursor, err := executor.ExecuteIter(core.Query{Collection: "rows"})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	defer cursor.Close()
+	if !cursor.Next() {
+		t.Fatalf("Expected a result, cursor ended: %v", cursor.Err())
+	}
+
+	// The scan waits on the unread cursor, which must not hold up writes
+	written := make(chan error, 1)
+	go func() {
+		written <- engine.WriteDocument("rows", "r999", core.Document{"n": 999})
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write blocked by an open cursor")
+	}
+	if got := collect(t, cursor); len(got) != 9 {
+		t.Errorf("Expected the rest of the scan, 9 results, got %v", got)
+	}
+}
+
+// failingEngine fails every collection scan
+type failingEngine struct {
+	core.StorageEngine
+}
+
+func (failingEngine) ScanCollection(string, func(core.DocumentID, core.Document) bool) error {
+	return errors.New("disk on fire")
+}
+
+func TestCursorErrors(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+
+	if _, err := executor.ExecuteIter(core.Query{}); err == nil {
+		t.Errorf("Expected error for a query without a collection")
+	}
+
+	cursor, err := NewExecutor(failingEngine{engine}, nil).ExecuteIter(core.Query{Collection: "rows"})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	defer cursor.Close()
+	if cursor.Next() {
+		t.Errorf("Expected no results from a failed scan")
+	}
+	if cursor.Err() == nil {
+		t.Errorf("Expected the scan error to be reported")
+	}
+}
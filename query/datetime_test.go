@@ -0,0 +1,172 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// seedEvents writes events at 09:00Z, written with several offsets and as
+// unix seconds, plus an event with an invalid timestamp
+func seedEvents(t *testing.T, engine core.StorageEngine) {
+	events := []core.Document{
+		{"id": "e1", "at": "2024-01-01T10:00:00+02:00"}, // 08:00Z
+		{"id": "e2", "at": "2024-01-01T09:00:00Z"},      // 09:00Z
+		{"id": "e3", "at": "2024-01-01T10:30:00+01:00"}, // 09:30Z
+		{"id": "e4", "at": 1704103200},                  // 10:00Z as unix seconds
+		{"id": "e5", "at": "2024-01-01T11:00:00+02:00"}, // 09:00Z
+		{"id": "e6", "at": "not a date"},
+	}
+	for _, doc := range events {
+		if err := engine.WriteDocument("events", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestDateTimeFilters(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedEvents(t, engine)
+
+	nine := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		filter   core.Filter
+		expected []string
+	}{
+		{
+			name:   "mixed offsets compare as instants",
+			filter: core.Filter{Field: "at", Operator: core.OpGreaterThan, Value: "2024-01-01T09:00:00Z"},
+			// e6 is not a timestamp, so it compares as a string
+			expected: []string{"e3", "e6"},
+		},
+		{
+			name:     "equal instants",
+			filter:   core.Filter{Field: "at", Operator: core.OpEqual, Value: "2024-01-01T12:00:00+03:00"},
+			expected: []string{"e2", "e5"},
+		},
+		{
+			name:     "time value",
+			filter:   core.Filter{Field: "at", Operator: core.OpLessThan, Value: nine},
+			expected: []string{"e1"},
+		},
+		{
+			name:     "invalid filter value falls back to string order",
+			filter:   core.Filter{Field: "at", Operator: core.OpGreaterThanOrEqual, Value: "2024-01-01T10"},
+			expected: []string{"e1", "e3", "e5", "e6"},
+		},
+		{
+			name:     "hint compares strings and unix seconds",
+			filter:   core.Filter{Field: "at", Operator: core.OpGreaterThan, Value: "2024-01-01T09:00:00Z", ValueType: core.ValueDateTime},
+			expected: []string{"e3", "e4"},
+		},
+		{
+			name:     "hint with unix seconds value",
+			filter:   core.Filter{Field: "at", Operator: core.OpLessThanOrEqual, Value: float64(nine.Unix()), ValueType: core.ValueDateTime},
+			expected: []string{"e1", "e2", "e5"},
+		},
+		{
+			name:     "hint membership",
+			filter:   core.Filter{Field: "at", Operator: core.OpIn, Value: []interface{}{nine, "2024-01-01T10:00:00Z"}, ValueType: core.ValueDateTime},
+			expected: []string{"e2", "e4", "e5"},
+		},
+		{
+			name:     "hint negation matches invalid values",
+			filter:   core.Filter{Field: "at", Operator: core.OpNotEqual, Value: nine, ValueType: core.ValueDateTime},
+			expected: []string{"e1", "e3", "e4", "e6"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := executor.Execute(core.Query{Collection: "events", Filters: []core.Filter{tt.filter}})
+			if err != nil {
+				t.Fatalf("Failed to execute query: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDateTimeSort(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedEvents(t, engine)
+
+	docs, err := executor.Execute(core.Query{Collection: "events", Sort: &core.SortOption{Field: "at"}})
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+
+	// Numbers sort before timestamps, timestamps by instant with ties by ID,
+	// then other strings
+	expected := []string{"e4", "e1", "e2", "e5", "e3", "e6"}
+	if got := ids(docs); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDateTimeFilterValidation(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedEvents(t, engine)
+
+	invalid := []core.Filter{
+		{Field: "at", Operator: core.OpGreaterThan, Value: "tomorrow", ValueType: core.ValueDateTime},
+		{Field: "at", Operator: core.OpIn, Value: []interface{}{"2024-01-01T09:00:00Z", true}, ValueType: core.ValueDateTime},
+		{Field: "at", Operator: core.OpHasPrefix, Value: "2024", ValueType: core.ValueDateTime},
+		{Field: "at", Operator: core.OpEqual, Value: "2024-01-01T09:00:00Z", ValueType: core.ValueType(9)},
+	}
+	for _, f := range invalid {
+		if _, err := executor.Execute(core.Query{Collection: "events", Filters: []core.Filter{f}}); err == nil {
+			t.Errorf("Expected error for %+v", f)
+		}
+	}
+}
+
+func TestDateTimeIndexPushdown(t *testing.T) {
+	scan, engine := setupTestExecutor(t)
+	seedEvents(t, engine)
+
+	manager, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := manager.CreateSecondaryIndex("events", "at", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	indexed := NewExecutor(engine, manager)
+
+	queries := []core.Query{
+		{Collection: "events", Filters: []core.Filter{{Field: "at", Operator: core.OpEqual, Value: "2024-01-01T09:00:00Z"}}},
+		{Collection: "events", Filters: []core.Filter{{Field: "at", Operator: core.OpIn, Value: []interface{}{"2024-01-01T08:00:00Z"}}}},
+		{Collection: "events", Filters: []core.Filter{{Field: "at", Operator: core.OpEqual, Value: 1704103200.0, ValueType: core.ValueDateTime}}},
+	}
+	for _, q := range queries {
+		plan, err := indexed.Plan(q)
+		if err != nil {
+			t.Fatalf("Failed to plan query: %v", err)
+		}
+		if plan.Access != AccessScan {
+			t.Errorf("Expected a scan for %+v, got %s", q.Filters, plan.Access)
+		}
+
+		expected, _ := scan.Execute(q)
+		got, err := indexed.Execute(q)
+		if err != nil {
+			t.Fatalf("Failed to execute query: %v", err)
+		}
+		if !reflect.DeepEqual(ids(got), ids(expected)) || len(got) == 0 {
+			t.Errorf("Expected %v, got %v", ids(expected), ids(got))
+		}
+	}
+
+	// Plain strings are still looked up through the index
+	plan, _ := indexed.Plan(core.Query{Collection: "events", Filters: []core.Filter{{Field: "at", Operator: core.OpEqual, Value: "not a date"}}})
+	if plan.Access != AccessHash {
+		t.Errorf("Expected a hash lookup, got %s", plan.Access)
+	}
+}
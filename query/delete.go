@@ -0,0 +1,78 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+var (
+	// ErrUnfilteredDelete is returned when a delete has no filters and
+	// DeleteOptions.AllowUnfiltered is not set
+	ErrUnfilteredDelete = errors.New("delete without filters")
+
+	// ErrDeleteLimitExceeded is returned when more documents match a delete
+	// than DeleteOptions.MaxDocuments allows
+	ErrDeleteLimitExceeded = errors.New("delete limit exceeded")
+)
+
+// DeleteOptions control DeleteManyWithOptions
+type DeleteOptions struct {
+	// AllowUnfiltered permits a query without filters, which deletes every
+	// document in the collection (within Offset and Limit)
+	AllowUnfiltered bool
+
+	// MaxDocuments caps how many documents one call may delete; 0 means no
+	// cap. When more match, the call fails with ErrDeleteLimitExceeded and
+	// deletes nothing, unless Truncate is set.
+	MaxDocuments int
+
+	// Truncate deletes the first MaxDocuments matches in sort order instead
+	// of failing when more match
+	Truncate bool
+}
+
+// DeleteMany deletes every document matching the query with default options
+func (e *Executor) DeleteMany(q core.Query) (int, error) {
+	return e.DeleteManyWithOptions(q, DeleteOptions{})
+}
+
+// DeleteManyWithOptions deletes the documents matching a query and returns how
+// many were removed. Matches are taken in the query's sort order, so Sort,
+// Offset and Limit select which documents are eligible. The query is evaluated
+// and the deletes applied as one batch while the collection is locked.
+func (e *Executor) DeleteManyWithOptions(q core.Query, opts DeleteOptions) (int, error) {
+	if opts.MaxDocuments < 0 {
+		return 0, fmt.Errorf("invalid delete cap: %d", opts.MaxDocuments)
+	}
+	if len(q.Filters) == 0 && q.Where == nil && !opts.AllowUnfiltered {
+		return 0, fmt.Errorf("%w on %s: set AllowUnfiltered to delete every document", ErrUnfilteredDelete, q.Collection)
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	err = e.applyBatch(q.Collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		matches := selectMatches(q, compiled, docs)
+		if opts.MaxDocuments > 0 && len(matches) > opts.MaxDocuments {
+			if !opts.Truncate {
+				return nil, fmt.Errorf("%w: %d documents match, at most %d may be deleted", ErrDeleteLimitExceeded, len(matches), opts.MaxDocuments)
+			}
+			matches = matches[:opts.MaxDocuments]
+		}
+
+		writes := make(map[core.DocumentID]core.Document, len(matches))
+		for _, r := range matches {
+			writes[r.id] = nil
+		}
+		deleted = len(writes)
+		return writes, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
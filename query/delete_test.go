@@ -0,0 +1,132 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestDeleteMany(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	revision, _ := engine.CollectionRevision("people")
+
+	deleted, err := executor.DeleteMany(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "age", Operator: core.OpLessThanOrEqual, Value: 30}},
+	})
+	if err != nil {
+		t.Fatalf("DeleteMany failed: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 documents deleted, got %d", deleted)
+	}
+
+	docs, _ := executor.Execute(core.Query{Collection: "people"})
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p3", "p4", "p5"}) {
+		t.Errorf("Expected [p3 p4 p5] to remain, got %v", got)
+	}
+	if count, _ := engine.CountDocuments("people"); count != 3 {
+		t.Errorf("Expected 3 documents counted, got %d", count)
+	}
+	// A single rewrite of the collection file
+	if after, _ := engine.CollectionRevision("people"); after != revision+1 {
+		t.Errorf("Expected revision %d, got %d", revision+1, after)
+	}
+
+	deleted, _ = executor.DeleteMany(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "Nobody"}},
+	})
+	if deleted != 0 {
+		t.Errorf("Expected nothing deleted, got %d", deleted)
+	}
+}
+
+func TestDeleteManyRequiresFilters(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	if _, err := executor.DeleteMany(core.Query{Collection: "people"}); !errors.Is(err, ErrUnfilteredDelete) {
+		t.Fatalf("Expected ErrUnfilteredDelete, got %v", err)
+	}
+	if count, _ := engine.CountDocuments("people"); count != 6 {
+		t.Errorf("Expected nothing deleted, got %d remaining", count)
+	}
+
+	deleted, err := executor.DeleteManyWithOptions(core.Query{Collection: "people"}, DeleteOptions{AllowUnfiltered: true})
+	if err != nil {
+		t.Fatalf("DeleteManyWithOptions failed: %v", err)
+	}
+	if deleted != 6 {
+		t.Errorf("Expected 6 documents deleted, got %d", deleted)
+	}
+}
+
+func TestDeleteManyMaxDocuments(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	active := core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}},
+		Sort:       &core.SortOption{Field: "name"},
+	}
+
+	_, err := executor.DeleteManyWithOptions(active, DeleteOptions{MaxDocuments: 2})
+	if !errors.Is(err, ErrDeleteLimitExceeded) {
+		t.Fatalf("Expected ErrDeleteLimitExceeded, got %v", err)
+	}
+	if count, _ := engine.CountDocuments("people"); count != 6 {
+		t.Errorf("Expected nothing deleted, got %d remaining", count)
+	}
+
+	// Truncating deletes the first matches in sort order
+	deleted, err := executor.DeleteManyWithOptions(active, DeleteOptions{MaxDocuments: 2, Truncate: true})
+	if err != nil {
+		t.Fatalf("DeleteManyWithOptions failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 documents deleted, got %d", deleted)
+	}
+	docs, _ := executor.Execute(active)
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p6"}) {
+		t.Errorf("Expected only p6 to remain active, got %v", got)
+	}
+
+	// Exactly at the cap is allowed
+	if deleted, err := executor.DeleteManyWithOptions(active, DeleteOptions{MaxDocuments: 1}); err != nil || deleted != 1 {
+		t.Errorf("Expected 1 document deleted, got %d (%v)", deleted, err)
+	}
+}
+
+func TestDeleteManyUpdatesIndexes(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+
+	deleted, err := executor.DeleteMany(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Paris", "Rome"}}},
+	})
+	if err != nil {
+		t.Fatalf("DeleteMany failed: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 documents deleted, got %d", deleted)
+	}
+
+	if ids, _ := manager.LookupSecondaryIDs("people", "city", "Paris"); len(ids) != 0 {
+		t.Errorf("Expected no documents indexed under Paris, got %v", ids)
+	}
+	infos, _ := manager.ListIndexes("people")
+	if infos[0].Stale || infos[0].DocumentCount != 3 {
+		t.Errorf("Expected a fresh index over 3 documents, got %+v", infos[0])
+	}
+	if _, err := manager.LookupPrimary("people", "p2"); err == nil {
+		t.Errorf("Expected deleted document to leave the primary index")
+	}
+	if count, _ := engine.CountDocuments("people"); count != 3 {
+		t.Errorf("Expected 3 documents in storage, got %d", count)
+	}
+}
@@ -0,0 +1,301 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Executor evaluates core.Query values against a storage engine
+type Executor struct {
+	storage core.StorageEngine
+	indexes core.IndexManager // Optional; nil means every query scans
+	tracer  trace.Tracer      // Set by SetTracerProvider; nil traces nothing
+
+	sortBudget int64  // Set by SetSortBudget; 0 sorts in memory
+	spillDir   string // Where external sorts spill their runs
+}
+
+// result is a matching document together with its ID
+type result struct {
+	id  core.DocumentID
+	doc core.Document
+}
+
+// NewExecutor creates a query executor. The index manager is optional and
+// may be nil.
+func NewExecutor(storage core.StorageEngine, indexes core.IndexManager) *Executor {
+	return &Executor{
+		storage: storage,
+		indexes: indexes,
+	}
+}
+
+// Execute runs a query: documents matching every filter are collected from
+// the access path chosen by the planner, sorted, and then windowed by Offset
+// and Limit. Without a sort, results are ordered by document ID. A Limit of 0
+// means no limit.
+//
+// Filters never fail on data: a document whose field is missing or holds a
+// value that cannot be compared with the filter value (a string against a
+// number, say) simply does not match.
+//
+// With Projection or Exclude set, each result is a reshaped copy carrying the
+// document ID under IDField.
+func (e *Executor) Execute(q core.Query) ([]core.Document, error) {
+	return e.ExecuteContext(context.Background(), q)
+}
+
+// ExecuteContext is Execute, traced as a child of the span in ctx once
+// SetTracerProvider is called. The storage reads of the query are traced as
+// its children when the storage engine supports it.
+func (e *Executor) ExecuteContext(ctx context.Context, q core.Query) (_ []core.Document, err error) {
+	proj, err := compileProjection(q)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	p := e.plan(q.Collection, compiled)
+
+	var span trace.Span
+	if e.tracer != nil {
+		ctx, span = e.startSpan(ctx, q.Collection, p)
+		defer func() { core.EndSpan(span, err) }()
+	}
+	results, err := e.runPlan(ctx, q, compiled, p)
+	if err != nil {
+		return nil, err
+	}
+	if span != nil {
+		recordPlan(span, p, len(results))
+	}
+
+	return documents(results, proj), nil
+}
+
+// documents returns the documents of results, projected if proj is set
+func documents(results []result, proj *projection) []core.Document {
+	docs := make([]core.Document, len(results))
+	for i, r := range results {
+		if proj != nil {
+			docs[i] = proj.apply(r.id, r.doc)
+		} else {
+			docs[i] = r.doc
+		}
+	}
+	return docs
+}
+
+// run executes a query and returns the windowed results with their IDs
+func (e *Executor) run(q core.Query) ([]result, error) {
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return e.runPlan(context.Background(), q, compiled, e.plan(q.Collection, compiled))
+}
+
+// runPlan executes a query through a plan and returns the windowed results
+func (e *Executor) runPlan(ctx context.Context, q core.Query, compiled *compiledQuery, p *Plan) ([]result, error) {
+	var results []result
+	err := e.scanPlanned(ctx, q.Collection, p, func(docID core.DocumentID, doc core.Document) bool {
+		if compiled.match(docID, doc) {
+			results = append(results, result{id: docID, doc: doc})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sortResults(results, sortKeys(q))
+	return window(results, q.Offset, q.Limit), nil
+}
+
+// ExecuteOne returns a single document matching the query. Without a sort the
+// scan stops at the first match, so any matching document may be returned;
+// with a sort the first document in sort order is returned without sorting
+// the rest. Offset and Limit are ignored. It returns core.ErrDocumentNotFound
+// when nothing matches.
+func (e *Executor) ExecuteOne(q core.Query) (core.DocumentID, core.Document, error) {
+	proj, err := compileProjection(q)
+	if err != nil {
+		return "", nil, err
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	keys := sortKeys(q)
+	var best *result
+	err = e.scanMatches(q.Collection, compiled, func(docID core.DocumentID, doc core.Document) bool {
+		candidate := result{id: docID, doc: doc}
+		if best == nil || lessResult(candidate, *best, keys) {
+			best = &candidate
+		}
+		return len(keys) > 0
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if best == nil {
+		return "", nil, fmt.Errorf("no match in collection %s: %w", q.Collection, core.ErrDocumentNotFound)
+	}
+
+	if proj != nil {
+		return best.id, proj.apply(best.id, best.doc), nil
+	}
+	return best.id, best.doc, nil
+}
+
+// ExecuteCount returns the number of documents matching the query's filters.
+// Sorting, Offset and Limit do not apply.
+func (e *Executor) ExecuteCount(q core.Query) (int, error) {
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = e.scanMatches(q.Collection, compiled, func(core.DocumentID, core.Document) bool {
+		count++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// scanMatches calls fn for every document matching the compiled query until
+// fn returns false, reading candidates through the planned access path
+func (e *Executor) scanMatches(collection string, compiled *compiledQuery, fn func(core.DocumentID, core.Document) bool) error {
+	return e.scanPlanned(context.Background(), collection, e.plan(collection, compiled), func(docID core.DocumentID, doc core.Document) bool {
+		if !compiled.match(docID, doc) {
+			return true
+		}
+		return fn(docID, doc)
+	})
+}
+
+// compiledQuery holds the compiled filters of a query
+type compiledQuery struct {
+	filters []*compiledFilter // Flat filters, also used for index pushdown
+	where   *compiledNode     // Optional filter tree
+	read    core.ReadOptions  // How candidates are read from storage
+}
+
+// match reports whether a document satisfies the flat filters and the tree
+func (c *compiledQuery) match(docID core.DocumentID, doc core.Document) bool {
+	if !matchesAll(docID, doc, c.filters) {
+		return false
+	}
+	return c.where == nil || c.where.match(docID, doc)
+}
+
+// validateQuery rejects queries that cannot be executed and compiles their filters
+func validateQuery(q core.Query) (*compiledQuery, error) {
+	return validateQueryWith(q, compileFilter)
+}
+
+// validateQueryWith is validateQuery, compiling filters with compile
+func validateQueryWith(q core.Query, compile func(core.Filter) (*compiledFilter, error)) (*compiledQuery, error) {
+	if q.Collection == "" {
+		return nil, fmt.Errorf("missing collection - unable to execute query")
+	}
+	if q.Limit < 0 {
+		return nil, fmt.Errorf("invalid limit: %d", q.Limit)
+	}
+	if q.Offset < 0 {
+		return nil, fmt.Errorf("invalid offset: %d", q.Offset)
+	}
+	for _, key := range sortKeys(q) {
+		if key.Field == "" {
+			return nil, fmt.Errorf("missing field in sort key")
+		}
+	}
+
+	filters, err := compileFilters(q.Filters, compile)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &compiledQuery{filters: filters, read: q.Read}
+
+	if q.Where != nil {
+		if compiled.where, err = compileNodeWith(*q.Where, compile); err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// sortKeys returns the sort keys of a query: Sort, if set, followed by SortBy
+func sortKeys(q core.Query) []core.SortOption {
+	if q.Sort == nil {
+		return q.SortBy
+	}
+	return append([]core.SortOption{*q.Sort}, q.SortBy...)
+}
+
+// sortResults orders results by each sort key in turn, breaking remaining
+// ties by document ID so the order is fully deterministic. Without sort keys
+// results are ordered by document ID alone.
+func sortResults(results []result, keys []core.SortOption) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return lessResult(results[i], results[j], keys)
+	})
+}
+
+// lessResult reports whether a sorts before b by the sort keys, then by ID
+func lessResult(a, b result, keys []core.SortOption) bool {
+	for k := range keys {
+		if cmp := compareByField(a.doc, b.doc, &keys[k]); cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return a.id < b.id
+}
+
+// compareByField orders two documents by a sort option. Documents missing
+// the field are placed according to MissingFirst regardless of direction.
+func compareByField(a, b core.Document, opt *core.SortOption) int {
+	va, aFound := core.GetPath(a, opt.Field)
+	vb, bFound := core.GetPath(b, opt.Field)
+	return compareSortValues(va, aFound, vb, bFound, opt)
+}
+
+// compareSortValues orders two field values by a sort option, as
+// compareByField orders the documents holding them
+func compareSortValues(va interface{}, aFound bool, vb interface{}, bFound bool, opt *core.SortOption) int {
+	if aFound != bFound {
+		if aFound == opt.MissingFirst {
+			return 1
+		}
+		return -1
+	}
+
+	cmp := compareForSort(va, aFound, vb, bFound)
+	if opt.Descending {
+		return -cmp
+	}
+	return cmp
+}
+
+// window applies offset and limit to a result set
+func window(results []result, offset, limit int) []result {
+	if offset >= len(results) {
+		return []result{}
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
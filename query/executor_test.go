@@ -0,0 +1,411 @@
+package query
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func setupTestExecutor(t *testing.T) (*Executor, *storage.FileStorageEngine) {
+	tempDir, err := os.MkdirTemp("", "query_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	engine, err := storage.NewFileStorageEngine(tempDir)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	t.Cleanup(func() {
+		engine.Close()
+		os.RemoveAll(tempDir)
+	})
+
+	return NewExecutor(engine, nil), engine
+}
+
+func seedPeople(t *testing.T, engine core.StorageEngine) {
+	people := []core.Document{
+		{"id": "p1", "name": "Alice", "age": 30, "city": "Berlin", "active": true},
+		{"id": "p2", "name": "Bob", "age": 25, "city": "Paris", "active": false},
+		{"id": "p3", "name": "Carol", "age": 35, "city": "Berlin", "active": true},
+		{"id": "p4", "name": "Dave", "age": "unknown", "city": "Rome"},
+		{"id": "p5", "name": "Eve", "city": nil},
+		{"id": "p6", "name": "Frank", "age": 25.0, "city": "Paris", "active": true},
+	}
+	for _, doc := range people {
+		if err := engine.WriteDocument("people", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func ids(docs []core.Document) []string {
+	out := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		out = append(out, fmt.Sprint(doc["id"]))
+	}
+	return out
+}
+
+func TestExecuteOperators(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	tests := []struct {
+		name     string
+		filter   core.Filter
+		expected []string
+	}{
+		{"equal number", core.Filter{Field: "age", Operator: core.OpEqual, Value: 25}, []string{"p2", "p6"}},
+		{"equal string", core.Filter{Field: "city", Operator: core.OpEqual, Value: "Berlin"}, []string{"p1", "p3"}},
+		{"equal bool", core.Filter{Field: "active", Operator: core.OpEqual, Value: false}, []string{"p2"}},
+		{"equal null", core.Filter{Field: "city", Operator: core.OpEqual, Value: nil}, []string{"p5"}},
+		{"equal missing field", core.Filter{Field: "email", Operator: core.OpEqual, Value: nil}, []string{}},
+		{"greater than", core.Filter{Field: "age", Operator: core.OpGreaterThan, Value: 25}, []string{"p1", "p3"}},
+		{"greater than or equal", core.Filter{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: 30.0}, []string{"p1", "p3"}},
+		{"less than", core.Filter{Field: "age", Operator: core.OpLessThan, Value: int64(30)}, []string{"p2", "p6"}},
+		{"less than or equal", core.Filter{Field: "age", Operator: core.OpLessThanOrEqual, Value: 30}, []string{"p1", "p2", "p6"}},
+		{"string range", core.Filter{Field: "name", Operator: core.OpLessThan, Value: "C"}, []string{"p1", "p2"}},
+		{"string value skips numbers", core.Filter{Field: "age", Operator: core.OpGreaterThan, Value: "a"}, []string{"p4"}},
+		{"range over null", core.Filter{Field: "city", Operator: core.OpGreaterThan, Value: nil}, []string{}},
+		{"not equal", core.Filter{Field: "city", Operator: core.OpNotEqual, Value: "Berlin"}, []string{"p2", "p4", "p5", "p6"}},
+		{"not equal coerces numbers", core.Filter{Field: "age", Operator: core.OpNotEqual, Value: int64(25)}, []string{"p1", "p3", "p4"}},
+		{"not equal matching missing", core.Filter{Field: "age", Operator: core.OpNotEqual, Value: 25, MatchMissing: true}, []string{"p1", "p3", "p4", "p5"}},
+		{"in", core.Filter{Field: "age", Operator: core.OpIn, Value: []interface{}{30, 35}}, []string{"p1", "p3"}},
+		{"in coerces numbers", core.Filter{Field: "age", Operator: core.OpIn, Value: []interface{}{1, int64(25)}}, []string{"p2", "p6"}},
+		{"in mixed types", core.Filter{Field: "age", Operator: core.OpIn, Value: []interface{}{"unknown", 30}}, []string{"p1", "p4"}},
+		{"in null", core.Filter{Field: "city", Operator: core.OpIn, Value: []interface{}{nil, "Rome"}}, []string{"p4", "p5"}},
+		{"in empty list", core.Filter{Field: "city", Operator: core.OpIn, Value: []interface{}{}}, []string{}},
+		{"in ignores missing", core.Filter{Field: "age", Operator: core.OpIn, Value: []interface{}{nil}, MatchMissing: true}, []string{}},
+		{"not in", core.Filter{Field: "city", Operator: core.OpNotIn, Value: []interface{}{"Berlin", "Paris"}}, []string{"p4", "p5"}},
+		{"not in matching missing", core.Filter{Field: "active", Operator: core.OpNotIn, Value: []interface{}{true}, MatchMissing: true}, []string{"p2", "p4", "p5"}},
+		{"not in excludes missing", core.Filter{Field: "active", Operator: core.OpNotIn, Value: []interface{}{true}}, []string{"p2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{tt.filter}})
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteCombinations(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected []string
+	}{
+		{
+			"no filters returns everything by ID",
+			core.Query{},
+			[]string{"p1", "p2", "p3", "p4", "p5", "p6"},
+		},
+		{
+			"filters are ANDed",
+			core.Query{Filters: []core.Filter{
+				{Field: "city", Operator: core.OpEqual, Value: "Paris"},
+				{Field: "active", Operator: core.OpEqual, Value: true},
+			}},
+			[]string{"p6"},
+		},
+		{
+			"closed range",
+			core.Query{Filters: []core.Filter{
+				{Field: "age", Operator: core.OpGreaterThan, Value: 25},
+				{Field: "age", Operator: core.OpLessThanOrEqual, Value: 35},
+			}},
+			[]string{"p1", "p3"},
+		},
+		{
+			"sort ascending with ID tiebreak",
+			core.Query{Sort: &core.SortOption{Field: "age"}},
+			[]string{"p2", "p6", "p1", "p3", "p4", "p5"},
+		},
+		{
+			"missing sorts last when descending",
+			core.Query{Sort: &core.SortOption{Field: "age", Descending: true}},
+			[]string{"p4", "p3", "p1", "p2", "p6", "p5"},
+		},
+		{
+			"missing first",
+			core.Query{Sort: &core.SortOption{Field: "active", MissingFirst: true}},
+			[]string{"p4", "p5", "p2", "p1", "p3", "p6"},
+		},
+		{
+			"sort descending",
+			core.Query{
+				Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Berlin"}},
+				Sort:    &core.SortOption{Field: "name", Descending: true},
+			},
+			[]string{"p3", "p1"},
+		},
+		{
+			"offset and limit after sort",
+			core.Query{Sort: &core.SortOption{Field: "name"}, Offset: 1, Limit: 2},
+			[]string{"p2", "p3"},
+		},
+		{
+			"offset past the end",
+			core.Query{Offset: 10},
+			[]string{},
+		},
+		{
+			"limit larger than results",
+			core.Query{Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Rome"}}, Limit: 5},
+			[]string{"p4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Collection = "people"
+			docs, err := executor.Execute(tt.query)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteInvalidQueries(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	tests := []struct {
+		name  string
+		query core.Query
+	}{
+		{"missing collection", core.Query{}},
+		{"negative limit", core.Query{Collection: "people", Limit: -1}},
+		{"negative offset", core.Query{Collection: "people", Offset: -1}},
+		{"missing field", core.Query{Collection: "people", Filters: []core.Filter{{Operator: core.OpEqual}}}},
+		{"in without a list", core.Query{Collection: "people", Filters: []core.Filter{{Field: "a", Operator: core.OpIn, Value: "x"}}}},
+		{"not in without a list", core.Query{Collection: "people", Filters: []core.Filter{{Field: "a", Operator: core.OpNotIn}}}},
+		{"unknown operator", core.Query{Collection: "people", Filters: []core.Filter{{Field: "a", Operator: core.FilterOperator(99)}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := executor.Execute(tt.query); err == nil {
+				t.Errorf("Expected error")
+			}
+		})
+	}
+}
+
+func TestExecuteEmptyCollection(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	docs, err := executor.Execute(core.Query{Collection: "nothing"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(docs) != 0 {
+		t.Errorf("Expected no documents, got %d", len(docs))
+	}
+}
+
+func seedAccounts(t *testing.T, engine core.StorageEngine) {
+	accounts := []core.Document{
+		{"id": "a1", "email": "alice@acme.com", "name": "Alice Anderson"},
+		{"id": "a2", "email": "bob@ACME.com", "name": "Bob Brown"},
+		{"id": "a3", "email": "carol@example.org", "name": "Carol Acme"},
+		{"id": "a4", "email": 42, "name": "Numeric Email"},
+		{"id": "a5", "name": "No Email"},
+	}
+	for _, doc := range accounts {
+		if err := engine.WriteDocument("accounts", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestExecuteStringOperators(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedAccounts(t, engine)
+
+	tests := []struct {
+		name     string
+		filter   core.Filter
+		expected []string
+	}{
+		{"suffix", core.Filter{Field: "email", Operator: core.OpHasSuffix, Value: "@acme.com"}, []string{"a1"}},
+		{"suffix case-insensitive", core.Filter{Field: "email", Operator: core.OpHasSuffix, Value: "@Acme.com", CaseInsensitive: true}, []string{"a1", "a2"}},
+		{"prefix", core.Filter{Field: "name", Operator: core.OpHasPrefix, Value: "Bob"}, []string{"a2"}},
+		{"prefix case-insensitive", core.Filter{Field: "name", Operator: core.OpHasPrefix, Value: "c", CaseInsensitive: true}, []string{"a3"}},
+		{"contains", core.Filter{Field: "name", Operator: core.OpContains, Value: "Acme"}, []string{"a3"}},
+		{"contains case-insensitive", core.Filter{Field: "name", Operator: core.OpContains, Value: "acme", CaseInsensitive: true}, []string{"a3"}},
+		{"contains empty string", core.Filter{Field: "email", Operator: core.OpContains, Value: ""}, []string{"a1", "a2", "a3"}},
+		{"regex", core.Filter{Field: "email", Operator: core.OpRegex, Value: `^[a-c]\w+@acme\.com$`}, []string{"a1"}},
+		{"regex case-insensitive", core.Filter{Field: "email", Operator: core.OpRegex, Value: `@ACME\.`, CaseInsensitive: true}, []string{"a1", "a2"}},
+		{"non-string values never match", core.Filter{Field: "email", Operator: core.OpRegex, Value: `.*`}, []string{"a1", "a2", "a3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := executor.Execute(core.Query{Collection: "accounts", Filters: []core.Filter{tt.filter}})
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteRejectsInvalidStringFilters(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	tests := []struct {
+		name   string
+		filter core.Filter
+	}{
+		{"invalid regex", core.Filter{Field: "email", Operator: core.OpRegex, Value: `([a-z`}},
+		{"non-string pattern", core.Filter{Field: "email", Operator: core.OpRegex, Value: 1}},
+		{"non-string prefix", core.Filter{Field: "email", Operator: core.OpHasPrefix, Value: nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := executor.Execute(core.Query{Collection: "accounts", Filters: []core.Filter{tt.filter}}); err == nil {
+				t.Errorf("Expected validation error")
+			}
+		})
+	}
+}
+
+func seedProfiles(t *testing.T, engine core.StorageEngine) {
+	docs := []core.Document{
+		{"id": "u1", "profile": map[string]interface{}{"address": map[string]interface{}{"city": "Berlin", "zip": 10115}}, "items": []interface{}{map[string]interface{}{"sku": "B2"}}},
+		{"id": "u2", "profile": map[string]interface{}{"address": map[string]interface{}{"city": "Paris", "zip": 75001}}, "items": []interface{}{map[string]interface{}{"sku": "A1"}, map[string]interface{}{"sku": "C3"}}},
+		{"id": "u3", "profile": map[string]interface{}{"address": "unknown"}, "items": []interface{}{}},
+		{"id": "u4", "profile": "not an object", "items": "not an array"},
+		{"id": "u5"},
+	}
+	for _, doc := range docs {
+		if err := engine.WriteDocument("profiles", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestExecuteNestedPaths(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedProfiles(t, engine)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected []string
+	}{
+		{
+			"nested equality",
+			core.Query{Filters: []core.Filter{{Field: "profile.address.city", Operator: core.OpEqual, Value: "Paris"}}},
+			[]string{"u2"},
+		},
+		{
+			"nested range",
+			core.Query{Filters: []core.Filter{{Field: "profile.address.zip", Operator: core.OpLessThan, Value: 20000}}},
+			[]string{"u1"},
+		},
+		{
+			"array index",
+			core.Query{Filters: []core.Filter{{Field: "items.1.sku", Operator: core.OpExists, Value: true}}},
+			[]string{"u2"},
+		},
+		{
+			"type mismatches are missing fields",
+			core.Query{Filters: []core.Filter{{Field: "profile.address.city", Operator: core.OpExists, Value: false}}},
+			[]string{"u3", "u4", "u5"},
+		},
+		{
+			"sort by array element",
+			core.Query{Sort: &core.SortOption{Field: "items.0.sku"}},
+			[]string{"u2", "u1", "u3", "u4", "u5"},
+		},
+		{
+			"sort by nested field descending",
+			core.Query{Sort: &core.SortOption{Field: "profile.address.city", Descending: true}},
+			[]string{"u2", "u1", "u3", "u4", "u5"},
+		},
+		{
+			"sort by nested field with missing first",
+			core.Query{Sort: &core.SortOption{Field: "profile.address.city", MissingFirst: true}},
+			[]string{"u3", "u4", "u5", "u1", "u2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Collection = "profiles"
+			docs, err := executor.Execute(tt.query)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestExecuteReadPreference(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	cached := core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Berlin"}}, Read: core.ReadOptions{Preference: core.ReadCached}}
+	if got := ids(mustExecute(t, executor, cached)); !reflect.DeepEqual(got, []string{"p1", "p3"}) {
+		t.Fatalf("Expected [p1 p3], got %v", got)
+	}
+
+	// Another process moves Alice to Munich
+	path := filepath.Join(engine.Dir(), "people.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	data = bytes.Replace(data, []byte(`"Berlin"`), []byte(`"Munich"`), 1)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write collection file: %v", err)
+	}
+
+	if got := ids(mustExecute(t, executor, cached)); len(got) != 2 {
+		t.Errorf("Expected the cached query to serve both Berliners, got %v", got)
+	}
+	fresh := cached
+	fresh.Read = core.ReadOptions{}
+	if got := ids(mustExecute(t, executor, fresh)); len(got) != 1 {
+		t.Errorf("Expected the fresh query to see one Berliner, got %v", got)
+	}
+}
+
+// mustExecute runs a query, failing the test on error
+func mustExecute(t *testing.T, executor *Executor, q core.Query) []core.Document {
+	t.Helper()
+	docs, err := executor.Execute(q)
+	if err != nil {
+		t.Fatalf("Failed to execute query: %v", err)
+	}
+	return docs
+}
@@ -0,0 +1,131 @@
+package query
+
+import (
+	"context"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// documentCounter is implemented by storage engines that can count a
+// collection's documents without scanning it (FileStorageEngine does)
+type documentCounter interface {
+	CountDocuments(collection string) (int, error)
+}
+
+// SortStrategy describes how query results are ordered
+type SortStrategy string
+
+const (
+	SortByID     SortStrategy = "id"        // No sort keys; results are ordered by document ID
+	SortInMemory SortStrategy = "in-memory" // Every match is collected and sorted by the sort keys
+)
+
+// QueryPlan describes how a query is executed. It marshals to JSON for logging.
+type QueryPlan struct {
+	Collection          string          `json:"collection"`
+	Access              AccessPath      `json:"access"`
+	Index               string          `json:"index,omitempty"`
+	EstimatedCandidates int             `json:"estimated_candidates"` // -1 when unknown
+	IndexedFilters      []core.Filter   `json:"indexed_filters,omitempty"`
+	ResidualFilters     []core.Filter   `json:"residual_filters,omitempty"`
+	ResidualTree        bool            `json:"residual_tree,omitempty"` // The Where tree is checked against every candidate
+	Sort                SortStrategy    `json:"sort"`
+	Stats               *ExecutionStats `json:"stats,omitempty"` // Set by ExecuteExplain
+}
+
+// ExecutionStats records what running a query actually did
+type ExecutionStats struct {
+	DocumentsExamined int           `json:"documents_examined"`
+	DocumentsReturned int           `json:"documents_returned"`
+	IndexHits         int           `json:"index_hits"` // Candidate IDs yielded by the access path
+	Duration          time.Duration `json:"duration_ns"`
+}
+
+// Explain returns the plan Execute would use for a query without running it.
+// The candidate estimate may consult the chosen index.
+func (e *Executor) Explain(q core.Query) (QueryPlan, error) {
+	if _, err := compileProjection(q); err != nil {
+		return QueryPlan{}, err
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return QueryPlan{}, err
+	}
+
+	p := e.plan(q.Collection, compiled)
+	qp := e.describe(q, p)
+	qp.EstimatedCandidates = e.estimate(q.Collection, p)
+	return qp, nil
+}
+
+// ExecuteExplain runs a query like Execute and also returns its plan with
+// execution statistics
+func (e *Executor) ExecuteExplain(q core.Query) ([]core.Document, QueryPlan, error) {
+	start := time.Now()
+
+	proj, err := compileProjection(q)
+	if err != nil {
+		return nil, QueryPlan{}, err
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, QueryPlan{}, err
+	}
+
+	p := e.plan(q.Collection, compiled)
+	results, err := e.runPlan(context.Background(), q, compiled, p)
+	if err != nil {
+		return nil, QueryPlan{}, err
+	}
+	docs := documents(results, proj)
+
+	qp := e.describe(q, p)
+	qp.EstimatedCandidates = p.hits
+	if p.ids == nil {
+		qp.EstimatedCandidates = p.examined
+	}
+	qp.Stats = &ExecutionStats{
+		DocumentsExamined: p.examined,
+		DocumentsReturned: len(docs),
+		IndexHits:         p.hits,
+		Duration:          time.Since(start),
+	}
+	return docs, qp, nil
+}
+
+// describe converts an internal plan to its public description
+func (e *Executor) describe(q core.Query, p *Plan) QueryPlan {
+	qp := QueryPlan{
+		Collection:      q.Collection,
+		Access:          p.Access,
+		Index:           p.Index,
+		IndexedFilters:  p.Indexed,
+		ResidualFilters: p.Residual,
+		ResidualTree:    q.Where != nil,
+		Sort:            SortByID,
+	}
+	if len(sortKeys(q)) > 0 {
+		qp.Sort = SortInMemory
+	}
+	return qp
+}
+
+// estimate returns the number of candidates a plan will visit, or -1 if that
+// cannot be known without scanning
+func (e *Executor) estimate(collection string, p *Plan) int {
+	if p.ids != nil {
+		ids, err := p.ids()
+		if err != nil {
+			return -1
+		}
+		return len(ids)
+	}
+
+	if counter, ok := e.storage.(documentCounter); ok {
+		if count, err := counter.CountDocuments(collection); err == nil {
+			return count
+		}
+	}
+	return -1
+}
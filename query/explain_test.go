@@ -0,0 +1,118 @@
+package query
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+func TestExplainFlipsToIndex(t *testing.T) {
+	_, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	manager, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	executor := NewExecutor(engine, manager)
+
+	q := core.Query{
+		Collection: "people",
+		Filters: []core.Filter{
+			{Field: "city", Operator: core.OpEqual, Value: "Paris"},
+			{Field: "active", Operator: core.OpEqual, Value: true},
+		},
+	}
+
+	plan, err := executor.Explain(q)
+	if err != nil {
+		t.Fatalf("Explain failed: %v", err)
+	}
+	if plan.Access != AccessScan || plan.Index != "" || plan.EstimatedCandidates != 6 {
+		t.Errorf("Expected a scan over 6 documents, got %+v", plan)
+	}
+	if len(plan.ResidualFilters) != 2 || len(plan.IndexedFilters) != 0 {
+		t.Errorf("Expected both filters as residuals, got %+v", plan)
+	}
+
+	if err := manager.CreateSecondaryIndex("people", "city", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	plan, _ = executor.Explain(q)
+	if plan.Access != AccessHash || plan.Index != "city" || plan.EstimatedCandidates != 2 {
+		t.Errorf("Expected a hash lookup with 2 candidates, got %+v", plan)
+	}
+	if !reflect.DeepEqual(plan.IndexedFilters, q.Filters[:1]) || !reflect.DeepEqual(plan.ResidualFilters, q.Filters[1:]) {
+		t.Errorf("Expected city indexed and active residual, got %+v", plan)
+	}
+	if plan.Stats != nil {
+		t.Errorf("Expected Explain not to run the query")
+	}
+}
+
+func TestExecuteExplainStats(t *testing.T) {
+	executor, _, _ := setupIndexedExecutor(t)
+
+	q := core.Query{
+		Collection: "people",
+		Filters: []core.Filter{
+			{Field: "city", Operator: core.OpEqual, Value: "Paris"},
+			{Field: "active", Operator: core.OpEqual, Value: true},
+		},
+	}
+	docs, plan, err := executor.ExecuteExplain(q)
+	if err != nil {
+		t.Fatalf("ExecuteExplain failed: %v", err)
+	}
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p6"}) {
+		t.Errorf("Expected [p6], got %v", got)
+	}
+
+	stats := plan.Stats
+	if stats == nil {
+		t.Fatalf("Expected execution stats")
+	}
+	if stats.DocumentsExamined != 2 || stats.DocumentsReturned != 1 || stats.IndexHits != 2 {
+		t.Errorf("Expected 2 examined, 1 returned and 2 index hits, got %+v", stats)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("Expected a wall time, got %v", stats.Duration)
+	}
+
+	// A scan examines every document and has no index hits
+	q.Filters = []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 26}}
+	q.Sort = &core.SortOption{Field: "age"}
+	_, plan, _ = executor.ExecuteExplain(q)
+	if plan.Access != AccessScan || plan.Sort != SortInMemory {
+		t.Errorf("Expected an in-memory sorted scan, got %+v", plan)
+	}
+	if plan.Stats.DocumentsExamined != 6 || plan.Stats.DocumentsReturned != 2 || plan.Stats.IndexHits != 0 {
+		t.Errorf("Expected 6 examined, 2 returned and no index hits, got %+v", plan.Stats)
+	}
+}
+
+func TestQueryPlanMarshalsToJSON(t *testing.T) {
+	executor, _, _ := setupIndexedExecutor(t)
+
+	_, plan, err := executor.ExecuteExplain(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Rome"}}},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteExplain failed: %v", err)
+	}
+
+	data, err := json.Marshal(plan)
+	if err != nil {
+		t.Fatalf("Failed to marshal plan: %v", err)
+	}
+	for _, want := range []string{`"access":"hash"`, `"index":"city"`, `"Operator":"in"`, `"sort":"id"`, `"documents_returned":1`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Expected %s in %s", want, data)
+		}
+	}
+}
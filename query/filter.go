@@ -0,0 +1,349 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// compiledFilter is a validated filter with any per-query state, such as a
+// compiled regular expression, prepared once before documents are visited
+type compiledFilter struct {
+	core.Filter
+	values []interface{}  // Value list of OpIn and OpNotIn
+	str    string         // Value of the string operators, lowercased if case-insensitive
+	re     *regexp.Regexp // Pattern of OpRegex
+	want   bool           // Expected state for OpExists and OpIsNull
+
+	instants []time.Time // Values of a ValueDateTime filter
+
+	param core.Param // Placeholder holding the value, in prepared query templates
+}
+
+// compileFilters validates and compiles every filter of a query
+func compileFilters(filters []core.Filter, compile func(core.Filter) (*compiledFilter, error)) ([]*compiledFilter, error) {
+	compiled := make([]*compiledFilter, 0, len(filters))
+	for _, f := range filters {
+		cf, err := compile(f)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, cf)
+	}
+	return compiled, nil
+}
+
+// compileFilter rejects filters with an unknown operator, no field or a value
+// of the wrong type for the operator
+func compileFilter(f core.Filter) (*compiledFilter, error) {
+	if f.Field == "" {
+		return nil, fmt.Errorf("missing field in filter")
+	}
+	if param, ok := f.Value.(core.Param); ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnboundParam, param)
+	}
+
+	cf := &compiledFilter{Filter: f}
+	switch f.ValueType {
+	case core.ValueAuto:
+	case core.ValueDateTime:
+		return compileInstantFilter(cf)
+	default:
+		return nil, fmt.Errorf("unknown value type for %s: %d", f.Field, f.ValueType)
+	}
+
+	switch f.Operator {
+	case core.OpEqual, core.OpNotEqual, core.OpGreaterThan, core.OpLessThan, core.OpGreaterThanOrEqual, core.OpLessThanOrEqual:
+		cf.Value = canonicalValue(f.Value)
+		return cf, nil
+	case core.OpIn, core.OpNotIn:
+		values, ok := f.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter on %s needs a []interface{} value, got %T", f.Field, f.Value)
+		}
+		cf.values = make([]interface{}, len(values))
+		for i, value := range values {
+			cf.values[i] = canonicalValue(value)
+		}
+		return cf, nil
+	case core.OpExists, core.OpIsNull:
+		cf.want = true
+		if f.Value != nil {
+			want, ok := f.Value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("filter on %s needs a bool value, got %T", f.Field, f.Value)
+			}
+			cf.want = want
+		}
+		return cf, nil
+	case core.OpContains, core.OpHasPrefix, core.OpHasSuffix, core.OpRegex:
+		str, ok := f.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("filter on %s needs a string value, got %T", f.Field, f.Value)
+		}
+		if f.Operator == core.OpRegex {
+			if f.CaseInsensitive {
+				str = "(?i)" + str
+			}
+			re, err := regexp.Compile(str)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression for %s: %w", f.Field, err)
+			}
+			cf.re = re
+			return cf, nil
+		}
+		if f.CaseInsensitive {
+			str = strings.ToLower(str)
+		}
+		cf.str = str
+		return cf, nil
+	}
+	return nil, fmt.Errorf("unknown filter operator: %d", f.Operator)
+}
+
+// canonicalValue converts a time.Time filter value to the string form
+// documents store timestamps in
+func canonicalValue(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return core.Time(t)
+	}
+	return value
+}
+
+// compileInstantFilter compiles a ValueDateTime filter, converting its values
+// to instants. Only comparison and membership operators are supported.
+func compileInstantFilter(cf *compiledFilter) (*compiledFilter, error) {
+	values := []interface{}{cf.Value}
+	switch cf.Operator {
+	case core.OpEqual, core.OpNotEqual, core.OpGreaterThan, core.OpLessThan, core.OpGreaterThanOrEqual, core.OpLessThanOrEqual:
+	case core.OpIn, core.OpNotIn:
+		list, ok := cf.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("filter on %s needs a []interface{} value, got %T", cf.Field, cf.Value)
+		}
+		values = list
+	default:
+		return nil, fmt.Errorf("filter on %s cannot compare %s values with %s", cf.Field, cf.ValueType, cf.Operator)
+	}
+
+	cf.instants = make([]time.Time, len(values))
+	for i, value := range values {
+		t, ok := core.ToTime(value)
+		if !ok {
+			return nil, fmt.Errorf("filter on %s needs timestamp values, got %v", cf.Field, value)
+		}
+		cf.instants[i] = t
+	}
+	return cf, nil
+}
+
+// compiledNode is a validated filter tree node
+type compiledNode struct {
+	logic    core.LogicOperator
+	filter   *compiledFilter
+	children []*compiledNode
+}
+
+// compileNode validates and compiles a filter tree. Groups must not be empty
+// and a Not node must have exactly one child.
+func compileNode(node core.FilterNode) (*compiledNode, error) {
+	return compileNodeWith(node, compileFilter)
+}
+
+// compileNodeWith is compileNode, compiling leaf filters with compile
+func compileNodeWith(node core.FilterNode, compile func(core.Filter) (*compiledFilter, error)) (*compiledNode, error) {
+	switch node.Logic {
+	case core.LogicLeaf:
+		if node.Filter == nil {
+			return nil, fmt.Errorf("filter leaf without a filter")
+		}
+		cf, err := compile(*node.Filter)
+		if err != nil {
+			return nil, err
+		}
+		return &compiledNode{logic: core.LogicLeaf, filter: cf}, nil
+	case core.LogicAnd, core.LogicOr:
+		if len(node.Children) == 0 {
+			return nil, fmt.Errorf("empty filter group")
+		}
+	case core.LogicNot:
+		if len(node.Children) != 1 {
+			return nil, fmt.Errorf("not filter needs exactly one child, got %d", len(node.Children))
+		}
+	default:
+		return nil, fmt.Errorf("unknown filter logic: %d", node.Logic)
+	}
+
+	cn := &compiledNode{logic: node.Logic, children: make([]*compiledNode, 0, len(node.Children))}
+	for _, child := range node.Children {
+		compiled, err := compileNodeWith(child, compile)
+		if err != nil {
+			return nil, err
+		}
+		cn.children = append(cn.children, compiled)
+	}
+	return cn, nil
+}
+
+// match evaluates the tree against a document, short-circuiting groups
+func (n *compiledNode) match(docID core.DocumentID, doc core.Document) bool {
+	switch n.logic {
+	case core.LogicLeaf:
+		return n.filter.match(docID, doc)
+	case core.LogicAnd:
+		for _, child := range n.children {
+			if !child.match(docID, doc) {
+				return false
+			}
+		}
+		return true
+	case core.LogicOr:
+		for _, child := range n.children {
+			if child.match(docID, doc) {
+				return true
+			}
+		}
+		return false
+	case core.LogicNot:
+		return !n.children[0].match(docID, doc)
+	}
+	return false
+}
+
+// matchesAll reports whether a document satisfies every filter
+func matchesAll(docID core.DocumentID, doc core.Document, filters []*compiledFilter) bool {
+	for _, f := range filters {
+		if !f.match(docID, doc) {
+			return false
+		}
+	}
+	return true
+}
+
+// match evaluates the filter against a document. The field may be a dotted
+// path; a path that does not resolve is a missing field. The pseudo-field
+// core.DocumentIDField resolves to the document ID.
+func (f *compiledFilter) match(docID core.DocumentID, doc core.Document) bool {
+	value, found := f.resolve(docID, doc)
+	if f.Operator == core.OpExists {
+		return found == f.want
+	}
+	if !found {
+		return f.MatchMissing && (f.Operator == core.OpNotEqual || f.Operator == core.OpNotIn)
+	}
+	if f.ValueType == core.ValueDateTime {
+		return f.matchInstant(value)
+	}
+
+	switch f.Operator {
+	case core.OpIsNull:
+		return (value == nil) == f.want
+	case core.OpEqual:
+		return ValuesEqual(value, f.Value)
+	case core.OpNotEqual:
+		return !ValuesEqual(value, f.Value)
+	case core.OpIn:
+		return containsValue(f.values, value)
+	case core.OpNotIn:
+		return !containsValue(f.values, value)
+	case core.OpContains, core.OpHasPrefix, core.OpHasSuffix, core.OpRegex:
+		str, ok := value.(string)
+		return ok && f.matchString(str)
+	}
+
+	cmp, err := compareValues(value, f.Value)
+	if err != nil {
+		return false
+	}
+
+	switch f.Operator {
+	case core.OpGreaterThan:
+		return cmp > 0
+	case core.OpLessThan:
+		return cmp < 0
+	case core.OpGreaterThanOrEqual:
+		return cmp >= 0
+	case core.OpLessThanOrEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+// matchInstant evaluates a ValueDateTime filter. A value that is not a
+// timestamp only matches the negative operators.
+func (f *compiledFilter) matchInstant(value interface{}) bool {
+	t, ok := core.ToTime(value)
+
+	switch f.Operator {
+	case core.OpIn, core.OpNotIn:
+		in := false
+		for _, instant := range f.instants {
+			if ok && t.Equal(instant) {
+				in = true
+				break
+			}
+		}
+		return in == (f.Operator == core.OpIn)
+	}
+
+	if !ok {
+		return f.Operator == core.OpNotEqual
+	}
+	cmp := t.Compare(f.instants[0])
+	switch f.Operator {
+	case core.OpEqual:
+		return cmp == 0
+	case core.OpNotEqual:
+		return cmp != 0
+	case core.OpGreaterThan:
+		return cmp > 0
+	case core.OpLessThan:
+		return cmp < 0
+	case core.OpGreaterThanOrEqual:
+		return cmp >= 0
+	case core.OpLessThanOrEqual:
+		return cmp <= 0
+	}
+	return false
+}
+
+// resolve returns the value the filter's field refers to
+func (f *compiledFilter) resolve(docID core.DocumentID, doc core.Document) (interface{}, bool) {
+	if f.Field == core.DocumentIDField {
+		return string(docID), true
+	}
+	return core.GetPath(doc, f.Field)
+}
+
+// matchString evaluates a string matching operator
+func (f *compiledFilter) matchString(str string) bool {
+	if f.Operator == core.OpRegex {
+		return f.re.MatchString(str)
+	}
+
+	if f.CaseInsensitive {
+		str = strings.ToLower(str)
+	}
+	switch f.Operator {
+	case core.OpContains:
+		return strings.Contains(str, f.str)
+	case core.OpHasPrefix:
+		return strings.HasPrefix(str, f.str)
+	case core.OpHasSuffix:
+		return strings.HasSuffix(str, f.str)
+	}
+	return false
+}
+
+// containsValue reports whether any of values equals value
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if ValuesEqual(value, v) {
+			return true
+		}
+	}
+	return false
+}
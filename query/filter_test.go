@@ -0,0 +1,220 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+var (
+	inBerlin = core.Leaf(core.Filter{Field: "city", Operator: core.OpEqual, Value: "Berlin"})
+	isActive = core.Leaf(core.Filter{Field: "active", Operator: core.OpEqual, Value: true})
+	isYoung  = core.Leaf(core.Filter{Field: "age", Operator: core.OpLessThan, Value: 30})
+)
+
+func TestExecuteFilterTree(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	tests := []struct {
+		name     string
+		where    core.FilterNode
+		filters  []core.Filter
+		expected []string
+	}{
+		{"or", core.Or(inBerlin, isYoung), nil, []string{"p1", "p2", "p3", "p6"}},
+		{"and", core.And(inBerlin, isActive), nil, []string{"p1", "p3"}},
+		{"not", core.Not(inBerlin), nil, []string{"p2", "p4", "p5", "p6"}},
+		{"nested", core.Or(core.And(inBerlin, core.Not(isActive)), core.And(isYoung, isActive)), nil, []string{"p6"}},
+		{"single-child group", core.And(core.Or(isYoung)), nil, []string{"p2", "p6"}},
+		{
+			"tree is ANDed with flat filters",
+			core.Or(inBerlin, isYoung),
+			[]core.Filter{{Field: "name", Operator: core.OpHasPrefix, Value: "C"}},
+			[]string{"p3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := tt.where
+			docs, err := executor.Execute(core.Query{Collection: "people", Filters: tt.filters, Where: &where})
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFilterTreeDeMorgan(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	leaves := []core.FilterNode{inBerlin, isActive, isYoung}
+	run := func(where core.FilterNode) []string {
+		docs, err := executor.Execute(core.Query{Collection: "people", Where: &where})
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return ids(docs)
+	}
+
+	for _, a := range leaves {
+		for _, b := range leaves {
+			// NOT (a AND b) == NOT a OR NOT b
+			if left, right := run(core.Not(core.And(a, b))), run(core.Or(core.Not(a), core.Not(b))); !reflect.DeepEqual(left, right) {
+				t.Errorf("NOT (a AND b) gave %v but NOT a OR NOT b gave %v", left, right)
+			}
+			// NOT (a OR b) == NOT a AND NOT b
+			if left, right := run(core.Not(core.Or(a, b))), run(core.And(core.Not(a), core.Not(b))); !reflect.DeepEqual(left, right) {
+				t.Errorf("NOT (a OR b) gave %v but NOT a AND NOT b gave %v", left, right)
+			}
+		}
+		// NOT NOT a == a
+		if left, right := run(core.Not(core.Not(a))), run(a); !reflect.DeepEqual(left, right) {
+			t.Errorf("NOT NOT a gave %v but a gave %v", left, right)
+		}
+	}
+}
+
+func TestFilterTreeValidation(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	tests := []struct {
+		name  string
+		where core.FilterNode
+	}{
+		{"empty and", core.And()},
+		{"empty or", core.Or()},
+		{"nested empty group", core.Or(inBerlin, core.And())},
+		{"not with two children", core.FilterNode{Logic: core.LogicNot, Children: []core.FilterNode{inBerlin, isActive}}},
+		{"leaf without filter", core.FilterNode{Logic: core.LogicLeaf}},
+		{"invalid leaf filter", core.Leaf(core.Filter{Field: "email", Operator: core.OpRegex, Value: "("})},
+		{"unknown logic", core.FilterNode{Logic: core.LogicOperator(9)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := tt.where
+			if _, err := executor.Execute(core.Query{Collection: "people", Where: &where}); err == nil {
+				t.Errorf("Expected validation error")
+			}
+		})
+	}
+}
+
+func TestFilterTreeShortCircuits(t *testing.T) {
+	// The second child would panic on a nil compiled filter if it were evaluated
+	never := &compiledNode{logic: core.LogicLeaf}
+	doc := core.Document{"city": "Berlin"}
+
+	cf, _ := compileFilter(*inBerlin.Filter)
+	matching := &compiledNode{logic: core.LogicLeaf, filter: cf}
+
+	or := &compiledNode{logic: core.LogicOr, children: []*compiledNode{matching, never}}
+	if !or.match("d1", doc) {
+		t.Errorf("Expected OR to match on its first child")
+	}
+
+	and := &compiledNode{logic: core.LogicAnd, children: []*compiledNode{{logic: core.LogicNot, children: []*compiledNode{matching}}, never}}
+	if and.match("d1", doc) {
+		t.Errorf("Expected AND to fail on its first child")
+	}
+}
+
+func seedPresence(t *testing.T, engine core.StorageEngine) {
+	docs := []core.Document{
+		{"id": "absent", "profile": map[string]interface{}{}},
+		{"id": "null", "nickname": nil, "profile": map[string]interface{}{"bio": nil}},
+		{"id": "zero", "nickname": "", "profile": map[string]interface{}{"bio": ""}},
+		{"id": "value", "nickname": "al", "profile": map[string]interface{}{"bio": "hi"}},
+	}
+	for _, doc := range docs {
+		if err := engine.WriteDocument("presence", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestExistsAndIsNull(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPresence(t, engine)
+
+	exists := func(field string, want interface{}) core.Filter {
+		return core.Filter{Field: field, Operator: core.OpExists, Value: want}
+	}
+	isNull := func(field string, want interface{}) core.Filter {
+		return core.Filter{Field: field, Operator: core.OpIsNull, Value: want}
+	}
+
+	tests := []struct {
+		name     string
+		filter   core.Filter
+		expected []string
+	}{
+		{"exists", exists("nickname", true), []string{"null", "value", "zero"}},
+		{"exists defaults to true", exists("nickname", nil), []string{"null", "value", "zero"}},
+		{"absent", exists("nickname", false), []string{"absent"}},
+		{"is null", isNull("nickname", nil), []string{"null"}},
+		{"is not null", isNull("nickname", false), []string{"value", "zero"}},
+		{"nested exists", exists("profile.bio", true), []string{"null", "value", "zero"}},
+		{"nested absent", exists("profile.bio", false), []string{"absent"}},
+		{"nested is null", isNull("profile.bio", true), []string{"null"}},
+		{"absent through a scalar", exists("nickname.first", false), []string{"absent", "null", "value", "zero"}},
+		{"zero value equals empty string", core.Filter{Field: "nickname", Operator: core.OpEqual, Value: ""}, []string{"zero"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs, err := executor.Execute(core.Query{Collection: "presence", Filters: []core.Filter{tt.filter}})
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := executor.Execute(core.Query{Collection: "presence", Filters: []core.Filter{exists("nickname", "yes")}}); err == nil {
+		t.Errorf("Expected error for a non-bool OpExists value")
+	}
+}
+
+func TestExistsComposesInTrees(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPresence(t, engine)
+
+	absent := core.Leaf(core.Filter{Field: "nickname", Operator: core.OpExists, Value: false})
+	null := core.Leaf(core.Filter{Field: "nickname", Operator: core.OpIsNull})
+	empty := core.Leaf(core.Filter{Field: "nickname", Operator: core.OpEqual, Value: ""})
+
+	tests := []struct {
+		name     string
+		where    core.FilterNode
+		expected []string
+	}{
+		{"absent or null", core.Or(absent, null), []string{"absent", "null"}},
+		{"absent or null or empty", core.Or(absent, null, empty), []string{"absent", "null", "zero"}},
+		{"absent and null never match together", core.And(absent, null), []string{}},
+		{"not absent is exists", core.Not(absent), []string{"null", "value", "zero"}},
+		{"absent and nested bio missing", core.And(absent, core.Leaf(core.Filter{Field: "profile.bio", Operator: core.OpExists, Value: false})), []string{"absent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := tt.where
+			docs, err := executor.Execute(core.Query{Collection: "presence", Where: &where})
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// GroupOptions control GroupBy. Having and SortBy refer to aggregates by
+// their result names, such as "sum(total)", which are matched literally
+// rather than as dotted paths.
+type GroupOptions struct {
+	Having []core.Filter     // Groups must satisfy every filter on their aggregates
+	SortBy []core.SortOption // Group order by aggregate; ties and the default order follow the key
+	Limit  int               // Maximum number of groups returned; 0 means no limit
+}
+
+// GroupResult is one group of documents with its aggregates
+type GroupResult struct {
+	Key        []interface{}          // Group field values in groupFields order; nil for null or missing
+	Aggregates map[string]interface{} // Aggregate values keyed by result name
+}
+
+// group accumulates the aggregates of one group
+type group struct {
+	key  []interface{}
+	accs []*accumulator
+}
+
+// GroupBy groups the documents of a collection matching q, which may be nil,
+// by the values of groupFields and computes aggregates per group. Documents
+// with a null or missing group field share a nil key value. Only one set of
+// accumulators per group is held in memory, not the documents themselves.
+func (e *Executor) GroupBy(collection string, q *core.Query, groupFields []string, aggs []AggregateSpec, opts GroupOptions) ([]GroupResult, error) {
+	if len(groupFields) == 0 {
+		return nil, fmt.Errorf("missing group fields")
+	}
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("invalid group limit: %d", opts.Limit)
+	}
+	query, err := queryFor(collection, q)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newAccumulators(aggs); err != nil {
+		return nil, err
+	}
+	having, err := compileHaving(opts.Having)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*group)
+	err = e.forEachMatch(query, func(doc core.Document) {
+		key := make([]interface{}, len(groupFields))
+		for i, field := range groupFields {
+			key[i], _ = core.GetPath(doc, field)
+		}
+
+		encoded := groupKey(key)
+		g, exists := groups[encoded]
+		if !exists {
+			g = &group{key: key}
+			for _, spec := range aggs {
+				g.accs = append(g.accs, &accumulator{spec: spec})
+			}
+			groups[encoded] = g
+		}
+		for _, acc := range g.accs {
+			acc.add(doc)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]GroupResult, 0, len(groups))
+	for _, g := range groups {
+		values := aggregateResults(g.accs)
+		if !matchesAll("", core.Document(values), having) {
+			continue
+		}
+		out = append(out, GroupResult{Key: g.key, Aggregates: values})
+	}
+
+	sortGroups(out, opts.SortBy)
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+	}
+	return out, nil
+}
+
+// compileHaving compiles Having filters, escaping their fields so aggregate
+// names are matched literally
+func compileHaving(filters []core.Filter) ([]*compiledFilter, error) {
+	escaped := make([]core.Filter, len(filters))
+	for i, f := range filters {
+		f.Field = core.EscapePathSegment(f.Field)
+		escaped[i] = f
+	}
+	return compileFilters(escaped, compileFilter)
+}
+
+// groupKey encodes group key values so that values comparing equal, such as
+// 25 and 25.0, share a group
+func groupKey(key []interface{}) string {
+	normalized := make([]interface{}, len(key))
+	for i, value := range key {
+		if f, ok := core.ToFloat64(value); ok {
+			normalized[i] = f
+		} else {
+			normalized[i] = value
+		}
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return fmt.Sprintf("%v", normalized)
+	}
+	return string(data)
+}
+
+// sortGroups orders groups by the sort options, then by key
+func sortGroups(groups []GroupResult, keys []core.SortOption) {
+	escaped := make([]core.SortOption, len(keys))
+	for i, key := range keys {
+		key.Field = core.EscapePathSegment(key.Field)
+		escaped[i] = key
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := core.Document(groups[i].Aggregates), core.Document(groups[j].Aggregates)
+		for k := range escaped {
+			if cmp := compareByField(a, b, &escaped[k]); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return compareKeys(groups[i].Key, groups[j].Key) < 0
+	})
+}
+
+// compareKeys orders group keys value by value
+func compareKeys(a, b []interface{}) int {
+	for i := range a {
+		if cmp := compareForSort(a[i], true, b[i], true); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
@@ -0,0 +1,151 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedSales(t *testing.T, engine core.StorageEngine) {
+	sales := []core.Document{
+		{"id": "s1", "region": "eu", "channel": "web", "amount": 10},
+		{"id": "s2", "region": "eu", "channel": "web", "amount": 30},
+		{"id": "s3", "region": "eu", "channel": "store", "amount": 5},
+		{"id": "s4", "region": "us", "channel": "web", "amount": 100},
+		{"id": "s5", "region": "us", "channel": "store", "amount": 7},
+		{"id": "s6", "region": "us", "channel": "store", "amount": 8},
+		{"id": "s7", "channel": "web", "amount": 1},                // missing region
+		{"id": "s8", "region": nil, "channel": "web", "amount": 2}, // null region
+	}
+	for _, doc := range sales {
+		if err := engine.WriteDocument("sales", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+var salesAggs = []AggregateSpec{
+	{Function: AggCount},
+	{Function: AggSum, Field: "amount"},
+}
+
+func groupKeys(groups []GroupResult) [][]interface{} {
+	keys := make([][]interface{}, len(groups))
+	for i, g := range groups {
+		keys[i] = g.Key
+	}
+	return keys
+}
+
+func TestGroupByMultipleFields(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedSales(t, engine)
+
+	groups, err := executor.GroupBy("sales", nil, []string{"region", "channel"}, salesAggs, GroupOptions{})
+	if err != nil {
+		t.Fatalf("Failed to group: %v", err)
+	}
+
+	// Ordered by key; null and missing regions share the first group
+	expected := []GroupResult{
+		{Key: []interface{}{nil, "web"}, Aggregates: map[string]interface{}{"count": 2, "sum(amount)": 3.0}},
+		{Key: []interface{}{"eu", "store"}, Aggregates: map[string]interface{}{"count": 1, "sum(amount)": 5.0}},
+		{Key: []interface{}{"eu", "web"}, Aggregates: map[string]interface{}{"count": 2, "sum(amount)": 40.0}},
+		{Key: []interface{}{"us", "store"}, Aggregates: map[string]interface{}{"count": 2, "sum(amount)": 15.0}},
+		{Key: []interface{}{"us", "web"}, Aggregates: map[string]interface{}{"count": 1, "sum(amount)": 100.0}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected %v, got %v", expected, groups)
+	}
+}
+
+func TestGroupByOptions(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedSales(t, engine)
+
+	tests := []struct {
+		name     string
+		query    *core.Query
+		opts     GroupOptions
+		expected [][]interface{}
+	}{
+		{
+			name: "having",
+			opts: GroupOptions{Having: []core.Filter{
+				{Field: "sum(amount)", Operator: core.OpGreaterThanOrEqual, Value: 10},
+			}},
+			expected: [][]interface{}{{"eu", "web"}, {"us", "store"}, {"us", "web"}},
+		},
+		{
+			name: "having on count and sum",
+			opts: GroupOptions{Having: []core.Filter{
+				{Field: "count", Operator: core.OpEqual, Value: 2},
+				{Field: "sum(amount)", Operator: core.OpLessThan, Value: 20},
+			}},
+			expected: [][]interface{}{{nil, "web"}, {"us", "store"}},
+		},
+		{
+			name:     "sort by aggregate descending",
+			opts:     GroupOptions{SortBy: []core.SortOption{{Field: "sum(amount)", Descending: true}}},
+			expected: [][]interface{}{{"us", "web"}, {"eu", "web"}, {"us", "store"}, {"eu", "store"}, {nil, "web"}},
+		},
+		{
+			name:     "ties broken by key",
+			opts:     GroupOptions{SortBy: []core.SortOption{{Field: "count"}}, Limit: 3},
+			expected: [][]interface{}{{"eu", "store"}, {"us", "web"}, {nil, "web"}},
+		},
+		{
+			name: "filtered query",
+			query: &core.Query{Filters: []core.Filter{
+				{Field: "channel", Operator: core.OpEqual, Value: "store"},
+			}},
+			expected: [][]interface{}{{"eu", "store"}, {"us", "store"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups, err := executor.GroupBy("sales", tt.query, []string{"region", "channel"}, salesAggs, tt.opts)
+			if err != nil {
+				t.Fatalf("Failed to group: %v", err)
+			}
+			if got := groupKeys(groups); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGroupByNumericKeys(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	engine.WriteDocument("scores", "a", core.Document{"score": 25})
+	engine.WriteDocument("scores", "b", core.Document{"score": 25.0})
+	engine.WriteDocument("scores", "c", core.Document{"score": int64(30)})
+
+	groups, err := executor.GroupBy("scores", nil, []string{"score"}, []AggregateSpec{{Function: AggCount}}, GroupOptions{})
+	if err != nil {
+		t.Fatalf("Failed to group: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Aggregates["count"] != 2 {
+		t.Errorf("Expected 25 and 25.0 to share a group, got %v", groups)
+	}
+}
+
+func TestGroupByValidation(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedSales(t, engine)
+
+	if _, err := executor.GroupBy("sales", nil, nil, salesAggs, GroupOptions{}); err == nil {
+		t.Errorf("Expected error for missing group fields")
+	}
+	if _, err := executor.GroupBy("sales", nil, []string{"region"}, salesAggs, GroupOptions{Limit: -1}); err == nil {
+		t.Errorf("Expected error for negative limit")
+	}
+	if _, err := executor.GroupBy("sales", nil, []string{"region"}, []AggregateSpec{{Function: "median", Field: "amount"}}, GroupOptions{}); err == nil {
+		t.Errorf("Expected error for unknown aggregate")
+	}
+	if _, err := executor.GroupBy("sales", &core.Query{Collection: "orders"}, []string{"region"}, salesAggs, GroupOptions{}); err == nil {
+		t.Errorf("Expected error for mismatched collection")
+	}
+}
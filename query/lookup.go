@@ -0,0 +1,143 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// LookupSpec joins documents of another collection into query results
+type LookupSpec struct {
+	FromCollection string // Collection holding the referenced documents
+	LocalField     string // Dotted path of the reference in each result
+	ForeignField   string // Dotted path matched in FromCollection; defaults to core.DocumentIDField
+	As             string // Top-level key the matches are embedded under
+	Single         bool   // Embed the first match, or nil, instead of an array
+}
+
+// ExecuteLookup runs a query and then applies each lookup in order, so a
+// later lookup may reference a key embedded by an earlier one. Matches are
+// embedded as an array ordered by document ID; a reference without matches
+// embeds an empty array. An array local value references each of its
+// elements, and null or missing local values reference nothing.
+//
+// Each lookup reads the referenced documents with a single query on the
+// foreign field, so it uses the primary key or a secondary index when one
+// applies. A projection is applied before the lookups and must keep the
+// local fields.
+func (e *Executor) ExecuteLookup(q core.Query, lookups ...LookupSpec) ([]core.Document, error) {
+	for _, spec := range lookups {
+		if spec.FromCollection == "" || spec.LocalField == "" || spec.As == "" {
+			return nil, fmt.Errorf("lookup needs a collection, local field and key")
+		}
+	}
+
+	docs, err := e.Execute(q)
+	if err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		copied := make(core.Document, len(doc)+len(lookups))
+		for key, value := range doc {
+			copied[key] = value
+		}
+		docs[i] = copied
+	}
+
+	for _, spec := range lookups {
+		if err := e.lookup(docs, spec); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// lookup embeds the matches of one lookup into every document
+func (e *Executor) lookup(docs []core.Document, spec LookupSpec) error {
+	foreignField := spec.ForeignField
+	if foreignField == "" {
+		foreignField = core.DocumentIDField
+	}
+
+	var values []interface{}
+	seen := make(map[string]struct{})
+	for _, doc := range docs {
+		for _, value := range references(doc, spec.LocalField) {
+			key := lookupKey(value)
+			if _, dup := seen[key]; !dup {
+				seen[key] = struct{}{}
+				values = append(values, value)
+			}
+		}
+	}
+
+	matches := make(map[string][]core.Document)
+	if len(values) > 0 {
+		results, err := e.run(core.Query{
+			Collection: spec.FromCollection,
+			Filters:    []core.Filter{{Field: foreignField, Operator: core.OpIn, Value: values}},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to look up %s.%s: %w", spec.FromCollection, foreignField, err)
+		}
+		for _, r := range results {
+			var value interface{} = string(r.id)
+			if foreignField != core.DocumentIDField {
+				value, _ = core.GetPath(r.doc, foreignField)
+			}
+			key := lookupKey(value)
+			matches[key] = append(matches[key], r.doc)
+		}
+	}
+
+	for _, doc := range docs {
+		joined := []core.Document{}
+		referenced := make(map[string]struct{})
+		for _, value := range references(doc, spec.LocalField) {
+			key := lookupKey(value)
+			if _, dup := referenced[key]; dup {
+				continue
+			}
+			referenced[key] = struct{}{}
+			for _, match := range matches[key] {
+				joined = append(joined, match.Clone())
+			}
+		}
+
+		if !spec.Single {
+			doc[spec.As] = joined
+		} else if len(joined) > 0 {
+			doc[spec.As] = joined[0]
+		} else {
+			doc[spec.As] = nil
+		}
+	}
+	return nil
+}
+
+// references returns the values a document references through a local
+// field, skipping nulls and values that cannot be looked up
+func references(doc core.Document, field string) []interface{} {
+	value, found := core.GetPath(doc, field)
+	if !found {
+		return nil
+	}
+
+	candidates := []interface{}{value}
+	if elements, ok := value.([]interface{}); ok {
+		candidates = elements
+	}
+
+	var refs []interface{}
+	for _, candidate := range candidates {
+		if candidate != nil && lookupSafe(candidate) {
+			refs = append(refs, candidate)
+		}
+	}
+	return refs
+}
+
+// lookupKey encodes a joined value the way group keys are encoded
+func lookupKey(value interface{}) string {
+	return groupKey([]interface{}{value})
+}
@@ -0,0 +1,182 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// seedShop writes customers, regions and orders referencing them, with a hash
+// index on orders.customer_id
+func seedShop(t *testing.T) (*Executor, *countingEngine) {
+	executor, engine, manager := setupIndexedExecutor(t)
+
+	docs := map[string][]core.Document{
+		"regions": {
+			{"id": "eu", "name": "Europe"},
+		},
+		"customers": {
+			{"id": "c1", "name": "Ada", "region_id": "eu"},
+			{"id": "c2", "name": "Grace", "region_id": "us"},
+			{"id": "c3", "name": "Linus"},
+		},
+		"orders": {
+			{"id": "o1", "customer_id": "c1", "total": 10},
+			{"id": "o2", "customer_id": "c2", "total": 20},
+			{"id": "o3", "customer_id": "c1", "total": 30},
+			{"id": "o4", "customer_id": "c9", "total": 40},
+			{"id": "o5", "total": 50},
+		},
+	}
+	for collection, list := range docs {
+		for _, doc := range list {
+			if err := engine.WriteDocument(collection, core.DocumentID(doc["id"].(string)), doc); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+		}
+	}
+	if err := manager.CreateSecondaryIndex("orders", "customer_id", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	engine.scans, engine.visited = 0, 0
+	return executor, engine
+}
+
+func TestLookupByDocumentID(t *testing.T) {
+	executor, engine := seedShop(t)
+
+	docs, err := executor.ExecuteLookup(core.Query{Collection: "orders"}, LookupSpec{
+		FromCollection: "customers",
+		LocalField:     "customer_id",
+		As:             "customer",
+		Single:         true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute lookup: %v", err)
+	}
+
+	expected := map[string]interface{}{"o1": "Ada", "o2": "Grace", "o3": "Ada", "o4": nil, "o5": nil}
+	for _, doc := range docs {
+		var got interface{}
+		if customer, ok := doc["customer"].(core.Document); ok {
+			got = customer["name"]
+		} else if doc["customer"] != nil {
+			t.Fatalf("Expected a single customer document, got %T", doc["customer"])
+		}
+		if got != expected[doc["id"].(string)] {
+			t.Errorf("Expected order %v to join %v, got %v", doc["id"], expected[doc["id"].(string)], got)
+		}
+	}
+
+	// Only the orders are scanned; customers are read by ID
+	if engine.scans != 1 {
+		t.Errorf("Expected 1 scan, got %d", engine.scans)
+	}
+}
+
+func TestLookupBySecondaryField(t *testing.T) {
+	executor, engine := seedShop(t)
+
+	docs, err := executor.ExecuteLookup(core.Query{Collection: "customers"}, LookupSpec{
+		FromCollection: "orders",
+		LocalField:     "id",
+		ForeignField:   "customer_id",
+		As:             "orders",
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute lookup: %v", err)
+	}
+
+	expected := map[string][]string{"c1": {"o1", "o3"}, "c2": {"o2"}, "c3": {}}
+	for _, doc := range docs {
+		orders, ok := doc["orders"].([]core.Document)
+		if !ok {
+			t.Fatalf("Expected an array of orders, got %T", doc["orders"])
+		}
+		got := []string{}
+		for _, order := range orders {
+			got = append(got, order["id"].(string))
+		}
+		if want := expected[doc["id"].(string)]; !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected customer %v to join %v, got %v", doc["id"], want, got)
+		}
+	}
+
+	// The orders are looked up through the customer_id index
+	if engine.scans != 1 {
+		t.Errorf("Expected 1 scan, got %d", engine.scans)
+	}
+}
+
+func TestLookupChained(t *testing.T) {
+	executor, _ := seedShop(t)
+
+	q := core.Query{
+		Collection: "orders",
+		Filters:    []core.Filter{{Field: "total", Operator: core.OpLessThanOrEqual, Value: 20}},
+	}
+	docs, err := executor.ExecuteLookup(q,
+		LookupSpec{FromCollection: "customers", LocalField: "customer_id", As: "customer", Single: true},
+		LookupSpec{FromCollection: "regions", LocalField: "customer.region_id", As: "region", Single: true},
+	)
+	if err != nil {
+		t.Fatalf("Failed to execute lookup: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 orders, got %d", len(docs))
+	}
+
+	if region, _ := docs[0]["region"].(core.Document); region == nil || region["name"] != "Europe" {
+		t.Errorf("Expected o1 to join Europe, got %v", docs[0]["region"])
+	}
+	if docs[1]["region"] != nil {
+		t.Errorf("Expected o2 to join no region, got %v", docs[1]["region"])
+	}
+}
+
+func TestLookupArrayReferences(t *testing.T) {
+	executor, engine := seedShop(t)
+	engine.WriteDocument("carts", "k1", core.Document{"order_ids": []interface{}{"o3", "o1", "o3", "o404"}})
+
+	docs, err := executor.ExecuteLookup(core.Query{Collection: "carts"}, LookupSpec{
+		FromCollection: "orders",
+		LocalField:     "order_ids",
+		As:             "orders",
+	})
+	if err != nil {
+		t.Fatalf("Failed to execute lookup: %v", err)
+	}
+
+	orders := docs[0]["orders"].([]core.Document)
+	if len(orders) != 2 || orders[0]["id"] != "o3" || orders[1]["id"] != "o1" {
+		t.Errorf("Expected [o3 o1] in reference order, got %v", orders)
+	}
+}
+
+func TestLookupDoesNotModifyStoredDocuments(t *testing.T) {
+	executor, engine := seedShop(t)
+
+	if _, err := executor.ExecuteLookup(core.Query{Collection: "orders"}, LookupSpec{
+		FromCollection: "customers", LocalField: "customer_id", As: "customer",
+	}); err != nil {
+		t.Fatalf("Failed to execute lookup: %v", err)
+	}
+
+	doc, err := engine.ReadDocument("orders", "o1")
+	if err != nil {
+		t.Fatalf("Failed to read document: %v", err)
+	}
+	if _, found := doc["customer"]; found {
+		t.Errorf("Expected the stored order to be unchanged, got %v", doc)
+	}
+}
+
+func TestLookupValidation(t *testing.T) {
+	executor, _ := seedShop(t)
+
+	if _, err := executor.ExecuteLookup(core.Query{Collection: "orders"}, LookupSpec{FromCollection: "customers", LocalField: "customer_id"}); err == nil {
+		t.Errorf("Expected error for a lookup without a key")
+	}
+}
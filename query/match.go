@@ -0,0 +1,50 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Matcher applies the filters and projection of a query to documents the
+// caller already holds, such as those of a snapshot, one at a time
+type Matcher struct {
+	compiled *compiledQuery
+	proj     *projection
+}
+
+// NewMatcher compiles the filters and projection of a query. Sorting and
+// windowing need every match at once, so a query with a sort, Limit or
+// Offset is rejected; its collection is ignored.
+func NewMatcher(q core.Query) (*Matcher, error) {
+	if len(sortKeys(q)) > 0 || q.Limit != 0 || q.Offset != 0 {
+		return nil, fmt.Errorf("unable to match documents one at a time with a sort, limit or offset")
+	}
+	filters, err := compileFilters(q.Filters, compileFilter)
+	if err != nil {
+		return nil, err
+	}
+	compiled := &compiledQuery{filters: filters}
+	if q.Where != nil {
+		if compiled.where, err = compileNode(*q.Where); err != nil {
+			return nil, err
+		}
+	}
+	proj, err := compileProjection(q)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{compiled: compiled, proj: proj}, nil
+}
+
+// Match reports whether a document satisfies the query, returning it as
+// Execute would: a projected copy with projection, or doc itself without
+func (m *Matcher) Match(docID core.DocumentID, doc core.Document) (core.Document, bool) {
+	if !m.compiled.match(docID, doc) {
+		return nil, false
+	}
+	if m.proj == nil {
+		return doc, true
+	}
+	return m.proj.apply(docID, doc), true
+}
@@ -0,0 +1,46 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestMatcher(t *testing.T) {
+	doc := core.Document{"name": "Ada", "age": 36.0, "tags": []interface{}{"admin"}}
+	where := core.Or(
+		core.Leaf(core.Filter{Field: "age", Operator: core.OpLessThan, Value: 18.0}),
+		core.Leaf(core.Filter{Field: "name", Operator: core.OpEqual, Value: "Ada"}),
+	)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected core.Document
+	}{
+		{"no filters", core.Query{}, doc},
+		{"matching filter", core.Query{Filters: []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 30.0}}}, doc},
+		{"failing filter", core.Query{Filters: []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 40.0}}}, nil},
+		{"filter tree", core.Query{Where: &where}, doc},
+		{"projection", core.Query{Projection: []string{"name"}}, core.Document{"id": "u1", "name": "Ada"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.query)
+			if err != nil {
+				t.Fatalf("Failed to compile matcher: %v", err)
+			}
+			got, ok := m.Match("u1", doc)
+			if ok != (tt.expected != nil) || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v (matched %v)", tt.expected, got, ok)
+			}
+		})
+	}
+
+	for _, q := range []core.Query{{Limit: 1}, {Offset: 1}, {Sort: &core.SortOption{Field: "age"}}} {
+		if _, err := NewMatcher(q); err == nil {
+			t.Errorf("Expected an error for %+v", q)
+		}
+	}
+}
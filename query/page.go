@@ -0,0 +1,116 @@
+package query
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// Window is a window of a query's results together with the number of
+// matches around it
+type Window struct {
+	Docs   []core.Document
+	Total  int // Documents matching the query's filters
+	Before int // Matches ordered before the window
+}
+
+// ExecuteWindow runs a query like Execute and also counts every match, both
+// from a single pass over the planned access path, so the count and the
+// window agree. With afterID set, the window starts after that document in
+// the query's order instead of at Offset, which keeps paging stable while
+// documents are inserted before it. A sorted query needs the afterID
+// document to still exist, failing with core.ErrDocumentNotFound otherwise.
+//
+// Matches ordered before the window are only counted, and with a Limit only
+// the window's worth of the rest is kept, so no page sorts the whole match
+// set.
+func (e *Executor) ExecuteWindow(q core.Query, afterID core.DocumentID) (Window, error) {
+	proj, err := compileProjection(q)
+	if err != nil {
+		return Window{}, err
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return Window{}, err
+	}
+	keys := sortKeys(q)
+
+	// The window seeks past the afterID document's sort key
+	var after *result
+	offset := q.Offset
+	if afterID != "" {
+		after = &result{id: afterID}
+		if len(keys) > 0 {
+			doc, found, err := e.fetch(context.Background(), q.Collection, afterID, true, q.Read)
+			if err != nil {
+				return Window{}, err
+			}
+			if !found {
+				return Window{}, fmt.Errorf("failed to page %s after %s: %w", q.Collection, afterID, core.ErrDocumentNotFound)
+			}
+			after.doc = doc
+		}
+		offset = 0
+	}
+
+	// Without a Limit every match from the offset on is in the window
+	size := 0
+	if q.Limit > 0 {
+		size = offset + q.Limit
+	}
+	kept := &windowHeap{keys: keys}
+	total, before := 0, 0
+	err = e.scanMatches(q.Collection, compiled, func(docID core.DocumentID, doc core.Document) bool {
+		total++
+		r := result{id: docID, doc: doc}
+		if after != nil && !lessResult(*after, r, keys) {
+			before++
+			return true
+		}
+		kept.add(r, size)
+		return true
+	})
+	if err != nil {
+		return Window{}, err
+	}
+
+	results := kept.results
+	sortResults(results, keys)
+	return Window{
+		Docs:   documents(window(results, offset, q.Limit), proj),
+		Total:  total,
+		Before: before + min(offset, len(results)),
+	}, nil
+}
+
+// windowHeap keeps the matches ordered first, the last of them on top
+type windowHeap struct {
+	results []result
+	keys    []core.SortOption
+}
+
+// add keeps r if fewer than size results are kept or it orders before the
+// last of them, which it then replaces. A size of 0 keeps every result.
+func (h *windowHeap) add(r result, size int) {
+	switch {
+	case size == 0:
+		h.results = append(h.results, r)
+	case len(h.results) < size:
+		heap.Push(h, r)
+	case lessResult(r, h.results[0], h.keys):
+		h.results[0] = r
+		heap.Fix(h, 0)
+	}
+}
+
+func (h windowHeap) Len() int           { return len(h.results) }
+func (h windowHeap) Less(i, j int) bool { return lessResult(h.results[j], h.results[i], h.keys) }
+func (h windowHeap) Swap(i, j int)      { h.results[i], h.results[j] = h.results[j], h.results[i] }
+func (h *windowHeap) Push(x any)        { h.results = append(h.results, x.(result)) }
+func (h *windowHeap) Pop() any {
+	last := h.results[len(h.results)-1]
+	h.results = h.results[:len(h.results)-1]
+	return last
+}
@@ -0,0 +1,69 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestExecuteWindow(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	byName := &core.SortOption{Field: "name", Descending: true}
+	tests := []struct {
+		name          string
+		q             core.Query
+		afterID       core.DocumentID
+		expected      []string
+		total, before int
+	}{
+		{"first window", core.Query{Limit: 2}, "", []string{"p1", "p2"}, 6, 0},
+		{"offset", core.Query{Offset: 4, Limit: 4}, "", []string{"p5", "p6"}, 6, 4},
+		{"beyond the end", core.Query{Offset: 9, Limit: 2}, "", []string{}, 6, 6},
+		{"filtered", core.Query{Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Paris"}}, Limit: 1}, "", []string{"p2"}, 2, 0},
+		{"after ID", core.Query{Limit: 2, Offset: 5}, "p2", []string{"p3", "p4"}, 6, 2},
+		{"after missing ID", core.Query{Limit: 2}, "p25", []string{"p3", "p4"}, 6, 2},
+		{"after last", core.Query{Limit: 2}, "p6", []string{}, 6, 6},
+		{"after sorted", core.Query{Sort: byName, Limit: 2}, "p5", []string{"p4", "p3"}, 6, 2},
+		{"sorted offset", core.Query{Sort: byName, Offset: 1, Limit: 2}, "", []string{"p5", "p4"}, 6, 1},
+		{"after sorted without limit", core.Query{Sort: byName}, "p4", []string{"p3", "p2", "p1"}, 6, 3},
+		{"after non-match", core.Query{Filters: []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}}}, "p2", []string{"p3", "p6"}, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.q.Collection = "people"
+			w, err := executor.ExecuteWindow(tt.q, tt.afterID)
+			if err != nil {
+				t.Fatalf("Failed to execute window: %v", err)
+			}
+			if got := ids(w.Docs); !reflect.DeepEqual(got, tt.expected) || w.Total != tt.total || w.Before != tt.before {
+				t.Errorf("Expected %v of %d after %d, got %v of %d after %d", tt.expected, tt.total, tt.before, got, w.Total, w.Before)
+			}
+		})
+	}
+
+	q := core.Query{Collection: "people", Sort: byName}
+	if _, err := executor.ExecuteWindow(q, "gone"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for a sorted page after a missing document, got %v", err)
+	}
+}
+
+func TestExecuteWindowUsesIndex(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+
+	paris := []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Paris"}}
+	w, err := executor.ExecuteWindow(core.Query{Collection: "people", Filters: paris, Limit: 1}, "p2")
+	if err != nil {
+		t.Fatalf("Failed to execute window: %v", err)
+	}
+	if got := ids(w.Docs); !reflect.DeepEqual(got, []string{"p6"}) || w.Total != 2 || w.Before != 1 {
+		t.Errorf("Expected [p6] of 2 after 1, got %v of %d after %d", got, w.Total, w.Before)
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected the index to replace the scan, got %d scans", engine.scans)
+	}
+}
@@ -0,0 +1,491 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// maxFilterDepth bounds the nesting of parsed filter documents
+const maxFilterDepth = 32
+
+// member is one key of a JSON object, in document order
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// decodeObject decodes a JSON object into its members in document order,
+// rejecting duplicate keys
+func decodeObject(data []byte) ([]member, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, false, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, false, nil
+	}
+
+	var members []member
+	seen := make(map[string]struct{})
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, true, err
+		}
+		key := tok.(string)
+		if _, dup := seen[key]; dup {
+			return nil, true, fmt.Errorf("duplicate key %q", key)
+		}
+		seen[key] = struct{}{}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, true, err
+		}
+		members = append(members, member{key: key, value: value})
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, true, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, true, fmt.Errorf("unexpected data after object")
+	}
+	return members, true, nil
+}
+
+// joinPath appends a key to a path for error messages
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// ParseFilter parses a MongoDB-style filter document such as
+//
+//	{"age": {"$gt": 18}, "$or": [{"status": "active"}, {"role": "admin"}]}
+//
+// into a filter tree. Field keys are dotted paths, and core.DocumentIDField
+// filters on the document ID. Fields take a literal, matched with $eq, or an
+// object of $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $regex (with
+// "$options": "i" to ignore case) and $not. Top-level $and, $or and $not
+// combine whole filter documents. Conditions of one document are ANDed.
+//
+// A null literal matches explicit nulls only; use $exists for missing fields.
+// Errors name the path of the offending key. An empty document is an error,
+// since it matches everything.
+func ParseFilter(data []byte) (core.FilterNode, error) {
+	node, err := parseFilterDocument(data, "", 0)
+	if err != nil {
+		return core.FilterNode{}, err
+	}
+	if node == nil {
+		return core.FilterNode{}, fmt.Errorf("empty filter")
+	}
+	return *node, nil
+}
+
+// parseFilterDocument parses a filter document, returning nil if it is empty
+func parseFilterDocument(data []byte, path string, depth int) (*core.FilterNode, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("invalid filter at %s: nested deeper than %d levels", pathOrRoot(path), maxFilterDepth)
+	}
+
+	members, isObject, err := decodeObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter at %s: %w", pathOrRoot(path), err)
+	}
+	if !isObject {
+		return nil, fmt.Errorf("invalid filter at %s: expected an object", pathOrRoot(path))
+	}
+
+	var conditions []core.FilterNode
+	for _, m := range members {
+		keyPath := joinPath(path, m.key)
+
+		if !strings.HasPrefix(m.key, "$") || m.key == core.DocumentIDField {
+			nodes, err := parseField(m.key, m.value, keyPath, depth)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, nodes...)
+			continue
+		}
+
+		switch m.key {
+		case "$and", "$or":
+			node, err := parseGroup(m.key, m.value, keyPath, depth)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, node)
+		case "$not":
+			child, err := parseFilterDocument(m.value, keyPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			if child == nil {
+				return nil, fmt.Errorf("invalid filter at %s: empty filter", keyPath)
+			}
+			conditions = append(conditions, core.Not(*child))
+		default:
+			return nil, fmt.Errorf("invalid filter at %s: unknown operator %s", keyPath, m.key)
+		}
+	}
+
+	switch len(conditions) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &conditions[0], nil
+	}
+	node := core.And(conditions...)
+	return &node, nil
+}
+
+// parseGroup parses the array of filter documents of $and or $or
+func parseGroup(op string, data []byte, path string, depth int) (core.FilterNode, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return core.FilterNode{}, fmt.Errorf("invalid filter at %s: expected an array of filters", path)
+	}
+	if len(raws) == 0 {
+		return core.FilterNode{}, fmt.Errorf("invalid filter at %s: empty array", path)
+	}
+
+	children := make([]core.FilterNode, 0, len(raws))
+	for i, raw := range raws {
+		child, err := parseFilterDocument(raw, fmt.Sprintf("%s[%d]", path, i), depth+1)
+		if err != nil {
+			return core.FilterNode{}, err
+		}
+		if child == nil {
+			return core.FilterNode{}, fmt.Errorf("invalid filter at %s[%d]: empty filter", path, i)
+		}
+		children = append(children, *child)
+	}
+
+	if op == "$and" {
+		return core.And(children...), nil
+	}
+	return core.Or(children...), nil
+}
+
+// parseField parses the condition on one field: a literal, or an object of
+// operators
+func parseField(field string, data []byte, path string, depth int) ([]core.FilterNode, error) {
+	if field == "" {
+		return nil, fmt.Errorf("invalid filter at %s: empty field name", pathOrRoot(path))
+	}
+
+	members, isObject, err := decodeObject(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter at %s: %w", path, err)
+	}
+	if !isObject || !isOperatorObject(members) {
+		value, err := decodeValue(data, path)
+		if err != nil {
+			return nil, err
+		}
+		return []core.FilterNode{core.Leaf(core.Filter{Field: field, Operator: core.OpEqual, Value: value})}, nil
+	}
+	return parseOperators(field, members, path, depth)
+}
+
+// isOperatorObject reports whether an object holds operators rather than
+// being a literal to compare against. Objects mixing the two are treated as
+// operator objects so the plain keys are reported.
+func isOperatorObject(members []member) bool {
+	for _, m := range members {
+		if strings.HasPrefix(m.key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// comparisonOperators maps Mongo comparison operators to filter operators
+var comparisonOperators = map[string]core.FilterOperator{
+	"$eq":  core.OpEqual,
+	"$ne":  core.OpNotEqual,
+	"$gt":  core.OpGreaterThan,
+	"$gte": core.OpGreaterThanOrEqual,
+	"$lt":  core.OpLessThan,
+	"$lte": core.OpLessThanOrEqual,
+}
+
+// parseOperators parses the operators applied to one field
+func parseOperators(field string, members []member, path string, depth int) ([]core.FilterNode, error) {
+	var nodes []core.FilterNode
+	var regexOptions *member
+	regexAt := -1
+
+	for _, m := range members {
+		opPath := path + "." + m.key
+		if op, ok := comparisonOperators[m.key]; ok {
+			value, err := decodeValue(m.value, opPath)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, core.Leaf(core.Filter{Field: field, Operator: op, Value: value}))
+			continue
+		}
+
+		switch m.key {
+		case "$in", "$nin":
+			value, err := decodeValue(m.value, opPath)
+			if err != nil {
+				return nil, err
+			}
+			values, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid filter at %s: expected an array, got %s", opPath, jsonType(value))
+			}
+			op := core.OpIn
+			if m.key == "$nin" {
+				op = core.OpNotIn
+			}
+			nodes = append(nodes, core.Leaf(core.Filter{Field: field, Operator: op, Value: values}))
+
+		case "$exists":
+			var want bool
+			if err := json.Unmarshal(m.value, &want); err != nil {
+				return nil, fmt.Errorf("invalid filter at %s: expected a boolean", opPath)
+			}
+			nodes = append(nodes, core.Leaf(core.Filter{Field: field, Operator: core.OpExists, Value: want}))
+
+		case "$regex":
+			var pattern string
+			if err := json.Unmarshal(m.value, &pattern); err != nil {
+				return nil, fmt.Errorf("invalid filter at %s: expected a string", opPath)
+			}
+			regexAt = len(nodes)
+			nodes = append(nodes, core.Leaf(core.Filter{Field: field, Operator: core.OpRegex, Value: pattern}))
+
+		case "$options":
+			regexOptions = &member{key: opPath, value: m.value}
+
+		case "$not":
+			if depth+1 > maxFilterDepth {
+				return nil, fmt.Errorf("invalid filter at %s: nested deeper than %d levels", opPath, maxFilterDepth)
+			}
+			inner, isObject, err := decodeObject(m.value)
+			if err != nil || !isObject || len(inner) == 0 || !isOperatorObject(inner) {
+				return nil, fmt.Errorf("invalid filter at %s: expected an operator object", opPath)
+			}
+			children, err := parseOperators(field, inner, opPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			child := children[0]
+			if len(children) > 1 {
+				child = core.And(children...)
+			}
+			nodes = append(nodes, core.Not(child))
+
+		default:
+			if strings.HasPrefix(m.key, "$") {
+				return nil, fmt.Errorf("invalid filter at %s: unknown operator %s", opPath, m.key)
+			}
+			return nil, fmt.Errorf("invalid filter at %s: cannot mix operators and fields", opPath)
+		}
+	}
+
+	if regexOptions != nil {
+		if regexAt < 0 {
+			return nil, fmt.Errorf("invalid filter at %s: $options needs $regex", regexOptions.key)
+		}
+		var options string
+		if err := json.Unmarshal(regexOptions.value, &options); err != nil || strings.Trim(options, "i") != "" {
+			return nil, fmt.Errorf("invalid filter at %s: only the \"i\" option is supported", regexOptions.key)
+		}
+		nodes[regexAt].Filter.CaseInsensitive = options != ""
+	}
+
+	for _, node := range nodes {
+		if node.Logic != core.LogicLeaf {
+			continue
+		}
+		if _, err := compileFilter(*node.Filter); err != nil {
+			return nil, fmt.Errorf("invalid filter at %s: %w", path, err)
+		}
+	}
+	return nodes, nil
+}
+
+// decodeValue decodes a filter value
+func decodeValue(data []byte, path string) (interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("invalid filter at %s: %w", path, err)
+	}
+	return value, nil
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// pathOrRoot names the root of a document in error messages
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "root"
+	}
+	return path
+}
+
+// ParseQuery parses a JSON query document for a collection:
+//
+//	{"filter": {...}, "sort": {"name": 1, "age": -1}, "limit": 10, "skip": 20, "projection": {"name": 1}}
+//
+// The filter uses the ParseFilter syntax; an empty or absent filter matches
+// every document. Sort keys apply in document order, 1 ascending and -1
+// descending. A projection of 1s keeps fields and one of 0s drops them.
+// A filter that only ANDs field conditions becomes plain Filters so the
+// planner can use indexes.
+func ParseQuery(collection string, data []byte) (core.Query, error) {
+	members, isObject, err := decodeObject(data)
+	if err != nil {
+		return core.Query{}, fmt.Errorf("invalid query: %w", err)
+	}
+	if !isObject {
+		return core.Query{}, fmt.Errorf("invalid query: expected an object")
+	}
+
+	q := core.Query{Collection: collection}
+	for _, m := range members {
+		switch m.key {
+		case "filter":
+			node, err := parseFilterDocument(m.value, "filter", 0)
+			if err != nil {
+				return core.Query{}, err
+			}
+			if node != nil {
+				SetFilter(&q, *node)
+			}
+		case "sort":
+			if err := parseSort(&q, m.value); err != nil {
+				return core.Query{}, err
+			}
+		case "limit":
+			if q.Limit, err = parseCount(m.key, m.value); err != nil {
+				return core.Query{}, err
+			}
+		case "skip":
+			if q.Offset, err = parseCount(m.key, m.value); err != nil {
+				return core.Query{}, err
+			}
+		case "projection":
+			if err := parseProjection(&q, m.value); err != nil {
+				return core.Query{}, err
+			}
+		default:
+			return core.Query{}, fmt.Errorf("invalid query: unknown key %q", m.key)
+		}
+	}
+
+	if _, err := validateQuery(q); err != nil {
+		return core.Query{}, err
+	}
+	if _, err := compileProjection(q); err != nil {
+		return core.Query{}, err
+	}
+	return q, nil
+}
+
+// SetFilter stores a filter tree in a query, as plain Filters when it is a
+// conjunction of field conditions so the planner can use indexes
+func SetFilter(q *core.Query, node core.FilterNode) {
+	switch node.Logic {
+	case core.LogicLeaf:
+		q.Filters = []core.Filter{*node.Filter}
+		return
+	case core.LogicAnd:
+		filters := make([]core.Filter, 0, len(node.Children))
+		for _, child := range node.Children {
+			if child.Logic != core.LogicLeaf {
+				q.Where = &node
+				return
+			}
+			filters = append(filters, *child.Filter)
+		}
+		q.Filters = filters
+		return
+	}
+	q.Where = &node
+}
+
+// parseSort parses the sort keys of a query document
+func parseSort(q *core.Query, data []byte) error {
+	members, isObject, err := decodeObject(data)
+	if err != nil || !isObject {
+		return fmt.Errorf("invalid query at sort: expected an object")
+	}
+
+	for _, m := range members {
+		var direction float64
+		if err := json.Unmarshal(m.value, &direction); err != nil || (direction != 1 && direction != -1) {
+			return fmt.Errorf("invalid query at sort.%s: expected 1 or -1", m.key)
+		}
+		key := core.SortOption{Field: m.key, Descending: direction == -1}
+		if q.Sort == nil {
+			q.Sort = &key
+		} else {
+			q.SortBy = append(q.SortBy, key)
+		}
+	}
+	return nil
+}
+
+// parseCount parses a non-negative integer such as limit or skip
+func parseCount(key string, data []byte) (int, error) {
+	var n float64
+	if err := json.Unmarshal(data, &n); err != nil || n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid query at %s: expected a non-negative integer", key)
+	}
+	return int(n), nil
+}
+
+// parseProjection parses a projection of 1s, kept fields, or 0s, dropped fields
+func parseProjection(q *core.Query, data []byte) error {
+	members, isObject, err := decodeObject(data)
+	if err != nil || !isObject {
+		return fmt.Errorf("invalid query at projection: expected an object")
+	}
+
+	for _, m := range members {
+		var flag interface{}
+		if err := json.Unmarshal(m.value, &flag); err != nil {
+			return fmt.Errorf("invalid query at projection.%s: %w", m.key, err)
+		}
+		switch flag {
+		case 1.0, true:
+			q.Projection = append(q.Projection, m.key)
+		case 0.0, false:
+			q.Exclude = append(q.Exclude, m.key)
+		default:
+			return fmt.Errorf("invalid query at projection.%s: expected 0 or 1", m.key)
+		}
+	}
+	return nil
+}
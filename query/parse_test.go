@@ -0,0 +1,269 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func leaf(field string, op core.FilterOperator, value interface{}) core.FilterNode {
+	return core.Leaf(core.Filter{Field: field, Operator: op, Value: value})
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected core.FilterNode
+	}{
+		{
+			name:     "literal",
+			input:    `{"status": "active"}`,
+			expected: leaf("status", core.OpEqual, "active"),
+		},
+		{
+			name:  "comparisons in document order",
+			input: `{"age": {"$gte": 18, "$lt": 65}, "address.city": {"$ne": "Paris"}}`,
+			expected: core.And(
+				leaf("age", core.OpGreaterThanOrEqual, 18.0),
+				leaf("age", core.OpLessThan, 65.0),
+				leaf("address.city", core.OpNotEqual, "Paris"),
+			),
+		},
+		{
+			name:  "membership and existence",
+			input: `{"role": {"$in": ["admin", "owner"]}, "tag": {"$nin": []}, "deleted": {"$exists": false}}`,
+			expected: core.And(
+				leaf("role", core.OpIn, []interface{}{"admin", "owner"}),
+				leaf("tag", core.OpNotIn, []interface{}{}),
+				leaf("deleted", core.OpExists, false),
+			),
+		},
+		{
+			name:  "or with and",
+			input: `{"age": {"$gt": 18}, "$or": [{"status": "active"}, {"role": "admin", "$id": "u1"}]}`,
+			expected: core.And(
+				leaf("age", core.OpGreaterThan, 18.0),
+				core.Or(
+					leaf("status", core.OpEqual, "active"),
+					core.And(leaf("role", core.OpEqual, "admin"), leaf(core.DocumentIDField, core.OpEqual, "u1")),
+				),
+			),
+		},
+		{
+			name:     "top-level not",
+			input:    `{"$not": {"status": "banned"}}`,
+			expected: core.Not(leaf("status", core.OpEqual, "banned")),
+		},
+		{
+			name:     "field not",
+			input:    `{"age": {"$not": {"$gt": 5}}}`,
+			expected: core.Not(leaf("age", core.OpGreaterThan, 5.0)),
+		},
+		{
+			name:  "regex with options",
+			input: `{"name": {"$regex": "^a", "$options": "i"}}`,
+			expected: core.Leaf(core.Filter{
+				Field: "name", Operator: core.OpRegex, Value: "^a", CaseInsensitive: true,
+			}),
+		},
+		{
+			name:     "object literal",
+			input:    `{"meta": {"a": 1}, "tags": ["x"]}`,
+			expected: core.And(leaf("meta", core.OpEqual, map[string]interface{}{"a": 1.0}), leaf("tags", core.OpEqual, []interface{}{"x"})),
+		},
+		{
+			name:     "null literal",
+			input:    `{"deleted_at": null}`,
+			expected: leaf("deleted_at", core.OpEqual, nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ParseFilter([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("Failed to parse filter: %v", err)
+			}
+			if !reflect.DeepEqual(node, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, node)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		path  string
+	}{
+		{`{"age": {"$gt": 1, "$between": [1, 2]}}`, "age.$between"},
+		{`{"$nor": []}`, "$nor"},
+		{`{"role": {"$in": "admin"}}`, "role.$in"},
+		{`{"deleted": {"$exists": 1}}`, "deleted.$exists"},
+		{`{"name": {"$regex": 5}}`, "name.$regex"},
+		{`{"name": {"$regex": "("}}`, "name"},
+		{`{"name": {"$options": "i"}}`, "name.$options"},
+		{`{"name": {"$regex": "a", "$options": "m"}}`, "name.$options"},
+		{`{"a": {"$gt": 1, "b": 2}}`, "a.b"},
+		{`{"$or": [{"a": 1}, {"b": {"$bad": 1}}]}`, "$or[1].b.$bad"},
+		{`{"$or": []}`, "$or"},
+		{`{"$and": {"a": 1}}`, "$and"},
+		{`{"$or": [{}]}`, "$or[0]"},
+		{`{"$not": {}}`, "$not"},
+		{`{"a": {"$not": 5}}`, "a.$not"},
+		{`{"a": 1, "a": 2}`, "root"},
+		{`[]`, "root"},
+		{`{"a": 1} x`, "root"},
+		{`{"": 1}`, "root"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseFilter([]byte(tt.input))
+		if err == nil {
+			t.Errorf("Expected error for %s", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), "at "+tt.path) {
+			t.Errorf("Expected error for %s to name %s, got %v", tt.input, tt.path, err)
+		}
+	}
+
+	if _, err := ParseFilter([]byte(`{}`)); err == nil {
+		t.Errorf("Expected error for an empty filter")
+	}
+	deep := strings.Repeat(`{"$not": `, maxFilterDepth+2) + `{"a": 1}` + strings.Repeat(`}`, maxFilterDepth+2)
+	if _, err := ParseFilter([]byte(deep)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("Expected depth error, got %v", err)
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	input := `{
+		"filter": {"age": {"$gte": 30}, "city": "Paris"},
+		"sort": {"age": -1, "name": 1},
+		"limit": 10,
+		"skip": 2,
+		"projection": {"name": 1, "age": true}
+	}`
+	q, err := ParseQuery("people", []byte(input))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+
+	expected := core.Query{
+		Collection: "people",
+		Filters: []core.Filter{
+			{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: 30.0},
+			{Field: "city", Operator: core.OpEqual, Value: "Paris"},
+		},
+		Sort:       &core.SortOption{Field: "age", Descending: true},
+		SortBy:     []core.SortOption{{Field: "name"}},
+		Limit:      10,
+		Offset:     2,
+		Projection: []string{"name", "age"},
+	}
+	if !reflect.DeepEqual(q, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, q)
+	}
+
+	// Boolean filters are kept as a tree
+	q, err = ParseQuery("people", []byte(`{"filter": {"$or": [{"city": "Paris"}, {"age": {"$lt": 30}}]}, "projection": {"email": 0}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	if q.Where == nil || q.Where.Logic != core.LogicOr || len(q.Filters) != 0 {
+		t.Errorf("Expected an or tree, got %+v", q)
+	}
+	if !reflect.DeepEqual(q.Exclude, []string{"email"}) {
+		t.Errorf("Expected [email] excluded, got %v", q.Exclude)
+	}
+
+	q, err = ParseQuery("people", []byte(`{"filter": {}}`))
+	if err != nil || len(q.Filters) != 0 || q.Where != nil {
+		t.Errorf("Expected an empty filter to match everything, got %+v, %v", q, err)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []string{
+		`{"filter": {"a": {"$bad": 1}}}`,
+		`{"sort": {"a": 2}}`,
+		`{"sort": ["a"]}`,
+		`{"limit": -1}`,
+		`{"limit": 1.5}`,
+		`{"skip": "2"}`,
+		`{"projection": {"a": 1, "b": 0}}`,
+		`{"projection": {"a": 2}}`,
+		`{"where": {}}`,
+		`null`,
+	}
+
+	for _, input := range tests {
+		if _, err := ParseQuery("people", []byte(input)); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+	if _, err := ParseQuery("", []byte(`{}`)); err == nil {
+		t.Errorf("Expected error for a missing collection")
+	}
+}
+
+func TestParseQueryExecutes(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	q, err := ParseQuery("people", []byte(`{"filter": {"$or": [{"city": "Paris"}, {"age": {"$gte": 30}}]}, "sort": {"age": -1}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse query: %v", err)
+	}
+	built, err := New("people").Where("city", "=", "Paris").OrWhere("age", ">=", 30).Sort("age").Desc().Build()
+	if err != nil {
+		t.Fatalf("Failed to build query: %v", err)
+	}
+
+	parsed, err := executor.Execute(q)
+	if err != nil {
+		t.Fatalf("Failed to execute parsed query: %v", err)
+	}
+	expected, err := executor.Execute(built)
+	if err != nil {
+		t.Fatalf("Failed to execute built query: %v", err)
+	}
+	if len(parsed) == 0 || !reflect.DeepEqual(parsed, expected) {
+		t.Errorf("Expected %v, got %v", expected, parsed)
+	}
+}
+
+func FuzzParseFilter(f *testing.F) {
+	seeds := []string{
+		`{"age": {"$gt": 18}, "$or": [{"status": "active"}, {"role": "admin"}]}`,
+		`{"name": {"$regex": "^a", "$options": "i"}}`,
+		`{"a": {"$not": {"$in": [1, 2]}}}`,
+		`{"$and": [{"$not": {"a": null}}]}`,
+		`{"a": {"$exists": true}, "b.c": {"d": 1}}`,
+		`{"a": 1, "a": 2}`,
+		`{"$or": [{}]}`,
+		`{`,
+		`[`,
+		``,
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		node, err := ParseFilter(data)
+		if err != nil {
+			return
+		}
+		// Every parsed filter must compile and be safe to evaluate
+		compiled, err := compileNode(node)
+		if err != nil {
+			t.Fatalf("Parsed filter %q does not compile: %v", data, err)
+		}
+		compiled.match("id", core.Document{"a": 1.0, "b": map[string]interface{}{"c": "x"}})
+	})
+}
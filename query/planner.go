@@ -0,0 +1,223 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// AccessPath is the way a query reads its candidate documents
+type AccessPath int
+
+const (
+	AccessScan      AccessPath = iota // Full collection scan
+	AccessPrimary                     // Lookup by document ID
+	AccessHash                        // Hash index equality or membership lookup
+	AccessOrdered                     // Ordered index equality, range or prefix scan
+	AccessComposite                   // Composite index lookup on leading fields
+)
+
+// accessPathNames maps access paths to their encoded names
+var accessPathNames = map[AccessPath]string{
+	AccessScan:      "scan",
+	AccessPrimary:   "primary",
+	AccessHash:      "hash",
+	AccessOrdered:   "ordered",
+	AccessComposite: "composite",
+}
+
+// String returns the access path name
+func (a AccessPath) String() string {
+	if name, ok := accessPathNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("AccessPath(%d)", int(a))
+}
+
+// MarshalText encodes the access path by name
+func (a AccessPath) MarshalText() ([]byte, error) {
+	name, ok := accessPathNames[a]
+	if !ok {
+		return nil, fmt.Errorf("unknown access path: %d", int(a))
+	}
+	return []byte(name), nil
+}
+
+// Plan describes how a query reads candidate documents. An index only
+// narrows the candidates: every candidate is still checked against all of
+// the query's filters, so a plan never changes the results, only the cost.
+type Plan struct {
+	Access   AccessPath
+	Index    string        // Name of the index used; empty for scans and ID lookups
+	Indexed  []core.Filter // Filters the access path narrows candidates by
+	Residual []core.Filter // Flat filters checked only against candidates
+
+	ids         func() ([]core.DocumentID, error) // Candidate IDs; nil for a scan
+	fromStorage bool                              // Candidates are read from storage rather than the primary index
+	read        core.ReadOptions                  // How candidates are read from storage
+
+	// Counters updated while the plan runs
+	examined int // Candidate documents visited
+	hits     int // Candidate IDs yielded by the access path
+}
+
+// Access path preferences, most selective first. Among options of the same
+// rank the one on the earliest filter wins.
+const (
+	rankPrimary = iota
+	rankCompositeMulti
+	rankHashEqual
+	rankOrderedEqual
+	rankCompositeSingle
+	rankHashIn
+	rankOrderedRange
+	rankOrderedPrefix
+)
+
+// option is a candidate access path considered by the planner
+type option struct {
+	rank int
+	plan Plan
+	used []*compiledFilter
+}
+
+// Plan returns the access path Execute would use for a query
+func (e *Executor) Plan(q core.Query) (*Plan, error) {
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return e.plan(q.Collection, compiled), nil
+}
+
+// plan chooses an access path for the query's flat filters. Filters inside
+// the Where tree are only evaluated as residuals.
+func (e *Executor) plan(collection string, compiled *compiledQuery) *Plan {
+	return e.planWith(collection, compiled, e.indexInfos(collection))
+}
+
+// indexInfos describes the secondary indexes of a collection, or returns nil
+// when there is no index manager or it cannot describe them
+func (e *Executor) indexInfos(collection string) []core.IndexInfo {
+	if e.indexes == nil {
+		return nil
+	}
+	infos, err := e.indexes.ListIndexes(collection)
+	if err != nil {
+		return nil
+	}
+	return infos
+}
+
+// planWith is plan, choosing among the indexes infos describes. Without
+// any, every index path is skipped.
+func (e *Executor) planWith(collection string, compiled *compiledQuery, infos []core.IndexInfo) *Plan {
+	var best *option
+	consider := func(o *option) {
+		if o != nil && (best == nil || o.rank < best.rank) {
+			best = o
+		}
+	}
+
+	// Indexes key values by their dynamic type, so only filters comparing
+	// the same way can be pushed down
+	var filters []*compiledFilter
+	for _, f := range compiled.filters {
+		if f.ValueType == core.ValueAuto {
+			filters = append(filters, f)
+		}
+	}
+
+	consider(primaryOption(filters))
+
+	if len(infos) > 0 {
+		consider(e.compositeOption(collection, infos, filters))
+		for _, f := range filters {
+			consider(e.fieldOption(collection, infos, f))
+		}
+		consider(e.rangeOption(collection, infos, filters))
+	}
+
+	if best == nil {
+		best = &option{plan: Plan{Access: AccessScan}}
+	}
+
+	p := best.plan
+	p.read = compiled.read
+	for _, f := range compiled.filters {
+		if usesFilter(best.used, f) {
+			p.Indexed = append(p.Indexed, f.Filter)
+		} else {
+			p.Residual = append(p.Residual, f.Filter)
+		}
+	}
+	return &p
+}
+
+// usesFilter reports whether f is one of used
+func usesFilter(used []*compiledFilter, f *compiledFilter) bool {
+	for _, u := range used {
+		if u == f {
+			return true
+		}
+	}
+	return false
+}
+
+// scanPlanned visits the candidates of a plan. Candidates are a superset of
+// the matches, so visit must still evaluate every filter.
+func (e *Executor) scanPlanned(ctx context.Context, collection string, p *Plan, visit func(core.DocumentID, core.Document) bool) error {
+	if p.ids == nil {
+		err := e.scanCollection(ctx, collection, p.read, func(docID core.DocumentID, doc core.Document) bool {
+			p.examined++
+			return visit(docID, doc)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scan collection %s: %w", collection, err)
+		}
+		return nil
+	}
+
+	ids, err := p.ids()
+	if err != nil {
+		return err
+	}
+	p.hits += len(ids)
+	for _, docID := range ids {
+		doc, found, err := e.fetch(ctx, collection, docID, p.fromStorage, p.read)
+		if err != nil {
+			return err
+		}
+		if !found {
+			continue
+		}
+		p.examined++
+		if !visit(docID, doc) {
+			break
+		}
+	}
+	return nil
+}
+
+// fetch reads a candidate document, reporting false if it does not exist
+func (e *Executor) fetch(ctx context.Context, collection string, docID core.DocumentID, fromStorage bool, read core.ReadOptions) (core.Document, bool, error) {
+	if fromStorage {
+		doc, err := e.readDocument(ctx, collection, docID, read)
+		if errors.Is(err, core.ErrDocumentNotFound) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read document %s: %w", docID, err)
+		}
+		return doc, true, nil
+	}
+
+	doc, err := e.indexes.LookupPrimary(collection, docID)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read indexed document %s: %w", docID, err)
+	}
+	// Indexed documents are shared with the index, so hand out a copy
+	return doc.Clone(), true, nil
+}
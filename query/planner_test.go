@@ -0,0 +1,190 @@
+package query
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+func TestPlanChoosesAccessPath(t *testing.T) {
+	executor, _, manager := setupIndexedExecutor(t)
+	manager.CreateSecondaryIndex("people", "age", core.IndexOrdered)
+	manager.CreateSecondaryIndex("people", "name", core.IndexOrdered)
+	manager.CreateCompositeIndex("people", []string{"city", "active"})
+
+	eq := func(field string, value interface{}) core.Filter {
+		return core.Filter{Field: field, Operator: core.OpEqual, Value: value}
+	}
+
+	tests := []struct {
+		name    string
+		filters []core.Filter
+		access  AccessPath
+		index   string
+		indexed int
+	}{
+		{"no filters", nil, AccessScan, "", 0},
+		{"unindexed field", []core.Filter{eq("active", true)}, AccessScan, "", 0},
+		{"document ID", []core.Filter{eq("name", "Bob"), eq(core.DocumentIDField, "p2")}, AccessPrimary, "", 1},
+		{"document ID list", []core.Filter{{Field: core.DocumentIDField, Operator: core.OpIn, Value: []interface{}{"p1", "p2"}}}, AccessPrimary, "", 1},
+		{"hash equality", []core.Filter{eq("city", "Paris")}, AccessHash, "city", 1},
+		{"composite beats hash", []core.Filter{eq("city", "Paris"), eq("active", true)}, AccessComposite, "city,active", 2},
+		{"ordered equality", []core.Filter{eq("age", 25)}, AccessOrdered, "age", 1},
+		{"hash equality beats ordered", []core.Filter{eq("age", 25), eq("city", "Paris")}, AccessHash, "city", 1},
+		{"membership", []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Paris", "Rome"}}}, AccessHash, "city", 1},
+		{"range merges bounds", []core.Filter{
+			{Field: "age", Operator: core.OpGreaterThan, Value: 20},
+			{Field: "age", Operator: core.OpLessThanOrEqual, Value: 30},
+		}, AccessOrdered, "age", 2},
+		{"string range is not pushed down", []core.Filter{{Field: "name", Operator: core.OpGreaterThan, Value: "B"}}, AccessScan, "", 0},
+		{"prefix", []core.Filter{{Field: "name", Operator: core.OpHasPrefix, Value: "Ca"}}, AccessOrdered, "name", 1},
+		{"array value is not pushed down", []core.Filter{eq("city", []interface{}{"Paris"})}, AccessScan, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := core.Query{Collection: "people", Filters: tt.filters}
+			plan, err := executor.Plan(q)
+			if err != nil {
+				t.Fatalf("Plan failed: %v", err)
+			}
+			if plan.Access != tt.access || plan.Index != tt.index {
+				t.Errorf("Expected %s on %q, got %s on %q", tt.access, tt.index, plan.Access, plan.Index)
+			}
+			if len(plan.Indexed) != tt.indexed || len(plan.Indexed)+len(plan.Residual) != len(tt.filters) {
+				t.Errorf("Expected %d indexed filters, got %d indexed and %d residual", tt.indexed, len(plan.Indexed), len(plan.Residual))
+			}
+
+			// Whatever the plan, results match an unindexed executor
+			expected, _ := NewExecutor(executor.storage, nil).Execute(q)
+			got, err := executor.Execute(q)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if !reflect.DeepEqual(ids(got), ids(expected)) {
+				t.Errorf("Expected %v, got %v", ids(expected), ids(got))
+			}
+		})
+	}
+}
+
+func TestPlanPrimaryReadsByID(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	engine.WriteDocument("people", "mismatch", core.Document{"id": "p1", "name": "Other"})
+
+	docs, err := executor.Execute(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: core.DocumentIDField, Operator: core.OpIn, Value: []interface{}{"p3", "p1", "nope", "p3"}}},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	// The pseudo-field compares the document ID, not the stored "id" field
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p1", "p3"}) {
+		t.Errorf("Expected [p1 p3], got %v", got)
+	}
+}
+
+// randomValue returns a value from a small pool so that filters and documents collide often
+func randomValue(r *rand.Rand) interface{} {
+	pool := []interface{}{
+		nil, true, false, 0, 1, 2.5, 3, -1, int64(7),
+		"a", "A", "ab", "Abc", "b", "ba", "", "2024-01-01T00:00:00Z", "2024-01-01T01:00:00+01:00",
+		[]interface{}{"a", 1}, []interface{}{},
+	}
+	return pool[r.Intn(len(pool))]
+}
+
+func randomFilter(r *rand.Rand) core.Filter {
+	fields := []string{"a", "b", "c", core.DocumentIDField}
+	operators := []core.FilterOperator{
+		core.OpEqual, core.OpEqual, core.OpIn, core.OpGreaterThan, core.OpGreaterThanOrEqual,
+		core.OpLessThan, core.OpLessThanOrEqual, core.OpHasPrefix,
+	}
+
+	f := core.Filter{Field: fields[r.Intn(len(fields))], Operator: operators[r.Intn(len(operators))]}
+	switch f.Operator {
+	case core.OpIn:
+		values := make([]interface{}, r.Intn(3)+1)
+		for i := range values {
+			values[i] = randomValue(r)
+		}
+		f.Value = values
+	case core.OpHasPrefix:
+		f.Value = []string{"a", "A", "b", "d1", "2024"}[r.Intn(5)]
+		f.CaseInsensitive = r.Intn(2) == 0
+	default:
+		f.Value = randomValue(r)
+		if f.Field == core.DocumentIDField && r.Intn(2) == 0 {
+			f.Value = fmt.Sprintf("d%d", r.Intn(60))
+		}
+	}
+	return f
+}
+
+func TestPlannerMatchesScan(t *testing.T) {
+	_, engine := setupTestExecutor(t)
+	manager, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	manager.CreatePrimaryIndex("docs")
+	manager.CreateSecondaryIndex("docs", "a", core.IndexHash)
+	manager.CreateIndexWithOptions("docs", "b", core.IndexOrdered, index.IndexOptions{Sparse: true, CaseInsensitive: true})
+	manager.CreateSecondaryIndex("docs", "c", core.IndexOrdered)
+	manager.CreateCompositeIndex("docs", []string{"a", "c"})
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 50; i++ {
+		doc := core.Document{"id": fmt.Sprintf("d%d", i)}
+		for _, field := range []string{"a", "b", "c"} {
+			if r.Intn(5) > 0 {
+				doc[field] = randomValue(r)
+			}
+		}
+		if err := manager.WriteIndexed("docs", core.DocumentID(fmt.Sprintf("d%d", i)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+
+	indexed := NewExecutor(engine, manager)
+	scanning := NewExecutor(engine, nil)
+	paths := make(map[AccessPath]int)
+
+	for i := 0; i < 500; i++ {
+		q := core.Query{Collection: "docs"}
+		for n := r.Intn(3) + 1; n > 0; n-- {
+			q.Filters = append(q.Filters, randomFilter(r))
+		}
+
+		plan, err := indexed.Plan(q)
+		if err != nil {
+			t.Fatalf("Plan failed: %v", err)
+		}
+		paths[plan.Access]++
+
+		expected, err := scanning.Execute(q)
+		if err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+		got, err := indexed.Execute(q)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		if !reflect.DeepEqual(ids(got), ids(expected)) {
+			t.Fatalf("Query %+v planned as %s on %q: expected %v, got %v", q.Filters, plan.Access, plan.Index, ids(expected), ids(got))
+		}
+	}
+
+	// Every access path should have been exercised
+	for _, access := range []AccessPath{AccessScan, AccessPrimary, AccessHash, AccessOrdered, AccessComposite} {
+		if paths[access] == 0 {
+			t.Errorf("Expected some queries planned as %s, got %v", access, paths)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrUnboundParam is returned for a query holding a core.Param run
+	// without preparing it
+	ErrUnboundParam = errors.New("query parameter is not bound")
+
+	// ErrMissingParam is returned when a prepared query runs without a
+	// binding for one of its parameters
+	ErrMissingParam = errors.New("missing query parameter")
+
+	// ErrParamType is returned when a parameter is bound to a value its
+	// filter cannot use, such as a number for a regular expression
+	ErrParamType = errors.New("query parameter has the wrong type")
+)
+
+// versionedIndexes is implemented by index managers that report when
+// indexes change or go stale (FileIndexManager does), letting prepared
+// queries keep their plans until then
+type versionedIndexes interface {
+	IndexVersion() uint64
+	IndexesStale(collection string) (bool, error)
+}
+
+// PreparedQuery is a query validated and compiled once, to be run many
+// times with different values for its parameters. Its plan is kept until
+// indexes are created, dropped, loaded or rebuilt, or go stale through
+// writes that bypass the index manager. It is safe for concurrent use.
+type PreparedQuery struct {
+	e        *Executor
+	query    core.Query
+	proj     *projection
+	compiled *compiledQuery // Filters holding parameters are left uncompiled
+	params   []core.Param   // Parameters of the query, sorted
+	bound    bool           // A flat filter holds a parameter, so plans depend on the bindings
+
+	plan    atomic.Pointer[preparedPlan]
+	replans atomic.Uint64
+}
+
+// preparedPlan is what a prepared query keeps of its planning
+type preparedPlan struct {
+	version uint64
+	stale   bool             // Whether the indexes were stale
+	infos   []core.IndexInfo // Indexes planned against
+	plan    *Plan            // Nil when plans depend on the bindings
+}
+
+// Prepare validates and compiles a query whose filter values may be
+// core.Param placeholders, in Filters or in the Where tree, each standing
+// for a whole filter value
+func (e *Executor) Prepare(q core.Query) (*PreparedQuery, error) {
+	proj, err := compileProjection(q)
+	if err != nil {
+		return nil, err
+	}
+	compiled, err := validateQueryWith(q, compileTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &PreparedQuery{e: e, query: q, proj: proj, compiled: compiled}
+	seen := make(map[core.Param]bool)
+	note := func(f *compiledFilter) {
+		if f.param != "" && !seen[f.param] {
+			seen[f.param] = true
+			p.params = append(p.params, f.param)
+		}
+	}
+	for _, f := range compiled.filters {
+		note(f)
+		p.bound = p.bound || f.param != ""
+	}
+	if compiled.where != nil {
+		compiled.where.walk(note)
+	}
+	sort.Slice(p.params, func(i, j int) bool { return p.params[i] < p.params[j] })
+	return p, nil
+}
+
+// compileTemplate compiles a filter of a prepared query, leaving a filter
+// whose value is a parameter to be compiled once it is bound
+func compileTemplate(f core.Filter) (*compiledFilter, error) {
+	param, ok := f.Value.(core.Param)
+	if !ok {
+		return compileFilter(f)
+	}
+	if f.Field == "" {
+		return nil, fmt.Errorf("missing field in filter")
+	}
+	if _, err := f.Operator.MarshalText(); err != nil {
+		return nil, err
+	}
+	if _, err := f.ValueType.MarshalText(); err != nil {
+		return nil, fmt.Errorf("unknown value type for %s: %d", f.Field, f.ValueType)
+	}
+	return &compiledFilter{Filter: f, param: param}, nil
+}
+
+// Params returns the names of the query's parameters, sorted
+func (p *PreparedQuery) Params() []core.Param {
+	return append([]core.Param(nil), p.params...)
+}
+
+// Replans returns how many times the query has been planned, which happens
+// on its first run and again after the collection's indexes change
+func (p *PreparedQuery) Replans() uint64 {
+	return p.replans.Load()
+}
+
+// Execute runs the query with its parameters bound to values by name, as
+// Executor.Execute. A missing binding fails with ErrMissingParam, and a
+// value its filter cannot use with ErrParamType, before storage is read.
+func (p *PreparedQuery) Execute(bindings map[string]interface{}) ([]core.Document, error) {
+	return p.ExecuteContext(context.Background(), bindings)
+}
+
+// ExecuteContext is Execute, traced as Executor.ExecuteContext is
+func (p *PreparedQuery) ExecuteContext(ctx context.Context, bindings map[string]interface{}) (_ []core.Document, err error) {
+	compiled, err := p.bind(bindings)
+	if err != nil {
+		return nil, err
+	}
+	plan := p.planFor(compiled)
+
+	var span trace.Span
+	if p.e.tracer != nil {
+		ctx, span = p.e.startSpan(ctx, p.query.Collection, plan)
+		defer func() { core.EndSpan(span, err) }()
+	}
+	results, err := p.e.runPlan(ctx, p.query, compiled, plan)
+	if err != nil {
+		return nil, err
+	}
+	if span != nil {
+		recordPlan(span, plan, len(results))
+	}
+	return documents(results, p.proj), nil
+}
+
+// Plan returns the access path Execute would use with the bindings
+func (p *PreparedQuery) Plan(bindings map[string]interface{}) (*Plan, error) {
+	compiled, err := p.bind(bindings)
+	if err != nil {
+		return nil, err
+	}
+	return p.planFor(compiled), nil
+}
+
+// bind returns the compiled query with its parameters bound. Filters without
+// parameters are shared with the template.
+func (p *PreparedQuery) bind(bindings map[string]interface{}) (*compiledQuery, error) {
+	if len(p.params) == 0 {
+		return p.compiled, nil
+	}
+	for _, param := range p.params {
+		if _, ok := bindings[string(param)]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingParam, param)
+		}
+	}
+
+	bindFilter := func(f *compiledFilter) (*compiledFilter, error) {
+		if f.param == "" {
+			return f, nil
+		}
+		filter := f.Filter
+		filter.Value = bindings[string(f.param)]
+		cf, err := compileFilter(filter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrParamType, f.param, err)
+		}
+		return cf, nil
+	}
+
+	compiled := &compiledQuery{filters: make([]*compiledFilter, len(p.compiled.filters)), read: p.compiled.read}
+	for i, f := range p.compiled.filters {
+		cf, err := bindFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		compiled.filters[i] = cf
+	}
+	if p.compiled.where != nil {
+		where, err := p.compiled.where.bind(bindFilter)
+		if err != nil {
+			return nil, err
+		}
+		compiled.where = where
+	}
+	return compiled, nil
+}
+
+// planFor returns a plan for the bound query, reusing the kept one while the
+// indexes have neither changed nor gone stale. Each call returns its own
+// copy, as plans count what they visit.
+func (p *PreparedQuery) planFor(compiled *compiledQuery) *Plan {
+	collection := p.query.Collection
+	version, stale, current := p.e.indexVersion(collection)
+	if kept := p.plan.Load(); kept != nil && current && kept.version == version && kept.stale == stale {
+		if kept.plan != nil {
+			plan := *kept.plan
+			return &plan
+		}
+		return p.e.planWith(collection, compiled, kept.infos)
+	}
+
+	infos := p.e.indexInfos(collection)
+	plan := p.e.planWith(collection, compiled, infos)
+	p.replans.Add(1)
+	if current {
+		kept := &preparedPlan{version: version, stale: stale, infos: infos}
+		if !p.bound {
+			copied := *plan
+			kept.plan = &copied
+		}
+		p.plan.Store(kept)
+	}
+	return plan
+}
+
+// indexVersion returns the version of the indexes, whether those of the
+// collection are stale and whether plans made against them may be kept.
+// Without an index manager plans never change; with one that reports no
+// versions they are never kept.
+func (e *Executor) indexVersion(collection string) (uint64, bool, bool) {
+	if e.indexes == nil {
+		return 0, false, true
+	}
+	v, ok := e.indexes.(versionedIndexes)
+	if !ok {
+		return 0, false, false
+	}
+	stale, err := v.IndexesStale(collection)
+	if err != nil {
+		return 0, false, false
+	}
+	return v.IndexVersion(), stale, true
+}
+
+// walk calls fn for every filter in the tree
+func (n *compiledNode) walk(fn func(*compiledFilter)) {
+	if n.filter != nil {
+		fn(n.filter)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+}
+
+// bind returns the tree with its filters replaced by bindFilter, sharing the
+// subtrees it leaves unchanged
+func (n *compiledNode) bind(bindFilter func(*compiledFilter) (*compiledFilter, error)) (*compiledNode, error) {
+	if n.filter != nil {
+		cf, err := bindFilter(n.filter)
+		if err != nil {
+			return nil, err
+		}
+		if cf == n.filter {
+			return n, nil
+		}
+		return &compiledNode{logic: n.logic, filter: cf}, nil
+	}
+
+	var bound *compiledNode
+	for i, child := range n.children {
+		c, err := child.bind(bindFilter)
+		if err != nil {
+			return nil, err
+		}
+		if c != child && bound == nil {
+			bound = &compiledNode{logic: n.logic, children: append([]*compiledNode(nil), n.children...)}
+		}
+		if bound != nil {
+			bound.children[i] = c
+		}
+	}
+	if bound == nil {
+		return n, nil
+	}
+	return bound, nil
+}
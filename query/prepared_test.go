@@ -0,0 +1,227 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// peopleQuery is a query on the people collection whose values are
+// parameters
+var peopleQuery = core.Query{
+	Collection: "people",
+	Filters: []core.Filter{
+		{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: core.Param("minAge")},
+	},
+	Where: &core.FilterNode{Logic: core.LogicOr, Children: []core.FilterNode{
+		core.Leaf(core.Filter{Field: "city", Operator: core.OpEqual, Value: core.Param("city")}),
+		core.Leaf(core.Filter{Field: "name", Operator: core.OpRegex, Value: core.Param("name")}),
+	}},
+	Sort: &core.SortOption{Field: "age"},
+}
+
+// boundQuery returns peopleQuery with its parameters replaced by values
+func boundQuery(minAge interface{}, city, name string) core.Query {
+	q := peopleQuery
+	q.Filters = []core.Filter{{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: minAge}}
+	where := core.Or(
+		core.Leaf(core.Filter{Field: "city", Operator: core.OpEqual, Value: city}),
+		core.Leaf(core.Filter{Field: "name", Operator: core.OpRegex, Value: name}),
+	)
+	q.Where = &where
+	return q
+}
+
+func TestPreparedQuery(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+	seedPeople(t, executor.storage)
+
+	prepared, err := executor.Prepare(peopleQuery)
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+	if got := prepared.Params(); !reflect.DeepEqual(got, []core.Param{"city", "minAge", "name"}) {
+		t.Errorf("Expected the sorted parameters, got %v", got)
+	}
+
+	tests := []struct {
+		minAge interface{}
+		city   string
+		name   string
+		want   []string
+	}{
+		{25, "Paris", "^$", []string{"p2", "p6"}},
+		{26, "Paris", "^$", nil},
+		{25, "Berlin", "^F", []string{"p6", "p1", "p3"}},
+		{31, "Berlin", "^F", []string{"p3"}},
+	}
+	for _, tt := range tests {
+		bindings := map[string]interface{}{"minAge": tt.minAge, "city": tt.city, "name": tt.name}
+		docs, err := prepared.Execute(bindings)
+		if err != nil {
+			t.Fatalf("Failed to execute prepared query: %v", err)
+		}
+		if got := ids(docs); !reflect.DeepEqual(got, append([]string{}, tt.want...)) {
+			t.Errorf("Expected %v for %v, got %v", tt.want, bindings, got)
+		}
+		if want := ids(mustExecute(t, executor, boundQuery(tt.minAge, tt.city, tt.name))); !reflect.DeepEqual(ids(docs), want) {
+			t.Errorf("Expected the results of the query built with the values, %v, got %v", want, ids(docs))
+		}
+	}
+	if prepared.Replans() != 1 {
+		t.Errorf("Expected the query planned once, got %d", prepared.Replans())
+	}
+}
+
+func TestPreparedQueryBindingErrors(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+	prepared, err := executor.Prepare(peopleQuery)
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		bindings map[string]interface{}
+		want     error
+	}{
+		{"missing parameter", map[string]interface{}{"minAge": 25, "city": "Paris"}, ErrMissingParam},
+		{"no bindings", nil, ErrMissingParam},
+		{"number for a regex", map[string]interface{}{"minAge": 25, "city": "Paris", "name": 7}, ErrParamType},
+		{"invalid regex", map[string]interface{}{"minAge": 25, "city": "Paris", "name": "("}, ErrParamType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := prepared.Execute(tt.bindings); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected failed bindings not to touch storage, got %d scans", engine.scans)
+	}
+
+	in, err := executor.Prepare(core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpIn, Value: core.Param("cities")}}})
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+	if _, err := in.Execute(map[string]interface{}{"cities": "Paris"}); !errors.Is(err, ErrParamType) {
+		t.Errorf("Expected ErrParamType for a string list, got %v", err)
+	}
+	docs, err := in.Execute(map[string]interface{}{"cities": []interface{}{"Rome"}})
+	if err != nil || !reflect.DeepEqual(ids(docs), []string{"p4"}) {
+		t.Errorf("Expected p4, got %v and %v", ids(docs), err)
+	}
+
+	if _, err := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "age", Operator: core.OpEqual, Value: core.Param("age")}}}); !errors.Is(err, ErrUnboundParam) {
+		t.Errorf("Expected ErrUnboundParam without preparing, got %v", err)
+	}
+	if _, err := executor.Prepare(core.Query{Collection: "people", Filters: []core.Filter{{Operator: core.OpEqual, Value: core.Param("age")}}}); err == nil {
+		t.Errorf("Expected an error preparing a filter without a field")
+	}
+}
+
+func TestPreparedQueryReplansOnIndexChange(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+	prepared, err := executor.Prepare(core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Paris"}}})
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+
+	check := func(access AccessPath, replans uint64) {
+		t.Helper()
+		plan, err := prepared.Plan(nil)
+		if err != nil {
+			t.Fatalf("Failed to plan: %v", err)
+		}
+		if plan.Access != access || prepared.Replans() != replans {
+			t.Errorf("Expected %s after %d plans, got %s after %d", access, replans, plan.Access, prepared.Replans())
+		}
+		docs, err := prepared.Execute(nil)
+		if err != nil || !reflect.DeepEqual(ids(docs), []string{"p2", "p6"}) {
+			t.Errorf("Expected p2 and p6, got %v and %v", ids(docs), err)
+		}
+	}
+	check(AccessHash, 1)
+	check(AccessHash, 1)
+
+	if err := manager.DropIndex("people", "city"); err != nil {
+		t.Fatalf("Failed to drop index: %v", err)
+	}
+	check(AccessScan, 2)
+	if err := manager.CreateSecondaryIndex("people", "city", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	check(AccessHash, 3)
+
+	if err := manager.RebuildIndexes("people"); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	check(AccessHash, 4)
+
+	// A write that bypasses the manager leaves the index stale until rebuilt
+	if err := engine.WriteDocument("people", "p7", core.Document{"id": "p7", "city": "Rome"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	check(AccessScan, 5)
+	check(AccessScan, 5)
+	if err := manager.RebuildIndexes("people"); err != nil {
+		t.Fatalf("Failed to rebuild indexes: %v", err)
+	}
+	check(AccessHash, 6)
+}
+
+func TestPreparedQueryConcurrentUse(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	manager, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := manager.CreateSecondaryIndex("people", "city", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	executor = NewExecutor(engine, manager)
+	prepared, err := executor.Prepare(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "city", Operator: core.OpEqual, Value: core.Param("city")}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+
+	want := map[string][]string{"Berlin": {"p1", "p3"}, "Paris": {"p2", "p6"}, "Rome": {"p4"}}
+	cities := []string{"Berlin", "Paris", "Rome"}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				city := cities[(g+i)%len(cities)]
+				docs, err := prepared.Execute(map[string]interface{}{"city": city})
+				if err != nil {
+					t.Errorf("Failed to execute prepared query: %v", err)
+					return
+				}
+				if got := ids(docs); !reflect.DeepEqual(got, want[city]) {
+					t.Errorf("Expected %v for %s, got %v", want[city], city, got)
+					return
+				}
+				if g == 0 && i == 25 {
+					if err := manager.CreateSecondaryIndex("people", "name", core.IndexOrdered); err != nil {
+						t.Errorf("Failed to create index: %v", err)
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if prepared.Replans() < 2 {
+		t.Errorf("Expected a replan after an index was created, got %d plans", prepared.Replans())
+	}
+}
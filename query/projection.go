@@ -0,0 +1,126 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// projection reshapes result documents. Paths descend through nested objects
+// only: a path that reaches into an array keeps or drops the whole array.
+type projection struct {
+	include [][]string
+	exclude [][]string
+	idField string
+}
+
+// compileProjection validates the projection settings of a query. It returns
+// nil when the query keeps documents whole.
+func compileProjection(q core.Query) (*projection, error) {
+	if len(q.Projection) > 0 && len(q.Exclude) > 0 {
+		return nil, fmt.Errorf("projection and exclude cannot be combined")
+	}
+	if len(q.Projection) == 0 && len(q.Exclude) == 0 {
+		return nil, nil
+	}
+
+	p := &projection{idField: q.IDField}
+	if p.idField == "" {
+		p.idField = core.DefaultIDField
+	}
+
+	var err error
+	if p.include, err = splitPaths(q.Projection); err != nil {
+		return nil, err
+	}
+	if p.exclude, err = splitPaths(q.Exclude); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// splitPaths splits field paths into segments, rejecting empty paths
+func splitPaths(paths []string) ([][]string, error) {
+	split := make([][]string, len(paths))
+	for i, path := range paths {
+		if path == "" {
+			return nil, fmt.Errorf("missing field in projection")
+		}
+		split[i] = core.SplitPath(path)
+	}
+	return split, nil
+}
+
+// apply returns a projected copy of doc; the original is never modified. The
+// document ID is always set under the ID field.
+func (p *projection) apply(docID core.DocumentID, doc core.Document) core.Document {
+	var out core.Document
+	if len(p.include) > 0 {
+		out = make(core.Document, len(p.include)+1)
+		for _, segments := range p.include {
+			copyPath(out, doc, segments)
+		}
+	} else {
+		out = doc.Clone()
+		for _, segments := range p.exclude {
+			deletePath(out, segments)
+		}
+	}
+
+	out[p.idField] = string(docID)
+	return out
+}
+
+// copyPath copies the value at segments from src into dst, creating the
+// enclosing objects in dst as needed
+func copyPath(dst, src map[string]interface{}, segments []string) {
+	value, ok := src[segments[0]]
+	if !ok {
+		return
+	}
+	if len(segments) == 1 {
+		dst[segments[0]] = cloneJSON(value)
+		return
+	}
+
+	child, isObject := asObject(value)
+	if !isObject {
+		// Arrays and scalars are kept whole
+		dst[segments[0]] = cloneJSON(value)
+		return
+	}
+
+	target, exists := dst[segments[0]].(map[string]interface{})
+	if !exists {
+		target = make(map[string]interface{})
+		dst[segments[0]] = target
+	}
+	copyPath(target, child, segments[1:])
+}
+
+// deletePath removes the value at segments from an object, if present
+func deletePath(obj map[string]interface{}, segments []string) {
+	if len(segments) == 1 {
+		delete(obj, segments[0])
+		return
+	}
+	if child, ok := asObject(obj[segments[0]]); ok {
+		deletePath(child, segments[1:])
+	}
+}
+
+// asObject returns a value as a JSON object, if it is one
+func asObject(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case core.Document:
+		return v, true
+	}
+	return nil, false
+}
+
+// cloneJSON deep-copies a JSON value
+func cloneJSON(value interface{}) interface{} {
+	return core.Document{"v": value}.Clone()["v"]
+}
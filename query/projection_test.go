@@ -0,0 +1,115 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestProjection(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedProfiles(t, engine)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected core.Document
+	}{
+		{
+			"top-level fields",
+			core.Query{Projection: []string{"items"}},
+			core.Document{"id": "u1", "items": []interface{}{map[string]interface{}{"sku": "B2"}}},
+		},
+		{
+			"nested path keeps structure",
+			core.Query{Projection: []string{"profile.address.city"}},
+			core.Document{"id": "u1", "profile": map[string]interface{}{"address": map[string]interface{}{"city": "Berlin"}}},
+		},
+		{
+			"sibling nested paths merge",
+			core.Query{Projection: []string{"profile.address.city", "profile.address.zip"}},
+			core.Document{"id": "u1", "profile": map[string]interface{}{"address": map[string]interface{}{"city": "Berlin", "zip": float64(10115)}}},
+		},
+		{
+			"path into an array keeps the array",
+			core.Query{Projection: []string{"items.0.sku"}},
+			core.Document{"id": "u1", "items": []interface{}{map[string]interface{}{"sku": "B2"}}},
+		},
+		{
+			"missing fields are omitted",
+			core.Query{Projection: []string{"email", "profile.phone"}},
+			core.Document{"id": "u1", "profile": map[string]interface{}{}},
+		},
+		{
+			"exclude nested field",
+			core.Query{Exclude: []string{"items", "profile.address.zip"}},
+			core.Document{"id": "u1", "profile": map[string]interface{}{"address": map[string]interface{}{"city": "Berlin"}}},
+		},
+		{
+			"custom ID field",
+			core.Query{Projection: []string{"items"}, IDField: "_id"},
+			core.Document{"_id": "u1", "items": []interface{}{map[string]interface{}{"sku": "B2"}}},
+		},
+		{
+			"excluding the ID field still reports the ID",
+			core.Query{Exclude: []string{"id", "profile", "items"}},
+			core.Document{"id": "u1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Collection = "profiles"
+			tt.query.Limit = 1
+			docs, err := executor.Execute(tt.query)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if len(docs) != 1 || !reflect.DeepEqual(docs[0], tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, docs)
+			}
+		})
+	}
+}
+
+func TestProjectionDoesNotMutateStoredDocuments(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedProfiles(t, engine)
+
+	docs, err := executor.Execute(core.Query{Collection: "profiles", Exclude: []string{"profile.address.zip"}})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	docs[0]["items"] = "changed"
+
+	stored, err := engine.ReadDocument("profiles", "u1")
+	if err != nil {
+		t.Fatalf("Failed to read document: %v", err)
+	}
+	if zip, ok := core.GetPath(stored, "profile.address.zip"); !ok || zip != float64(10115) {
+		t.Errorf("Expected stored zip to be untouched, got %v", zip)
+	}
+	if _, ok := stored["items"].([]interface{}); !ok {
+		t.Errorf("Expected stored items to be untouched, got %v", stored["items"])
+	}
+
+	// Projection over an in-memory document leaves it intact
+	doc := core.Document{"a": map[string]interface{}{"b": 1, "c": 2}}
+	proj, _ := compileProjection(core.Query{Exclude: []string{"a.b"}})
+	proj.apply("x", doc)
+	if len(doc["a"].(map[string]interface{})) != 2 {
+		t.Errorf("Expected source document to be unchanged, got %v", doc)
+	}
+}
+
+func TestProjectionValidation(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+
+	if _, err := executor.Execute(core.Query{Collection: "profiles", Projection: []string{"a"}, Exclude: []string{"b"}}); err == nil {
+		t.Errorf("Expected error when combining projection and exclude")
+	}
+	if _, err := executor.Execute(core.Query{Collection: "profiles", Projection: []string{""}}); err == nil {
+		t.Errorf("Expected error for an empty projection path")
+	}
+}
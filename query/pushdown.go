@@ -0,0 +1,401 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// rangeLookup is implemented by index managers that can answer range queries
+// over ordered indexes (FileIndexManager does)
+type rangeLookup interface {
+	RangeIDs(collection string, field string, min, max interface{}, includeMin, includeMax bool) ([]core.DocumentID, error)
+}
+
+// compositeLookup is implemented by index managers that can answer prefix
+// lookups over composite indexes (FileIndexManager does)
+type compositeLookup interface {
+	LookupCompositeIDs(collection string, fields []string, values []interface{}) ([]core.DocumentID, error)
+}
+
+// primaryOption reads documents by ID for an equality or membership filter
+// on core.DocumentIDField
+func primaryOption(filters []*compiledFilter) *option {
+	for _, f := range filters {
+		if f.Field != core.DocumentIDField {
+			continue
+		}
+
+		var values []interface{}
+		switch f.Operator {
+		case core.OpEqual:
+			values = []interface{}{f.Value}
+		case core.OpIn:
+			values = f.values
+		default:
+			continue
+		}
+
+		ids, ok := documentIDs(values)
+		if !ok {
+			continue
+		}
+		return &option{
+			rank: rankPrimary,
+			plan: Plan{
+				Access:      AccessPrimary,
+				ids:         func() ([]core.DocumentID, error) { return ids, nil },
+				fromStorage: true,
+			},
+			used: []*compiledFilter{f},
+		}
+	}
+	return nil
+}
+
+// documentIDs converts lookup values to distinct document IDs, reporting
+// false if any value is not a string
+func documentIDs(values []interface{}) ([]core.DocumentID, bool) {
+	seen := make(map[core.DocumentID]struct{}, len(values))
+	ids := make([]core.DocumentID, 0, len(values))
+	for _, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		if _, dup := seen[core.DocumentID(str)]; !dup {
+			seen[core.DocumentID(str)] = struct{}{}
+			ids = append(ids, core.DocumentID(str))
+		}
+	}
+	return ids, true
+}
+
+// fieldOption returns the best single-filter access path for a filter:
+//
+//   - OpEqual over a hash or ordered index, as a lookup
+//   - OpIn over a hash index, as the union of the buckets of its values
+//   - OpHasPrefix over an ordered index, as a range scan
+//
+// Indexes group values more loosely than filters compare them (numbers of
+// any type share a key, case-insensitive indexes fold case), which is safe
+// because candidates are re-checked. Values an index cannot look up
+// faithfully, such as arrays, are never pushed down.
+func (e *Executor) fieldOption(collection string, infos []core.IndexInfo, f *compiledFilter) *option {
+	switch f.Operator {
+	case core.OpEqual:
+		if !lookupSafe(f.Value) {
+			return nil
+		}
+		if info, ok := usableIndex(infos, f.Field, core.IndexHash, f.Value); ok && hashSafe(f.Value) {
+			return e.lookupOption(collection, info, AccessHash, rankHashEqual, f, []interface{}{f.Value})
+		}
+		if info, ok := usableIndex(infos, f.Field, core.IndexOrdered, f.Value); ok && (!info.CaseInsensitive || hashSafe(f.Value)) {
+			return e.lookupOption(collection, info, AccessOrdered, rankOrderedEqual, f, []interface{}{f.Value})
+		}
+
+	case core.OpIn:
+		for _, value := range f.values {
+			if !lookupSafe(value) || !hashSafe(value) {
+				return nil
+			}
+		}
+		info, ok := findIndex(infos, f.Field, core.IndexHash)
+		if !ok || info.Stale || (info.Sparse && containsValue(f.values, nil)) {
+			return nil
+		}
+		return e.lookupOption(collection, info, AccessHash, rankHashIn, f, f.values)
+
+	case core.OpHasPrefix:
+		return e.prefixOption(collection, infos, f)
+	}
+	return nil
+}
+
+// usableIndex returns a fresh single-field index of the given kind that holds
+// every document whose field equals value
+func usableIndex(infos []core.IndexInfo, field string, kind core.IndexKind, value interface{}) (core.IndexInfo, bool) {
+	info, ok := findIndex(infos, field, kind)
+	if !ok || info.Stale || (info.Sparse && value == nil) {
+		return core.IndexInfo{}, false
+	}
+	return info, true
+}
+
+// lookupSafe reports whether a filter value can be looked up in an index.
+// Arrays and objects are indexed element-wise or by encoding, so documents
+// equal to them may sit under other keys.
+func lookupSafe(value interface{}) bool {
+	return classOf(value) != classOther
+}
+
+// hashSafe reports whether a value can be looked up in a hash index, or in a
+// case-insensitive ordered index. These key timestamps by their text, while
+// filters compare them as instants, so a timestamp may equal values under
+// other keys.
+func hashSafe(value interface{}) bool {
+	return classOf(value) != classTime
+}
+
+// lookupOption looks up each of values in a single-field index
+func (e *Executor) lookupOption(collection string, info core.IndexInfo, access AccessPath, rank int, f *compiledFilter, values []interface{}) *option {
+	return &option{
+		rank: rank,
+		plan: Plan{
+			Access: access,
+			Index:  info.Name,
+			ids:    func() ([]core.DocumentID, error) { return e.unionLookup(collection, f.Field, values) },
+		},
+		used: []*compiledFilter{f},
+	}
+}
+
+// prefixOption scans an ordered index over the range of strings with the
+// filter's prefix
+func (e *Executor) prefixOption(collection string, infos []core.IndexInfo, f *compiledFilter) *option {
+	ranges, ok := e.indexes.(rangeLookup)
+	if !ok || !prefixRangeSafe(f.str) {
+		return nil
+	}
+	info, ok := findIndex(infos, f.Field, core.IndexOrdered)
+	if !ok || info.Stale || (f.CaseInsensitive && !info.CaseInsensitive) {
+		return nil
+	}
+
+	// A case-insensitive index compares lowercased keys, so the bounds must be lowercase too
+	prefix := f.str
+	if info.CaseInsensitive {
+		prefix = strings.ToLower(prefix)
+	}
+	return &option{
+		rank: rankOrderedPrefix,
+		plan: Plan{
+			Access: AccessOrdered,
+			Index:  info.Name,
+			ids: func() ([]core.DocumentID, error) {
+				ids, err := ranges.RangeIDs(collection, f.Field, prefix, prefixUpperBound(prefix), true, false)
+				if err != nil {
+					return nil, fmt.Errorf("failed to scan %s.%s: %w", collection, f.Field, err)
+				}
+				return ids, nil
+			},
+		},
+		used: []*compiledFilter{f},
+	}
+}
+
+// bound is one side of a numeric range
+type bound struct {
+	value     float64
+	inclusive bool
+	set       bool
+}
+
+// numericRange collects the range filters on one field
+type numericRange struct {
+	field    string
+	min, max bound
+	used     []*compiledFilter
+}
+
+// tighten narrows the range by a comparison filter with a numeric value
+func (r *numericRange) tighten(f *compiledFilter, value float64) {
+	switch f.Operator {
+	case core.OpGreaterThan, core.OpGreaterThanOrEqual:
+		inclusive := f.Operator == core.OpGreaterThanOrEqual
+		if !r.min.set || value > r.min.value || (value == r.min.value && !inclusive) {
+			r.min = bound{value: value, inclusive: inclusive, set: true}
+		}
+	case core.OpLessThan, core.OpLessThanOrEqual:
+		inclusive := f.Operator == core.OpLessThanOrEqual
+		if !r.max.set || value < r.max.value || (value == r.max.value && !inclusive) {
+			r.max = bound{value: value, inclusive: inclusive, set: true}
+		}
+	}
+	r.used = append(r.used, f)
+}
+
+// rangeOption scans an ordered index over the numeric range the comparison
+// filters on a field allow. Only numeric bounds are pushed down: ordered
+// indexes sort RFC3339 timestamps apart from other strings, which filters
+// compare as plain strings.
+func (e *Executor) rangeOption(collection string, infos []core.IndexInfo, filters []*compiledFilter) *option {
+	ranges, ok := e.indexes.(rangeLookup)
+	if !ok {
+		return nil
+	}
+
+	var fields []*numericRange
+	byField := make(map[string]*numericRange)
+	for _, f := range filters {
+		switch f.Operator {
+		case core.OpGreaterThan, core.OpGreaterThanOrEqual, core.OpLessThan, core.OpLessThanOrEqual:
+		default:
+			continue
+		}
+		value, ok := core.ToFloat64(f.Value)
+		if !ok || math.IsNaN(value) {
+			continue
+		}
+		if info, ok := findIndex(infos, f.Field, core.IndexOrdered); !ok || info.Stale {
+			continue
+		}
+
+		r, exists := byField[f.Field]
+		if !exists {
+			r = &numericRange{field: f.Field}
+			byField[f.Field] = r
+			fields = append(fields, r)
+		}
+		r.tighten(f, value)
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+
+	r := fields[0]
+	info, _ := findIndex(infos, r.field, core.IndexOrdered)
+	return &option{
+		rank: rankOrderedRange,
+		plan: Plan{
+			Access: AccessOrdered,
+			Index:  info.Name,
+			ids: func() ([]core.DocumentID, error) {
+				var min, max interface{}
+				if r.min.set {
+					min = r.min.value
+				}
+				if r.max.set {
+					max = r.max.value
+				}
+				ids, err := ranges.RangeIDs(collection, r.field, min, max, r.min.inclusive, r.max.inclusive)
+				if err != nil {
+					return nil, fmt.Errorf("failed to scan %s.%s: %w", collection, r.field, err)
+				}
+				return ids, nil
+			},
+		},
+		used: r.used,
+	}
+}
+
+// compositeOption looks up the longest run of leading fields of a composite
+// index that all have equality filters
+func (e *Executor) compositeOption(collection string, infos []core.IndexInfo, filters []*compiledFilter) *option {
+	composites, ok := e.indexes.(compositeLookup)
+	if !ok {
+		return nil
+	}
+
+	var best *option
+	bestLen := 0
+	for _, info := range infos {
+		if info.Kind != core.IndexComposite || info.Stale {
+			continue
+		}
+
+		var values []interface{}
+		var used []*compiledFilter
+		for _, field := range info.Fields {
+			f := equalityFilter(filters, field)
+			if f == nil {
+				break
+			}
+			values = append(values, f.Value)
+			used = append(used, f)
+		}
+		if len(values) <= bestLen {
+			continue
+		}
+
+		rank := rankCompositeMulti
+		if len(values) == 1 {
+			rank = rankCompositeSingle
+		}
+		name, fields := info.Name, info.Fields
+		bestLen = len(values)
+		best = &option{
+			rank: rank,
+			plan: Plan{
+				Access: AccessComposite,
+				Index:  info.Name,
+				ids: func() ([]core.DocumentID, error) {
+					ids, err := composites.LookupCompositeIDs(collection, fields, values)
+					if err != nil {
+						return nil, fmt.Errorf("failed to look up %s.%s: %w", collection, name, err)
+					}
+					return ids, nil
+				},
+			},
+			used: used,
+		}
+	}
+	return best
+}
+
+// equalityFilter returns the first equality filter on field with a value an
+// index can look up
+func equalityFilter(filters []*compiledFilter, field string) *compiledFilter {
+	for _, f := range filters {
+		if f.Field == field && f.Operator == core.OpEqual && lookupSafe(f.Value) {
+			return f
+		}
+	}
+	return nil
+}
+
+// prefixRangeSafe reports whether every string with the prefix lies in a
+// single range of an ordered index. Ordered indexes sort RFC3339 timestamps
+// apart from other strings, so a prefix that may begin a timestamp (one
+// starting with a digit) or an empty prefix is not pushed down.
+func prefixRangeSafe(prefix string) bool {
+	for _, r := range prefix {
+		return !unicode.IsDigit(r)
+	}
+	return false
+}
+
+// prefixUpperBound returns the smallest string greater than every string
+// starting with prefix, or nil when there is none
+func prefixUpperBound(prefix string) interface{} {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return nil
+}
+
+// findIndex returns the single-field index of the given kind on field
+func findIndex(infos []core.IndexInfo, field string, kind core.IndexKind) (core.IndexInfo, bool) {
+	for _, info := range infos {
+		if info.Kind == kind && len(info.Fields) == 1 && info.Fields[0] == field {
+			return info, true
+		}
+	}
+	return core.IndexInfo{}, false
+}
+
+// unionLookup returns the distinct IDs of documents matching any of values
+func (e *Executor) unionLookup(collection string, field string, values []interface{}) ([]core.DocumentID, error) {
+	seen := make(map[core.DocumentID]struct{})
+	var ids []core.DocumentID
+	for _, value := range values {
+		matches, err := e.indexes.LookupSecondaryIDs(collection, field, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up %s.%s: %w", collection, field, err)
+		}
+		for _, docID := range matches {
+			if _, dup := seen[docID]; !dup {
+				seen[docID] = struct{}{}
+				ids = append(ids, docID)
+			}
+		}
+	}
+	return ids, nil
+}
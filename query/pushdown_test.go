@@ -0,0 +1,282 @@
+package query
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// countingEngine counts collection scans and the documents they visit so
+// tests can tell whether an index was used and whether a scan stopped early
+type countingEngine struct {
+	*storage.FileStorageEngine
+	scans   int
+	visited int
+}
+
+func (c *countingEngine) ScanCollection(collection string, fn func(core.DocumentID, core.Document) bool) error {
+	c.scans++
+	return c.FileStorageEngine.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		c.visited++
+		return fn(docID, doc)
+	})
+}
+
+func setupIndexedExecutor(t *testing.T) (*Executor, *countingEngine, *index.FileIndexManager) {
+	_, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	counting := &countingEngine{FileStorageEngine: engine}
+	manager, err := index.NewFileIndexManager(counting, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := manager.CreateSecondaryIndex("people", "city", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	counting.scans, counting.visited = 0, 0
+	return NewExecutor(counting, manager), counting, manager
+}
+
+func TestInPushdownUsesHashIndex(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+
+	docs, err := executor.Execute(core.Query{
+		Collection: "people",
+		Filters: []core.Filter{
+			{Field: "city", Operator: core.OpIn, Value: []interface{}{"Paris", "Berlin", "Paris"}},
+			{Field: "active", Operator: core.OpEqual, Value: true},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p1", "p3", "p6"}) {
+		t.Errorf("Expected [p1 p3 p6], got %v", got)
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected the index to replace the scan, got %d scans", engine.scans)
+	}
+
+	// Results are copies, not the indexed documents themselves
+	docs[0]["name"] = "changed"
+	again, _ := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Berlin"}}}})
+	if again[0]["name"] != "Alice" {
+		t.Errorf("Expected indexed document to be unaffected by result changes")
+	}
+}
+
+func TestInPushdownFallsBackToScan(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+
+	// No index on the field
+	executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "name", Operator: core.OpIn, Value: []interface{}{"Bob"}}}})
+	if engine.scans != 1 {
+		t.Errorf("Expected a scan without an index, got %d", engine.scans)
+	}
+
+	// A stale index is not trusted
+	engine.WriteDocument("people", "p7", core.Document{"id": "p7", "city": "Paris"})
+	engine.scans = 0
+	docs, _ := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Paris"}}}})
+	if engine.scans != 1 {
+		t.Errorf("Expected a scan with a stale index, got %d", engine.scans)
+	}
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p2", "p6", "p7"}) {
+		t.Errorf("Expected [p2 p6 p7], got %v", got)
+	}
+}
+
+func TestInPushdownSkipsSparseIndexForNull(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+	manager.CreateIndexWithOptions("people", "city", core.IndexHash, index.IndexOptions{Sparse: true})
+	engine.scans = 0
+
+	docs, _ := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{nil}}}})
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p5"}) {
+		t.Errorf("Expected [p5], got %v", got)
+	}
+	if engine.scans != 1 {
+		t.Errorf("Expected a scan for null over a sparse index, got %d", engine.scans)
+	}
+}
+
+func TestPrefixPushdownUsesOrderedIndex(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+	manager.WriteIndexed("people", "p7", core.Document{"id": "p7", "name": "Carolina"})
+	manager.WriteIndexed("people", "p8", core.Document{"id": "p8", "name": "Car"})
+	manager.CreateSecondaryIndex("people", "name", core.IndexOrdered)
+	engine.scans = 0
+
+	docs, err := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "name", Operator: core.OpHasPrefix, Value: "Caro"}}})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p3", "p7"}) {
+		t.Errorf("Expected [p3 p7], got %v", got)
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected a range scan instead of a collection scan, got %d scans", engine.scans)
+	}
+
+	// A case-insensitive filter cannot use a case-sensitive index
+	docs, _ = executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "name", Operator: core.OpHasPrefix, Value: "caro", CaseInsensitive: true}}})
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p3", "p7"}) {
+		t.Errorf("Expected [p3 p7], got %v", got)
+	}
+	if engine.scans != 1 {
+		t.Errorf("Expected a collection scan, got %d scans", engine.scans)
+	}
+}
+
+func TestPrefixPushdownCaseInsensitiveIndex(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+	manager.WriteIndexed("people", "p7", core.Document{"id": "p7", "name": "ALIAS"})
+	manager.CreateIndexWithOptions("people", "name", core.IndexOrdered, index.IndexOptions{CaseInsensitive: true})
+	engine.scans = 0
+
+	tests := []struct {
+		filter   core.Filter
+		expected []string
+	}{
+		{core.Filter{Field: "name", Operator: core.OpHasPrefix, Value: "AL", CaseInsensitive: true}, []string{"p1", "p7"}},
+		{core.Filter{Field: "name", Operator: core.OpHasPrefix, Value: "AL"}, []string{"p7"}},
+		{core.Filter{Field: "name", Operator: core.OpHasPrefix, Value: "Al"}, []string{"p1"}},
+	}
+	for _, tt := range tests {
+		docs, _ := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{tt.filter}})
+		if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Prefix %v: expected %v, got %v", tt.filter.Value, tt.expected, got)
+		}
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected range scans only, got %d collection scans", engine.scans)
+	}
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		expected interface{}
+	}{
+		{"abc", "abd"},
+		{"a\xff", "b"},
+		{"\xff\xff", nil},
+	}
+	for _, tt := range tests {
+		if got := prefixUpperBound(tt.prefix); got != tt.expected {
+			t.Errorf("prefixUpperBound(%q) = %q, expected %q", tt.prefix, got, tt.expected)
+		}
+	}
+
+	if prefixRangeSafe("2024-") || prefixRangeSafe("") || !prefixRangeSafe("user_") {
+		t.Errorf("Unexpected prefixRangeSafe result")
+	}
+}
+
+func TestExecuteOneStopsAtFirstMatch(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+
+	docID, doc, err := executor.ExecuteOne(core.Query{Collection: "people"})
+	if err != nil {
+		t.Fatalf("ExecuteOne failed: %v", err)
+	}
+	if doc["id"] != string(docID) {
+		t.Errorf("Expected document %s, got %v", docID, doc)
+	}
+	if engine.visited != 1 {
+		t.Errorf("Expected the scan to stop after one document, visited %d", engine.visited)
+	}
+
+	// A sort needs every match, but still yields the first in sort order
+	engine.visited = 0
+	docID, _, err = executor.ExecuteOne(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}},
+		Sort:       &core.SortOption{Field: "age", Descending: true},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteOne failed: %v", err)
+	}
+	if docID != "p3" {
+		t.Errorf("Expected p3, got %s", docID)
+	}
+	if engine.visited != 6 {
+		t.Errorf("Expected a full scan with a sort, visited %d", engine.visited)
+	}
+}
+
+func TestExecuteOneNotFound(t *testing.T) {
+	executor, _, _ := setupIndexedExecutor(t)
+
+	_, _, err := executor.ExecuteOne(core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "Zed"}},
+	})
+	if !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestExecuteOneAndCountUseIndexes(t *testing.T) {
+	executor, engine, _ := setupIndexedExecutor(t)
+	inParis := []core.Filter{{Field: "city", Operator: core.OpIn, Value: []interface{}{"Paris"}}}
+
+	docID, _, err := executor.ExecuteOne(core.Query{Collection: "people", Filters: inParis, Sort: &core.SortOption{Field: "name", Descending: true}})
+	if err != nil {
+		t.Fatalf("ExecuteOne failed: %v", err)
+	}
+	if docID != "p6" {
+		t.Errorf("Expected p6, got %s", docID)
+	}
+
+	count, err := executor.ExecuteCount(core.Query{Collection: "people", Filters: inParis})
+	if err != nil {
+		t.Fatalf("ExecuteCount failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2, got %d", count)
+	}
+	if engine.scans != 0 {
+		t.Errorf("Expected the index to replace the scan, got %d scans", engine.scans)
+	}
+}
+
+func TestExecuteCount(t *testing.T) {
+	executor, _, _ := setupIndexedExecutor(t)
+	romeOrEve := core.Or(
+		core.Leaf(core.Filter{Field: "city", Operator: core.OpEqual, Value: "Rome"}),
+		core.Leaf(core.Filter{Field: "name", Operator: core.OpEqual, Value: "Eve"}),
+	)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected int
+	}{
+		{"all documents", core.Query{}, 6},
+		{"filtered", core.Query{Filters: []core.Filter{{Field: "age", Operator: core.OpEqual, Value: 25}}}, 2},
+		{"ignores offset and limit", core.Query{Limit: 1, Offset: 2, Filters: []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}}}, 3},
+		{"filter tree", core.Query{Where: &romeOrEve}, 2},
+		{"no matches", core.Query{Filters: []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "Zed"}}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Collection = "people"
+			count, err := executor.ExecuteCount(tt.query)
+			if err != nil {
+				t.Fatalf("ExecuteCount failed: %v", err)
+			}
+			if count != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func seedNames(t *testing.T, engine core.StorageEngine) {
+	docs := []core.Document{
+		{"id": "n1", "last_name": "Smith", "first_name": "Anna", "created_at": "2024-01-02T00:00:00Z"},
+		{"id": "n2", "last_name": "Smith", "first_name": "Anna", "created_at": "2024-03-01T00:00:00Z"},
+		{"id": "n3", "last_name": "Smith", "first_name": "Zoe", "created_at": "2024-02-01T00:00:00Z"},
+		{"id": "n4", "last_name": "Jones", "first_name": "Bob", "created_at": "2024-01-01T00:00:00Z"},
+		{"id": "n5", "last_name": "Jones", "first_name": 7},
+		{"id": "n6", "last_name": "Jones"},
+		{"id": "n7", "last_name": "Smith", "first_name": "Anna", "created_at": "2024-03-01T00:00:00Z"},
+	}
+	for _, doc := range docs {
+		if err := engine.WriteDocument("names", core.DocumentID(doc["id"].(string)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+}
+
+func TestMultiKeySort(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedNames(t, engine)
+
+	tests := []struct {
+		name     string
+		query    core.Query
+		expected []string
+	}{
+		{
+			"asc, asc, desc with ID tiebreak",
+			core.Query{SortBy: []core.SortOption{
+				{Field: "last_name"},
+				{Field: "first_name"},
+				{Field: "created_at", Descending: true},
+			}},
+			// Numbers sort before strings and missing values last; n2 and n7 tie on every key
+			[]string{"n5", "n4", "n6", "n2", "n7", "n1", "n3"},
+		},
+		{
+			"secondary key descending",
+			core.Query{SortBy: []core.SortOption{
+				{Field: "last_name", Descending: true},
+				{Field: "first_name", Descending: true},
+			}},
+			[]string{"n3", "n1", "n2", "n7", "n4", "n5", "n6"},
+		},
+		{
+			"single Sort still works",
+			core.Query{Sort: &core.SortOption{Field: "first_name", Descending: true}},
+			[]string{"n3", "n4", "n1", "n2", "n7", "n5", "n6"},
+		},
+		{
+			"Sort is the primary key before SortBy",
+			core.Query{
+				Sort:   &core.SortOption{Field: "last_name"},
+				SortBy: []core.SortOption{{Field: "created_at"}},
+			},
+			[]string{"n4", "n5", "n6", "n1", "n3", "n2", "n7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Collection = "names"
+			docs, err := executor.Execute(tt.query)
+			if err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+			if got := ids(docs); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMultiKeySortIsReproducible(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	for i := 0; i < 50; i++ {
+		doc := core.Document{"group": i % 3, "rank": i % 4}
+		engine.WriteDocument("ties", core.DocumentID(fmt.Sprintf("d%02d", i)), doc)
+	}
+
+	q := core.Query{Collection: "ties", SortBy: []core.SortOption{{Field: "group"}, {Field: "rank", Descending: true}}}
+	first, _ := executor.Execute(q)
+	for run := 0; run < 10; run++ {
+		again, _ := executor.Execute(q)
+		if !reflect.DeepEqual(first, again) {
+			t.Fatalf("Expected identical order on run %d", run)
+		}
+	}
+}
+
+func TestSortRejectsEmptyField(t *testing.T) {
+	executor, _ := setupTestExecutor(t)
+	if _, err := executor.Execute(core.Query{Collection: "names", SortBy: []core.SortOption{{}}}); err == nil {
+		t.Errorf("Expected error for a sort key without a field")
+	}
+}
@@ -0,0 +1,336 @@
+package query
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// spillFilePattern names the run files of an external sort. The .tmp suffix
+// makes files left behind by a crash show up as orphans in verification.
+const spillFilePattern = "_sort-*.tmp"
+
+// SetSortBudget bounds the memory a sorted ExecuteIter holds. Once the
+// documents it matches exceed budget bytes, estimated, only their sort keys
+// and IDs are kept, sorted in runs spilled to temporary files in dir and
+// merged, and each result is read again by ID as the cursor reaches it. A
+// budget of 0, the default, sorts in memory.
+func (e *Executor) SetSortBudget(budget int64, dir string) {
+	e.sortBudget = budget
+	e.spillDir = dir
+}
+
+// sortEntry is what an external sort keeps of a result: the values of its
+// sort fields, whether each was found, and its ID
+type sortEntry struct {
+	ID     core.DocumentID `json:"id"`
+	Values []interface{}   `json:"v"`
+	Found  []bool          `json:"f"`
+}
+
+// newSortEntry extracts the sort key of a result
+func newSortEntry(r result, keys []core.SortOption) sortEntry {
+	entry := sortEntry{ID: r.id, Values: make([]interface{}, len(keys)), Found: make([]bool, len(keys))}
+	for k, key := range keys {
+		entry.Values[k], entry.Found[k] = core.GetPath(r.doc, key.Field)
+	}
+	return entry
+}
+
+// lessEntry orders sort entries as lessResult orders their results
+func lessEntry(a, b sortEntry, keys []core.SortOption) bool {
+	for k := range keys {
+		if cmp := compareSortValues(a.Values[k], a.Found[k], b.Values[k], b.Found[k], &keys[k]); cmp != 0 {
+			return cmp < 0
+		}
+	}
+	return a.ID < b.ID
+}
+
+// valueSize estimates the memory a decoded JSON value holds
+func valueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(len(v)) + 16
+	case map[string]interface{}:
+		size := int64(48)
+		for key, element := range v {
+			size += int64(len(key)) + 16 + valueSize(element)
+		}
+		return size
+	case core.Document:
+		return valueSize(map[string]interface{}(v))
+	case []interface{}:
+		size := int64(24)
+		for _, element := range v {
+			size += valueSize(element)
+		}
+		return size
+	}
+	return 16
+}
+
+// externalSort sorts sort entries in runs of at most its budget, spilling
+// each run to a file, and merges the runs. Its files are removed by close.
+type externalSort struct {
+	dir    string
+	budget int64
+	keys   []core.SortOption
+
+	run  []sortEntry // Entries not yet spilled
+	size int64       // Estimated size of run
+
+	paths   []string // Spilled runs
+	files   []*os.File
+	decoder []*json.Decoder
+	heads   mergeHeap
+}
+
+// newExternalSort creates an external sort spilling to dir
+func newExternalSort(dir string, budget int64, keys []core.SortOption) *externalSort {
+	return &externalSort{dir: dir, budget: budget, keys: keys}
+}
+
+// add adds a result's entry, spilling the run once it exceeds the budget
+func (s *externalSort) add(r result) error {
+	entry := newSortEntry(r, s.keys)
+	s.run = append(s.run, entry)
+	s.size += int64(len(entry.ID)) + 64
+	for _, value := range entry.Values {
+		s.size += valueSize(value)
+	}
+	if s.size > s.budget {
+		return s.spill()
+	}
+	return nil
+}
+
+// spill sorts the run and writes it to a new file
+func (s *externalSort) spill() error {
+	if len(s.run) == 0 {
+		return nil
+	}
+	sort.Slice(s.run, func(i, j int) bool { return lessEntry(s.run[i], s.run[j], s.keys) })
+
+	f, err := os.CreateTemp(s.dir, spillFilePattern)
+	if err != nil {
+		return fmt.Errorf("failed to create sort run: %w", err)
+	}
+	s.paths = append(s.paths, f.Name())
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, entry := range s.run {
+		if err := enc.Encode(entry); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to write sort run: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write sort run: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write sort run: %w", err)
+	}
+
+	s.run, s.size = nil, 0
+	return nil
+}
+
+// finish spills the last run and opens every run for merging
+func (s *externalSort) finish() error {
+	if err := s.spill(); err != nil {
+		return err
+	}
+	for i, path := range s.paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open sort run: %w", err)
+		}
+		s.files = append(s.files, f)
+		s.decoder = append(s.decoder, json.NewDecoder(bufio.NewReader(f)))
+		if err := s.advance(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance pushes the next entry of a run onto the merge heap, if any
+func (s *externalSort) advance(run int) error {
+	var entry sortEntry
+	err := s.decoder[run].Decode(&entry)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read sort run: %w", err)
+	}
+	heap.Push(&s.heads, mergeItem{entry: entry, run: run, keys: s.keys})
+	return nil
+}
+
+// next returns the next entry in sort order, reporting false after the last
+func (s *externalSort) next() (sortEntry, bool, error) {
+	if s.heads.Len() == 0 {
+		return sortEntry{}, false, nil
+	}
+	item := heap.Pop(&s.heads).(mergeItem)
+	if err := s.advance(item.run); err != nil {
+		return sortEntry{}, false, err
+	}
+	return item.entry, true, nil
+}
+
+// close closes and removes the run files
+func (s *externalSort) close() error {
+	var errs []error
+	for _, f := range s.files {
+		f.Close()
+	}
+	for _, path := range s.paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("failed to remove sort run: %w", err))
+		}
+	}
+	s.run, s.paths, s.files, s.decoder, s.heads = nil, nil, nil, nil, nil
+	return errors.Join(errs...)
+}
+
+// mergeItem is the head entry of a run being merged
+type mergeItem struct {
+	entry sortEntry
+	run   int
+	keys  []core.SortOption
+}
+
+// mergeHeap orders the head entries of the runs, least first
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int           { return len(h) }
+func (h mergeHeap) Less(i, j int) bool { return lessEntry(h[i].entry, h[j].entry, h[i].keys) }
+func (h mergeHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)        { *h = append(*h, x.(mergeItem)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// sortIter runs a sorted query within the executor's sort budget. Matches
+// are held in memory until they exceed it, and then sorted externally.
+// Either the buffered results or an external sort is returned.
+func (e *Executor) sortIter(q core.Query) ([]result, *spillStream, error) {
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := sortKeys(q)
+	var results []result
+	var size int64
+	var sorter *externalSort
+	var spillErr error
+	err = e.scanMatches(q.Collection, compiled, func(docID core.DocumentID, doc core.Document) bool {
+		r := result{id: docID, doc: doc}
+		if sorter != nil {
+			spillErr = sorter.add(r)
+			return spillErr == nil
+		}
+
+		results = append(results, r)
+		if size += valueSize(doc); size <= e.sortBudget {
+			return true
+		}
+		// Over budget: keep only the sort keys from here on
+		sorter = newExternalSort(e.spillDir, e.sortBudget, keys)
+		for _, r := range results {
+			if spillErr = sorter.add(r); spillErr != nil {
+				return false
+			}
+		}
+		results = nil
+		return true
+	})
+	if err == nil {
+		err = spillErr
+	}
+	if err == nil && sorter != nil {
+		err = sorter.finish()
+	}
+	if err != nil {
+		if sorter != nil {
+			sorter.close()
+		}
+		return nil, nil, err
+	}
+
+	if sorter == nil {
+		sortResults(results, keys)
+		return window(results, q.Offset, q.Limit), nil, nil
+	}
+	return nil, &spillStream{e: e, collection: q.Collection, compiled: compiled, sorter: sorter, offset: q.Offset, limit: q.Limit}, nil
+}
+
+// spillStream yields the results of an external sort, reading each
+// document again by ID
+type spillStream struct {
+	e          *Executor
+	collection string
+	compiled   *compiledQuery
+	sorter     *externalSort
+	offset     int // Matches still to skip
+	limit      int
+	sent       int
+}
+
+// next returns the next result, reporting false after the last. Documents
+// deleted since the scan, or changed so that they no longer match, are
+// skipped; those changed and still matching are returned as they are now
+// but in the position of their earlier sort key.
+func (s *spillStream) next() (result, bool, error) {
+	for s.limit == 0 || s.sent < s.limit {
+		entry, ok, err := s.sorter.next()
+		if err != nil || !ok {
+			return result{}, false, err
+		}
+		doc, found, err := s.e.refetch(s.collection, entry.ID)
+		if err != nil {
+			return result{}, false, err
+		}
+		if !found || !s.compiled.match(entry.ID, doc) {
+			continue
+		}
+		if s.offset > 0 {
+			s.offset--
+			continue
+		}
+		s.sent++
+		return result{id: entry.ID, doc: doc}, true, nil
+	}
+	return result{}, false, nil
+}
+
+// refetch reads a document by ID through the primary index, or from storage
+// without one, reporting false if it does not exist
+func (e *Executor) refetch(collection string, docID core.DocumentID) (core.Document, bool, error) {
+	if e.indexes != nil {
+		doc, err := e.indexes.LookupPrimary(collection, docID)
+		switch {
+		case err == nil:
+			return doc.Clone(), true, nil
+		case errors.Is(err, core.ErrDocumentNotFound):
+			return nil, false, nil
+		}
+	}
+	return e.fetch(context.Background(), collection, docID, true, core.ReadOptions{})
+}
@@ -0,0 +1,209 @@
+package query
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// setupSpillingExecutor seeds n events and returns an executor with a low
+// sort budget, an executor sorting in memory and the spill directory
+func setupSpillingExecutor(t *testing.T, n int) (*Executor, *Executor, string) {
+	_, engine := setupTestExecutor(t)
+	rng := rand.New(rand.NewPCG(7, 7))
+	err := engine.ApplyBatch("events", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document, n)
+		for i := 0; i < n; i++ {
+			docID := core.DocumentID(fmt.Sprintf("e%05d", i))
+			doc := core.Document{"id": string(docID), "kind": []string{"click", "view", "buy"}[i%3], "payload": "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx"}
+			switch i % 10 {
+			case 0: // Missing timestamp
+			case 1:
+				doc["ts"] = core.Time(time.Unix(int64(rng.IntN(1000)), 0))
+			default:
+				doc["ts"] = float64(rng.IntN(1000))
+			}
+			writes[docID] = doc
+		}
+		return writes, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to seed events: %v", err)
+	}
+
+	manager, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	if err := manager.CreatePrimaryIndex("events"); err != nil {
+		t.Fatalf("Failed to create primary index: %v", err)
+	}
+
+	dir := t.TempDir()
+	spilling := NewExecutor(engine, manager)
+	spilling.SetSortBudget(4<<10, dir)
+	return spilling, NewExecutor(engine, manager), dir
+}
+
+// spillFiles returns the run files in dir
+func spillFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, spillFilePattern))
+	if err != nil {
+		t.Fatalf("Failed to list spill files: %v", err)
+	}
+	return files
+}
+
+func TestExternalSortMatchesInMemorySort(t *testing.T) {
+	spilling, inMemory, dir := setupSpillingExecutor(t, 3000)
+
+	queries := []core.Query{
+		{Sort: &core.SortOption{Field: "ts"}},
+		{Sort: &core.SortOption{Field: "ts", Descending: true, MissingFirst: true}},
+		{SortBy: []core.SortOption{{Field: "kind"}, {Field: "ts", Descending: true}}},
+		{Sort: &core.SortOption{Field: "ts"}, Offset: 100, Limit: 250},
+		{Filters: []core.Filter{{Field: "kind", Operator: core.OpEqual, Value: "buy"}}, Sort: &core.SortOption{Field: "ts"}, Offset: 10},
+		{Projection: []string{"ts"}, Sort: &core.SortOption{Field: "ts"}, Limit: 20},
+	}
+	for i, q := range queries {
+		q.Collection = "events"
+		docs, err := inMemory.Execute(q)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		cursor, err := spilling.ExecuteIter(q)
+		if err != nil {
+			t.Fatalf("ExecuteIter failed: %v", err)
+		}
+		if files := spillFiles(t, dir); len(files) < 2 {
+			t.Errorf("Query %d: expected the sort to spill several runs, got %d", i, len(files))
+		}
+		got := collect(t, cursor)
+		if !reflect.DeepEqual(got, ids(docs)) {
+			t.Errorf("Query %d: expected %d results in memory order, got %d differing", i, len(docs), len(got))
+		}
+		if files := spillFiles(t, dir); len(files) != 0 {
+			t.Errorf("Query %d: expected spill files removed at the end, got %v", i, files)
+		}
+		cursor.Close()
+	}
+}
+
+func TestExternalSortWithinBudgetStaysInMemory(t *testing.T) {
+	spilling, _, dir := setupSpillingExecutor(t, 300)
+
+	cursor, err := spilling.ExecuteIter(core.Query{
+		Collection: "events",
+		Filters:    []core.Filter{{Field: "id", Operator: core.OpIn, Value: []interface{}{"e00003", "e00001", "e00002"}}},
+		Sort:       &core.SortOption{Field: "id", Descending: true},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("Expected no spill files, got %v", files)
+	}
+	if got := collect(t, cursor); !reflect.DeepEqual(got, []string{"e00003", "e00002", "e00001"}) {
+		t.Errorf("Expected [e00003 e00002 e00001], got %v", got)
+	}
+}
+
+func TestExternalSortCleanup(t *testing.T) {
+	spilling, _, dir := setupSpillingExecutor(t, 2000)
+	q := core.Query{Collection: "events", Sort: &core.SortOption{Field: "ts"}}
+
+	t.Run("close", func(t *testing.T) {
+		cursor, err := spilling.ExecuteIter(q)
+		if err != nil {
+			t.Fatalf("ExecuteIter failed: %v", err)
+		}
+		for i := 0; i < 5 && cursor.Next(); i++ {
+		}
+		if err := cursor.Close(); err != nil {
+			t.Fatalf("Failed to close cursor: %v", err)
+		}
+		if files := spillFiles(t, dir); len(files) != 0 {
+			t.Errorf("Expected spill files removed by Close, got %v", files)
+		}
+		if cursor.Next() {
+			t.Errorf("Expected no results after Close")
+		}
+	})
+
+	t.Run("spill error", func(t *testing.T) {
+		failing, _, _ := setupSpillingExecutor(t, 2000)
+		failing.SetSortBudget(4<<10, filepath.Join(dir, "missing"))
+		if _, err := failing.ExecuteIter(q); err == nil {
+			t.Errorf("Expected an error spilling to a missing directory")
+		}
+	})
+}
+
+func TestExternalSortRereadsChangedDocuments(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	dir := t.TempDir()
+	executor.SetSortBudget(1, dir)
+
+	q := core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 0}},
+		Sort:       &core.SortOption{Field: "age"},
+	}
+	expected, err := executor.Execute(q)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	cursor, err := executor.ExecuteIter(q)
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	defer cursor.Close()
+
+	// A document deleted after the scan is skipped
+	last := core.DocumentID(expected[len(expected)-1]["id"].(string))
+	if err := engine.DeleteDocument("people", last); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	got := collect(t, cursor)
+	if want := ids(expected[:len(expected)-1]); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestExternalSortCleanupOnReadError(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	dir := t.TempDir()
+	executor.SetSortBudget(1, dir)
+
+	cursor, err := executor.ExecuteIter(core.Query{Collection: "people", Sort: &core.SortOption{Field: "name"}})
+	if err != nil {
+		t.Fatalf("ExecuteIter failed: %v", err)
+	}
+	defer cursor.Close()
+	if !cursor.Next() {
+		t.Fatalf("Expected a first result, got %v", cursor.Err())
+	}
+
+	// Documents are read again as the cursor reaches them, so this fails
+	// the next one
+	engine.Close()
+	if cursor.Next() {
+		t.Errorf("Expected no result from a closed engine")
+	}
+	if cursor.Err() == nil {
+		t.Errorf("Expected an error reading from a closed engine")
+	}
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("Expected spill files removed after the error, got %v", files)
+	}
+}
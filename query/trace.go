@@ -0,0 +1,80 @@
+package query
+
+import (
+	"context"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the executor's spans
+const tracerName = "github.com/HakashiKatake/Go-Json-Database/query"
+
+// contextStorage is implemented by storage engines whose reads can be traced
+// as children of a query's span (FileStorageEngine does)
+type contextStorage interface {
+	ReadDocumentContext(ctx context.Context, collection string, docID core.DocumentID) (core.Document, error)
+	ScanCollectionContext(ctx context.Context, collection string, fn func(core.DocumentID, core.Document) bool) error
+}
+
+// cachedStorage is implemented by storage engines that can serve reads from
+// a cache as a query's read options prefer (FileStorageEngine does)
+type cachedStorage interface {
+	ReadDocumentWith(collection string, docID core.DocumentID, opts core.ReadOptions) (core.Document, error)
+	ScanCollectionWith(collection string, opts core.ReadOptions, fn func(core.DocumentID, core.Document) bool) error
+}
+
+// SetTracerProvider records ExecuteContext as spans of tracers from tp. A nil
+// tp traces nothing.
+func (e *Executor) SetTracerProvider(tp trace.TracerProvider) {
+	e.tracer = nil
+	if tp != nil {
+		e.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan starts the span of a query run through a plan; the executor must
+// have a tracer
+func (e *Executor) startSpan(ctx context.Context, collection string, p *Plan) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String(core.AttrCollection, collection),
+		attribute.String("db.access", p.Access.String()),
+	}
+	if p.Index != "" {
+		attrs = append(attrs, attribute.String(core.AttrIndex, p.Index))
+	}
+	return e.tracer.Start(ctx, "query.Execute", trace.WithAttributes(attrs...))
+}
+
+// recordPlan records the outcome of a plan on its query's span
+func recordPlan(span trace.Span, p *Plan, returned int) {
+	span.SetAttributes(
+		attribute.Int("db.documents_examined", p.examined),
+		attribute.Int(core.AttrDocuments, returned),
+	)
+}
+
+// readDocument reads a document, from the storage engine's cache if read
+// prefers and the engine has one, or else within ctx if the executor traces
+// and the storage engine allows
+func (e *Executor) readDocument(ctx context.Context, collection string, docID core.DocumentID, read core.ReadOptions) (core.Document, error) {
+	if cs, ok := e.storage.(cachedStorage); ok && read.Preference == core.ReadCached {
+		return cs.ReadDocumentWith(collection, docID, read)
+	}
+	if cs, ok := e.storage.(contextStorage); ok && e.tracer != nil {
+		return cs.ReadDocumentContext(ctx, collection, docID)
+	}
+	return e.storage.ReadDocument(collection, docID)
+}
+
+// scanCollection scans a collection like readDocument reads a document
+func (e *Executor) scanCollection(ctx context.Context, collection string, read core.ReadOptions, fn func(core.DocumentID, core.Document) bool) error {
+	if cs, ok := e.storage.(cachedStorage); ok && read.Preference == core.ReadCached {
+		return cs.ScanCollectionWith(collection, read, fn)
+	}
+	if cs, ok := e.storage.(contextStorage); ok && e.tracer != nil {
+		return cs.ScanCollectionContext(ctx, collection, fn)
+	}
+	return e.storage.ScanCollection(collection, fn)
+}
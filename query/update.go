@@ -0,0 +1,87 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// UpdateOptions control UpdateMany
+type UpdateOptions struct {
+	Limit  int  // Maximum number of documents to modify; 0 means no limit
+	DryRun bool // Count the documents that would be modified without writing
+}
+
+// UpdateMany applies a JSON merge patch to every document matching the query
+// and returns the number of documents modified. Documents the patch leaves
+// unchanged are not written or counted. Matches are taken in the query's sort
+// order, so Sort, Offset and Limit select which documents are eligible.
+//
+// The query is evaluated and the writes applied as one batch while the
+// collection is locked, so concurrent writers cannot interleave.
+func (e *Executor) UpdateMany(q core.Query, update core.Document, opts UpdateOptions) (int, error) {
+	if opts.Limit < 0 {
+		return 0, fmt.Errorf("invalid update limit: %d", opts.Limit)
+	}
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return 0, err
+	}
+
+	modified := 0
+	err = e.applyBatch(q.Collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		modified = 0
+		writes := make(map[core.DocumentID]core.Document)
+		for _, r := range selectMatches(q, compiled, docs) {
+			if opts.Limit > 0 && modified == opts.Limit {
+				break
+			}
+
+			patched := r.doc.MergePatch(update)
+			if sameDocument(r.doc, patched) {
+				continue
+			}
+			modified++
+			writes[r.id] = patched
+		}
+
+		if opts.DryRun {
+			return nil, nil
+		}
+		return writes, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return modified, nil
+}
+
+// applyBatch applies a batch of writes through the index manager when it
+// supports batches, or else through storage followed by index updates
+func (e *Executor) applyBatch(collection string, fn core.BatchFunc) error {
+	return index.WriteBatch(context.Background(), e.storage, e.indexes, collection, fn)
+}
+
+// selectMatches evaluates a query against a set of documents, returning the
+// matches sorted and windowed as Execute would
+func selectMatches(q core.Query, compiled *compiledQuery, docs map[core.DocumentID]core.Document) []result {
+	var results []result
+	for docID, doc := range docs {
+		if compiled.match(docID, doc) {
+			results = append(results, result{id: docID, doc: doc})
+		}
+	}
+	sortResults(results, sortKeys(q))
+	return window(results, q.Offset, q.Limit)
+}
+
+// sameDocument reports whether two documents have the same JSON encoding, so
+// that numbers of different Go types holding the same value compare equal
+func sameDocument(a, b core.Document) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(dataA) == string(dataB)
+}
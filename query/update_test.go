@@ -0,0 +1,133 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestUpdateMany(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	q := core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Paris"}}}
+	modified, err := executor.UpdateMany(q, core.Document{"city": "Lyon", "moved": true}, UpdateOptions{})
+	if err != nil {
+		t.Fatalf("UpdateMany failed: %v", err)
+	}
+	if modified != 2 {
+		t.Errorf("Expected 2 documents modified, got %d", modified)
+	}
+
+	docs, _ := executor.Execute(core.Query{Collection: "people", Filters: []core.Filter{{Field: "moved", Operator: core.OpEqual, Value: true}}})
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p2", "p6"}) {
+		t.Errorf("Expected [p2 p6] moved, got %v", got)
+	}
+	if docs[0]["city"] != "Lyon" || docs[0]["name"] != "Bob" {
+		t.Errorf("Expected patch merged into the document, got %v", docs[0])
+	}
+
+	// Documents the patch does not change are not counted
+	all := core.Query{Collection: "people"}
+	modified, _ = executor.UpdateMany(all, core.Document{"moved": true}, UpdateOptions{})
+	if modified != 4 {
+		t.Errorf("Expected only the 4 unmoved documents modified, got %d", modified)
+	}
+	modified, _ = executor.UpdateMany(all, core.Document{"moved": true}, UpdateOptions{})
+	if modified != 0 {
+		t.Errorf("Expected no documents modified, got %d", modified)
+	}
+}
+
+func TestUpdateManyLimitAndDryRun(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+	revision, _ := engine.CollectionRevision("people")
+
+	active := core.Query{
+		Collection: "people",
+		Filters:    []core.Filter{{Field: "active", Operator: core.OpEqual, Value: true}},
+		Sort:       &core.SortOption{Field: "name", Descending: true},
+	}
+
+	modified, err := executor.UpdateMany(active, core.Document{"active": false}, UpdateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("UpdateMany failed: %v", err)
+	}
+	if modified != 3 {
+		t.Errorf("Expected a dry run to count 3 documents, got %d", modified)
+	}
+	if after, _ := engine.CollectionRevision("people"); after != revision {
+		t.Errorf("Expected a dry run not to write, revision went from %d to %d", revision, after)
+	}
+
+	// The limit applies in sort order
+	modified, _ = executor.UpdateMany(active, core.Document{"active": false}, UpdateOptions{Limit: 2})
+	if modified != 2 {
+		t.Errorf("Expected 2 documents modified, got %d", modified)
+	}
+	docs, _ := executor.Execute(active)
+	if got := ids(docs); !reflect.DeepEqual(got, []string{"p1"}) {
+		t.Errorf("Expected only p1 still active, got %v", got)
+	}
+
+	if _, err := executor.UpdateMany(active, core.Document{}, UpdateOptions{Limit: -1}); err == nil {
+		t.Errorf("Expected error for a negative limit")
+	}
+}
+
+func TestUpdateManyUpdatesIndexes(t *testing.T) {
+	executor, engine, manager := setupIndexedExecutor(t)
+
+	q := core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Berlin"}}}
+	if _, err := executor.UpdateMany(q, core.Document{"city": "Hamburg"}, UpdateOptions{}); err != nil {
+		t.Fatalf("UpdateMany failed: %v", err)
+	}
+
+	ids, _ := manager.LookupSecondaryIDs("people", "city", "Hamburg")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"p1", "p3"}) {
+		t.Errorf("Expected [p1 p3] indexed under Hamburg, got %v", ids)
+	}
+	if ids, _ := manager.LookupSecondaryIDs("people", "city", "Berlin"); len(ids) != 0 {
+		t.Errorf("Expected no documents indexed under Berlin, got %v", ids)
+	}
+
+	// The index stays fresh, so the planner keeps using it
+	engine.scans = 0
+	hamburg := core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Hamburg"}}}
+	docs, _ := executor.Execute(hamburg)
+	if len(docs) != 2 || engine.scans != 0 {
+		t.Errorf("Expected 2 documents through the index, got %d with %d scans", len(docs), engine.scans)
+	}
+}
+
+func TestUpdateManyConcurrentPatchesAreNotLost(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	for i := 0; i < 20; i++ {
+		engine.WriteDocument("items", core.DocumentID(fmt.Sprintf("i%02d", i)), core.Document{"n": i})
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(field string) {
+			defer wg.Done()
+			if _, err := executor.UpdateMany(core.Query{Collection: "items"}, core.Document{field: true}, UpdateOptions{}); err != nil {
+				t.Errorf("UpdateMany failed: %v", err)
+			}
+		}(fmt.Sprintf("f%d", i))
+	}
+	wg.Wait()
+
+	complete := core.Query{Collection: "items"}
+	for i := 0; i < 8; i++ {
+		complete.Filters = append(complete.Filters, core.Filter{Field: fmt.Sprintf("f%d", i), Operator: core.OpEqual, Value: true})
+	}
+	count, _ := executor.ExecuteCount(complete)
+	if count != 20 {
+		t.Errorf("Expected every patch on every document, got %d complete documents", count)
+	}
+}
@@ -0,0 +1,76 @@
+package query
+
+import (
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// UpsertOne merges doc, as a JSON merge patch, into the first document
+// matching the query, or inserts it when nothing matches. It reports the ID
+// written and whether an insert happened. When several documents match, the
+// first in the query's sort order is updated; without a sort that is the
+// lowest document ID.
+//
+// An inserted document is seeded with the values of the query's top-level
+// equality filters, so an upsert keyed on email=x creates a document with
+// that email. Its ID comes from an equality filter on core.DocumentIDField if
+// there is one, and from idGen otherwise.
+//
+// The match and the write happen as one batch while the collection is
+// locked, so concurrent upserts for the same key cannot both insert.
+func (e *Executor) UpsertOne(q core.Query, doc core.Document, idGen func() core.DocumentID) (core.DocumentID, bool, error) {
+	compiled, err := validateQuery(q)
+	if err != nil {
+		return "", false, err
+	}
+
+	var docID core.DocumentID
+	var inserted bool
+	err = e.applyBatch(q.Collection, func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		if matches := selectMatches(q, compiled, docs); len(matches) > 0 {
+			docID, inserted = matches[0].id, false
+			return map[core.DocumentID]core.Document{docID: matches[0].doc.MergePatch(doc)}, nil
+		}
+
+		seed, id := upsertSeed(q.Filters)
+		if id == "" {
+			if idGen == nil {
+				return nil, fmt.Errorf("no document matches and no ID generator was given")
+			}
+			id = idGen()
+		}
+		if _, exists := docs[id]; exists {
+			return nil, fmt.Errorf("cannot insert %s: a document with that ID already exists", id)
+		}
+
+		docID, inserted = id, true
+		return map[core.DocumentID]core.Document{docID: seed.MergePatch(doc)}, nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return docID, inserted, nil
+}
+
+// upsertSeed returns the fields set by top-level equality filters and the
+// document ID fixed by an equality filter on core.DocumentIDField, if any
+func upsertSeed(filters []core.Filter) (core.Document, core.DocumentID) {
+	seed := core.Document{}
+	var docID core.DocumentID
+	for _, f := range filters {
+		if f.Operator != core.OpEqual {
+			continue
+		}
+		if f.Field == core.DocumentIDField {
+			if id, ok := f.Value.(string); ok {
+				docID = core.DocumentID(id)
+			}
+			continue
+		}
+		if segments := core.SplitPath(f.Field); len(segments) == 1 {
+			seed[segments[0]] = f.Value
+		}
+	}
+	return seed, docID
+}
@@ -0,0 +1,132 @@
+package query
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+// sequentialIDs returns an ID generator producing prefix1, prefix2, ...
+func sequentialIDs(prefix string) func() core.DocumentID {
+	var n int64
+	return func() core.DocumentID {
+		return core.DocumentID(fmt.Sprintf("%s%d", prefix, atomic.AddInt64(&n, 1)))
+	}
+}
+
+func TestUpsertOne(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	byEmail := core.Query{Collection: "users", Filters: []core.Filter{{Field: "email", Operator: core.OpEqual, Value: "a@example.com"}}}
+	gen := sequentialIDs("u")
+
+	docID, inserted, err := executor.UpsertOne(byEmail, core.Document{"name": "Alice", "visits": 1}, gen)
+	if err != nil {
+		t.Fatalf("UpsertOne failed: %v", err)
+	}
+	if !inserted || docID != "u1" {
+		t.Errorf("Expected insert of u1, got %s (inserted %v)", docID, inserted)
+	}
+
+	// The inserted document carries the key it was looked up by
+	doc, _ := engine.ReadDocument("users", "u1")
+	if doc["email"] != "a@example.com" || doc["name"] != "Alice" {
+		t.Errorf("Expected seeded document, got %v", doc)
+	}
+
+	docID, inserted, err = executor.UpsertOne(byEmail, core.Document{"visits": 2}, gen)
+	if err != nil {
+		t.Fatalf("UpsertOne failed: %v", err)
+	}
+	if inserted || docID != "u1" {
+		t.Errorf("Expected update of u1, got %s (inserted %v)", docID, inserted)
+	}
+	doc, _ = engine.ReadDocument("users", "u1")
+	if doc["name"] != "Alice" || doc["visits"] != float64(2) {
+		t.Errorf("Expected merged update, got %v", doc)
+	}
+}
+
+func TestUpsertOneUpdatesFirstMatch(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	paris := core.Query{Collection: "people", Filters: []core.Filter{{Field: "city", Operator: core.OpEqual, Value: "Paris"}}}
+	docID, _, _ := executor.UpsertOne(paris, core.Document{"seen": true}, nil)
+	if docID != "p2" {
+		t.Errorf("Expected the lowest ID p2 to be updated, got %s", docID)
+	}
+
+	paris.Sort = &core.SortOption{Field: "name", Descending: true}
+	docID, _, _ = executor.UpsertOne(paris, core.Document{"seen": true}, nil)
+	if docID != "p6" {
+		t.Errorf("Expected the first in sort order p6 to be updated, got %s", docID)
+	}
+}
+
+func TestUpsertOneInsertIDs(t *testing.T) {
+	executor, engine := setupTestExecutor(t)
+	seedPeople(t, engine)
+
+	byID := core.Query{Collection: "people", Filters: []core.Filter{{Field: core.DocumentIDField, Operator: core.OpEqual, Value: "p9"}}}
+	docID, inserted, err := executor.UpsertOne(byID, core.Document{"name": "Ivy"}, nil)
+	if err != nil || !inserted || docID != "p9" {
+		t.Errorf("Expected insert of p9 from the ID filter, got %s (inserted %v, %v)", docID, inserted, err)
+	}
+
+	nobody := core.Query{Collection: "people", Filters: []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "Nobody"}}}
+	if _, _, err := executor.UpsertOne(nobody, core.Document{}, nil); err == nil {
+		t.Errorf("Expected error inserting without an ID generator")
+	}
+	if _, _, err := executor.UpsertOne(nobody, core.Document{}, func() core.DocumentID { return "p1" }); err == nil {
+		t.Errorf("Expected error inserting over an existing ID")
+	}
+}
+
+func TestUpsertOneRacingUpsertsInsertOnce(t *testing.T) {
+	for _, unique := range []bool{false, true} {
+		t.Run(fmt.Sprintf("unique index %v", unique), func(t *testing.T) {
+			executor, engine := setupTestExecutor(t)
+			if unique {
+				manager, err := index.NewFileIndexManager(engine, t.TempDir())
+				if err != nil {
+					t.Fatalf("Failed to create index manager: %v", err)
+				}
+				if err := manager.CreateUniqueIndex("users", "email"); err != nil {
+					t.Fatalf("Failed to create unique index: %v", err)
+				}
+				executor = NewExecutor(engine, manager)
+			}
+
+			byEmail := core.Query{Collection: "users", Filters: []core.Filter{{Field: "email", Operator: core.OpEqual, Value: "race@example.com"}}}
+			gen := sequentialIDs("u")
+
+			var inserts int64
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, inserted, err := executor.UpsertOne(byEmail, core.Document{"touched": true}, gen)
+					if err != nil {
+						t.Errorf("UpsertOne failed: %v", err)
+					}
+					if inserted {
+						atomic.AddInt64(&inserts, 1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if inserts != 1 {
+				t.Errorf("Expected exactly one insert, got %d", inserts)
+			}
+			if count, _ := executor.ExecuteCount(byEmail); count != 1 {
+				t.Errorf("Expected exactly one document, got %d", count)
+			}
+		})
+	}
+}
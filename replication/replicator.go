@@ -0,0 +1,337 @@
+package replication
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// Primary is the engine being replicated. FileStorageEngine satisfies it once
+// its oplog is enabled.
+type Primary interface {
+	core.StorageEngine
+
+	// ReadOplog returns up to limit entries recorded after afterSeq
+	ReadOplog(afterSeq uint64, limit int) ([]storage.OplogEntry, error)
+
+	// LastOplogSeq returns the sequence number of the most recent entry
+	LastOplogSeq() (uint64, error)
+}
+
+// Options configures a Replicator
+type Options struct {
+	// StateFile is where the last applied sequence is persisted. Required.
+	StateFile string
+
+	// BatchSize caps the number of oplog entries applied per round (default 256)
+	BatchSize int
+
+	// PollInterval is how long Start waits between rounds when caught up (default 100ms)
+	PollInterval time.Duration
+}
+
+// Stats reports replication progress
+type Stats struct {
+	LastAppliedSeq  uint64    `json:"last_applied_seq"`
+	PrimarySeq      uint64    `json:"primary_seq"`
+	Lag             uint64    `json:"lag"`
+	InitialSyncDone bool      `json:"initial_sync_done"`
+	FullSyncs       int       `json:"full_syncs"`
+	AppliedOps      uint64    `json:"applied_ops"`
+	LastAppliedAt   time.Time `json:"last_applied_at"`
+	LastError       string    `json:"last_error,omitempty"`
+	Running         bool      `json:"running"`
+}
+
+// replicationState is the durable part of a Replicator
+type replicationState struct {
+	LastAppliedSeq  uint64 `json:"last_applied_seq"`
+	InitialSyncDone bool   `json:"initial_sync_done"`
+}
+
+// Replicator copies changes from a primary engine to a read-only replica.
+// It performs a full sync on first run (or when the oplog has been trimmed past
+// its position) and then tails the primary's oplog.
+type Replicator struct {
+	primary Primary
+	replica core.StorageEngine
+	opts    Options
+
+	mu    sync.Mutex // Serializes sync rounds and guards state/stats
+	state replicationState
+	stats Stats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReplicator creates a replicator, resuming from the state file if it exists
+func NewReplicator(primary Primary, replica core.StorageEngine, opts Options) (*Replicator, error) {
+	if opts.StateFile == "" {
+		return nil, errors.New("replication: state file is required")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 100 * time.Millisecond
+	}
+
+	r := &Replicator{
+		primary: primary,
+		replica: replica,
+		opts:    opts,
+	}
+
+	data, err := os.ReadFile(opts.StateFile)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &r.state); err != nil {
+			return nil, fmt.Errorf("replication: failed to parse state file: %w", err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("replication: failed to read state file: %w", err)
+	}
+
+	return r, nil
+}
+
+// Start runs the replicator in the background until Stop is called
+func (r *Replicator) Start() {
+	r.mu.Lock()
+	if r.stop != nil {
+		r.mu.Unlock()
+		return
+	}
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	r.stats.Running = true
+	stop, done := r.stop, r.done
+	r.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		for {
+			applied, _ := r.SyncOnce()
+
+			// Keep draining while there is a backlog
+			if applied > 0 {
+				select {
+				case <-stop:
+					return
+				default:
+					continue
+				}
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(r.opts.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop halts the background loop and waits for the current round to finish
+func (r *Replicator) Stop() {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop, r.done = nil, nil
+	r.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+
+	r.mu.Lock()
+	r.stats.Running = false
+	r.mu.Unlock()
+}
+
+// SyncOnce performs one replication round: a full sync if required, otherwise
+// applying at most one batch of oplog entries. It returns the number of
+// operations applied.
+func (r *Replicator) SyncOnce() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	applied, err := r.syncOnce()
+	if err != nil {
+		r.stats.LastError = err.Error()
+	} else {
+		r.stats.LastError = ""
+	}
+	return applied, err
+}
+
+func (r *Replicator) syncOnce() (int, error) {
+	if !r.state.InitialSyncDone {
+		return 0, r.fullSync()
+	}
+
+	entries, err := r.primary.ReadOplog(r.state.LastAppliedSeq, r.opts.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("replication: failed to read oplog: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	// The oplog was trimmed past our position, so tailing would skip changes
+	if entries[0].Seq != r.state.LastAppliedSeq+1 {
+		return 0, r.fullSync()
+	}
+
+	for _, entry := range entries {
+		if err := r.apply(entry); err != nil {
+			return 0, err
+		}
+		r.state.LastAppliedSeq = entry.Seq
+	}
+
+	if err := r.saveState(); err != nil {
+		return 0, err
+	}
+
+	r.stats.AppliedOps += uint64(len(entries))
+	r.stats.LastAppliedAt = time.Now()
+	return len(entries), nil
+}
+
+// apply replays a single oplog entry onto the replica. Writes and deletes are
+// idempotent, so re-applying entries after a crash is harmless.
+func (r *Replicator) apply(entry storage.OplogEntry) error {
+	var err error
+	switch entry.Op {
+	case core.OpInsert, core.OpUpdate:
+		err = r.replica.WriteDocument(entry.Collection, entry.DocID, entry.Document)
+	case core.OpDelete:
+		err = r.replica.DeleteDocument(entry.Collection, entry.DocID)
+		if errors.Is(err, core.ErrDocumentNotFound) {
+			err = nil
+		}
+	default:
+		err = fmt.Errorf("unknown operation type %d", entry.Op)
+	}
+	if err != nil {
+		return fmt.Errorf("replication: failed to apply seq %d: %w", entry.Seq, err)
+	}
+	return nil
+}
+
+// fullSync copies every collection from the primary and removes replica
+// documents the primary no longer has. The oplog position is captured before
+// copying so that changes made during the copy are re-applied by tailing.
+func (r *Replicator) fullSync() error {
+	startSeq, err := r.primary.LastOplogSeq()
+	if err != nil {
+		return fmt.Errorf("replication: failed to read primary position: %w", err)
+	}
+
+	collections, err := r.primary.ListCollections()
+	if err != nil {
+		return fmt.Errorf("replication: failed to list collections: %w", err)
+	}
+
+	for _, collection := range collections {
+		if err := r.syncCollection(collection); err != nil {
+			return err
+		}
+	}
+
+	r.state.LastAppliedSeq = startSeq
+	r.state.InitialSyncDone = true
+	if err := r.saveState(); err != nil {
+		return err
+	}
+
+	r.stats.FullSyncs++
+	r.stats.LastAppliedAt = time.Now()
+	return nil
+}
+
+// syncCollection makes one replica collection match the primary
+func (r *Replicator) syncCollection(collection string) error {
+	docs := make(map[core.DocumentID]core.Document)
+	if err := r.primary.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		docs[docID] = doc
+		return true
+	}); err != nil {
+		return fmt.Errorf("replication: failed to scan %s: %w", collection, err)
+	}
+
+	var stale []core.DocumentID
+	if err := r.replica.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		if _, ok := docs[docID]; !ok {
+			stale = append(stale, docID)
+		}
+		return true
+	}); err != nil {
+		return fmt.Errorf("replication: failed to scan replica %s: %w", collection, err)
+	}
+
+	for _, docID := range stale {
+		if err := r.replica.DeleteDocument(collection, docID); err != nil {
+			return fmt.Errorf("replication: failed to delete %s/%s: %w", collection, docID, err)
+		}
+	}
+
+	for docID, doc := range docs {
+		if err := r.replica.WriteDocument(collection, docID, doc); err != nil {
+			return fmt.Errorf("replication: failed to copy %s/%s: %w", collection, docID, err)
+		}
+	}
+
+	return nil
+}
+
+// saveState persists the replication position atomically
+func (r *Replicator) saveState() error {
+	data, err := json.Marshal(r.state)
+	if err != nil {
+		return fmt.Errorf("replication: failed to marshal state: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.opts.StateFile), 0755); err != nil {
+		return fmt.Errorf("replication: failed to create state directory: %w", err)
+	}
+
+	tempPath := r.opts.StateFile + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("replication: failed to write state: %w", err)
+	}
+	if err := os.Rename(tempPath, r.opts.StateFile); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("replication: failed to write state: %w", err)
+	}
+
+	return nil
+}
+
+// Stats returns a snapshot of replication progress, including the lag behind the primary
+func (r *Replicator) Stats() Stats {
+	r.mu.Lock()
+	stats := r.stats
+	stats.LastAppliedSeq = r.state.LastAppliedSeq
+	stats.InitialSyncDone = r.state.InitialSyncDone
+	r.mu.Unlock()
+
+	if seq, err := r.primary.LastOplogSeq(); err == nil {
+		stats.PrimarySeq = seq
+		if seq > stats.LastAppliedSeq {
+			stats.Lag = seq - stats.LastAppliedSeq
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,237 @@
+package replication
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func setupEngines(t *testing.T) (*storage.FileStorageEngine, *storage.FileStorageEngine, string) {
+	tempDir, err := os.MkdirTemp("", "replication_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	primary, err := storage.NewFileStorageEngine(filepath.Join(tempDir, "primary"))
+	if err != nil {
+		t.Fatalf("Failed to create primary: %v", err)
+	}
+	if err := primary.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+
+	replica, err := storage.NewFileStorageEngine(filepath.Join(tempDir, "replica"))
+	if err != nil {
+		t.Fatalf("Failed to create replica: %v", err)
+	}
+
+	t.Cleanup(func() {
+		primary.Close()
+		replica.Close()
+		os.RemoveAll(tempDir)
+	})
+
+	return primary, replica, tempDir
+}
+
+// writeMixedOps performs n random writes and deletes against the primary
+func writeMixedOps(t *testing.T, engine *storage.FileStorageEngine, rng *rand.Rand, n int) {
+	collections := []string{"users", "orders", "events"}
+	for i := 0; i < n; i++ {
+		collection := collections[rng.Intn(len(collections))]
+		docID := core.DocumentID(fmt.Sprintf("doc_%d", rng.Intn(50)))
+
+		var err error
+		if rng.Intn(4) == 0 {
+			if err = engine.DeleteDocument(collection, docID); errors.Is(err, core.ErrDocumentNotFound) {
+				err = nil
+			}
+		} else {
+			err = engine.WriteDocument(collection, docID, core.Document{
+				"value": rng.Intn(1000),
+				"label": fmt.Sprintf("label_%d", i),
+			})
+		}
+		if err != nil {
+			t.Fatalf("Failed to apply op %d: %v", i, err)
+		}
+	}
+}
+
+// collectionBytes serializes a collection's documents deterministically
+func collectionBytes(t *testing.T, engine core.StorageEngine, collection string) []byte {
+	docs := make(map[core.DocumentID]core.Document)
+	if err := engine.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		docs[docID] = doc
+		return true
+	}); err != nil {
+		t.Fatalf("Failed to scan %s: %v", collection, err)
+	}
+
+	data, err := json.Marshal(docs)
+	if err != nil {
+		t.Fatalf("Failed to marshal %s: %v", collection, err)
+	}
+	return data
+}
+
+func assertReplicaMatches(t *testing.T, primary, replica core.StorageEngine) {
+	t.Helper()
+
+	collections, err := primary.ListCollections()
+	if err != nil {
+		t.Fatalf("Failed to list collections: %v", err)
+	}
+
+	for _, collection := range collections {
+		expected := collectionBytes(t, primary, collection)
+		actual := collectionBytes(t, replica, collection)
+		if !bytes.Equal(expected, actual) {
+			t.Errorf("Collection %s differs between primary and replica", collection)
+		}
+	}
+}
+
+// drain runs sync rounds until the replicator has nothing left to apply
+func drain(t *testing.T, r *Replicator) {
+	for i := 0; i < 1000; i++ {
+		applied, err := r.SyncOnce()
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if applied == 0 && r.Stats().Lag == 0 {
+			return
+		}
+	}
+	t.Fatalf("Replicator did not catch up")
+}
+
+func TestNewReplicatorRequiresStateFile(t *testing.T) {
+	primary, replica, _ := setupEngines(t)
+
+	if _, err := NewReplicator(primary, replica, Options{}); err == nil {
+		t.Errorf("Expected error without a state file")
+	}
+}
+
+func TestReplicatorInitialSyncThenTail(t *testing.T) {
+	primary, replica, tempDir := setupEngines(t)
+	rng := rand.New(rand.NewSource(1))
+
+	// Data written before the replicator exists is copied by the full sync
+	writeMixedOps(t, primary, rng, 200)
+	primary.TrimOplog(150)
+
+	r, err := NewReplicator(primary, replica, Options{StateFile: filepath.Join(tempDir, "repl.state")})
+	if err != nil {
+		t.Fatalf("Failed to create replicator: %v", err)
+	}
+
+	drain(t, r)
+	assertReplicaMatches(t, primary, replica)
+
+	if stats := r.Stats(); stats.FullSyncs != 1 || !stats.InitialSyncDone {
+		t.Errorf("Expected exactly one full sync, got %+v", stats)
+	}
+
+	// Subsequent changes are tailed from the oplog
+	writeMixedOps(t, primary, rng, 800)
+	if stats := r.Stats(); stats.Lag == 0 {
+		t.Errorf("Expected lag after new writes, got %+v", stats)
+	}
+
+	drain(t, r)
+	assertReplicaMatches(t, primary, replica)
+
+	if stats := r.Stats(); stats.FullSyncs != 1 || stats.AppliedOps == 0 {
+		t.Errorf("Expected tailing without another full sync, got %+v", stats)
+	}
+}
+
+func TestReplicatorResumesAfterRestart(t *testing.T) {
+	primary, replica, tempDir := setupEngines(t)
+	rng := rand.New(rand.NewSource(2))
+	stateFile := filepath.Join(tempDir, "repl.state")
+
+	r, err := NewReplicator(primary, replica, Options{StateFile: stateFile, BatchSize: 50})
+	if err != nil {
+		t.Fatalf("Failed to create replicator: %v", err)
+	}
+	if _, err := r.SyncOnce(); err != nil {
+		t.Fatalf("Initial sync failed: %v", err)
+	}
+
+	writeMixedOps(t, primary, rng, 1000)
+
+	// Apply a few batches, then "kill" the replicator mid-stream
+	for i := 0; i < 5; i++ {
+		if _, err := r.SyncOnce(); err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+	}
+	position := r.Stats().LastAppliedSeq
+	if position != 250 {
+		t.Fatalf("Expected to stop at seq 250, got %d", position)
+	}
+
+	// A new replicator resumes from the persisted position
+	r, err = NewReplicator(primary, replica, Options{StateFile: stateFile, BatchSize: 50})
+	if err != nil {
+		t.Fatalf("Failed to recreate replicator: %v", err)
+	}
+	primarySeq, _ := primary.LastOplogSeq()
+	if stats := r.Stats(); stats.LastAppliedSeq != position || stats.Lag != primarySeq-position {
+		t.Errorf("Expected resume at %d with lag %d, got %+v", position, primarySeq-position, stats)
+	}
+
+	drain(t, r)
+	assertReplicaMatches(t, primary, replica)
+
+	if stats := r.Stats(); stats.FullSyncs != 0 {
+		t.Errorf("Expected resume without a full sync, got %+v", stats)
+	}
+}
+
+func TestReplicatorBackgroundLoop(t *testing.T) {
+	primary, replica, tempDir := setupEngines(t)
+	rng := rand.New(rand.NewSource(3))
+
+	r, err := NewReplicator(primary, replica, Options{
+		StateFile:    filepath.Join(tempDir, "repl.state"),
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create replicator: %v", err)
+	}
+
+	r.Start()
+	writeMixedOps(t, primary, rng, 300)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := r.Stats()
+		if stats.InitialSyncDone && stats.Lag == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Replicator did not catch up: %+v", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	r.Stop()
+	if r.Stats().Running {
+		t.Errorf("Expected replicator to be stopped")
+	}
+
+	assertReplicaMatches(t, primary, replica)
+}
@@ -0,0 +1,331 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// DefaultInferDepth is how deep an Inferrer descends into nested objects
+// and arrays unless told otherwise
+const DefaultInferDepth = 8
+
+// maxExamples is the number of distinct example values kept per field
+const maxExamples = 3
+
+// String formats detected by inference, named as in JSON Schema
+const (
+	FormatDateTime = "date-time"
+	FormatUUID     = "uuid"
+	FormatEmail    = "email"
+)
+
+// formatPatterns are the patterns a draft schema requires of strings that
+// all had a format
+var formatPatterns = map[string]string{
+	FormatDateTime: `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`,
+	FormatUUID:     `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+	FormatEmail:    `^[^@\s]+@[^@\s]+\.[^@\s]+$`,
+}
+
+var (
+	uuidPattern  = regexp.MustCompile(formatPatterns[FormatUUID])
+	emailPattern = regexp.MustCompile(formatPatterns[FormatEmail])
+)
+
+// Report is the structure inferred from a collection's documents
+type Report struct {
+	Collection string        `json:"collection"`
+	Documents  int           `json:"documents"` // Documents inferred from
+	Total      int           `json:"total"`     // Documents in the collection
+	Fields     []FieldReport `json:"fields"`    // By path
+}
+
+// FieldReport describes the values found at a field path. Paths join keys
+// with dots, and the elements of an array at path are at path[].
+type FieldReport struct {
+	Path string `json:"path"`
+	// Types counts the values of each JSON type, whole numbers counting as
+	// integers
+	Types map[string]int `json:"types"`
+	// Presence is the percentage of documents holding the field
+	Presence float64       `json:"presence"`
+	Examples []interface{} `json:"examples,omitempty"` // Distinct scalar values
+	Min      *float64      `json:"min,omitempty"`
+	Max      *float64      `json:"max,omitempty"`
+	// Formats counts the strings of each detected format
+	Formats map[string]int `json:"formats,omitempty"`
+	// Truncated is set when the field's objects or arrays were not
+	// descended into, being deeper than the limit
+	Truncated bool `json:"truncated,omitempty"`
+
+	docs    int // Documents holding the field
+	lastDoc int // Last document counted in docs
+}
+
+// Inferrer accumulates the structure of documents for a Report
+type Inferrer struct {
+	maxDepth int
+	docs     int
+	fields   map[string]*FieldReport
+}
+
+// NewInferrer creates an Inferrer that descends maxDepth levels of nested
+// objects and arrays, or DefaultInferDepth if maxDepth is not positive
+func NewInferrer(maxDepth int) *Inferrer {
+	if maxDepth <= 0 {
+		maxDepth = DefaultInferDepth
+	}
+	return &Inferrer{maxDepth: maxDepth, fields: make(map[string]*FieldReport)}
+}
+
+// Add records the fields of a document
+func (in *Inferrer) Add(doc core.Document) {
+	in.docs++
+	in.addObject(normalize(map[string]interface{}(doc)).(map[string]interface{}), "", 1)
+}
+
+// addObject records the fields of an object at a path and depth
+func (in *Inferrer) addObject(obj map[string]interface{}, path string, depth int) {
+	for key, value := range obj {
+		in.addValue(value, joinPath(path, key), depth)
+	}
+}
+
+// addValue records a value found at a path
+func (in *Inferrer) addValue(value interface{}, path string, depth int) {
+	f, ok := in.fields[path]
+	if !ok {
+		f = &FieldReport{Path: path, Types: make(map[string]int)}
+		in.fields[path] = f
+	}
+	if f.lastDoc != in.docs {
+		f.docs++
+		f.lastDoc = in.docs
+	}
+	f.Types[typeOf(value)]++
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if depth >= in.maxDepth {
+			f.Truncated = true
+			return
+		}
+		in.addObject(v, path, depth+1)
+	case []interface{}:
+		if depth >= in.maxDepth {
+			f.Truncated = true
+			return
+		}
+		for _, element := range v {
+			in.addValue(element, path+"[]", depth+1)
+		}
+	case float64:
+		if f.Min == nil || v < *f.Min {
+			f.Min = &v
+		}
+		if f.Max == nil || v > *f.Max {
+			f.Max = &v
+		}
+		f.example(v)
+	case string:
+		if format := detectFormat(v); format != "" {
+			if f.Formats == nil {
+				f.Formats = make(map[string]int)
+			}
+			f.Formats[format]++
+		}
+		f.example(v)
+	case bool:
+		f.example(v)
+	}
+}
+
+// values returns the number of values found, counting each array element
+func (f *FieldReport) values() int {
+	n := 0
+	for _, count := range f.Types {
+		n += count
+	}
+	return n
+}
+
+// example keeps a value as an example if there is room and it is new
+func (f *FieldReport) example(value interface{}) {
+	if len(f.Examples) >= maxExamples {
+		return
+	}
+	for _, seen := range f.Examples {
+		if seen == value {
+			return
+		}
+	}
+	f.Examples = append(f.Examples, value)
+}
+
+// sortedExamples returns examples sorted by their JSON encoding, so reports
+// do not depend on the order documents were added in
+func sortedExamples(examples []interface{}) []interface{} {
+	if examples == nil {
+		return nil
+	}
+	keys := make(map[interface{}]string, len(examples))
+	for _, example := range examples {
+		data, _ := json.Marshal(example)
+		keys[example] = string(data)
+	}
+	sorted := append([]interface{}(nil), examples...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return keys[sorted[i]] < keys[sorted[j]]
+	})
+	return sorted
+}
+
+// detectFormat returns the format of a string, or "" if it has none
+func detectFormat(s string) string {
+	switch {
+	case len(s) >= 20 && s[4] == '-' && isDateTime(s):
+		return FormatDateTime
+	case len(s) == 36 && uuidPattern.MatchString(s):
+		return FormatUUID
+	case emailPattern.MatchString(s):
+		return FormatEmail
+	}
+	return ""
+}
+
+// isDateTime reports whether a string is an RFC 3339 timestamp
+func isDateTime(s string) bool {
+	_, err := time.Parse(time.RFC3339Nano, s)
+	return err == nil
+}
+
+// Report returns the structure of the documents added so far. collection
+// and total are reported as given.
+func (in *Inferrer) Report(collection string, total int) Report {
+	report := Report{Collection: collection, Documents: in.docs, Total: total, Fields: make([]FieldReport, 0, len(in.fields))}
+	for _, f := range in.fields {
+		field := *f
+		field.Examples = sortedExamples(f.Examples)
+		if in.docs > 0 {
+			field.Presence = float64(f.docs) * 100 / float64(in.docs)
+		}
+		report.Fields = append(report.Fields, field)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool {
+		return report.Fields[i].Path < report.Fields[j].Path
+	})
+	return report
+}
+
+// Draft returns a JSON Schema describing the reported documents, to review
+// and pass to SetSchema. Fields found in every object holding them are
+// required, a field holding several types allows each, and strings that
+// all had one format must match its pattern.
+func (r Report) Draft() ([]byte, error) {
+	fields := make(map[string]*FieldReport, len(r.Fields))
+	for i := range r.Fields {
+		fields[r.Fields[i].Path] = &r.Fields[i]
+	}
+	root := map[string]interface{}{"type": "object"}
+	if props, required := draftProperties(fields, "", r.Documents); len(props) > 0 {
+		root["properties"] = props
+		if len(required) > 0 {
+			root["required"] = required
+		}
+	}
+
+	data, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	if _, err := Compile(data, Lenient); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// draftProperties returns the schemas of the fields directly under a path
+// whose objects numbered objects, and the fields every one of them held
+func draftProperties(fields map[string]*FieldReport, path string, objects int) (map[string]interface{}, []string) {
+	props := make(map[string]interface{})
+	var required []string
+	for p, f := range fields {
+		if name, ok := childName(path, p); ok {
+			props[name] = draftField(fields, f)
+			if f.values() == objects && objects > 0 {
+				required = append(required, name)
+			}
+		}
+	}
+	sort.Strings(required)
+	return props, required
+}
+
+// childName returns the key of a field path directly under an object path
+func childName(parent, path string) (string, bool) {
+	prefix := ""
+	if parent != "" {
+		prefix = parent + "."
+	}
+	if len(path) <= len(prefix) || path[:len(prefix)] != prefix {
+		return "", false
+	}
+	name := path[len(prefix):]
+	if containsSeparator(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// containsSeparator reports whether a key is a path of several keys
+func containsSeparator(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '.' || name[i] == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+// draftField returns the schema of one field
+func draftField(fields map[string]*FieldReport, f *FieldReport) map[string]interface{} {
+	s := make(map[string]interface{})
+	types := make([]string, 0, len(f.Types))
+	for t := range f.Types {
+		if t == "integer" && f.Types["number"] > 0 {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	if len(types) == 1 {
+		s["type"] = types[0]
+	} else {
+		s["type"] = types
+	}
+
+	if f.Types["string"] > 0 && len(f.Formats) == 1 {
+		for format, n := range f.Formats {
+			if n == f.Types["string"] {
+				s["pattern"] = formatPatterns[format]
+			}
+		}
+	}
+	if objects := f.Types["object"]; objects > 0 && !f.Truncated {
+		if props, required := draftProperties(fields, f.Path, objects); len(props) > 0 {
+			s["properties"] = props
+			if len(required) > 0 {
+				s["required"] = required
+			}
+		}
+	}
+	if items, ok := fields[f.Path+"[]"]; ok {
+		s["items"] = draftField(fields, items)
+	}
+	return s
+}
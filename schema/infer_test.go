@@ -0,0 +1,148 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// inferDocs are documents of an organically grown collection
+var inferDocs = []core.Document{
+	{"name": "Ada", "age": 36, "email": "ada@example.com", "joined": "2020-01-02T03:04:05Z",
+		"address": map[string]interface{}{"city": "London", "zip": "N1"},
+		"orders":  []interface{}{map[string]interface{}{"id": "3f2504e0-4f89-11d3-9a0c-0305e82c3301", "total": 9.5}}},
+	{"name": "Grace", "age": 85, "email": "grace@example.com", "joined": "2021-06-07T08:09:10.5+02:00",
+		"address": map[string]interface{}{"city": "New York"},
+		"orders":  []interface{}{}},
+	{"name": "Alan", "age": "unknown", "email": nil, "tags": []interface{}{"a", "b"},
+		"orders": []interface{}{map[string]interface{}{"id": "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "total": 20}}},
+}
+
+// field returns the report of a path, failing if there is none
+func field(t *testing.T, report Report, path string) FieldReport {
+	t.Helper()
+	for _, f := range report.Fields {
+		if f.Path == path {
+			return f
+		}
+	}
+	t.Fatalf("Expected a report for %s", path)
+	return FieldReport{}
+}
+
+func TestInfer(t *testing.T) {
+	in := NewInferrer(0)
+	for _, doc := range inferDocs {
+		in.Add(doc)
+	}
+	report := in.Report("users", 10)
+	if report.Collection != "users" || report.Documents != 3 || report.Total != 10 {
+		t.Errorf("Expected 3 of 10 users documents, got %+v", report)
+	}
+
+	tests := []struct {
+		path     string
+		types    map[string]int
+		presence float64
+		formats  map[string]int
+	}{
+		{"name", map[string]int{"string": 3}, 100, nil},
+		{"age", map[string]int{"integer": 2, "string": 1}, 100, nil},
+		{"email", map[string]int{"string": 2, "null": 1}, 100, map[string]int{FormatEmail: 2}},
+		{"joined", map[string]int{"string": 2}, 200.0 / 3, map[string]int{FormatDateTime: 2}},
+		{"address.city", map[string]int{"string": 2}, 200.0 / 3, nil},
+		{"address.zip", map[string]int{"string": 1}, 100.0 / 3, nil},
+		{"orders", map[string]int{"array": 3}, 100, nil},
+		{"orders[]", map[string]int{"object": 2}, 200.0 / 3, nil},
+		{"orders[].id", map[string]int{"string": 2}, 200.0 / 3, map[string]int{FormatUUID: 2}},
+		{"orders[].total", map[string]int{"number": 1, "integer": 1}, 200.0 / 3, nil},
+		{"tags[]", map[string]int{"string": 2}, 100.0 / 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			f := field(t, report, tt.path)
+			if !reflect.DeepEqual(f.Types, tt.types) {
+				t.Errorf("Expected types %v, got %v", tt.types, f.Types)
+			}
+			if f.Presence != tt.presence {
+				t.Errorf("Expected presence %v, got %v", tt.presence, f.Presence)
+			}
+			if !reflect.DeepEqual(f.Formats, tt.formats) {
+				t.Errorf("Expected formats %v, got %v", tt.formats, f.Formats)
+			}
+		})
+	}
+
+	age := field(t, report, "age")
+	if *age.Min != 36 || *age.Max != 85 || !reflect.DeepEqual(age.Examples, []interface{}{"unknown", 36.0, 85.0}) {
+		t.Errorf("Expected ages 36 to 85 with examples, got %v to %v, %v", *age.Min, *age.Max, age.Examples)
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("Failed to marshal report: %v", err)
+	}
+}
+
+func TestInferDepth(t *testing.T) {
+	in := NewInferrer(2)
+	in.Add(core.Document{"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}}, "l": []interface{}{[]interface{}{1}}})
+	report := in.Report("deep", 1)
+
+	paths := make([]string, 0, len(report.Fields))
+	for _, f := range report.Fields {
+		paths = append(paths, f.Path)
+	}
+	if expected := []string{"a", "a.b", "l", "l[]"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected paths %v, got %v", expected, paths)
+	}
+	if !field(t, report, "a.b").Truncated || field(t, report, "a").Truncated {
+		t.Errorf("Expected only a.b truncated")
+	}
+}
+
+func TestInferDraft(t *testing.T) {
+	in := NewInferrer(0)
+	for _, doc := range inferDocs {
+		in.Add(doc)
+	}
+	data, err := in.Report("users", 3).Draft()
+	if err != nil {
+		t.Fatalf("Failed to draft schema: %v", err)
+	}
+	s, err := Compile(data, Lenient)
+	if err != nil {
+		t.Fatalf("Failed to compile draft: %v", err)
+	}
+
+	// The documents inferred from satisfy the draft
+	for _, doc := range inferDocs {
+		if violations := s.Validate(doc); len(violations) > 0 {
+			t.Errorf("Expected %v to satisfy the draft, got %v", doc["name"], violations)
+		}
+	}
+
+	// Fields present everywhere are required, and formats give patterns
+	tests := []struct {
+		name string
+		doc  core.Document
+	}{
+		{"missing name", core.Document{"age": 1, "email": nil, "orders": []interface{}{}}},
+		{"malformed date", core.Document{"name": "x", "age": 1, "email": nil, "orders": []interface{}{}, "joined": "yesterday"}},
+		{"order without id", core.Document{"name": "x", "age": 1, "email": nil, "orders": []interface{}{map[string]interface{}{"total": 1}}}},
+		{"wrong type", core.Document{"name": "x", "age": true, "email": nil, "orders": []interface{}{}}},
+	}
+	for _, tt := range tests {
+		if violations := s.Validate(tt.doc); len(violations) == 0 {
+			t.Errorf("Expected the draft to reject a document with %s", tt.name)
+		}
+	}
+
+	// The draft is the same from a report that went through JSON
+	var decoded Report
+	encoded, _ := json.Marshal(in.Report("users", 3))
+	json.Unmarshal(encoded, &decoded)
+	if again, err := decoded.Draft(); err != nil || string(again) != string(data) {
+		t.Errorf("Expected the same draft from a decoded report, got %s, %v", again, err)
+	}
+}
@@ -0,0 +1,231 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Mode controls whether objects accept properties their schema does not
+// declare when the schema has no additionalProperties keyword
+type Mode int
+
+const (
+	// Lenient allows undeclared properties
+	Lenient Mode = iota
+	// Strict rejects undeclared properties
+	Strict
+)
+
+// modeNames maps modes to their encoded names
+var modeNames = map[Mode]string{
+	Lenient: "lenient",
+	Strict:  "strict",
+}
+
+// String returns the mode's name
+func (m Mode) String() string {
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// MarshalText encodes the mode as its name
+func (m Mode) MarshalText() ([]byte, error) {
+	name, ok := modeNames[m]
+	if !ok {
+		return nil, fmt.Errorf("unknown schema mode: %d", int(m))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes a mode from its name
+func (m *Mode) UnmarshalText(text []byte) error {
+	for mode, name := range modeNames {
+		if name == string(text) {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown schema mode: %s", text)
+}
+
+// jsonTypes are the type names a schema may use
+var jsonTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// ignoredKeywords are annotations that do not affect validation
+var ignoredKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true,
+}
+
+// Schema is a compiled JSON Schema. It supports the draft 7 keywords type,
+// required, properties, additionalProperties, enum, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, pattern and items.
+type Schema struct {
+	types      []string
+	required   []string
+	properties map[string]*Schema
+	additional *Schema // Schema for undeclared properties; nil allows any
+	closed     bool    // Undeclared properties are rejected
+	enum       []interface{}
+	minimum    *float64
+	maximum    *float64
+	exclMin    *float64
+	exclMax    *float64
+	pattern    *regexp.Regexp
+	items      *Schema
+}
+
+// rawSchema is the JSON form of a schema
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Required             []string                   `json:"required"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Enum                 []interface{}              `json:"enum"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+	Pattern              *string                    `json:"pattern"`
+	Items                json.RawMessage            `json:"items"`
+}
+
+// knownKeywords are the keywords Compile understands
+var knownKeywords = map[string]bool{
+	"type": true, "required": true, "properties": true, "additionalProperties": true,
+	"enum": true, "minimum": true, "maximum": true, "exclusiveMinimum": true,
+	"exclusiveMaximum": true, "pattern": true, "items": true,
+}
+
+// Compile parses a JSON Schema. Keywords outside the supported subset are
+// rejected rather than silently ignored, except for annotations such as title
+// and description.
+func Compile(data []byte, mode Mode) (*Schema, error) {
+	s, err := compile(data, mode, "")
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return s, nil
+}
+
+// compile parses the schema at a path within the root schema
+func compile(data []byte, mode Mode, path string) (*Schema, error) {
+	var keywords map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keywords); err != nil {
+		return nil, fmt.Errorf("%s: schema must be an object", displayPath(path))
+	}
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !knownKeywords[name] && !ignoredKeywords[name] {
+			return nil, fmt.Errorf("%s: unsupported keyword %q", displayPath(path), name)
+		}
+	}
+
+	var raw rawSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", displayPath(path), err)
+	}
+
+	s := &Schema{
+		required: raw.Required,
+		enum:     raw.Enum,
+		minimum:  raw.Minimum,
+		maximum:  raw.Maximum,
+		exclMin:  raw.ExclusiveMinimum,
+		exclMax:  raw.ExclusiveMaximum,
+		closed:   mode == Strict,
+	}
+
+	if len(raw.Type) > 0 {
+		if err := s.parseType(raw.Type, path); err != nil {
+			return nil, err
+		}
+	}
+
+	if raw.Pattern != nil {
+		re, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern: %w", displayPath(path), err)
+		}
+		s.pattern = re
+	}
+
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*Schema, len(raw.Properties))
+		for name, data := range raw.Properties {
+			sub, err := compile(data, mode, joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = sub
+		}
+	}
+
+	switch trimmed := bytes.TrimSpace(raw.AdditionalProperties); {
+	case len(trimmed) == 0:
+	case bytes.Equal(trimmed, []byte("true")):
+		s.closed = false
+	case bytes.Equal(trimmed, []byte("false")):
+		s.closed = true
+	default:
+		sub, err := compile(trimmed, mode, joinPath(path, "*"))
+		if err != nil {
+			return nil, err
+		}
+		s.closed, s.additional = false, sub
+	}
+
+	if len(raw.Items) > 0 {
+		sub, err := compile(raw.Items, mode, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		s.items = sub
+	}
+	return s, nil
+}
+
+// parseType reads a type keyword holding a name or a list of names
+func (s *Schema) parseType(data json.RawMessage, path string) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		s.types = []string{name}
+	} else if err := json.Unmarshal(data, &s.types); err != nil {
+		return fmt.Errorf("%s: type must be a string or an array of strings", displayPath(path))
+	}
+
+	for _, t := range s.types {
+		if !jsonTypes[t] {
+			return fmt.Errorf("%s: unknown type %q", displayPath(path), t)
+		}
+	}
+	return nil
+}
+
+// joinPath appends a property name to a dotted path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// displayPath names the document root for messages
+func displayPath(path string) string {
+	if path == "" {
+		return "(root)"
+	}
+	return path
+}
@@ -0,0 +1,168 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+const userSchema = `{
+	"title": "user",
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {
+		"name": {"type": "string", "pattern": "^[A-Z]"},
+		"age": {"type": "integer", "minimum": 0, "exclusiveMaximum": 150},
+		"role": {"enum": ["admin", "member"]},
+		"tags": {"type": "array", "items": {"type": "string"}},
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}}
+		}
+	}
+}`
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		errMsg string
+	}{
+		{"valid", userSchema, ""},
+		{"not an object", `[1, 2]`, "schema must be an object"},
+		{"unsupported keyword", `{"properties": {"a": {"oneOf": []}}}`, `a: unsupported keyword "oneOf"`},
+		{"unknown type", `{"type": "decimal"}`, `unknown type "decimal"`},
+		{"type list", `{"type": ["string", "null"]}`, ""},
+		{"bad pattern", `{"pattern": "("}`, "invalid pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]byte(tt.schema), Lenient)
+			if tt.errMsg == "" {
+				if err != nil {
+					t.Fatalf("Failed to compile schema: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     Mode
+		doc      core.Document
+		expected []string // path:rule of each violation
+	}{
+		{
+			name: "valid",
+			doc:  core.Document{"name": "Ada", "age": 36, "tags": []string{"math"}},
+		},
+		{
+			name:     "missing required",
+			doc:      core.Document{"name": "Ada"},
+			expected: []string{"age:required"},
+		},
+		{
+			name:     "wrong types",
+			doc:      core.Document{"name": 7, "age": 36.5},
+			expected: []string{"age:type", "name:type"},
+		},
+		{
+			name:     "bounds pattern and enum",
+			doc:      core.Document{"name": "ada", "age": 150, "role": "owner"},
+			expected: []string{"age:exclusiveMaximum", "name:pattern", "role:enum"},
+		},
+		{
+			name:     "array items",
+			doc:      core.Document{"name": "Ada", "age": 1, "tags": []interface{}{"ok", 2}},
+			expected: []string{"tags[1]:type"},
+		},
+		{
+			name: "lenient allows extra properties",
+			doc:  core.Document{"name": "Ada", "age": 1, "extra": true, "address": map[string]interface{}{"zip": "N1"}},
+		},
+		{
+			name:     "strict rejects extra properties",
+			mode:     Strict,
+			doc:      core.Document{"name": "Ada", "age": 1, "extra": true, "address": map[string]interface{}{"zip": "N1"}},
+			expected: []string{"address.zip:additionalProperties", "extra:additionalProperties"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Compile([]byte(userSchema), tt.mode)
+			if err != nil {
+				t.Fatalf("Failed to compile schema: %v", err)
+			}
+
+			var got []string
+			for _, v := range s.Validate(tt.doc) {
+				got = append(got, v.Path+":"+v.Rule)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected violations %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAdditionalPropertiesOverridesMode(t *testing.T) {
+	open, _ := Compile([]byte(`{"properties": {"a": {}}, "additionalProperties": true}`), Strict)
+	if v := open.Validate(core.Document{"b": 1}); len(v) != 0 {
+		t.Errorf("Expected no violations, got %v", v)
+	}
+
+	typed, _ := Compile([]byte(`{"additionalProperties": {"type": "number"}}`), Strict)
+	if v := typed.Validate(core.Document{"a": 1, "b": "x"}); len(v) != 1 || v[0].Path != "b" {
+		t.Errorf("Expected one violation at b, got %v", v)
+	}
+
+	closed, _ := Compile([]byte(`{"additionalProperties": false}`), Lenient)
+	if v := closed.Validate(core.Document{"a": 1}); len(v) != 1 || v[0].Rule != "additionalProperties" {
+		t.Errorf("Expected one additionalProperties violation, got %v", v)
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	err := error(&ValidationError{
+		Collection: "users",
+		DocID:      "u1",
+		Violations: []Violation{{Path: "", Rule: "type", Message: "expected object, got array"}, {Path: "age", Rule: "required", Message: "required property is missing"}},
+	})
+
+	if !errors.Is(err, ErrSchemaValidation) {
+		t.Errorf("Expected error to match ErrSchemaValidation")
+	}
+	expected := "schema validation failed for users/u1: (root): expected object, got array; age: required property is missing"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestModeText(t *testing.T) {
+	for _, mode := range []Mode{Lenient, Strict} {
+		text, err := mode.MarshalText()
+		if err != nil {
+			t.Fatalf("Failed to marshal mode: %v", err)
+		}
+		var decoded Mode
+		if err := decoded.UnmarshalText(text); err != nil || decoded != mode {
+			t.Errorf("Expected %v, got %v (%v)", mode, decoded, err)
+		}
+	}
+
+	var m Mode
+	if err := m.UnmarshalText([]byte("loose")); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+}
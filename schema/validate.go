@@ -0,0 +1,215 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrSchemaValidation is wrapped by every ValidationError
+var ErrSchemaValidation = errors.New("schema validation failed")
+
+// Violation is one rule a document breaks
+type Violation struct {
+	Path    string `json:"path"`    // Dotted path of the offending value, empty for the document itself
+	Rule    string `json:"rule"`    // Schema keyword that failed
+	Message string `json:"message"` // Human-readable detail
+}
+
+// String formats the violation as "path: message"
+func (v Violation) String() string {
+	return displayPath(v.Path) + ": " + v.Message
+}
+
+// ValidationError reports every violation of a document that failed
+// validation. It matches ErrSchemaValidation with errors.Is.
+type ValidationError struct {
+	Collection string
+	DocID      core.DocumentID
+	Violations []Violation
+}
+
+// Error lists the violations
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return fmt.Sprintf("%s for %s/%s: %s", ErrSchemaValidation, e.Collection, e.DocID, strings.Join(messages, "; "))
+}
+
+// Unwrap returns ErrSchemaValidation
+func (e *ValidationError) Unwrap() error {
+	return ErrSchemaValidation
+}
+
+// Validate returns every violation of the schema by a document, ordered by
+// path. A valid document has none.
+func (s *Schema) Validate(doc core.Document) []Violation {
+	var violations []Violation
+	s.validate(normalize(map[string]interface{}(doc)), "", &violations)
+	sort.SliceStable(violations, func(i, j int) bool {
+		return violations[i].Path < violations[j].Path
+	})
+	return violations
+}
+
+// validate checks a normalized value against the schema
+func (s *Schema) validate(value interface{}, path string, out *[]Violation) {
+	add := func(rule, format string, args ...interface{}) {
+		*out = append(*out, Violation{Path: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !s.matchesType(value) {
+		add("type", "expected %s, got %s", strings.Join(s.types, " or "), typeOf(value))
+		return
+	}
+
+	if len(s.enum) > 0 && !s.inEnum(value) {
+		add("enum", "value is not one of the allowed values")
+	}
+
+	switch v := value.(type) {
+	case float64:
+		switch {
+		case s.minimum != nil && v < *s.minimum:
+			add("minimum", "%v is less than the minimum %v", v, *s.minimum)
+		case s.exclMin != nil && v <= *s.exclMin:
+			add("exclusiveMinimum", "%v is not greater than %v", v, *s.exclMin)
+		}
+		switch {
+		case s.maximum != nil && v > *s.maximum:
+			add("maximum", "%v is greater than the maximum %v", v, *s.maximum)
+		case s.exclMax != nil && v >= *s.exclMax:
+			add("exclusiveMaximum", "%v is not less than %v", v, *s.exclMax)
+		}
+	case string:
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			add("pattern", "does not match pattern %s", s.pattern)
+		}
+	case []interface{}:
+		if s.items != nil {
+			for i, element := range v {
+				s.items.validate(element, fmt.Sprintf("%s[%d]", path, i), out)
+			}
+		}
+	case map[string]interface{}:
+		s.validateObject(v, path, out)
+	}
+}
+
+// validateObject checks required, declared and undeclared properties
+func (s *Schema) validateObject(obj map[string]interface{}, path string, out *[]Violation) {
+	for _, name := range s.required {
+		if _, ok := obj[name]; !ok {
+			*out = append(*out, Violation{Path: joinPath(path, name), Rule: "required", Message: "required property is missing"})
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		childPath := joinPath(path, name)
+		if sub, declared := s.properties[name]; declared {
+			sub.validate(obj[name], childPath, out)
+			continue
+		}
+		switch {
+		case s.additional != nil:
+			s.additional.validate(obj[name], childPath, out)
+		case s.closed:
+			*out = append(*out, Violation{Path: childPath, Rule: "additionalProperties", Message: "property is not allowed"})
+		}
+	}
+}
+
+// matchesType reports whether a value has one of the schema's types
+func (s *Schema) matchesType(value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range s.types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// inEnum reports whether a value equals one of the enum values
+func (s *Schema) inEnum(value interface{}) bool {
+	for _, allowed := range s.enum {
+		if reflect.DeepEqual(value, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf names the JSON type of a normalized value, reporting whole numbers
+// as integers
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// normalize converts a value to the form encoding/json decodes it to, so Go
+// values such as ints, core.Document and []string validate like stored ones
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, bool, string, float64:
+		return v
+	case core.Document:
+		return normalize(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			out[key] = normalize(element)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, element := range v {
+			out[i] = normalize(element)
+		}
+		return out
+	}
+
+	if f, ok := core.ToFloat64(value); ok {
+		return f
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return value
+	}
+	return decoded
+}
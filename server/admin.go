@@ -0,0 +1,20 @@
+package server
+
+import "net/http"
+
+// adminStats responds with the database's db.Info. With authentication it
+// requires an admin key.
+func (s *server) adminStats(w http.ResponseWriter, r *http.Request) {
+	if s.auth {
+		if err := authorizeAdmin(r, "reading stats"); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	info, err := s.db.Info()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
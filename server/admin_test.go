@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestAdminStats(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth())
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"name": "Ada"})
+	admin, _, err := CreateAPIKey(database, "admin", RoleAdmin, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	reader, _, err := CreateAPIKey(database, "reader", RoleUser, map[string]Permission{"*": PermRead})
+	if err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+
+	if status, _, _ := send(t, srv, "GET", "/admin/stats", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a key, got %d", status)
+	}
+	if status, _, _ := send(t, srv, "GET", "/admin/stats", "", bearer(reader)); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a user key, got %d", status)
+	}
+
+	status, _, body := send(t, srv, "GET", "/admin/stats", "", bearer(admin))
+	if status != http.StatusOK {
+		t.Fatalf("Expected the stats, got %d %v", status, body)
+	}
+	collections, _ := body["collections"].([]interface{})
+	found := false
+	for _, c := range collections {
+		if c := c.(map[string]interface{}); c["name"] == "users" && c["documents"] == 1.0 {
+			found = true
+		}
+	}
+	if !found || body["uptime_ns"] == nil || body["last_backup"] != nil {
+		t.Errorf("Expected the users collection and no backup, got %v", body)
+	}
+}
@@ -0,0 +1,336 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// KeysCollection is the reserved collection storing API keys, which no
+// collection endpoint serves while authentication is enabled
+const KeysCollection = "_system_keys"
+
+var (
+	// errUnauthorized is returned for requests without a valid API key
+	errUnauthorized = errors.New("missing or invalid API key")
+	// errForbidden is returned when a key lacks the required permission
+	errForbidden = errors.New("insufficient permission")
+)
+
+// Role is the role of an API key
+type Role string
+
+const (
+	// RoleAdmin keys may do anything, including managing keys
+	RoleAdmin Role = "admin"
+	// RoleUser keys may do what their permissions allow
+	RoleUser Role = "user"
+)
+
+// Permission is the access an API key has to a collection. Each permission
+// includes the ones before it.
+type Permission string
+
+const (
+	// PermRead allows reading, querying and watching documents
+	PermRead Permission = "read"
+	// PermWrite also allows inserting, replacing, patching and deleting
+	PermWrite Permission = "write"
+	// PermAdmin also allows creating the collection
+	PermAdmin Permission = "admin"
+)
+
+// permissionRanks orders the permissions
+var permissionRanks = map[Permission]int{PermRead: 1, PermWrite: 2, PermAdmin: 3}
+
+// APIKey describes a stored API key. The key itself is only returned when it
+// is created; the server keeps its SHA-256 hash.
+type APIKey struct {
+	ID          string                `json:"id"`
+	Name        string                `json:"name,omitempty"`
+	Role        Role                  `json:"role"`
+	Permissions map[string]Permission `json:"permissions,omitempty"` // By collection, "*" for every collection
+	Attributes  map[string]string     `json:"attributes,omitempty"`  // Given to security policies, such as "tenant_id"
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+// storedKey is an API key as stored in KeysCollection, under its ID
+type storedKey struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+// Allows reports whether the key has at least a permission on a collection
+func (k *APIKey) Allows(collection string, perm Permission) bool {
+	if k.Role == RoleAdmin {
+		return true
+	}
+	granted, ok := k.Permissions[collection]
+	if !ok {
+		granted = k.Permissions["*"]
+	}
+	return permissionRanks[granted] >= permissionRanks[perm]
+}
+
+// validate checks the role and permissions of a new key
+func (k *APIKey) validate() error {
+	if k.Role != RoleAdmin && k.Role != RoleUser {
+		return fmt.Errorf("invalid role %q", k.Role)
+	}
+	for collection, perm := range k.Permissions {
+		if collection == "" || collection == KeysCollection {
+			return fmt.Errorf("invalid permission collection %q", collection)
+		}
+		if _, ok := permissionRanks[perm]; !ok {
+			return fmt.Errorf("invalid permission %q on %s", perm, collection)
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key with a role and permissions, returning
+// the key to present as "Authorization: Bearer <key>" and its description.
+// The key cannot be recovered later. Use it to bootstrap the first admin key
+// from Go; over HTTP the first key can be created without credentials.
+func CreateAPIKey(d *db.DB, name string, role Role, perms map[string]Permission) (string, *APIKey, error) {
+	return createKey(d, &APIKey{Name: name, Role: role, Permissions: perms}, nil)
+}
+
+// createKey stores a new key. With check, it runs against the stored keys in
+// the same batch, so it can refuse atomically.
+func createKey(d *db.DB, k *APIKey, check func(keys map[core.DocumentID]core.Document) error) (string, *APIKey, error) {
+	if err := k.validate(); err != nil {
+		return "", nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	c, err := d.CreateCollection(KeysCollection)
+	if err != nil {
+		return "", nil, err
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	k.ID = id
+	k.CreatedAt = time.Now().UTC()
+	doc, err := encodeKey(storedKey{APIKey: *k, Hash: hashSecret(secret)})
+	if err != nil {
+		return "", nil, err
+	}
+
+	err = c.Batch(func(keys map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		if check != nil {
+			if err := check(keys); err != nil {
+				return nil, err
+			}
+		}
+		if _, exists := keys[core.DocumentID(id)]; exists {
+			return nil, fmt.Errorf("failed to create API key: %w", core.ErrIDCollision)
+		}
+		return map[core.DocumentID]core.Document{core.DocumentID(id): doc}, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return id + "." + secret, k, nil
+}
+
+// RevokeAPIKey deletes an API key, failing with core.ErrDocumentNotFound if
+// there is none
+func RevokeAPIKey(d *db.DB, id string) error {
+	c, err := d.CreateCollection(KeysCollection)
+	if err != nil {
+		return err
+	}
+	return c.Delete(core.DocumentID(id))
+}
+
+// ListAPIKeys returns the stored API keys ordered by ID
+func ListAPIKeys(d *db.DB) ([]APIKey, error) {
+	c, err := d.CreateCollection(KeysCollection)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := c.Find(core.Query{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	keys := make([]APIKey, 0, len(docs))
+	for _, doc := range docs {
+		stored, err := decodeKey(doc)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, stored.APIKey)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// authenticate returns the key presented by a bearer Authorization header.
+// The secret is compared in constant time, and against a dummy hash when the
+// ID is unknown, so timing reveals neither.
+func authenticate(d *db.DB, header string) (*APIKey, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return nil, errUnauthorized
+	}
+	id, secret, ok := strings.Cut(strings.TrimSpace(token), ".")
+	if !ok || id == "" {
+		return nil, errUnauthorized
+	}
+	c, err := d.CreateCollection(KeysCollection)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored storedKey
+	doc, err := c.Get(core.DocumentID(id))
+	switch {
+	case err == nil:
+		if stored, err = decodeKey(doc); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, core.ErrDocumentNotFound):
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	expected := stored.Hash
+	if expected == "" {
+		expected = strings.Repeat("0", sha256.Size*2)
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(expected)) != 1 || stored.Hash == "" {
+		return nil, errUnauthorized
+	}
+	return &stored.APIKey, nil
+}
+
+// hashSecret returns the hex SHA-256 of a key's secret. Secrets are 256
+// random bits, so a slow password hash would add nothing.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString encodes n random bytes
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return encode(b), nil
+}
+
+// encodeKey encodes a stored key as a document
+func encodeKey(k storedKey) (core.Document, error) {
+	data, err := json.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode API key: %w", err)
+	}
+	var doc core.Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to encode API key: %w", err)
+	}
+	return doc, nil
+}
+
+// decodeKey decodes a stored key
+func decodeKey(doc core.Document) (storedKey, error) {
+	var k storedKey
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return k, fmt.Errorf("failed to decode API key: %w", err)
+	}
+	if err := json.Unmarshal(data, &k); err != nil {
+		return k, fmt.Errorf("failed to decode API key: %w", err)
+	}
+	return k, nil
+}
+
+// principalKey is the context key of the authenticated API key
+type principalKey struct{}
+
+// PrincipalFromContext returns the API key that authenticated a request
+func PrincipalFromContext(ctx context.Context) (*APIKey, bool) {
+	k, ok := ctx.Value(principalKey{}).(*APIKey)
+	return k, ok
+}
+
+// WithAuth requires API keys: every request must carry a key allowed to do
+// what it asks, and keys are managed under /keys. See CreateAPIKey.
+func WithAuth() Option {
+	return func(s *server) {
+		s.auth = true
+	}
+}
+
+// withPrincipal authenticates the request's Authorization header, if any,
+// attaching the key to the request's context
+func (s *server) withPrincipal(r *http.Request) (*http.Request, error) {
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return r, nil
+	}
+	key, err := authenticate(s.db, header)
+	if err != nil {
+		return r, err
+	}
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, key)), nil
+}
+
+// authorize checks that the request's key has a permission on a collection,
+// failing with errUnauthorized without a key and errForbidden if it lacks
+// the permission. Without authentication everything is allowed.
+func (s *server) authorize(r *http.Request, collection string, perm Permission) error {
+	if !s.auth {
+		return nil
+	}
+	key, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return errUnauthorized
+	}
+	if collection == KeysCollection {
+		return fmt.Errorf("%w: %s is reserved", errForbidden, collection)
+	}
+	if !key.Allows(collection, perm) {
+		return fmt.Errorf("%w: %s on %s", errForbidden, perm, collection)
+	}
+	return nil
+}
+
+// collection authorizes a permission on the request's collection and
+// returns it, acting on behalf of the request's key under the collection's
+// security policy
+func (s *server) collection(r *http.Request, perm Permission) (*db.Collection, error) {
+	name := r.PathValue("coll")
+	if err := s.authorize(r, name, perm); err != nil {
+		return nil, err
+	}
+	if key, ok := PrincipalFromContext(r.Context()); ok {
+		return s.db.WithPrincipal(key.principal()).Collection(name)
+	}
+	return s.db.Collection(name)
+}
+
+// principal returns who a request made with the key acts on behalf of
+func (k *APIKey) principal() db.Principal {
+	return db.Principal{ID: k.ID, Roles: []string{string(k.Role)}, Attributes: k.Attributes}
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// bearer returns the Authorization header presenting a key
+func bearer(key string) map[string]string {
+	if key == "" {
+		return nil
+	}
+	return map[string]string{"Authorization": "Bearer " + key}
+}
+
+func TestAuthorization(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth())
+	users, _ := database.CreateCollection("users")
+	database.CreateCollection("orders")
+	users.Insert(core.Document{"_id": "ada", "name": "Ada"})
+
+	principals := []struct {
+		name  string
+		role  Role
+		perms map[string]Permission
+	}{
+		{"reader", RoleUser, map[string]Permission{"*": PermRead}},
+		{"writer", RoleUser, map[string]Permission{"users": PermWrite}},
+		{"owner", RoleUser, map[string]Permission{"users": PermAdmin}},
+		{"admin", RoleAdmin, nil},
+	}
+	keys := map[string]string{"none": "", "invalid": "0000.bogus"}
+	for _, p := range principals {
+		key, _, err := CreateAPIKey(database, p.name, p.role, p.perms)
+		if err != nil {
+			t.Fatalf("Failed to create API key: %v", err)
+		}
+		keys[p.name] = key
+	}
+	order := []string{"none", "invalid", "reader", "writer", "owner", "admin"}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		statuses [6]int // Indexed like order
+	}{
+		{"get", "GET", "/collections/users/documents/ada", "", [6]int{401, 401, 200, 200, 200, 200}},
+		{"query", "POST", "/collections/users/query", `{}`, [6]int{401, 401, 200, 200, 200, 200}},
+		{"insert", "POST", "/collections/users/documents", `{"name": "x"}`, [6]int{401, 401, 403, 201, 201, 201}},
+		{"patch", "PATCH", "/collections/users/documents/ada", `{"age": 36}`, [6]int{401, 401, 403, 200, 200, 200}},
+		{"put", "PUT", "/collections/users/documents/tmp", `{}`, [6]int{401, 401, 403, 200, 200, 200}},
+		{"delete", "DELETE", "/collections/users/documents/tmp", "", [6]int{401, 401, 403, 204, 204, 204}},
+		{"create collection", "POST", "/collections/users", "", [6]int{401, 401, 403, 403, 409, 409}},
+		{"other collection", "GET", "/collections/orders/documents/o1", "", [6]int{401, 401, 404, 403, 403, 404}},
+		{"watch other collection", "GET", "/collections/orders/watch", "", [6]int{401, 401, 0, 403, 403, 0}},
+		{"reserved collection", "GET", "/collections/" + KeysCollection + "/documents/x", "", [6]int{401, 401, 403, 403, 403, 403}},
+		{"list collections", "GET", "/collections", "", [6]int{401, 401, 200, 200, 200, 200}},
+		{"list keys", "GET", "/keys", "", [6]int{401, 401, 403, 403, 403, 200}},
+		{"revoke key", "DELETE", "/keys/missing", "", [6]int{401, 401, 403, 403, 403, 404}},
+	}
+	for _, tt := range tests {
+		for i, principal := range order {
+			if tt.statuses[i] == 0 {
+				continue // Allowed, but a stream
+			}
+			t.Run(tt.name+"/"+principal, func(t *testing.T) {
+				users.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+					return map[core.DocumentID]core.Document{"tmp": {}}, nil
+				})
+				status, header, body := send(t, srv, tt.method, tt.path, tt.body, bearer(keys[principal]))
+				if status != tt.statuses[i] {
+					t.Errorf("Expected status %d, got %d: %v", tt.statuses[i], status, body)
+				}
+				if status == http.StatusUnauthorized && header.Get("WWW-Authenticate") != "Bearer" {
+					t.Errorf("Expected a WWW-Authenticate challenge, got %q", header.Get("WWW-Authenticate"))
+				}
+			})
+		}
+	}
+
+	// Listing only shows the collections a key may read
+	_, _, body := send(t, srv, "GET", "/collections", "", bearer(keys["writer"]))
+	if names := body["collections"].([]interface{}); len(names) != 1 || names[0] != "users" {
+		t.Errorf("Expected the writer to see only users, got %v", names)
+	}
+	_, _, body = send(t, srv, "GET", "/collections", "", bearer(keys["admin"]))
+	if names := body["collections"].([]interface{}); len(names) != 2 {
+		t.Errorf("Expected the admin to see every collection but the keys, got %v", names)
+	}
+}
+
+func TestKeyManagement(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth())
+
+	tests := []struct {
+		name   string
+		body   string
+		key    string
+		status int
+	}{
+		{"bootstrap needs admin role", `{"role": "user", "permissions": {"*": "read"}}`, "", http.StatusUnauthorized},
+		{"bootstrap", `{"name": "root", "role": "admin"}`, "", http.StatusCreated},
+		{"second bootstrap", `{"name": "again", "role": "admin"}`, "", http.StatusUnauthorized},
+	}
+	var rootKey string
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, header, body := send(t, srv, "POST", "/keys", tt.body, bearer(tt.key))
+			if status != tt.status {
+				t.Fatalf("Expected status %d, got %d: %v", tt.status, status, body)
+			}
+			if status == http.StatusCreated {
+				rootKey, _ = body["key"].(string)
+				if !strings.HasPrefix(header.Get("Location"), "/keys/") || body["role"] != "admin" {
+					t.Errorf("Unexpected created key: %v %v", header, body)
+				}
+			}
+		})
+	}
+	if rootKey == "" {
+		t.Fatalf("Expected the bootstrap key")
+	}
+
+	for _, invalid := range []string{`{"role": "root"}`, `{"role": "user", "permissions": {"users": "superuser"}}`, `{"role": "user", "permissions": {"_system_keys": "read"}}`} {
+		if status, _, body := send(t, srv, "POST", "/keys", invalid, bearer(rootKey)); status != http.StatusBadRequest {
+			t.Errorf("Expected %s to fail, got %d: %v", invalid, status, body)
+		}
+	}
+	status, _, body := send(t, srv, "POST", "/keys", `{"name": "app", "role": "user", "permissions": {"users": "write"}}`, bearer(rootKey))
+	if status != http.StatusCreated {
+		t.Fatalf("Expected an admin to create keys, got %d: %v", status, body)
+	}
+	appKey, appID := body["key"].(string), body["id"].(string)
+
+	status, _, body = send(t, srv, "POST", "/keys", `{"role": "admin"}`, bearer(appKey))
+	if status != http.StatusForbidden {
+		t.Errorf("Expected a user key not to create keys, got %d: %v", status, body)
+	}
+
+	// Keys are stored hashed and never listed
+	stored, _ := database.CreateCollection(KeysCollection)
+	doc, err := stored.Get(core.DocumentID(appID))
+	if err != nil {
+		t.Fatalf("Failed to read the stored key: %v", err)
+	}
+	_, secret, _ := strings.Cut(appKey, ".")
+	if hash, _ := doc["hash"].(string); hash == "" || strings.Contains(hash, secret) {
+		t.Errorf("Expected the key to be stored hashed, got %v", doc)
+	}
+	_, _, body = send(t, srv, "GET", "/keys", "", bearer(rootKey))
+	listed := body["keys"].([]interface{})
+	if len(listed) != 2 {
+		t.Fatalf("Expected 2 keys, got %v", listed)
+	}
+	for _, k := range listed {
+		if _, ok := k.(map[string]interface{})["hash"]; ok {
+			t.Errorf("Expected listed keys without hashes, got %v", k)
+		}
+		if _, ok := k.(map[string]interface{})["key"]; ok {
+			t.Errorf("Expected listed keys without the key, got %v", k)
+		}
+	}
+
+	if status, _, _ := send(t, srv, "DELETE", "/keys/"+appID, "", bearer(rootKey)); status != http.StatusNoContent {
+		t.Errorf("Expected the key to be revoked, got %d", status)
+	}
+	if status, _, _ := send(t, srv, "GET", "/collections", "", bearer(appKey)); status != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked key to be refused, got %d", status)
+	}
+	wrongSecret := appKey[:strings.Index(appKey, ".")] + ".wrong"
+	if status, _, _ := send(t, srv, "GET", "/collections", "", bearer(wrongSecret)); status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong secret to be refused, got %d", status)
+	}
+}
+
+func TestKeysNeedAuth(t *testing.T) {
+	srv, _ := setupTestServer(t)
+	if status, _ := do(t, srv, "GET", "/keys", ""); status != http.StatusNotFound {
+		t.Errorf("Expected no key management without WithAuth, got %d", status)
+	}
+}
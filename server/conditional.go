@@ -0,0 +1,96 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// preconditions are the conditional headers of a request, compared against
+// a document's ETag, which is its db.Version as a strong entity tag
+type preconditions struct {
+	ifMatch     []string // Entity tags of If-Match; nil when absent
+	ifNoneMatch []string // Entity tags of If-None-Match; nil when absent
+}
+
+// parsePreconditions reads the conditional headers of a request
+func parsePreconditions(r *http.Request) preconditions {
+	return preconditions{
+		ifMatch:     entityTags(r.Header.Values("If-Match")),
+		ifNoneMatch: entityTags(r.Header.Values("If-None-Match")),
+	}
+}
+
+// entityTags splits header values into their entity tags, nil if there are
+// no values
+func entityTags(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	tags := []string{}
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// etag returns the strong entity tag of a version
+func etag(version string) string {
+	return `"` + version + `"`
+}
+
+// matches reports whether a list of entity tags matches the current entity
+// tag, "*" matching any. A missing document matches nothing. Strong
+// comparison never matches weak tags (RFC 9110, section 8.8.3.2).
+func matches(tags []string, current string, exists, weak bool) bool {
+	if !exists {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "*" || tag == current {
+			return true
+		}
+		if weak && strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+	return false
+}
+
+// check evaluates the preconditions of a write against a document's current
+// version, failing with db.ErrVersionConflict: If-Match must strongly match
+// an existing document and If-None-Match must not weakly match, so
+// If-None-Match: * only creates
+func (p preconditions) check(version string, exists bool) error {
+	if err := p.checkMatch(version, exists); err != nil {
+		return err
+	}
+	if current := etag(version); p.ifNoneMatch != nil && matches(p.ifNoneMatch, current, exists, true) {
+		return fmt.Errorf("%w: document exists at %s", db.ErrVersionConflict, current)
+	}
+	return nil
+}
+
+// checkMatch evaluates If-Match alone, which reads check too
+func (p preconditions) checkMatch(version string, exists bool) error {
+	current := etag(version)
+	if p.ifMatch == nil || matches(p.ifMatch, current, exists, false) {
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("%w: document does not exist", db.ErrVersionConflict)
+	}
+	return fmt.Errorf("%w: document is at %s", db.ErrVersionConflict, current)
+}
+
+// notModified reports whether a read's If-None-Match weakly matches the
+// document, so it can be answered with 304 Not Modified
+func (p preconditions) notModified(version string) bool {
+	return p.ifNoneMatch != nil && matches(p.ifNoneMatch, etag(version), true, true)
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	srv, database := setupTestServer(t)
+	database.CreateCollection("users")
+
+	status, header, _ := send(t, srv, "PUT", "/collections/users/documents/ada", `{"name": "Ada"}`, map[string]string{"If-None-Match": "*"})
+	if status != http.StatusCreated {
+		t.Fatalf("Expected a create-only PUT to create, got %d", status)
+	}
+	tag := header.Get("ETag")
+	if len(tag) < 3 || tag[0] != '"' {
+		t.Fatalf("Expected a strong ETag, got %q", tag)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		header map[string]string
+		status int
+	}{
+		{"create-only on existing", "PUT", `{"name": "x"}`, map[string]string{"If-None-Match": "*"}, http.StatusPreconditionFailed},
+		{"stale If-Match", "PUT", `{"name": "x"}`, map[string]string{"If-Match": `"stale"`}, http.StatusPreconditionFailed},
+		{"weak If-Match", "PATCH", `{"name": "x"}`, map[string]string{"If-Match": "W/" + tag}, http.StatusPreconditionFailed},
+		{"stale delete", "DELETE", "", map[string]string{"If-Match": `"stale"`}, http.StatusPreconditionFailed},
+		{"If-None-Match on write", "PATCH", `{"name": "x"}`, map[string]string{"If-None-Match": tag}, http.StatusPreconditionFailed},
+		{"stale If-Match on read", "GET", "", map[string]string{"If-Match": `"stale"`}, http.StatusPreconditionFailed},
+		{"conditional read", "GET", "", map[string]string{"If-None-Match": `"other", ` + tag}, http.StatusNotModified},
+		{"weak conditional read", "GET", "", map[string]string{"If-None-Match": "W/" + tag}, http.StatusNotModified},
+		{"changed read", "GET", "", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"matching If-Match", "PATCH", `{"age": 36}`, map[string]string{"If-Match": `"other", ` + tag}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := send(t, srv, tt.method, "/collections/users/documents/ada", tt.body, tt.header)
+			if status != tt.status {
+				t.Errorf("Expected status %d, got %d: %v", tt.status, status, body)
+			}
+		})
+	}
+
+	// If-Match on a missing document fails rather than creating it
+	status, _, _ = send(t, srv, "PUT", "/collections/users/documents/bob", `{}`, map[string]string{"If-Match": "*"})
+	if status != http.StatusPreconditionFailed {
+		t.Errorf("Expected If-Match on a missing document to fail, got %d", status)
+	}
+}
+
+func TestNotModifiedRoundTrip(t *testing.T) {
+	srv, database := setupTestServer(t)
+	database.CreateCollection("users")
+	do(t, srv, "POST", "/collections/users/documents", `{"_id": "ada", "name": "Ada"}`)
+
+	status, header, body := send(t, srv, "GET", "/collections/users/documents/ada", "", nil)
+	tag := header.Get("ETag")
+	if status != http.StatusOK || tag == "" || body["name"] != "Ada" {
+		t.Fatalf("Expected the document with an ETag, got %d %q %v", status, tag, body)
+	}
+
+	status, header, body = send(t, srv, "GET", "/collections/users/documents/ada", "", map[string]string{"If-None-Match": tag})
+	if status != http.StatusNotModified || body != nil || header.Get("ETag") != tag {
+		t.Errorf("Expected 304 without a body, got %d %v", status, body)
+	}
+
+	// Once the document changes its ETag does too
+	do(t, srv, "PATCH", "/collections/users/documents/ada", `{"name": "Ada Lovelace"}`)
+	status, header, _ = send(t, srv, "GET", "/collections/users/documents/ada", "", map[string]string{"If-None-Match": tag})
+	if status != http.StatusOK || header.Get("ETag") == tag {
+		t.Errorf("Expected the changed document with a new ETag, got %d %q", status, header.Get("ETag"))
+	}
+}
+
+func TestConcurrentConditionalPuts(t *testing.T) {
+	srv, database := setupTestServer(t)
+	database.CreateCollection("counters")
+	_, header, _ := send(t, srv, "PUT", "/collections/counters/documents/c1", `{"n": 0}`, nil)
+	tag := header.Get("ETag")
+
+	const writers = 8
+	statuses := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 1; i <= writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			status, _, _ := send(t, srv, "PUT", "/collections/counters/documents/c1", fmt.Sprintf(`{"n": %d}`, i), map[string]string{"If-Match": tag})
+			statuses <- status
+		}(i)
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := make(map[int]int)
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusPreconditionFailed] != writers-1 {
+		t.Errorf("Expected exactly one PUT to succeed, got %v", counts)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+	"github.com/HakashiKatake/Go-Json-Database/txn"
+)
+
+var (
+	// errBadRequest is wrapped by errors in the request itself
+	errBadRequest = errors.New("bad request")
+	// errCollectionExists is returned when creating a collection that exists
+	errCollectionExists = errors.New("collection already exists")
+)
+
+// errorStatuses maps errors to response statuses, the first match winning
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{errBadRequest, http.StatusBadRequest},
+	{errUnauthorized, http.StatusUnauthorized},
+	{errForbidden, http.StatusForbidden},
+	{db.ErrPolicyViolation, http.StatusForbidden},
+	{db.ErrNoPrincipal, http.StatusForbidden},
+	{db.ErrEncryptedField, http.StatusBadRequest},
+	{storage.ErrIDMismatch, http.StatusBadRequest},
+	{core.ErrDocumentNotFound, http.StatusNotFound},
+	{db.ErrCollectionNotFound, http.StatusNotFound},
+	{storage.ErrNamespaceNotFound, http.StatusNotFound},
+	{core.ErrDocumentExists, http.StatusConflict},
+	{core.ErrIDCollision, http.StatusConflict},
+	{errCollectionExists, http.StatusConflict},
+	{index.ErrUniqueConstraintViolation, http.StatusConflict},
+	{txn.ErrTxnConflict, http.StatusConflict},
+	{schema.ErrSchemaValidation, http.StatusUnprocessableEntity},
+	{db.ErrReferenceViolation, http.StatusUnprocessableEntity},
+	{db.ErrVersionConflict, http.StatusPreconditionFailed},
+	{storage.ErrReadOnly, http.StatusForbidden},
+	{db.ErrClosed, http.StatusServiceUnavailable},
+}
+
+// statusOf returns the response status of an error
+func statusOf(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	for _, e := range errorStatuses {
+		if errors.Is(err, e.err) {
+			return e.status
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+// errorBody is the JSON body of an error response
+type errorBody struct {
+	Error      string             `json:"error"`
+	Violations []schema.Violation `json:"violations,omitempty"`
+}
+
+// writeError responds with an error and its status
+func writeError(w http.ResponseWriter, err error) {
+	body := errorBody{Error: err.Error()}
+	var verr *schema.ValidationError
+	if errors.As(err, &verr) {
+		body.Violations = verr.Violations
+	}
+	status := statusOf(err)
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	writeJSON(w, status, body)
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/query"
+)
+
+// listCollections responds with the names of the collections the request
+// may read
+func (s *server) listCollections(w http.ResponseWriter, r *http.Request) {
+	names, err := s.db.Collections()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if s.auth {
+		if _, ok := PrincipalFromContext(r.Context()); !ok {
+			writeError(w, errUnauthorized)
+			return
+		}
+		names = slices.DeleteFunc(names, func(name string) bool {
+			return s.authorize(r, name, PermRead) != nil
+		})
+	}
+	if names == nil {
+		names = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collections": names})
+}
+
+// createCollection creates a collection, failing with 409 if it exists
+func (s *server) createCollection(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("coll")
+	if err := s.authorize(r, name, PermAdmin); err != nil {
+		writeError(w, err)
+		return
+	}
+	names, err := s.db.Collections()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if slices.Contains(names, name) {
+		writeError(w, fmt.Errorf("%w: %s", errCollectionExists, name))
+		return
+	}
+
+	if _, err := s.db.CreateCollection(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/collections/"+url.PathEscape(name))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"collection": name})
+}
+
+// insertDocument inserts the request's document and responds with it
+func (s *server) insertDocument(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermWrite)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id, err := c.Insert(doc)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", documentPath(c.Name(), id))
+	s.writeDocument(w, r, c, id, http.StatusCreated)
+}
+
+// getDocument responds with a document and its ETag, or with 304 Not
+// Modified if If-None-Match matches it
+func (s *server) getDocument(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermRead)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, version, err := c.GetVersion(core.DocumentID(r.PathValue("id")))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	p := parsePreconditions(r)
+	if err := p.checkMatch(version, true); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	if p.notModified(version) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	redaction, err := s.redaction(r, c.Name())
+	if err == nil {
+		doc, err = redact(redaction, doc)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
+// putDocument stores the request's document under the ID, responding with
+// 201 if it was created and 200 if it replaced a document. If-Match and
+// If-None-Match make the write conditional.
+func (s *server) putDocument(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermWrite)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id := core.DocumentID(r.PathValue("id"))
+	p := parsePreconditions(r)
+	created := false
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		current, exists := docs[id]
+		if err := p.check(db.Version(current), exists); err != nil {
+			return nil, err
+		}
+		created = !exists
+		return map[core.DocumentID]core.Document{id: doc}, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		w.Header().Set("Location", documentPath(c.Name(), id))
+	}
+	s.writeDocument(w, r, c, id, status)
+}
+
+// patchDocument merges the request's JSON merge patch into a document,
+// conditionally on If-Match and If-None-Match
+func (s *server) patchDocument(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermWrite)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	patch, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id := core.DocumentID(r.PathValue("id"))
+	p := parsePreconditions(r)
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		doc, exists := docs[id]
+		if err := p.check(db.Version(doc), exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("failed to patch %s/%s: %w", c.Name(), id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: doc.MergePatch(patch)}, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeDocument(w, r, c, id, http.StatusOK)
+}
+
+// deleteDocument deletes a document, conditionally on If-Match and
+// If-None-Match, responding with 204
+func (s *server) deleteDocument(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermWrite)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	id := core.DocumentID(r.PathValue("id"))
+	p := parsePreconditions(r)
+	err = c.Batch(func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		doc, exists := docs[id]
+		if err := p.check(db.Version(doc), exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("failed to delete %s/%s: %w", c.Name(), id, core.ErrDocumentNotFound)
+		}
+		return map[core.DocumentID]core.Document{id: nil}, nil
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// queryDocuments runs the request's query and responds with the matches
+func (s *server) queryDocuments(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermRead)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	q, err := query.ParseQuery(c.Name(), body)
+	if err != nil {
+		writeError(w, fmt.Errorf("%w: %w", errBadRequest, err))
+		return
+	}
+	docs, err := c.FindContext(r.Context(), q)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	redaction, err := s.redaction(r, c.Name())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for i, doc := range docs {
+		if docs[i], err = redact(redaction, doc); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"documents": docs, "count": len(docs)})
+}
+
+// readDocument decodes the request body as a JSON object
+func readDocument(r *http.Request) (core.Document, error) {
+	var doc core.Document
+	dec := json.NewDecoder(r.Body)
+	if err := dec.Decode(&doc); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: invalid JSON document: %w", errBadRequest, err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("%w: expected a JSON object", errBadRequest)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("%w: unexpected data after document", errBadRequest)
+	}
+	return doc, nil
+}
+
+// writeDocument responds with a document as read back from the collection,
+// redacted for the request, and its ETag
+func (s *server) writeDocument(w http.ResponseWriter, r *http.Request, c *db.Collection, id core.DocumentID, status int) {
+	doc, version, err := c.GetVersion(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	redaction, err := s.redaction(r, c.Name())
+	if err == nil {
+		doc, err = redact(redaction, doc)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+	writeJSON(w, status, doc)
+}
+
+// documentPath returns the URL path of a document
+func documentPath(collection string, id core.DocumentID) string {
+	return "/collections/" + url.PathEscape(collection) + "/documents/" + url.PathEscape(string(id))
+}
+
+// writeJSON responds with v encoded as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
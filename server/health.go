@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// WithHealthOptions sets the options of the checks run by /readyz, such as
+// db.HealthMinFreeSpace
+func WithHealthOptions(opts ...db.HealthOption) Option {
+	return func(s *server) {
+		s.health = opts
+	}
+}
+
+// healthz answers liveness probes without touching the database. It needs
+// no credentials.
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]db.HealthStatus{"status": db.HealthOK})
+}
+
+// readyz answers readiness probes with the database's health report, with
+// 503 Service Unavailable unless every check passes. It needs no
+// credentials.
+func (s *server) readyz(w http.ResponseWriter, r *http.Request) {
+	report, err := s.db.Health(r.Context(), s.health...)
+	if err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, errorBody{Error: err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if report.Status != db.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestHealthEndpoints(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth(), WithHealthOptions(db.HealthFull(), db.HealthMinFreeSpace(1)))
+	if _, err := database.CreateCollection("users"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	// Probes need no credentials
+	if status, body := do(t, srv, "GET", "/healthz", ""); status != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("Expected a live server, got %d %v", status, body)
+	}
+	status, body := do(t, srv, "GET", "/readyz", "")
+	if status != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("Expected a ready server, got %d %v", status, body)
+	}
+	checks, _ := body["checks"].([]interface{})
+	if len(checks) != 4 {
+		t.Errorf("Expected 4 checks, got %v", body["checks"])
+	}
+
+	path := filepath.Join(database.Storage().Dir(), "users.json")
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt collection: %v", err)
+	}
+	if status, body := do(t, srv, "GET", "/readyz", ""); status != http.StatusServiceUnavailable || body["status"] != "degraded" {
+		t.Errorf("Expected an unready server, got %d %v", status, body)
+	}
+	if status, _ := do(t, srv, "GET", "/healthz", ""); status != http.StatusOK {
+		t.Errorf("Expected liveness not to depend on the checks, got %d", status)
+	}
+
+	database.Close()
+	if status, body := do(t, srv, "GET", "/readyz", ""); status != http.StatusServiceUnavailable || body["error"] == nil {
+		t.Errorf("Expected a closed database to be unready, got %d %v", status, body)
+	}
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// keyRequest is the body of POST /keys
+type keyRequest struct {
+	Name        string                `json:"name"`
+	Role        Role                  `json:"role"`
+	Permissions map[string]Permission `json:"permissions"`
+	Attributes  map[string]string     `json:"attributes"`
+}
+
+// createdKey is the response to POST /keys, the only one carrying the key
+type createdKey struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+// authorizeKeys checks that the request's key has the admin role
+func (s *server) authorizeKeys(r *http.Request) error {
+	return authorizeAdmin(r, "managing keys")
+}
+
+// authorizeAdmin checks that the request's key has the admin role, naming
+// the action in the error
+func authorizeAdmin(r *http.Request, action string) error {
+	key, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return errUnauthorized
+	}
+	if key.Role != RoleAdmin {
+		return fmt.Errorf("%w: %s requires the %s role", errForbidden, action, RoleAdmin)
+	}
+	return nil
+}
+
+// listKeys responds with the stored keys, without their hashes
+func (s *server) listKeys(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorizeKeys(r); err != nil {
+		writeError(w, err)
+		return
+	}
+	keys, err := ListAPIKeys(s.db)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// issueKey creates a key and responds with it. Without credentials it
+// only creates the first key, which must have the admin role, so a new
+// server can be bootstrapped.
+func (s *server) issueKey(w http.ResponseWriter, r *http.Request) {
+	_, authenticated := PrincipalFromContext(r.Context())
+	if authenticated {
+		if err := s.authorizeKeys(r); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	doc, err := readDocument(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var req keyRequest
+	data, _ := json.Marshal(doc)
+	if err := json.Unmarshal(data, &req); err != nil {
+		writeError(w, fmt.Errorf("%w: invalid key request: %w", errBadRequest, err))
+		return
+	}
+
+	var bootstrap func(map[core.DocumentID]core.Document) error
+	if !authenticated {
+		if req.Role != RoleAdmin {
+			writeError(w, errUnauthorized)
+			return
+		}
+		bootstrap = func(keys map[core.DocumentID]core.Document) error {
+			if len(keys) > 0 {
+				return errUnauthorized
+			}
+			return nil
+		}
+	}
+
+	key := &APIKey{Name: req.Name, Role: req.Role, Permissions: req.Permissions, Attributes: req.Attributes}
+	if err := key.validate(); err != nil {
+		writeError(w, fmt.Errorf("%w: %w", errBadRequest, err))
+		return
+	}
+	secret, key, err := createKey(s.db, key, bootstrap)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/keys/"+url.PathEscape(key.ID))
+	writeJSON(w, http.StatusCreated, createdKey{APIKey: key, Key: secret})
+}
+
+// revokeKey deletes a key, responding with 204
+func (s *server) revokeKey(w http.ResponseWriter, r *http.Request) {
+	if err := s.authorizeKeys(r); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := RevokeAPIKey(s.db, r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// redaction returns the redaction of a collection's documents served in
+// response to a request, or nil if they are served whole: the collection
+// has none or the request's API key has a role it exempts. Without
+// authentication every request is redacted.
+func (s *server) redaction(r *http.Request, collection string) (*core.Redaction, error) {
+	redaction, err := s.db.Redaction(collection)
+	if err != nil || redaction == nil {
+		return nil, err
+	}
+	if k, ok := PrincipalFromContext(r.Context()); ok && redaction.Exempts(string(k.Role)) {
+		return nil, nil
+	}
+	return redaction, nil
+}
+
+// redact applies a redaction to a document, returning it unchanged for a
+// nil redaction
+func redact(redaction *core.Redaction, doc core.Document) (core.Document, error) {
+	if redaction == nil || doc == nil {
+		return doc, nil
+	}
+	return core.RedactDocument(doc, *redaction)
+}
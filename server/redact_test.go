@@ -0,0 +1,62 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestRedactionByRole(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth())
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"_id": "ada", "name": "Ada", "email": "ada@example.com", "ssn": "123-45-6789"})
+	err := database.SetRedaction("users", core.Redaction{
+		Rules:       []core.RedactRule{{Path: "ssn", Action: core.RedactDrop}, {Path: "email", Action: core.RedactMask}},
+		ExemptRoles: []string{string(RoleAdmin)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set redaction: %v", err)
+	}
+	userKey, _, _ := CreateAPIKey(database, "analyst", RoleUser, map[string]Permission{"users": PermWrite})
+	adminKey, _, _ := CreateAPIKey(database, "root", RoleAdmin, nil)
+
+	tests := []struct {
+		name     string
+		key      string
+		method   string
+		path     string
+		body     string
+		redacted bool
+	}{
+		{"get as user", userKey, "GET", "/collections/users/documents/ada", "", true},
+		{"get as admin", adminKey, "GET", "/collections/users/documents/ada", "", false},
+		{"patch as user", userKey, "PATCH", "/collections/users/documents/ada", `{"age": 36}`, true},
+		{"query as user", userKey, "POST", "/collections/users/query", `{}`, true},
+		{"query as admin", adminKey, "POST", "/collections/users/query", `{}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _, body := send(t, srv, tt.method, tt.path, tt.body, bearer(tt.key))
+			if status != 200 {
+				t.Fatalf("Expected status 200, got %d: %v", status, body)
+			}
+			doc := body
+			if docs, ok := body["documents"].([]interface{}); ok {
+				doc = docs[0].(map[string]interface{})
+			}
+
+			_, hasSSN := doc["ssn"]
+			if tt.redacted && (hasSSN || doc["email"] != "a***@***.com") {
+				t.Errorf("Expected a redacted document, got %v", doc)
+			}
+			if !tt.redacted && (!hasSSN || doc["email"] != "ada@example.com") {
+				t.Errorf("Expected the whole document, got %v", doc)
+			}
+		})
+	}
+
+	// The stored document is untouched
+	if doc, _ := users.Get("ada"); doc["ssn"] != "123-45-6789" || doc["email"] != "ada@example.com" {
+		t.Errorf("Expected the stored document unredacted, got %v", doc)
+	}
+}
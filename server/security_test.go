@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestRowLevelSecurityByKey(t *testing.T) {
+	srv, database := setupTestServer(t, WithAuth())
+	orders, _ := database.CreateCollection("orders")
+	orders.Insert(core.Document{"_id": "a1", "tenant_id": "acme"})
+	orders.Insert(core.Document{"_id": "g1", "tenant_id": "globex"})
+	database.RegisterPolicy("orders", func(p db.Principal) core.FilterNode {
+		return core.Leaf(core.Filter{Field: "tenant_id", Operator: core.OpEqual, Value: p.Attributes["tenant_id"]})
+	})
+
+	rootKey, _, _ := CreateAPIKey(database, "root", RoleAdmin, nil)
+	status, _, body := send(t, srv, "POST", "/keys", `{"name": "acme", "role": "user", "permissions": {"orders": "write"}, "attributes": {"tenant_id": "acme"}}`, bearer(rootKey))
+	if status != http.StatusCreated {
+		t.Fatalf("Expected the tenant key created, got %d: %v", status, body)
+	}
+	acmeKey := body["key"].(string)
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"get own order", acmeKey, "GET", "/collections/orders/documents/a1", "", http.StatusOK},
+		{"get another tenant's order", acmeKey, "GET", "/collections/orders/documents/g1", "", http.StatusNotFound},
+		{"insert for another tenant", acmeKey, "POST", "/collections/orders/documents", `{"tenant_id": "globex"}`, http.StatusForbidden},
+		{"insert own order", acmeKey, "POST", "/collections/orders/documents", `{"tenant_id": "acme"}`, http.StatusCreated},
+		{"watch", acmeKey, "GET", "/collections/orders/watch", "", http.StatusForbidden},
+		{"key without attributes", rootKey, "GET", "/collections/orders/documents/a1", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _, body := send(t, srv, tt.method, tt.path, tt.body, bearer(tt.key)); status != tt.status {
+				t.Errorf("Expected status %d, got %d: %v", tt.status, status, body)
+			}
+		})
+	}
+
+	status, _, body = send(t, srv, "POST", "/collections/orders/query", `{}`, bearer(acmeKey))
+	docs, _ := body["documents"].([]interface{})
+	if status != http.StatusOK || len(docs) != 2 {
+		t.Fatalf("Expected acme's 2 orders, got %d: %v", status, body)
+	}
+	for _, doc := range docs {
+		if doc.(map[string]interface{})["tenant_id"] != "acme" {
+			t.Errorf("Expected only acme's orders, got %v", doc)
+		}
+	}
+}
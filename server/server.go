@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// DefaultMaxBodyBytes is the largest request body accepted unless set with
+// WithMaxBodyBytes
+const DefaultMaxBodyBytes = 1 << 20
+
+// server serves a database's collections over HTTP
+type server struct {
+	db          *db.DB
+	mux         *http.ServeMux
+	maxBody     int64
+	keepAlive   time.Duration
+	watchBuffer int
+	auth        bool
+	health      []db.HealthOption
+}
+
+// Option configures NewHTTPServer
+type Option func(*server)
+
+// WithMaxBodyBytes rejects request bodies larger than n bytes with 413
+// Request Entity Too Large. The default is DefaultMaxBodyBytes.
+func WithMaxBodyBytes(n int64) Option {
+	return func(s *server) {
+		s.maxBody = n
+	}
+}
+
+// NewHTTPServer returns a handler exposing a database as a JSON REST API:
+//
+//	GET    /collections                           list collections
+//	POST   /collections/{coll}                    create a collection
+//	POST   /collections/{coll}/documents          insert a document, generating its ID if missing
+//	GET    /collections/{coll}/documents/{id}     read a document
+//	PUT    /collections/{coll}/documents/{id}     create or replace a document
+//	PATCH  /collections/{coll}/documents/{id}     merge a JSON merge patch (RFC 7396) into a document
+//	DELETE /collections/{coll}/documents/{id}     delete a document
+//	POST   /collections/{coll}/query              run a query in the query.ParseQuery syntax
+//	GET    /collections/{coll}/watch              stream changes as server-sent events
+//	GET    /healthz                               liveness: 200 while the process serves requests
+//	GET    /readyz                                readiness: the db.HealthReport, 503 when degraded
+//	GET    /admin/stats                           the db.Info snapshot; with WithAuth, for admin keys only
+//
+// Document responses carry the document's db.Version as a strong ETag.
+// Writes honour If-Match and If-None-Match, failing with 412 Precondition
+// Failed, so If-None-Match: * only creates, and a GET whose If-None-Match
+// matches is answered with 304 Not Modified.
+//
+// Documents are served redacted when their collection has a redaction, set
+// with db.SetRedaction, unless the request's API key has a role the
+// redaction exempts.
+//
+// Errors are returned as {"error": "..."} with 404 for missing documents and
+// collections, 409 for conflicts and 422 for schema violations, which also
+// list the violations.
+//
+// WithAuth requires an API key in an "Authorization: Bearer" header, failing
+// with 401 Unauthorized without a valid one and 403 Forbidden when its
+// permissions do not cover the collection, and adds key management for keys
+// with the admin role:
+//
+//	GET    /keys                                  list keys
+//	POST   /keys                                  create a key; without credentials, only the first admin key
+//	DELETE /keys/{id}                             revoke a key
+func NewHTTPServer(d *db.DB, opts ...Option) http.Handler {
+	s := &server{
+		db:        d,
+		mux:       http.NewServeMux(),
+		maxBody:   DefaultMaxBodyBytes,
+		keepAlive: defaultKeepAlive,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("GET /collections", s.listCollections)
+	s.mux.HandleFunc("POST /collections/{coll}", s.createCollection)
+	s.mux.HandleFunc("POST /collections/{coll}/documents", s.insertDocument)
+	s.mux.HandleFunc("GET /collections/{coll}/documents/{id}", s.getDocument)
+	s.mux.HandleFunc("PUT /collections/{coll}/documents/{id}", s.putDocument)
+	s.mux.HandleFunc("PATCH /collections/{coll}/documents/{id}", s.patchDocument)
+	s.mux.HandleFunc("DELETE /collections/{coll}/documents/{id}", s.deleteDocument)
+	s.mux.HandleFunc("POST /collections/{coll}/query", s.queryDocuments)
+	s.mux.HandleFunc("GET /collections/{coll}/watch", s.watchCollection)
+	s.mux.HandleFunc("GET /healthz", s.healthz)
+	s.mux.HandleFunc("GET /readyz", s.readyz)
+	s.mux.HandleFunc("GET /admin/stats", s.adminStats)
+	if s.auth {
+		s.mux.HandleFunc("GET /keys", s.listKeys)
+		s.mux.HandleFunc("POST /keys", s.issueKey)
+		s.mux.HandleFunc("DELETE /keys/{id}", s.revokeKey)
+	}
+	return s
+}
+
+// ServeHTTP authenticates the request, limits its body and routes it
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.auth {
+		var err error
+		if r, err = s.withPrincipal(r); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if s.maxBody > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.maxBody)
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve serves h on l until ctx is done, then shuts down gracefully: the
+// listener is closed and in-flight requests get up to grace to finish before
+// their connections are closed. It returns nil after a clean shutdown.
+func Serve(ctx context.Context, l net.Listener, h http.Handler, grace time.Duration) error {
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errc:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		srv.Close()
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// ListenAndServe listens on the TCP address addr and serves h like Serve
+func ListenAndServe(ctx context.Context, addr string, h http.Handler, grace time.Duration) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return Serve(ctx, l, h, grace)
+}
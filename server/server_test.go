@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// setupTestServer opens a database in a temporary directory and serves it
+func setupTestServer(t *testing.T, opts ...Option) (*httptest.Server, *db.DB) {
+	t.Helper()
+	database, err := db.Open(t.TempDir(), db.WithAutoCreate(false))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	srv := httptest.NewServer(NewHTTPServer(database, opts...))
+	t.Cleanup(func() {
+		srv.Close()
+		database.Close()
+	})
+	return srv, database
+}
+
+// do sends a request and returns the status and decoded JSON body
+func do(t *testing.T, srv *httptest.Server, method, path, body string) (int, map[string]interface{}) {
+	t.Helper()
+	status, _, decoded := send(t, srv, method, path, body, nil)
+	return status, decoded
+}
+
+// send sends a request with headers and returns the status, the response
+// headers and the decoded JSON body
+func send(t *testing.T, srv *httptest.Server, method, path, body string, header map[string]string) (int, http.Header, map[string]interface{}) {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Errorf("Failed to create request: %v", err)
+		return 0, nil, nil
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Errorf("Failed to send request: %v", err)
+		return 0, nil, nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var decoded map[string]interface{}
+	if len(data) > 0 && resp.Header.Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("Failed to decode response %q: %v", data, err)
+		}
+	}
+	return resp.StatusCode, resp.Header, decoded
+}
+
+func TestRoutes(t *testing.T) {
+	srv, _ := setupTestServer(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		check  func(map[string]interface{}) bool
+	}{
+		{"create collection", "POST", "/collections/users", "", http.StatusCreated,
+			func(b map[string]interface{}) bool { return b["collection"] == "users" }},
+		{"list collections", "GET", "/collections", "", http.StatusOK,
+			func(b map[string]interface{}) bool { return len(b["collections"].([]interface{})) == 1 }},
+		{"insert with ID", "POST", "/collections/users/documents", `{"_id": "ada", "name": "Ada", "age": 36}`, http.StatusCreated,
+			func(b map[string]interface{}) bool { return b["_id"] == "ada" }},
+		{"insert generating ID", "POST", "/collections/users/documents", `{"name": "Grace", "age": 45}`, http.StatusCreated,
+			func(b map[string]interface{}) bool { return b["_id"] != "" && b["name"] == "Grace" }},
+		{"get", "GET", "/collections/users/documents/ada", "", http.StatusOK,
+			func(b map[string]interface{}) bool { return b["name"] == "Ada" }},
+		{"put creating", "PUT", "/collections/users/documents/alan", `{"_id": "alan", "name": "Alan", "age": 41}`, http.StatusCreated,
+			func(b map[string]interface{}) bool { return b["name"] == "Alan" }},
+		{"put replacing", "PUT", "/collections/users/documents/alan", `{"_id": "alan", "name": "Alan Turing"}`, http.StatusOK,
+			func(b map[string]interface{}) bool { return b["name"] == "Alan Turing" && b["age"] == nil }},
+		{"patch", "PATCH", "/collections/users/documents/ada", `{"age": null, "address": {"city": "London"}}`, http.StatusOK,
+			func(b map[string]interface{}) bool {
+				_, hasAge := b["age"]
+				return !hasAge && b["name"] == "Ada" && b["address"].(map[string]interface{})["city"] == "London"
+			}},
+		{"query", "POST", "/collections/users/query", `{"filter": {"name": {"$regex": "^A"}}, "sort": {"name": -1}, "limit": 1, "projection": {"name": 1}}`, http.StatusOK,
+			func(b map[string]interface{}) bool {
+				docs := b["documents"].([]interface{})
+				return b["count"] == 1.0 && docs[0].(map[string]interface{})["name"] == "Alan Turing"
+			}},
+		{"query skip", "POST", "/collections/users/query", `{"sort": {"name": 1}, "skip": 2}`, http.StatusOK,
+			func(b map[string]interface{}) bool { return b["count"] == 1.0 }},
+		{"delete", "DELETE", "/collections/users/documents/alan", "", http.StatusNoContent, nil},
+		{"get deleted", "GET", "/collections/users/documents/alan", "", http.StatusNotFound,
+			func(b map[string]interface{}) bool { return b["error"] != "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, tt.method, tt.path, tt.body)
+			if status != tt.status {
+				t.Fatalf("Expected status %d, got %d: %v", tt.status, status, body)
+			}
+			if tt.check != nil && !tt.check(body) {
+				t.Errorf("Unexpected body: %v", body)
+			}
+		})
+	}
+}
+
+func TestErrorMapping(t *testing.T) {
+	srv, database := setupTestServer(t, WithMaxBodyBytes(64))
+	database.CreateCollection("users")
+	do(t, srv, "POST", "/collections/users/documents", `{"_id": "ada", "name": "Ada"}`)
+	err := database.SetSchema("users", []byte(`{"type": "object", "properties": {"name": {"type": "string"}}}`), schema.Lenient)
+	if err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"missing document", "GET", "/collections/users/documents/nobody", "", http.StatusNotFound},
+		{"patch missing document", "PATCH", "/collections/users/documents/nobody", `{"name": "x"}`, http.StatusNotFound},
+		{"delete missing document", "DELETE", "/collections/users/documents/nobody", "", http.StatusNotFound},
+		{"missing collection", "GET", "/collections/ghosts/documents/g1", "", http.StatusNotFound},
+		{"query missing collection", "POST", "/collections/ghosts/query", `{}`, http.StatusNotFound},
+		{"duplicate insert", "POST", "/collections/users/documents", `{"_id": "ada"}`, http.StatusConflict},
+		{"existing collection", "POST", "/collections/users", "", http.StatusConflict},
+		{"schema violation", "PUT", "/collections/users/documents/bob", `{"name": 42}`, http.StatusUnprocessableEntity},
+		{"invalid JSON", "POST", "/collections/users/documents", `{"name":`, http.StatusBadRequest},
+		{"not an object", "PUT", "/collections/users/documents/bob", `[1, 2]`, http.StatusBadRequest},
+		{"trailing data", "PUT", "/collections/users/documents/bob", `{} {}`, http.StatusBadRequest},
+		{"invalid query", "POST", "/collections/users/query", `{"filter": {"age": {"$bogus": 1}}}`, http.StatusBadRequest},
+		{"body too large", "POST", "/collections/users/documents", `{"name": "` + strings.Repeat("x", 100) + `"}`, http.StatusRequestEntityTooLarge},
+		{"query too large", "POST", "/collections/users/query", `{"filter": {"name": "` + strings.Repeat("x", 100) + `"}}`, http.StatusRequestEntityTooLarge},
+		{"wrong method", "DELETE", "/collections/users", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := do(t, srv, tt.method, tt.path, tt.body)
+			if status != tt.status {
+				t.Errorf("Expected status %d, got %d: %v", tt.status, status, body)
+			}
+		})
+	}
+
+	_, body := do(t, srv, "PUT", "/collections/users/documents/bob", `{"name": 42}`)
+	violations, _ := body["violations"].([]interface{})
+	if len(violations) != 1 || violations[0].(map[string]interface{})["path"] != "name" {
+		t.Errorf("Expected the schema violation to be listed, got %v", body)
+	}
+}
+
+func TestIDFieldConvention(t *testing.T) {
+	database, err := db.Open(t.TempDir(), db.WithIDField("id"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	srv := httptest.NewServer(NewHTTPServer(database))
+	defer srv.Close()
+
+	if status, body := do(t, srv, "PUT", "/collections/users/documents/ada", `{"name": "Ada"}`); status != http.StatusCreated || body["id"] != "ada" {
+		t.Errorf("Expected the document created with its ID field, got %d: %v", status, body)
+	}
+	if status, body := do(t, srv, "PUT", "/collections/users/documents/ada", `{"id": "grace"}`); status != http.StatusBadRequest {
+		t.Errorf("Expected a conflicting ID field rejected, got %d: %v", status, body)
+	}
+	if status, body := do(t, srv, "POST", "/collections/users/documents", `{"id": "grace"}`); status != http.StatusCreated || body["id"] != "grace" {
+		t.Errorf("Expected the insert under its ID field, got %d: %v", status, body)
+	}
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- Serve(ctx, l, h, time.Second)
+	}()
+
+	responded := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			responded <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		responded <- string(data)
+	}()
+
+	<-started
+	cancel()
+	if got := <-responded; got != "done" {
+		t.Errorf("Expected the in-flight request to finish, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if _, err := http.Get("http://" + l.Addr().String()); err == nil {
+		t.Errorf("Expected new connections to be refused after shutdown")
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// defaultKeepAlive is how often an idle event stream gets a comment unless
+// set with WithKeepAlive
+const defaultKeepAlive = 15 * time.Second
+
+// eventTypes names the event of each operation
+var eventTypes = map[core.OperationType]string{
+	core.OpInsert: "insert",
+	core.OpUpdate: "update",
+	core.OpDelete: "delete",
+}
+
+// WithKeepAlive sets how often an idle event stream of
+// /collections/{coll}/watch gets a keep-alive comment. The default is 15s.
+func WithKeepAlive(d time.Duration) Option {
+	return func(s *server) {
+		s.keepAlive = d
+	}
+}
+
+// WithWatchBuffer sets how many changes a watching client may fall behind
+// before it is dropped. The default is that of storage.WatchOptions.
+func WithWatchBuffer(n int) Option {
+	return func(s *server) {
+		s.watchBuffer = n
+	}
+}
+
+// changeEvent is the data of a change event
+type changeEvent struct {
+	ID       core.DocumentID `json:"id"`
+	Document core.Document   `json:"document,omitempty"`
+}
+
+// watchCollection streams the changes of a collection as server-sent events
+// until the client disconnects. Event IDs are oplog sequence numbers when
+// the oplog is enabled, so a reconnecting client resumes after its
+// Last-Event-ID. A client too slow to keep up gets a "dropped" event and the
+// stream ends.
+func (s *server) watchCollection(w http.ResponseWriter, r *http.Request) {
+	c, err := s.collection(r, PermRead)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Changes are streamed from the oplog, which security policies do not
+	// filter
+	if s.db.HasPolicy(c.Name()) {
+		writeError(w, fmt.Errorf("%w: unable to watch %s, which has a security policy", errForbidden, c.Name()))
+		return
+	}
+	opts := storage.WatchOptions{Buffer: s.watchBuffer}
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		if opts.AfterSeq, err = strconv.ParseUint(lastID, 10, 64); err != nil {
+			writeError(w, fmt.Errorf("%w: invalid Last-Event-ID %q", errBadRequest, lastID))
+			return
+		}
+	}
+
+	redaction, err := s.redaction(r, c.Name())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	watcher, err := s.db.Watch(r.Context(), c.Name(), opts)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(s.keepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case entry, ok := <-watcher.C:
+			if !ok {
+				if err := watcher.Err(); errors.Is(err, storage.ErrWatcherDropped) {
+					writeEvent(w, 0, "dropped", map[string]string{"error": err.Error()})
+					rc.Flush()
+				}
+				return
+			}
+			doc, err := redact(redaction, entry.Document)
+			if err != nil {
+				return
+			}
+			if err := writeEvent(w, entry.Seq, eventTypes[entry.Op], changeEvent{ID: entry.DocID, Document: doc}); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a server-sent event with JSON data, and an ID unless id
+// is zero
+func writeEvent(w http.ResponseWriter, id uint64, event string, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+	return err
+}
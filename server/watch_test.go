@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// setupWatchServer serves a database with the oplog enabled, so events carry
+// IDs
+func setupWatchServer(t *testing.T, opts ...Option) (*httptest.Server, *db.DB) {
+	t.Helper()
+	database, err := db.Open(t.TempDir(), db.WithAutoCreate(false), db.WithOplog())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	srv := httptest.NewServer(NewHTTPServer(database, opts...))
+	t.Cleanup(func() {
+		srv.Close()
+		database.Close()
+	})
+	return srv, database
+}
+
+// watch opens an event stream, which ends with the test
+func watch(t *testing.T, srv *httptest.Server, path, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+path, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readEvent reads the fields of the next event or comment of a stream
+func readEvent(t *testing.T, r *bufio.Reader) map[string]string {
+	t.Helper()
+	fields := map[string]string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return fields
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = strings.TrimPrefix(value, " ")
+	}
+}
+
+func TestWatchStreamsChanges(t *testing.T) {
+	srv, database := setupWatchServer(t)
+	users, _ := database.CreateCollection("users")
+	orders, _ := database.CreateCollection("orders")
+	stream := watch(t, srv, "/collections/users/watch", "")
+
+	users.Insert(core.Document{"_id": "ada", "name": "Ada"})
+	orders.Insert(core.Document{"_id": "o1"})
+	users.Update("ada", core.Document{"_id": "ada", "name": "Ada Lovelace"})
+	users.Delete("ada")
+
+	expected := []struct {
+		id    string
+		event string
+		data  string
+	}{
+		{"1", "insert", `{"id":"ada","document":{"_id":"ada","name":"Ada"}}`},
+		{"3", "update", `{"id":"ada","document":{"_id":"ada","name":"Ada Lovelace"}}`},
+		{"4", "delete", `{"id":"ada"}`},
+	}
+	for _, exp := range expected {
+		event := readEvent(t, stream)
+		if event["id"] != exp.id || event["event"] != exp.event || event["data"] != exp.data {
+			t.Errorf("Expected %s event %s with %s, got %v", exp.event, exp.id, exp.data, event)
+		}
+	}
+}
+
+func TestWatchResumesAfterLastEventID(t *testing.T) {
+	srv, database := setupWatchServer(t)
+	users, _ := database.CreateCollection("users")
+	for _, id := range []string{"a", "b", "c"} {
+		users.Insert(core.Document{"_id": id})
+	}
+
+	stream := watch(t, srv, "/collections/users/watch", "1")
+	users.Insert(core.Document{"_id": "d"})
+	for _, id := range []string{"2", "3", "4"} {
+		if event := readEvent(t, stream); event["id"] != id {
+			t.Errorf("Expected event %s, got %v", id, event)
+		}
+	}
+
+	status, _, _ := send(t, srv, "GET", "/collections/users/watch", "", map[string]string{"Last-Event-ID": "x"})
+	if status != http.StatusBadRequest {
+		t.Errorf("Expected an invalid Last-Event-ID to fail, got %d", status)
+	}
+	if status, _ := do(t, srv, "GET", "/collections/ghosts/watch", ""); status != http.StatusNotFound {
+		t.Errorf("Expected watching a missing collection to fail, got %d", status)
+	}
+}
+
+func TestWatchKeepAlive(t *testing.T) {
+	srv, database := setupWatchServer(t, WithKeepAlive(10*time.Millisecond))
+	database.CreateCollection("users")
+	stream := watch(t, srv, "/collections/users/watch", "")
+
+	if event := readEvent(t, stream); event[""] != "keep-alive" {
+		t.Errorf("Expected a keep-alive comment, got %v", event)
+	}
+}
+
+// stalledWriter is a response writer whose writes wait until it is released,
+// like a client that stopped reading
+type stalledWriter struct {
+	header   http.Header
+	flushed  chan struct{} // Receives on every flush
+	writing  chan struct{} // Closed by the first write
+	release  chan struct{}
+	once     sync.Once
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	finished chan struct{}
+}
+
+func (w *stalledWriter) Header() http.Header { return w.header }
+func (w *stalledWriter) WriteHeader(int)     {}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.writing) })
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *stalledWriter) Flush() {
+	select {
+	case w.flushed <- struct{}{}:
+	default:
+	}
+}
+
+func TestWatchDropsSlowClient(t *testing.T) {
+	database, err := db.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer database.Close()
+	users, _ := database.CreateCollection("users")
+	h := NewHTTPServer(database, WithWatchBuffer(1))
+
+	w := &stalledWriter{
+		header:   http.Header{},
+		flushed:  make(chan struct{}, 1),
+		writing:  make(chan struct{}),
+		release:  make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/collections/users/watch", nil))
+		close(w.finished)
+	}()
+	<-w.flushed
+
+	users.Insert(core.Document{"_id": "first"})
+	<-w.writing
+	for i := 0; i < 10; i++ {
+		users.Insert(core.Document{})
+	}
+	close(w.release)
+
+	select {
+	case <-w.finished:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the stream to end after the drop")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !strings.HasSuffix(w.buf.String(), "event: dropped\ndata: {\"error\":\"watcher fell behind and was dropped\"}\n\n") {
+		t.Errorf("Expected the stream to end with a dropped event, got %q", w.buf.String())
+	}
+}
@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+// accessStatsFileName is the sidecar access statistics are persisted in.
+// It has no .json extension, so it is not taken for a collection.
+const accessStatsFileName = "_stats"
+
+// accessStampInterval is how often the last access times are brought up
+// to date, and so their resolution
+const accessStampInterval = time.Second
+
+// ErrAccessStatsDisabled is returned by AccessStats and TopDocuments of an
+// engine created without WithAccessStats
+var ErrAccessStatsDisabled = errors.New("access statistics are not enabled")
+
+// WithAccessStats counts the reads and writes of each collection and notes
+// when it was last read and written, to within a second, persisting the
+// statistics in a _stats file in the data directory every interval and on
+// Close so they survive restarts. Counting costs reads and writes an atomic
+// increment. Reads are document reads and collection scans, including the
+// reads a database serves from its indexes and records with RecordRead;
+// writes are rewrites of the collection file.
+func WithAccessStats(interval time.Duration) Option {
+	return func(c *Config) {
+		c.AccessStatsInterval = interval
+	}
+}
+
+// WithDocumentReadSampling also counts the reads of individual documents,
+// for TopDocuments, sampling a fraction rate of the reads. At most
+// maxDocuments documents are tracked per collection; once more are seen,
+// the counts are halved and the documents left with none forgotten, so
+// rarely read documents give way to often read ones. It requires
+// WithAccessStats.
+func WithDocumentReadSampling(rate float64, maxDocuments int) Option {
+	return func(c *Config) {
+		c.DocumentSampleRate = rate
+		c.DocumentSampleLimit = maxDocuments
+	}
+}
+
+// AccessStats are the access statistics of a collection. Times are zero
+// if the collection has not been read or written since statistics began.
+type AccessStats struct {
+	Reads     uint64    `json:"reads"`
+	Writes    uint64    `json:"writes"`
+	LastRead  time.Time `json:"last_read"`
+	LastWrite time.Time `json:"last_write"`
+}
+
+// DocumentReads is the estimated number of reads of a document
+type DocumentReads struct {
+	ID    core.DocumentID
+	Reads uint64
+}
+
+// AccessStats returns the access statistics of a collection
+func (e *FileStorageEngine) AccessStats(collection string) (AccessStats, error) {
+	if e.access == nil {
+		return AccessStats{}, ErrAccessStatsDisabled
+	}
+	if e.closed.Load() {
+		return AccessStats{}, ErrEngineClosed
+	}
+	c, ok := e.access.collections.Load(collection)
+	if !ok {
+		return AccessStats{}, nil
+	}
+	access := c.(*collectionAccess)
+	access.mu.Lock()
+	defer access.mu.Unlock()
+	access.stamp(time.Now())
+	return access.stats(), nil
+}
+
+// TopDocuments returns the n documents of a collection read most often,
+// most read first, as estimated from the reads sampled since statistics
+// began. It returns none unless the engine samples document reads.
+func (e *FileStorageEngine) TopDocuments(collection string, n int) ([]DocumentReads, error) {
+	if e.access == nil {
+		return nil, ErrAccessStatsDisabled
+	}
+	if e.closed.Load() {
+		return nil, ErrEngineClosed
+	}
+	c, ok := e.access.collections.Load(collection)
+	if !ok {
+		return nil, nil
+	}
+	access := c.(*collectionAccess)
+	access.mu.Lock()
+	top := make([]DocumentReads, 0, len(access.docs))
+	for id, sampled := range access.docs {
+		top = append(top, DocumentReads{ID: core.DocumentID(id), Reads: uint64(float64(sampled) / e.access.rate)})
+	}
+	access.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Reads != top[j].Reads {
+			return top[i].Reads > top[j].Reads
+		}
+		return top[i].ID < top[j].ID
+	})
+	if n >= 0 && n < len(top) {
+		top = top[:n]
+	}
+	return top, nil
+}
+
+// RecordRead counts a read of a document served without reading the
+// collection file, as a database serves reads from its primary index. It
+// does nothing unless the engine was created WithAccessStats.
+func (e *FileStorageEngine) RecordRead(collection string, docID core.DocumentID) {
+	e.access.read(collection, docID)
+}
+
+// accessTracker counts the accesses of an engine's collections
+type accessTracker struct {
+	e           *FileStorageEngine
+	rate        float64 // Fraction of document reads sampled
+	limit       int     // Documents tracked per collection
+	collections sync.Map
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// collectionAccess is the access statistics of one collection. The
+// counters are updated without locking; the rest is guarded by mu.
+type collectionAccess struct {
+	reads  atomic.Uint64
+	writes atomic.Uint64
+
+	mu         sync.Mutex
+	seenReads  uint64 // Reads as of the last stamp
+	seenWrites uint64
+	lastRead   time.Time
+	lastWrite  time.Time
+	docs       map[string]uint64 // Sampled reads, by document
+}
+
+// accessFile is the content of the statistics sidecar
+type accessFile struct {
+	Collections map[string]persistedAccess `json:"collections"`
+}
+
+// persistedAccess is a collection's statistics as persisted
+type persistedAccess struct {
+	AccessStats
+	Documents map[string]uint64 `json:"documents,omitempty"` // Sampled reads
+}
+
+// newAccessTracker loads the statistics persisted in an engine's data
+// directory and starts keeping them up to date, persisting them every
+// interval
+func newAccessTracker(e *FileStorageEngine, interval time.Duration) (*accessTracker, error) {
+	t := &accessTracker{
+		e:     e,
+		rate:  e.cfg.DocumentSampleRate,
+		limit: e.cfg.DocumentSampleLimit,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.dataDir, accessStatsFileName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read access statistics: %w", err)
+	}
+	if err == nil {
+		var file accessFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse access statistics: %w", err)
+		}
+		for name, persisted := range file.Collections {
+			c := &collectionAccess{
+				seenReads:  persisted.Reads,
+				seenWrites: persisted.Writes,
+				lastRead:   persisted.LastRead,
+				lastWrite:  persisted.LastWrite,
+				docs:       persisted.Documents,
+			}
+			c.reads.Store(persisted.Reads)
+			c.writes.Store(persisted.Writes)
+			t.collections.Store(name, c)
+		}
+	}
+
+	go t.run(interval)
+	return t, nil
+}
+
+// collection returns the statistics of a collection, creating them
+func (t *accessTracker) collection(name string) *collectionAccess {
+	if c, ok := t.collections.Load(name); ok {
+		return c.(*collectionAccess)
+	}
+	c, _ := t.collections.LoadOrStore(name, &collectionAccess{})
+	return c.(*collectionAccess)
+}
+
+// read counts a read of a collection, and samples the read of a document
+// if docID is set. It does nothing on a nil tracker.
+func (t *accessTracker) read(collection string, docID core.DocumentID) {
+	if t == nil {
+		return
+	}
+	c := t.collection(collection)
+	c.reads.Add(1)
+	if docID != "" && t.rate > 0 && rand.Float64() < t.rate {
+		c.sample(string(docID), t.limit)
+	}
+}
+
+// wrote counts a write of a collection. It does nothing on a nil tracker.
+func (t *accessTracker) wrote(collection string) {
+	if t == nil {
+		return
+	}
+	t.collection(collection).writes.Add(1)
+}
+
+// drop forgets the statistics of a dropped collection. It does nothing on
+// a nil tracker.
+func (t *accessTracker) drop(collection string) {
+	if t == nil {
+		return
+	}
+	t.collections.Delete(collection)
+}
+
+// sample counts a sampled read of a document, halving the counts when
+// more than limit documents are tracked
+func (c *collectionAccess) sample(docID string, limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.docs == nil {
+		c.docs = make(map[string]uint64)
+	}
+	c.docs[docID]++
+	for len(c.docs) > limit {
+		for id, n := range c.docs {
+			if n /= 2; n == 0 {
+				delete(c.docs, id)
+			} else {
+				c.docs[id] = n
+			}
+		}
+	}
+}
+
+// stamp sets the last access times of a collection counted since the last
+// stamp to now. Callers hold c.mu.
+func (c *collectionAccess) stamp(now time.Time) {
+	if reads := c.reads.Load(); reads != c.seenReads {
+		c.seenReads, c.lastRead = reads, now
+	}
+	if writes := c.writes.Load(); writes != c.seenWrites {
+		c.seenWrites, c.lastWrite = writes, now
+	}
+}
+
+// stats returns the statistics as of the last stamp. Callers hold c.mu.
+func (c *collectionAccess) stats() AccessStats {
+	return AccessStats{Reads: c.seenReads, Writes: c.seenWrites, LastRead: c.lastRead, LastWrite: c.lastWrite}
+}
+
+// run stamps the collections every accessStampInterval and persists the
+// statistics every interval, until stopped
+func (t *accessTracker) run(interval time.Duration) {
+	defer close(t.done)
+	stamp := time.NewTicker(accessStampInterval)
+	defer stamp.Stop()
+	persist := time.NewTicker(interval)
+	defer persist.Stop()
+	for {
+		select {
+		case <-t.stop:
+			return
+		case now := <-stamp.C:
+			t.stampAll(now)
+		case <-persist.C:
+			if err := t.persist(); err != nil {
+				t.e.logEvent(slog.LevelError, "failed to persist access statistics", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// stampAll stamps every collection
+func (t *accessTracker) stampAll(now time.Time) {
+	t.collections.Range(func(_, value interface{}) bool {
+		c := value.(*collectionAccess)
+		c.mu.Lock()
+		c.stamp(now)
+		c.mu.Unlock()
+		return true
+	})
+}
+
+// persist writes the statistics to the sidecar
+func (t *accessTracker) persist() error {
+	now := time.Now()
+	file := accessFile{Collections: make(map[string]persistedAccess)}
+	t.collections.Range(func(key, value interface{}) bool {
+		c := value.(*collectionAccess)
+		c.mu.Lock()
+		c.stamp(now)
+		file.Collections[key.(string)] = persistedAccess{AccessStats: c.stats(), Documents: maps.Clone(c.docs)}
+		c.mu.Unlock()
+		return true
+	})
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal access statistics: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(t.e.dataDir, accessStatsFileName), data); err != nil {
+		return fmt.Errorf("failed to write access statistics: %w", err)
+	}
+	return nil
+}
+
+// close stops the tracker and persists the statistics a last time
+func (t *accessTracker) close() error {
+	t.stopOnce.Do(func() { close(t.stop) })
+	<-t.done
+	return t.persist()
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestAccessStats(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithAccessStats(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	engine.WriteDocument("hot", "h1", core.Document{})
+	engine.WriteDocument("cold", "c1", core.Document{})
+	before := time.Now()
+
+	// Concurrent reads and writes are all counted
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				engine.ReadDocument("hot", "h1")
+				engine.ScanCollection("hot", func(core.DocumentID, core.Document) bool { return true })
+			}
+			engine.WriteDocument("hot", core.DocumentID(fmt.Sprint(g)), core.Document{})
+		}(g)
+	}
+	wg.Wait()
+
+	hot, err := engine.AccessStats("hot")
+	if err != nil {
+		t.Fatalf("Failed to get access stats: %v", err)
+	}
+	if hot.Reads != 800 || hot.Writes != 9 {
+		t.Errorf("Expected 800 reads and 9 writes, got %d and %d", hot.Reads, hot.Writes)
+	}
+	if hot.LastRead.Before(before) || hot.LastWrite.Before(before) {
+		t.Errorf("Expected recent access times, got %v and %v", hot.LastRead, hot.LastWrite)
+	}
+	cold, _ := engine.AccessStats("cold")
+	if cold.Reads != 0 || cold.Writes != 1 || !cold.LastRead.IsZero() {
+		t.Errorf("Expected the cold collection never read, got %+v", cold)
+	}
+	if missing, err := engine.AccessStats("missing"); err != nil || missing != (AccessStats{}) {
+		t.Errorf("Expected no stats for a missing collection, got %+v, %v", missing, err)
+	}
+
+	// The statistics survive a restart
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, accessStatsFileName)); err != nil {
+		t.Fatalf("Expected the statistics persisted: %v", err)
+	}
+	reopened, err := NewFileStorageEngine(dir, WithAccessStats(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer reopened.Close()
+	if collections, _ := reopened.ListCollections(); len(collections) != 2 {
+		t.Errorf("Expected the sidecar not listed as a collection, got %v", collections)
+	}
+	reopened.ReadDocument("hot", "h1")
+	again, _ := reopened.AccessStats("hot")
+	if again.Reads != 801 || again.Writes != 9 || !again.LastWrite.Equal(hot.LastWrite) {
+		t.Errorf("Expected the counts to carry on after reopening, got %+v", again)
+	}
+
+	// Dropping a collection forgets it
+	reopened.DropCollection("hot")
+	if dropped, _ := reopened.AccessStats("hot"); dropped.Reads != 0 {
+		t.Errorf("Expected no stats for a dropped collection, got %+v", dropped)
+	}
+}
+
+func TestAccessStatsPersistInterval(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithAccessStats(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	engine.WriteDocument("users", "u1", core.Document{})
+
+	// A crash loses at most the last interval
+	waitFor(t, "the statistics to be persisted", func() bool {
+		data, _ := os.ReadFile(filepath.Join(dir, accessStatsFileName))
+		return len(data) > 0
+	})
+}
+
+func TestTopDocuments(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithAccessStats(time.Hour), WithDocumentReadSampling(1, 3))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for _, id := range []core.DocumentID{"a", "b", "c", "d"} {
+		engine.WriteDocument("items", id, core.Document{})
+	}
+	reads := map[core.DocumentID]int{"a": 40, "b": 20, "c": 10, "d": 1}
+	for id, n := range reads {
+		for i := 0; i < n; i++ {
+			engine.ReadDocument("items", id)
+		}
+	}
+
+	// The limit of 3 documents makes room by halving the counts, so rarely
+	// read documents are dropped first
+	top, err := engine.TopDocuments("items", 2)
+	if err != nil {
+		t.Fatalf("Failed to get top documents: %v", err)
+	}
+	if len(top) != 2 || top[0].ID != "a" || top[1].ID != "b" || top[0].Reads < top[1].Reads {
+		t.Errorf("Expected a then b, got %v", top)
+	}
+	all, _ := engine.TopDocuments("items", -1)
+	if len(all) > 3 {
+		t.Errorf("Expected at most 3 documents tracked, got %v", all)
+	}
+
+	// Sampled counts persist too
+	engine.Close()
+	reopened, err := NewFileStorageEngine(dir, WithAccessStats(time.Hour), WithDocumentReadSampling(1, 3))
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer reopened.Close()
+	if again, _ := reopened.TopDocuments("items", 2); len(again) != 2 || again[0] != top[0] {
+		t.Errorf("Expected the top documents to survive reopening, got %v", again)
+	}
+}
+
+func TestAccessStatsDisabled(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+
+	engine.WriteDocument("users", "u1", core.Document{})
+	engine.RecordRead("users", "u1")
+	if _, err := engine.AccessStats("users"); err != ErrAccessStatsDisabled {
+		t.Errorf("Expected ErrAccessStatsDisabled, got %v", err)
+	}
+	if _, err := engine.TopDocuments("users", 1); err != ErrAccessStatsDisabled {
+		t.Errorf("Expected ErrAccessStatsDisabled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, accessStatsFileName)); !os.IsNotExist(err) {
+		t.Errorf("Expected no statistics file, got %v", err)
+	}
+}
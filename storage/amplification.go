@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// WriteStats are the writes of a collection since the engine opened. Every
+// write rewrites the whole collection file, so BytesWritten grows with the
+// file while LogicalBytes grows only with the documents changed.
+type WriteStats struct {
+	Collection   string
+	Writes       uint64 // Collection files written to disk
+	BytesWritten uint64 // Bytes of those files
+	LogicalBytes uint64 // Bytes of the documents changed, as compact JSON; IDs for deletes
+	FileBytes    int64  // Size of the last file written
+	Documents    int    // Documents in the last file written
+}
+
+// Amplification returns the bytes written per byte changed, or 0 before
+// any change
+func (s WriteStats) Amplification() float64 {
+	if s.LogicalBytes == 0 {
+		return 0
+	}
+	return float64(s.BytesWritten) / float64(s.LogicalBytes)
+}
+
+// AdviceThresholds are the limits past which a collection gets advice. A
+// zero limit is not checked.
+type AdviceThresholds struct {
+	FileBytes     int64
+	Documents     int
+	Amplification float64
+}
+
+// DefaultAdviceThresholds are the thresholds of "jsondb stats -advice"
+var DefaultAdviceThresholds = AdviceThresholds{FileBytes: 16 << 20, Documents: 100000, Amplification: 1000}
+
+// AdviceKind is the threshold an Advice is about
+type AdviceKind string
+
+const (
+	// AdviceFileSize is about the size of the collection file
+	AdviceFileSize AdviceKind = "file_size"
+	// AdviceDocuments is about the number of documents
+	AdviceDocuments AdviceKind = "documents"
+	// AdviceAmplification is about the bytes written per byte changed
+	AdviceAmplification AdviceKind = "amplification"
+)
+
+// Advice warns that a collection crossed a threshold
+type Advice struct {
+	Collection string
+	Kind       AdviceKind
+	Value      float64
+	Threshold  float64
+}
+
+// String describes the advice with a suggestion
+func (a Advice) String() string {
+	var what string
+	switch a.Kind {
+	case AdviceFileSize:
+		what = fmt.Sprintf("collection file is %.0f bytes (threshold %.0f)", a.Value, a.Threshold)
+	case AdviceDocuments:
+		what = fmt.Sprintf("collection holds %.0f documents (threshold %.0f)", a.Value, a.Threshold)
+	default:
+		what = fmt.Sprintf("write amplification is %.1f (threshold %.1f)", a.Value, a.Threshold)
+	}
+	return fmt.Sprintf("%s: %s, and every write rewrites the whole file; split it into smaller collections or namespaces, batch writes or enable write coalescing", a.Collection, what)
+}
+
+// Advise returns the advice for a collection's write statistics
+func Advise(stats WriteStats, t AdviceThresholds) []Advice {
+	var advice []Advice
+	if t.FileBytes > 0 && stats.FileBytes > t.FileBytes {
+		advice = append(advice, Advice{stats.Collection, AdviceFileSize, float64(stats.FileBytes), float64(t.FileBytes)})
+	}
+	if t.Documents > 0 && stats.Documents > t.Documents {
+		advice = append(advice, Advice{stats.Collection, AdviceDocuments, float64(stats.Documents), float64(t.Documents)})
+	}
+	if amplification := stats.Amplification(); t.Amplification > 0 && amplification > t.Amplification {
+		advice = append(advice, Advice{stats.Collection, AdviceAmplification, amplification, t.Amplification})
+	}
+	return advice
+}
+
+// WithWriteAdvice checks each collection against thresholds after every
+// write, and passes fn the advice once for each threshold the collection
+// crosses; it is given again only after the collection falls back below
+// the threshold and crosses it anew. A nil fn logs the advice as a
+// warning instead. fn runs while the collection is locked for writing, so
+// it must not use the engine.
+func WithWriteAdvice(t AdviceThresholds, fn func(Advice)) Option {
+	return func(c *Config) {
+		c.AdviceThresholds = &t
+		c.AdviceHandler = fn
+	}
+}
+
+// WriteStats returns the write statistics of a collection since the engine
+// opened
+func (e *FileStorageEngine) WriteStats(collection string) WriteStats {
+	return e.writes.stats(collection)
+}
+
+// EstimateWrites estimates the write statistics of a single-document update
+// of a collection from its file alone: the whole file written for one
+// document of average size. It reads the collection.
+func (e *FileStorageEngine) EstimateWrites(collection string) (WriteStats, error) {
+	size, err := e.CollectionSize(collection)
+	if err != nil {
+		return WriteStats{}, err
+	}
+	stats := WriteStats{Collection: collection, FileBytes: size}
+	var docBytes int
+	err = e.ScanCollection(collection, func(_ core.DocumentID, doc core.Document) bool {
+		data, err := json.Marshal(doc)
+		if err == nil {
+			docBytes += len(data)
+		}
+		stats.Documents++
+		return true
+	})
+	if err != nil {
+		return WriteStats{}, err
+	}
+	if stats.Documents > 0 {
+		stats.Writes = 1
+		stats.BytesWritten = uint64(size)
+		stats.LogicalBytes = uint64(max(docBytes/stats.Documents, 1))
+	}
+	return stats, nil
+}
+
+// writeTracker keeps the write statistics of an engine's collections. Its
+// zero value is ready to use.
+type writeTracker struct {
+	mu          sync.Mutex
+	collections map[string]*collectionWrites
+}
+
+// collectionWrites are the write statistics of a collection and the
+// thresholds it is past
+type collectionWrites struct {
+	stats WriteStats
+	above map[AdviceKind]bool
+}
+
+// collection returns the statistics of a collection, creating them.
+// Callers hold t.mu.
+func (t *writeTracker) collection(name string) *collectionWrites {
+	if t.collections == nil {
+		t.collections = make(map[string]*collectionWrites)
+	}
+	c, ok := t.collections[name]
+	if !ok {
+		c = &collectionWrites{stats: WriteStats{Collection: name}, above: make(map[AdviceKind]bool)}
+		t.collections[name] = c
+	}
+	return c
+}
+
+// wrote counts a collection file of n bytes holding documents written to
+// disk
+func (t *writeTracker) wrote(collection string, n, documents int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.collection(collection)
+	c.stats.Writes++
+	c.stats.BytesWritten += uint64(n)
+	c.stats.FileBytes = int64(n)
+	c.stats.Documents = documents
+}
+
+// changed counts the logical bytes of changes and returns the advice for
+// thresholds the collection has newly crossed
+func (t *writeTracker) changed(collection string, changes []change, thresholds *AdviceThresholds) []Advice {
+	var logical uint64
+	for _, ch := range changes {
+		if ch.op == core.OpDelete {
+			logical += uint64(len(ch.docID))
+			continue
+		}
+		if data, err := json.Marshal(ch.doc); err == nil {
+			logical += uint64(len(data))
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	c := t.collection(collection)
+	c.stats.LogicalBytes += logical
+	if thresholds == nil {
+		return nil
+	}
+
+	current := Advise(c.stats, *thresholds)
+	var crossed []Advice
+	now := make(map[AdviceKind]bool, len(current))
+	for _, advice := range current {
+		now[advice.Kind] = true
+		if !c.above[advice.Kind] {
+			crossed = append(crossed, advice)
+		}
+	}
+	c.above = now
+	return crossed
+}
+
+// stats returns the statistics of a collection
+func (t *writeTracker) stats(collection string) WriteStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.collections[collection]; ok {
+		return c.stats
+	}
+	return WriteStats{Collection: collection}
+}
+
+// all returns the statistics of every collection written, by name
+func (t *writeTracker) all() []WriteStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	all := make([]WriteStats, 0, len(t.collections))
+	for _, c := range t.collections {
+		all = append(all, c.stats)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Collection < all[j].Collection })
+	return all
+}
+
+// drop forgets the statistics of a dropped collection
+func (t *writeTracker) drop(collection string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.collections, collection)
+}
+
+// recordWrites counts applied changes and gives the advice they lead to
+func (e *FileStorageEngine) recordWrites(collection string, changes []change) {
+	for _, advice := range e.writes.changed(collection, changes, e.cfg.AdviceThresholds) {
+		if e.cfg.AdviceHandler != nil {
+			e.cfg.AdviceHandler(advice)
+			continue
+		}
+		e.logEvent(slog.LevelWarn, "collection write advice",
+			slog.String("collection", collection), slog.String("advice", advice.String()))
+	}
+}
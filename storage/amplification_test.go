@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestWriteAmplification(t *testing.T) {
+	dir := t.TempDir()
+	var advice []Advice
+	engine, err := NewFileStorageEngine(dir, WithWriteAdvice(AdviceThresholds{Documents: 50, Amplification: 20}, func(a Advice) {
+		advice = append(advice, a)
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// Every write adds the whole file to the bytes written, and only the
+	// document to the logical bytes
+	var written, logical uint64
+	fileSize := func() uint64 {
+		info, err := os.Stat(filepath.Join(dir, "events.json"))
+		if err != nil {
+			t.Fatalf("Failed to stat collection file: %v", err)
+		}
+		return uint64(info.Size())
+	}
+	if err := engine.CreateCollection("events"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	written += fileSize()
+
+	for i := 0; i < 100; i++ {
+		doc := core.Document{"n": float64(i), "payload": "xxxxxxxxxxxxxxxx"}
+		if err := engine.WriteDocument("events", core.DocumentID(fmt.Sprintf("e%03d", i)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+		data, _ := json.Marshal(doc)
+		written += fileSize()
+		logical += uint64(len(data))
+	}
+
+	stats := engine.WriteStats("events")
+	if stats.Writes != 101 || stats.BytesWritten != written || stats.LogicalBytes != logical {
+		t.Errorf("Expected 101 writes of %d bytes for %d logical, got %+v", written, logical, stats)
+	}
+	if stats.Documents != 100 || uint64(stats.FileBytes) != fileSize() {
+		t.Errorf("Expected the last file's size and documents, got %+v", stats)
+	}
+	expected := float64(written) / float64(logical)
+	if got := stats.Amplification(); got != expected || got < 20 {
+		t.Errorf("Expected amplification %.2f, got %.2f", expected, got)
+	}
+	engineStats, _ := engine.Stats()
+	if len(engineStats.Writes) != 1 || engineStats.Writes[0] != stats {
+		t.Errorf("Expected the write stats in Stats, got %+v", engineStats.Writes)
+	}
+
+	// Each threshold was crossed once, however many writes followed
+	counts := func() map[AdviceKind]int {
+		n := make(map[AdviceKind]int)
+		for _, a := range advice {
+			n[a.Kind]++
+		}
+		return n
+	}
+	if n := counts(); n[AdviceDocuments] != 1 || n[AdviceAmplification] != 1 || len(advice) != 2 {
+		t.Fatalf("Expected one advice per threshold, got %v", advice)
+	}
+	if advice[0].Kind != AdviceAmplification || advice[1].Kind != AdviceDocuments || advice[1].Value != 51 {
+		t.Errorf("Expected amplification advice before the 51st document, got %v", advice)
+	}
+
+	// Falling below a threshold and crossing it again gives the advice again
+	for i := 0; i < 60; i++ {
+		engine.DeleteDocument("events", core.DocumentID(fmt.Sprintf("e%03d", i)))
+	}
+	for i := 0; i < 20; i++ {
+		engine.WriteDocument("events", core.DocumentID(fmt.Sprintf("e%03d", i)), core.Document{})
+	}
+	if n := counts(); n[AdviceDocuments] != 2 || n[AdviceAmplification] != 1 {
+		t.Errorf("Expected a second documents advice only, got %v", advice)
+	}
+
+	if err := engine.DropCollection("events"); err != nil {
+		t.Fatalf("Failed to drop collection: %v", err)
+	}
+	if stats := engine.WriteStats("events"); stats.Writes != 0 {
+		t.Errorf("Expected the stats dropped with the collection, got %+v", stats)
+	}
+}
+
+func TestWriteAdviceLogged(t *testing.T) {
+	var buf bytes.Buffer
+	engine, err := NewFileStorageEngine(t.TempDir(),
+		WithLogger(slog.New(slog.NewTextHandler(&buf, nil))),
+		WithWriteAdvice(AdviceThresholds{FileBytes: 1000}, nil))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < 50; i++ {
+		engine.WriteDocument("logs", core.DocumentID(fmt.Sprint(i)), core.Document{"line": "some log line"})
+	}
+	if n := strings.Count(buf.String(), "collection write advice"); n != 1 {
+		t.Errorf("Expected the advice logged once, got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), "level=WARN") || !strings.Contains(buf.String(), "write coalescing") {
+		t.Errorf("Expected a warning with a suggestion, got %s", buf.String())
+	}
+}
+
+func TestEstimateWrites(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+
+	for i := 0; i < 10; i++ {
+		engine.WriteDocument("users", core.DocumentID(fmt.Sprint(i)), core.Document{"name": "0123456789"})
+	}
+	stats, err := engine.EstimateWrites("users")
+	if err != nil {
+		t.Fatalf("Failed to estimate writes: %v", err)
+	}
+	size, _ := engine.CollectionSize("users")
+	if stats.Documents != 10 || stats.FileBytes != size || stats.LogicalBytes != uint64(len(`{"name":"0123456789"}`)) {
+		t.Errorf("Unexpected estimate: %+v", stats)
+	}
+	if got := stats.Amplification(); got != float64(size)/float64(stats.LogicalBytes) {
+		t.Errorf("Expected the file size per document, got %.2f", got)
+	}
+	if advice := Advise(stats, AdviceThresholds{Amplification: 1}); len(advice) != 1 || advice[0].Kind != AdviceAmplification {
+		t.Errorf("Expected amplification advice, got %v", advice)
+	}
+}
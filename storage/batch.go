@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// change is one effective write of a batch
+type change struct {
+	op    core.OperationType
+	docID core.DocumentID
+	doc   core.Document
+}
+
+// ApplyBatch reads a collection, passes its documents to fn and writes the
+// returned writes back in a single atomic file write. The collection stays
+// locked throughout, so no other write can interleave between fn seeing the
+// documents and its writes landing. If fn fails or returns no writes, the
+// collection file is left untouched.
+func (e *FileStorageEngine) ApplyBatch(collection string, fn core.BatchFunc) error {
+	return e.ApplyBatchContext(context.Background(), collection, fn)
+}
+
+// ApplyBatchContext is ApplyBatch giving up while waiting for locks once ctx
+// is done. Documents given a key order with WithKeyOrder keep it, and the
+// revision change is recorded in the map set by core.WithRevisions.
+func (e *FileStorageEngine) ApplyBatchContext(ctx context.Context, collection string, fn core.BatchFunc) (err error) {
+	if e.instrumented() {
+		defer e.observe(opBatch, collection, "", time.Now(), &err)
+	}
+	if err := e.checkWritable(collection); err != nil {
+		return err
+	}
+
+	// Acquire file lock
+	lockFile, err := e.acquireFileLockContext(ctx, collection)
+	if err != nil {
+		return err
+	}
+	defer e.releaseFileLock(lockFile)
+
+	// Acquire write lock
+	waitStart := time.Now()
+	if err := core.LockContext(ctx, &e.mu); err != nil {
+		return fmt.Errorf("failed to lock collection %s: %w", collection, err)
+	}
+	e.observeLockWait(collection, waitStart)
+	defer e.mu.Unlock()
+
+	// Read current collection
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return err
+	}
+
+	writes, err := fn(documentMap(collFile))
+	if err != nil {
+		return err
+	}
+
+	if err := e.SyncIDFields(collection, writes); err != nil {
+		return err
+	}
+	if err := e.validateWrites(collection, collFile, writes); err != nil {
+		return err
+	}
+
+	from := collFile.Metadata.Revision
+	changes := applyWrites(collFile, writes, keyOrders(ctx, collection))
+	if len(changes) == 0 {
+		core.RecordRevision(ctx, collection, from, from)
+		return nil
+	}
+
+	// Write atomically
+	if _, err := e.writeCollectionFileAtomic(collection, collFile); err != nil {
+		return err
+	}
+	core.RecordRevision(ctx, collection, from, collFile.Metadata.Revision)
+
+	return e.recordChanges(collection, changes)
+}
+
+// InsertDocument inserts a document under the ID held in its ID key, or else
+// under a generated ID written into that key, and returns the ID used. See
+// core.IDOptions.InsertBatch.
+func (e *FileStorageEngine) InsertDocument(collection string, doc core.Document, opts core.IDOptions) (core.DocumentID, error) {
+	if opts.Key == "" {
+		opts.Key = e.cfg.IDField
+	}
+	var id core.DocumentID
+	if err := e.ApplyBatch(collection, opts.InsertBatch(doc, &id)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// documentMap returns the documents of a collection file keyed by ID
+func documentMap(collFile *CollectionFile) map[core.DocumentID]core.Document {
+	docs := make(map[core.DocumentID]core.Document, len(collFile.Documents))
+	for docID, doc := range collFile.Documents {
+		docs[core.DocumentID(docID)] = doc
+	}
+	return docs
+}
+
+// applyWrites applies writes to a collection file in ID order, so the oplog
+// order is deterministic, and returns the effective changes. Deleting a
+// document that does not exist is not a change. Written documents in orders
+// take its key order if the collection preserves key order.
+func applyWrites(collFile *CollectionFile, writes map[core.DocumentID]core.Document, orders map[core.DocumentID]core.OrderedDocument) []change {
+	ids := make([]core.DocumentID, 0, len(writes))
+	for docID := range writes {
+		ids = append(ids, docID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	changes := make([]change, 0, len(ids))
+	for _, docID := range ids {
+		_, existed := collFile.Documents[string(docID)]
+		doc := writes[docID]
+		switch {
+		case doc == nil && existed:
+			changes = append(changes, change{core.OpDelete, docID, nil})
+			delete(collFile.Documents, string(docID))
+		case doc == nil:
+		case existed:
+			changes = append(changes, change{core.OpUpdate, docID, doc})
+			collFile.Documents[string(docID)] = doc
+		default:
+			changes = append(changes, change{core.OpInsert, docID, doc})
+			collFile.Documents[string(docID)] = doc
+		}
+		if order, ok := orders[docID]; ok && doc != nil && collFile.Metadata.PreserveKeyOrder {
+			collFile.setOrder(docID, core.OrderDocument(doc, order))
+		}
+	}
+	return changes
+}
+
+// recordChanges counts applied changes in the write statistics, appends
+// them to the oplog, if enabled, and publishes them to watchers. Changes
+// held by the write coalescer are appended and published once written out.
+func (e *FileStorageEngine) recordChanges(collection string, changes []change) error {
+	e.recordWrites(collection, changes)
+	e.reads.drop(collection)
+	if e.coalescer.hold(collection, changes) {
+		return nil
+	}
+	return e.logChanges(e.oplog, collection, changes)
+}
+
+// logChanges appends applied changes to log, unless nil, and publishes them
+// to watchers
+func (e *FileStorageEngine) logChanges(log *oplog, collection string, changes []change) error {
+	if log == nil {
+		e.publishChanges(collection, changes, nil)
+		return nil
+	}
+
+	entries := make([]OplogEntry, 0, len(changes))
+	for _, c := range changes {
+		entry, err := log.append(c.op, collection, c.docID, c.doc)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	e.publishChanges(collection, changes, entries)
+	return nil
+}
+
+// publishChanges publishes applied changes to watchers, as their oplog
+// entries if there are any
+func (e *FileStorageEngine) publishChanges(collection string, changes []change, entries []OplogEntry) {
+	if e.watchers.active.Load() == 0 {
+		return
+	}
+	if entries == nil {
+		entries = changeEntries(collection, changes)
+	}
+	e.watchers.publish(entries)
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestApplyBatch(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.EnableOplog()
+	engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"})
+	engine.WriteDocument("users", "user_002", core.Document{"name": "Bob"})
+	before, _ := engine.CollectionRevision("users")
+
+	err := engine.ApplyBatch("users", func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		if len(docs) != 2 {
+			t.Errorf("Expected 2 documents, got %d", len(docs))
+		}
+		return map[core.DocumentID]core.Document{
+			"user_001": {"name": "Alice Updated"},
+			"user_002": nil,
+			"user_003": {"name": "Carol"},
+			"missing":  nil,
+		}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+
+	state := collectionState(t, engine, "users")
+	if len(state) != 2 || state["user_001"]["name"] != "Alice Updated" || state["user_003"]["name"] != "Carol" {
+		t.Errorf("Unexpected state after batch: %v", state)
+	}
+
+	// One file write for the whole batch
+	if after, _ := engine.CollectionRevision("users"); after != before+1 {
+		t.Errorf("Expected revision %d, got %d", before+1, after)
+	}
+
+	entries, _ := engine.ReadOplog(2, 0)
+	expected := []struct {
+		op    core.OperationType
+		docID core.DocumentID
+	}{
+		{core.OpUpdate, "user_001"},
+		{core.OpDelete, "user_002"},
+		{core.OpInsert, "user_003"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d oplog entries, got %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Op != expected[i].op || entry.DocID != expected[i].docID {
+			t.Errorf("Entry %d: expected %d on %s, got %d on %s", i, expected[i].op, expected[i].docID, entry.Op, entry.DocID)
+		}
+	}
+}
+
+func TestApplyBatchFailureLeavesCollectionUntouched(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"})
+	before, _ := engine.CollectionRevision("users")
+
+	boom := errors.New("boom")
+	err := engine.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{"user_001": nil}, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected the batch error, got %v", err)
+	}
+
+	// An empty batch does not rewrite the file either
+	engine.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return nil, nil
+	})
+
+	if after, _ := engine.CollectionRevision("users"); after != before {
+		t.Errorf("Expected revision to stay %d, got %d", before, after)
+	}
+	if _, err := engine.ReadDocument("users", "user_001"); err != nil {
+		t.Errorf("Expected document to survive a failed batch: %v", err)
+	}
+}
+
+func TestApplyBatchIsAtomicAgainstConcurrentWriters(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.WriteDocument("counters", "hits", core.Document{"n": 0})
+
+	// Read-modify-write inside a batch must never lose an increment
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := engine.ApplyBatch("counters", func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+				n, _ := core.ToFloat64(docs["hits"]["n"])
+				return map[core.DocumentID]core.Document{"hits": {"n": n + 1}}, nil
+			})
+			if err != nil {
+				t.Errorf("Failed to apply batch: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	doc, _ := engine.ReadDocument("counters", "hits")
+	if n, _ := core.ToFloat64(doc["n"]); n != 20 {
+		t.Errorf("Expected 20 increments, got %v", fmt.Sprint(doc["n"]))
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestCloseRejectsFurtherOperations(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.WriteDocument("items", "i1", core.Document{"n": 1}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	if err := engine.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"write", func() error { return engine.WriteDocument("items", "i2", core.Document{}) }},
+		{"read", func() error { _, err := engine.ReadDocument("items", "i1"); return err }},
+		{"delete", func() error { return engine.DeleteDocument("items", "i1") }},
+		{"scan", func() error {
+			return engine.ScanCollection("items", func(core.DocumentID, core.Document) bool { return true })
+		}},
+		{"batch", func() error {
+			return engine.ApplyBatch("items", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) { return nil, nil })
+		}},
+		{"create", func() error { return engine.CreateCollection("other") }},
+		{"drop", func() error { return engine.DropCollection("items") }},
+		{"list", func() error { _, err := engine.ListCollections(); return err }},
+		{"count", func() error { _, err := engine.CountDocuments("items"); return err }},
+		{"watch", func() error { _, err := engine.Watch(context.Background(), "items", WatchOptions{}); return err }},
+		{"oplog", func() error { return engine.EnableOplog() }},
+		{"namespace", func() error { _, err := engine.Namespace("acme"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, ErrEngineClosed) {
+				t.Errorf("Expected ErrEngineClosed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCloseWaitsForWritesInFlight(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	batch := make(chan error, 1)
+	go func() {
+		batch <- engine.ApplyBatch("items", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			close(started)
+			<-release
+			return map[core.DocumentID]core.Document{"i1": {"n": 1}}, nil
+		})
+	}()
+	<-started
+
+	closed := make(chan error, 1)
+	go func() { closed <- engine.Close() }()
+	select {
+	case err := <-closed:
+		t.Fatalf("Expected Close to wait for the batch, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-batch; err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	if err := <-closed; err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+
+	reopened, err := NewFileStorageEngine(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.ReadDocument("items", "i1"); err != nil {
+		t.Errorf("Expected the batch written before Close returned, got %v", err)
+	}
+}
+
+func TestCloseEndsWatches(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	w, err := engine.Watch(context.Background(), "", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	engine.Close()
+	select {
+	case _, ok := <-w.C:
+		if ok {
+			t.Fatal("Expected no change")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected Close to end the watch")
+	}
+	if w.Err() != nil {
+		t.Errorf("Expected no error for a watch ended by Close, got %v", w.Err())
+	}
+}
+
+func TestCloseWithConcurrentWriters(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	const writers = 8
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		acked []core.DocumentID
+	)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				docID := core.DocumentID(fmt.Sprintf("w%d_%d", w, i))
+				err := engine.WriteDocument(fmt.Sprintf("coll_%d", w%3), docID, core.Document{"i": i})
+				if errors.Is(err, ErrEngineClosed) {
+					return
+				}
+				if err != nil {
+					t.Errorf("Expected the write to succeed or fail with ErrEngineClosed, got %v", err)
+					return
+				}
+				mu.Lock()
+				acked = append(acked, docID)
+				mu.Unlock()
+			}
+		}(w)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	wg.Wait()
+
+	reopened, err := NewFileStorageEngine(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer reopened.Close()
+	if len(acked) == 0 {
+		t.Fatal("Expected some writes before Close")
+	}
+	for _, docID := range acked {
+		var w, i int
+		fmt.Sscanf(string(docID), "w%d_%d", &w, &i)
+		if _, err := reopened.ReadDocument(fmt.Sprintf("coll_%d", w%3), docID); err != nil {
+			t.Fatalf("Expected acknowledged write %s to survive Close, got %v", docID, err)
+		}
+	}
+}
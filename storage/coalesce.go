@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WithWriteCoalescing keeps rewritten collection files in memory and writes
+// each to disk at most once per window, or as soon as maxPending writes have
+// been coalesced into it if maxPending is positive. Reads see every write
+// at once. A write is acknowledged before it reaches the disk, so a crash
+// loses the writes of up to the last window; Flush and Close write
+// everything out. Writes reach the oplog and watchers once on disk. Files that reach the disk are synced as the sync mode
+// says. The engine must be the only one writing to the data directory,
+// since other processes do not see unflushed writes.
+func WithWriteCoalescing(window time.Duration, maxPending int) Option {
+	return func(c *Config) {
+		c.CoalesceWindow = window
+		c.CoalesceMaxPending = maxPending
+	}
+}
+
+// WithFlushErrorHandler sets the function told about background flushes of
+// coalesced writes that fail. The writes stay in memory and are retried at
+// the next flush. Without a handler the errors are logged.
+func WithFlushErrorHandler(fn func(collection string, err error)) Option {
+	return func(c *Config) {
+		c.FlushErrorHandler = fn
+	}
+}
+
+// Flush writes the collection files holding coalesced writes to disk, in
+// this engine and its opened namespaces. It does nothing unless the engine
+// was created WithWriteCoalescing.
+func (e *FileStorageEngine) Flush() error {
+	if e.closed.Load() {
+		return ErrEngineClosed
+	}
+
+	var errs []error
+	if e.coalescer != nil {
+		for _, collection := range e.coalescer.collections() {
+			if err := e.coalescer.flush(collection); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	e.namespacesMu.Lock()
+	defer e.namespacesMu.Unlock()
+	for name, ns := range e.namespaces {
+		if err := ns.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to flush namespace %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// coalescer holds the collection files rewritten since they were last
+// written to disk, writing them out in the background
+type coalescer struct {
+	e          *FileStorageEngine
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[string]*pendingFile // Unwritten collection files, by collection
+
+	kick     chan struct{} // Signals a file reaching maxPending writes
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// pendingFile is the latest content of a collection file not yet on disk.
+// The data is never modified once stored, so readers may use it unlocked.
+type pendingFile struct {
+	data      []byte
+	documents int
+	writes    int      // Writes coalesced into data
+	changes   []change // Of the writes, recorded once data is on disk
+}
+
+// newCoalescer starts writing an engine's coalesced files out every window
+func newCoalescer(e *FileStorageEngine, window time.Duration, maxPending int) *coalescer {
+	c := &coalescer{
+		e:          e,
+		maxPending: maxPending,
+		pending:    make(map[string]*pendingFile),
+		kick:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go c.run(window)
+	return c
+}
+
+// get returns the unwritten content of a collection file, or nil if the
+// file on disk is current
+func (c *coalescer) get(collection string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pending[collection]; ok {
+		return p.data
+	}
+	return nil
+}
+
+// put holds a rewrite of a collection file, whose writer holds the
+// collection's file lock, for writing out later. A file not yet on disk is
+// not held, so the collection exists for other readers of the directory,
+// and put reports false for the caller to write it.
+func (c *coalescer) put(collection string, data []byte, documents int) bool {
+	c.mu.Lock()
+	p, ok := c.pending[collection]
+	c.mu.Unlock()
+	if !ok {
+		if _, err := os.Stat(c.e.getCollectionPath(collection)); err != nil {
+			return false
+		}
+		p = &pendingFile{}
+	}
+
+	held := &pendingFile{data: bytes.Clone(data), documents: documents, writes: p.writes + 1, changes: p.changes}
+	c.mu.Lock()
+	c.pending[collection] = held
+	c.mu.Unlock()
+
+	if c.maxPending > 0 && held.writes >= c.maxPending {
+		select {
+		case c.kick <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// hold keeps the changes of a write just held by put, to be recorded once
+// the file is written out, reporting false if the collection holds no
+// unwritten file. It does nothing on a nil coalescer.
+func (c *coalescer) hold(collection string, changes []change) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.pending[collection]
+	if ok {
+		p.changes = append(p.changes, changes...)
+	}
+	return ok
+}
+
+// held returns the changes of the writes held for a collection. It returns
+// nil on a nil coalescer.
+func (c *coalescer) held(collection string) []change {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pending[collection]; ok {
+		return slices.Clone(p.changes)
+	}
+	return nil
+}
+
+// discard drops the unwritten content of a collection file that has been
+// replaced or removed on disk. It does nothing on a nil coalescer.
+func (c *coalescer) discard(collection string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.pending, collection)
+	c.mu.Unlock()
+}
+
+// collections returns the collections with unwritten files, sorted
+func (c *coalescer) collections() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := make([]string, 0, len(c.pending))
+	for collection := range c.pending {
+		names = append(names, collection)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// run writes the held files out every window, and when one reaches
+// maxPending writes, until stopped
+func (c *coalescer) run(window time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+		for _, collection := range c.collections() {
+			if err := c.flush(collection); err != nil && !errors.Is(err, ErrEngineClosed) {
+				c.report(collection, err)
+			}
+		}
+	}
+}
+
+// report passes a failed background flush to the error handler, or logs it
+func (c *coalescer) report(collection string, err error) {
+	if fn := c.e.cfg.FlushErrorHandler; fn != nil {
+		fn(collection, err)
+		return
+	}
+	c.e.logEvent(slog.LevelError, "failed to flush collection file", slog.String("collection", collection), slog.Any("error", err))
+}
+
+// flush writes a collection's held file out under its file lock. On
+// failure the file stays held, to be retried.
+func (c *coalescer) flush(collection string) error {
+	l, err := c.e.acquireFileLock(collection)
+	if err != nil {
+		return err
+	}
+	defer c.e.releaseFileLock(l)
+	return c.write(collection)
+}
+
+// write writes a collection's held file out, then appends the changes of
+// its writes to the oplog and publishes them to watchers, now that they are
+// durable. Callers must hold the collection's file lock.
+func (c *coalescer) write(collection string) error {
+	c.mu.Lock()
+	p, ok := c.pending[collection]
+	var changes []change
+	if ok {
+		changes = p.changes
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	if err := c.e.replaceCollectionFile(c.e.getCollectionPath(collection), p.data); err != nil {
+		return fmt.Errorf("failed to flush collection %s: %w", collection, err)
+	}
+	c.e.observeFile(collection, len(p.data), p.documents)
+	c.discard(collection)
+	return c.e.logChanges(c.e.currentOplog(), collection, changes)
+}
+
+// writeHeld writes a collection's held file out during Close, which holds
+// the lock's mutex but has taken it out of the locks map, so the file lock
+// is taken directly
+func (c *coalescer) writeHeld(collection string, l *fileLock) error {
+	if l.file == nil {
+		return c.write(collection)
+	}
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("failed to acquire file lock: %w", err)
+	}
+	defer syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	return c.write(collection)
+}
+
+// close stops the background flushes. The files still held are written
+// out by Close as it drains each collection.
+func (c *coalescer) close() {
+	c.stopOnce.Do(func() { close(c.stop) })
+	<-c.done
+}
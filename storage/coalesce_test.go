@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// diskFile parses a collection file as it is on disk, as a crash would
+// leave it
+func diskFile(t *testing.T, dir, collection string) CollectionFile {
+	t.Helper()
+	var collFile CollectionFile
+	data, err := os.ReadFile(filepath.Join(dir, collection+".json"))
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	if err := json.Unmarshal(data, &collFile); err != nil {
+		t.Fatalf("Failed to parse collection file: %v", err)
+	}
+	return collFile
+}
+
+// waitFor polls cond until it holds, failing after a second
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithWriteCoalescing(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	// The first write creates the file; the others stay in memory, where
+	// reads see them
+	for i := 0; i < 50; i++ {
+		if err := engine.WriteDocument("events", core.DocumentID(fmt.Sprintf("e%02d", i)), core.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	if err := engine.DeleteDocument("events", "e00"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if count, _ := engine.CountDocuments("events"); count != 49 {
+		t.Errorf("Expected 49 documents, got %d", count)
+	}
+	if revision, _ := engine.CollectionRevision("events"); revision != 51 {
+		t.Errorf("Expected revision 51, got %d", revision)
+	}
+	if onDisk := diskFile(t, dir, "events"); len(onDisk.Documents) != 1 || onDisk.Metadata.Revision != 1 {
+		t.Errorf("Expected only the first write on disk, got %d documents at revision %d", len(onDisk.Documents), onDisk.Metadata.Revision)
+	}
+
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	if onDisk := diskFile(t, dir, "events"); len(onDisk.Documents) != 49 || onDisk.Metadata.Revision != 51 {
+		t.Errorf("Expected every write on disk after Flush, got %d documents at revision %d", len(onDisk.Documents), onDisk.Metadata.Revision)
+	}
+
+	// Close writes out what is left
+	engine.WriteDocument("events", "last", core.Document{})
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if onDisk := diskFile(t, dir, "events"); len(onDisk.Documents) != 50 {
+		t.Errorf("Expected the last write on disk after Close, got %d documents", len(onDisk.Documents))
+	}
+	if err := engine.Flush(); err != ErrEngineClosed {
+		t.Errorf("Expected ErrEngineClosed, got %v", err)
+	}
+}
+
+func TestWriteCoalescingTriggers(t *testing.T) {
+	tests := []struct {
+		name       string
+		window     time.Duration
+		maxPending int
+		writes     int
+	}{
+		{"window", 20 * time.Millisecond, 0, 5},
+		{"pending writes", time.Hour, 10, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			engine, err := NewFileStorageEngine(dir, WithWriteCoalescing(tt.window, tt.maxPending))
+			if err != nil {
+				t.Fatalf("Failed to create engine: %v", err)
+			}
+			defer engine.Close()
+
+			for i := 0; i < tt.writes; i++ {
+				engine.WriteDocument("events", core.DocumentID(fmt.Sprint(i)), core.Document{})
+			}
+			waitFor(t, "the writes to reach the disk", func() bool {
+				return len(diskFile(t, dir, "events").Documents) == tt.writes
+			})
+		})
+	}
+}
+
+func TestWriteCoalescingCrash(t *testing.T) {
+	dir := t.TempDir()
+	window := 10 * time.Millisecond
+	engine, err := NewFileStorageEngine(dir, WithWriteCoalescing(window, 0))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// What is on disk at any moment is the collection as of one earlier
+	// write, never a mix: documents are written in order, so it holds a
+	// prefix of them
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			engine.WriteDocument("events", core.DocumentID(fmt.Sprintf("e%03d", i)), core.Document{"n": i})
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		time.Sleep(window / 2)
+		if _, err := os.Stat(filepath.Join(dir, "events.json")); err != nil {
+			continue
+		}
+		onDisk := diskFile(t, dir, "events")
+		for j := 0; j < len(onDisk.Documents); j++ {
+			if _, ok := onDisk.Documents[fmt.Sprintf("e%03d", j)]; !ok {
+				t.Fatalf("Expected a prefix of the writes on disk, missing e%03d of %d", j, len(onDisk.Documents))
+			}
+		}
+		if int(onDisk.Metadata.Revision) != len(onDisk.Documents) {
+			t.Fatalf("Expected revision %d for %d documents", onDisk.Metadata.Revision, len(onDisk.Documents))
+		}
+	}
+	wg.Wait()
+
+	// Once writes stop, the last window reaches the disk without a Flush
+	waitFor(t, "the last window to reach the disk", func() bool {
+		return len(diskFile(t, dir, "events").Documents) == 200
+	})
+}
+
+func TestWriteCoalescingPublishesOnFlush(t *testing.T) {
+	engine, err := NewFileStorageEngine(t.TempDir(), WithWriteCoalescing(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	w, err := engine.Watch(context.Background(), "events", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+
+	// The first write creates the file, so it is on disk at once
+	engine.WriteDocument("events", "e1", core.Document{"n": 1})
+	if entry := <-w.C; entry.DocID != "e1" || entry.Seq != 1 {
+		t.Fatalf("Expected e1 at seq 1, got %+v", entry)
+	}
+
+	// Held writes reach the oplog and watchers only once flushed
+	engine.WriteDocument("events", "e2", core.Document{"n": 2})
+	engine.DeleteDocument("events", "e1")
+	if seq, _ := engine.LastOplogSeq(); seq != 1 {
+		t.Errorf("Expected held writes kept out of the oplog, got seq %d", seq)
+	}
+	select {
+	case entry := <-w.C:
+		t.Fatalf("Expected no change published before the flush, got %+v", entry)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := engine.Flush(); err != nil {
+		t.Fatalf("Failed to flush: %v", err)
+	}
+	for _, expected := range []OplogEntry{{Seq: 2, Op: core.OpInsert, DocID: "e2"}, {Seq: 3, Op: core.OpDelete, DocID: "e1"}} {
+		entry := <-w.C
+		if entry.Seq != expected.Seq || entry.Op != expected.Op || entry.DocID != expected.DocID {
+			t.Errorf("Expected op %v of %s at seq %d, got %+v", expected.Op, expected.DocID, expected.Seq, entry)
+		}
+	}
+
+	// A batch replacing the file logs the held writes it carries to disk first
+	engine.WriteDocument("events", "e3", core.Document{"n": 3})
+	engine.WriteDocument("audit", "a0", core.Document{})
+	err = engine.ApplyMultiBatch([]string{"events", "audit"}, func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		return map[string]map[core.DocumentID]core.Document{"events": {"e4": {}}, "audit": {"a1": {}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	entries, _ := engine.ReadOplog(3, 0)
+	var got []core.DocumentID
+	for _, entry := range entries {
+		got = append(got, entry.DocID)
+	}
+	if expected := []core.DocumentID{"a0", "a1", "e3", "e4"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected oplog entries %v, got %v", expected, got)
+	}
+}
+
+func TestWriteCoalescingFlushErrors(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	var failed []string
+	engine, err := NewFileStorageEngine(dir, WithWriteCoalescing(10*time.Millisecond, 0), WithFlushErrorHandler(func(collection string, err error) {
+		mu.Lock()
+		failed = append(failed, collection)
+		mu.Unlock()
+	}))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	// A directory in the way of the temporary file makes flushes fail
+	engine.WriteDocument("events", "e1", core.Document{})
+	blocker := filepath.Join(dir, "events.json.tmp")
+	if err := os.Mkdir(blocker, 0755); err != nil {
+		t.Fatalf("Failed to block flushes: %v", err)
+	}
+	engine.WriteDocument("events", "e2", core.Document{})
+	waitFor(t, "a failed flush", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(failed) > 0
+	})
+	mu.Lock()
+	if failed[0] != "events" {
+		t.Errorf("Expected the failure reported for events, got %v", failed)
+	}
+	mu.Unlock()
+	if err := engine.Flush(); err == nil {
+		t.Errorf("Expected Flush to fail")
+	}
+	if _, err := engine.ReadDocument("events", "e2"); err != nil {
+		t.Errorf("Expected the write kept after failed flushes, got %v", err)
+	}
+
+	// The next flush retries
+	os.Remove(blocker)
+	waitFor(t, "the retried flush", func() bool {
+		return len(diskFile(t, dir, "events").Documents) == 2
+	})
+}
+
+func TestWriteCoalescingCollections(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithWriteCoalescing(time.Hour, 0))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	// A dropped collection is not brought back by a flush
+	engine.WriteDocument("dropped", "d1", core.Document{})
+	engine.WriteDocument("dropped", "d2", core.Document{})
+	if err := engine.DropCollection("dropped"); err != nil {
+		t.Fatalf("Failed to drop collection: %v", err)
+	}
+
+	// A multi-collection batch replaces the files with what it read
+	engine.WriteDocument("a", "a1", core.Document{})
+	engine.WriteDocument("a", "a2", core.Document{})
+	engine.WriteDocument("b", "b1", core.Document{})
+	err = engine.ApplyMultiBatch([]string{"a", "b"}, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		return map[string]map[core.DocumentID]core.Document{"a": {"a3": {}}, "b": {"b2": {}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	if onDisk := diskFile(t, dir, "a"); len(onDisk.Documents) != 3 {
+		t.Errorf("Expected the batch to write the coalesced documents, got %v", onDisk.Documents)
+	}
+
+	// Namespaces coalesce too
+	ns, err := engine.Namespace("acme")
+	if err != nil {
+		t.Fatalf("Failed to open namespace: %v", err)
+	}
+	ns.WriteDocument("users", "u1", core.Document{})
+	ns.WriteDocument("users", "u2", core.Document{})
+	nsDir := filepath.Join(dir, NamespaceDir, "acme")
+	if onDisk := diskFile(t, nsDir, "users"); len(onDisk.Documents) != 1 {
+		t.Errorf("Expected the namespace to coalesce writes, got %d documents on disk", len(onDisk.Documents))
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "dropped.json")); !os.IsNotExist(err) {
+		t.Errorf("Expected the dropped collection to stay gone, got %v", err)
+	}
+	if onDisk := diskFile(t, nsDir, "users"); len(onDisk.Documents) != 2 {
+		t.Errorf("Expected Close to flush the namespace, got %d documents on disk", len(onDisk.Documents))
+	}
+}
@@ -0,0 +1,524 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+// ErrCompactionPaused is returned by CompactCollection while compaction is
+// paused with PauseCompaction
+var ErrCompactionPaused = errors.New("compaction is paused")
+
+// CompactionPolicy decides when a collection is compacted automatically.
+// Collection files hold only live documents, as every write rewrites them,
+// so a collection's dead space is in the oplog: the entries of its
+// documents that later entries supersede.
+type CompactionPolicy struct {
+	// DeadSpaceRatio compacts a collection once its superseded entries make
+	// up more than this share of its oplog bytes; 0 never does
+	DeadSpaceRatio float64 `json:"dead_space_ratio,omitempty"`
+	// Interval compacts a collection with any dead space this long after
+	// its last compaction; 0 never does
+	Interval time.Duration `json:"interval,omitempty"`
+	// Disabled leaves the collection alone, for overriding the engine's
+	// policy with SetCompactionPolicy
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// validate checks that a policy's settings are in range
+func (p CompactionPolicy) validate() error {
+	if p.DeadSpaceRatio < 0 || p.DeadSpaceRatio >= 1 {
+		return fmt.Errorf("%w: dead space ratio must be at least 0 and below 1, got %v", ErrInvalidConfig, p.DeadSpaceRatio)
+	}
+	if p.Interval < 0 {
+		return fmt.Errorf("%w: compaction interval cannot be negative, got %v", ErrInvalidConfig, p.Interval)
+	}
+	return nil
+}
+
+// WithAutoCompaction checks every collection against policy each
+// checkInterval, in the background, and compacts those it calls for one at
+// a time. SetCompactionPolicy overrides the policy for a collection.
+// Compaction needs the oplog; until EnableOplog is called there is nothing
+// to compact.
+func WithAutoCompaction(policy CompactionPolicy, checkInterval time.Duration) Option {
+	return func(c *Config) {
+		c.Compaction = &policy
+		c.CompactionCheckInterval = checkInterval
+	}
+}
+
+// DeadSpace is how much of the oplog a collection's entries take, and how
+// much of that later entries supersede
+type DeadSpace struct {
+	Collection string
+	OplogBytes int64
+	DeadBytes  int64
+}
+
+// Ratio returns the share of the collection's oplog bytes that is dead, or
+// 0 without any
+func (d DeadSpace) Ratio() float64 {
+	if d.OplogBytes == 0 {
+		return 0
+	}
+	return float64(d.DeadBytes) / float64(d.OplogBytes)
+}
+
+// DeadSpace returns the dead space of a collection in the oplog
+func (e *FileStorageEngine) DeadSpace(collection string) (DeadSpace, error) {
+	log := e.currentOplog()
+	if log == nil {
+		return DeadSpace{}, ErrOplogDisabled
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.space.deadSpace(collection), nil
+}
+
+// CompactCollection removes the oplog entries of a collection's documents
+// that later entries supersede and returns the bytes reclaimed. The latest
+// entry of every document stays, so replicas still converge, and reads as
+// of a moment before the latest entry removed fail with
+// ErrHistoryUnavailable for documents the remaining entries cannot vouch
+// for, rather than returning a wrong state. The log is copied without blocking writes; they
+// wait only while the copy takes what they appended meanwhile and replaces
+// the log. One compaction runs at a time, and none while paused.
+func (e *FileStorageEngine) CompactCollection(collection string) (int64, error) {
+	log := e.currentOplog()
+	if log == nil {
+		return 0, ErrOplogDisabled
+	}
+	if e.readOnly {
+		return 0, fmt.Errorf("failed to compact collection %s: %w", collection, ErrReadOnly)
+	}
+
+	e.compaction.mu.Lock()
+	defer e.compaction.mu.Unlock()
+	if e.compaction.paused.Load() > 0 {
+		return 0, fmt.Errorf("failed to compact collection %s: %w", collection, ErrCompactionPaused)
+	}
+	return e.compact(log, collection)
+}
+
+// compact compacts a collection and records it. Callers hold
+// e.compaction.mu.
+func (e *FileStorageEngine) compact(log *oplog, collection string) (int64, error) {
+	start := time.Now()
+	reclaimed, err := log.compact(collection, e.compactHook)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compact collection %s: %w", collection, err)
+	}
+	if reclaimed == 0 {
+		return 0, nil
+	}
+	e.compaction.record(collection, reclaimed)
+	e.logEvent(slog.LevelInfo, "collection compacted", slog.String("collection", collection),
+		slog.Int64("reclaimed_bytes", reclaimed), slog.Duration("duration", time.Since(start)))
+	return reclaimed, nil
+}
+
+// PauseCompaction stops compaction, such as while a backup copies the
+// data directory, waiting for one that is running to finish. Pauses nest:
+// compaction resumes once every pause is matched by ResumeCompaction.
+func (e *FileStorageEngine) PauseCompaction() {
+	e.compaction.mu.Lock()
+	e.compaction.paused.Add(1)
+	e.compaction.mu.Unlock()
+}
+
+// ResumeCompaction undoes one PauseCompaction
+func (e *FileStorageEngine) ResumeCompaction() {
+	e.compaction.mu.Lock()
+	if e.compaction.paused.Load() > 0 {
+		e.compaction.paused.Add(-1)
+	}
+	e.compaction.mu.Unlock()
+}
+
+// SetCompactionPolicy stores a collection's own compaction policy, which
+// overrides the one given to WithAutoCompaction. A nil policy removes it.
+func (e *FileStorageEngine) SetCompactionPolicy(collection string, policy *CompactionPolicy) error {
+	if policy != nil {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+	}
+	err := e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.Compaction = nil
+		if policy != nil {
+			p := *policy
+			metadata.Compaction = &p
+		}
+	})
+	if err != nil {
+		return err
+	}
+	e.compaction.override(collection, policy)
+	return nil
+}
+
+// CompactionPolicy returns the compaction policy stored with a collection,
+// or nil if it has none
+func (e *FileStorageEngine) CompactionPolicy(collection string) (*CompactionPolicy, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collFile.Metadata.Compaction, nil
+}
+
+// compactor runs the compactions of an engine, one at a time. Its zero
+// value is ready to use and runs none on its own.
+type compactor struct {
+	mu        sync.Mutex                   // Held while a compaction runs
+	paused    atomic.Int32                 // Pauses not yet resumed, changed under mu
+	overrides map[string]*CompactionPolicy // Policies of collections, nil for none, once loaded
+	last      map[string]time.Time         // When each collection was last compacted
+	now       func() time.Time             // Nil uses time.Now; set by tests
+
+	statsMu   sync.Mutex
+	runs      uint64
+	lastAt    time.Time
+	lastBytes int64
+	reclaimed int64
+
+	stop chan struct{} // Nil unless checking in the background
+	done chan struct{}
+}
+
+// clock returns the current time
+func (c *compactor) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// record counts a compaction
+func (c *compactor) record(collection string, reclaimed int64) {
+	now := c.clock()
+	if c.last == nil {
+		c.last = make(map[string]time.Time)
+	}
+	c.last[collection] = now
+
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.runs++
+	c.lastAt = now
+	c.lastBytes = reclaimed
+	c.reclaimed += reclaimed
+}
+
+// override keeps the policy of a collection set with SetCompactionPolicy
+func (c *compactor) override(collection string, policy *CompactionPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.overrides == nil {
+		c.overrides = make(map[string]*CompactionPolicy)
+	}
+	c.overrides[collection] = policy
+}
+
+// start checks the engine's collections every interval until closed
+func (c *compactor) start(e *FileStorageEngine, interval time.Duration) {
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				if err := e.autoCompact(); err != nil {
+					e.logEvent(slog.LevelError, "failed to compact collections", slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// close stops checking in the background, waiting for a compaction that
+// is running
+func (c *compactor) close() {
+	if c.stop != nil {
+		close(c.stop)
+		<-c.done
+		c.stop = nil
+	}
+}
+
+// autoCompact compacts the collections their policies call for, unless
+// compaction is paused
+func (e *FileStorageEngine) autoCompact() error {
+	log := e.currentOplog()
+	if log == nil || e.cfg.Compaction == nil {
+		return nil
+	}
+	e.compaction.mu.Lock()
+	defer e.compaction.mu.Unlock()
+	if e.compaction.paused.Load() > 0 {
+		return nil
+	}
+
+	log.mu.Lock()
+	spaces := log.space.all()
+	log.mu.Unlock()
+
+	var errs []error
+	for _, space := range spaces {
+		policy := e.compactionPolicy(space.Collection)
+		if policy.Disabled || space.DeadBytes == 0 {
+			continue
+		}
+		last, ok := e.compaction.last[space.Collection]
+		if !ok {
+			last = e.openedAt
+		}
+		due := policy.DeadSpaceRatio > 0 && space.Ratio() > policy.DeadSpaceRatio
+		if policy.Interval > 0 && e.compaction.clock().Sub(last) >= policy.Interval {
+			due = true
+		}
+		if !due {
+			continue
+		}
+		if _, err := e.compact(log, space.Collection); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// compactionPolicy returns the policy of a collection: its own if it has
+// one, else the engine's. Callers hold e.compaction.mu.
+func (e *FileStorageEngine) compactionPolicy(collection string) CompactionPolicy {
+	if e.compaction.overrides == nil {
+		e.compaction.overrides = make(map[string]*CompactionPolicy)
+	}
+	policy, loaded := e.compaction.overrides[collection]
+	if !loaded {
+		if stored, err := e.CompactionPolicy(collection); err == nil {
+			policy = stored
+		}
+		e.compaction.overrides[collection] = policy
+	}
+	if policy != nil {
+		return *policy
+	}
+	return *e.cfg.Compaction
+}
+
+// oplogSpace counts the bytes of the oplog's entries, by collection. Its
+// zero value is ready to use.
+type oplogSpace struct {
+	collections map[string]*collectionSpace
+}
+
+// collectionSpace counts the bytes of a collection's oplog entries
+type collectionSpace struct {
+	bytes  int64
+	dead   int64                     // Of entries later entries supersede
+	latest map[core.DocumentID]int64 // Size of each document's latest entry
+}
+
+// add counts an entry of n bytes
+func (s *oplogSpace) add(collection string, docID core.DocumentID, n int64) {
+	if s.collections == nil {
+		s.collections = make(map[string]*collectionSpace)
+	}
+	c, ok := s.collections[collection]
+	if !ok {
+		c = &collectionSpace{latest: make(map[core.DocumentID]int64)}
+		s.collections[collection] = c
+	}
+	c.bytes += n
+	if previous, ok := c.latest[docID]; ok {
+		c.dead += previous
+	}
+	c.latest[docID] = n
+}
+
+// deadSpace returns the dead space of a collection
+func (s *oplogSpace) deadSpace(collection string) DeadSpace {
+	space := DeadSpace{Collection: collection}
+	if c, ok := s.collections[collection]; ok {
+		space.OplogBytes, space.DeadBytes = c.bytes, c.dead
+	}
+	return space
+}
+
+// all returns the dead space of every collection in the log, by name
+func (s *oplogSpace) all() []DeadSpace {
+	all := make([]DeadSpace, 0, len(s.collections))
+	for collection := range s.collections {
+		all = append(all, s.deadSpace(collection))
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Collection < all[j].Collection })
+	return all
+}
+
+// compact rewrites the log without the entries of a collection that later
+// entries of the same documents supersede, and returns the bytes removed.
+// The log is copied without holding l.mu, which is taken only to append
+// the entries written meanwhile to the copy and swap it in. hook, if set,
+// runs between the two.
+func (l *oplog) compact(collection string, hook func()) (int64, error) {
+	l.rewriteMu.Lock()
+	defer l.rewriteMu.Unlock()
+
+	l.mu.Lock()
+	end := l.size
+	l.mu.Unlock()
+
+	path := filepath.Join(l.dir, oplogFileName)
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open oplog: %w", err)
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, end))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read oplog: %w", err)
+	}
+
+	// Only the document of each entry is needed
+	type entryKey struct {
+		Collection string          `json:"coll"`
+		DocID      core.DocumentID `json:"id"`
+		Timestamp  time.Time       `json:"ts"`
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	keys := make([]entryKey, len(lines))
+	latest := make(map[core.DocumentID]int)
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &keys[i]); err != nil {
+			return 0, fmt.Errorf("failed to parse oplog entry: %w", err)
+		}
+		if keys[i].Collection == collection {
+			latest[keys[i].DocID] = i
+		}
+	}
+
+	var kept bytes.Buffer
+	var reclaimed int64
+	watermark := l.compacted[collection]
+	for i, line := range lines {
+		if keys[i].Collection == collection && latest[keys[i].DocID] != i {
+			reclaimed += int64(len(line))
+			if keys[i].Timestamp.After(watermark) {
+				watermark = keys[i].Timestamp
+			}
+			continue
+		}
+		kept.Write(line)
+	}
+	if reclaimed == 0 {
+		return 0, nil
+	}
+
+	// Recorded before the entries go, so a crash cannot lose it
+	compacted := maps.Clone(l.compacted)
+	compacted[collection] = watermark
+	encoded, err := json.Marshal(compacted)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal oplog compaction times: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(l.dir, oplogCompactedFileName), encoded); err != nil {
+		return 0, err
+	}
+	l.compacted = compacted
+
+	tempPath := path + ".tmp"
+	if err := fsutil.WriteFile(tempPath, kept.Bytes(), false); err != nil {
+		return 0, err
+	}
+	if hook != nil {
+		hook()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	size, err := appendTail(tempPath, src, end, l.size)
+	if err != nil {
+		os.Remove(tempPath)
+		return 0, err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return 0, fmt.Errorf("failed to rename temp file: %w", err)
+	}
+
+	// Reopen the append handle on the new file
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reopen oplog: %w", err)
+	}
+	l.file.Close()
+	l.file = file
+	l.size = size
+	l.history = nil // Rebuilt from the compacted log
+	if c, ok := l.space.collections[collection]; ok {
+		c.bytes -= reclaimed
+		c.dead -= reclaimed
+	}
+	return reclaimed, nil
+}
+
+// appendTail appends the bytes of src from start to end to the file at
+// path, fsyncs it and returns its size
+func appendTail(path string, src *os.File, start, end int64) (int64, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open temp file: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(f, io.NewSectionReader(src, start, end-start)); err != nil {
+		return 0, fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat temp file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// stats adds the compaction statistics to engine stats
+func (c *compactor) stats(stats *EngineStats) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats.Compactions = c.runs
+	stats.LastCompactionAt = c.lastAt
+	stats.LastCompactionBytes = c.lastBytes
+	stats.BytesReclaimed = c.reclaimed
+	stats.CompactionPaused = c.paused.Load() > 0
+}
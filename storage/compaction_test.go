@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// newCompactionEngine opens an engine with the oplog enabled
+func newCompactionEngine(t *testing.T, opts ...Option) *FileStorageEngine {
+	t.Helper()
+	engine, err := NewFileStorageEngine(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	return engine
+}
+
+// rewrite writes each of docs documents of a collection times times
+func rewrite(t *testing.T, engine *FileStorageEngine, collection string, docs, times int) {
+	t.Helper()
+	for n := 0; n < times; n++ {
+		for i := 0; i < docs; i++ {
+			id := core.DocumentID(fmt.Sprintf("doc_%d", i))
+			if err := engine.WriteDocument(collection, id, core.Document{"n": n}); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+		}
+	}
+}
+
+// latestEntries returns the oplog entries of a collection, by document,
+// failing if any document has more than one
+func latestEntries(t *testing.T, engine *FileStorageEngine, collection string) map[core.DocumentID]OplogEntry {
+	t.Helper()
+	entries, err := engine.ReadOplog(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+	latest := make(map[core.DocumentID]OplogEntry)
+	for _, entry := range entries {
+		if entry.Collection != collection {
+			continue
+		}
+		if _, ok := latest[entry.DocID]; ok {
+			t.Fatalf("Expected one entry for %s, got more", entry.DocID)
+		}
+		latest[entry.DocID] = entry
+	}
+	return latest
+}
+
+func TestCompactCollection(t *testing.T) {
+	engine := newCompactionEngine(t)
+	rewrite(t, engine, "items", 3, 4)
+	rewrite(t, engine, "other", 2, 2)
+	if err := engine.DeleteDocument("items", "doc_2"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+
+	before, err := engine.DeadSpace("items")
+	if err != nil {
+		t.Fatalf("Failed to get dead space: %v", err)
+	}
+	if before.DeadBytes == 0 || before.Ratio() <= 0.5 {
+		t.Fatalf("Expected most of the collection's oplog to be dead, got %+v", before)
+	}
+	statsBefore, _ := engine.Stats()
+
+	reclaimed, err := engine.CompactCollection("items")
+	if err != nil {
+		t.Fatalf("Failed to compact collection: %v", err)
+	}
+	if reclaimed != before.DeadBytes {
+		t.Errorf("Expected %d bytes reclaimed, got %d", before.DeadBytes, reclaimed)
+	}
+	after, _ := engine.DeadSpace("items")
+	if after.DeadBytes != 0 || after.OplogBytes != before.OplogBytes-reclaimed {
+		t.Errorf("Expected no dead space left, got %+v", after)
+	}
+	stats, _ := engine.Stats()
+	if stats.OplogBytes != statsBefore.OplogBytes-reclaimed {
+		t.Errorf("Expected the oplog to shrink by %d bytes, got %d to %d", reclaimed, statsBefore.OplogBytes, stats.OplogBytes)
+	}
+	if stats.Compactions != 1 || stats.BytesReclaimed != reclaimed || stats.LastCompactionBytes != reclaimed {
+		t.Errorf("Expected one compaction of %d bytes in stats, got %+v", reclaimed, stats)
+	}
+
+	// Each document keeps its latest entry, deletes included
+	latest := latestEntries(t, engine, "items")
+	if len(latest) != 3 || latest["doc_0"].Document["n"] != float64(3) || latest["doc_2"].Op != core.OpDelete {
+		t.Errorf("Expected the latest entry of each document, got %v", latest)
+	}
+	if other, _ := engine.DeadSpace("other"); other.DeadBytes == 0 {
+		t.Errorf("Expected other collections untouched, got %+v", other)
+	}
+
+	// Appends continue after a compaction
+	if err := engine.WriteDocument("items", "doc_0", core.Document{"n": 4}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	entries, _ := engine.ReadOplog(stats.OplogLastSeq, 0)
+	if len(entries) != 1 || entries[0].Seq != stats.OplogLastSeq+1 {
+		t.Errorf("Expected entry %d after compaction, got %v", stats.OplogLastSeq+1, entries)
+	}
+	if reclaimed, err := engine.CompactCollection("missing"); err != nil || reclaimed != 0 {
+		t.Errorf("Expected nothing to compact, got %d and %v", reclaimed, err)
+	}
+}
+
+func TestCompactionLeavesReinsertsUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	engine.WriteDocument("c", "other", core.Document{"v": 0})
+	engine.WriteDocument("c", "a", core.Document{"v": 1})
+	time.Sleep(time.Millisecond)
+	existed := time.Now()
+	time.Sleep(time.Millisecond)
+	engine.DeleteDocument("c", "a")
+	engine.WriteDocument("c", "a", core.Document{"v": 2})
+
+	if doc, err := engine.ReadDocumentAsOf("c", "a", existed); err != nil || doc["v"] != float64(1) {
+		t.Fatalf("Expected v 1 before compaction, got %v, %v", doc, err)
+	}
+	if _, err := engine.CompactCollection("c"); err != nil {
+		t.Fatalf("Failed to compact collection: %v", err)
+	}
+	if _, err := engine.ReadDocumentAsOf("c", "a", existed); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Expected ErrHistoryUnavailable after compaction, got %v", err)
+	}
+	if doc, err := engine.ReadDocumentAsOf("c", "a", time.Now()); err != nil || doc["v"] != float64(2) {
+		t.Errorf("Expected v 2 now, got %v, %v", doc, err)
+	}
+	engine.Close()
+
+	// The compaction is remembered across restarts
+	engine, err = NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	if _, err := engine.ReadDocumentAsOf("c", "a", existed); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Expected ErrHistoryUnavailable after reopening, got %v", err)
+	}
+}
+
+func TestCompactionKeepsConcurrentWrites(t *testing.T) {
+	engine := newCompactionEngine(t)
+	rewrite(t, engine, "items", 2, 3)
+	engine.compactHook = func() {
+		if err := engine.WriteDocument("items", "doc_0", core.Document{"n": "during"}); err != nil {
+			t.Errorf("Failed to write document: %v", err)
+		}
+	}
+	if _, err := engine.CompactCollection("items"); err != nil {
+		t.Fatalf("Failed to compact collection: %v", err)
+	}
+
+	entries, _ := engine.ReadOplog(0, 0)
+	last := entries[len(entries)-1]
+	if last.Seq != 7 || last.Document["n"] != "during" {
+		t.Errorf("Expected the write made during compaction at the end, got %+v", last)
+	}
+	space, _ := engine.DeadSpace("items")
+	if space.DeadBytes == 0 {
+		t.Errorf("Expected the write made during compaction to leave dead space")
+	}
+}
+
+func TestCompactionPause(t *testing.T) {
+	engine := newCompactionEngine(t)
+	engine.cfg.Compaction = &CompactionPolicy{DeadSpaceRatio: 0.5}
+	rewrite(t, engine, "items", 2, 3)
+
+	engine.PauseCompaction()
+	engine.PauseCompaction()
+	if _, err := engine.CompactCollection("items"); !errors.Is(err, ErrCompactionPaused) {
+		t.Errorf("Expected ErrCompactionPaused, got %v", err)
+	}
+	if err := engine.autoCompact(); err != nil {
+		t.Fatalf("Failed to check collections: %v", err)
+	}
+	engine.ResumeCompaction()
+	stats, _ := engine.Stats()
+	if stats.Compactions != 0 || !stats.CompactionPaused {
+		t.Errorf("Expected no compactions while paused, got %d", stats.Compactions)
+	}
+
+	engine.ResumeCompaction()
+	if err := engine.autoCompact(); err != nil {
+		t.Fatalf("Failed to check collections: %v", err)
+	}
+	stats, _ = engine.Stats()
+	if stats.Compactions != 1 || stats.CompactionPaused {
+		t.Errorf("Expected a compaction once resumed, got %d", stats.Compactions)
+	}
+}
+
+func TestAutoCompactionPolicy(t *testing.T) {
+	engine := newCompactionEngine(t)
+	engine.cfg.Compaction = &CompactionPolicy{DeadSpaceRatio: 0.6, Interval: time.Hour}
+	now := engine.openedAt
+	engine.compaction.now = func() time.Time { return now }
+
+	check := func(want uint64) {
+		t.Helper()
+		if err := engine.autoCompact(); err != nil {
+			t.Fatalf("Failed to check collections: %v", err)
+		}
+		if stats, _ := engine.Stats(); stats.Compactions != want {
+			t.Fatalf("Expected %d compactions, got %d", want, stats.Compactions)
+		}
+	}
+
+	// Half the entries are dead, under the threshold
+	rewrite(t, engine, "items", 2, 2)
+	check(0)
+
+	// Crossing it compacts once, however often it is checked
+	rewrite(t, engine, "items", 2, 2)
+	check(1)
+	check(1)
+	if space, _ := engine.DeadSpace("items"); space.DeadBytes != 0 {
+		t.Errorf("Expected the dead space reclaimed, got %+v", space)
+	}
+
+	// The interval compacts any dead space once it has passed
+	rewrite(t, engine, "items", 1, 1)
+	now = now.Add(59 * time.Minute)
+	check(1)
+	now = now.Add(time.Minute)
+	check(2)
+
+	// A collection's own policy overrides the engine's
+	if err := engine.SetCompactionPolicy("items", &CompactionPolicy{Disabled: true}); err != nil {
+		t.Fatalf("Failed to set compaction policy: %v", err)
+	}
+	rewrite(t, engine, "items", 2, 4)
+	now = now.Add(2 * time.Hour)
+	check(2)
+	policy, err := engine.CompactionPolicy("items")
+	if err != nil || policy == nil || !policy.Disabled {
+		t.Errorf("Expected the stored policy, got %v and %v", policy, err)
+	}
+	if err := engine.SetCompactionPolicy("items", &CompactionPolicy{DeadSpaceRatio: 2}); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+	if err := engine.SetCompactionPolicy("items", nil); err != nil {
+		t.Fatalf("Failed to remove compaction policy: %v", err)
+	}
+	check(3)
+}
+
+func TestAutoCompactionRunsInBackground(t *testing.T) {
+	engine := newCompactionEngine(t, WithAutoCompaction(CompactionPolicy{DeadSpaceRatio: 0.5}, 5*time.Millisecond))
+	rewrite(t, engine, "items", 2, 4)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := engine.Stats()
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.Compactions > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a background compaction")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWithAutoCompactionValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy CompactionPolicy
+		check  time.Duration
+	}{
+		{"zero check interval", CompactionPolicy{DeadSpaceRatio: 0.5}, 0},
+		{"negative ratio", CompactionPolicy{DeadSpaceRatio: -0.1}, time.Second},
+		{"ratio of one", CompactionPolicy{DeadSpaceRatio: 1}, time.Second},
+		{"negative interval", CompactionPolicy{Interval: -time.Second}, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileStorageEngine(t.TempDir(), WithAutoCompaction(tt.policy, tt.check))
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrReservedMetaKey is returned by SetCollectionMeta for a key the engine
+// uses for its own metadata
+var ErrReservedMetaKey = errors.New("reserved collection metadata key")
+
+// reservedMetaKeys are the keys of the engine's own collection metadata,
+// which custom metadata may not use so that the two never read as one
+var reservedMetaKeys = map[string]bool{
+	"collection": true, "version": true, "created_at": true, "document_count": true,
+	"revision": true, "schema": true, "schema_mode": true, "defaults": true,
+	"encrypted_fields": true, "references": true, "redaction": true,
+	"preserve_key_order": true, "compaction": true, "custom": true,
+}
+
+// SetDefaults stores the values a collection's inserts take for missing
+// fields. The engine only keeps them with the collection; the db package
+// applies them. An empty document removes them.
+func (e *FileStorageEngine) SetDefaults(collection string, defaults core.Document) error {
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.Defaults = nil
+		if len(defaults) > 0 {
+			metadata.Defaults = defaults.Clone()
+		}
+	})
+}
+
+// Defaults returns the defaults stored with a collection, or nil if it has none
+func (e *FileStorageEngine) Defaults(collection string) (core.Document, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collFile.Metadata.Defaults, nil
+}
+
+// updateMetadata rewrites a collection file with changed metadata. The
+// documents are unchanged, so the revision is kept and indexes stay current.
+func (e *FileStorageEngine) updateMetadata(collection string, update func(*CollectionMetadata)) error {
+	if err := e.checkWritable(collection); err != nil {
+		return err
+	}
+
+	// Acquire file lock
+	lockFile, err := e.acquireFileLock(collection)
+	if err != nil {
+		return err
+	}
+	defer e.releaseFileLock(lockFile)
+
+	// Acquire write lock
+	e.lockWrite(collection)
+	defer e.mu.Unlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return err
+	}
+
+	update(&collFile.Metadata)
+	_, err = e.rewriteCollectionFile(collection, collFile)
+	return err
+}
+
+// SetEncryptedFields stores the field paths whose values a collection keeps
+// encrypted. As with defaults, the db package does the encryption. An empty
+// list removes them.
+func (e *FileStorageEngine) SetEncryptedFields(collection string, fields []string) error {
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.EncryptedFields = nil
+		if len(fields) > 0 {
+			metadata.EncryptedFields = append([]string(nil), fields...)
+		}
+	})
+}
+
+// EncryptedFields returns the encrypted field paths stored with a collection
+func (e *FileStorageEngine) EncryptedFields(collection string) ([]string, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collFile.Metadata.EncryptedFields, nil
+}
+
+// SetReferences stores the references a collection's documents make to
+// other collections. The db package enforces them.
+func (e *FileStorageEngine) SetReferences(collection string, refs []core.Reference) error {
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.References = append([]core.Reference(nil), refs...)
+	})
+}
+
+// References returns the references stored with a collection
+func (e *FileStorageEngine) References(collection string) ([]core.Reference, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collFile.Metadata.References, nil
+}
+
+// SetRedaction stores how a collection's documents are redacted. The db
+// package applies it. A nil redaction removes it.
+func (e *FileStorageEngine) SetRedaction(collection string, redaction *core.Redaction) error {
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.Redaction = nil
+		if redaction != nil {
+			r := *redaction
+			r.Rules = append([]core.RedactRule(nil), redaction.Rules...)
+			r.ExemptRoles = append([]string(nil), redaction.ExemptRoles...)
+			metadata.Redaction = &r
+		}
+	})
+}
+
+// Redaction returns the redaction stored with a collection, or nil if it
+// has none
+func (e *FileStorageEngine) Redaction(collection string) (*core.Redaction, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	return collFile.Metadata.Redaction, nil
+}
+
+// SetCollectionMeta replaces the application metadata stored with a
+// collection, such as a description or owner, without touching its
+// documents. Keys the engine uses for its own metadata fail with
+// ErrReservedMetaKey. An empty map removes it.
+func (e *FileStorageEngine) SetCollectionMeta(collection string, custom map[string]interface{}) error {
+	for key := range custom {
+		if key == "" || reservedMetaKeys[key] {
+			return fmt.Errorf("%w: %q", ErrReservedMetaKey, key)
+		}
+	}
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.Custom = nil
+		if len(custom) > 0 {
+			metadata.Custom = core.Document(custom).Clone()
+		}
+	})
+}
+
+// GetCollectionMeta returns the metadata stored with a collection, custom
+// metadata included. The result is the caller's to keep.
+func (e *FileStorageEngine) GetCollectionMeta(collection string) (CollectionMetadata, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return CollectionMetadata{}, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return CollectionMetadata{}, err
+	}
+	return collFile.Metadata, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestCollectionMeta(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.WriteDocument("users", "u1", core.Document{"name": "Ada"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	custom := map[string]interface{}{
+		"description":    "Registered users",
+		"schema_version": 3.0,
+		"owner":          map[string]interface{}{"team": "identity"},
+	}
+	if err := engine.SetCollectionMeta("users", custom); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	custom["owner"].(map[string]interface{})["team"] = "changed"
+
+	// Every write rewrites the whole file, so writes, deletes and a
+	// restore from a snapshot all compact it
+	if err := engine.WriteDocument("users", "u2", core.Document{"name": "Grace"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := engine.DeleteDocument("users", "u1"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	snapshot, err := engine.SnapshotCollection("users")
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if err := engine.RestoreCollection("users", snapshot); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	engine.Close()
+	engine, err = NewFileStorageEngine(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+
+	metadata, err := engine.GetCollectionMeta("users")
+	if err != nil {
+		t.Fatalf("Failed to get metadata: %v", err)
+	}
+	expected := map[string]interface{}{
+		"description":    "Registered users",
+		"schema_version": 3.0,
+		"owner":          map[string]interface{}{"team": "identity"},
+	}
+	if !reflect.DeepEqual(metadata.Custom, expected) {
+		t.Errorf("Expected %v, got %v", expected, metadata.Custom)
+	}
+	if metadata.DocumentCount != 1 || metadata.Collection != "users" {
+		t.Errorf("Expected the engine's metadata alongside, got %+v", metadata)
+	}
+
+	if err := engine.SetCollectionMeta("users", nil); err != nil {
+		t.Fatalf("Failed to clear metadata: %v", err)
+	}
+	if metadata, _ := engine.GetCollectionMeta("users"); metadata.Custom != nil {
+		t.Errorf("Expected no custom metadata, got %v", metadata.Custom)
+	}
+	if count, _ := engine.CountDocuments("users"); count != 1 {
+		t.Errorf("Expected the documents untouched, got %d", count)
+	}
+	cleanupTestEngine(engine, tempDir)
+}
+
+func TestCollectionMetaReservedKeys(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.SetCollectionMeta("users", map[string]interface{}{"owner": "identity"}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	revision, _ := engine.CollectionRevision("users")
+
+	// Every key of the engine's own metadata is reserved
+	typ := reflect.TypeOf(CollectionMetadata{})
+	for i := 0; i < typ.NumField(); i++ {
+		key := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		err := engine.SetCollectionMeta("users", map[string]interface{}{"owner": "x", key: 1})
+		if !errors.Is(err, ErrReservedMetaKey) {
+			t.Errorf("Expected ErrReservedMetaKey for %q, got %v", key, err)
+		}
+	}
+	if err := engine.SetCollectionMeta("users", map[string]interface{}{"": 1}); !errors.Is(err, ErrReservedMetaKey) {
+		t.Errorf("Expected ErrReservedMetaKey for an empty key, got %v", err)
+	}
+
+	if after, _ := engine.CollectionRevision("users"); after != revision {
+		t.Errorf("Expected no rewrite, got revisions %d and %d", revision, after)
+	}
+	if metadata, _ := engine.GetCollectionMeta("users"); metadata.Custom["owner"] != "identity" {
+		t.Errorf("Expected the metadata unchanged, got %v", metadata.Custom)
+	}
+}
+
+func TestCollectionMetaConcurrentWrites(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if err := engine.WriteDocument("items", core.DocumentID(fmt.Sprintf("i%d", i)), core.Document{"n": i}); err != nil {
+				t.Errorf("Failed to write document: %v", err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			if err := engine.SetCollectionMeta("items", map[string]interface{}{"last": float64(i)}); err != nil {
+				t.Errorf("Failed to set metadata: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if count, _ := engine.CountDocuments("items"); count != n {
+		t.Errorf("Expected %d documents, got %d", n, count)
+	}
+	if metadata, _ := engine.GetCollectionMeta("items"); metadata.Custom["last"] == nil {
+		t.Errorf("Expected the custom metadata kept, got %v", metadata.Custom)
+	}
+}
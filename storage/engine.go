@@ -1,29 +1,90 @@
 package storage
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// indexFileSuffix marks persisted index files, which share the data directory
+// with collection files but are not collections themselves
+const indexFileSuffix = ".idx.json"
+
+// ErrReadOnly is returned by every write to an engine opened with WithReadOnly
+var ErrReadOnly = errors.New("storage engine is read-only")
+
+// ErrEngineClosed is returned by operations started once the engine is
+// closing or closed
+var ErrEngineClosed = errors.New("storage engine is closed")
+
 // FileStorageEngine implements the StorageEngine interface with thread-safe file operations
 type FileStorageEngine struct {
 	dataDir string
+	cfg     Config // Set by the Options given to NewFileStorageEngine
 	mu      sync.RWMutex
-	locks   map[string]*os.File // File locks per collection
-	locksMu sync.Mutex          // Protects the locks map
+	locks   map[string]*fileLock // File locks per collection; nil once closed
+	locksMu sync.Mutex           // Protects the locks map
+	oplog   *oplog               // Durable change log, nil unless enabled
+
+	readOnly bool // Set by WithReadOnly; writes fail and no lock files are created
+
+	syncer    *syncer        // Syncs rewritten files in the background, nil unless SyncInterval
+	coalescer *coalescer     // Holds rewritten files in memory, nil unless WithWriteCoalescing
+	access    *accessTracker // Counts collection accesses, nil unless WithAccessStats
+
+	namespacesMu sync.Mutex
+	namespaces   map[string]*FileStorageEngine // Opened namespaces, by name
+
+	metrics      *Metrics              // Nil unless metrics are enabled
+	metricsScope string                // Prefix of the collection label, for namespaces
+	registerer   prometheus.Registerer // Holds metrics until Close; nil for namespaces
+
+	logger        *slog.Logger  // Set by WithLogger; nil logs nothing
+	slowThreshold time.Duration // Operations and lock waits at least this long are logged as slow
+
+	tracer trace.Tracer // Set by WithTracer; nil traces nothing
+
+	commitHook  func(stage commitStage) error // Test hook simulating crashes during ApplyMultiBatch
+	compactHook func()                        // Test hook run while a compaction has copied the oplog
+
+	schemasMu    sync.Mutex
+	schemas      map[string]compiledSchema // Compiled collection schemas, by collection
+	schemaHits   atomic.Uint64             // Lookups of schemas found compiled
+	schemaMisses atomic.Uint64             // Lookups of schemas that had to be compiled
+
+	openedAt time.Time
+
+	closeMu sync.Mutex  // Serializes CloseContext calls
+	closed  atomic.Bool // Set when CloseContext starts
+
+	watchers watchers     // Subscriptions of Watch
+	writes   writeTracker // Write statistics, by collection
+	reads    readCache    // Documents read with read options, by collection
+
+	compaction compactor // Compactions of the oplog
 }
 
 // CollectionFile represents the structure of a collection file
 type CollectionFile struct {
-	Metadata  CollectionMetadata         `json:"metadata"`
-	Documents map[string]core.Document   `json:"documents"`
+	Metadata  CollectionMetadata       `json:"metadata"`
+	Documents map[string]core.Document `json:"documents"`
+
+	order map[string]core.OrderedDocument // Key order of the documents, if Metadata.PreserveKeyOrder
 }
 
 // CollectionMetadata contains metadata about a collection
@@ -32,19 +93,155 @@ type CollectionMetadata struct {
 	Version       int       `json:"version"`
 	CreatedAt     time.Time `json:"created_at"`
 	DocumentCount int       `json:"document_count"`
+	Revision      uint64    `json:"revision"` // Incremented on every rewrite that changes the documents
+
+	// Schema is the JSON Schema every written document must satisfy
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	SchemaMode schema.Mode     `json:"schema_mode,omitempty"`
+
+	// Defaults are the values inserts take for missing fields
+	Defaults core.Document `json:"defaults,omitempty"`
+	// EncryptedFields are the field paths whose values are stored encrypted
+	EncryptedFields []string `json:"encrypted_fields,omitempty"`
+	// References are the fields holding IDs of documents in other collections
+	References []core.Reference `json:"references,omitempty"`
+	// Redaction is how documents are redacted on their way out of the database
+	Redaction *core.Redaction `json:"redaction,omitempty"`
+	// PreserveKeyOrder keeps the keys of documents in the order written
+	PreserveKeyOrder bool `json:"preserve_key_order,omitempty"`
+	// Compaction overrides the engine's compaction policy for the collection
+	Compaction *CompactionPolicy `json:"compaction,omitempty"`
+	// Custom is application metadata, set with SetCollectionMeta
+	Custom map[string]interface{} `json:"custom,omitempty"`
 }
 
-// NewFileStorageEngine creates a new file-based storage engine
-func NewFileStorageEngine(dataDir string) (*FileStorageEngine, error) {
+// WithReadOnly opens the data directory without ever writing to it, so it
+// can sit on a read-only filesystem. Writes fail with ErrReadOnly, reads
+// take no file locks, and the directory must already exist. A batch journal
+// left by a crash cannot be recovered read-only and fails the open.
+func WithReadOnly() Option {
+	return func(c *Config) {
+		c.ReadOnly = true
+	}
+}
+
+// NewFileStorageEngine creates a new file-based storage engine, failing
+// with ErrInvalidConfig if the options cannot be combined
+func NewFileStorageEngine(dataDir string, opts ...Option) (_ *FileStorageEngine, err error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	e := &FileStorageEngine{
+		dataDir:       dataDir,
+		cfg:           cfg,
+		locks:         make(map[string]*fileLock),
+		schemas:       make(map[string]compiledSchema),
+		readOnly:      cfg.ReadOnly,
+		logger:        cfg.Logger,
+		slowThreshold: cfg.SlowThreshold,
+		openedAt:      time.Now(),
+	}
+	e.reads.budget = cfg.ReadCacheBytes
+	if cfg.Tracer != nil {
+		e.tracer = cfg.Tracer.Tracer(tracerName)
+	}
+
+	if cfg.Metrics != nil {
+		e.metrics = newMetrics()
+		if err := cfg.Metrics.Register(e.metrics); err != nil {
+			return nil, fmt.Errorf("failed to register storage metrics: %w", err)
+		}
+		e.registerer = cfg.Metrics
+		defer func() {
+			if err != nil {
+				e.unregisterMetrics()
+			}
+		}()
+	}
+
+	if e.readOnly {
+		if err := e.checkReadOnlyDir(); err != nil {
+			return nil, err
+		}
+		e.logEvent(slog.LevelInfo, "storage engine opened", slog.String("dir", dataDir), slog.Bool("read_only", true))
+		return e, nil
+	}
+
 	// Create data directory if it doesn't exist
 	if err := os.MkdirAll(dataDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	return &FileStorageEngine{
-		dataDir: dataDir,
-		locks:   make(map[string]*os.File),
-	}, nil
+	// Finish or undo a multi-collection batch interrupted by a crash
+	if err := e.recoverJournal(); err != nil {
+		return nil, err
+	}
+
+	if cfg.AccessStatsInterval > 0 {
+		access, err := newAccessTracker(e, cfg.AccessStatsInterval)
+		if err != nil {
+			return nil, err
+		}
+		e.access = access
+	}
+	if cfg.Sync == SyncInterval {
+		e.syncer = newSyncer(e, cfg.SyncInterval)
+	}
+	if cfg.CoalesceWindow > 0 {
+		e.coalescer = newCoalescer(e, cfg.CoalesceWindow, cfg.CoalesceMaxPending)
+	}
+	if cfg.Compaction != nil {
+		e.compaction.start(e, cfg.CompactionCheckInterval)
+	}
+
+	e.logEvent(slog.LevelInfo, "storage engine opened", slog.String("dir", dataDir), slog.Bool("read_only", false))
+	return e, nil
+}
+
+// Dir returns the engine's data directory
+func (e *FileStorageEngine) Dir() string {
+	return e.dataDir
+}
+
+// checkReadOnlyDir checks that a read-only engine's data directory exists
+// and holds no batch journal awaiting recovery
+func (e *FileStorageEngine) checkReadOnlyDir() error {
+	info, err := os.Stat(e.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to open data directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("failed to open data directory: %s is not a directory", e.dataDir)
+	}
+
+	if _, err := os.Stat(filepath.Join(e.dataDir, journalFileName)); err == nil {
+		return fmt.Errorf("interrupted batch in %s needs recovery: %w", e.dataDir, ErrReadOnly)
+	}
+	return nil
+}
+
+// rlock takes the engine's read lock, failing with ErrEngineClosed once the
+// engine is closing
+func (e *FileStorageEngine) rlock() error {
+	e.mu.RLock()
+	if e.closed.Load() {
+		e.mu.RUnlock()
+		return ErrEngineClosed
+	}
+	return nil
+}
+
+// checkWritable fails with ErrReadOnly for writes to a read-only engine
+func (e *FileStorageEngine) checkWritable(collection string) error {
+	if e.readOnly {
+		return fmt.Errorf("failed to write collection %s: %w", collection, ErrReadOnly)
+	}
+	return nil
 }
 
 // getCollectionPath returns the file path for a collection
@@ -52,51 +249,152 @@ func (e *FileStorageEngine) getCollectionPath(collection string) string {
 	return filepath.Join(e.dataDir, collection+".json")
 }
 
-// acquireFileLock acquires an exclusive file lock for a collection
-func (e *FileStorageEngine) acquireFileLock(collection string) (*os.File, error) {
+// fileLock is the lock of a collection: mu excludes the engine's own
+// goroutines and a flock on file excludes other processes. An engine's
+// goroutines share one open lock file per collection, and flock does not
+// exclude holders of the same open file from each other, hence mu.
+type fileLock struct {
+	mu        sync.Mutex
+	file      *os.File // Opened by the first holder
+	discarded bool     // Removed by DropCollection or Close; look the lock up again
+}
+
+// lockEntry returns the lock of a collection, adding it to the locks map if
+// needed. It does no I/O, so locksMu is only ever held briefly.
+func (e *FileStorageEngine) lockEntry(collection string) (*fileLock, error) {
 	e.locksMu.Lock()
 	defer e.locksMu.Unlock()
 
-	// Check if we already have a lock file open
-	if lockFile, exists := e.locks[collection]; exists {
-		// Try to acquire the lock
-		if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
-			return nil, fmt.Errorf("failed to acquire file lock: %w", err)
+	if e.locks == nil {
+		return nil, ErrEngineClosed
+	}
+	l, exists := e.locks[collection]
+	if !exists {
+		l = &fileLock{}
+		e.locks[collection] = l
+	}
+	return l, nil
+}
+
+// acquireFileLock acquires an exclusive file lock for a collection. It must
+// be taken before e.mu, so waiting for another process does not hold up
+// the engine's other collections.
+func (e *FileStorageEngine) acquireFileLock(collection string) (*fileLock, error) {
+	return e.acquireFileLockContext(context.Background(), collection)
+}
+
+// acquireFileLockContext is acquireFileLock giving up once ctx is done, with
+// an error naming the collection it was waiting for
+func (e *FileStorageEngine) acquireFileLockContext(ctx context.Context, collection string) (*fileLock, error) {
+	for {
+		l, err := e.lockEntry(collection)
+		if err != nil {
+			return nil, err
+		}
+		if err := core.LockContext(ctx, &l.mu); err != nil {
+			return nil, fmt.Errorf("failed to acquire file lock on collection %s: %w", collection, err)
+		}
+		if l.discarded {
+			// Dropped or closed while we waited
+			l.mu.Unlock()
+			continue
 		}
-		return lockFile, nil
+
+		if err := e.flock(ctx, l, collection); err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		if e.closed.Load() {
+			// Close gave up waiting for us while another process held the lock
+			e.releaseFileLock(l)
+			return nil, ErrEngineClosed
+		}
+		return l, nil
 	}
+}
 
-	// Open lock file
-	lockPath := filepath.Join(e.dataDir, collection+".lock")
-	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+// flock opens the lock file of a held lock if needed and locks it against
+// other processes, polling if ctx can be done
+func (e *FileStorageEngine) flock(ctx context.Context, l *fileLock, collection string) error {
+	if l.file == nil {
+		file, err := os.OpenFile(filepath.Join(e.dataDir, collection+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open lock file: %w", err)
+		}
+		l.file = file
+	}
+
+	if ctx.Done() == nil {
+		if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX); err != nil {
+			return fmt.Errorf("failed to acquire file lock: %w", err)
+		}
+		return nil
+	}
+
+	var flockErr error
+	err := core.PollContext(ctx, func() bool {
+		flockErr = syscall.Flock(int(l.file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		return !errors.Is(flockErr, syscall.EWOULDBLOCK)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open lock file: %w", err)
+		return fmt.Errorf("failed to acquire file lock on collection %s: %w", collection, err)
+	}
+	if flockErr != nil {
+		return fmt.Errorf("failed to acquire file lock: %w", flockErr)
 	}
+	return nil
+}
 
-	// Acquire exclusive lock
-	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
-		lockFile.Close()
-		return nil, fmt.Errorf("failed to acquire file lock: %w", err)
+// releaseFileLock releases the file lock for a collection. If the engine
+// was closed while the lock was held, the lock file is closed too.
+func (e *FileStorageEngine) releaseFileLock(l *fileLock) error {
+	if l == nil {
+		return nil
 	}
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
 
-	e.locks[collection] = lockFile
-	return lockFile, nil
+	// Close skips the locks held at the time, so holding locksMu while
+	// unlocking makes sure either it or this closes the file
+	e.locksMu.Lock()
+	defer e.locksMu.Unlock()
+	if e.locks == nil || l.discarded {
+		if closeErr := l.discard(); err == nil {
+			err = closeErr
+		}
+	}
+	l.mu.Unlock()
+	return err
 }
 
-// releaseFileLock releases the file lock for a collection
-func (e *FileStorageEngine) releaseFileLock(lockFile *os.File) error {
-	if lockFile == nil {
+// discard closes the lock file of a lock, which callers must hold
+func (l *fileLock) discard() error {
+	l.discarded = true
+	if l.file == nil {
 		return nil
 	}
-	return syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	err := l.file.Close()
+	l.file = nil
+	return err
 }
 
 // readCollectionFile reads the entire collection file
 func (e *FileStorageEngine) readCollectionFile(collection string) (*CollectionFile, error) {
-	path := e.getCollectionPath(collection)
-
-	// Check if file exists
-	if _, err := os.Stat(path); os.IsNotExist(err) {
+	var collFile CollectionFile
+	err := e.readCollectionData(collection, func(data []byte) error {
+		// Parse JSON
+		if err := json.Unmarshal(data, &collFile); err != nil {
+			e.logEvent(slog.LevelError, "corrupt collection file", slog.String("collection", collection), slog.Any("error", err))
+			return fmt.Errorf("failed to parse collection file: %w", err)
+		}
+		if collFile.Metadata.PreserveKeyOrder {
+			if err := decodeKeyOrder(data, &collFile); err != nil {
+				e.logEvent(slog.LevelError, "corrupt collection file", slog.String("collection", collection), slog.Any("error", err))
+				return fmt.Errorf("failed to parse collection file: %w", err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
 		// Return empty collection
 		return &CollectionFile{
 			Metadata: CollectionMetadata{
@@ -108,76 +406,114 @@ func (e *FileStorageEngine) readCollectionFile(collection string) (*CollectionFi
 			Documents: make(map[string]core.Document),
 		}, nil
 	}
-
-	// Read file
-	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read collection file: %w", err)
-	}
-
-	// Parse JSON
-	var collFile CollectionFile
-	if err := json.Unmarshal(data, &collFile); err != nil {
-		return nil, fmt.Errorf("failed to parse collection file: %w", err)
+		return nil, err
 	}
 
 	return &collFile, nil
 }
 
-// writeCollectionFileAtomic writes the collection file atomically using temp file + rename
-func (e *FileStorageEngine) writeCollectionFileAtomic(collection string, collFile *CollectionFile) error {
-	path := e.getCollectionPath(collection)
-	
-	// Update metadata
-	collFile.Metadata.DocumentCount = len(collFile.Documents)
-
-	// Marshal to JSON
-	data, err := json.MarshalIndent(collFile, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal collection file: %w", err)
+// readCollectionMetadata reads the metadata of a collection file, skipping
+// over its documents rather than decoding them. A missing collection has
+// zero metadata.
+func (e *FileStorageEngine) readCollectionMetadata(collection string) (CollectionMetadata, error) {
+	var collFile struct {
+		Metadata CollectionMetadata `json:"metadata"`
+	}
+	err := e.readCollectionData(collection, func(data []byte) error {
+		if err := json.Unmarshal(data, &collFile); err != nil {
+			e.logEvent(slog.LevelError, "corrupt collection file", slog.String("collection", collection), slog.Any("error", err))
+			return fmt.Errorf("failed to parse collection file: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return CollectionMetadata{Collection: collection, Version: 1}, nil
 	}
+	return collFile.Metadata, err
+}
+
+// writeCollectionFileAtomic writes the collection file atomically using temp
+// file + rename after its documents changed, returning the number of bytes
+// written
+func (e *FileStorageEngine) writeCollectionFileAtomic(collection string, collFile *CollectionFile) (int, error) {
+	collFile.Metadata.Revision++
+	return e.rewriteCollectionFile(collection, collFile)
+}
 
-	// Write to temporary file
-	tempPath := path + ".tmp"
-	tempFile, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+// rewriteCollectionFile writes the collection file as writeCollectionFileAtomic
+// does, keeping its revision, for rewrites that leave the documents as they
+// are. Indexes built at the revision stay current.
+func (e *FileStorageEngine) rewriteCollectionFile(collection string, collFile *CollectionFile) (int, error) {
+	enc := getEncoder()
+	defer enc.release()
+	data, err := marshalCollectionFile(enc, collFile)
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return 0, err
 	}
 
-	// Write data
-	if _, err := tempFile.Write(data); err != nil {
-		tempFile.Close()
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to write temp file: %w", err)
+	if e.coalescer != nil && e.coalescer.put(collection, data, len(collFile.Documents)) {
+		e.access.wrote(collection)
+		return len(data), nil
 	}
-
-	// Fsync to ensure data is on disk
-	if err := tempFile.Sync(); err != nil {
-		tempFile.Close()
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to sync temp file: %w", err)
+	if err := e.replaceCollectionFile(e.getCollectionPath(collection), data); err != nil {
+		return 0, err
 	}
+	e.observeFile(collection, len(data), len(collFile.Documents))
+	e.access.wrote(collection)
+	return len(data), nil
+}
 
-	// Close temp file
-	if err := tempFile.Close(); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to close temp file: %w", err)
-	}
+// encodeCollectionFile updates the metadata of a collection file for a
+// rewrite and marshals it with enc, returning data valid until enc is
+// released
+func encodeCollectionFile(enc *encoder, collFile *CollectionFile) ([]byte, error) {
+	collFile.Metadata.Revision++
+	return marshalCollectionFile(enc, collFile)
+}
 
-	// Atomic rename
-	if err := os.Rename(tempPath, path); err != nil {
-		os.Remove(tempPath)
-		return fmt.Errorf("failed to rename temp file: %w", err)
+// marshalCollectionFile marshals a collection file with enc, as
+// encodeCollectionFile does without changing its revision
+func marshalCollectionFile(enc *encoder, collFile *CollectionFile) ([]byte, error) {
+	// Update metadata
+	collFile.Metadata.DocumentCount = len(collFile.Documents)
+	if collFile.Metadata.PreserveKeyOrder {
+		return encodeOrdered(enc, collFile)
 	}
 
-	return nil
+	// Marshal to JSON
+	data, err := enc.marshal(collFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal collection file: %w", err)
+	}
+	return data, nil
 }
 
 // WriteDocument atomically writes a document to storage
 func (e *FileStorageEngine) WriteDocument(collection string, docID core.DocumentID, doc core.Document) error {
-	// Acquire write lock
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	return e.WriteDocumentContext(context.Background(), collection, docID, doc)
+}
+
+// WriteDocumentContext is WriteDocument, traced as a child of the span in ctx
+// and recording the revision change in the map set by core.WithRevisions
+func (e *FileStorageEngine) WriteDocumentContext(ctx context.Context, collection string, docID core.DocumentID, doc core.Document) error {
+	return e.writeDocument(ctx, collection, docID, doc, nil)
+}
+
+// writeDocument is WriteDocumentContext, with the document's keys in the
+// order of order if the collection preserves key order and order is set
+func (e *FileStorageEngine) writeDocument(ctx context.Context, collection string, docID core.DocumentID, doc core.Document, order core.OrderedDocument) (err error) {
+	var span trace.Span
+	if e.tracer != nil {
+		_, span = e.startSpan(ctx, "storage.WriteDocument", collection, docID)
+		defer func() { core.EndSpan(span, err) }()
+	}
+	if e.instrumented() {
+		defer e.observe(opWrite, collection, docID, time.Now(), &err)
+	}
+	if err := e.checkWritable(collection); err != nil {
+		return err
+	}
 
 	// Acquire file lock
 	lockFile, err := e.acquireFileLock(collection)
@@ -186,23 +522,70 @@ func (e *FileStorageEngine) WriteDocument(collection string, docID core.Document
 	}
 	defer e.releaseFileLock(lockFile)
 
+	// Acquire write lock
+	e.lockWrite(collection)
+	defer e.mu.Unlock()
+
 	// Read current collection
 	collFile, err := e.readCollectionFile(collection)
 	if err != nil {
 		return err
 	}
 
+	writes := map[core.DocumentID]core.Document{docID: doc}
+	if err := e.SyncIDFields(collection, writes); err != nil {
+		return err
+	}
+	doc = writes[docID]
+	if err := e.validateWrites(collection, collFile, writes); err != nil {
+		return err
+	}
+
 	// Add/update document
+	from := collFile.Metadata.Revision
+	_, existed := collFile.Documents[string(docID)]
 	collFile.Documents[string(docID)] = doc
+	if order != nil {
+		collFile.setOrder(docID, order)
+	}
 
 	// Write atomically
-	return e.writeCollectionFileAtomic(collection, collFile)
+	n, err := e.writeCollectionFileAtomic(collection, collFile)
+	if err != nil {
+		return err
+	}
+	if span != nil {
+		span.SetAttributes(attribute.Int(core.AttrBytes, n))
+	}
+	core.RecordRevision(ctx, collection, from, collFile.Metadata.Revision)
+
+	// Record the change while still holding the write lock so the oplog
+	// order matches the order in which writes were applied
+	op := core.OpInsert
+	if existed {
+		op = core.OpUpdate
+	}
+	return e.recordChanges(collection, []change{{op, docID, doc}})
 }
 
 // ReadDocument retrieves a document by ID
 func (e *FileStorageEngine) ReadDocument(collection string, docID core.DocumentID) (core.Document, error) {
+	return e.ReadDocumentContext(context.Background(), collection, docID)
+}
+
+// ReadDocumentContext is ReadDocument, traced as a child of the span in ctx
+func (e *FileStorageEngine) ReadDocumentContext(ctx context.Context, collection string, docID core.DocumentID) (_ core.Document, err error) {
+	if e.tracer != nil {
+		_, span := e.startSpan(ctx, "storage.ReadDocument", collection, docID)
+		defer func() { core.EndSpan(span, err) }()
+	}
+	if e.instrumented() {
+		defer e.observe(opRead, collection, docID, time.Now(), &err)
+	}
 	// Acquire read lock
-	e.mu.RLock()
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
 	defer e.mu.RUnlock()
 
 	// Read collection file
@@ -214,17 +597,28 @@ func (e *FileStorageEngine) ReadDocument(collection string, docID core.DocumentI
 	// Find document
 	doc, exists := collFile.Documents[string(docID)]
 	if !exists {
-		return nil, fmt.Errorf("document not found: %s", docID)
+		return nil, fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
 	}
+	e.access.read(collection, docID)
 
 	return doc, nil
 }
 
-// DeleteDocument removes a document from storage
+// DeleteDocument removes a document from storage, failing with
+// core.ErrDocumentNotFound without rewriting the file if there is none
 func (e *FileStorageEngine) DeleteDocument(collection string, docID core.DocumentID) error {
-	// Acquire write lock
-	e.mu.Lock()
-	defer e.mu.Unlock()
+	return e.DeleteDocumentContext(context.Background(), collection, docID)
+}
+
+// DeleteDocumentContext is DeleteDocument recording the revision change in
+// the map set by core.WithRevisions
+func (e *FileStorageEngine) DeleteDocumentContext(ctx context.Context, collection string, docID core.DocumentID) (err error) {
+	if e.instrumented() {
+		defer e.observe(opDelete, collection, docID, time.Now(), &err)
+	}
+	if err := e.checkWritable(collection); err != nil {
+		return err
+	}
 
 	// Acquire file lock
 	lockFile, err := e.acquireFileLock(collection)
@@ -233,31 +627,69 @@ func (e *FileStorageEngine) DeleteDocument(collection string, docID core.Documen
 	}
 	defer e.releaseFileLock(lockFile)
 
+	// Acquire write lock
+	e.lockWrite(collection)
+	defer e.mu.Unlock()
+
 	// Read current collection
 	collFile, err := e.readCollectionFile(collection)
 	if err != nil {
 		return err
 	}
 
-	// Delete document
+	// A missing document leaves the file as it is
+	if _, exists := collFile.Documents[string(docID)]; !exists {
+		return fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
+	}
 	delete(collFile.Documents, string(docID))
 
 	// Write atomically
-	return e.writeCollectionFileAtomic(collection, collFile)
+	from := collFile.Metadata.Revision
+	if _, err := e.writeCollectionFileAtomic(collection, collFile); err != nil {
+		return err
+	}
+	core.RecordRevision(ctx, collection, from, collFile.Metadata.Revision)
+
+	return e.recordChanges(collection, []change{{core.OpDelete, docID, nil}})
 }
 
 // ScanCollection iterates over all documents in a collection
 func (e *FileStorageEngine) ScanCollection(collection string, fn func(core.DocumentID, core.Document) bool) error {
-	// Acquire read lock
-	e.mu.RLock()
-	defer e.mu.RUnlock()
+	return e.ScanCollectionContext(context.Background(), collection, fn)
+}
 
-	// Read collection file
+// ScanCollectionContext is ScanCollection, traced as a child of the span in
+// ctx with the number of documents visited
+func (e *FileStorageEngine) ScanCollectionContext(ctx context.Context, collection string, fn func(core.DocumentID, core.Document) bool) (err error) {
+	if e.tracer != nil {
+		_, span := e.startSpan(ctx, "storage.ScanCollection", collection, "")
+		visited, visit := 0, fn
+		fn = func(docID core.DocumentID, doc core.Document) bool {
+			visited++
+			return visit(docID, doc)
+		}
+		defer func() {
+			span.SetAttributes(attribute.Int(core.AttrDocuments, visited))
+			core.EndSpan(span, err)
+		}()
+	}
+	if e.instrumented() {
+		defer e.observe(opScan, collection, "", time.Now(), &err)
+	}
+	// Read collection file under the read lock. The documents are decoded
+	// afresh, so fn runs after it is released and a slow caller, such as an
+	// unread cursor, does not hold up writes.
+	if err := e.rlock(); err != nil {
+		return err
+	}
 	collFile, err := e.readCollectionFile(collection)
+	e.mu.RUnlock()
 	if err != nil {
 		return err
 	}
 
+	e.access.read(collection, "")
+
 	// Iterate over documents
 	for docID, doc := range collFile.Documents {
 		if !fn(core.DocumentID(docID), doc) {
@@ -269,10 +701,13 @@ func (e *FileStorageEngine) ScanCollection(collection string, fn func(core.Docum
 }
 
 // CreateCollection initializes a new collection
-func (e *FileStorageEngine) CreateCollection(name string) error {
-	// Acquire write lock
-	e.mu.Lock()
-	defer e.mu.Unlock()
+func (e *FileStorageEngine) CreateCollection(name string) (err error) {
+	if e.instrumented() {
+		defer e.observe(opCreateCollection, name, "", time.Now(), &err)
+	}
+	if err := e.checkWritable(name); err != nil {
+		return err
+	}
 
 	// Acquire file lock
 	lockFile, err := e.acquireFileLock(name)
@@ -281,6 +716,10 @@ func (e *FileStorageEngine) CreateCollection(name string) error {
 	}
 	defer e.releaseFileLock(lockFile)
 
+	// Acquire write lock
+	e.lockWrite(name)
+	defer e.mu.Unlock()
+
 	// Check if collection already exists
 	path := e.getCollectionPath(name)
 	if _, err := os.Stat(path); err == nil {
@@ -299,13 +738,67 @@ func (e *FileStorageEngine) CreateCollection(name string) error {
 	}
 
 	// Write to disk
-	return e.writeCollectionFileAtomic(name, collFile)
+	_, err = e.writeCollectionFileAtomic(name, collFile)
+	return err
+}
+
+// DropCollection deletes a collection's file, with its documents and
+// configuration, and its lock file. Dropping a missing collection fails
+// with an error wrapping os.ErrNotExist.
+func (e *FileStorageEngine) DropCollection(name string) (err error) {
+	if e.instrumented() {
+		defer e.observe(opDropCollection, name, "", time.Now(), &err)
+	}
+	if err := e.checkWritable(name); err != nil {
+		return err
+	}
+
+	// Acquire file lock
+	lockFile, err := e.acquireFileLock(name)
+	if err != nil {
+		return err
+	}
+	defer e.releaseFileLock(lockFile)
+
+	// Acquire write lock
+	e.lockWrite(name)
+	defer e.mu.Unlock()
+
+	path := e.getCollectionPath(name)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("failed to drop collection %s: %w", name, err)
+	}
+	removeErr := os.Remove(path)
+	e.coalescer.discard(name)
+	e.access.drop(name)
+	e.writes.drop(name)
+	e.reads.drop(name)
+
+	// Waiters on the lock look it up again once it is released, creating a
+	// new lock file
+	e.locksMu.Lock()
+	if e.locks != nil {
+		delete(e.locks, name)
+	}
+	lockFile.discarded = true
+	e.locksMu.Unlock()
+	if removeErr != nil {
+		return fmt.Errorf("failed to drop collection %s: %w", name, removeErr)
+	}
+	os.Remove(filepath.Join(e.dataDir, name+".lock"))
+
+	e.schemasMu.Lock()
+	delete(e.schemas, name)
+	e.schemasMu.Unlock()
+	return nil
 }
 
 // ListCollections returns all collection names
 func (e *FileStorageEngine) ListCollections() ([]string, error) {
 	// Acquire read lock
-	e.mu.RLock()
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
 	defer e.mu.RUnlock()
 
 	// Read directory
@@ -317,7 +810,7 @@ func (e *FileStorageEngine) ListCollections() ([]string, error) {
 	// Filter for .json files
 	var collections []string
 	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".json" && !strings.HasSuffix(entry.Name(), indexFileSuffix) {
 			name := entry.Name()[:len(entry.Name())-5] // Remove .json extension
 			collections = append(collections, name)
 		}
@@ -326,23 +819,151 @@ func (e *FileStorageEngine) ListCollections() ([]string, error) {
 	return collections, nil
 }
 
-// Close flushes pending writes and releases locks
+// CollectionRevision returns the revision counter of a collection, which changes
+// every time the collection file is rewritten. A missing collection has revision 0.
+func (e *FileStorageEngine) CollectionRevision(collection string) (uint64, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return 0, err
+	}
+	defer e.mu.RUnlock()
+
+	meta, err := e.readCollectionMetadata(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	return meta.Revision, nil
+}
+
+// CountDocuments returns the number of documents in a collection. A missing
+// collection has none.
+func (e *FileStorageEngine) CountDocuments(collection string) (int, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return 0, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(collFile.Documents), nil
+}
+
+// CollectionSize returns the size in bytes of a collection's file. A missing
+// collection has size 0.
+func (e *FileStorageEngine) CollectionSize(collection string) (int64, error) {
+	if err := e.rlock(); err != nil {
+		return 0, err
+	}
+	defer e.mu.RUnlock()
+
+	info, err := os.Stat(e.getCollectionPath(collection))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat collection %s: %w", collection, err)
+	}
+	return info.Size(), nil
+}
+
+// defaultCloseTimeout is how long Close waits for operations in flight
+const defaultCloseTimeout = 30 * time.Second
+
+// Close is CloseContext waiting up to 30 seconds for operations in flight
 func (e *FileStorageEngine) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCloseTimeout)
+	defer cancel()
+	return e.CloseContext(ctx)
+}
+
+// CloseContext shuts the engine and its namespaces down. Operations started
+// from then on fail with ErrEngineClosed, and those in flight are waited
+// for until ctx is done. Then rewritten files are synced, watches end, the
+// oplog is closed and lock files are released. If ctx is done first, the
+// shutdown goes on and the error wraps its cause; operations still waiting
+// for a lock then fail with ErrEngineClosed. Calling it again does nothing.
+func (e *FileStorageEngine) CloseContext(ctx context.Context) error {
+	e.closeMu.Lock()
+	defer e.closeMu.Unlock()
+	if e.closed.Load() {
+		return nil
+	}
+	e.closed.Store(true)
+	if e.coalescer != nil {
+		e.coalescer.close()
+	}
+
 	e.locksMu.Lock()
-	defer e.locksMu.Unlock()
+	locks := e.locks
+	e.locks = nil
+	e.locksMu.Unlock()
 
-	// Release all file locks
-	for collection, lockFile := range e.locks {
-		if err := e.releaseFileLock(lockFile); err != nil {
-			return fmt.Errorf("failed to release lock for collection %s: %w", collection, err)
+	var errs []error
+	if err := e.drain(ctx, locks); err != nil {
+		errs = append(errs, err)
+	}
+	if e.coalescer != nil {
+		if lost := e.coalescer.collections(); len(lost) > 0 {
+			errs = append(errs, fmt.Errorf("failed to flush coalesced writes to %s", strings.Join(lost, ", ")))
 		}
-		if err := lockFile.Close(); err != nil {
-			return fmt.Errorf("failed to close lock file for collection %s: %w", collection, err)
+	}
+	if e.access != nil {
+		if err := e.access.close(); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	if err := e.closeNamespaces(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	e.watchers.close()
+	e.compaction.close()
 
-	// Clear locks map
-	e.locks = make(map[string]*os.File)
+	if e.syncer != nil {
+		if err := e.syncer.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := e.closeOplog(); err != nil {
+		errs = append(errs, err)
+	}
+	e.unregisterMetrics()
 
-	return nil
+	e.logEvent(slog.LevelInfo, "storage engine closed", slog.String("dir", e.dataDir))
+	return errors.Join(errs...)
+}
+
+// drain waits for the operations in flight of a closed engine: writes, each
+// holding the lock of its collection, closing the lock files they release,
+// then reads. A lock still held once ctx is done is left to its holder,
+// whose releaseFileLock closes the file.
+func (e *FileStorageEngine) drain(ctx context.Context, locks map[string]*fileLock) error {
+	var errs []error
+	for collection, l := range locks {
+		if err := core.LockContext(ctx, &l.mu); err != nil {
+			errs = append(errs, fmt.Errorf("failed to wait for writes to collection %s: %w", collection, err))
+			continue
+		}
+		if e.coalescer != nil {
+			if err := e.coalescer.writeHeld(collection, l); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		err := l.discard()
+		l.mu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to close lock file for collection %s: %w", collection, err))
+		}
+	}
+
+	if err := core.LockContext(ctx, &e.mu); err != nil {
+		errs = append(errs, fmt.Errorf("failed to wait for reads: %w", err))
+	} else {
+		e.mu.Unlock()
+	}
+	return errors.Join(errs...)
 }
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -179,6 +181,96 @@ func TestDeleteDocument(t *testing.T) {
 	}
 }
 
+func TestDeleteMissingDocument(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.CreateCollection("users"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if err := engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		docID  core.DocumentID
+		exists bool
+	}{
+		{"delete existing", "user_001", true},
+		{"delete twice", "user_001", false},
+		{"delete missing", "user_404", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := os.ReadFile(engine.getCollectionPath("users"))
+			if err != nil {
+				t.Fatalf("Failed to read collection file: %v", err)
+			}
+			err = engine.DeleteDocument("users", tt.docID)
+			after, _ := os.ReadFile(engine.getCollectionPath("users"))
+
+			if tt.exists {
+				if err != nil {
+					t.Fatalf("Failed to delete document: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, core.ErrDocumentNotFound) {
+				t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+			}
+			if string(before) != string(after) {
+				t.Errorf("Expected the collection file to be left as it was")
+			}
+		})
+	}
+}
+
+func TestDocumentCountAfterWritesAndDeletes(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.CreateCollection("items"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	// Corrupt the stored count: the next write recomputes it
+	collFile, err := engine.readCollectionFile("items")
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	collFile.Metadata.DocumentCount = 42
+	data, _ := json.Marshal(collFile)
+	if err := os.WriteFile(engine.getCollectionPath("items"), data, 0644); err != nil {
+		t.Fatalf("Failed to write collection file: %v", err)
+	}
+
+	expected := make(map[core.DocumentID]bool)
+	for i := 0; i < 30; i++ {
+		docID := core.DocumentID(fmt.Sprintf("item_%d", i%7))
+		if i%3 == 2 {
+			err := engine.DeleteDocument("items", docID)
+			if expected[docID] && err != nil {
+				t.Fatalf("Failed to delete document: %v", err)
+			}
+			delete(expected, docID)
+		} else {
+			if err := engine.WriteDocument("items", docID, core.Document{"i": i}); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+			expected[docID] = true
+		}
+
+		collFile, err := engine.readCollectionFile("items")
+		if err != nil {
+			t.Fatalf("Failed to read collection file: %v", err)
+		}
+		if collFile.Metadata.DocumentCount != len(collFile.Documents) || len(collFile.Documents) != len(expected) {
+			t.Fatalf("Expected a count of %d after op %d, got %d for %d documents", len(expected), i, collFile.Metadata.DocumentCount, len(collFile.Documents))
+		}
+	}
+}
+
 func TestScanCollection(t *testing.T) {
 	engine, tempDir := setupTestEngine(t)
 	defer cleanupTestEngine(engine, tempDir)
@@ -341,8 +433,32 @@ func TestReadNonExistentDocument(t *testing.T) {
 
 	// Try to read non-existent document
 	_, err = engine.ReadDocument("users", "nonexistent")
-	if err == nil {
-		t.Errorf("Expected error when reading non-existent document")
+	if !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound when reading non-existent document, got %v", err)
+	}
+}
+
+func TestCountDocuments(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	count, err := engine.CountDocuments("users")
+	if err != nil {
+		t.Fatalf("Failed to count documents: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected 0 documents in a missing collection, got %d", count)
+	}
+
+	for i := 0; i < 3; i++ {
+		engine.WriteDocument("users", core.DocumentID(fmt.Sprintf("user_%d", i)), core.Document{"n": i})
+	}
+	engine.WriteDocument("users", "user_0", core.Document{"n": 10})
+	engine.DeleteDocument("users", "user_1")
+
+	count, _ = engine.CountDocuments("users")
+	if count != 2 {
+		t.Errorf("Expected 2 documents, got %d", count)
 	}
 }
 
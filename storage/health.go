@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// ProbeWritable checks that the data directory accepts writes by creating,
+// syncing and removing a hidden probe file
+func (e *FileStorageEngine) ProbeWritable() error {
+	f, err := os.CreateTemp(e.dataDir, ".health-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create probe file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write probe file: %w", err)
+	}
+	if err := os.Remove(f.Name()); err != nil {
+		return fmt.Errorf("failed to remove probe file: %w", err)
+	}
+	return nil
+}
+
+// CheckCollection reads and parses a collection's file, failing if it
+// cannot be. A missing collection has nothing to check.
+func (e *FileStorageEngine) CheckCollection(collection string) error {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return err
+	}
+	defer e.mu.RUnlock()
+
+	if _, err := e.readCollectionFile(collection); err != nil {
+		return fmt.Errorf("collection %s: %w", collection, err)
+	}
+	return nil
+}
+
+// FreeSpace returns the bytes available to unprivileged users on the file
+// system of the data directory
+func (e *FileStorageEngine) FreeSpace() (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(e.dataDir, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat file system: %w", err)
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+const (
+	// historyCheckpointInterval is the initial number of oplog entries
+	// between the checkpoints of time-travel reads, and so the most entries
+	// one replays
+	historyCheckpointInterval = 1000
+
+	// maxHistoryCheckpoints bounds the checkpoints kept. Past it every other
+	// one is dropped and the interval doubled, so the memory they hold stays
+	// bounded as the log grows. It must be even for the newest to survive.
+	maxHistoryCheckpoints = 32
+)
+
+// ErrHistoryUnavailable is returned by reads as of a moment the oplog no
+// longer covers, or of a document whose state then it does not record
+var ErrHistoryUnavailable = errors.New("history is not available")
+
+// oplogHistory indexes the oplog for time-travel reads. It is built on the
+// first such read and kept up to date by appends.
+type oplogHistory struct {
+	oldest time.Time // Timestamp of the oldest entry; zero if the log is empty
+	// first is the operation of each document's oldest entry, by collection
+	first map[string]map[core.DocumentID]core.OperationType
+	// tip is the state of each document as of the last entry, nil if
+	// deleted, by collection
+	tip      map[string]map[core.DocumentID]core.Document
+	since    int // Entries since the last checkpoint
+	interval int // Entries between checkpoints
+
+	checkpoints []historyCheckpoint // Oldest first
+}
+
+// historyCheckpoint is the state of the documents the oplog records as of
+// one entry, from which reads replay the entries that follow
+type historyCheckpoint struct {
+	ts     time.Time                                    // Of the entry; zero for the start of the log
+	offset int64                                        // Of the entry that follows in the log file
+	docs   map[string]map[core.DocumentID]core.Document // As tip
+}
+
+// newOplogHistory returns the history of an empty log
+func newOplogHistory() *oplogHistory {
+	return &oplogHistory{
+		first:       make(map[string]map[core.DocumentID]core.OperationType),
+		tip:         make(map[string]map[core.DocumentID]core.Document),
+		interval:    historyCheckpointInterval,
+		checkpoints: []historyCheckpoint{{docs: make(map[string]map[core.DocumentID]core.Document)}},
+	}
+}
+
+// add records an entry ending at offset in the log file
+func (h *oplogHistory) add(entry OplogEntry, offset int64) {
+	if h.oldest.IsZero() {
+		h.oldest = entry.Timestamp
+	}
+	if h.first[entry.Collection] == nil {
+		h.first[entry.Collection] = make(map[core.DocumentID]core.OperationType)
+		h.tip[entry.Collection] = make(map[core.DocumentID]core.Document)
+	}
+	if _, ok := h.first[entry.Collection][entry.DocID]; !ok {
+		h.first[entry.Collection][entry.DocID] = entry.Op
+	}
+	h.tip[entry.Collection][entry.DocID] = entry.Document
+
+	if h.since++; h.since == h.interval {
+		docs := make(map[string]map[core.DocumentID]core.Document, len(h.tip))
+		for collection, tip := range h.tip {
+			docs[collection] = maps.Clone(tip)
+		}
+		h.checkpoints = append(h.checkpoints, historyCheckpoint{ts: entry.Timestamp, offset: offset, docs: docs})
+		h.since = 0
+		if len(h.checkpoints) > maxHistoryCheckpoints {
+			h.thin()
+		}
+	}
+}
+
+// thin drops every other checkpoint but the start of the log and doubles
+// the interval between them
+func (h *oplogHistory) thin() {
+	kept := h.checkpoints[:1]
+	for i := 2; i < len(h.checkpoints); i += 2 {
+		kept = append(kept, h.checkpoints[i])
+	}
+	clear(h.checkpoints[len(kept):])
+	h.checkpoints = kept
+	h.interval *= 2
+}
+
+// collectionHistory is what the oplog records of a collection as of a moment
+type collectionHistory struct {
+	// known is the state of the documents changed by then, nil if deleted
+	known map[core.DocumentID]core.Document
+	// first is the operation of the oldest entry of each document changed
+	// since
+	first map[core.DocumentID]core.OperationType
+	// compacted is set when compaction removed entries from after then, so
+	// a document first inserted since may have existed before
+	compacted bool
+}
+
+// resolve returns a document's state given its current state, and whether
+// it existed then
+func (h collectionHistory) resolve(docID core.DocumentID, current core.Document) (core.Document, bool, error) {
+	if doc, ok := h.known[docID]; ok {
+		return doc, doc != nil, nil
+	}
+	switch op, ok := h.first[docID]; {
+	case !ok:
+		// Unchanged since
+		return current, current != nil, nil
+	case op == core.OpInsert && !h.compacted:
+		return nil, false, nil
+	case op == core.OpInsert:
+		return nil, false, fmt.Errorf("%w: %s has oplog entries removed by compaction", ErrHistoryUnavailable, docID)
+	}
+	return nil, false, fmt.Errorf("%w: %s changed before the oldest oplog entry", ErrHistoryUnavailable, docID)
+}
+
+// asOf returns what the log records of a collection as of t, replaying the
+// entries that follow the last checkpoint before t. The log is read without
+// holding l.mu; l.rewriteMu keeps it from being rewritten meanwhile.
+func (l *oplog) asOf(collection string, t time.Time) (collectionHistory, error) {
+	l.rewriteMu.Lock()
+	defer l.rewriteMu.Unlock()
+	if err := l.loadHistory(); err != nil {
+		return collectionHistory{}, err
+	}
+
+	l.mu.Lock()
+	h := l.history
+	if h.oldest.IsZero() || t.Before(h.oldest) {
+		l.mu.Unlock()
+		return collectionHistory{}, fmt.Errorf("%w: the oplog starts at %s", ErrHistoryUnavailable, h.oldest.Format(time.RFC3339Nano))
+	}
+	i := sort.Search(len(h.checkpoints), func(i int) bool { return h.checkpoints[i].ts.After(t) }) - 1
+	cp := h.checkpoints[i]
+	first := maps.Clone(h.first[collection])
+	end := l.size
+	l.mu.Unlock()
+
+	known := maps.Clone(cp.docs[collection])
+	if known == nil {
+		known = make(map[core.DocumentID]core.Document)
+	}
+	err := l.replay(cp.offset, func(entry OplogEntry, offset int64) bool {
+		if offset > end || entry.Timestamp.After(t) {
+			return false
+		}
+		if entry.Collection == collection {
+			known[entry.DocID] = entry.Document
+		}
+		return true
+	})
+	if err != nil {
+		return collectionHistory{}, err
+	}
+
+	for docID := range known {
+		delete(first, docID)
+	}
+	return collectionHistory{known: known, first: first, compacted: t.Before(l.compacted[collection])}, nil
+}
+
+// loadHistory indexes the whole log unless it already is. The log is
+// replayed without holding l.mu, which is taken only to index the entries
+// appended meanwhile and install the history. Callers hold l.rewriteMu.
+func (l *oplog) loadHistory() error {
+	l.mu.Lock()
+	end := l.size
+	built := l.history != nil
+	l.mu.Unlock()
+	if built {
+		return nil
+	}
+
+	h := newOplogHistory()
+	add := func(entry OplogEntry, offset int64) bool {
+		h.add(entry, offset)
+		return true
+	}
+	if err := l.replay(0, func(entry OplogEntry, offset int64) bool {
+		return offset <= end && add(entry, offset)
+	}); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.replay(end, add); err != nil {
+		return err
+	}
+	l.history = h
+	return nil
+}
+
+// replay calls fn with the entries from offset in the log file, and the
+// offset each ends at, until fn returns false. Callers hold l.mu, or
+// l.rewriteMu and stop at the size of the log when they took it.
+func (l *oplog) replay(offset int64, fn func(entry OplogEntry, end int64) bool) error {
+	file, err := os.Open(filepath.Join(l.dir, oplogFileName))
+	if err != nil {
+		return fmt.Errorf("failed to open oplog: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek oplog: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read oplog: %w", err)
+		}
+		var entry OplogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("failed to parse oplog entry: %w", err)
+		}
+		offset += int64(len(line))
+		if !fn(entry, offset) {
+			return nil
+		}
+	}
+}
+
+// ReadDocumentAsOf returns a document as it was at t, failing with
+// core.ErrDocumentNotFound if it did not exist then. It requires the oplog,
+// and fails with ErrHistoryUnavailable before its oldest entry, or for a
+// document updated since whose earlier state the oplog no longer holds.
+// Changes that bypass the oplog, such as restores and dropped collections,
+// are not seen.
+func (e *FileStorageEngine) ReadDocumentAsOf(collection string, docID core.DocumentID, t time.Time) (core.Document, error) {
+	var doc core.Document
+	found := false
+	err := e.readAsOf(collection, t, func(current *CollectionFile, h collectionHistory) error {
+		var err error
+		doc, found, err = h.resolve(docID, current.Documents[string(docID)])
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
+	}
+	return doc.Clone(), nil
+}
+
+// ScanCollectionAsOf iterates over the documents of a collection as it was
+// at t, as ReadDocumentAsOf reads them. Documents whose state then the
+// oplog does not hold fail the scan before any is visited.
+func (e *FileStorageEngine) ScanCollectionAsOf(collection string, t time.Time, fn func(core.DocumentID, core.Document) bool) error {
+	docs := make(map[core.DocumentID]core.Document)
+	err := e.readAsOf(collection, t, func(current *CollectionFile, h collectionHistory) error {
+		for id, doc := range current.Documents {
+			docs[core.DocumentID(id)] = doc
+		}
+		for docID := range h.known {
+			docs[docID] = nil
+		}
+		for docID := range h.first {
+			docs[docID] = nil
+		}
+		for docID := range docs {
+			doc, found, err := h.resolve(docID, current.Documents[string(docID)])
+			if err != nil {
+				return err
+			}
+			if found {
+				docs[docID] = doc
+			} else {
+				delete(docs, docID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for docID, doc := range docs {
+		if !fn(docID, doc.Clone()) {
+			break
+		}
+	}
+	return nil
+}
+
+// readAsOf calls fn with the current state of a collection and what the
+// oplog records of it as of t, read together under the read lock so that no
+// write falls between them
+func (e *FileStorageEngine) readAsOf(collection string, t time.Time, fn func(current *CollectionFile, h collectionHistory) error) error {
+	if err := e.rlock(); err != nil {
+		return err
+	}
+	defer e.mu.RUnlock()
+	if e.oplog == nil {
+		return ErrOplogDisabled
+	}
+
+	current, err := e.readCollectionFile(collection)
+	if err != nil {
+		return err
+	}
+	h, err := e.oplog.asOf(collection, t)
+	if err != nil {
+		return err
+	}
+	e.access.read(collection, "")
+	return fn(current, h)
+}
+
+// AsOf returns a read-only view of the engine's collections as they were
+// at t, for running queries against. Reads fail as ReadDocumentAsOf and
+// ScanCollectionAsOf do, and writes with ErrReadOnly.
+func (e *FileStorageEngine) AsOf(t time.Time) core.StorageEngine {
+	return asOfView{e: e, t: t}
+}
+
+// asOfView is the view returned by AsOf
+type asOfView struct {
+	e *FileStorageEngine
+	t time.Time
+}
+
+func (v asOfView) ReadDocument(collection string, docID core.DocumentID) (core.Document, error) {
+	return v.e.ReadDocumentAsOf(collection, docID, v.t)
+}
+
+func (v asOfView) ScanCollection(collection string, fn func(core.DocumentID, core.Document) bool) error {
+	return v.e.ScanCollectionAsOf(collection, v.t, fn)
+}
+
+func (v asOfView) ListCollections() ([]string, error) {
+	return v.e.ListCollections()
+}
+
+func (v asOfView) WriteDocument(collection string, _ core.DocumentID, _ core.Document) error {
+	return fmt.Errorf("failed to write collection %s: %w", collection, ErrReadOnly)
+}
+
+func (v asOfView) DeleteDocument(collection string, _ core.DocumentID) error {
+	return fmt.Errorf("failed to write collection %s: %w", collection, ErrReadOnly)
+}
+
+func (v asOfView) CreateCollection(name string) error {
+	return fmt.Errorf("failed to write collection %s: %w", name, ErrReadOnly)
+}
+
+// Close does nothing; the view's engine stays open
+func (v asOfView) Close() error {
+	return nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// newOplogEngine returns an engine with the oplog enabled
+func newOplogEngine(t *testing.T) *FileStorageEngine {
+	t.Helper()
+	engine, err := NewFileStorageEngine(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	return engine
+}
+
+func TestReadDocumentAsOf(t *testing.T) {
+	engine := newOplogEngine(t)
+	for rev := 1; rev <= 10; rev++ {
+		if err := engine.WriteDocument("orders", "o1", core.Document{"rev": float64(rev)}); err != nil {
+			t.Fatalf("Failed to write revision %d: %v", rev, err)
+		}
+	}
+	engine.DeleteDocument("orders", "o1")
+	entries, err := engine.ReadOplog(0, 0)
+	if err != nil || len(entries) != 11 {
+		t.Fatalf("Failed to read 11 oplog entries, got %d: %v", len(entries), err)
+	}
+
+	// Each revision is read as of its own timestamp and until the next
+	for i, entry := range entries[:10] {
+		until := entries[i+1].Timestamp.Add(-time.Nanosecond)
+		for _, at := range []time.Time{entry.Timestamp, until} {
+			doc, err := engine.ReadDocumentAsOf("orders", "o1", at)
+			if err != nil {
+				t.Fatalf("Failed to read revision %d: %v", i+1, err)
+			}
+			if doc["rev"] != float64(i+1) {
+				t.Errorf("Expected revision %d as of %v, got %v", i+1, at, doc["rev"])
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected error
+	}{
+		{"after the delete", entries[10].Timestamp, core.ErrDocumentNotFound},
+		{"now", time.Now(), core.ErrDocumentNotFound},
+		{"before the oplog", entries[0].Timestamp.Add(-time.Nanosecond), ErrHistoryUnavailable},
+	}
+	for _, tt := range tests {
+		if _, err := engine.ReadDocumentAsOf("orders", "o1", tt.at); !errors.Is(err, tt.expected) {
+			t.Errorf("Expected %v %s, got %v", tt.expected, tt.name, err)
+		}
+	}
+}
+
+func TestReadDocumentAsOfUnlogged(t *testing.T) {
+	engine, err := NewFileStorageEngine(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	engine.WriteDocument("users", "kept", core.Document{"v": "before"})
+	engine.WriteDocument("users", "changed", core.Document{"v": "before"})
+	if _, err := engine.ReadDocumentAsOf("users", "kept", time.Now()); !errors.Is(err, ErrOplogDisabled) {
+		t.Errorf("Expected ErrOplogDisabled, got %v", err)
+	}
+
+	engine.EnableOplog()
+	engine.WriteDocument("users", "added", core.Document{"v": "after"})
+	start := time.Now()
+	engine.WriteDocument("users", "changed", core.Document{"v": "after"})
+
+	// A document unchanged since the oplog began is as it is now, and one
+	// inserted after the moment did not exist, but the state of one updated
+	// since is unknown
+	if doc, err := engine.ReadDocumentAsOf("users", "kept", start); err != nil || doc["v"] != "before" {
+		t.Errorf("Expected the unchanged document, got %v, %v", doc, err)
+	}
+	if _, err := engine.ReadDocumentAsOf("users", "changed", start); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Expected ErrHistoryUnavailable, got %v", err)
+	}
+	if err := engine.ScanCollectionAsOf("users", start, func(core.DocumentID, core.Document) bool { return true }); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Expected the scan to fail with ErrHistoryUnavailable, got %v", err)
+	}
+}
+
+func TestScanCollectionAsOfCheckpoints(t *testing.T) {
+	engine := newOplogEngine(t)
+	const docs, batches, step = 1000, 4, 200
+	var ends []time.Time
+	for b := 0; b < batches; b++ {
+		err := engine.ApplyBatch("items", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			writes := make(map[core.DocumentID]core.Document, docs)
+			for i := 0; i < docs-b*step; i++ {
+				writes[core.DocumentID(fmt.Sprintf("i%04d", i))] = core.Document{"batch": float64(b)}
+			}
+			return writes, nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to apply batch %d: %v", b, err)
+		}
+		last, _ := engine.LastOplogSeq()
+		entries, _ := engine.ReadOplog(last-1, 1)
+		ends = append(ends, entries[0].Timestamp)
+	}
+	engine.ReadDocumentAsOf("items", "i0000", ends[0])
+	if n := len(engine.oplog.history.checkpoints); n < 3 {
+		t.Errorf("Expected checkpoints every %d entries, got %d", historyCheckpointInterval, n)
+	}
+
+	// Later batches are smaller, so each as-of scan sees the batch it
+	// follows on the documents it wrote and the one before on the rest
+	for b, end := range ends {
+		counts := make(map[float64]int)
+		err := engine.ScanCollectionAsOf("items", end, func(_ core.DocumentID, doc core.Document) bool {
+			counts[doc["batch"].(float64)]++
+			return true
+		})
+		if err != nil {
+			t.Fatalf("Failed to scan as of batch %d: %v", b, err)
+		}
+		if counts[float64(b)] != docs-b*step || (b > 0 && counts[float64(b-1)] != step) {
+			t.Errorf("Expected batch %d to show, got %v", b, counts)
+		}
+	}
+
+	// Entries appended since the history was built are read too
+	engine.WriteDocument("items", "i0000", core.Document{"batch": "late"})
+	if doc, err := engine.ReadDocumentAsOf("items", "i0000", time.Now()); err != nil || doc["batch"] != "late" {
+		t.Errorf("Expected the late write, got %v, %v", doc, err)
+	}
+
+	// Trimming moves the start of the history
+	last, _ := engine.LastOplogSeq()
+	if err := engine.TrimOplog(last); err != nil {
+		t.Fatalf("Failed to trim oplog: %v", err)
+	}
+	if _, err := engine.ReadDocumentAsOf("items", "i0000", ends[3]); !errors.Is(err, ErrHistoryUnavailable) {
+		t.Errorf("Expected ErrHistoryUnavailable after the trim, got %v", err)
+	}
+}
+
+func TestOplogHistoryThinsCheckpoints(t *testing.T) {
+	h := newOplogHistory()
+	start := time.Now()
+	const entries = historyCheckpointInterval * maxHistoryCheckpoints * 3
+	for i := 1; i <= entries; i++ {
+		h.add(OplogEntry{Timestamp: start.Add(time.Duration(i)), Op: core.OpUpdate, Collection: "items", DocID: "a"}, int64(i))
+	}
+	if n := len(h.checkpoints); n > maxHistoryCheckpoints {
+		t.Errorf("Expected at most %d checkpoints, got %d", maxHistoryCheckpoints, n)
+	}
+	if h.interval != historyCheckpointInterval*4 {
+		t.Errorf("Expected the interval to double twice, got %d", h.interval)
+	}
+	for i, cp := range h.checkpoints {
+		if cp.offset != int64(i*h.interval) {
+			t.Errorf("Expected checkpoint %d at %d, got %d", i, i*h.interval, cp.offset)
+		}
+	}
+}
+
+func TestAsOfView(t *testing.T) {
+	engine := newOplogEngine(t)
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada"})
+	at := time.Now()
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada Lovelace"})
+
+	view := engine.AsOf(at)
+	if doc, err := view.ReadDocument("users", "u1"); err != nil || doc["name"] != "Ada" {
+		t.Errorf("Expected the earlier name, got %v, %v", doc, err)
+	}
+	if err := view.WriteDocument("users", "u2", core.Document{}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ErrIDMismatch is returned for a write whose ID field holds another ID than
+// the document is written under
+var ErrIDMismatch = errors.New("document ID field does not match its ID")
+
+// WithIDField keeps the ID field of written documents in step with the IDs
+// they are written under: a document without the field gets it, and one
+// whose field holds another ID fails with ErrIDMismatch. InsertDocument
+// reads IDs from the field unless given another key. An empty name means
+// core.DefaultIDKey.
+func WithIDField(name string) Option {
+	return func(c *Config) {
+		if name == "" {
+			name = core.DefaultIDKey
+		}
+		c.IDField = name
+	}
+}
+
+// WithIDFieldCorrection overwrites an ID field holding another ID with the
+// document's ID instead of failing the write. It requires WithIDField.
+func WithIDFieldCorrection() Option {
+	return func(c *Config) {
+		c.CorrectIDField = true
+	}
+}
+
+// SyncIDFields populates or checks the ID field of the documents a batch
+// writes, as every write does with WithIDField, replacing the documents it
+// changes with copies so that callers' documents are left alone. Layers
+// that act on writes before the engine applies them, such as indexes, call
+// it first so they see the documents as stored.
+func (e *FileStorageEngine) SyncIDFields(collection string, writes map[core.DocumentID]core.Document) error {
+	field := e.cfg.IDField
+	if field == "" {
+		return nil
+	}
+	for docID, doc := range writes {
+		if doc == nil {
+			continue
+		}
+		value, ok := doc[field]
+		if ok && value == string(docID) {
+			continue
+		}
+		if ok && !e.cfg.CorrectIDField {
+			return fmt.Errorf("failed to write %s/%s: %w: %s holds %v", collection, docID, ErrIDMismatch, field, value)
+		}
+		doc = doc.Clone()
+		doc[field] = string(docID)
+		writes[docID] = doc
+	}
+	return nil
+}
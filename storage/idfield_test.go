@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestIDField(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		doc      core.Document
+		expected interface{} // The stored ID field, or an error
+	}{
+		{"missing field populated", nil, core.Document{"n": 1}, "u1"},
+		{"matching field kept", nil, core.Document{"_id": "u1"}, "u1"},
+		{"conflicting field rejected", nil, core.Document{"_id": "u2"}, ErrIDMismatch},
+		{"non-string field rejected", nil, core.Document{"_id": 1}, ErrIDMismatch},
+		{"conflicting field corrected", []Option{WithIDFieldCorrection()}, core.Document{"_id": "u2"}, "u1"},
+		{"custom field", []Option{WithIDField("id")}, core.Document{"_id": "other"}, "u1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, err := NewFileStorageEngine(t.TempDir(), append([]Option{WithIDField("")}, tt.opts...)...)
+			if err != nil {
+				t.Fatalf("Failed to create engine: %v", err)
+			}
+			defer engine.Close()
+			field := engine.Config().IDField
+			original := tt.doc.Clone()
+
+			err = engine.WriteDocument("users", "u1", tt.doc)
+			if expectedErr, ok := tt.expected.(error); ok {
+				if !errors.Is(err, expectedErr) {
+					t.Errorf("Expected %v, got %v", expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+			doc, _ := engine.ReadDocument("users", "u1")
+			if doc[field] != tt.expected {
+				t.Errorf("Expected %s to be %v, got %v", field, tt.expected, doc[field])
+			}
+			if !reflect.DeepEqual(tt.doc, original) {
+				t.Errorf("Expected the caller's document left alone, got %v", tt.doc)
+			}
+		})
+	}
+}
+
+func TestIDFieldBatches(t *testing.T) {
+	engine, err := NewFileStorageEngine(t.TempDir(), WithIDField("id"))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	err = engine.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{"a": {"n": 1}, "b": {"id": "c"}}, nil
+	})
+	if !errors.Is(err, ErrIDMismatch) {
+		t.Errorf("Expected a conflicting batch to fail with ErrIDMismatch, got %v", err)
+	}
+	err = engine.ApplyMultiBatch([]string{"users"}, func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		return map[string]map[core.DocumentID]core.Document{"users": {"a": {"n": 1}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	if doc, _ := engine.ReadDocument("users", "a"); doc["id"] != "a" {
+		t.Errorf("Expected the batch to populate the ID field, got %v", doc)
+	}
+
+	// Inserts take their ID from the field
+	id, err := engine.InsertDocument("users", core.Document{"id": "named"}, core.IDOptions{})
+	if err != nil || id != "named" {
+		t.Errorf("Expected the insert under its ID field, got %q, %v", id, err)
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// EngineStats is a snapshot of an engine's state gathered from counters and
+// file sizes, without reading any collection
+type EngineStats struct {
+	OpenedAt          time.Time
+	Watchers          int    // Active Watch subscriptions
+	OplogEnabled      bool   // EnableOplog was called
+	OplogBytes        int64  // Size of the oplog file
+	OplogLastSeq      uint64 // Sequence number of the latest oplog entry
+	JournalBytes      int64  // Size of the batch journal, present only while a multi-collection batch commits
+	SchemaCacheHits   uint64 // Writes whose collection schema was found compiled
+	SchemaCacheMisses uint64 // Writes whose collection schema had to be compiled
+	ReadCacheHits     uint64 // Fresh reads with read options served from the read cache
+	ReadCacheMisses   uint64 // Reads with read options that loaded a collection into the read cache
+	StaleReads        uint64 // Cached reads served from the read cache without checking the file
+
+	Compactions         uint64    // Compactions that reclaimed oplog space
+	LastCompactionAt    time.Time // When the latest of them finished
+	LastCompactionBytes int64     // Bytes the latest of them reclaimed
+	BytesReclaimed      int64     // Bytes all of them reclaimed
+	CompactionPaused    bool      // PauseCompaction is in effect
+
+	Writes []WriteStats // Write statistics of the collections written, by name
+}
+
+// Stats returns a snapshot of the engine's state. It takes no lock a
+// writer holds for long.
+func (e *FileStorageEngine) Stats() (EngineStats, error) {
+	stats := EngineStats{
+		OpenedAt:          e.openedAt,
+		Watchers:          int(e.watchers.active.Load()),
+		SchemaCacheHits:   e.schemaHits.Load(),
+		SchemaCacheMisses: e.schemaMisses.Load(),
+		ReadCacheHits:     e.reads.hits.Load(),
+		ReadCacheMisses:   e.reads.misses.Load(),
+		StaleReads:        e.reads.stale.Load(),
+		Writes:            e.writes.all(),
+	}
+	e.compaction.stats(&stats)
+
+	if log := e.currentOplog(); log != nil {
+		stats.OplogEnabled = true
+		log.mu.Lock()
+		stats.OplogLastSeq = log.lastSeq
+		log.mu.Unlock()
+
+		size, err := fileSize(filepath.Join(e.dataDir, oplogFileName))
+		if err != nil {
+			return EngineStats{}, err
+		}
+		stats.OplogBytes = size
+	}
+
+	size, err := fileSize(filepath.Join(e.dataDir, journalFileName))
+	if err != nil {
+		return EngineStats{}, err
+	}
+	stats.JournalBytes = size
+	return stats, nil
+}
+
+// fileSize returns the size of a file, or 0 if it does not exist
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", filepath.Base(path), err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,359 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+const (
+	// journalFileName describes a multi-collection batch whose collection
+	// files are being replaced. Its presence marks the batch as committed.
+	journalFileName = "_batch.journal"
+
+	// stagedFileSuffix marks the new collection files of a multi-collection
+	// batch before they replace the originals
+	stagedFileSuffix = ".json.staged"
+)
+
+// commitStage identifies a point in ApplyMultiBatch where tests can simulate a crash
+type commitStage int
+
+const (
+	stageBeforeJournal commitStage = iota // Staged files are written and synced
+	stageAfterJournal                     // The journal is written; no file replaced yet
+	stageAfterRename                      // One more collection file was replaced
+)
+
+// journal lists the file replacements of a committed multi-collection batch
+// and, if the oplog is enabled, the entries recording its changes
+type journal struct {
+	Replacements []replacement `json:"replacements"`
+	Oplog        []OplogEntry  `json:"oplog,omitempty"`
+}
+
+// replacement is one collection file to replace, with paths relative to the data directory
+type replacement struct {
+	Collection string `json:"collection"`
+	Staged     string `json:"staged"`
+	Target     string `json:"target"`
+}
+
+// ApplyMultiBatch is ApplyBatch across several collections: fn receives the
+// documents of every listed collection and the returned writes land in all
+// of them or none, even across a crash.
+//
+// The collections are locked in sorted order, so concurrent batches cannot
+// deadlock. The new collection files are staged and synced, then a journal
+// listing them is written, which commits the batch. The staged files then
+// replace the originals and the journal is removed. NewFileStorageEngine
+// completes a batch whose journal it finds and discards staged files
+// without one. A batch that changes a single collection needs no journal.
+func (e *FileStorageEngine) ApplyMultiBatch(collections []string, fn core.MultiBatchFunc) error {
+	return e.ApplyMultiBatchContext(context.Background(), collections, fn)
+}
+
+// ApplyMultiBatchContext is ApplyMultiBatch giving up while waiting for locks
+// once ctx is done. Locks already acquired are released and the error names
+// the collection being waited for. Documents given a key order with
+// WithKeyOrder keep it, and the revision changes are recorded in the map set
+// by core.WithRevisions.
+func (e *FileStorageEngine) ApplyMultiBatchContext(ctx context.Context, collections []string, fn core.MultiBatchFunc) (err error) {
+	names := make([]string, 0, len(collections))
+	seen := make(map[string]struct{}, len(collections))
+	for _, collection := range collections {
+		if collection == "" {
+			return fmt.Errorf("missing collection name in batch")
+		}
+		if _, dup := seen[collection]; !dup {
+			seen[collection] = struct{}{}
+			names = append(names, collection)
+		}
+	}
+	sort.Strings(names)
+	if e.instrumented() {
+		defer func(start time.Time) {
+			for _, collection := range names {
+				e.observe(opBatch, collection, "", start, &err)
+			}
+		}(time.Now())
+	}
+	if e.readOnly {
+		return fmt.Errorf("failed to write collections %v: %w", names, ErrReadOnly)
+	}
+
+	// Acquire file locks in a deterministic order
+	for _, collection := range names {
+		lockFile, err := e.acquireFileLockContext(ctx, collection)
+		if err != nil {
+			return err
+		}
+		defer e.releaseFileLock(lockFile)
+	}
+
+	// Acquire write lock
+	waitStart := time.Now()
+	if err := core.LockContext(ctx, &e.mu); err != nil {
+		return fmt.Errorf("failed to lock collections %v: %w", names, err)
+	}
+	for _, collection := range names {
+		e.observeLockWait(collection, waitStart)
+	}
+	defer e.mu.Unlock()
+
+	files := make(map[string]*CollectionFile, len(names))
+	docs := make(map[string]map[core.DocumentID]core.Document, len(names))
+	for _, collection := range names {
+		collFile, err := e.readCollectionFile(collection)
+		if err != nil {
+			return err
+		}
+		files[collection] = collFile
+		docs[collection] = documentMap(collFile)
+	}
+
+	writes, err := fn(docs)
+	if err != nil {
+		return err
+	}
+	for collection := range writes {
+		if _, ok := files[collection]; !ok {
+			return fmt.Errorf("batch writes to unlisted collection %s", collection)
+		}
+	}
+	for _, collection := range names {
+		if err := e.SyncIDFields(collection, writes[collection]); err != nil {
+			return err
+		}
+		if err := e.validateWrites(collection, files[collection], writes[collection]); err != nil {
+			return err
+		}
+	}
+
+	// Record the revision changes once the batch has landed
+	from := make(map[string]uint64, len(names))
+	for _, collection := range names {
+		from[collection] = files[collection].Metadata.Revision
+	}
+	recordRevisions := func() {
+		for _, collection := range names {
+			core.RecordRevision(ctx, collection, from[collection], files[collection].Metadata.Revision)
+		}
+	}
+
+	changes := make(map[string][]change)
+	var j journal
+	enc := getEncoder()
+	defer enc.release()
+	for _, collection := range names {
+		applied := applyWrites(files[collection], writes[collection], keyOrders(ctx, collection))
+		if len(applied) == 0 {
+			continue
+		}
+		changes[collection] = applied
+
+		data, err := encodeCollectionFile(enc, files[collection])
+		if err != nil {
+			e.discardStaged(j)
+			return err
+		}
+		r := replacement{
+			Collection: collection,
+			Staged:     collection + stagedFileSuffix,
+			Target:     filepath.Base(e.getCollectionPath(collection)),
+		}
+		if err := fsutil.WriteFile(filepath.Join(e.dataDir, r.Staged), data, true); err != nil {
+			e.discardStaged(j)
+			return err
+		}
+		e.observeFile(collection, len(data), len(files[collection].Documents))
+		e.access.wrote(collection)
+		j.Replacements = append(j.Replacements, r)
+	}
+	switch len(j.Replacements) {
+	case 0:
+		recordRevisions()
+		return nil
+	case 1:
+		// Replacing a single file is atomic without a journal
+		r := j.Replacements[0]
+		if err := os.Rename(filepath.Join(e.dataDir, r.Staged), filepath.Join(e.dataDir, r.Target)); err != nil {
+			e.discardStaged(j)
+			return fmt.Errorf("failed to replace collection %s: %w", r.Collection, err)
+		}
+		recordRevisions()
+		// The coalesced writes the staged file holds are now on disk too
+		held := e.coalescer.held(r.Collection)
+		e.coalescer.discard(r.Collection)
+		if err := e.logChanges(e.oplog, r.Collection, held); err != nil {
+			return err
+		}
+		return e.recordChanges(r.Collection, changes[r.Collection])
+	}
+
+	if err := e.hook(stageBeforeJournal); err != nil {
+		return err
+	}
+
+	// The staged files hold the coalesced writes too, so their changes are
+	// logged with the batch's. The oplog entries are numbered now and
+	// appended by the replay, so a crash before they are written leaves them
+	// to recovery.
+	logged := make(map[string][]change, len(j.Replacements))
+	replaced := make([]string, len(j.Replacements))
+	for i, r := range j.Replacements {
+		replaced[i] = r.Collection
+		logged[r.Collection] = append(e.coalescer.held(r.Collection), changes[r.Collection]...)
+	}
+	if e.oplog != nil {
+		j.Oplog = e.oplog.pending(replaced, logged)
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		e.discardStaged(j)
+		return fmt.Errorf("failed to marshal batch journal: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(e.dataDir, journalFileName), data); err != nil {
+		e.discardStaged(j)
+		return fmt.Errorf("failed to write batch journal: %w", err)
+	}
+
+	// The staged files supersede any coalesced writes
+	for _, r := range j.Replacements {
+		e.coalescer.discard(r.Collection)
+	}
+
+	if err := e.hook(stageAfterJournal); err != nil {
+		return err
+	}
+
+	// The batch is committed: from here on a failure is completed by recovery
+	if err := e.replayJournal(j, e.oplog, e.hook); err != nil {
+		return err
+	}
+	recordRevisions()
+
+	for _, r := range j.Replacements {
+		e.recordWrites(r.Collection, changes[r.Collection])
+		e.reads.drop(r.Collection)
+		var entries []OplogEntry
+		for _, entry := range j.Oplog {
+			if entry.Collection == r.Collection {
+				entries = append(entries, entry)
+			}
+		}
+		e.publishChanges(r.Collection, logged[r.Collection], entries)
+	}
+	return nil
+}
+
+// hook calls the test hook, if set
+func (e *FileStorageEngine) hook(stage commitStage) error {
+	if e.commitHook == nil {
+		return nil
+	}
+	return e.commitHook(stage)
+}
+
+// replayJournal moves the staged files of a journal into place, appends
+// its entries to log and removes the journal. Replacements and entries
+// already made are skipped, so replaying is idempotent.
+func (e *FileStorageEngine) replayJournal(j journal, log *oplog, hook func(commitStage) error) error {
+	for _, r := range j.Replacements {
+		staged := filepath.Join(e.dataDir, r.Staged)
+		if _, err := os.Stat(staged); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(staged, filepath.Join(e.dataDir, r.Target)); err != nil {
+			return fmt.Errorf("failed to replace collection %s: %w", r.Collection, err)
+		}
+		if hook != nil {
+			if err := hook(stageAfterRename); err != nil {
+				return err
+			}
+		}
+	}
+
+	if log != nil {
+		if err := log.appendReplayed(j.Oplog); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Remove(filepath.Join(e.dataDir, journalFileName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove batch journal: %w", err)
+	}
+	return nil
+}
+
+// recoverBatch replays the journal of a batch interrupted by a crash,
+// opening the oplog for its entries if it has any
+func (e *FileStorageEngine) recoverBatch(j journal) error {
+	if len(j.Oplog) == 0 {
+		return e.replayJournal(j, nil, nil)
+	}
+	log, err := openOplog(e.dataDir)
+	if err != nil {
+		return err
+	}
+	defer log.close()
+	return e.replayJournal(j, log, nil)
+}
+
+// discardStaged removes the staged files of an uncommitted batch
+func (e *FileStorageEngine) discardStaged(j journal) {
+	for _, r := range j.Replacements {
+		os.Remove(filepath.Join(e.dataDir, r.Staged))
+	}
+}
+
+// recoverJournal brings the data directory to a consistent state after a
+// crash during ApplyMultiBatch. A journal means the batch committed, so its
+// remaining replacements are made; staged files without a journal belong to
+// an uncommitted batch and are removed.
+func (e *FileStorageEngine) recoverJournal() error {
+	path := filepath.Join(e.dataDir, journalFileName)
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		var j journal
+		if err := json.Unmarshal(data, &j); err != nil {
+			return fmt.Errorf("failed to parse batch journal: %w", err)
+		}
+		if err := e.recoverBatch(j); err != nil {
+			e.logEvent(slog.LevelError, "failed to recover interrupted batch", slog.Any("error", err))
+			return fmt.Errorf("failed to recover batch journal: %w", err)
+		}
+		for _, r := range j.Replacements {
+			e.logEvent(slog.LevelError, "recovered collection of interrupted batch", slog.String("collection", r.Collection))
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("failed to read batch journal: %w", err)
+	}
+
+	entries, err := os.ReadDir(e.dataDir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, stagedFileSuffix) || name == journalFileName+".tmp" {
+			if err := os.Remove(filepath.Join(e.dataDir, name)); err != nil {
+				return fmt.Errorf("failed to remove staged file: %w", err)
+			}
+			e.logEvent(slog.LevelError, "discarded file of uncommitted batch", slog.String("file", name))
+		}
+	}
+	return nil
+}
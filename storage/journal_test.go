@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// transfer moves 30 from account a1 to a2 and records it in the ledger
+func transfer(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+	a1, _ := core.ToFloat64(docs["accounts"]["a1"]["balance"])
+	a2, _ := core.ToFloat64(docs["accounts"]["a2"]["balance"])
+	return map[string]map[core.DocumentID]core.Document{
+		"accounts": {
+			"a1": {"balance": a1 - 30},
+			"a2": {"balance": a2 + 30},
+		},
+		"ledger": {
+			"l1": {"from": "a1", "to": "a2", "amount": 30},
+		},
+	}, nil
+}
+
+func seedAccounts(t *testing.T, engine *FileStorageEngine) {
+	if err := engine.WriteDocument("accounts", "a1", core.Document{"balance": 100}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := engine.WriteDocument("accounts", "a2", core.Document{"balance": 50}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := engine.WriteDocument("ledger", "l0", core.Document{"amount": 0}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+}
+
+// checkTransfer asserts that the transfer was applied to every collection or to none
+func checkTransfer(t *testing.T, engine *FileStorageEngine, applied bool) {
+	t.Helper()
+
+	accounts := collectionState(t, engine, "accounts")
+	ledger := collectionState(t, engine, "ledger")
+
+	a1, a2 := 100.0, 50.0
+	if applied {
+		a1, a2 = 70, 80
+	}
+	if accounts["a1"]["balance"] != a1 || accounts["a2"]["balance"] != a2 {
+		t.Errorf("Expected balances %v and %v, got %v", a1, a2, accounts)
+	}
+	if _, ok := ledger["l1"]; ok != applied {
+		t.Errorf("Expected ledger entry present=%v, got %v", applied, ledger)
+	}
+}
+
+// checkNoLeftovers asserts that no journal or staged file remains
+func checkNoLeftovers(t *testing.T, dir string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read data directory: %v", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, journalFileName) || strings.HasSuffix(name, stagedFileSuffix) {
+			t.Errorf("Unexpected leftover file %s", name)
+		}
+	}
+}
+
+func TestApplyMultiBatch(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	seedAccounts(t, engine)
+	engine.EnableOplog()
+
+	if err := engine.ApplyMultiBatch([]string{"ledger", "accounts", "ledger"}, transfer); err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	checkTransfer(t, engine, true)
+	checkNoLeftovers(t, tempDir)
+
+	entries, _ := engine.ReadOplog(0, 0)
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 oplog entries, got %d", len(entries))
+	}
+}
+
+func TestApplyMultiBatchFailures(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	seedAccounts(t, engine)
+
+	boom := errors.New("boom")
+	err := engine.ApplyMultiBatch([]string{"accounts", "ledger"}, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		writes, _ := transfer(docs)
+		return writes, boom
+	})
+	if !errors.Is(err, boom) {
+		t.Errorf("Expected the batch error, got %v", err)
+	}
+
+	err = engine.ApplyMultiBatch([]string{"accounts"}, transfer)
+	if err == nil {
+		t.Errorf("Expected error for a write to an unlisted collection")
+	}
+
+	checkTransfer(t, engine, false)
+	checkNoLeftovers(t, tempDir)
+}
+
+func TestApplyMultiBatchCrashRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		stage   commitStage
+		applied bool
+	}{
+		{"before journal", stageBeforeJournal, false},
+		{"after journal", stageAfterJournal, true},
+		{"between renames", stageAfterRename, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine, tempDir := setupTestEngine(t)
+			defer os.RemoveAll(tempDir)
+
+			seedAccounts(t, engine)
+
+			// Simulate a crash by abandoning the commit at the stage
+			crash := errors.New("crash")
+			engine.commitHook = func(stage commitStage) error {
+				if stage == tt.stage {
+					return crash
+				}
+				return nil
+			}
+			if err := engine.ApplyMultiBatch([]string{"accounts", "ledger"}, transfer); !errors.Is(err, crash) {
+				t.Fatalf("Expected the simulated crash, got %v", err)
+			}
+			engine.Close()
+
+			engine, err := NewFileStorageEngine(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to reopen engine: %v", err)
+			}
+			defer engine.Close()
+
+			checkTransfer(t, engine, tt.applied)
+			checkNoLeftovers(t, tempDir)
+		})
+	}
+}
+
+func TestRecoverJournalIsIdempotent(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer os.RemoveAll(tempDir)
+
+	seedAccounts(t, engine)
+	engine.commitHook = func(stage commitStage) error {
+		if stage == stageAfterJournal {
+			return errors.New("crash")
+		}
+		return nil
+	}
+	engine.ApplyMultiBatch([]string{"accounts", "ledger"}, transfer)
+	engine.Close()
+
+	// Keep a copy of the journal, as if recovery crashed before removing it
+	data, err := os.ReadFile(filepath.Join(tempDir, journalFileName))
+	if err != nil {
+		t.Fatalf("Failed to read journal: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		engine, err := NewFileStorageEngine(tempDir)
+		if err != nil {
+			t.Fatalf("Failed to reopen engine: %v", err)
+		}
+		checkTransfer(t, engine, true)
+		engine.Close()
+
+		os.WriteFile(filepath.Join(tempDir, journalFileName), data, 0644)
+	}
+}
+
+func TestRecoverJournalAppendsOplog(t *testing.T) {
+	for _, stage := range []commitStage{stageAfterJournal, stageAfterRename} {
+		engine, tempDir := setupTestEngine(t)
+		defer os.RemoveAll(tempDir)
+
+		if err := engine.EnableOplog(); err != nil {
+			t.Fatalf("Failed to enable oplog: %v", err)
+		}
+		seedAccounts(t, engine)
+		engine.commitHook = func(s commitStage) error {
+			if s == stage {
+				return errors.New("crash")
+			}
+			return nil
+		}
+		engine.ApplyMultiBatch([]string{"accounts", "ledger"}, transfer)
+		engine.Close()
+		data, err := os.ReadFile(filepath.Join(tempDir, journalFileName))
+		if err != nil {
+			t.Fatalf("Failed to read journal: %v", err)
+		}
+
+		// Recovering twice appends the batch's entries once
+		for i := 0; i < 2; i++ {
+			engine, err = NewFileStorageEngine(tempDir)
+			if err != nil {
+				t.Fatalf("Failed to reopen engine: %v", err)
+			}
+			engine.Close()
+			os.WriteFile(filepath.Join(tempDir, journalFileName), data, 0644)
+		}
+		os.Remove(filepath.Join(tempDir, journalFileName))
+
+		engine, _ = NewFileStorageEngine(tempDir)
+		if err := engine.EnableOplog(); err != nil {
+			t.Fatalf("Failed to enable oplog: %v", err)
+		}
+		entries, err := engine.ReadOplog(3, 0)
+		if err != nil {
+			t.Fatalf("Failed to read oplog: %v", err)
+		}
+		var got []string
+		for i, entry := range entries {
+			if entry.Seq != uint64(4+i) {
+				t.Errorf("Expected seq %d, got %d", 4+i, entry.Seq)
+			}
+			got = append(got, entry.Collection+"/"+string(entry.DocID))
+		}
+		if expected := "accounts/a1 accounts/a2 ledger/l1"; strings.Join(got, " ") != expected {
+			t.Errorf("Expected the batch's entries %s after a crash at stage %d, got %v", expected, stage, got)
+		}
+		engine.Close()
+	}
+}
+
+func TestApplyMultiBatchLockOrder(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	seedAccounts(t, engine)
+	increment := func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		n, _ := core.ToFloat64(docs["ledger"]["l0"]["amount"])
+		return map[string]map[core.DocumentID]core.Document{
+			"accounts": {"a1": docs["accounts"]["a1"]},
+			"ledger":   {"l0": {"amount": n + 1}},
+		}, nil
+	}
+
+	// Batches listing the collections in opposite orders must not deadlock
+	const workers = 8
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		order := []string{"accounts", "ledger"}
+		if i%2 == 1 {
+			order = []string{"ledger", "accounts"}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := engine.ApplyMultiBatch(order, increment); err != nil {
+				t.Errorf("Failed to apply batch: %v", err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Concurrent batches deadlocked")
+	}
+
+	if n := collectionState(t, engine, "ledger")["l0"]["amount"]; n != float64(workers) {
+		t.Errorf("Expected %d increments, got %v", workers, n)
+	}
+}
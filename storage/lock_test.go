@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// holdFlock locks a collection's lock file through its own open file, as
+// another process would
+func holdFlock(t *testing.T, dir, collection string) *os.File {
+	t.Helper()
+	f, err := os.OpenFile(filepath.Join(dir, collection+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open lock file: %v", err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("Failed to lock file: %v", err)
+	}
+	return f
+}
+
+func TestFileLockDoesNotBlockOtherCollections(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	for _, name := range []string{"a", "b"} {
+		if err := engine.CreateCollection(name); err != nil {
+			t.Fatalf("Failed to create collection: %v", err)
+		}
+	}
+	other := holdFlock(t, tempDir, "b")
+	defer other.Close()
+
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- engine.WriteDocument("b", "1", core.Document{"n": 1})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.WriteDocument("a", "1", core.Document{"n": 1})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the write to a to complete while b is locked")
+	}
+	select {
+	case err := <-blocked:
+		t.Fatalf("Expected the write to b to wait for the lock, got %v", err)
+	default:
+	}
+
+	// Close gives up waiting for the blocked write, which then fails rather
+	// than writing to a closed engine
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := engine.CloseContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Close to time out waiting for the write, got %v", err)
+	}
+	syscall.Flock(int(other.Fd()), syscall.LOCK_UN)
+	select {
+	case err := <-blocked:
+		if !errors.Is(err, ErrEngineClosed) {
+			t.Errorf("Expected ErrEngineClosed for the blocked write, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the write to b to return once unlocked")
+	}
+
+	if err := engine.WriteDocument("a", "2", core.Document{"n": 2}); !errors.Is(err, ErrEngineClosed) {
+		t.Errorf("Expected ErrEngineClosed, got %v", err)
+	}
+}
+
+func TestFileLockConcurrentAcquire(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.CreateCollection("c"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	// Every goroutine races to add the lock entry, and all share it
+	const writers = 16
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			errs <- engine.WriteDocument("c", core.DocumentID(string(rune('a'+i))), core.Document{"n": i})
+		}(i)
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	count, err := engine.CountDocuments("c")
+	if err != nil {
+		t.Fatalf("Failed to count documents: %v", err)
+	}
+	if count != writers {
+		t.Errorf("Expected %d documents, got %d", writers, count)
+	}
+	if len(engine.locks) != 1 {
+		t.Errorf("Expected 1 lock entry, got %d", len(engine.locks))
+	}
+}
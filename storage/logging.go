@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// defaultSlowThreshold is how long an operation or lock wait may take before
+// it is logged as slow, unless set with WithSlowThreshold
+const defaultSlowThreshold = 100 * time.Millisecond
+
+// WithLogger logs the engine's events to l: each operation at debug level,
+// slow operations and lock waits at warn, corrupt files and crash recovery
+// at error, and opening and closing at info. Records carry the keys
+// collection, doc_id, duration_ms and bytes where they apply. A nil l logs
+// nothing.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Config) {
+		c.Logger = l
+	}
+}
+
+// WithSlowThreshold sets how long an operation or a wait for the write lock
+// may take before it is logged as slow. The default is 100ms; zero or less
+// logs nothing as slow.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(c *Config) {
+		c.SlowThreshold = d
+	}
+}
+
+// instrumented reports whether the engine records metrics or logs, so
+// uninstrumented engines skip timing operations altogether
+func (e *FileStorageEngine) instrumented() bool {
+	return e.metrics != nil || e.logger != nil
+}
+
+// observe records an operation that started at start and returned err
+func (e *FileStorageEngine) observe(op, collection string, docID core.DocumentID, start time.Time, err *error) {
+	e.metrics.observe(op, e.metricsLabel(collection), start, err)
+	if e.logger == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+	level, msg := slog.LevelDebug, "storage operation"
+	if e.slow(elapsed) {
+		level, msg = slog.LevelWarn, "slow storage operation"
+	}
+	if !e.logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("op", op), slog.String("collection", collection)}
+	if docID != "" {
+		attrs = append(attrs, slog.String("doc_id", string(docID)))
+	}
+	attrs = append(attrs, durationAttr(elapsed))
+	if *err != nil {
+		attrs = append(attrs, slog.Any("error", *err))
+	}
+	e.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// observeLockWait records a write lock acquired after waiting since start
+func (e *FileStorageEngine) observeLockWait(collection string, start time.Time) {
+	e.metrics.observeLockWait(e.metricsLabel(collection), start)
+	if e.logger == nil {
+		return
+	}
+	if elapsed := time.Since(start); e.slow(elapsed) {
+		e.logger.LogAttrs(context.Background(), slog.LevelWarn, "slow lock wait",
+			slog.String("collection", collection), durationAttr(elapsed))
+	}
+}
+
+// observeFile records a collection file written with n bytes and documents
+func (e *FileStorageEngine) observeFile(collection string, n, documents int) {
+	e.writes.wrote(collection, n, documents)
+	e.metrics.observeFile(e.metricsLabel(collection), n, documents)
+	if e.logger == nil {
+		return
+	}
+	e.logger.LogAttrs(context.Background(), slog.LevelDebug, "collection file written",
+		slog.String("collection", collection), slog.Int("bytes", n), slog.Int("documents", documents))
+}
+
+// logEvent logs an event at a level unless the engine has no logger
+func (e *FileStorageEngine) logEvent(level slog.Level, msg string, attrs ...slog.Attr) {
+	if e.logger == nil {
+		return
+	}
+	e.logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
+
+// lockWrite takes the engine's write lock, recording the wait when the
+// engine is instrumented
+func (e *FileStorageEngine) lockWrite(collection string) {
+	if !e.instrumented() {
+		e.mu.Lock()
+		return
+	}
+	start := time.Now()
+	e.mu.Lock()
+	e.observeLockWait(collection, start)
+}
+
+// slow reports whether elapsed reaches the slow threshold
+func (e *FileStorageEngine) slow(elapsed time.Duration) bool {
+	return e.slowThreshold > 0 && elapsed >= e.slowThreshold
+}
+
+// metricsLabel returns the collection label of a collection
+func (e *FileStorageEngine) metricsLabel(collection string) string {
+	return e.metricsScope + collection
+}
+
+// durationAttr returns a duration_ms attribute, in fractional milliseconds
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Float64("duration_ms", float64(d)/float64(time.Millisecond))
+}
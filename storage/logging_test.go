@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// captureHandler is a slog.Handler keeping every record
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *captureHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r.Clone())
+	return nil
+}
+
+// find returns the attributes of the first record with a level and message
+// whose attributes include want, or nil if there is none
+func (h *captureHandler) find(level slog.Level, msg string, want map[string]string) map[string]slog.Value {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, r := range h.records {
+		if r.Level != level || r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		matches := true
+		for key, value := range want {
+			if got, ok := attrs[key]; !ok || got.String() != value {
+				matches = false
+			}
+		}
+		if matches {
+			return attrs
+		}
+	}
+	return nil
+}
+
+func TestEngineLogging(t *testing.T) {
+	dir := t.TempDir()
+	h := &captureHandler{}
+	engine, err := NewFileStorageEngine(dir, WithLogger(slog.New(h)), WithSlowThreshold(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada"})
+	engine.ReadDocument("users", "u1")
+
+	if h.find(slog.LevelInfo, "storage engine opened", map[string]string{"dir": dir}) == nil {
+		t.Errorf("Expected an open event")
+	}
+	attrs := h.find(slog.LevelDebug, "storage operation", map[string]string{"op": "write", "collection": "users", "doc_id": "u1"})
+	if attrs == nil || attrs["duration_ms"].Kind() != slog.KindFloat64 {
+		t.Errorf("Expected a write event with a duration, got %v", attrs)
+	}
+	if attrs := h.find(slog.LevelDebug, "collection file written", map[string]string{"collection": "users"}); attrs["bytes"].Kind() != slog.KindInt64 {
+		t.Errorf("Expected a file write event with bytes, got %v", attrs)
+	}
+	if h.find(slog.LevelWarn, "slow storage operation", nil) != nil {
+		t.Errorf("Expected no slow operations under the threshold")
+	}
+
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{not json"), 0644)
+	engine.ReadDocument("broken", "b1")
+	if h.find(slog.LevelError, "corrupt collection file", map[string]string{"collection": "broken"}) == nil {
+		t.Errorf("Expected a corruption event")
+	}
+
+	engine.Close()
+	if h.find(slog.LevelInfo, "storage engine closed", nil) == nil {
+		t.Errorf("Expected a close event")
+	}
+}
+
+func TestEngineLoggingSlowAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "users"+stagedFileSuffix), []byte("{}"), 0644)
+
+	h := &captureHandler{}
+	engine, err := NewFileStorageEngine(dir, WithLogger(slog.New(h)), WithSlowThreshold(time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if h.find(slog.LevelError, "discarded file of uncommitted batch", map[string]string{"file": "users" + stagedFileSuffix}) == nil {
+		t.Errorf("Expected a recovery event")
+	}
+
+	// A write waiting for the lock is logged as slow, twice over
+	engine.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		engine.WriteDocument("users", "u1", core.Document{})
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	engine.mu.Unlock()
+	<-done
+
+	if h.find(slog.LevelWarn, "slow lock wait", map[string]string{"collection": "users"}) == nil {
+		t.Errorf("Expected a slow lock wait event")
+	}
+	if h.find(slog.LevelWarn, "slow storage operation", map[string]string{"op": "write", "doc_id": "u1"}) == nil {
+		t.Errorf("Expected a slow operation event")
+	}
+}
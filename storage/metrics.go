@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operation labels of the storage metrics
+const (
+	opWrite            = "write"
+	opRead             = "read"
+	opDelete           = "delete"
+	opScan             = "scan"
+	opBatch            = "batch"
+	opCreateCollection = "create_collection"
+	opDropCollection   = "drop_collection"
+	opRestore          = "restore"
+	opListCollections  = "list_collections"
+)
+
+// Metrics records storage operations as Prometheus metrics: operation
+// counts, errors and latencies by operation and collection, and for a
+// FileStorageEngine also write lock waits, bytes written and collection
+// sizes. It is a prometheus.Collector. A nil *Metrics records nothing.
+type Metrics struct {
+	operations *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	lockWait   *prometheus.HistogramVec
+	bytes      *prometheus.CounterVec
+	documents  *prometheus.GaugeVec
+}
+
+// newMetrics creates the storage metrics
+func newMetrics() *Metrics {
+	return &Metrics{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "operations_total",
+			Help: "Storage operations, by operation and collection.",
+		}, []string{"op", "collection"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "operation_errors_total",
+			Help: "Storage operations that failed, by operation and collection.",
+		}, []string{"op", "collection"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "operation_duration_seconds",
+			Help:    "Latency of storage operations, by operation and collection.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 9),
+		}, []string{"op", "collection"}),
+		lockWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "lock_wait_seconds",
+			Help:    "Time writes waited for the engine's write lock, by collection.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+		}, []string{"collection"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "written_bytes_total",
+			Help: "Bytes of collection files written, by collection.",
+		}, []string{"collection"}),
+		documents: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "jsondb", Subsystem: "storage", Name: "documents",
+			Help: "Documents in a collection as of its last write.",
+		}, []string{"collection"}),
+	}
+}
+
+// Describe sends the descriptors of the metrics
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.operations.Describe(ch)
+	m.errors.Describe(ch)
+	m.duration.Describe(ch)
+	m.lockWait.Describe(ch)
+	m.bytes.Describe(ch)
+	m.documents.Describe(ch)
+}
+
+// Collect sends the current values of the metrics
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.operations.Collect(ch)
+	m.errors.Collect(ch)
+	m.duration.Collect(ch)
+	m.lockWait.Collect(ch)
+	m.bytes.Collect(ch)
+	m.documents.Collect(ch)
+}
+
+// observe records an operation that started at start and returned err
+func (m *Metrics) observe(op, collection string, start time.Time, err *error) {
+	if m == nil {
+		return
+	}
+	m.operations.WithLabelValues(op, collection).Inc()
+	m.duration.WithLabelValues(op, collection).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		m.errors.WithLabelValues(op, collection).Inc()
+	}
+}
+
+// observeLockWait records a write lock acquired after waiting since start
+func (m *Metrics) observeLockWait(collection string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.lockWait.WithLabelValues(collection).Observe(time.Since(start).Seconds())
+}
+
+// observeFile records a collection file written with n bytes and documents
+func (m *Metrics) observeFile(collection string, n, documents int) {
+	if m == nil {
+		return
+	}
+	m.bytes.WithLabelValues(collection).Add(float64(n))
+	m.documents.WithLabelValues(collection).Set(float64(documents))
+}
+
+// WithMetrics records the engine's operations as Metrics registered with
+// reg until the engine is closed, so it can be reopened with the same reg.
+// NewFileStorageEngine fails if registering fails, as it does while another
+// engine's metrics are registered with reg. A nil reg records nothing and
+// costs nothing. Namespaces share the metrics, labelling their collections
+// "<namespace>/<collection>".
+func WithMetrics(reg prometheus.Registerer) Option {
+	return func(c *Config) {
+		c.Metrics = reg
+	}
+}
+
+// unregisterMetrics removes the engine's metrics from the registerer they
+// were registered with, if any
+func (e *FileStorageEngine) unregisterMetrics() {
+	if e.registerer != nil {
+		e.registerer.Unregister(e.metrics)
+		e.registerer = nil
+	}
+}
+
+// Instrumented is a StorageEngine recording the operations of another as
+// Metrics. Register it with a prometheus.Registerer to export them.
+type Instrumented struct {
+	*Metrics
+	inner core.StorageEngine
+}
+
+// InstrumentedEngine wraps a StorageEngine so its operations are recorded.
+// Only operation counts, errors and latencies are known from outside an
+// engine; FileStorageEngine's WithMetrics records more.
+func InstrumentedEngine(inner core.StorageEngine) *Instrumented {
+	return &Instrumented{Metrics: newMetrics(), inner: inner}
+}
+
+// WriteDocument writes a document through the wrapped engine
+func (i *Instrumented) WriteDocument(collection string, docID core.DocumentID, doc core.Document) (err error) {
+	defer i.observe(opWrite, collection, time.Now(), &err)
+	return i.inner.WriteDocument(collection, docID, doc)
+}
+
+// ReadDocument reads a document through the wrapped engine
+func (i *Instrumented) ReadDocument(collection string, docID core.DocumentID) (doc core.Document, err error) {
+	defer i.observe(opRead, collection, time.Now(), &err)
+	return i.inner.ReadDocument(collection, docID)
+}
+
+// DeleteDocument deletes a document through the wrapped engine
+func (i *Instrumented) DeleteDocument(collection string, docID core.DocumentID) (err error) {
+	defer i.observe(opDelete, collection, time.Now(), &err)
+	return i.inner.DeleteDocument(collection, docID)
+}
+
+// ScanCollection scans a collection through the wrapped engine
+func (i *Instrumented) ScanCollection(collection string, fn func(core.DocumentID, core.Document) bool) (err error) {
+	defer i.observe(opScan, collection, time.Now(), &err)
+	return i.inner.ScanCollection(collection, fn)
+}
+
+// CreateCollection creates a collection through the wrapped engine
+func (i *Instrumented) CreateCollection(name string) (err error) {
+	defer i.observe(opCreateCollection, name, time.Now(), &err)
+	return i.inner.CreateCollection(name)
+}
+
+// ListCollections lists the collections of the wrapped engine
+func (i *Instrumented) ListCollections() (names []string, err error) {
+	defer i.observe(opListCollections, "", time.Now(), &err)
+	return i.inner.ListCollections()
+}
+
+// Close closes the wrapped engine
+func (i *Instrumented) Close() error {
+	return i.inner.Close()
+}
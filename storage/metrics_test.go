@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metricValue scrapes a registry and returns the value of the series of a
+// metric with the given labels: the count for histograms
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	series:
+		for _, m := range family.GetMetric() {
+			for _, pair := range m.GetLabel() {
+				if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+					continue series
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue()
+			case m.Gauge != nil:
+				return m.Gauge.GetValue()
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	return 0
+}
+
+func TestEngineMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	engine, err := NewFileStorageEngine(t.TempDir(), WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada"})
+	engine.WriteDocument("users", "u2", core.Document{"name": "Grace"})
+	engine.ReadDocument("users", "u1")
+	engine.ReadDocument("users", "missing")
+	engine.DeleteDocument("users", "u2")
+	engine.ScanCollection("users", func(core.DocumentID, core.Document) bool { return true })
+	engine.ApplyMultiBatch([]string{"users", "orders"}, func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		return map[string]map[core.DocumentID]core.Document{"orders": {"o1": {"user": "u1"}}}, nil
+	})
+
+	tests := []struct {
+		metric   string
+		labels   map[string]string
+		expected float64
+	}{
+		{"jsondb_storage_operations_total", map[string]string{"op": "write", "collection": "users"}, 2},
+		{"jsondb_storage_operations_total", map[string]string{"op": "read", "collection": "users"}, 2},
+		{"jsondb_storage_operation_errors_total", map[string]string{"op": "read", "collection": "users"}, 1},
+		{"jsondb_storage_operations_total", map[string]string{"op": "delete", "collection": "users"}, 1},
+		{"jsondb_storage_operations_total", map[string]string{"op": "scan", "collection": "users"}, 1},
+		{"jsondb_storage_operations_total", map[string]string{"op": "batch", "collection": "orders"}, 1},
+		{"jsondb_storage_operation_duration_seconds", map[string]string{"op": "write", "collection": "users"}, 2},
+		{"jsondb_storage_lock_wait_seconds", map[string]string{"collection": "users"}, 4},
+		{"jsondb_storage_documents", map[string]string{"collection": "users"}, 1},
+		{"jsondb_storage_documents", map[string]string{"collection": "orders"}, 1},
+	}
+	for _, tt := range tests {
+		if got := metricValue(t, reg, tt.metric, tt.labels); got != tt.expected {
+			t.Errorf("Expected %s%v to be %v, got %v", tt.metric, tt.labels, tt.expected, got)
+		}
+	}
+	if metricValue(t, reg, "jsondb_storage_written_bytes_total", map[string]string{"collection": "users"}) == 0 {
+		t.Errorf("Expected bytes written to users")
+	}
+
+	// Namespaces share the metrics under their own labels
+	acme, _ := engine.Namespace("acme")
+	acme.WriteDocument("users", "u1", core.Document{})
+	if got := metricValue(t, reg, "jsondb_storage_operations_total", map[string]string{"op": "write", "collection": "acme/users"}); got != 1 {
+		t.Errorf("Expected one write to acme/users, got %v", got)
+	}
+
+	// Registering the same metrics twice fails while the first engine is open
+	if _, err := NewFileStorageEngine(t.TempDir(), WithMetrics(reg)); err == nil {
+		t.Errorf("Expected error registering metrics twice")
+	}
+
+	// Closing unregisters them, so the directory reopens with the same registry
+	dir := engine.Dir()
+	if err := engine.Close(); err != nil {
+		t.Fatalf("Failed to close engine: %v", err)
+	}
+	notDir := filepath.Join(dir, "users.json")
+	if _, err := NewFileStorageEngine(notDir, WithMetrics(reg)); err == nil {
+		t.Fatalf("Expected error opening a file as the data directory")
+	}
+	reopened, err := NewFileStorageEngine(dir, WithMetrics(reg))
+	if err != nil {
+		t.Fatalf("Failed to reopen with the same registry: %v", err)
+	}
+	defer reopened.Close()
+	reopened.WriteDocument("users", "u9", core.Document{})
+	if got := metricValue(t, reg, "jsondb_storage_operations_total", map[string]string{"op": "write", "collection": "users"}); got != 1 {
+		t.Errorf("Expected one write after reopening, got %v", got)
+	}
+}
+
+func TestInstrumentedEngine(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	instrumented := InstrumentedEngine(engine)
+	var _ core.StorageEngine = instrumented
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(instrumented)
+
+	instrumented.CreateCollection("items")
+	instrumented.WriteDocument("items", "i1", core.Document{"qty": 1})
+	if _, err := instrumented.ReadDocument("items", "i2"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected the wrapped engine's error, got %v", err)
+	}
+	instrumented.ListCollections()
+
+	for op, expected := range map[string]float64{"create_collection": 1, "write": 1, "read": 1} {
+		if got := metricValue(t, reg, "jsondb_storage_operations_total", map[string]string{"op": op, "collection": "items"}); got != expected {
+			t.Errorf("Expected %v %s operations, got %v", expected, op, got)
+		}
+	}
+	if got := metricValue(t, reg, "jsondb_storage_operation_errors_total", map[string]string{"op": "read"}); got != 1 {
+		t.Errorf("Expected one read error, got %v", got)
+	}
+	if got := metricValue(t, reg, "jsondb_storage_operations_total", map[string]string{"op": "list_collections"}); got != 1 {
+		t.Errorf("Expected one list operation, got %v", got)
+	}
+}
+
+func BenchmarkWriteWithoutMetrics(b *testing.B) {
+	engine, err := NewFileStorageEngine(b.TempDir(), WithMetrics(nil))
+	if err != nil {
+		b.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	for i := 0; i < b.N; i++ {
+		engine.WriteDocument("items", "i1", core.Document{"n": i})
+	}
+}
@@ -0,0 +1,13 @@
+package storage
+
+// WithMmapReads maps collection files into memory to decode them instead of
+// copying them into a buffer first, so reading a large collection does not
+// hold the file's bytes on the heap next to the decoded documents. Each
+// mapping lasts for one read; writes replace files by rename, so a read in
+// progress keeps seeing the file it mapped. Where mapping is not supported
+// (see MmapSupported), files are read as usual.
+func WithMmapReads() Option {
+	return func(c *Config) {
+		c.MmapReads = true
+	}
+}
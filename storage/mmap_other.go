@@ -0,0 +1,12 @@
+//go:build !unix
+
+package storage
+
+// MmapSupported reports whether WithMmapReads maps files on this platform
+const MmapSupported = false
+
+// readFileMapped falls back to reading the file where mapping is not
+// supported
+func readFileMapped(path string, fn func(data []byte) error) error {
+	return readFilePooled(path, fn)
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestMmapReads(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir, WithMmapReads())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	if _, err := engine.ReadDocument("users", "u1"); err == nil {
+		t.Errorf("Expected an error reading a missing collection")
+	}
+	for i := 0; i < 10; i++ {
+		if err := engine.WriteDocument("users", core.DocumentID(fmt.Sprintf("u%d", i)), core.Document{"n": float64(i), "name": "Ada"}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	doc, err := engine.ReadDocument("users", "u3")
+	if err != nil || doc["n"] != 3.0 || doc["name"] != "Ada" {
+		t.Errorf("Expected document u3, got %v, %v", doc, err)
+	}
+	if revision, _ := engine.CollectionRevision("users"); revision != 10 {
+		t.Errorf("Expected revision 10, got %d", revision)
+	}
+
+	// Writes replace the file, so reads in progress see one revision or
+	// the next and never a torn file
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 10; i < 30; i++ {
+			engine.WriteDocument("users", core.DocumentID(fmt.Sprintf("u%d", i)), core.Document{"n": float64(i)})
+		}
+	}()
+	for i := 0; i < 30; i++ {
+		count := 0
+		if err := engine.ScanCollection("users", func(core.DocumentID, core.Document) bool { count++; return true }); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		if count < 10 || count > 30 {
+			t.Fatalf("Expected between 10 and 30 documents, got %d", count)
+		}
+	}
+	wg.Wait()
+
+	// Empty and corrupt files fail to parse as they do without mapping
+	for _, content := range []string{"", "{"} {
+		os.WriteFile(filepath.Join(dir, "broken.json"), []byte(content), 0644)
+		if _, err := engine.ReadDocument("broken", "d1"); err == nil || !strings.Contains(err.Error(), "failed to parse collection file") {
+			t.Errorf("Expected a parse error for %q, got %v", content, err)
+		}
+	}
+}
+
+func TestReadModesMatch(t *testing.T) {
+	dir := t.TempDir()
+	plain, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		doc := core.Document{"n": float64(i), "tags": []interface{}{"a", "b"}, "nested": map[string]interface{}{"s": strings.Repeat("x", i)}}
+		if err := plain.WriteDocument("items", core.DocumentID(fmt.Sprintf("i%02d", i)), doc); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	expected, err := plain.readCollectionFile("items")
+	if err != nil {
+		t.Fatalf("Failed to read collection: %v", err)
+	}
+	plain.Close()
+
+	mapped, err := NewFileStorageEngine(dir, WithMmapReads(), WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer mapped.Close()
+	got, err := mapped.readCollectionFile("items")
+	if err != nil {
+		t.Fatalf("Failed to read collection: %v", err)
+	}
+	if !reflect.DeepEqual(got.Documents, expected.Documents) || got.Metadata.Revision != expected.Metadata.Revision {
+		t.Errorf("Expected the mapped read to match the plain one")
+	}
+}
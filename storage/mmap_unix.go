@@ -0,0 +1,41 @@
+//go:build unix
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// MmapSupported reports whether WithMmapReads maps files on this platform
+const MmapSupported = true
+
+// readFileMapped maps a file read-only and passes the mapping to fn,
+// unmapping it once fn returns
+func readFileMapped(path string, fn func(data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read collection file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read collection file: %w", err)
+	}
+	if info.Size() == 0 {
+		// Zero-length mappings are invalid
+		return fn(nil)
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return fmt.Errorf("failed to map collection file: %w", err)
+	}
+
+	fnErr := fn(data)
+	if err := syscall.Munmap(data); err != nil && fnErr == nil {
+		return fmt.Errorf("failed to unmap collection file: %w", err)
+	}
+	return fnErr
+}
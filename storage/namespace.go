@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// NamespaceDir is the subdirectory of the data directory holding one
+// directory per namespace
+const NamespaceDir = "tenants"
+
+// ErrNamespaceNotFound is returned for a namespace that does not exist
+var ErrNamespaceNotFound = errors.New("namespace not found")
+
+// Namespace returns an engine scoped to a namespace, whose collections live
+// in dataDir/tenants/<name>/ with their own lock files and metadata, apart
+// from the collections of the engine and of every other namespace. The
+// directory is created on first use unless the engine is read-only. Calling
+// Namespace again returns the same engine, and closing the engine closes
+// its namespaces.
+func (e *FileStorageEngine) Namespace(name string) (*FileStorageEngine, error) {
+	if err := validateNamespace(name); err != nil {
+		return nil, err
+	}
+
+	e.namespacesMu.Lock()
+	defer e.namespacesMu.Unlock()
+
+	if e.closed.Load() {
+		return nil, ErrEngineClosed
+	}
+	if ns, ok := e.namespaces[name]; ok {
+		return ns, nil
+	}
+
+	opts := []Option{WithSlowThreshold(e.slowThreshold), WithSyncMode(e.cfg.Sync)}
+	if e.cfg.Sync == SyncInterval {
+		opts = append(opts, WithSyncInterval(e.cfg.SyncInterval))
+	}
+	if e.cfg.CoalesceWindow > 0 {
+		opts = append(opts, WithWriteCoalescing(e.cfg.CoalesceWindow, e.cfg.CoalesceMaxPending))
+	}
+	if e.cfg.AccessStatsInterval > 0 {
+		opts = append(opts, WithAccessStats(e.cfg.AccessStatsInterval), WithDocumentReadSampling(e.cfg.DocumentSampleRate, e.cfg.DocumentSampleLimit))
+	}
+	if e.cfg.IDField != "" {
+		opts = append(opts, WithIDField(e.cfg.IDField))
+		if e.cfg.CorrectIDField {
+			opts = append(opts, WithIDFieldCorrection())
+		}
+	}
+	if fn := e.cfg.FlushErrorHandler; fn != nil {
+		opts = append(opts, WithFlushErrorHandler(func(collection string, err error) { fn(name+"/"+collection, err) }))
+	}
+	if e.logger != nil {
+		opts = append(opts, WithLogger(e.logger.With(slog.String("namespace", name))))
+	}
+	if e.readOnly {
+		opts = append(opts, WithReadOnly())
+	}
+	ns, err := NewFileStorageEngine(e.namespacePath(name), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open namespace %s: %w", name, err)
+	}
+
+	ns.metrics, ns.metricsScope = e.metrics, e.metricsScope+name+"/"
+	ns.tracer = e.tracer
+
+	if e.namespaces == nil {
+		e.namespaces = make(map[string]*FileStorageEngine)
+	}
+	e.namespaces[name] = ns
+	return ns, nil
+}
+
+// ListNamespaces returns the names of the namespaces in the data directory,
+// sorted
+func (e *FileStorageEngine) ListNamespaces() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(e.dataDir, NamespaceDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read namespace directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DropNamespace closes a namespace's engine and deletes its collections.
+// Handles on the namespace must not be used afterwards.
+func (e *FileStorageEngine) DropNamespace(name string) error {
+	if err := validateNamespace(name); err != nil {
+		return err
+	}
+	if e.readOnly {
+		return fmt.Errorf("failed to drop namespace %s: %w", name, ErrReadOnly)
+	}
+
+	e.namespacesMu.Lock()
+	defer e.namespacesMu.Unlock()
+
+	path := e.namespacePath(name)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNamespaceNotFound, name)
+	}
+
+	if ns, ok := e.namespaces[name]; ok {
+		if err := ns.Close(); err != nil {
+			return fmt.Errorf("failed to close namespace %s: %w", name, err)
+		}
+		delete(e.namespaces, name)
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// closeNamespaces closes the engines of the opened namespaces
+func (e *FileStorageEngine) closeNamespaces(ctx context.Context) error {
+	e.namespacesMu.Lock()
+	defer e.namespacesMu.Unlock()
+
+	var errs []error
+	for name, ns := range e.namespaces {
+		if err := ns.CloseContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close namespace %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// namespacePath returns the directory of a namespace
+func (e *FileStorageEngine) namespacePath(name string) string {
+	return filepath.Join(e.dataDir, NamespaceDir, name)
+}
+
+// validateNamespace rejects namespace names that are empty or not a plain
+// file name, which could escape the namespace directory
+func validateNamespace(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid namespace name %q", name)
+	}
+	return nil
+}
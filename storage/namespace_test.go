@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	acme, err := engine.Namespace("acme")
+	if err != nil {
+		t.Fatalf("Failed to open namespace: %v", err)
+	}
+	globex, _ := engine.Namespace("globex")
+	if again, _ := engine.Namespace("acme"); again != acme {
+		t.Errorf("Expected the same engine for the same namespace")
+	}
+
+	engine.WriteDocument("users", "u1", core.Document{"tenant": "root"})
+	acme.WriteDocument("users", "u1", core.Document{"tenant": "acme"})
+	globex.WriteDocument("users", "u1", core.Document{"tenant": "globex"})
+	globex.WriteDocument("orders", "o1", core.Document{"tenant": "globex"})
+
+	for ns, expected := range map[*FileStorageEngine]string{engine: "root", acme: "acme", globex: "globex"} {
+		doc, err := ns.ReadDocument("users", "u1")
+		if err != nil || doc["tenant"] != expected {
+			t.Errorf("Expected the %s document, got %v (%v)", expected, doc, err)
+		}
+	}
+	if _, err := acme.ReadDocument("orders", "o1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected another namespace's document to be missing, got %v", err)
+	}
+
+	acme.DeleteDocument("users", "u1")
+	if n, _ := globex.CountDocuments("users"); n != 1 {
+		t.Errorf("Expected a delete to stay in its namespace, got %d documents", n)
+	}
+
+	for ns, expected := range map[*FileStorageEngine][]string{engine: {"users"}, acme: {"users"}, globex: {"orders", "users"}} {
+		names, _ := ns.ListCollections()
+		if len(names) == 2 && names[0] > names[1] {
+			names[0], names[1] = names[1], names[0]
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected collections %v, got %v", expected, names)
+		}
+	}
+
+	// Lock files stay in the namespace's directory
+	if _, err := os.Stat(filepath.Join(tempDir, NamespaceDir, "acme", "users.lock")); err != nil {
+		t.Errorf("Expected the namespace's lock file: %v", err)
+	}
+
+	if names, _ := engine.ListNamespaces(); !reflect.DeepEqual(names, []string{"acme", "globex"}) {
+		t.Errorf("Expected namespaces acme and globex, got %v", names)
+	}
+	if err := engine.DropNamespace("acme"); err != nil {
+		t.Fatalf("Failed to drop namespace: %v", err)
+	}
+	if names, _ := engine.ListNamespaces(); !reflect.DeepEqual(names, []string{"globex"}) {
+		t.Errorf("Expected only globex after the drop, got %v", names)
+	}
+	if err := engine.DropNamespace("acme"); !errors.Is(err, ErrNamespaceNotFound) {
+		t.Errorf("Expected ErrNamespaceNotFound, got %v", err)
+	}
+	if doc, _ := globex.ReadDocument("users", "u1"); doc["tenant"] != "globex" {
+		t.Errorf("Expected the other namespace to survive the drop, got %v", doc)
+	}
+}
+
+func TestNamespaceNames(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	for _, name := range []string{"", ".", "..", "../escape", `a\b`, "a/b"} {
+		if _, err := engine.Namespace(name); err == nil {
+			t.Errorf("Expected error for namespace %q", name)
+		}
+		if err := engine.DropNamespace(name); err == nil {
+			t.Errorf("Expected error dropping namespace %q", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "escape")); !os.IsNotExist(err) {
+		t.Errorf("Expected no directory outside the namespace directory, got %v", err)
+	}
+
+	// A read-only engine opens existing namespaces only
+	engine.Namespace("acme")
+	readOnly, err := NewFileStorageEngine(tempDir, WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open read-only engine: %v", err)
+	}
+	defer readOnly.Close()
+	if _, err := readOnly.Namespace("acme"); err != nil {
+		t.Errorf("Failed to open existing namespace read-only: %v", err)
+	}
+	if _, err := readOnly.Namespace("missing"); err == nil {
+		t.Errorf("Expected error opening a missing namespace read-only")
+	}
+	if err := readOnly.DropNamespace("acme"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
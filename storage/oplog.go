@@ -0,0 +1,405 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+const (
+	// oplogFileName is the append-only change log, one JSON entry per line.
+	// The .jsonl extension keeps it out of ListCollections.
+	oplogFileName = "_oplog.jsonl"
+
+	// oplogSeqFileName records the last issued sequence number so that
+	// trimming the whole log does not reset the sequence after a restart.
+	oplogSeqFileName = "_oplog.seq"
+
+	// oplogCompactedFileName records, by collection, the time of the latest
+	// entry compaction removed, before which as-of reads cannot trust the
+	// entries left
+	oplogCompactedFileName = "_oplog.compacted"
+)
+
+// ErrOplogDisabled is returned by oplog operations when the oplog has not been enabled
+var ErrOplogDisabled = errors.New("oplog is not enabled")
+
+// ErrOplogCorrupt is returned when enabling an oplog holding an entry that
+// does not parse before others. Verify reports it, and its destructive
+// repair drops the entries from there on.
+var ErrOplogCorrupt = errors.New("oplog is corrupt")
+
+// OplogEntry is a single change recorded in the operation log
+type OplogEntry struct {
+	Seq        uint64             `json:"seq"`
+	Timestamp  time.Time          `json:"ts"`
+	Op         core.OperationType `json:"op"`
+	Collection string             `json:"coll"`
+	DocID      core.DocumentID    `json:"id"`
+	Document   core.Document      `json:"doc,omitempty"`
+}
+
+// oplog is the durable, append-only change stream behind EnableOplog
+type oplog struct {
+	mu      sync.Mutex
+	dir     string
+	file    *os.File
+	lastSeq uint64
+	size    int64         // Of the log file
+	history *oplogHistory // Nil until the first time-travel read
+	space   oplogSpace    // Bytes of the entries, by collection
+
+	rewriteMu sync.Mutex // Serializes trims and compactions, taken before mu
+	// compacted is the time of the latest entry compaction removed, by
+	// collection. Guarded by rewriteMu.
+	compacted map[string]time.Time
+}
+
+// openOplog opens (or creates) the oplog in dir and recovers the last sequence number.
+// A torn trailing line left by a crash mid-append is truncated away; any
+// other line that does not parse fails with ErrOplogCorrupt, leaving the
+// file alone.
+func openOplog(dir string) (*oplog, error) {
+	path := filepath.Join(dir, oplogFileName)
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open oplog: %w", err)
+	}
+
+	var space oplogSpace
+	lastSeq, validSize, err := scanOplog(file, &space)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Drop any partially written entry
+	if err := file.Truncate(validSize); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate oplog: %w", err)
+	}
+
+	// The sequence file wins when the log has been trimmed empty
+	if data, err := os.ReadFile(filepath.Join(dir, oplogSeqFileName)); err == nil {
+		if seq, err := strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64); err == nil && seq > lastSeq {
+			lastSeq = seq
+		}
+	}
+
+	compacted := make(map[string]time.Time)
+	if data, err := os.ReadFile(filepath.Join(dir, oplogCompactedFileName)); err == nil {
+		if err := json.Unmarshal(data, &compacted); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to parse oplog compaction times: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		file.Close()
+		return nil, fmt.Errorf("failed to read oplog compaction times: %w", err)
+	}
+
+	return &oplog{
+		dir:       dir,
+		file:      file,
+		lastSeq:   lastSeq,
+		size:      validSize,
+		space:     space,
+		compacted: compacted,
+	}, nil
+}
+
+// scanOplog returns the highest sequence number in the log and the size of
+// its entries before any torn trailing line, counting them in space
+func scanOplog(file *os.File, space *oplogSpace) (uint64, int64, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("failed to seek oplog: %w", err)
+	}
+
+	var lastSeq uint64
+	var validSize int64
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without a trailing newline was never fully written
+			return lastSeq, validSize, nil
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to read oplog: %w", err)
+		}
+
+		// Appends end with the newline, so a whole line was acknowledged
+		var entry OplogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, 0, fmt.Errorf("%w: entry at offset %d does not parse: %v", ErrOplogCorrupt, validSize, err)
+		}
+
+		lastSeq = entry.Seq
+		validSize += int64(len(line))
+		space.add(entry.Collection, entry.DocID, int64(len(line)))
+	}
+}
+
+// append writes a new entry to the log and fsyncs it before returning the
+// entry with its sequence number
+func (l *oplog) append(op core.OperationType, collection string, docID core.DocumentID, doc core.Document) (OplogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry := OplogEntry{
+		Seq:        l.lastSeq + 1,
+		Timestamp:  time.Now().UTC(),
+		Op:         op,
+		Collection: collection,
+		DocID:      docID,
+		Document:   doc,
+	}
+	if err := l.write(entry); err != nil {
+		return OplogEntry{}, err
+	}
+	return entry, nil
+}
+
+// appendReplayed writes the entries numbered after the last in the log, so
+// entries replayed twice are written once
+func (l *oplog) appendReplayed(entries []OplogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.Seq <= l.lastSeq {
+			continue
+		}
+		if err := l.write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends an entry and fsyncs it. Callers must hold l.mu.
+func (l *oplog) write(entry OplogEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oplog entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("failed to append oplog entry: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync oplog: %w", err)
+	}
+
+	l.lastSeq = entry.Seq
+	l.size += int64(len(data))
+	l.space.add(entry.Collection, entry.DocID, int64(len(data)))
+	if l.history != nil {
+		l.history.add(entry, l.size)
+	}
+	return nil
+}
+
+// pending returns the entries appending the changes of collections, in
+// order, would write, without writing them. Callers must hold the engine's
+// write lock, so nothing else is appended before they are replayed.
+func (l *oplog) pending(collections []string, changes map[string][]change) []OplogEntry {
+	l.mu.Lock()
+	seq := l.lastSeq
+	l.mu.Unlock()
+
+	now := time.Now().UTC()
+	var entries []OplogEntry
+	for _, collection := range collections {
+		for _, c := range changes[collection] {
+			seq++
+			entries = append(entries, OplogEntry{Seq: seq, Timestamp: now, Op: c.op, Collection: collection, DocID: c.docID, Document: c.doc})
+		}
+	}
+	return entries
+}
+
+// read returns up to limit entries with a sequence number greater than afterSeq
+func (l *oplog) read(afterSeq uint64, limit int) ([]OplogEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.Open(filepath.Join(l.dir, oplogFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open oplog: %w", err)
+	}
+	defer file.Close()
+
+	var entries []OplogEntry
+	reader := bufio.NewReader(file)
+	for limit <= 0 || len(entries) < limit {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read oplog: %w", err)
+		}
+
+		var entry OplogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse oplog entry: %w", err)
+		}
+		if entry.Seq > afterSeq {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// trim removes all entries with a sequence number lower than beforeSeq
+func (l *oplog) trim(beforeSeq uint64) error {
+	l.rewriteMu.Lock()
+	defer l.rewriteMu.Unlock()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.history = nil // Rebuilt from the trimmed log
+
+	path := filepath.Join(l.dir, oplogFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read oplog: %w", err)
+	}
+
+	var kept bytes.Buffer
+	var space oplogSpace
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry OplogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return fmt.Errorf("failed to parse oplog entry: %w", err)
+		}
+		if entry.Seq >= beforeSeq {
+			kept.Write(line)
+			space.add(entry.Collection, entry.DocID, int64(len(line)))
+		}
+	}
+
+	// Persist the sequence first so a crash during the swap cannot rewind it
+	if err := fsutil.WriteFileAtomic(filepath.Join(l.dir, oplogSeqFileName), []byte(strconv.FormatUint(l.lastSeq, 10))); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFileAtomic(path, kept.Bytes()); err != nil {
+		return err
+	}
+
+	// Reopen the append handle on the new file
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen oplog: %w", err)
+	}
+	l.file.Close()
+	l.file = file
+	l.size = int64(kept.Len())
+	l.space = space
+
+	return nil
+}
+
+// close releases the append handle
+func (l *oplog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// EnableOplog turns on the durable operation log. Every successful write and
+// delete from then on is appended to the log before the call returns, in the
+// same order the changes were applied to the collection files.
+func (e *FileStorageEngine) EnableOplog() error {
+	if e.readOnly {
+		return fmt.Errorf("failed to enable oplog: %w", ErrReadOnly)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed.Load() {
+		return ErrEngineClosed
+	}
+	if e.oplog != nil {
+		return nil
+	}
+
+	log, err := openOplog(e.dataDir)
+	if err != nil {
+		return err
+	}
+
+	e.oplog = log
+	return nil
+}
+
+// ReadOplog returns up to limit entries recorded after afterSeq, oldest first.
+// A limit of zero or less returns every remaining entry.
+func (e *FileStorageEngine) ReadOplog(afterSeq uint64, limit int) ([]OplogEntry, error) {
+	log := e.currentOplog()
+	if log == nil {
+		return nil, ErrOplogDisabled
+	}
+	return log.read(afterSeq, limit)
+}
+
+// TrimOplog discards entries with a sequence number lower than beforeSeq.
+// Sequence numbers keep increasing after a trim, including across restarts.
+func (e *FileStorageEngine) TrimOplog(beforeSeq uint64) error {
+	log := e.currentOplog()
+	if log == nil {
+		return ErrOplogDisabled
+	}
+	return log.trim(beforeSeq)
+}
+
+// LastOplogSeq returns the sequence number of the most recent entry
+func (e *FileStorageEngine) LastOplogSeq() (uint64, error) {
+	log := e.currentOplog()
+	if log == nil {
+		return 0, ErrOplogDisabled
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.lastSeq, nil
+}
+
+// currentOplog returns the oplog if enabled
+func (e *FileStorageEngine) currentOplog() *oplog {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.oplog
+}
+
+// closeOplog closes the oplog if enabled
+func (e *FileStorageEngine) closeOplog() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.oplog == nil {
+		return nil
+	}
+	if err := e.oplog.close(); err != nil {
+		return fmt.Errorf("failed to close oplog: %w", err)
+	}
+	e.oplog = nil
+	return nil
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// replayOplog applies oplog entries to an engine in sequence order
+func replayOplog(t *testing.T, engine *FileStorageEngine, entries []OplogEntry) {
+	for _, entry := range entries {
+		var err error
+		switch entry.Op {
+		case core.OpInsert, core.OpUpdate:
+			err = engine.WriteDocument(entry.Collection, entry.DocID, entry.Document)
+		case core.OpDelete:
+			err = engine.DeleteDocument(entry.Collection, entry.DocID)
+		}
+		if err != nil {
+			t.Fatalf("Failed to replay entry %d: %v", entry.Seq, err)
+		}
+	}
+}
+
+// collectionState reads every document of a collection into a map
+func collectionState(t *testing.T, engine *FileStorageEngine, collection string) map[core.DocumentID]core.Document {
+	state := make(map[core.DocumentID]core.Document)
+	err := engine.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		state[docID] = doc
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan collection %s: %v", collection, err)
+	}
+	return state
+}
+
+func TestOplogDisabledByDefault(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	if _, err := engine.ReadOplog(0, 0); err != ErrOplogDisabled {
+		t.Errorf("Expected ErrOplogDisabled, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, oplogFileName)); !os.IsNotExist(err) {
+		t.Errorf("Oplog file should not exist when disabled")
+	}
+}
+
+func TestOplogRecordsWritesAndDeletes(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+
+	engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"})
+	engine.WriteDocument("users", "user_001", core.Document{"name": "Alice Updated"})
+	engine.DeleteDocument("users", "user_001")
+	engine.DeleteDocument("users", "missing")
+
+	entries, err := engine.ReadOplog(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+
+	expectedOps := []core.OperationType{core.OpInsert, core.OpUpdate, core.OpDelete}
+	if len(entries) != len(expectedOps) {
+		t.Fatalf("Expected %d entries, got %d", len(expectedOps), len(entries))
+	}
+
+	for i, entry := range entries {
+		if entry.Seq != uint64(i+1) {
+			t.Errorf("Expected seq %d, got %d", i+1, entry.Seq)
+		}
+		if entry.Op != expectedOps[i] {
+			t.Errorf("Entry %d: expected op %d, got %d", i, expectedOps[i], entry.Op)
+		}
+		if entry.Collection != "users" || entry.DocID != "user_001" {
+			t.Errorf("Entry %d: unexpected target %s/%s", i, entry.Collection, entry.DocID)
+		}
+	}
+
+	if entries[1].Document["name"] != "Alice Updated" {
+		t.Errorf("Expected update entry to carry the new document, got %v", entries[1].Document)
+	}
+
+	// Limit and afterSeq
+	entries, err = engine.ReadOplog(1, 1)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 2 {
+		t.Errorf("Expected only entry 2, got %v", entries)
+	}
+}
+
+func TestOplogSequencePersistsAcrossRestart(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer os.RemoveAll(tempDir)
+
+	engine.EnableOplog()
+	for i := 0; i < 3; i++ {
+		engine.WriteDocument("users", core.DocumentID(fmt.Sprintf("user_%d", i)), core.Document{"n": i})
+	}
+
+	// Trim everything, then restart
+	if err := engine.TrimOplog(4); err != nil {
+		t.Fatalf("Failed to trim oplog: %v", err)
+	}
+	engine.Close()
+
+	engine, err := NewFileStorageEngine(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer engine.Close()
+	engine.EnableOplog()
+
+	engine.WriteDocument("users", "user_3", core.Document{"n": 3})
+
+	entries, err := engine.ReadOplog(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 4 {
+		t.Errorf("Expected a single entry with seq 4, got %v", entries)
+	}
+}
+
+func TestOplogTrim(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.EnableOplog()
+	for i := 0; i < 10; i++ {
+		engine.WriteDocument("users", core.DocumentID(fmt.Sprintf("user_%d", i)), core.Document{"n": i})
+	}
+
+	if err := engine.TrimOplog(6); err != nil {
+		t.Fatalf("Failed to trim oplog: %v", err)
+	}
+
+	entries, _ := engine.ReadOplog(0, 0)
+	if len(entries) != 5 || entries[0].Seq != 6 {
+		t.Fatalf("Expected entries 6..10 after trim, got %d entries", len(entries))
+	}
+
+	// Appends continue after a trim
+	engine.WriteDocument("users", "user_10", core.Document{"n": 10})
+	entries, _ = engine.ReadOplog(10, 0)
+	if len(entries) != 1 || entries[0].Seq != 11 {
+		t.Errorf("Expected entry 11 after trim, got %v", entries)
+	}
+}
+
+func TestOplogTornTailIsDiscarded(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer os.RemoveAll(tempDir)
+
+	engine.EnableOplog()
+	engine.WriteDocument("users", "user_001", core.Document{"name": "Alice"})
+	engine.Close()
+
+	// Simulate a crash in the middle of an append
+	path := filepath.Join(tempDir, oplogFileName)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"seq":2,"ts":"2024-01-`)
+	f.Close()
+
+	engine, _ = NewFileStorageEngine(tempDir)
+	defer engine.Close()
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+
+	engine.WriteDocument("users", "user_002", core.Document{"name": "Bob"})
+
+	entries, err := engine.ReadOplog(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Seq != 2 || entries[1].DocID != "user_002" {
+		t.Errorf("Expected torn entry to be replaced by user_002 at seq 2, got %v", entries)
+	}
+}
+
+func TestOplogCorruptEntryFailsOpen(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer os.RemoveAll(tempDir)
+
+	engine.EnableOplog()
+	for _, id := range []core.DocumentID{"user_001", "user_002", "user_003"} {
+		engine.WriteDocument("users", id, core.Document{"name": "Alice"})
+	}
+	engine.Close()
+
+	// Damage the middle entry, leaving acknowledged entries after it
+	path := filepath.Join(tempDir, oplogFileName)
+	data, _ := os.ReadFile(path)
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	lines[1] = append(bytes.Repeat([]byte("x"), len(lines[1])-1), '\n')
+	corrupt := bytes.Join(lines, nil)
+	if err := os.WriteFile(path, corrupt, 0644); err != nil {
+		t.Fatalf("Failed to write oplog: %v", err)
+	}
+
+	engine, _ = NewFileStorageEngine(tempDir)
+	defer engine.Close()
+	if err := engine.EnableOplog(); !errors.Is(err, ErrOplogCorrupt) {
+		t.Fatalf("Expected ErrOplogCorrupt, got %v", err)
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(after, corrupt) {
+		t.Errorf("Expected the oplog left alone, got %d bytes instead of %d", len(after), len(corrupt))
+	}
+}
+
+func TestOplogReplayProducesIdenticalState(t *testing.T) {
+	primary, primaryDir := setupTestEngine(t)
+	defer cleanupTestEngine(primary, primaryDir)
+
+	primary.EnableOplog()
+
+	collections := []string{"users", "orders"}
+	for i := 0; i < 100; i++ {
+		collection := collections[i%len(collections)]
+		docID := core.DocumentID(fmt.Sprintf("doc_%d", i%17))
+		switch i % 5 {
+		case 4:
+			primary.DeleteDocument(collection, docID)
+		default:
+			primary.WriteDocument(collection, docID, core.Document{"iteration": i, "tags": []interface{}{"a", "b"}})
+		}
+	}
+
+	entries, err := primary.ReadOplog(0, 0)
+	if err != nil {
+		t.Fatalf("Failed to read oplog: %v", err)
+	}
+
+	replica, replicaDir := setupTestEngine(t)
+	defer cleanupTestEngine(replica, replicaDir)
+	replayOplog(t, replica, entries)
+
+	for _, collection := range collections {
+		expected := collectionState(t, primary, collection)
+		actual := collectionState(t, replica, collection)
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Collection %s differs after replay", collection)
+		}
+	}
+}
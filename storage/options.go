@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrInvalidConfig is returned by NewFileStorageEngine for options that are
+// invalid or cannot be combined
+var ErrInvalidConfig = errors.New("invalid storage engine configuration")
+
+// SyncMode is when collection files are fsynced after being rewritten
+type SyncMode int
+
+const (
+	// SyncAlways fsyncs every rewrite before the write returns
+	SyncAlways SyncMode = iota
+	// SyncInterval fsyncs rewritten files in the background every
+	// Config.SyncInterval; writes acknowledged since the last sync may be
+	// lost on a crash, but never leave a torn file
+	SyncInterval
+	// SyncNone leaves syncing to the operating system
+	SyncNone
+)
+
+// String returns the name of a sync mode
+func (m SyncMode) String() string {
+	switch m {
+	case SyncAlways:
+		return "always"
+	case SyncInterval:
+		return "interval"
+	case SyncNone:
+		return "none"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", int(m))
+	}
+}
+
+// Config is the configuration of a FileStorageEngine, set with Options and
+// returned by Config
+type Config struct {
+	ReadOnly      bool
+	Sync          SyncMode
+	SyncInterval  time.Duration // Used by SyncInterval
+	SlowThreshold time.Duration
+	MmapReads     bool
+
+	// ReadCacheBytes is set by WithReadCacheSize; zero leaves the read
+	// cache unbounded
+	ReadCacheBytes int64
+
+	// CoalesceWindow and CoalesceMaxPending are set by WithWriteCoalescing;
+	// a zero window writes every change through
+	CoalesceWindow     time.Duration
+	CoalesceMaxPending int
+	FlushErrorHandler  func(collection string, err error)
+
+	// AccessStatsInterval is set by WithAccessStats; zero disables access
+	// statistics. DocumentSampleRate and DocumentSampleLimit are set by
+	// WithDocumentReadSampling.
+	AccessStatsInterval time.Duration
+	DocumentSampleRate  float64
+	DocumentSampleLimit int
+
+	// IDField is set by WithIDField; empty leaves document fields alone.
+	// CorrectIDField is set by WithIDFieldCorrection.
+	IDField        string
+	CorrectIDField bool
+
+	// AdviceThresholds and AdviceHandler are set by WithWriteAdvice; nil
+	// thresholds give no advice
+	AdviceThresholds *AdviceThresholds
+	AdviceHandler    func(Advice)
+
+	// Compaction and CompactionCheckInterval are set by
+	// WithAutoCompaction; a nil policy compacts only on request
+	Compaction              *CompactionPolicy
+	CompactionCheckInterval time.Duration
+
+	Logger  *slog.Logger
+	Metrics prometheus.Registerer
+	Tracer  trace.TracerProvider
+}
+
+// defaultConfig returns the configuration of an engine given no options
+func defaultConfig() Config {
+	return Config{
+		Sync:           SyncAlways,
+		SlowThreshold:  defaultSlowThreshold,
+		ReadCacheBytes: defaultReadCacheBytes,
+	}
+}
+
+// validate fails with ErrInvalidConfig for settings that are out of range or
+// contradict each other
+func (c Config) validate() error {
+	switch c.Sync {
+	case SyncAlways, SyncNone:
+	case SyncInterval:
+		if c.SyncInterval <= 0 {
+			return fmt.Errorf("%w: sync interval must be positive, got %v", ErrInvalidConfig, c.SyncInterval)
+		}
+	default:
+		return fmt.Errorf("%w: unknown sync mode %v", ErrInvalidConfig, c.Sync)
+	}
+	if c.ReadOnly && c.Sync != SyncAlways {
+		return fmt.Errorf("%w: read-only engine cannot use sync mode %v", ErrInvalidConfig, c.Sync)
+	}
+	if c.CoalesceWindow < 0 || c.CoalesceMaxPending < 0 {
+		return fmt.Errorf("%w: coalescing window and pending writes cannot be negative, got %v and %d", ErrInvalidConfig, c.CoalesceWindow, c.CoalesceMaxPending)
+	}
+	if c.ReadOnly && c.CoalesceWindow > 0 {
+		return fmt.Errorf("%w: read-only engine cannot coalesce writes", ErrInvalidConfig)
+	}
+	if c.ReadCacheBytes < 0 {
+		return fmt.Errorf("%w: read cache size cannot be negative, got %d", ErrInvalidConfig, c.ReadCacheBytes)
+	}
+	if c.AccessStatsInterval < 0 {
+		return fmt.Errorf("%w: access statistics interval cannot be negative, got %v", ErrInvalidConfig, c.AccessStatsInterval)
+	}
+	if c.ReadOnly && c.AccessStatsInterval > 0 {
+		return fmt.Errorf("%w: read-only engine cannot persist access statistics", ErrInvalidConfig)
+	}
+	if c.DocumentSampleRate < 0 || c.DocumentSampleRate > 1 {
+		return fmt.Errorf("%w: document sample rate must be between 0 and 1, got %v", ErrInvalidConfig, c.DocumentSampleRate)
+	}
+	if c.DocumentSampleRate > 0 && (c.DocumentSampleLimit <= 0 || c.AccessStatsInterval == 0) {
+		return fmt.Errorf("%w: document read sampling needs access statistics and a positive document limit", ErrInvalidConfig)
+	}
+	if c.Compaction != nil {
+		if c.CompactionCheckInterval <= 0 {
+			return fmt.Errorf("%w: compaction check interval must be positive, got %v", ErrInvalidConfig, c.CompactionCheckInterval)
+		}
+		if err := c.Compaction.validate(); err != nil {
+			return err
+		}
+		if c.ReadOnly {
+			return fmt.Errorf("%w: read-only engine cannot compact collections", ErrInvalidConfig)
+		}
+	}
+	if c.CorrectIDField && c.IDField == "" {
+		return fmt.Errorf("%w: ID field correction needs an ID field", ErrInvalidConfig)
+	}
+	return nil
+}
+
+// Option configures a FileStorageEngine
+type Option func(*Config)
+
+// WithSyncMode sets when rewritten collection files are fsynced. The
+// default is SyncAlways. The oplog and batch journal are always synced.
+func WithSyncMode(mode SyncMode) Option {
+	return func(c *Config) {
+		c.Sync = mode
+	}
+}
+
+// WithSyncInterval fsyncs rewritten collection files every d in the
+// background rather than on every write, as SyncInterval
+func WithSyncInterval(d time.Duration) Option {
+	return func(c *Config) {
+		c.Sync = SyncInterval
+		c.SyncInterval = d
+	}
+}
+
+// Config returns the engine's configuration
+func (e *FileStorageEngine) Config() Config {
+	return e.cfg
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	cfg := engine.Config()
+	if cfg.ReadOnly || cfg.Sync != SyncAlways || cfg.SyncInterval != 0 || cfg.SlowThreshold != defaultSlowThreshold {
+		t.Errorf("Expected the default configuration, got %+v", cfg)
+	}
+	if cfg.Logger != nil || cfg.Metrics != nil || cfg.Tracer != nil {
+		t.Errorf("Expected no logger, metrics or tracer by default, got %+v", cfg)
+	}
+	if engine.syncer != nil {
+		t.Errorf("Expected no background syncer by default")
+	}
+}
+
+func TestConfigOverrides(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	reg := prometheus.NewRegistry()
+	engine, err := NewFileStorageEngine(t.TempDir(),
+		WithSyncInterval(20*time.Millisecond),
+		WithSlowThreshold(time.Second),
+		WithLogger(logger),
+		WithMetrics(reg),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	cfg := engine.Config()
+	if cfg.Sync != SyncInterval || cfg.SyncInterval != 20*time.Millisecond || cfg.SlowThreshold != time.Second {
+		t.Errorf("Expected the overridden sync and threshold, got %+v", cfg)
+	}
+	if cfg.Logger != logger || cfg.Metrics != reg || engine.metrics == nil {
+		t.Errorf("Expected the logger and metrics to be set, got %+v", cfg)
+	}
+
+	// Namespaces inherit the sync mode
+	ns, err := engine.Namespace("acme")
+	if err != nil {
+		t.Fatalf("Failed to open namespace: %v", err)
+	}
+	if got := ns.Config(); got.Sync != SyncInterval || got.SyncInterval != cfg.SyncInterval {
+		t.Errorf("Expected the namespace to sync on the same interval, got %+v", got)
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"read-only with interval sync", []Option{WithReadOnly(), WithSyncInterval(time.Second)}},
+		{"read-only without sync", []Option{WithSyncMode(SyncNone), WithReadOnly()}},
+		{"zero sync interval", []Option{WithSyncInterval(0)}},
+		{"interval mode without interval", []Option{WithSyncMode(SyncInterval)}},
+		{"unknown sync mode", []Option{WithSyncMode(SyncMode(42))}},
+		{"negative coalescing window", []Option{WithWriteCoalescing(-time.Second, 0)}},
+		{"negative pending writes", []Option{WithWriteCoalescing(time.Second, -1)}},
+		{"read-only with coalescing", []Option{WithReadOnly(), WithWriteCoalescing(time.Second, 0)}},
+		{"read-only with access stats", []Option{WithReadOnly(), WithAccessStats(time.Second)}},
+		{"sampling without access stats", []Option{WithDocumentReadSampling(0.5, 100)}},
+		{"sample rate above one", []Option{WithAccessStats(time.Second), WithDocumentReadSampling(2, 100)}},
+		{"sampling without document limit", []Option{WithAccessStats(time.Second), WithDocumentReadSampling(0.5, 0)}},
+		{"ID field correction without ID field", []Option{WithIDFieldCorrection()}},
+		{"negative read cache size", []Option{WithReadCacheSize(-1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFileStorageEngine(t.TempDir(), tt.opts...)
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSyncModes(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"always", WithSyncMode(SyncAlways)},
+		{"interval", WithSyncInterval(10 * time.Millisecond)},
+		{"none", WithSyncMode(SyncNone)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			engine, err := NewFileStorageEngine(dir, tt.opt)
+			if err != nil {
+				t.Fatalf("Failed to create engine: %v", err)
+			}
+			if err := engine.WriteDocument("items", "i1", core.Document{"n": 1}); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+			if err := engine.Close(); err != nil {
+				t.Fatalf("Failed to close engine: %v", err)
+			}
+			if engine.syncer != nil && len(engine.syncer.dirty) != 0 {
+				t.Errorf("Expected Close to sync every rewritten file, %d left", len(engine.syncer.dirty))
+			}
+
+			reopened, err := NewFileStorageEngine(dir)
+			if err != nil {
+				t.Fatalf("Failed to reopen engine: %v", err)
+			}
+			defer reopened.Close()
+			if doc, err := reopened.ReadDocument("items", "i1"); err != nil || doc["n"] != float64(1) {
+				t.Errorf("Expected the written document, got %v, %v", doc, err)
+			}
+		})
+	}
+}
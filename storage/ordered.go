@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// SetPreserveKeyOrder sets whether a collection keeps the keys of its
+// documents in the order they were written, in its file and through
+// ReadOrderedDocument. Writes of plain documents keep the order of the keys
+// a document already has and add new ones after them, sorted. Enabling it
+// starts from the sorted order the file already has.
+func (e *FileStorageEngine) SetPreserveKeyOrder(collection string, enabled bool) error {
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.PreserveKeyOrder = enabled
+	})
+}
+
+// PreserveKeyOrder reports whether a collection keeps the order of keys
+func (e *FileStorageEngine) PreserveKeyOrder(collection string) (bool, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return false, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return false, err
+	}
+	return collFile.Metadata.PreserveKeyOrder, nil
+}
+
+// WriteOrderedDocument is WriteDocument keeping the order of the
+// document's keys if the collection preserves key order
+func (e *FileStorageEngine) WriteOrderedDocument(collection string, docID core.DocumentID, doc core.OrderedDocument) error {
+	return e.writeDocument(context.Background(), collection, docID, doc.Document(), doc)
+}
+
+// ReadOrderedDocument is ReadDocument with the document's keys in the
+// order stored, or sorted if the collection does not preserve key order
+func (e *FileStorageEngine) ReadOrderedDocument(collection string, docID core.DocumentID) (core.OrderedDocument, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	doc, exists := collFile.Documents[string(docID)]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
+	}
+	e.access.read(collection, docID)
+	return core.OrderDocument(doc, collFile.order[string(docID)]), nil
+}
+
+// keyOrderKey is the context key of the key orders set by WithKeyOrder
+type keyOrderKey struct{}
+
+// WithKeyOrder returns a context under which ApplyBatchContext and
+// ApplyMultiBatchContext write a collection's document docID with its keys
+// in the order of order, for writers whose batches hold plain documents.
+// Keys order lacks come after, sorted. It has no effect on collections that
+// do not preserve key order.
+func WithKeyOrder(ctx context.Context, collection string, docID core.DocumentID, order core.OrderedDocument) context.Context {
+	parent, _ := ctx.Value(keyOrderKey{}).(map[string]map[core.DocumentID]core.OrderedDocument)
+	orders := make(map[string]map[core.DocumentID]core.OrderedDocument, len(parent)+1)
+	for name, docs := range parent {
+		orders[name] = docs
+	}
+	docs := make(map[core.DocumentID]core.OrderedDocument, len(orders[collection])+1)
+	for id, o := range orders[collection] {
+		docs[id] = o
+	}
+	docs[docID] = order
+	orders[collection] = docs
+	return context.WithValue(ctx, keyOrderKey{}, orders)
+}
+
+// keyOrders returns the key orders ctx holds for a collection
+func keyOrders(ctx context.Context, collection string) map[core.DocumentID]core.OrderedDocument {
+	orders, _ := ctx.Value(keyOrderKey{}).(map[string]map[core.DocumentID]core.OrderedDocument)
+	return orders[collection]
+}
+
+// setOrder sets the key order of a document
+func (f *CollectionFile) setOrder(docID core.DocumentID, order core.OrderedDocument) {
+	if f.order == nil {
+		f.order = make(map[string]core.OrderedDocument)
+	}
+	f.order[string(docID)] = order
+}
+
+// orderedCollectionFile is the encoding of a collection file that
+// preserves key order
+type orderedCollectionFile struct {
+	Metadata  CollectionMetadata              `json:"metadata"`
+	Documents map[string]core.OrderedDocument `json:"documents"`
+}
+
+// encodeOrdered marshals a collection file that preserves key order, each
+// document's keys in its recorded order
+func encodeOrdered(enc *encoder, collFile *CollectionFile) ([]byte, error) {
+	docs := make(map[string]core.OrderedDocument, len(collFile.Documents))
+	for id, doc := range collFile.Documents {
+		docs[id] = core.OrderDocument(doc, collFile.order[id])
+	}
+	collFile.order = docs
+
+	data, err := enc.marshal(orderedCollectionFile{collFile.Metadata, docs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal collection file: %w", err)
+	}
+	return data, nil
+}
+
+// decodeKeyOrder records the key order of the documents of a collection
+// file that preserves it
+func decodeKeyOrder(data []byte, collFile *CollectionFile) error {
+	var ordered orderedCollectionFile
+	if err := json.Unmarshal(data, &ordered); err != nil {
+		return err
+	}
+	collFile.order = ordered.Documents
+	return nil
+}
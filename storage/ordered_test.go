@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// orderedJSON marshals an ordered document
+func orderedJSON(t *testing.T, doc core.OrderedDocument) string {
+	t.Helper()
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	return string(data)
+}
+
+func TestPreserveKeyOrder(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	if err := engine.CreateCollection("config"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if err := engine.SetPreserveKeyOrder("config", true); err != nil {
+		t.Fatalf("Failed to enable key order: %v", err)
+	}
+
+	input := `{"service":"api","version":3,"server":{"port":8080,"host":"0.0.0.0"},"routes":[{"path":"/","methods":["GET"]}],"debug":false}`
+	var doc core.OrderedDocument
+	if err := json.Unmarshal([]byte(input), &doc); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if err := engine.WriteOrderedDocument("config", "api", doc); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	// Every cycle reads back the same bytes
+	for i := 0; i < 3; i++ {
+		got, err := engine.ReadOrderedDocument("config", "api")
+		if err != nil {
+			t.Fatalf("Failed to read document: %v", err)
+		}
+		if data := orderedJSON(t, got); data != input {
+			t.Fatalf("Expected %s after %d cycles, got %s", input, i, data)
+		}
+		if err := engine.WriteOrderedDocument("config", "api", got); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+		if err := engine.WriteDocument("config", core.DocumentID("other"), core.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+
+	// The file lists the keys in order too
+	data, err := os.ReadFile(engine.getCollectionPath("config"))
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	last := strings.Index(string(data), `"documents"`)
+	for _, key := range []string{`"service"`, `"version"`, `"server"`, `"port"`, `"host"`, `"routes"`, `"debug"`} {
+		i := last + strings.Index(string(data[last:]), key)
+		if i <= last {
+			t.Fatalf("Expected %s after the keys before it in the file:\n%s", key, data)
+		}
+		last = i
+	}
+
+	// A plain update keeps the existing order and adds new keys after it
+	plain, _ := engine.ReadDocument("config", "api")
+	plain["version"] = 4.0
+	plain["auth"] = true
+	delete(plain, "debug")
+	if err := engine.WriteDocument("config", "api", plain); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	got, _ := engine.ReadOrderedDocument("config", "api")
+	expected := `{"service":"api","version":4,"server":{"port":8080,"host":"0.0.0.0"},"routes":[{"path":"/","methods":["GET"]}],"auth":true}`
+	if data := orderedJSON(t, got); data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	// A batch carries the order in the same write
+	revision, _ := engine.CollectionRevision("config")
+	ctx := WithKeyOrder(context.Background(), "config", "api", core.OrderedDocument{{Key: "auth"}})
+	err = engine.ApplyBatchContext(ctx, "config", func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{"api": docs["api"]}, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to apply batch: %v", err)
+	}
+	got, _ = engine.ReadOrderedDocument("config", "api")
+	if keys := got.Keys(); keys[0] != "auth" || len(keys) != 5 {
+		t.Errorf("Expected auth first, got %v", keys)
+	}
+	if after, _ := engine.CollectionRevision("config"); after != revision+1 {
+		t.Errorf("Expected a single rewrite, got revisions %d and %d", revision, after)
+	}
+}
+
+func TestKeyOrderNotPreservedByDefault(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	doc := core.OrderedDocument{{Key: "b", Value: 1.0}, {Key: "a", Value: 2.0}}
+	if err := engine.WriteOrderedDocument("plain", "d1", doc); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	got, err := engine.ReadOrderedDocument("plain", "d1")
+	if err != nil {
+		t.Fatalf("Failed to read document: %v", err)
+	}
+	if data := orderedJSON(t, got); data != `{"a":2,"b":1}` {
+		t.Errorf("Expected the keys sorted, got %s", data)
+	}
+	if enabled, _ := engine.PreserveKeyOrder("plain"); enabled {
+		t.Errorf("Expected key order not to be preserved by default")
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// encoder is a reusable buffer with a JSON encoder indenting into it.
+// Collection files are rewritten whole, so reusing the buffer saves an
+// allocation the size of the file per write.
+type encoder struct {
+	buf bytes.Buffer
+	enc *json.Encoder
+}
+
+// encoders holds the encoders not in use
+var encoders = sync.Pool{New: func() interface{} {
+	e := &encoder{}
+	e.enc = json.NewEncoder(&e.buf)
+	e.enc.SetIndent("", "  ")
+	return e
+}}
+
+// getEncoder takes an encoder from the pool, to give back with release
+func getEncoder() *encoder {
+	return encoders.Get().(*encoder)
+}
+
+// release returns an encoder to the pool. The data it returned must no
+// longer be used.
+func (e *encoder) release() {
+	e.buf.Reset()
+	encoders.Put(e)
+}
+
+// marshal encodes v as json.MarshalIndent does, returning data that is
+// valid until the next marshal or release
+func (e *encoder) marshal(v interface{}) ([]byte, error) {
+	e.buf.Reset()
+	if err := e.enc.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode ends the value with a newline MarshalIndent does not write
+	return bytes.TrimSuffix(e.buf.Bytes(), []byte("\n")), nil
+}
+
+// readBuffers holds the buffers collection files are read into
+var readBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// readCollectionData passes the content of a collection file to fn, which
+// must not keep it: the coalesced writes not yet on disk if there are any,
+// else the file, mapped if the engine is configured WithMmapReads and read
+// into a pooled buffer otherwise. Opening the file without a stat first
+// leaves a missing file to os.ErrNotExist.
+func (e *FileStorageEngine) readCollectionData(collection string, fn func(data []byte) error) error {
+	if e.coalescer != nil {
+		if data := e.coalescer.get(collection); data != nil {
+			return fn(data)
+		}
+	}
+	path := e.getCollectionPath(collection)
+	if e.cfg.MmapReads {
+		return readFileMapped(path, fn)
+	}
+	return readFilePooled(path, fn)
+}
+
+// readFilePooled reads a file into a pooled buffer and passes its content
+// to fn
+func readFilePooled(path string, fn func(data []byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read collection file: %w", err)
+	}
+	defer f.Close()
+
+	buf := readBuffers.Get().(*bytes.Buffer)
+	defer func() {
+		buf.Reset()
+		readBuffers.Put(buf)
+	}()
+	if info, err := f.Stat(); err == nil {
+		buf.Grow(int(info.Size()) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(f); err != nil {
+		return fmt.Errorf("failed to read collection file: %w", err)
+	}
+	return fn(buf.Bytes())
+}
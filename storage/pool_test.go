@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestEncoderMatchesMarshalIndent(t *testing.T) {
+	values := []interface{}{
+		core.Document{"name": "<b>&</b>", "n": 1.5, "tags": []interface{}{"a", nil}, "nested": map[string]interface{}{"z": true, "a": " "}},
+		CollectionFile{Metadata: CollectionMetadata{Collection: "c", Schema: json.RawMessage(`{"type": "object"}`)}, Documents: map[string]core.Document{"d1": {}}},
+		[]interface{}{},
+	}
+
+	enc := getEncoder()
+	defer enc.release()
+	for _, v := range values {
+		expected, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		got, err := enc.marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		if !bytes.Equal(got, expected) {
+			t.Errorf("Expected %s, got %s", expected, got)
+		}
+	}
+	if _, err := enc.marshal(map[string]interface{}{"f": func() {}}); err == nil {
+		t.Errorf("Expected an error encoding a function")
+	}
+}
+
+func TestReadCollectionMetadata(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+
+	if meta, err := engine.readCollectionMetadata("missing"); err != nil || meta.Revision != 0 {
+		t.Errorf("Expected zero metadata for a missing collection, got %+v, %v", meta, err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := engine.WriteDocument("users", "u1", core.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	collFile, err := engine.readCollectionFile("users")
+	if err != nil {
+		t.Fatalf("Failed to read collection: %v", err)
+	}
+	meta, err := engine.readCollectionMetadata("users")
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	if meta.Revision != 3 || meta.Revision != collFile.Metadata.Revision || meta.DocumentCount != 1 {
+		t.Errorf("Expected the metadata of the collection file, got %+v", meta)
+	}
+}
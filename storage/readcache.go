@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// defaultReadCacheBytes is the read cache budget of an engine given no
+// WithReadCacheSize
+const defaultReadCacheBytes = 64 << 20
+
+// WithReadCacheSize bounds the read cache of ReadDocumentWith to maxBytes of
+// collection files, by their size on disk. Past it the least recently read
+// collections are evicted, and a collection larger than the whole budget is
+// not cached. Zero leaves the cache unbounded; the default is 64 MiB.
+func WithReadCacheSize(maxBytes int64) Option {
+	return func(c *Config) {
+		c.ReadCacheBytes = maxBytes
+	}
+}
+
+// ReadDocumentWith reads a document as opts prefer, through the engine's
+// read cache. The cache holds the documents of each collection read this
+// way, with the modification time and size of the file they were loaded
+// from. Fresh reads serve them only after checking the file still has that
+// time and size, reloading it otherwise; cached reads serve them unchecked,
+// up to opts.MaxStaleness after they were last checked. Writes through the
+// engine drop a collection from the cache, as does evicting it to stay
+// within WithReadCacheSize.
+func (e *FileStorageEngine) ReadDocumentWith(collection string, docID core.DocumentID, opts core.ReadOptions) (_ core.Document, err error) {
+	if e.instrumented() {
+		defer e.observe(opRead, collection, docID, time.Now(), &err)
+	}
+	docs, err := e.cachedDocuments(collection, opts)
+	if err != nil {
+		return nil, err
+	}
+	doc, exists := docs[string(docID)]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", core.ErrDocumentNotFound, docID)
+	}
+	e.access.read(collection, docID)
+	return doc.Clone(), nil
+}
+
+// ScanCollectionWith iterates over all documents in a collection as opts
+// prefer, through the read cache of ReadDocumentWith
+func (e *FileStorageEngine) ScanCollectionWith(collection string, opts core.ReadOptions, fn func(core.DocumentID, core.Document) bool) (err error) {
+	if e.instrumented() {
+		defer e.observe(opScan, collection, "", time.Now(), &err)
+	}
+	docs, err := e.cachedDocuments(collection, opts)
+	if err != nil {
+		return err
+	}
+	e.access.read(collection, "")
+	for docID, doc := range docs {
+		if !fn(core.DocumentID(docID), doc.Clone()) {
+			break
+		}
+	}
+	return nil
+}
+
+// cachedDocuments returns the documents of a collection from the read
+// cache, loading them as opts require. They are shared with the cache.
+func (e *FileStorageEngine) cachedDocuments(collection string, opts core.ReadOptions) (map[string]core.Document, error) {
+	if opts.Preference == core.ReadCached {
+		if e.closed.Load() {
+			return nil, ErrEngineClosed
+		}
+		if docs, ok := e.reads.serve(collection, opts.MaxStaleness); ok {
+			return docs, nil
+		}
+	}
+
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	// Coalesced writes are not on disk yet, so the file cannot vouch for
+	// the cache
+	if e.coalescer != nil && e.coalescer.get(collection) != nil {
+		collFile, err := e.readCollectionFile(collection)
+		if err != nil {
+			return nil, err
+		}
+		return collFile.Documents, nil
+	}
+
+	info, err := os.Stat(e.getCollectionPath(collection))
+	if errors.Is(err, os.ErrNotExist) {
+		e.reads.drop(collection)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection file: %w", err)
+	}
+	if docs, ok := e.reads.verify(collection, info); ok {
+		return docs, nil
+	}
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	e.reads.store(collection, collFile.Documents, info)
+	return collFile.Documents, nil
+}
+
+// readCache holds the documents of collections read with read options. Its
+// zero value is ready to use, without a budget.
+type readCache struct {
+	mu          sync.Mutex
+	collections map[string]*cachedCollection
+	recent      list.List        // Names of the cached collections, most recently read first
+	budget      int64            // Bytes of collection files held at most; 0 is unbounded
+	used        int64            // Bytes of the cached collection files
+	now         func() time.Time // Nil uses time.Now; set by tests
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	stale  atomic.Uint64
+}
+
+// cachedCollection is the documents of a collection file and the file's
+// state when they were loaded
+type cachedCollection struct {
+	docs     map[string]core.Document
+	modTime  time.Time
+	size     int64
+	verified time.Time     // When the file was last found unchanged
+	elem     *list.Element // In readCache.recent
+}
+
+// clock returns the current time
+func (c *readCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// serve returns the cached documents of a collection without checking the
+// file, if they were checked at most maxStaleness ago
+func (c *readCache) serve(collection string, maxStaleness time.Duration) (map[string]core.Document, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.collections[collection]
+	if !ok || (maxStaleness > 0 && c.clock().Sub(cached.verified) > maxStaleness) {
+		return nil, false
+	}
+	c.recent.MoveToFront(cached.elem)
+	c.stale.Add(1)
+	return cached.docs, true
+}
+
+// verify returns the cached documents of a collection if its file is as
+// they were loaded from
+func (c *readCache) verify(collection string, info os.FileInfo) (map[string]core.Document, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.collections[collection]
+	if !ok || !cached.modTime.Equal(info.ModTime()) || cached.size != info.Size() {
+		return nil, false
+	}
+	cached.verified = c.clock()
+	c.recent.MoveToFront(cached.elem)
+	c.hits.Add(1)
+	return cached.docs, true
+}
+
+// store caches the documents loaded from a collection file, evicting the
+// least recently read collections to stay within the budget
+func (c *readCache) store(collection string, docs map[string]core.Document, info os.FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.misses.Add(1)
+	c.remove(collection)
+	if c.budget > 0 && info.Size() > c.budget {
+		return
+	}
+	if c.collections == nil {
+		c.collections = make(map[string]*cachedCollection)
+	}
+	c.collections[collection] = &cachedCollection{docs: docs, modTime: info.ModTime(), size: info.Size(), verified: c.clock(), elem: c.recent.PushFront(collection)}
+	c.used += info.Size()
+	for c.budget > 0 && c.used > c.budget {
+		c.remove(c.recent.Back().Value.(string))
+	}
+}
+
+// drop forgets the cached documents of a collection
+func (c *readCache) drop(collection string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(collection)
+}
+
+// remove forgets the cached documents of a collection. Callers must hold
+// c.mu.
+func (c *readCache) remove(collection string) {
+	cached, ok := c.collections[collection]
+	if !ok {
+		return
+	}
+	delete(c.collections, collection)
+	c.recent.Remove(cached.elem)
+	c.used -= cached.size
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// rewriteOutOfBand replaces text in a collection file behind the engine's
+// back, as another process would
+func rewriteOutOfBand(t *testing.T, dir, collection, old, new string) {
+	t.Helper()
+	path := filepath.Join(dir, collection+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	if !bytes.Contains(data, []byte(old)) {
+		t.Fatalf("Expected %q in the collection file", old)
+	}
+	if err := os.WriteFile(path, bytes.ReplaceAll(data, []byte(old), []byte(new)), 0644); err != nil {
+		t.Fatalf("Failed to write collection file: %v", err)
+	}
+}
+
+// readValue reads the "v" field of a document with read options
+func readValue(t *testing.T, engine *FileStorageEngine, opts core.ReadOptions) interface{} {
+	t.Helper()
+	doc, err := engine.ReadDocumentWith("items", "a", opts)
+	if err != nil {
+		t.Fatalf("Failed to read document: %v", err)
+	}
+	return doc["v"]
+}
+
+func TestReadPreference(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	if err := engine.WriteDocument("items", "a", core.Document{"v": "old"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	fresh := core.ReadOptions{}
+	cached := core.ReadOptions{Preference: core.ReadCached}
+	if v := readValue(t, engine, fresh); v != "old" {
+		t.Fatalf("Expected old, got %v", v)
+	}
+
+	rewriteOutOfBand(t, dir, "items", `"old"`, `"newer"`)
+	if v := readValue(t, engine, cached); v != "old" {
+		t.Errorf("Expected the cached read to serve old, got %v", v)
+	}
+	if v := readValue(t, engine, fresh); v != "newer" {
+		t.Errorf("Expected the fresh read to pick up newer, got %v", v)
+	}
+	if v := readValue(t, engine, cached); v != "newer" {
+		t.Errorf("Expected the cached read to serve what the fresh read loaded, got %v", v)
+	}
+	if v := readValue(t, engine, fresh); v != "newer" {
+		t.Errorf("Expected newer, got %v", v)
+	}
+
+	// Writes through the engine drop the collection from the cache
+	if err := engine.WriteDocument("items", "a", core.Document{"v": "written"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if v := readValue(t, engine, cached); v != "written" {
+		t.Errorf("Expected the cached read to see the engine's write, got %v", v)
+	}
+
+	stats, err := engine.Stats()
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.StaleReads != 2 || stats.ReadCacheHits != 1 || stats.ReadCacheMisses != 3 {
+		t.Errorf("Expected 2 stale reads, 1 hit and 3 misses, got %d, %d and %d", stats.StaleReads, stats.ReadCacheHits, stats.ReadCacheMisses)
+	}
+
+	// Documents handed out are copies
+	doc, _ := engine.ReadDocumentWith("items", "a", cached)
+	doc["v"] = "changed"
+	if v := readValue(t, engine, cached); v != "written" {
+		t.Errorf("Expected the cache untouched by callers, got %v", v)
+	}
+	if _, err := engine.ReadDocumentWith("items", "missing", cached); err == nil {
+		t.Errorf("Expected an error for a missing document")
+	}
+}
+
+func TestReadMaxStaleness(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	engine.reads.now = func() time.Time { return now }
+
+	if err := engine.WriteDocument("items", "a", core.Document{"v": "old"}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	readValue(t, engine, core.ReadOptions{})
+	rewriteOutOfBand(t, dir, "items", `"old"`, `"newer"`)
+
+	opts := core.ReadOptions{Preference: core.ReadCached, MaxStaleness: 10 * time.Second}
+	now = now.Add(10 * time.Second)
+	if v := readValue(t, engine, opts); v != "old" {
+		t.Errorf("Expected old at the staleness bound, got %v", v)
+	}
+	now = now.Add(time.Nanosecond)
+	if v := readValue(t, engine, opts); v != "newer" {
+		t.Errorf("Expected a refresh past the staleness bound, got %v", v)
+	}
+
+	// The refresh starts the bound again
+	rewriteOutOfBand(t, dir, "items", `"newer"`, `"newest"`)
+	now = now.Add(5 * time.Second)
+	if v := readValue(t, engine, opts); v != "newer" {
+		t.Errorf("Expected newer within the bound, got %v", v)
+	}
+}
+
+func TestScanCollectionWith(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	for _, id := range []core.DocumentID{"a", "b"} {
+		if err := engine.WriteDocument("items", id, core.Document{"v": "old"}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+
+	values := func(opts core.ReadOptions) map[core.DocumentID]interface{} {
+		out := make(map[core.DocumentID]interface{})
+		if err := engine.ScanCollectionWith("items", opts, func(id core.DocumentID, doc core.Document) bool {
+			out[id] = doc["v"]
+			return true
+		}); err != nil {
+			t.Fatalf("Failed to scan: %v", err)
+		}
+		return out
+	}
+	values(core.ReadOptions{})
+	rewriteOutOfBand(t, dir, "items", `"old"`, `"newer"`)
+
+	if got := values(core.ReadOptions{Preference: core.ReadCached}); got["a"] != "old" || got["b"] != "old" {
+		t.Errorf("Expected the cached scan to serve old values, got %v", got)
+	}
+	if got := values(core.ReadOptions{}); got["a"] != "newer" || got["b"] != "newer" {
+		t.Errorf("Expected the fresh scan to pick up newer values, got %v", got)
+	}
+	if got := values(core.ReadOptions{Preference: core.ReadCached}); len(got) != 2 {
+		t.Errorf("Expected 2 documents, got %v", got)
+	}
+	if err := engine.ScanCollectionWith("missing", core.ReadOptions{}, func(core.DocumentID, core.Document) bool { return true }); err != nil {
+		t.Errorf("Expected a missing collection to scan empty, got %v", err)
+	}
+}
+
+func TestReadCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	for _, collection := range []string{"a", "b", "c"} {
+		if err := engine.WriteDocument(collection, "a", core.Document{"v": collection}); err != nil {
+			t.Fatalf("Failed to write document: %v", err)
+		}
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.json"))
+	if err != nil {
+		t.Fatalf("Failed to stat collection file: %v", err)
+	}
+	// Room for two of the three files
+	engine.reads.budget = 2*info.Size() + info.Size()/2
+
+	fresh := core.ReadOptions{}
+	cached := func(collection string) bool {
+		engine.reads.mu.Lock()
+		defer engine.reads.mu.Unlock()
+		_, ok := engine.reads.collections[collection]
+		return ok
+	}
+	for _, collection := range []string{"a", "b", "a", "c"} {
+		if _, err := engine.ReadDocumentWith(collection, "a", fresh); err != nil {
+			t.Fatalf("Failed to read document: %v", err)
+		}
+	}
+	if !cached("a") || cached("b") || !cached("c") {
+		t.Errorf("Expected b, the least recently read, to be evicted")
+	}
+	if engine.reads.used > engine.reads.budget {
+		t.Errorf("Expected at most %d bytes cached, got %d", engine.reads.budget, engine.reads.used)
+	}
+
+	if err := engine.DropCollection("c"); err != nil {
+		t.Fatalf("Failed to drop collection: %v", err)
+	}
+	if cached("c") || engine.reads.used != info.Size() {
+		t.Errorf("Expected the dropped collection to leave the cache, got %d bytes cached", engine.reads.used)
+	}
+
+	// A collection larger than the whole budget is not cached. Timestamps
+	// make file sizes differ by a few bytes, so b's own size sets the budget.
+	info, err = os.Stat(filepath.Join(dir, "b.json"))
+	if err != nil {
+		t.Fatalf("Failed to stat collection file: %v", err)
+	}
+	engine.reads.budget = info.Size() - 1
+	engine.ReadDocumentWith("b", "a", fresh)
+	if cached("b") {
+		t.Errorf("Expected a collection over the budget not to be cached")
+	}
+}
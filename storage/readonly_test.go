@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// dirEntries returns the names in a directory, sorted
+func dirEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReadOnlyEngine(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	writer.WriteDocument("users", "u1", core.Document{"name": "Ada"})
+	writer.WriteDocument("users", "u2", core.Document{"name": "Grace"})
+	writer.Close()
+
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatalf("Failed to make directory read-only: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	before := dirEntries(t, dir)
+
+	engine, err := NewFileStorageEngine(dir, WithReadOnly())
+	if err != nil {
+		t.Fatalf("Failed to open read-only engine: %v", err)
+	}
+
+	if doc, err := engine.ReadDocument("users", "u1"); err != nil || doc["name"] != "Ada" {
+		t.Errorf("Expected to read u1, got %v (%v)", doc, err)
+	}
+	if n, err := engine.CountDocuments("users"); err != nil || n != 2 {
+		t.Errorf("Expected 2 documents, got %d (%v)", n, err)
+	}
+	scanned := 0
+	if err := engine.ScanCollection("users", func(core.DocumentID, core.Document) bool { scanned++; return true }); err != nil || scanned != 2 {
+		t.Errorf("Expected to scan 2 documents, got %d (%v)", scanned, err)
+	}
+	if names, err := engine.ListCollections(); err != nil || !reflect.DeepEqual(names, []string{"users"}) {
+		t.Errorf("Expected the users collection, got %v (%v)", names, err)
+	}
+
+	writes := map[string]func() error{
+		"WriteDocument":    func() error { return engine.WriteDocument("users", "u3", core.Document{}) },
+		"DeleteDocument":   func() error { return engine.DeleteDocument("users", "u1") },
+		"CreateCollection": func() error { return engine.CreateCollection("orders") },
+		"ApplyBatch": func() error {
+			return engine.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+				return map[core.DocumentID]core.Document{"u1": nil}, nil
+			})
+		},
+		"ApplyMultiBatch": func() error {
+			return engine.ApplyMultiBatch([]string{"users"}, func(map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+				return nil, nil
+			})
+		},
+		"InsertDocument": func() error {
+			_, err := engine.InsertDocument("users", core.Document{}, core.IDOptions{})
+			return err
+		},
+		"SetSchema":   func() error { return engine.SetSchema("users", []byte(`{"type": "object"}`), schema.Lenient) },
+		"SetDefaults": func() error { return engine.SetDefaults("users", core.Document{"role": "guest"}) },
+		"EnableOplog": engine.EnableOplog,
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("Expected ErrReadOnly from %s, got %v", name, err)
+		}
+	}
+
+	if err := engine.Close(); err != nil {
+		t.Errorf("Failed to close read-only engine: %v", err)
+	}
+	if after := dirEntries(t, dir); !reflect.DeepEqual(before, after) {
+		t.Errorf("Expected the directory to be untouched, got %v instead of %v", after, before)
+	}
+}
+
+func TestReadOnlyEngineOpen(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	if _, err := NewFileStorageEngine(missing, WithReadOnly()); err == nil {
+		t.Errorf("Expected error opening a missing directory")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory not to be created, got %v", err)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, journalFileName), []byte(`{"replacements": []}`), 0644)
+	if _, err := NewFileStorageEngine(dir, WithReadOnly()); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly with a journal to recover, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// allCollections stands for every collection in ScanCollections. A NUL
+// cannot appear in a file name, so no collection is called this.
+const allCollections = "\x00all"
+
+// AllCollections returns the collections argument that makes
+// ScanCollections scan every collection ListCollections returns
+func AllCollections() []string {
+	return []string{allCollections}
+}
+
+// ScanCollections scans several collections at once, at most parallelism
+// of them at a time (one per CPU if parallelism is below 1), passing each
+// document to fn with its collection. Each collection is scanned by a
+// single worker, so fn is called concurrently only for different
+// collections; a collection listed twice is scanned once. When fn returns
+// false or a scan fails, the scans in progress stop and no more start. The
+// first error is returned.
+func (e *FileStorageEngine) ScanCollections(collections []string, parallelism int, fn func(collection string, id core.DocumentID, doc core.Document) bool) error {
+	collections, err := e.scanTargets(collections)
+	if err != nil {
+		return err
+	}
+	if parallelism < 1 {
+		parallelism = runtime.GOMAXPROCS(0)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	queue := make(chan string)
+	for i := 0; i < min(parallelism, len(collections)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for collection := range queue {
+				if ctx.Err() != nil {
+					continue
+				}
+				err := e.ScanCollectionContext(ctx, collection, func(docID core.DocumentID, doc core.Document) bool {
+					if ctx.Err() != nil {
+						return false
+					}
+					if !fn(collection, docID, doc) {
+						cancel()
+						return false
+					}
+					return true
+				})
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("failed to scan collection %s: %w", collection, err) })
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for _, collection := range collections {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case queue <- collection:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// scanTargets expands AllCollections and drops repeated collections
+func (e *FileStorageEngine) scanTargets(collections []string) ([]string, error) {
+	var targets []string
+	seen := make(map[string]bool, len(collections))
+	for _, collection := range collections {
+		names := []string{collection}
+		if collection == allCollections {
+			all, err := e.ListCollections()
+			if err != nil {
+				return nil, err
+			}
+			names = all
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				targets = append(targets, name)
+			}
+		}
+	}
+	return targets, nil
+}
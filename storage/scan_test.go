@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// seedCollections writes docs documents to each of n collections
+func seedCollections(t *testing.T, engine *FileStorageEngine, n, docs int) {
+	t.Helper()
+	for c := 0; c < n; c++ {
+		for d := 0; d < docs; d++ {
+			if err := engine.WriteDocument(fmt.Sprintf("c%d", c), core.DocumentID(fmt.Sprintf("d%d", d)), core.Document{"n": d}); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+		}
+	}
+}
+
+func TestScanCollections(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+	seedCollections(t, engine, 8, 20)
+
+	tests := []struct {
+		name        string
+		collections []string
+		expected    int
+	}{
+		{"all collections", AllCollections(), 160},
+		{"listed collections", []string{"c1", "c2"}, 40},
+		{"repeated collection", []string{"c1", "c1", "c2"}, 40},
+		{"all and listed", append(AllCollections(), "c1"), 160},
+		{"none", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := make(map[string]bool)
+			active := make(map[string]*int32)
+			for c := 0; c < 8; c++ {
+				active[fmt.Sprintf("c%d", c)] = new(int32)
+			}
+			err := engine.ScanCollections(tt.collections, 4, func(collection string, id core.DocumentID, doc core.Document) bool {
+				// fn is never called concurrently for one collection
+				if atomic.AddInt32(active[collection], 1) != 1 {
+					t.Errorf("Expected one call at a time for %s", collection)
+				}
+				defer atomic.AddInt32(active[collection], -1)
+				mu.Lock()
+				seen[collection+"/"+string(id)] = true
+				mu.Unlock()
+				return true
+			})
+			if err != nil {
+				t.Fatalf("Failed to scan collections: %v", err)
+			}
+			if len(seen) != tt.expected {
+				t.Errorf("Expected %d documents, got %d", tt.expected, len(seen))
+			}
+		})
+	}
+}
+
+func TestScanCollectionsStop(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+	seedCollections(t, engine, 20, 50)
+
+	// Once fn returns false, each worker makes at most the call it was in
+	// the middle of
+	var calls int32
+	err := engine.ScanCollections(AllCollections(), 4, func(string, core.DocumentID, core.Document) bool {
+		atomic.AddInt32(&calls, 1)
+		return false
+	})
+	if err != nil {
+		t.Fatalf("Failed to scan collections: %v", err)
+	}
+	if calls > 4 {
+		t.Errorf("Expected the scans to stop after at most 4 calls, got %d", calls)
+	}
+
+	// A failed scan stops the others and its error is returned
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0644)
+	calls = 0
+	err = engine.ScanCollections([]string{"broken", "c1", "c2", "c3"}, 1, func(string, core.DocumentID, core.Document) bool {
+		atomic.AddInt32(&calls, 1)
+		return true
+	})
+	if err == nil {
+		t.Fatalf("Expected an error scanning a corrupt collection")
+	}
+	if calls != 0 {
+		t.Errorf("Expected no scans after the failure, got %d calls", calls)
+	}
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// compiledSchema caches a collection's schema with the source it was compiled from
+type compiledSchema struct {
+	source []byte
+	mode   schema.Mode
+	schema *schema.Schema
+}
+
+// SetSchema stores a JSON Schema in a collection's metadata. Every later
+// write must satisfy it or fails with a *schema.ValidationError; documents
+// already stored are not checked (see ValidateCollection). In strict mode
+// objects reject properties their schema does not declare unless it says
+// otherwise with additionalProperties. An empty schema removes it.
+func (e *FileStorageEngine) SetSchema(collection string, data []byte, mode schema.Mode) error {
+	if len(data) > 0 {
+		if _, err := schema.Compile(data, mode); err != nil {
+			return err
+		}
+	}
+
+	return e.updateMetadata(collection, func(metadata *CollectionMetadata) {
+		metadata.Schema = nil
+		metadata.SchemaMode = schema.Lenient
+		if len(data) > 0 {
+			metadata.Schema = append([]byte(nil), data...)
+			metadata.SchemaMode = mode
+		}
+	})
+}
+
+// Schema returns a collection's JSON Schema and mode, or a nil schema if it
+// has none
+func (e *FileStorageEngine) Schema(collection string) ([]byte, schema.Mode, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, schema.Lenient, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, schema.Lenient, err
+	}
+	return collFile.Metadata.Schema, collFile.Metadata.SchemaMode, nil
+}
+
+// ValidateCollection checks every stored document against the collection's
+// schema and returns a ValidationError for each invalid one, ordered by ID
+func (e *FileStorageEngine) ValidateCollection(collection string) ([]*schema.ValidationError, error) {
+	// Acquire read lock
+	if err := e.rlock(); err != nil {
+		return nil, err
+	}
+	defer e.mu.RUnlock()
+
+	collFile, err := e.readCollectionFile(collection)
+	if err != nil {
+		return nil, err
+	}
+	s, err := e.schemaFor(collection, collFile)
+	if err != nil || s == nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(collFile.Documents))
+	for docID := range collFile.Documents {
+		ids = append(ids, docID)
+	}
+	sort.Strings(ids)
+
+	var invalid []*schema.ValidationError
+	for _, docID := range ids {
+		if violations := s.Validate(collFile.Documents[docID]); len(violations) > 0 {
+			invalid = append(invalid, &schema.ValidationError{Collection: collection, DocID: core.DocumentID(docID), Violations: violations})
+		}
+	}
+	return invalid, nil
+}
+
+// validateWrites checks the documents of a batch against the collection's
+// schema, failing on the first invalid one by ID. Deletes are not checked.
+func (e *FileStorageEngine) validateWrites(collection string, collFile *CollectionFile, writes map[core.DocumentID]core.Document) error {
+	s, err := e.schemaFor(collection, collFile)
+	if err != nil || s == nil {
+		return err
+	}
+
+	ids := make([]core.DocumentID, 0, len(writes))
+	for docID, doc := range writes {
+		if doc != nil {
+			ids = append(ids, docID)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, docID := range ids {
+		if violations := s.Validate(writes[docID]); len(violations) > 0 {
+			return &schema.ValidationError{Collection: collection, DocID: docID, Violations: violations}
+		}
+	}
+	return nil
+}
+
+// schemaFor returns the compiled schema of a collection file, or nil if it
+// has none, compiling it only when it changed
+func (e *FileStorageEngine) schemaFor(collection string, collFile *CollectionFile) (*schema.Schema, error) {
+	source, mode := collFile.Metadata.Schema, collFile.Metadata.SchemaMode
+	if len(source) == 0 {
+		return nil, nil
+	}
+
+	e.schemasMu.Lock()
+	defer e.schemasMu.Unlock()
+
+	if cached, ok := e.schemas[collection]; ok && cached.mode == mode && bytes.Equal(cached.source, source) {
+		e.schemaHits.Add(1)
+		return cached.schema, nil
+	}
+	e.schemaMisses.Add(1)
+
+	s, err := schema.Compile(source, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema of %s: %w", collection, err)
+	}
+	e.schemas[collection] = compiledSchema{source: source, mode: mode, schema: s}
+	return s, nil
+}
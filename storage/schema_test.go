@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+const itemSchema = `{
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"qty": {"type": "integer", "minimum": 0}
+	}
+}`
+
+func TestSchemaValidatesWrites(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.CreateCollection("items")
+	if err := engine.SetSchema("items", []byte(itemSchema), schema.Strict); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+
+	if err := engine.WriteDocument("items", "i1", core.Document{"name": "bolt", "qty": 3}); err != nil {
+		t.Fatalf("Failed to write valid document: %v", err)
+	}
+
+	err := engine.WriteDocument("items", "i2", core.Document{"qty": -1, "colour": "red"})
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) || !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	if verr.DocID != "i2" || len(verr.Violations) != 3 {
+		t.Errorf("Expected 3 violations for i2, got %+v", verr)
+	}
+
+	// A batch with one invalid document writes nothing
+	err = engine.ApplyBatch("items", func(docs map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{
+			"i1": nil,
+			"i3": {"name": "nut"},
+			"i4": {"name": 4},
+		}, nil
+	})
+	if !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Fatalf("Expected ErrSchemaValidation from batch, got %v", err)
+	}
+	if state := collectionState(t, engine, "items"); len(state) != 1 || state["i1"] == nil {
+		t.Errorf("Expected only i1 after rejected batch, got %v", state)
+	}
+
+	// Removing the schema allows anything again
+	if err := engine.SetSchema("items", nil, schema.Lenient); err != nil {
+		t.Fatalf("Failed to remove schema: %v", err)
+	}
+	if err := engine.WriteDocument("items", "i2", core.Document{"qty": -1}); err != nil {
+		t.Errorf("Expected write without schema to succeed, got %v", err)
+	}
+}
+
+func TestSchemaPersists(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.CreateCollection("items")
+	if err := engine.SetSchema("items", []byte(`{"oneOf": []}`), schema.Lenient); err == nil {
+		t.Errorf("Expected error setting an unsupported schema")
+	}
+	engine.SetSchema("items", []byte(itemSchema), schema.Strict)
+	engine.Close()
+
+	reopened, err := NewFileStorageEngine(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reopen engine: %v", err)
+	}
+	defer reopened.Close()
+
+	data, mode, err := reopened.Schema("items")
+	if err != nil {
+		t.Fatalf("Failed to read schema: %v", err)
+	}
+	if mode != schema.Strict || len(data) == 0 {
+		t.Errorf("Expected the strict schema, got %s (%v)", data, mode)
+	}
+	if err := reopened.WriteDocument("items", "i1", core.Document{"name": "bolt", "extra": 1}); !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Errorf("Expected ErrSchemaValidation after reopen, got %v", err)
+	}
+}
+
+func TestValidateCollection(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	engine.WriteDocument("items", "i1", core.Document{"name": "bolt"})
+	engine.WriteDocument("items", "i2", core.Document{"qty": 1})
+	engine.WriteDocument("items", "i3", core.Document{"name": "nut", "qty": 1.5})
+
+	if invalid, err := engine.ValidateCollection("items"); err != nil || invalid != nil {
+		t.Errorf("Expected nothing to report without a schema, got %v (%v)", invalid, err)
+	}
+
+	engine.SetSchema("items", []byte(itemSchema), schema.Lenient)
+	invalid, err := engine.ValidateCollection("items")
+	if err != nil {
+		t.Fatalf("Failed to validate collection: %v", err)
+	}
+	if len(invalid) != 2 || invalid[0].DocID != "i2" || invalid[1].DocID != "i3" {
+		t.Fatalf("Expected i2 and i3 to be invalid, got %v", invalid)
+	}
+	if v := invalid[1].Violations; len(v) != 1 || v[0].Path != "qty" || v[0].Rule != "type" {
+		t.Errorf("Expected a type violation at qty, got %v", v)
+	}
+}
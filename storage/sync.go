@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+)
+
+// replaceCollectionFile atomically replaces a collection file, fsyncing it
+// as the engine's sync mode says
+func (e *FileStorageEngine) replaceCollectionFile(path string, data []byte) error {
+	if e.cfg.Sync == SyncAlways {
+		return fsutil.WriteFileAtomic(path, data)
+	}
+	if err := fsutil.ReplaceFile(path, data, false); err != nil {
+		return err
+	}
+	if e.syncer != nil {
+		e.syncer.add(path)
+	}
+	return nil
+}
+
+// syncer fsyncs the files rewritten without syncing, every interval
+type syncer struct {
+	e *FileStorageEngine
+
+	mu    sync.Mutex
+	dirty map[string]struct{} // Paths rewritten since the last sync
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newSyncer starts syncing an engine's rewritten files every interval
+func newSyncer(e *FileStorageEngine, interval time.Duration) *syncer {
+	s := &syncer{
+		e:     e,
+		dirty: make(map[string]struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run(interval)
+	return s
+}
+
+// add marks a file as needing a sync
+func (s *syncer) add(path string) {
+	s.mu.Lock()
+	s.dirty[path] = struct{}{}
+	s.mu.Unlock()
+}
+
+// run syncs every interval until closed
+func (s *syncer) run(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.sync(); err != nil {
+				s.e.logEvent(slog.LevelError, "failed to sync collection files", slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// sync fsyncs the files rewritten since the last sync, and the data
+// directory holding their new names. Files removed since are skipped.
+func (s *syncer) sync() error {
+	s.mu.Lock()
+	dirty := s.dirty
+	s.dirty = make(map[string]struct{})
+	s.mu.Unlock()
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for path := range dirty {
+		if err := syncPath(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if err := syncPath(s.e.dataDir); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// close stops the syncer and syncs what is left
+func (s *syncer) close() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return s.sync()
+}
+
+// syncPath fsyncs a file or directory
+func syncPath(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return nil
+}
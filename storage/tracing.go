@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the engine's spans
+const tracerName = "github.com/HakashiKatake/Go-Json-Database/storage"
+
+// WithTracer records WriteDocument, ReadDocument and ScanCollection as spans
+// of tracers from tp, children of the span in the context passed to their
+// Context variants. A nil tp traces nothing and costs nothing.
+func WithTracer(tp trace.TracerProvider) Option {
+	return func(c *Config) {
+		c.Tracer = tp
+	}
+}
+
+// startSpan starts the span of an operation on a document of a collection;
+// the engine must have a tracer
+func (e *FileStorageEngine) startSpan(ctx context.Context, name, collection string, docID core.DocumentID) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String(core.AttrCollection, collection)}
+	if docID != "" {
+		attrs = append(attrs, attribute.String(core.AttrDocumentID, string(docID)))
+	}
+	return e.tracer.Start(ctx, name, trace.WithAttributes(attrs...), trace.WithSpanKind(trace.SpanKindInternal))
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEngineTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	engine, err := NewFileStorageEngine(t.TempDir(), WithTracer(tp))
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	engine.WriteDocumentContext(ctx, "users", "u1", core.Document{"name": "Ada"})
+	engine.WriteDocument("users", "u2", core.Document{"name": "Grace"})
+	engine.ScanCollectionContext(ctx, "users", func(core.DocumentID, core.Document) bool { return true })
+	parent.End()
+
+	attrs := make(map[string]map[string]int64)
+	children := 0
+	for _, span := range exporter.GetSpans() {
+		if span.Parent.SpanID() == parent.SpanContext().SpanID() {
+			children++
+		}
+		values := make(map[string]int64)
+		for _, kv := range span.Attributes {
+			values[string(kv.Key)] = kv.Value.AsInt64()
+		}
+		attrs[span.Name] = values
+	}
+
+	// The write without a context starts a trace of its own
+	if children != 2 {
+		t.Errorf("Expected 2 spans under the caller's span, got %d", children)
+	}
+	if attrs["storage.WriteDocument"][core.AttrBytes] == 0 {
+		t.Errorf("Expected write spans to record bytes written")
+	}
+	if got := attrs["storage.ScanCollection"][core.AttrDocuments]; got != 2 {
+		t.Errorf("Expected the scan span to count 2 documents, got %d", got)
+	}
+}
+
+func TestEngineWithoutTracerAllocations(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+	engine.WriteDocument("items", "i1", core.Document{"n": 1})
+
+	ctx := context.Background()
+	plain := testing.AllocsPerRun(50, func() { engine.ReadDocument("items", "i1") })
+	withCtx := testing.AllocsPerRun(50, func() { engine.ReadDocumentContext(ctx, "items", "i1") })
+	if withCtx > plain {
+		t.Errorf("Expected no allocations for tracing without a tracer, got %v over %v", withCtx, plain)
+	}
+}
@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/internal/fsutil"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// corruptFileSuffix is added to the name of a collection file that cannot be
+// parsed when VerifyDataDir moves it aside
+const corruptFileSuffix = ".corrupt"
+
+// Severity is how serious an issue found by VerifyDataDir is
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"    // Nothing is wrong yet, such as a batch the next open completes
+	SeverityWarning Severity = "warning" // Data is intact but the directory is untidy or a cache is wrong
+	SeverityError   Severity = "error"   // Data is lost, unreadable or invalid
+)
+
+// IssueKind is the category of an issue found by VerifyDataDir
+type IssueKind string
+
+const (
+	IssueCorruptCollection IssueKind = "corrupt_collection" // A collection file does not parse
+	IssueCountMismatch     IssueKind = "count_mismatch"     // Metadata disagrees with the documents
+	IssueInvalidSchema     IssueKind = "invalid_schema"     // A stored schema does not compile
+	IssueInvalidDocument   IssueKind = "invalid_document"   // A document breaks its collection's schema
+	IssueOrphanFile        IssueKind = "orphan_file"        // A temporary, lock or staged file nothing owns
+	IssuePendingJournal    IssueKind = "pending_journal"    // A batch journal the next open completes
+	IssueCorruptJournal    IssueKind = "corrupt_journal"    // A batch journal that does not parse
+	IssueTornLog           IssueKind = "torn_log"           // A log ends with a partly written entry
+	IssueCorruptLog        IssueKind = "corrupt_log"        // A log has an unreadable entry before its end
+	IssueCorruptIndex      IssueKind = "corrupt_index"      // An index file is damaged or disagrees with its collection
+	IssueStaleIndex        IssueKind = "stale_index"        // An index file is older than its collection
+)
+
+// Repair is how an issue can be fixed
+type Repair string
+
+const (
+	RepairNone        Repair = "none"        // Must be fixed by hand
+	RepairSafe        Repair = "safe"        // Fixed by VerifyOptions.Repair without losing data
+	RepairDestructive Repair = "destructive" // Fixed only with VerifyOptions.AllowDestructive too, losing data
+)
+
+// Issue is one problem found by VerifyDataDir
+type Issue struct {
+	Severity   Severity        `json:"severity"`
+	Kind       IssueKind       `json:"kind"`
+	Path       string          `json:"path"`
+	Collection string          `json:"collection,omitempty"`
+	Namespace  string          `json:"namespace,omitempty"`
+	DocID      core.DocumentID `json:"id,omitempty"`
+	Message    string          `json:"message"`
+	Repair     Repair          `json:"repair"`
+	Repaired   bool            `json:"repaired,omitempty"`
+	RepairErr  string          `json:"repair_error,omitempty"` // Why a repair that was allowed failed
+}
+
+// VerifyReport is the result of VerifyDataDir
+type VerifyReport struct {
+	Dir         string  `json:"dir"`
+	Collections int     `json:"collections"`
+	Documents   int     `json:"documents"`
+	Issues      []Issue `json:"issues"`
+}
+
+// Unrepaired returns the number of issues of a severity left unrepaired
+func (r VerifyReport) Unrepaired(severity Severity) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity && !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+// VerifyOptions configures VerifyDataDir
+type VerifyOptions struct {
+	// Repair fixes the issues whose repair is RepairSafe
+	Repair bool
+	// AllowDestructive lets Repair also fix the issues whose repair is
+	// RepairDestructive, discarding what cannot be read
+	AllowDestructive bool
+	// Collection, if set, is called with every collection file that parses,
+	// after its own repairs, for checks of files kept elsewhere such as
+	// indexes. Its issues, repaired with Fix, are added to the report.
+	Collection func(namespace, collection string, file *CollectionFile) []Issue
+}
+
+// VerifyDataDir audits a data directory and its namespaces without opening
+// them: every collection file must parse with metadata that matches its
+// documents, and documents must satisfy their collection's schema; no
+// temporary, lock or staged file may be left over; a batch journal must
+// parse and the oplog must not be torn. Index files are the index package's
+// and are left to VerifyOptions.Collection.
+//
+// It is meant for a directory no process has open: the temporary files of
+// a write in progress would read as orphans. Repairs replace files
+// atomically. The error is for a directory that cannot be read at all.
+func VerifyDataDir(dir string, opts VerifyOptions) (VerifyReport, error) {
+	report := VerifyReport{Dir: dir}
+	if err := verifyDir(dir, "", opts, &report); err != nil {
+		return report, err
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, NamespaceDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, fmt.Errorf("failed to read namespace directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := verifyDir(filepath.Join(dir, NamespaceDir, entry.Name()), entry.Name(), opts, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// verifier collects the issues of one directory
+type verifier struct {
+	dir       string
+	namespace string
+	opts      VerifyOptions
+	report    *VerifyReport
+}
+
+// verifyDir audits the files of one data directory, not its subdirectories
+func verifyDir(dir, namespace string, opts VerifyOptions, report *VerifyReport) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read data directory: %w", err)
+	}
+	files := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[entry.Name()] = true
+		}
+	}
+
+	v := &verifier{dir: dir, namespace: namespace, opts: opts, report: report}
+	staged := v.verifyJournal(files[journalFileName])
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case entry.IsDir(), strings.HasSuffix(name, indexFileSuffix):
+			// Namespaces are verified separately, index files by the caller
+		case strings.HasSuffix(name, ".tmp"):
+			v.orphan(name, "temporary file of an interrupted write")
+		case strings.HasSuffix(name, stagedFileSuffix):
+			if !staged[name] {
+				v.orphan(name, "staged file of an uncommitted batch")
+			}
+		case strings.HasSuffix(name, ".lock"):
+			if collection := strings.TrimSuffix(name, ".lock"); !files[collection+".json"] {
+				v.orphanLock(name, collection)
+			}
+		case name == oplogFileName:
+			v.verifyOplog(name)
+		case filepath.Ext(name) == ".json":
+			v.verifyCollection(name)
+		}
+	}
+	return nil
+}
+
+// Fix repairs an issue with fix if the options allow its kind of repair,
+// recording the outcome in the issue it returns
+func (o VerifyOptions) Fix(issue Issue, fix func() error) Issue {
+	allowed := issue.Repair == RepairSafe || (issue.Repair == RepairDestructive && o.AllowDestructive)
+	if !o.Repair || !allowed || fix == nil {
+		return issue
+	}
+	if err := fix(); err != nil {
+		issue.RepairErr = err.Error()
+	} else {
+		issue.Repaired = true
+	}
+	return issue
+}
+
+// add records an issue, repairing it with fix if the options allow
+func (v *verifier) add(issue Issue, fix func() error) {
+	issue.Namespace = v.namespace
+	v.report.Issues = append(v.report.Issues, v.opts.Fix(issue, fix))
+}
+
+// orphan records a leftover file, which repair removes
+func (v *verifier) orphan(name, message string) {
+	path := filepath.Join(v.dir, name)
+	v.add(Issue{Severity: SeverityWarning, Kind: IssueOrphanFile, Path: path, Message: message, Repair: RepairSafe}, func() error {
+		return os.Remove(path)
+	})
+}
+
+// orphanLock records the lock file of a collection that does not exist,
+// unless a process holds it
+func (v *verifier) orphanLock(name, collection string) {
+	path := filepath.Join(v.dir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	v.add(Issue{Severity: SeverityWarning, Kind: IssueOrphanFile, Path: path, Collection: collection,
+		Message: "lock file of a collection that does not exist", Repair: RepairSafe}, func() error {
+		return os.Remove(path)
+	})
+}
+
+// verifyJournal checks the batch journal, if any, and returns the staged
+// files it names
+func (v *verifier) verifyJournal(exists bool) map[string]bool {
+	if !exists {
+		return nil
+	}
+	path := filepath.Join(v.dir, journalFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		v.add(Issue{Severity: SeverityError, Kind: IssueCorruptJournal, Path: path, Message: err.Error(), Repair: RepairNone}, nil)
+		return nil
+	}
+
+	var j journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		// Without the journal its staged files are discarded by the next open
+		v.add(Issue{Severity: SeverityError, Kind: IssueCorruptJournal, Path: path,
+			Message: fmt.Sprintf("batch journal does not parse: %v", err), Repair: RepairDestructive}, func() error {
+			return os.Remove(path)
+		})
+		return nil
+	}
+
+	staged := make(map[string]bool, len(j.Replacements))
+	for _, r := range j.Replacements {
+		staged[r.Staged] = true
+	}
+	v.add(Issue{Severity: SeverityInfo, Kind: IssuePendingJournal, Path: path,
+		Message: fmt.Sprintf("interrupted batch of %d collections, completed when the directory is next opened", len(j.Replacements)),
+		Repair:  RepairNone}, nil)
+	return staged
+}
+
+// verifyOplog checks that every entry of the oplog parses. A partly written
+// last entry is dropped by the next EnableOplog anyway, so cutting it is
+// safe; cutting at an unreadable entry before the end loses the entries
+// after it.
+func (v *verifier) verifyOplog(name string) {
+	path := filepath.Join(v.dir, name)
+	file, err := os.Open(path)
+	if err != nil {
+		v.add(Issue{Severity: SeverityError, Kind: IssueCorruptLog, Path: path, Message: err.Error(), Repair: RepairNone}, nil)
+		return
+	}
+	defer file.Close()
+
+	var valid int64
+	line := 0
+	reader := bufio.NewReader(file)
+	for {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(data) > 0 {
+				v.add(Issue{Severity: SeverityWarning, Kind: IssueTornLog, Path: path,
+					Message: fmt.Sprintf("oplog ends with a partly written entry at line %d", line+1), Repair: RepairSafe}, func() error {
+					return os.Truncate(path, valid)
+				})
+			}
+			return
+		}
+		if err != nil {
+			v.add(Issue{Severity: SeverityError, Kind: IssueCorruptLog, Path: path, Message: err.Error(), Repair: RepairNone}, nil)
+			return
+		}
+		line++
+
+		var entry OplogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			v.add(Issue{Severity: SeverityError, Kind: IssueCorruptLog, Path: path,
+				Message: fmt.Sprintf("oplog entry at line %d does not parse, hiding the entries after it: %v", line, err), Repair: RepairDestructive}, func() error {
+				return os.Truncate(path, valid)
+			})
+			return
+		}
+		valid += int64(len(data))
+	}
+}
+
+// verifyCollection checks a collection file and its documents
+func (v *verifier) verifyCollection(name string) {
+	path := filepath.Join(v.dir, name)
+	collection := strings.TrimSuffix(name, ".json")
+	v.report.Collections++
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		v.add(Issue{Severity: SeverityError, Kind: IssueCorruptCollection, Path: path, Collection: collection, Message: err.Error(), Repair: RepairNone}, nil)
+		return
+	}
+	var collFile CollectionFile
+	err = json.Unmarshal(data, &collFile)
+	if err == nil && collFile.Metadata.PreserveKeyOrder {
+		err = decodeKeyOrder(data, &collFile)
+	}
+	if err != nil {
+		v.add(Issue{Severity: SeverityError, Kind: IssueCorruptCollection, Path: path, Collection: collection,
+			Message: fmt.Sprintf("collection file does not parse, moved aside to %s by a destructive repair: %v", name+corruptFileSuffix, err),
+			Repair:  RepairDestructive}, func() error {
+			return os.Rename(path, path+corruptFileSuffix)
+		})
+		return
+	}
+	if collFile.Documents == nil {
+		collFile.Documents = make(map[string]core.Document)
+	}
+	v.report.Documents += len(collFile.Documents)
+
+	if count := collFile.Metadata.DocumentCount; count != len(collFile.Documents) {
+		v.add(Issue{Severity: SeverityWarning, Kind: IssueCountMismatch, Path: path, Collection: collection,
+			Message: fmt.Sprintf("metadata counts %d documents, the file holds %d", count, len(collFile.Documents)),
+			Repair:  RepairSafe}, func() error {
+			enc := getEncoder()
+			defer enc.release()
+			data, err := marshalCollectionFile(enc, &collFile)
+			if err != nil {
+				return err
+			}
+			return fsutil.WriteFileAtomic(path, data)
+		})
+	}
+	v.validateDocuments(path, collection, &collFile)
+
+	if v.opts.Collection != nil {
+		for _, issue := range v.opts.Collection(v.namespace, collection, &collFile) {
+			issue.Namespace = v.namespace
+			v.report.Issues = append(v.report.Issues, issue)
+		}
+	}
+}
+
+// validateDocuments checks the documents of a collection file against its
+// schema, in ID order
+func (v *verifier) validateDocuments(path, collection string, collFile *CollectionFile) {
+	if len(collFile.Metadata.Schema) == 0 {
+		return
+	}
+	s, err := schema.Compile(collFile.Metadata.Schema, collFile.Metadata.SchemaMode)
+	if err != nil {
+		v.add(Issue{Severity: SeverityError, Kind: IssueInvalidSchema, Path: path, Collection: collection, Message: err.Error(), Repair: RepairNone}, nil)
+		return
+	}
+
+	ids := make([]string, 0, len(collFile.Documents))
+	for docID := range collFile.Documents {
+		ids = append(ids, docID)
+	}
+	sort.Strings(ids)
+	for _, docID := range ids {
+		if violations := s.Validate(collFile.Documents[docID]); len(violations) > 0 {
+			err := &schema.ValidationError{Collection: collection, DocID: core.DocumentID(docID), Violations: violations}
+			v.add(Issue{Severity: SeverityError, Kind: IssueInvalidDocument, Path: path, Collection: collection,
+				DocID: core.DocumentID(docID), Message: err.Error(), Repair: RepairNone}, nil)
+		}
+	}
+}
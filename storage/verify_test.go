@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// seedCorruptDir writes a data directory with one issue of every kind
+// VerifyDataDir finds itself, returning the directory
+func seedCorruptDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	for _, coll := range []string{"good", "counted", "typed"} {
+		for _, id := range []core.DocumentID{"d1", "d2"} {
+			if err := engine.WriteDocument(coll, id, core.Document{"n": 1.0}); err != nil {
+				t.Fatalf("Failed to write document: %v", err)
+			}
+		}
+	}
+	ns, err := engine.Namespace("acme")
+	if err != nil {
+		t.Fatalf("Failed to open namespace: %v", err)
+	}
+	if err := ns.WriteDocument("tenant", "d1", core.Document{"n": 1.0}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	engine.Close()
+
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	rewrite := func(name string, edit func(*CollectionFile)) {
+		var collFile CollectionFile
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		if err := json.Unmarshal(data, &collFile); err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		edit(&collFile)
+		data, _ = json.Marshal(collFile)
+		write(name, string(data))
+	}
+
+	write("broken.json", `{"metadata": {"collection": "broken"}, "documents": {`)
+	rewrite("counted.json", func(f *CollectionFile) { f.Metadata.DocumentCount = 5 })
+	rewrite("typed.json", func(f *CollectionFile) {
+		f.Metadata.Schema = json.RawMessage(`{"type": "object", "properties": {"n": {"type": "string"}}}`)
+		f.Documents["d3"] = core.Document{"n": "ok"}
+		f.Metadata.DocumentCount = 3
+	})
+	write("good.json.tmp", "{")
+	write(".health-1.tmp", "")
+	write("gone.lock", "")
+	write("gone.json.staged", "{}")
+	write(oplogFileName, mustReadFile(t, filepath.Join(dir, oplogFileName))+`{"seq": 7, "op"`)
+	write(filepath.Join(NamespaceDir, "acme", journalFileName), "{")
+	return dir
+}
+
+// mustReadFile returns the content of a file
+func mustReadFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+// issueKeys returns the kind, file, document and repair state of each issue, sorted
+func issueKeys(dir string, issues []Issue) []string {
+	keys := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		rel, _ := filepath.Rel(dir, issue.Path)
+		key := string(issue.Severity) + " " + string(issue.Kind) + " " + rel
+		if issue.DocID != "" {
+			key += " " + string(issue.DocID)
+		}
+		if issue.Repaired {
+			key += " repaired"
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestVerifyDataDir(t *testing.T) {
+	dir := seedCorruptDir(t)
+
+	report, err := VerifyDataDir(dir, VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	expected := []string{
+		"error corrupt_collection broken.json",
+		"error corrupt_journal tenants/acme/_batch.journal",
+		"error invalid_document typed.json d1",
+		"error invalid_document typed.json d2",
+		"warning count_mismatch counted.json",
+		"warning orphan_file .health-1.tmp",
+		"warning orphan_file gone.json.staged",
+		"warning orphan_file gone.lock",
+		"warning orphan_file good.json.tmp",
+		"warning torn_log _oplog.jsonl",
+	}
+	if got := issueKeys(dir, report.Issues); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if report.Collections != 5 || report.Documents != 8 {
+		t.Errorf("Expected 5 collections with 8 documents, got %d with %d", report.Collections, report.Documents)
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind == IssueCorruptJournal && issue.Namespace != "acme" {
+			t.Errorf("Expected the journal issue in namespace acme, got %q", issue.Namespace)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "good.json.tmp")); err != nil {
+		t.Errorf("Expected verifying without repair to change nothing, got %v", err)
+	}
+
+	if _, err := VerifyDataDir(filepath.Join(dir, "missing"), VerifyOptions{}); err == nil {
+		t.Errorf("Expected an error for a missing directory")
+	}
+}
+
+func TestVerifyDataDirRepair(t *testing.T) {
+	dir := seedCorruptDir(t)
+
+	// Safe repairs fix counts and leftovers, destructive ones are refused
+	report, err := VerifyDataDir(dir, VerifyOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	for _, issue := range report.Issues {
+		if issue.Repaired != (issue.Repair == RepairSafe) {
+			t.Errorf("Expected only safe repairs, got %+v", issue)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.json")); err != nil {
+		t.Errorf("Expected the corrupt collection left in place, got %v", err)
+	}
+	if n := report.Unrepaired(SeverityError); n != 4 {
+		t.Errorf("Expected 4 errors left, got %d", n)
+	}
+
+	report, _ = VerifyDataDir(dir, VerifyOptions{Repair: true, AllowDestructive: true})
+	expected := []string{
+		"error corrupt_collection broken.json repaired",
+		"error corrupt_journal tenants/acme/_batch.journal repaired",
+		"error invalid_document typed.json d1",
+		"error invalid_document typed.json d2",
+	}
+	if got := issueKeys(dir, report.Issues); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected issues:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.json"+corruptFileSuffix)); err != nil {
+		t.Errorf("Expected the corrupt collection moved aside, got %v", err)
+	}
+
+	// Invalid documents need fixing by hand; everything else is clean and
+	// the directory opens with its data intact
+	report, _ = VerifyDataDir(dir, VerifyOptions{})
+	if len(report.Issues) != 2 {
+		t.Errorf("Expected only the invalid documents left, got %v", issueKeys(dir, report.Issues))
+	}
+	engine, err := NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to open repaired directory: %v", err)
+	}
+	defer engine.Close()
+	if count, _ := engine.CountDocuments("counted"); count != 2 {
+		t.Errorf("Expected 2 documents, got %d", count)
+	}
+	if err := engine.EnableOplog(); err != nil {
+		t.Fatalf("Failed to enable oplog: %v", err)
+	}
+	if entries, _ := engine.ReadOplog(0, 0); len(entries) != 6 {
+		t.Errorf("Expected the 6 whole oplog entries kept, got %d", len(entries))
+	}
+	if invalid, _ := engine.ValidateCollection("typed"); len(invalid) != 2 {
+		t.Errorf("Expected the schema kept, got %d invalid documents", len(invalid))
+	}
+}
+
+func TestVerifyDataDirCorruptLog(t *testing.T) {
+	dir := t.TempDir()
+	entry := `{"seq": 1, "op": 0, "coll": "c", "id": "a"}` + "\n"
+	os.WriteFile(filepath.Join(dir, oplogFileName), []byte(entry+"garbage\n"+entry), 0644)
+
+	report, err := VerifyDataDir(dir, VerifyOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Kind != IssueCorruptLog || report.Issues[0].Repaired {
+		t.Fatalf("Expected an unrepaired corrupt log, got %+v", report.Issues)
+	}
+
+	report, _ = VerifyDataDir(dir, VerifyOptions{Repair: true, AllowDestructive: true})
+	if len(report.Issues) != 1 || !report.Issues[0].Repaired {
+		t.Fatalf("Expected the log repaired, got %+v", report.Issues)
+	}
+	if data := mustReadFile(t, filepath.Join(dir, oplogFileName)); data != entry {
+		t.Errorf("Expected the log cut before the bad entry, got %q", data)
+	}
+}
+
+func TestVerifyDataDirClean(t *testing.T) {
+	engine, dir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, dir)
+
+	if err := engine.SetSchema("users", []byte(`{"type": "object"}`), schema.Strict); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	if err := engine.WriteDocument("users", "u1", core.Document{}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+	if err := engine.SetPreserveKeyOrder("users", true); err != nil {
+		t.Fatalf("Failed to enable key order: %v", err)
+	}
+	if err := engine.WriteOrderedDocument("users", "u2", core.OrderedDocument{}); err != nil {
+		t.Fatalf("Failed to write document: %v", err)
+	}
+
+	// The lock files of existing collections are not orphans, even held
+	report, err := VerifyDataDir(dir, VerifyOptions{Repair: true})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if len(report.Issues) != 0 || report.Collections != 1 || report.Documents != 2 {
+		t.Errorf("Expected a clean report, got %+v", report)
+	}
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWatchBuffer is how many changes a watcher may fall behind unless
+// set in WatchOptions
+const defaultWatchBuffer = 256
+
+// ErrWatcherDropped is reported by a watcher that fell further behind than
+// its buffer and was dropped so writers never wait for it
+var ErrWatcherDropped = errors.New("watcher fell behind and was dropped")
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	// AfterSeq replays the oplog entries of the collection after this
+	// sequence number before live changes, so a watcher can resume where a
+	// previous one stopped. Ignored unless the oplog is enabled.
+	AfterSeq uint64
+
+	// Buffer is how many changes the watcher may fall behind before it is
+	// dropped (default 256)
+	Buffer int
+}
+
+// Watcher receives the changes committed to a collection
+type Watcher struct {
+	// C delivers changes in commit order. Seq is the oplog sequence number,
+	// or zero when the oplog is disabled. C is closed when the watch ends;
+	// Err then tells why.
+	C <-chan OplogEntry
+
+	collection string
+	live       chan OplogEntry // Filled by writers without blocking
+	dropped    atomic.Bool
+	err        error // Set before C is closed
+}
+
+// watchers are the subscriptions of an engine
+type watchers struct {
+	mu     sync.Mutex
+	active atomic.Int32 // Number of subscriptions, read by writers without locking
+	subs   map[*Watcher]struct{}
+	closed bool
+}
+
+// Watch subscribes to the changes committed to a collection, or to every
+// collection if collection is empty, until ctx is done or the engine is
+// closed. A watcher that falls more than opts.Buffer changes behind is
+// dropped with ErrWatcherDropped rather than slowing writers down.
+// Documents are delivered as stored and must not be modified.
+func (e *FileStorageEngine) Watch(ctx context.Context, collection string, opts WatchOptions) (*Watcher, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultWatchBuffer
+	}
+	out := make(chan OplogEntry)
+	w := &Watcher{
+		C:          out,
+		collection: collection,
+		live:       make(chan OplogEntry, opts.Buffer),
+	}
+	if err := e.watchers.add(w); err != nil {
+		return nil, err
+	}
+
+	// The backlog is read after subscribing so no change falls in between;
+	// live changes it already covers are skipped
+	var backlog []OplogEntry
+	if log := e.currentOplog(); log != nil && opts.AfterSeq > 0 {
+		entries, err := log.read(opts.AfterSeq, 0)
+		if err != nil {
+			e.watchers.remove(w)
+			return nil, err
+		}
+		for _, entry := range entries {
+			if w.matches(entry.Collection) {
+				backlog = append(backlog, entry)
+			}
+		}
+	}
+
+	go w.run(ctx, e, out, backlog)
+	return w, nil
+}
+
+// Err returns why the watch ended once C is closed: ErrWatcherDropped, the
+// cause of the watch's context, or nil if the engine was closed
+func (w *Watcher) Err() error {
+	return w.err
+}
+
+// run delivers the backlog and then live changes to out until the watch ends
+func (w *Watcher) run(ctx context.Context, e *FileStorageEngine, out chan<- OplogEntry, backlog []OplogEntry) {
+	defer close(out)
+	defer e.watchers.remove(w)
+
+	var lastSeq uint64
+	for _, entry := range backlog {
+		select {
+		case out <- entry:
+			lastSeq = entry.Seq
+		case <-ctx.Done():
+			w.err = context.Cause(ctx)
+			return
+		}
+	}
+
+	for {
+		select {
+		case entry, ok := <-w.live:
+			if !ok {
+				if w.dropped.Load() {
+					w.err = ErrWatcherDropped
+				}
+				return
+			}
+			if entry.Seq != 0 && entry.Seq <= lastSeq {
+				continue
+			}
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				w.err = context.Cause(ctx)
+				return
+			}
+		case <-ctx.Done():
+			w.err = context.Cause(ctx)
+			return
+		}
+	}
+}
+
+// matches reports whether the watcher follows a collection
+func (w *Watcher) matches(collection string) bool {
+	return w.collection == "" || w.collection == collection
+}
+
+// add subscribes a watcher, failing once the engine is closed
+func (ws *watchers) add(w *Watcher) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return fmt.Errorf("failed to watch: %w", ErrEngineClosed)
+	}
+	if ws.subs == nil {
+		ws.subs = make(map[*Watcher]struct{})
+	}
+	ws.subs[w] = struct{}{}
+	ws.active.Add(1)
+	return nil
+}
+
+// remove unsubscribes a watcher, closing its live channel
+func (ws *watchers) remove(w *Watcher) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.removeLocked(w)
+}
+
+// removeLocked unsubscribes a watcher; callers must hold ws.mu
+func (ws *watchers) removeLocked(w *Watcher) {
+	if _, ok := ws.subs[w]; !ok {
+		return
+	}
+	delete(ws.subs, w)
+	ws.active.Add(-1)
+	close(w.live)
+}
+
+// publish delivers changes of a collection to its watchers without
+// blocking, dropping watchers whose buffer is full. Callers hold the
+// engine's write lock, so changes are published in commit order.
+func (ws *watchers) publish(entries []OplogEntry) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	// Copy documents so later changes by the writer are not seen
+	for i := range entries {
+		entries[i].Document = entries[i].Document.Clone()
+	}
+
+	for w := range ws.subs {
+		for _, entry := range entries {
+			if !w.matches(entry.Collection) {
+				continue
+			}
+			select {
+			case w.live <- entry:
+				continue
+			default:
+			}
+			w.dropped.Store(true)
+			ws.removeLocked(w)
+			break
+		}
+	}
+}
+
+// close ends every watch and refuses new ones
+func (ws *watchers) close() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for w := range ws.subs {
+		ws.removeLocked(w)
+	}
+	ws.closed = true
+}
+
+// changeEntries returns the changes of a collection as unsequenced entries
+// for watchers
+func changeEntries(collection string, changes []change) []OplogEntry {
+	now := time.Now().UTC()
+	entries := make([]OplogEntry, len(changes))
+	for i, c := range changes {
+		entries[i] = OplogEntry{Timestamp: now, Op: c.op, Collection: collection, DocID: c.docID, Document: c.doc}
+	}
+	return entries
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// receive returns the next change of a watcher, failing after a second
+func receive(t *testing.T, w *Watcher) (OplogEntry, bool) {
+	t.Helper()
+	select {
+	case entry, ok := <-w.C:
+		return entry, ok
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for a change")
+		return OplogEntry{}, false
+	}
+}
+
+func TestWatchDeliversChangesInOrder(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	w, err := engine.Watch(context.Background(), "users", WatchOptions{})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada"})
+	engine.WriteDocument("orders", "o1", core.Document{})
+	engine.WriteDocument("users", "u1", core.Document{"name": "Ada Lovelace"})
+	engine.ApplyBatch("users", func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		return map[core.DocumentID]core.Document{"u2": {"name": "Grace"}}, nil
+	})
+	engine.DeleteDocument("users", "u1")
+
+	expected := []struct {
+		op    core.OperationType
+		docID core.DocumentID
+	}{
+		{core.OpInsert, "u1"},
+		{core.OpUpdate, "u1"},
+		{core.OpInsert, "u2"},
+		{core.OpDelete, "u1"},
+	}
+	for _, exp := range expected {
+		entry, _ := receive(t, w)
+		if entry.Op != exp.op || entry.DocID != exp.docID || entry.Collection != "users" || entry.Seq != 0 {
+			t.Errorf("Expected %v of %s, got %+v", exp.op, exp.docID, entry)
+		}
+	}
+}
+
+func TestWatchDropsSlowWatcher(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	w, _ := engine.Watch(context.Background(), "items", WatchOptions{Buffer: 2})
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			engine.WriteDocument("items", core.DocumentID(rune('a'+i)), core.Document{"n": i})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected writers not to wait for a slow watcher")
+	}
+
+	received := 0
+	for range w.C {
+		received++
+	}
+	if !errors.Is(w.Err(), ErrWatcherDropped) {
+		t.Errorf("Expected the watcher to be dropped, got %v", w.Err())
+	}
+	if received == 0 || received >= 10 {
+		t.Errorf("Expected the buffered changes before the drop, got %d", received)
+	}
+	if n := engine.watchers.active.Load(); n != 0 {
+		t.Errorf("Expected no subscriptions left, got %d", n)
+	}
+}
+
+func TestWatchResumesFromOplog(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+	engine.EnableOplog()
+
+	engine.WriteDocument("users", "u1", core.Document{})
+	engine.WriteDocument("orders", "o1", core.Document{})
+	engine.WriteDocument("users", "u2", core.Document{})
+	engine.WriteDocument("users", "u3", core.Document{})
+
+	w, err := engine.Watch(context.Background(), "users", WatchOptions{AfterSeq: 1})
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	engine.WriteDocument("users", "u4", core.Document{})
+
+	for _, exp := range []struct {
+		seq   uint64
+		docID core.DocumentID
+	}{{3, "u2"}, {4, "u3"}, {5, "u4"}} {
+		entry, _ := receive(t, w)
+		if entry.Seq != exp.seq || entry.DocID != exp.docID {
+			t.Errorf("Expected %s at %d, got %+v", exp.docID, exp.seq, entry)
+		}
+	}
+}
+
+func TestWatchEnds(t *testing.T) {
+	engine, tempDir := setupTestEngine(t)
+	defer cleanupTestEngine(engine, tempDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, _ := engine.Watch(ctx, "", WatchOptions{})
+	cancel()
+	if _, ok := receive(t, w); ok {
+		t.Fatalf("Expected the watch to end with its context")
+	}
+	if !errors.Is(w.Err(), context.Canceled) {
+		t.Errorf("Expected the context's error, got %v", w.Err())
+	}
+	if n := engine.watchers.active.Load(); n != 0 {
+		t.Errorf("Expected the subscription to be removed, got %d", n)
+	}
+
+	w, _ = engine.Watch(context.Background(), "", WatchOptions{})
+	engine.Close()
+	if _, ok := receive(t, w); ok || w.Err() != nil {
+		t.Errorf("Expected the watch to end cleanly with the engine, got %v", w.Err())
+	}
+	if _, err := engine.Watch(context.Background(), "", WatchOptions{}); err == nil {
+		t.Errorf("Expected error watching a closed engine")
+	}
+}
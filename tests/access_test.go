@@ -0,0 +1,36 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func TestDBAccessStats(t *testing.T) {
+	database := openDB(t, t.TempDir(), db.WithStorageOptions(storage.WithAccessStats(time.Hour), storage.WithDocumentReadSampling(1, 100)))
+	users, _ := database.Collection("users")
+	if _, err := users.Insert(core.Document{"_id": "ada", "name": "Ada"}); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	// Gets served from the primary index count as reads too
+	for i := 0; i < 3; i++ {
+		if _, err := users.Get("ada"); err != nil {
+			t.Fatalf("Failed to get: %v", err)
+		}
+	}
+	stats, err := database.Storage().AccessStats("users")
+	if err != nil {
+		t.Fatalf("Failed to get access stats: %v", err)
+	}
+	if stats.Reads < 3 || stats.Writes < 1 {
+		t.Errorf("Expected at least 3 reads and a write, got %+v", stats)
+	}
+	top, _ := database.Storage().TopDocuments("users", 1)
+	if len(top) != 1 || top[0].ID != "ada" || top[0].Reads != 3 {
+		t.Errorf("Expected ada read 3 times, got %v", top)
+	}
+}
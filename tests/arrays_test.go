@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+func TestPushToArrayConcurrent(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	feeds, _ := database.Collection("feeds")
+	id, _ := feeds.Insert(core.Document{"owner": "ann"})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := database.PushToArray("feeds", id, "events", fmt.Sprintf("event-%02d", i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Failed to push: %v", err)
+	}
+
+	doc, _ := feeds.Get(id)
+	events, _ := doc["events"].([]interface{})
+	if len(events) != 50 {
+		t.Fatalf("Expected 50 events, got %d", len(events))
+	}
+	got := make([]string, len(events))
+	for i, event := range events {
+		got[i] = event.(string)
+	}
+	sort.Strings(got)
+	for i, event := range got {
+		if expected := fmt.Sprintf("event-%02d", i); event != expected {
+			t.Errorf("Expected %s, got %s", expected, event)
+		}
+	}
+}
+
+func TestArrayOperations(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	posts, _ := database.Collection("posts")
+	id, _ := posts.Insert(core.Document{
+		"title": "hello",
+		"tags":  []interface{}{"go", float64(1)},
+		"meta":  map[string]interface{}{},
+	})
+	field := func(path string) interface{} {
+		doc, _ := posts.Get(id)
+		value, _ := core.GetPath(doc, path)
+		return value
+	}
+
+	if err := database.PushToArray("posts", id, "tags", "db", 2); err != nil {
+		t.Fatalf("Failed to push: %v", err)
+	}
+	if expected := []interface{}{"go", float64(1), "db", float64(2)}; !reflect.DeepEqual(field("tags"), expected) {
+		t.Errorf("Expected %v, got %v", expected, field("tags"))
+	}
+
+	added, err := database.AddToSet("posts", id, "tags", "go", "1", 1, "new", "new")
+	if err != nil {
+		t.Fatalf("Failed to add to set: %v", err)
+	}
+	if added != 2 {
+		t.Errorf("Expected 2 added, got %d", added)
+	}
+	if expected := []interface{}{"go", float64(1), "db", float64(2), "1", "new"}; !reflect.DeepEqual(field("tags"), expected) {
+		t.Errorf("Expected %v, got %v", expected, field("tags"))
+	}
+
+	removed, err := database.PullFromArray("posts", id, "tags", 1)
+	if err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 removed, got %d", removed)
+	}
+	if expected := []interface{}{"go", "db", float64(2), "1", "new"}; !reflect.DeepEqual(field("tags"), expected) {
+		t.Errorf("Expected %v, got %v", expected, field("tags"))
+	}
+
+	// Missing fields are created, objects on the way included
+	if err := database.PushToArray("posts", id, "meta.comments.recent", map[string]interface{}{"by": "ann"}); err != nil {
+		t.Fatalf("Failed to push to a nested field: %v", err)
+	}
+	if expected := []interface{}{map[string]interface{}{"by": "ann"}}; !reflect.DeepEqual(field("meta.comments.recent"), expected) {
+		t.Errorf("Expected %v, got %v", expected, field("meta.comments.recent"))
+	}
+	if removed, _ := database.PullFromArray("posts", id, "meta.comments.recent", map[string]interface{}{"by": "ann"}); removed != 1 {
+		t.Errorf("Expected the object pulled, got %d removed", removed)
+	}
+	if removed, err := database.PullFromArray("posts", id, "missing", "x"); err != nil || removed != 0 || field("missing") != nil {
+		t.Errorf("Expected pulling from a missing field to change nothing, got %d (%v)", removed, err)
+	}
+
+	if err := database.PushToArray("posts", id, "title", "x"); !errors.Is(err, db.ErrNotArray) {
+		t.Errorf("Expected ErrNotArray, got %v", err)
+	}
+	if _, err := database.AddToSet("posts", id, "title.words", "x"); !errors.Is(err, db.ErrNotArray) {
+		t.Errorf("Expected ErrNotArray for a path through a string, got %v", err)
+	}
+	if err := database.PushToArray("posts", "missing", "tags", "x"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestPushToArrayMaxLength(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	feeds, _ := database.Collection("feeds")
+	id, _ := feeds.Insert(core.Document{})
+
+	for i := 1; i <= 5; i++ {
+		if err := database.PushToArrayWithOptions("feeds", id, "recent", []interface{}{i}, db.PushOptions{MaxLength: 3}); err != nil {
+			t.Fatalf("Failed to push: %v", err)
+		}
+	}
+	doc, _ := feeds.Get(id)
+	if expected := []interface{}{float64(3), float64(4), float64(5)}; !reflect.DeepEqual(doc["recent"], expected) {
+		t.Errorf("Expected the last 3 elements %v, got %v", expected, doc["recent"])
+	}
+	if err := database.PushToArrayWithOptions("feeds", id, "recent", nil, db.PushOptions{MaxLength: -1}); err == nil {
+		t.Errorf("Expected an error for a negative max length")
+	}
+}
+
+func TestArrayOperationsUpdateMultikeyIndex(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	posts, _ := database.Collection("posts")
+	if err := database.Indexes().CreateIndexWithOptions("posts", "tags", core.IndexHash, index.IndexOptions{}); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	id, _ := posts.Insert(core.Document{"tags": []interface{}{"go"}})
+
+	if _, err := database.AddToSet("posts", id, "tags", "db"); err != nil {
+		t.Fatalf("Failed to add to set: %v", err)
+	}
+	if _, err := database.PullFromArray("posts", id, "tags", "go"); err != nil {
+		t.Fatalf("Failed to pull: %v", err)
+	}
+
+	for tag, expected := range map[string]int{"db": 1, "go": 0} {
+		ids, err := database.Indexes().LookupSecondaryIDs("posts", "tags", tag)
+		if err != nil {
+			t.Fatalf("Failed to look up %s: %v", tag, err)
+		}
+		if len(ids) != expected {
+			t.Errorf("Expected %d documents tagged %s, got %v", expected, tag, ids)
+		}
+	}
+}
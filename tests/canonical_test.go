@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// exportCanonical returns the canonical export of a collection
+func exportCanonical(t *testing.T, c *db.Collection, opts ...db.ExportOption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := c.ExportCanonical(&buf, opts...); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportCanonical(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	settings, _ := database.Collection("settings")
+	for _, doc := range []core.Document{
+		{"_id": "theme", "value": "dark", "meta": map[string]interface{}{"z": 1, "a": []interface{}{map[string]interface{}{"y": true, "b": nil}}}},
+		{"_id": "banner", "value": "<b>Sale</b> & more", "updated": "2024-03-01T12:30:00+02:00"},
+		{"_id": "limits", "max": 10, "min": 1.5},
+	} {
+		if _, err := settings.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+
+	first := exportCanonical(t, settings)
+	want := `{"_id":"banner","updated":"2024-03-01T10:30:00Z","value":"<b>Sale</b> & more"}
+{"_id":"limits","max":10,"min":1.5}
+{"_id":"theme","meta":{"a":[{"b":null,"y":true}],"z":1},"value":"dark"}
+`
+	if string(first) != want {
+		t.Errorf("Expected canonical export:\n%s\ngot:\n%s", want, first)
+	}
+	for i := 0; i < 5; i++ {
+		if again := exportCanonical(t, settings); !bytes.Equal(again, first) {
+			t.Fatalf("Expected identical exports, got:\n%s\nthen:\n%s", first, again)
+		}
+	}
+
+	// Reimporting the export and exporting again changes nothing
+	copied, _ := database.Collection("copied")
+	if _, err := copied.ImportJSONL(bytes.NewReader(first)); err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if again := exportCanonical(t, copied); !bytes.Equal(again, first) {
+		t.Errorf("Expected the reimported export identical, got:\n%s", again)
+	}
+
+	pretty := exportCanonical(t, settings, db.ExportPretty())
+	if !bytes.HasPrefix(pretty, []byte("{\n  \"_id\": \"banner\",\n")) {
+		t.Errorf("Expected indented documents, got:\n%s", pretty)
+	}
+	if !bytes.Equal(exportCanonical(t, settings, db.ExportPretty()), pretty) {
+		t.Errorf("Expected identical pretty exports")
+	}
+	diff, err := db.DiffCollections(bytes.NewReader(first), bytes.NewReader(pretty))
+	if err != nil || !diff.Empty() {
+		t.Errorf("Expected no difference between the layouts, got %+v and %v", diff, err)
+	}
+}
+
+func TestDiffCollections(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	settings, _ := database.Collection("settings")
+	settings.Insert(core.Document{"_id": "theme", "value": "dark", "meta": map[string]interface{}{"owner": "ops", "rev": 1}})
+	settings.Insert(core.Document{"_id": "limits", "max": 10})
+	settings.Insert(core.Document{"_id": "old", "value": true})
+	before := exportCanonical(t, settings)
+
+	settings.Update("theme", core.Document{"_id": "theme", "value": "dark", "meta": map[string]interface{}{"owner": "ops", "rev": 2}})
+	diff, err := db.DiffCollections(bytes.NewReader(before), bytes.NewReader(exportCanonical(t, settings)))
+	if err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	want := db.CollectionDiff{Changed: []db.DocumentChange{{ID: "theme", Fields: []string{"meta.rev"}}}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected the single field change, got %+v", diff)
+	}
+
+	settings.Delete("old")
+	settings.Insert(core.Document{"_id": "new", "value": 1})
+	settings.Update("limits", core.Document{"_id": "limits", "max": 10.5, "min": 0})
+	diff, err = db.DiffCollections(bytes.NewReader(before), bytes.NewReader(exportCanonical(t, settings)))
+	if err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	want = db.CollectionDiff{
+		Added:   []core.DocumentID{"new"},
+		Removed: []core.DocumentID{"old"},
+		Changed: []db.DocumentChange{{ID: "limits", Fields: []string{"max", "min"}}, {ID: "theme", Fields: []string{"meta.rev"}}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected %+v, got %+v", want, diff)
+	}
+
+	for _, invalid := range []string{`{"_id": "a"} {"_id": "a"}`, `{"name": "no id"}`, `{"_id": "a"`} {
+		if _, err := db.DiffCollections(strings.NewReader(invalid), strings.NewReader("")); err == nil {
+			t.Errorf("Expected an error reading %s", invalid)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// seedUsers inserts n users, every third in the ops team
+func seedUsers(t *testing.T, database *db.DB, n int) *db.Collection {
+	t.Helper()
+	users, _ := database.Collection("users")
+	for i := 0; i < n; i++ {
+		team := "dev"
+		if i%3 == 0 {
+			team = "ops"
+		}
+		doc := core.Document{"_id": fmt.Sprintf("u%02d", i), "team": team, "age": float64(20 + i), "secret": "s"}
+		if _, err := users.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	return users
+}
+
+func TestCloneCollection(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users := seedUsers(t, database, 25)
+	if err := database.Indexes().CreateSecondaryIndex("users", "team", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if err := database.SetSchema("users", []byte(`{"type":"object","required":["team"]}`), schema.Lenient); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	before, _ := users.Find(core.Query{})
+	revision, _ := database.Storage().CollectionRevision("users")
+
+	var progress [][2]int
+	q := &core.Query{Filters: []core.Filter{{Field: "team", Operator: core.OpEqual, Value: "ops"}}}
+	err := database.CloneCollection("users", "sandbox", q, db.CloneDefinitions(), db.CloneBatchSize(4), db.CloneProgress(func(copied, total int) {
+		progress = append(progress, [2]int{copied, total})
+	}))
+	if err != nil {
+		t.Fatalf("Failed to clone: %v", err)
+	}
+
+	// The clone holds exactly the matching documents
+	sandbox, _ := database.Collection("sandbox")
+	expected, _ := users.Find(*q)
+	got, _ := sandbox.Find(core.Query{})
+	if len(expected) != 9 || !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if !reflect.DeepEqual(progress, [][2]int{{4, 9}, {8, 9}, {9, 9}}) {
+		t.Errorf("Expected progress after each batch, got %v", progress)
+	}
+
+	// Definitions came along
+	if ids, _ := database.Indexes().LookupSecondaryIDs("sandbox", "team", "ops"); len(ids) != 9 {
+		t.Errorf("Expected the index to cover the clone, got %v", ids)
+	}
+	if _, err := sandbox.Insert(core.Document{"age": 1.0}); err == nil {
+		t.Errorf("Expected the schema to reject a document without a team")
+	}
+
+	// The source is untouched
+	after, _ := users.Find(core.Query{})
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected the source unchanged")
+	}
+	if current, _ := database.Storage().CollectionRevision("users"); current != revision {
+		t.Errorf("Expected the source not rewritten, got revisions %d and %d", revision, current)
+	}
+}
+
+func TestCloneCollectionProjection(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	seedUsers(t, database, 5)
+
+	q := &core.Query{
+		Filters: []core.Filter{{Field: "age", Operator: core.OpGreaterThanOrEqual, Value: 23.0}},
+		Exclude: []string{"secret"},
+		IDField: "_id",
+	}
+	if err := database.CloneCollection("users", "public", q); err != nil {
+		t.Fatalf("Failed to clone: %v", err)
+	}
+	public, _ := database.Collection("public")
+	docs, _ := public.Find(core.Query{})
+	expected := []core.Document{
+		{"_id": "u03", "team": "ops", "age": 23.0},
+		{"_id": "u04", "team": "dev", "age": 24.0},
+	}
+	if !reflect.DeepEqual(docs, expected) {
+		t.Errorf("Expected %v, got %v", expected, docs)
+	}
+	if ids, _ := database.Indexes().LookupSecondaryIDs("public", "team", "ops"); len(ids) != 0 {
+		t.Errorf("Expected no indexes without CloneDefinitions, got %v", ids)
+	}
+}
+
+func TestCloneCollectionErrors(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	seedUsers(t, database, 3)
+	database.CreateCollection("existing")
+
+	if err := database.CloneCollection("users", "existing", nil); !errors.Is(err, db.ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+	if err := database.CloneCollection("users", "existing", nil, db.CloneOverwrite()); err != nil {
+		t.Fatalf("Failed to clone with overwrite: %v", err)
+	}
+	existing, _ := database.Collection("existing")
+	if count, _ := existing.Count(core.Query{}); count != 3 {
+		t.Errorf("Expected 3 documents after overwrite, got %d", count)
+	}
+
+	tests := []struct {
+		name     string
+		src, dst string
+		q        *core.Query
+	}{
+		{"missing source", "missing", "copy", nil},
+		{"onto itself", "users", "users", nil},
+		{"limit", "users", "copy", &core.Query{Limit: 1}},
+		{"sort", "users", "copy", &core.Query{Sort: &core.SortOption{Field: "age"}}},
+	}
+	for _, tt := range tests {
+		if err := database.CloneCollection(tt.src, tt.dst, tt.q); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if _, err := database.Storage().ReadDocument("copy", "u00"); err == nil {
+		t.Errorf("Expected failed clones to copy nothing")
+	}
+}
+
+func TestCloneCollectionDuringWrites(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	events, _ := database.Collection("events")
+
+	// Events are inserted in order, so a consistent clone holds a prefix
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			events.Insert(core.Document{"_id": fmt.Sprintf("e%03d", i)})
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		dst := fmt.Sprintf("copy%d", i)
+		if err := database.CloneCollection("events", dst, nil, db.CloneBatchSize(7)); err != nil {
+			t.Fatalf("Failed to clone: %v", err)
+		}
+		copied, _ := database.Collection(dst)
+		docs, _ := copied.Find(core.Query{})
+		for j, doc := range docs {
+			if want := fmt.Sprintf("e%03d", j); doc["_id"] != want {
+				t.Fatalf("Expected %s at %d in a consistent clone, got %v", want, j, doc["_id"])
+			}
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,367 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// openDB opens a database in dir and closes it when the test ends
+func openDB(t *testing.T, dir string, opts ...db.Option) *db.DB {
+	t.Helper()
+
+	database, err := db.Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// names returns the "name" field of each document
+func names(docs []core.Document) []string {
+	out := []string{}
+	for _, doc := range docs {
+		out = append(out, doc["name"].(string))
+	}
+	return out
+}
+
+func TestDBWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+
+	users, err := database.Collection("users")
+	if err != nil {
+		t.Fatalf("Failed to get collection: %v", err)
+	}
+	if err := database.Indexes().CreateSecondaryIndex("users", "team", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	seed := []core.Document{
+		{"_id": "u1", "name": "ada", "team": "core", "age": 36},
+		{"_id": "u2", "name": "bob", "team": "web", "age": 28},
+		{"_id": "u3", "name": "cy", "team": "core", "age": 41},
+	}
+	for _, doc := range seed {
+		if _, err := users.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert %v: %v", doc["_id"], err)
+		}
+	}
+	if _, err := users.Insert(core.Document{"_id": "u1", "name": "again"}); !errors.Is(err, core.ErrDocumentExists) {
+		t.Errorf("Expected ErrDocumentExists, got %v", err)
+	}
+
+	doc, err := users.Get("u2")
+	if err != nil || doc["name"] != "bob" {
+		t.Fatalf("Expected bob, got %v (%v)", doc, err)
+	}
+
+	// Find uses the index and sees updates
+	if err := users.Update("u2", core.Document{"name": "bob", "team": "core", "age": 29}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := users.Update("u9", core.Document{"name": "nobody"}); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+	coreTeam := core.Query{
+		Filters: []core.Filter{{Field: "team", Operator: core.OpEqual, Value: "core"}},
+		Sort:    &core.SortOption{Field: "age"},
+	}
+	docs, err := users.Find(coreTeam)
+	if err != nil {
+		t.Fatalf("Failed to find: %v", err)
+	}
+	if got := names(docs); !reflect.DeepEqual(got, []string{"bob", "ada", "cy"}) {
+		t.Errorf("Expected [bob ada cy], got %v", got)
+	}
+
+	if err := users.Delete("u3"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if n, _ := users.Count(coreTeam); n != 2 {
+		t.Errorf("Expected 2 core members, got %d", n)
+	}
+
+	// Everything survives a restart, including the index
+	if err := database.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := users.Get("u1"); !errors.Is(err, db.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	reopened := openDB(t, dir)
+	users, _ = reopened.Collection("users")
+	if n, _ := users.Count(coreTeam); n != 2 {
+		t.Errorf("Expected 2 core members after reopening, got %d", n)
+	}
+	infos, _ := reopened.Indexes().ListIndexes("users")
+	if len(infos) != 1 || infos[0].Fields[0] != "team" {
+		t.Errorf("Expected the team index after reopening, got %+v", infos)
+	}
+	collections, _ := reopened.Collections()
+	if !reflect.DeepEqual(collections, []string{"users"}) {
+		t.Errorf("Expected [users], got %v", collections)
+	}
+}
+
+func TestDBTransactions(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	accounts, _ := database.Collection("accounts")
+	ledger, _ := database.Collection("ledger")
+	accounts.Insert(core.Document{"_id": "a1", "balance": 100})
+
+	tx := database.Begin()
+	tx.Put("accounts", "a1", core.Document{"balance": 70})
+	tx.Put("ledger", "l1", core.Document{"amount": 30})
+	if _, err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if doc, _ := accounts.Get("a1"); doc["balance"] != 70 {
+		t.Errorf("Expected balance 70, got %v", doc)
+	}
+	if _, err := ledger.Get("l1"); err != nil {
+		t.Errorf("Expected the ledger entry: %v", err)
+	}
+}
+
+func TestDBCollections(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir, db.WithAutoCreate(false))
+
+	if _, err := database.Collection("users"); !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	created, err := database.CreateCollection("users")
+	if err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if c, err := database.Collection("users"); err != nil || c != created {
+		t.Errorf("Expected the created handle, got %v (%v)", c, err)
+	}
+
+	for _, name := range []string{"", "..", "a/b", `a\b`} {
+		if _, err := database.CreateCollection(name); err == nil {
+			t.Errorf("Expected error for collection name %q", name)
+		}
+	}
+}
+
+func TestDBDropCollection(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir, db.WithAutoCreate(false))
+	users, _ := database.CreateCollection("users")
+	orders, _ := database.CreateCollection("orders")
+	users.Insert(core.Document{"_id": "ada", "name": "Ada"})
+	if err := database.DeclareReference("orders", "user", "users", core.RefRestrict); err != nil {
+		t.Fatalf("Failed to declare reference: %v", err)
+	}
+	orders.Insert(core.Document{"_id": "o1", "user": "ada"})
+
+	if err := database.DropCollection("users"); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Errorf("Expected ErrReferenceViolation while orders references users, got %v", err)
+	}
+	if err := database.DropCollection("orders"); err != nil {
+		t.Fatalf("Failed to drop collection: %v", err)
+	}
+	if err := database.DropCollection("orders"); !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+	if _, err := database.Collection("orders"); !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected the collection to be gone, got %v", err)
+	}
+	for _, file := range []string{"orders.json", "orders.lock", "orders.idx.json"} {
+		if _, err := os.Stat(filepath.Join(dir, file)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected %s to be removed, got %v", file, err)
+		}
+	}
+
+	// A recreated collection starts empty and without the dropped indexes
+	orders, _ = database.CreateCollection("orders")
+	if n, _ := orders.Count(core.Query{}); n != 0 {
+		t.Errorf("Expected the recreated collection to be empty, got %d documents", n)
+	}
+	if infos, _ := database.Indexes().ListIndexes("orders"); len(infos) != 0 {
+		t.Errorf("Expected no indexes, got %v", infos)
+	}
+}
+
+func TestDBReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	writer := openDB(t, dir)
+	users, _ := writer.Collection("users")
+	users.Insert(core.Document{"_id": "ada", "name": "Ada"})
+
+	reader := openDB(t, dir, db.WithReadOnly())
+	readUsers, err := reader.Collection("users")
+	if err != nil {
+		t.Fatalf("Failed to open collection: %v", err)
+	}
+	if doc, err := readUsers.Get("ada"); err != nil || doc["name"] != "Ada" {
+		t.Errorf("Expected to read Ada, got %v (%v)", doc, err)
+	}
+	if _, err := readUsers.Insert(core.Document{"name": "Bob"}); !errors.Is(err, storage.ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "users.idx.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a read-only close to persist nothing, got %v", err)
+	}
+
+	if _, err := db.Open(filepath.Join(dir, "missing"), db.WithReadOnly()); err == nil {
+		t.Errorf("Expected opening a missing directory read-only to fail")
+	}
+}
+
+func TestDBJSONL(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	users.Insert(core.Document{"_id": "grace", "name": "Grace"})
+	users.Insert(core.Document{"_id": "ada", "name": "Ada", "tags": []interface{}{"math"}})
+
+	var buf bytes.Buffer
+	n, err := users.ExportJSONL(&buf)
+	if err != nil || n != 2 {
+		t.Fatalf("Failed to export: %d, %v", n, err)
+	}
+	expected := `{"_id":"ada","name":"Ada","tags":["math"]}` + "\n" + `{"_id":"grace","name":"Grace"}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, buf.String())
+	}
+
+	copies, _ := database.Collection("copies")
+	input := buf.String() + "\n" + `{"name":"Alan"}` + "\n" + `{"_id":"ada","name":"Ada Lovelace"}`
+	if n, err := copies.ImportJSONL(strings.NewReader(input)); err != nil || n != 4 {
+		t.Fatalf("Failed to import: %d, %v", n, err)
+	}
+	docs, _ := copies.Find(core.Query{})
+	if len(docs) != 3 {
+		t.Errorf("Expected 3 documents, got %v", docs)
+	}
+	if doc, _ := copies.Get("ada"); doc["name"] != "Ada Lovelace" {
+		t.Errorf("Expected the later line to replace ada, got %v", doc)
+	}
+
+	if _, err := copies.ImportJSONL(strings.NewReader("{\"_id\":\"x\"}\n[1]\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected an error on line 2, got %v", err)
+	}
+}
+
+func TestDBGeneratedIDs(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	events, _ := database.Collection("events")
+
+	// ULIDs from sequential inserts sort in insertion order
+	var ids []string
+	for i := 0; i < 50; i++ {
+		id, err := events.Insert(core.Document{"seq": i})
+		if err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+		ids = append(ids, string(id))
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("Expected ULIDs in insertion order, got %v", ids)
+	}
+
+	// The ID round-trips through the document
+	doc, err := events.Get(core.DocumentID(ids[7]))
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if doc["_id"] != ids[7] || doc["seq"] != 7 {
+		t.Errorf("Expected the document to carry its ID, got %v", doc)
+	}
+
+	sorted, _ := events.Find(core.Query{Sort: &core.SortOption{Field: "_id"}, Limit: 3})
+	for i, doc := range sorted {
+		if seq, _ := core.ToFloat64(doc["seq"]); seq != float64(i) {
+			t.Errorf("Expected seq %d at position %d, got %v", i, i, doc["seq"])
+		}
+	}
+}
+
+func TestDBIDOptions(t *testing.T) {
+	next := 0
+	counter := func() core.DocumentID {
+		next++
+		return core.DocumentID(fmt.Sprintf("n%d", next%2)) // Collides every other call
+	}
+	database := openDB(t, t.TempDir(), db.WithIDGenerator(counter), db.WithIDKey("key"))
+	items, _ := database.Collection("items")
+
+	first, err := items.Insert(core.Document{"name": "a"})
+	if err != nil || first != "n1" {
+		t.Fatalf("Expected n1, got %s (%v)", first, err)
+	}
+	second, err := items.Insert(core.Document{"name": "b"})
+	if err != nil || second != "n0" {
+		t.Fatalf("Expected n0, got %s (%v)", second, err)
+	}
+	if doc, _ := items.Get(second); doc["key"] != "n0" {
+		t.Errorf("Expected the ID under the configured key, got %v", doc)
+	}
+
+	// Every candidate is taken now
+	if _, err := items.Insert(core.Document{"name": "c"}); !errors.Is(err, core.ErrIDCollision) {
+		t.Errorf("Expected ErrIDCollision, got %v", err)
+	}
+}
+
+func TestDBSchema(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	users, _ := database.Collection("users")
+	users.Insert(core.Document{"name": 42})
+
+	err := database.SetSchema("users", []byte(`{
+		"type": "object",
+		"required": ["name"],
+		"properties": {"_id": {"type": "string"}, "name": {"type": "string"}}
+	}`), schema.Strict)
+	if err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+
+	if _, err := users.Insert(core.Document{"name": "Ada"}); err != nil {
+		t.Errorf("Failed to insert valid document: %v", err)
+	}
+	_, err = users.Insert(core.Document{"name": "Bob", "age": 3})
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) || verr.Violations[0].Path != "age" || verr.Violations[0].Rule != "additionalProperties" {
+		t.Errorf("Expected an additionalProperties violation at age, got %v", err)
+	}
+
+	// Commits are validated too, and the schema survives a restart
+	database.Close()
+	database = openDB(t, dir)
+	tx := database.Begin()
+	tx.Put("users", "u9", core.Document{"_id": "u9"})
+	if _, err := tx.Commit(); !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Errorf("Expected ErrSchemaValidation from commit, got %v", err)
+	}
+
+	invalid, err := database.ValidateCollection("users")
+	if err != nil {
+		t.Fatalf("Failed to validate collection: %v", err)
+	}
+	if len(invalid) != 1 || invalid[0].Violations[0].Path != "name" {
+		t.Errorf("Expected the document stored before the schema to be reported, got %v", invalid)
+	}
+}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 32)
+)
+
+// rawDocument reads a document as stored, bypassing decryption
+func rawDocument(t *testing.T, database *db.DB, collection string, id core.DocumentID) core.Document {
+	t.Helper()
+	docs, err := database.Executor().Execute(core.Query{
+		Collection: collection,
+		Filters:    []core.Filter{{Field: core.DocumentIDField, Operator: core.OpEqual, Value: string(id)}},
+	})
+	if err != nil || len(docs) != 1 {
+		t.Fatalf("Failed to read raw document %s: %v", id, err)
+	}
+	return docs[0]
+}
+
+func TestEncryptFields(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	users, _ := database.Collection("users")
+
+	if err := database.EncryptFields("users", []string{"ssn", "contact.email"}, []byte("short")); err == nil {
+		t.Errorf("Expected error for an invalid key")
+	}
+	if err := database.EncryptFields("users", []string{"ssn", "contact.email"}, oldKey); err != nil {
+		t.Fatalf("Failed to encrypt fields: %v", err)
+	}
+
+	in := core.Document{
+		"_id":     "u1",
+		"name":    "Ada",
+		"ssn":     "123-45-6789",
+		"contact": map[string]interface{}{"email": "ada@example.com", "phone": "555"},
+	}
+	if _, err := users.Insert(in); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	raw := rawDocument(t, database, "users", "u1")
+	ssn, _ := raw["ssn"].(map[string]interface{})
+	if _, ok := ssn["$enc"].(string); !ok || raw["name"] != "Ada" {
+		t.Errorf("Expected ssn to be stored encrypted and name in plaintext, got %v", raw)
+	}
+	if contact := raw["contact"].(map[string]interface{}); contact["phone"] != "555" || contact["email"] == "ada@example.com" {
+		t.Errorf("Expected only contact.email to be encrypted, got %v", contact)
+	}
+
+	doc, err := users.Get("u1")
+	if err != nil || doc["ssn"] != "123-45-6789" || doc["contact"].(map[string]interface{})["email"] != "ada@example.com" {
+		t.Errorf("Expected decrypted fields, got %v (%v)", doc, err)
+	}
+	found, err := users.Find(core.Query{Filters: []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "Ada"}}})
+	if err != nil || len(found) != 1 || found[0]["ssn"] != "123-45-6789" {
+		t.Errorf("Expected Find to filter on plaintext fields and decrypt, got %v (%v)", found, err)
+	}
+
+	for _, q := range []core.Query{
+		{Filters: []core.Filter{{Field: "ssn", Operator: core.OpEqual, Value: "123-45-6789"}}},
+		{Sort: &core.SortOption{Field: "contact.email"}},
+	} {
+		if _, err := users.Find(q); !errors.Is(err, db.ErrEncryptedField) {
+			t.Errorf("Expected ErrEncryptedField, got %v", err)
+		}
+	}
+
+	// Without the key reads return the wrapper, and only wrapped values
+	// can be written back
+	database.Close()
+	database = openDB(t, dir)
+	users, _ = database.Collection("users")
+
+	doc, _ = users.Get("u1")
+	if _, ok := doc["ssn"].(map[string]interface{}); !ok {
+		t.Errorf("Expected the wrapped ssn without a key, got %v", doc["ssn"])
+	}
+	doc["name"] = "Ada Lovelace"
+	if err := users.Update("u1", doc); err != nil {
+		t.Errorf("Failed to write back wrapped values: %v", err)
+	}
+	if _, err := users.Insert(core.Document{"ssn": "000"}); !errors.Is(err, db.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey writing plaintext without a key, got %v", err)
+	}
+
+	database.EncryptFields("users", []string{"ssn", "contact.email"}, newKey)
+	if _, err := users.Get("u1"); !errors.Is(err, db.ErrEncryptionKey) {
+		t.Errorf("Expected ErrEncryptionKey with the wrong key, got %v", err)
+	}
+}
+
+func TestReencryptCollection(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	users.Insert(core.Document{"_id": "plain", "ssn": "111"})
+
+	database.EncryptFields("users", []string{"ssn"}, oldKey)
+	users.Insert(core.Document{"_id": "sealed", "ssn": "222"})
+
+	// A nil old key cannot decrypt the sealed document, so nothing changes
+	if err := database.ReencryptCollection("users", nil, newKey); !errors.Is(err, db.ErrEncryptionKey) {
+		t.Fatalf("Expected ErrEncryptionKey, got %v", err)
+	}
+	if doc := rawDocument(t, database, "users", "plain"); doc["ssn"] != "111" {
+		t.Errorf("Expected the failed rotation to change nothing, got %v", doc)
+	}
+
+	if err := database.ReencryptCollection("users", oldKey, newKey); err != nil {
+		t.Fatalf("Failed to re-encrypt collection: %v", err)
+	}
+	for id, ssn := range map[core.DocumentID]string{"plain": "111", "sealed": "222"} {
+		if raw := rawDocument(t, database, "users", id); raw["ssn"] == ssn {
+			t.Errorf("Expected %s to be encrypted, got %v", id, raw)
+		}
+		if doc, err := users.Get(id); err != nil || doc["ssn"] != ssn {
+			t.Errorf("Expected %s to decrypt with the new key, got %v (%v)", id, doc, err)
+		}
+	}
+
+	database.EncryptFields("users", []string{"ssn"}, oldKey)
+	if _, err := users.Get("sealed"); !errors.Is(err, db.ErrEncryptionKey) {
+		t.Errorf("Expected the old key to fail after rotation, got %v", err)
+	}
+}
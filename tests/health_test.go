@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// healthCheck returns the named check of a report
+func healthCheck(t *testing.T, report db.HealthReport, name string) db.HealthCheck {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("Expected a %s check, got %+v", name, report.Checks)
+	return db.HealthCheck{}
+}
+
+// health runs the health checks, failing the test if they cannot run
+func health(t *testing.T, database *db.DB, opts ...db.HealthOption) db.HealthReport {
+	t.Helper()
+	report, err := database.Health(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("Failed to check health: %v", err)
+	}
+	return report
+}
+
+// healthyDB opens a database with a few collections, their indexes
+// persisted
+func healthyDB(t *testing.T, dir string) *db.DB {
+	t.Helper()
+	database := openDB(t, dir)
+	for _, name := range []string{"users", "orders", "events"} {
+		c, err := database.CreateCollection(name)
+		if err != nil {
+			t.Fatalf("Failed to create collection: %v", err)
+		}
+		c.Insert(core.Document{"name": name})
+		if err := database.Indexes().PersistIndexes(name); err != nil {
+			t.Fatalf("Failed to persist indexes: %v", err)
+		}
+	}
+	return database
+}
+
+func TestHealthOK(t *testing.T) {
+	database := healthyDB(t, t.TempDir())
+
+	report := health(t, database, db.HealthMinFreeSpace(1))
+	if report.Status != db.HealthOK || report.CheckedAt.IsZero() {
+		t.Fatalf("Expected a healthy report, got %+v", report)
+	}
+	for _, name := range []string{"data_dir_writable", "collections", "indexes", "disk_space"} {
+		if check := healthCheck(t, report, name); check.Status != db.HealthOK || check.Error != "" {
+			t.Errorf("Expected %s to pass, got %+v", name, check)
+		}
+	}
+	if check := healthCheck(t, report, "collections"); check.Detail != "3 checked" {
+		t.Errorf("Expected every collection checked, got %q", check.Detail)
+	}
+	if check := healthCheck(t, health(t, database, db.HealthSample(1)), "collections"); check.Detail != "1 checked" {
+		t.Errorf("Expected a sample of 1, got %q", check.Detail)
+	}
+	if check := healthCheck(t, health(t, database, db.HealthSample(1), db.HealthFull()), "collections"); check.Detail != "3 checked" {
+		t.Errorf("Expected the full mode to check everything, got %q", check.Detail)
+	}
+
+	// The probe leaves nothing behind
+	entries, _ := os.ReadDir(database.Storage().Dir())
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".health") {
+			t.Errorf("Expected the probe file to be removed, found %s", entry.Name())
+		}
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	checks, _ := decoded["checks"].([]interface{})
+	first, _ := checks[0].(map[string]interface{})
+	if decoded["status"] != "ok" || first["name"] != "data_dir_writable" || first["status"] != "ok" || first["latency_ns"] == nil {
+		t.Errorf("Expected per-check status and latency in JSON, got %s", data)
+	}
+}
+
+func TestHealthCorruptCollection(t *testing.T) {
+	dir := t.TempDir()
+	database := healthyDB(t, dir)
+
+	if err := os.WriteFile(filepath.Join(dir, "orders.json"), []byte(`{"metadata": {`), 0644); err != nil {
+		t.Fatalf("Failed to corrupt collection: %v", err)
+	}
+	report := health(t, database, db.HealthFull(), db.HealthMinFreeSpace(1))
+	if report.Status != db.HealthDegraded {
+		t.Fatalf("Expected a degraded report, got %+v", report)
+	}
+	if check := healthCheck(t, report, "collections"); check.Status != db.HealthFailed || !strings.Contains(check.Error, "orders") {
+		t.Errorf("Expected the orders collection to fail, got %+v", check)
+	}
+	if check := healthCheck(t, report, "data_dir_writable"); check.Status != db.HealthOK {
+		t.Errorf("Expected the other checks to pass, got %+v", check)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "users.idx.json"), []byte(`{"checksum": "bad"}`), 0644); err != nil {
+		t.Fatalf("Failed to corrupt index: %v", err)
+	}
+	report = health(t, database, db.HealthFull(), db.HealthMinFreeSpace(1))
+	if check := healthCheck(t, report, "indexes"); check.Status != db.HealthFailed || !strings.Contains(check.Error, "users") {
+		t.Errorf("Expected the users index file to fail, got %+v", check)
+	}
+}
+
+func TestHealthReadOnlyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	database := healthyDB(t, dir)
+
+	os.Chmod(dir, 0555)
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+	if os.WriteFile(filepath.Join(dir, "probe"), nil, 0644) == nil {
+		// Permissions do not bind root, so take the directory away instead
+		os.Remove(filepath.Join(dir, "probe"))
+		os.Chmod(dir, 0755)
+		moved := dir + ".moved"
+		if err := os.Rename(dir, moved); err != nil {
+			t.Fatalf("Failed to move data directory: %v", err)
+		}
+		t.Cleanup(func() { os.Rename(moved, dir) })
+	}
+
+	report := health(t, database, db.HealthMinFreeSpace(0))
+	if report.Status != db.HealthDegraded {
+		t.Fatalf("Expected a degraded report, got %+v", report)
+	}
+	if check := healthCheck(t, report, "data_dir_writable"); check.Status != db.HealthFailed || check.Error == "" {
+		t.Errorf("Expected the directory to be reported unwritable, got %+v", check)
+	}
+}
+
+func TestHealthReadOnlyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	healthyDB(t, dir).Close()
+	database := openDB(t, dir, db.WithReadOnly())
+
+	report := health(t, database, db.HealthMinFreeSpace(1))
+	if check := healthCheck(t, report, "data_dir_writable"); check.Status != db.HealthSkipped || report.Status != db.HealthOK {
+		t.Errorf("Expected writability to be skipped for a read-only database, got %+v", report)
+	}
+}
+
+func TestHealthDiskSpaceAndRegisteredChecks(t *testing.T) {
+	database := healthyDB(t, t.TempDir())
+
+	report := health(t, database, db.HealthMinFreeSpace(math.MaxUint64))
+	if check := healthCheck(t, report, "disk_space"); check.Status != db.HealthFailed || report.Status != db.HealthDegraded {
+		t.Errorf("Expected the disk check to fail below the threshold, got %+v", check)
+	}
+
+	alive := true
+	unregister := database.RegisterHealthCheck("purger", func(ctx context.Context) error {
+		if !alive {
+			return errors.New("purger stopped")
+		}
+		return nil
+	})
+	if check := healthCheck(t, health(t, database, db.HealthMinFreeSpace(1)), "purger"); check.Status != db.HealthOK {
+		t.Errorf("Expected the registered check to pass, got %+v", check)
+	}
+	alive = false
+	report = health(t, database, db.HealthMinFreeSpace(1))
+	if check := healthCheck(t, report, "purger"); check.Status != db.HealthFailed || check.Error != "purger stopped" || report.Status != db.HealthDegraded {
+		t.Errorf("Expected the registered check to fail, got %+v", check)
+	}
+
+	// Unregistered checks no longer run, and stopped tasks remove theirs
+	unregister()
+	unregister()
+	stop := database.StartTTLPurge(time.Hour)
+	healthCheck(t, health(t, database, db.HealthMinFreeSpace(1)), "ttl_purge")
+	stop()
+	report = health(t, database, db.HealthMinFreeSpace(1))
+	for _, check := range report.Checks {
+		if check.Name == "purger" || check.Name == "ttl_purge" {
+			t.Errorf("Expected the %s check removed, got %+v", check.Name, report.Checks)
+		}
+	}
+	if report.Status != db.HealthOK {
+		t.Errorf("Expected a healthy report once the failing check is removed, got %+v", report)
+	}
+
+	database.Close()
+	if _, err := database.Health(context.Background()); !errors.Is(err, db.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func TestFindAsOf(t *testing.T) {
+	database := openDB(t, t.TempDir(), db.WithOplog())
+	orders, _ := database.Collection("orders")
+
+	// Ten revisions of an order, each at a moment recorded after it
+	var moments []time.Time
+	for rev := 1; rev <= 10; rev++ {
+		status := "open"
+		if rev > 5 {
+			status = "shipped"
+		}
+		doc := core.Document{"_id": "o1", "rev": float64(rev), "status": status}
+		var err error
+		if rev == 1 {
+			_, err = orders.Insert(doc)
+		} else {
+			err = orders.Update("o1", doc)
+		}
+		if err != nil {
+			t.Fatalf("Failed to write revision %d: %v", rev, err)
+		}
+		moments = append(moments, time.Now())
+	}
+	orders.Insert(core.Document{"_id": "o2", "status": "open"})
+
+	for i, at := range moments {
+		doc, err := orders.GetAsOf("o1", at)
+		if err != nil {
+			t.Fatalf("Failed to get revision %d: %v", i+1, err)
+		}
+		if doc["rev"] != float64(i+1) {
+			t.Errorf("Expected revision %d, got %v", i+1, doc["rev"])
+		}
+	}
+
+	open := core.Query{Filters: []core.Filter{{Field: "status", Operator: core.OpEqual, Value: "open"}}}
+	tests := []struct {
+		at       time.Time
+		expected int
+	}{
+		{moments[4], 1}, // o1 still open, o2 not yet inserted
+		{moments[5], 0}, // o1 shipped
+		{time.Now(), 1}, // o2
+	}
+	for _, tt := range tests {
+		docs, err := orders.FindAsOf(open, tt.at)
+		if err != nil {
+			t.Fatalf("Failed to query as of %v: %v", tt.at, err)
+		}
+		if len(docs) != tt.expected {
+			t.Errorf("Expected %d open orders as of %v, got %v", tt.expected, tt.at, docs)
+		}
+	}
+
+	if _, err := orders.GetAsOf("o1", moments[0].Add(-time.Hour)); !errors.Is(err, storage.ErrHistoryUnavailable) {
+		t.Errorf("Expected ErrHistoryUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestBeforeWriteHooks(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+
+	var order []string
+	database.OnBeforeWrite("users", func(ctx context.Context, id core.DocumentID, doc core.Document) (core.Document, error) {
+		order = append(order, "first")
+		doc["slug"] = fmt.Sprintf("%v", doc["name"])
+		return nil, nil
+	})
+	database.OnBeforeWrite("users", func(ctx context.Context, id core.DocumentID, doc core.Document) (core.Document, error) {
+		order = append(order, "second")
+		if doc["name"] == "" {
+			return nil, errors.New("name is required")
+		}
+		enriched := doc.Clone()
+		enriched["slug"] = fmt.Sprintf("%v-%s", doc["slug"], id)
+		return enriched, nil
+	})
+
+	id, err := users.Insert(core.Document{"_id": "u1", "name": "ada"})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if doc, _ := users.Get(id); doc["slug"] != "ada-u1" {
+		t.Errorf("Expected the hooks' slug, got %v", doc)
+	}
+	if !reflect.DeepEqual(order, []string{"first", "second"}) {
+		t.Errorf("Expected hooks in registration order, got %v", order)
+	}
+
+	// A veto aborts the write
+	if err := users.Update("u1", core.Document{"name": ""}); err == nil {
+		t.Fatalf("Expected the update to be vetoed")
+	}
+	if doc, _ := users.Get("u1"); doc["name"] != "ada" {
+		t.Errorf("Expected the vetoed update not to be stored, got %v", doc)
+	}
+
+	// Deletes have their own veto
+	database.OnBeforeDelete("users", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		if doc["name"] == "ada" {
+			return errors.New("ada stays")
+		}
+		return nil
+	})
+	if err := users.Delete("u1"); err == nil {
+		t.Errorf("Expected the delete to be vetoed")
+	}
+	if _, err := users.Get("u1"); err != nil {
+		t.Errorf("Expected u1 to survive the vetoed delete: %v", err)
+	}
+}
+
+func TestAfterHooksKeepCollectionsInSync(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	posts, _ := database.Collection("posts")
+	audit, _ := database.Collection("audit")
+	stats, _ := database.Collection("stats")
+	stats.Insert(core.Document{"_id": "posts", "count": 0})
+
+	count := func(delta int) error {
+		doc, err := stats.Get("posts")
+		if err != nil {
+			return err
+		}
+		n, _ := core.ToFloat64(doc["count"])
+		doc["count"] = int(n) + delta
+		return stats.Update("posts", doc)
+	}
+
+	var seen []string
+	database.OnAfterWrite("posts", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		seen = append(seen, "write "+string(id))
+		_, err := audit.Insert(core.Document{"op": "write", "post": string(id)})
+		return err
+	})
+	database.OnAfterWrite("posts", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		if doc["_id"] == "p1" && doc["title"] == "Hello" {
+			return count(1)
+		}
+		return nil
+	})
+	database.OnAfterDelete("posts", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		seen = append(seen, "delete "+string(id)+" "+doc["title"].(string))
+		return count(-1)
+	})
+
+	posts.Insert(core.Document{"_id": "p1", "title": "Hello"})
+	if doc, _ := stats.Get("posts"); fmt.Sprint(doc["count"]) != "1" {
+		t.Errorf("Expected count 1 after insert, got %v", doc["count"])
+	}
+	posts.Update("p1", core.Document{"_id": "p1", "title": "Hello again"})
+	posts.Delete("p1")
+	if err := posts.Delete("p1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+
+	expected := []string{"write p1", "write p1", "delete p1 Hello again"}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Expected hooks %v, got %v", expected, seen)
+	}
+	doc, _ := stats.Get("posts")
+	if n, _ := core.ToFloat64(doc["count"]); n != 0 {
+		t.Errorf("Expected count 0, got %v", doc["count"])
+	}
+	if n, _ := audit.Count(core.Query{}); n != 2 {
+		t.Errorf("Expected 2 audit entries, got %d", n)
+	}
+	if errs := database.HookErrors(); len(errs) != 0 {
+		t.Errorf("Expected no hook errors, got %v", errs)
+	}
+}
+
+func TestAfterHookOrderMatchesWrites(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	log, _ := database.Collection("log")
+
+	var mu sync.Mutex
+	var seen []core.DocumentID
+	database.OnAfterWrite("log", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, id)
+		return nil
+	})
+
+	// ULIDs are monotonic and generated under the write lock, so commit
+	// order is ID order
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				log.Insert(core.Document{"j": j})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != 100 {
+		t.Fatalf("Expected 100 hook calls, got %d", len(seen))
+	}
+	for i := 1; i < len(seen); i++ {
+		if seen[i-1] >= seen[i] {
+			t.Fatalf("Expected hooks in commit order, got %s before %s", seen[i-1], seen[i])
+		}
+	}
+}
+
+func TestPanickingHooks(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	database.Indexes().CreateSecondaryIndex("users", "email", core.IndexHash)
+
+	database.OnBeforeWrite("users", func(ctx context.Context, id core.DocumentID, doc core.Document) (core.Document, error) {
+		if doc["email"] == "boom@example.com" {
+			panic("bad email")
+		}
+		return nil, nil
+	})
+	database.OnAfterWrite("users", func(ctx context.Context, id core.DocumentID, doc core.Document) error {
+		if doc["email"] == "late@example.com" {
+			panic("after the fact")
+		}
+		return nil
+	})
+
+	_, err := users.Insert(core.Document{"_id": "u1", "email": "boom@example.com"})
+	if !errors.Is(err, db.ErrHookPanic) {
+		t.Fatalf("Expected ErrHookPanic, got %v", err)
+	}
+	if _, err := users.Get("u1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected nothing stored, got %v", err)
+	}
+
+	// The engine and its indexes are still usable and consistent
+	if _, err := users.Insert(core.Document{"_id": "u1", "email": "late@example.com"}); err != nil {
+		t.Fatalf("Failed to insert after a panic: %v", err)
+	}
+	found, err := users.Find(core.Query{Filters: []core.Filter{{Field: "email", Operator: core.OpEqual, Value: "late@example.com"}}})
+	if err != nil || len(found) != 1 {
+		t.Errorf("Expected the indexed document, got %v (%v)", found, err)
+	}
+
+	errs := database.HookErrors()
+	if len(errs) != 1 || !errors.Is(errs[0], db.ErrHookPanic) {
+		t.Errorf("Expected the after-hook panic to be reported, got %v", errs)
+	}
+	if errs := database.HookErrors(); len(errs) != 0 {
+		t.Errorf("Expected HookErrors to be drained, got %v", errs)
+	}
+}
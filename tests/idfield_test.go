@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func TestIDField(t *testing.T) {
+	database := openDB(t, t.TempDir(), db.WithIDField("id"))
+	users, _ := database.Collection("users")
+	database.Indexes().CreateSecondaryIndex("users", "id", core.IndexHash)
+
+	id, err := users.Insert(core.Document{"id": "ada", "name": "Ada"})
+	if err != nil || id != "ada" {
+		t.Fatalf("Failed to insert under the ID field, got %q: %v", id, err)
+	}
+	generated, err := users.Insert(core.Document{"name": "Grace"})
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if err := users.Update("ada", core.Document{"name": "Ada Lovelace"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := users.Update("ada", core.Document{"id": "grace"}); !errors.Is(err, storage.ErrIDMismatch) {
+		t.Errorf("Expected a conflicting ID rejected with ErrIDMismatch, got %v", err)
+	}
+
+	// Documents carry their IDs, including in the indexes
+	for _, id := range []core.DocumentID{"ada", generated} {
+		doc, err := users.Get(id)
+		if err != nil || doc["id"] != string(id) {
+			t.Errorf("Expected %s to hold its ID, got %v, %v", id, doc, err)
+		}
+		ids, _ := database.Indexes().LookupSecondaryIDs("users", "id", string(id))
+		if !reflect.DeepEqual(ids, []core.DocumentID{id}) {
+			t.Errorf("Expected the index to find %s by its ID field, got %v", id, ids)
+		}
+	}
+
+	// Export and import round-trip the IDs
+	var buf bytes.Buffer
+	if _, err := users.ExportJSONL(&buf); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	other := openDB(t, t.TempDir(), db.WithIDField("id"))
+	copied, _ := other.Collection("users")
+	if n, err := copied.ImportJSONL(&buf); err != nil || n != 2 {
+		t.Fatalf("Failed to import 2 documents, got %d: %v", n, err)
+	}
+	for _, id := range []core.DocumentID{"ada", generated} {
+		original, _ := users.Get(id)
+		imported, err := copied.Get(id)
+		if err != nil || !reflect.DeepEqual(original, imported) {
+			t.Errorf("Expected %s to round-trip, got %v, %v", id, imported, err)
+		}
+	}
+}
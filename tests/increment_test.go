@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestIncrementFieldConcurrent(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	pages, _ := database.Collection("pages")
+	id, err := pages.Insert(core.Document{"title": "home"})
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := database.IncrementField("pages", id, "views", 1); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Failed to increment: %v", err)
+	}
+
+	doc, err := pages.Get(id)
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if doc["views"] != float64(100) {
+		t.Errorf("Expected 100 views, got %v", doc["views"])
+	}
+}
+
+func TestIncrementField(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	pages, _ := database.Collection("pages")
+	id, _ := pages.Insert(core.Document{
+		"views": float64(5),
+		"title": "home",
+		"stats": map[string]interface{}{"likes": float64(2)},
+		"tags":  []interface{}{"a"},
+		"gone":  nil,
+	})
+
+	tests := []struct {
+		name     string
+		field    string
+		delta    float64
+		expected float64
+		err      error
+	}{
+		{"existing", "views", 2, 7, nil},
+		{"fractional", "views", 0.5, 7.5, nil},
+		{"missing", "shares", 3, 3, nil},
+		{"nested", "stats.likes", 1, 3, nil},
+		{"missing nested", "stats.daily.visits", 4, 4, nil},
+		{"missing parent", "totals.all", 1, 1, nil},
+		{"string", "title", 1, 0, db.ErrNotNumeric},
+		{"array", "tags", 1, 0, db.ErrNotNumeric},
+		{"null", "gone", 1, 0, db.ErrNotNumeric},
+		{"through a string", "title.length", 1, 0, db.ErrNotNumeric},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := database.IncrementField("pages", id, tt.field, tt.delta)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to increment %s: %v", tt.field, err)
+			}
+			if value != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, value)
+			}
+			doc, _ := pages.Get(id)
+			if stored, _ := core.GetPath(doc, tt.field); stored != tt.expected {
+				t.Errorf("Expected %v stored, got %v", tt.expected, stored)
+			}
+		})
+	}
+
+	doc, _ := pages.Get(id)
+	if doc["title"] != "home" || !reflect.DeepEqual(doc["tags"], []interface{}{"a"}) {
+		t.Errorf("Expected failed increments to leave the document alone, got %v", doc)
+	}
+
+	if value, err := database.DecrementField("pages", id, "views", 2.5); err != nil || value != 5 {
+		t.Errorf("Expected 5 after decrementing, got %v (%v)", value, err)
+	}
+	if _, err := database.IncrementField("pages", "missing", "views", 1); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestIncrementFields(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	posts, _ := database.Collection("posts")
+	id, _ := posts.Insert(core.Document{"views": float64(10), "title": "hello"})
+
+	values, err := database.IncrementFields("posts", id, map[string]float64{"views": 1, "stats.shares": 2, "score": -1.5})
+	if err != nil {
+		t.Fatalf("Failed to increment fields: %v", err)
+	}
+	expected := map[string]float64{"views": 11, "stats.shares": 2, "score": -1.5}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	// One field that fails leaves every field as it was
+	if _, err := database.IncrementFields("posts", id, map[string]float64{"views": 1, "title": 1}); !errors.Is(err, db.ErrNotNumeric) {
+		t.Fatalf("Expected ErrNotNumeric, got %v", err)
+	}
+	doc, _ := posts.Get(id)
+	if doc["views"] != float64(11) {
+		t.Errorf("Expected views to stay 11, got %v", doc["views"])
+	}
+}
+
+func TestIncrementEncryptedField(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	if err := database.EncryptFields("users", []string{"balance"}, oldKey); err != nil {
+		t.Fatalf("Failed to encrypt fields: %v", err)
+	}
+	id, _ := users.Insert(core.Document{"balance": float64(10)})
+
+	if _, err := database.IncrementField("users", id, "balance", 1); !errors.Is(err, db.ErrEncryptedField) {
+		t.Errorf("Expected ErrEncryptedField, got %v", err)
+	}
+}
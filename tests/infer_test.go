@@ -0,0 +1,58 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+func TestDBInferSchema(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	events, _ := database.Collection("events")
+	for i := 0; i < 50; i++ {
+		doc := core.Document{"n": i}
+		if i%2 == 0 {
+			doc["note"] = fmt.Sprint(i)
+		}
+		if _, err := events.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+
+	report, err := database.InferSchema("events", 0)
+	if err != nil {
+		t.Fatalf("Failed to infer schema: %v", err)
+	}
+	presence := make(map[string]float64)
+	for _, f := range report.Fields {
+		presence[f.Path] = f.Presence
+	}
+	if report.Documents != 50 || presence["n"] != 100 || presence["note"] != 50 {
+		t.Errorf("Expected n in every document and note in half, got %v from %d documents", presence, report.Documents)
+	}
+
+	sampled, err := database.InferSchema("events", 10)
+	if err != nil || sampled.Documents != 10 || sampled.Total != 50 {
+		t.Errorf("Expected a sample of 10 of 50 documents, got %d of %d, %v", sampled.Documents, sampled.Total, err)
+	}
+
+	// The draft is accepted as the collection's schema
+	draft, err := report.Draft()
+	if err != nil {
+		t.Fatalf("Failed to draft schema: %v", err)
+	}
+	if err := database.SetSchema("events", draft, schema.Lenient); err != nil {
+		t.Fatalf("Failed to set drafted schema: %v", err)
+	}
+	if _, err := events.Insert(core.Document{"note": "no n"}); !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Errorf("Expected the draft to require n, got %v", err)
+	}
+
+	if _, err := database.InferSchema("missing", 0); !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+}
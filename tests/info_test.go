@@ -0,0 +1,121 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// keys returns the sorted keys of a JSON object
+func keys(v interface{}) []string {
+	m, _ := v.(map[string]interface{})
+	out := []string{}
+	for key := range m {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestInfo(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir, db.WithOplog())
+	users, _ := database.CreateCollection("users")
+	database.CreateCollection("empty")
+	if err := database.SetSchema("users", []byte(`{"type": "object"}`), schema.Lenient); err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	for _, name := range []string{"Ada", "Alan", "Grace"} {
+		if _, err := users.Insert(core.Document{"name": name}); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	if err := database.Indexes().CreateUniqueIndex("users", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := database.Watch(ctx, "users", storage.WatchOptions{}); err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	backupAt := time.Date(2026, 3, 14, 3, 0, 0, 0, time.UTC)
+	database.RecordBackup(backupAt)
+
+	// Info reads no collection: it still works once the files no longer parse
+	garbage := []byte("not a collection file")
+	for _, name := range []string{"users", "empty"} {
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), garbage, 0644); err != nil {
+			t.Fatalf("Failed to overwrite collection: %v", err)
+		}
+	}
+
+	info, err := database.Info()
+	if err != nil {
+		t.Fatalf("Failed to get info: %v", err)
+	}
+	if info.Documents != 3 || info.DataBytes != 2*int64(len(garbage)) || info.Watchers != 1 || info.Uptime <= 0 || info.Dir != dir {
+		t.Errorf("Expected 3 documents, 2 files, 1 watcher and an uptime, got %+v", info)
+	}
+	if !info.Oplog.Enabled || info.Oplog.LastSeq != 3 || info.Oplog.Bytes == 0 {
+		t.Errorf("Expected the oplog with 3 entries, got %+v", info.Oplog)
+	}
+	if info.SchemaCache.Hits != 2 || info.SchemaCache.Misses != 1 || info.SchemaCache.HitRate < 0.66 || info.SchemaCache.HitRate > 0.67 {
+		t.Errorf("Expected the schema compiled once and reused twice, got %+v", info.SchemaCache)
+	}
+	if info.LastBackup == nil || !info.LastBackup.Equal(backupAt) {
+		t.Errorf("Expected the last backup at %v, got %v", backupAt, info.LastBackup)
+	}
+
+	if len(info.Collections) != 2 || info.Collections[0].Name != "empty" || info.Collections[1].Name != "users" {
+		t.Fatalf("Expected the collections by name, got %+v", info.Collections)
+	}
+	usersInfo := info.Collections[1]
+	if usersInfo.Documents != 3 || len(usersInfo.Indexes) != 1 || info.Collections[0].Indexes == nil {
+		t.Fatalf("Expected 3 users and 1 index, got %+v", info.Collections)
+	}
+	if idx := usersInfo.Indexes[0]; idx.Name != "name" || !idx.Unique || idx.Documents != 3 || idx.SizeBytes <= 0 || idx.SizeBytes != info.IndexBytes {
+		t.Errorf("Expected the unique name index, got %+v", idx)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Failed to marshal info: %v", err)
+	}
+	var decoded map[string]interface{}
+	json.Unmarshal(data, &decoded)
+	collections := decoded["collections"].([]interface{})
+	indexes := collections[1].(map[string]interface{})["indexes"].([]interface{})
+	for _, tt := range []struct {
+		name     string
+		value    interface{}
+		expected []string
+	}{
+		{"info", decoded, []string{"collections", "data_bytes", "dir", "documents", "index_bytes", "journal_bytes", "last_backup", "opened_at", "oplog", "read_only", "schema_cache", "uptime_ns", "watchers"}},
+		{"collection", collections[1], []string{"documents", "file_bytes", "index_file_bytes", "indexes", "name", "write_amplification"}},
+		{"index", indexes[0], []string{"documents", "fields", "kind", "name", "size_bytes", "unique"}},
+		{"oplog", decoded["oplog"], []string{"bytes", "enabled", "last_seq"}},
+		{"schema cache", decoded["schema_cache"], []string{"hit_rate", "hits", "misses"}},
+	} {
+		if got := keys(tt.value); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Expected %s fields %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+	if indexes[0].(map[string]interface{})["kind"] != "hash" {
+		t.Errorf("Expected the index kind by name, got %v", indexes[0])
+	}
+
+	database.Close()
+	if _, err := database.Info(); err != db.ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
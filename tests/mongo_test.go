@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// importMongoFixture imports testdata/mongoexport.jsonl into a collection
+func importMongoFixture(t *testing.T, c *db.Collection, opts ...db.MongoImportOption) db.ImportReport {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", "mongoexport.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+	report, err := c.ImportMongoExport(f, opts...)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	return report
+}
+
+func TestImportMongoExport(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	users, _ := database.Collection("users")
+	report := importMongoFixture(t, users)
+
+	if report.Imported != 6 {
+		t.Errorf("Expected 6 documents imported, got %d", report.Imported)
+	}
+	var lines []int
+	for _, problem := range report.Problems {
+		lines = append(lines, problem.Line)
+	}
+	if !reflect.DeepEqual(lines, []int{7, 8, 9}) {
+		t.Errorf("Expected problems on lines 7, 8 and 9, got %v", report.Problems)
+	}
+	if msg := report.Problems[0].Error(); !strings.Contains(msg, "line 7") || !strings.Contains(msg, "$binary") {
+		t.Errorf("Expected the problem to name the line and the type, got %q", msg)
+	}
+
+	tests := []struct {
+		id       core.DocumentID
+		field    string
+		expected interface{}
+	}{
+		{"5f43a1b2c3d4e5f601234567", "_id", "5f43a1b2c3d4e5f601234567"},
+		{"5f43a1b2c3d4e5f601234567", "joined", "2020-08-24T11:22:33.456Z"},
+		{"5f43a1b2c3d4e5f601234567", "visits", 42.0},
+		{"5f43a1b2c3d4e5f601234567", "balance", json.Number("1234.50")},
+		{"5f43a1b2c3d4e5f601234568", "joined", "2020-08-24T11:22:33.456Z"},
+		{"5f43a1b2c3d4e5f601234568", "visits", json.Number("7")},
+		{"5f43a1b2c3d4e5f601234568", "score", json.Number("-2.5")},
+		{"5f43a1b2c3d4e5f601234569", "manager", "5f43a1b2c3d4e5f601234567"},
+		{"5f43a1b2c3d4e5f601234569", "logins", []interface{}{
+			map[string]interface{}{"at": "2021-01-02T02:04:05Z"},
+			map[string]interface{}{"at": "1969-12-31T23:59:59Z"},
+		}},
+		{"5f43a1b2c3d4e5f601234569", "big", json.Number("9007199254740993")},
+		{"custom-id", "address", map[string]interface{}{"city": "Oslo", "zip": "0150"}},
+		{"17", "name", "numeric id"},
+	}
+	for _, tt := range tests {
+		doc, err := users.Get(tt.id)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", tt.id, err)
+		}
+		if !reflect.DeepEqual(doc[tt.field], tt.expected) {
+			t.Errorf("Expected %s.%s to be %v, got %v", tt.id, tt.field, tt.expected, doc[tt.field])
+		}
+	}
+	if docs, _ := users.Find(core.Query{Filters: []core.Filter{{Field: "name", Operator: core.OpEqual, Value: "no id"}}}); len(docs) != 1 {
+		t.Errorf("Expected the document without _id under a generated ID, got %v", docs)
+	}
+
+}
+
+func TestImportMongoExportOptions(t *testing.T) {
+	database := openDB(t, t.TempDir(), db.WithIDKey("id"))
+	users, _ := database.Collection("users")
+	importMongoFixture(t, users, db.MongoDatesAsUnixMillis())
+
+	doc, err := users.Get("5f43a1b2c3d4e5f601234568")
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if doc["joined"] != json.Number("1598268153456") {
+		t.Errorf("Expected the date in Unix milliseconds, got %v", doc["joined"])
+	}
+	if _, ok := doc["_id"]; ok || doc["id"] != "5f43a1b2c3d4e5f601234568" {
+		t.Errorf("Expected the ID under the configured key only, got %v", doc)
+	}
+}
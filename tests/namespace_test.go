@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func TestNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+
+	acme, err := database.Namespace("acme")
+	if err != nil {
+		t.Fatalf("Failed to open namespace: %v", err)
+	}
+	globex, _ := database.Namespace("globex")
+
+	for d, tenant := range map[*db.DB]string{database: "root", acme: "acme", globex: "globex"} {
+		users, _ := d.Collection("users")
+		if _, err := users.Insert(core.Document{"_id": "u1", "tenant": tenant}); err != nil {
+			t.Fatalf("Failed to insert into %s: %v", tenant, err)
+		}
+		d.Indexes().CreateSecondaryIndex("users", "tenant", core.IndexHash)
+	}
+	database.SetDefaults("users", core.Document{"plan": "free"})
+
+	acmeUsers, _ := acme.Collection("users")
+	acmeUsers.Insert(core.Document{"_id": "u2", "tenant": "acme"})
+	if doc, _ := acmeUsers.Get("u2"); doc["plan"] != nil {
+		t.Errorf("Expected the root's defaults not to apply in a namespace, got %v", doc)
+	}
+	found, _ := acmeUsers.Find(core.Query{Filters: []core.Filter{{Field: "tenant", Operator: core.OpEqual, Value: "globex"}}})
+	if len(found) != 0 {
+		t.Errorf("Expected no globex documents in acme, got %v", found)
+	}
+
+	// Namespaces and their collections survive reopening
+	database.Close()
+	database = openDB(t, dir)
+	if names, _ := database.ListNamespaces(); !reflect.DeepEqual(names, []string{"acme", "globex"}) {
+		t.Errorf("Expected namespaces acme and globex, got %v", names)
+	}
+	if names, _ := database.Collections(); !reflect.DeepEqual(names, []string{"users"}) {
+		t.Errorf("Expected only the root's collections, got %v", names)
+	}
+	for tenant, expected := range map[string]int{"acme": 2, "globex": 1} {
+		ns, _ := database.Namespace(tenant)
+		users, _ := ns.Collection("users")
+		if n, _ := users.Count(core.Query{Filters: []core.Filter{{Field: "tenant", Operator: core.OpEqual, Value: tenant}}}); n != expected {
+			t.Errorf("Expected %d users in %s, got %d", expected, tenant, n)
+		}
+	}
+
+	if _, err := database.Namespace("../acme"); err == nil {
+		t.Errorf("Expected error for an invalid namespace name")
+	}
+	if err := database.DropNamespace("acme"); err != nil {
+		t.Fatalf("Failed to drop namespace: %v", err)
+	}
+	if err := database.DropNamespace("acme"); !errors.Is(err, storage.ErrNamespaceNotFound) {
+		t.Errorf("Expected ErrNamespaceNotFound, got %v", err)
+	}
+	acme, _ = database.Namespace("acme")
+	if names, _ := acme.Collections(); len(names) != 0 {
+		t.Errorf("Expected a dropped namespace to start empty, got %v", names)
+	}
+}
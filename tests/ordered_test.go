@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestOrderedCollection(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	configs, _ := database.CreateCollection("configs")
+	if err := database.SetPreserveKeyOrder("configs", true); err != nil {
+		t.Fatalf("Failed to enable key order: %v", err)
+	}
+	if err := database.Indexes().CreateSecondaryIndex("configs", "env", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	inputs := map[core.DocumentID]string{
+		"api":    `{"name":"api","env":"prod","limits":{"rps":100,"burst":20}}`,
+		"worker": `{"name":"worker","env":"dev","limits":{"rps":5,"burst":1}}`,
+	}
+	for id, input := range inputs {
+		var doc core.OrderedDocument
+		if err := json.Unmarshal([]byte(input), &doc); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if err := configs.PutOrdered(id, doc); err != nil {
+			t.Fatalf("Failed to put document: %v", err)
+		}
+	}
+
+	// Each put is a single write, so the index stays current
+	plan, err := database.Executor().Explain(core.Query{Collection: "configs", Filters: []core.Filter{{Field: "env", Operator: core.OpEqual, Value: "prod"}}})
+	if err != nil {
+		t.Fatalf("Failed to explain: %v", err)
+	}
+	if plan.Index != "env" {
+		t.Errorf("Expected the env index used after PutOrdered, got %s", plan.Access)
+	}
+
+	// Filters, indexes and projections see ordered documents as any other
+	docs, err := configs.Find(core.Query{
+		Filters:    []core.Filter{{Field: "env", Operator: core.OpEqual, Value: "prod"}},
+		Projection: []string{"limits.rps"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to find: %v", err)
+	}
+	if len(docs) != 1 || docs[0]["limits"].(map[string]interface{})["rps"] != 100.0 {
+		t.Errorf("Expected the prod config's rps, got %v", docs)
+	}
+	if ids, _ := database.Indexes().LookupSecondaryIDs("configs", "env", "dev"); len(ids) != 1 || ids[0] != "worker" {
+		t.Errorf("Expected the index to find worker, got %v", ids)
+	}
+
+	// Updates keep the order, across a restart too
+	if err := configs.Update("api", core.Document{"name": "api", "env": "staging", "limits": map[string]interface{}{"burst": 40.0, "rps": 100.0}}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	database.Close()
+	database = openDB(t, dir)
+	configs, _ = database.Collection("configs")
+
+	expected := map[core.DocumentID]string{
+		"api":    `{"name":"api","env":"staging","limits":{"rps":100,"burst":40}}`,
+		"worker": inputs["worker"],
+	}
+	for id, want := range expected {
+		doc, err := configs.GetOrdered(id)
+		if err != nil {
+			t.Fatalf("Failed to get document: %v", err)
+		}
+		if data, _ := json.Marshal(doc); string(data) != want {
+			t.Errorf("Expected %s, got %s", want, data)
+		}
+	}
+	if ids, _ := database.Indexes().LookupSecondaryIDs("configs", "env", "staging"); len(ids) != 1 {
+		t.Errorf("Expected the index to follow the update, got %v", ids)
+	}
+
+	database.Close()
+	if _, err := configs.GetOrdered("api"); err != db.ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package tests
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestPaginate(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	items, _ := database.Collection("items")
+	for i := 0; i < 23; i++ {
+		items.Insert(core.Document{"_id": fmt.Sprintf("i%02d", i), "n": i})
+	}
+
+	tests := []struct {
+		page, perPage    int
+		first            string
+		items, pages     int
+		hasNext, hasPrev bool
+	}{
+		{1, 10, "i00", 10, 3, true, false},
+		{2, 10, "i10", 10, 3, true, true},
+		{3, 10, "i20", 3, 3, false, true},
+		{4, 10, "", 0, 3, false, true},
+		{1, 23, "i00", 23, 1, false, false},
+	}
+	for _, tt := range tests {
+		p, err := items.Paginate(core.Query{}, tt.page, tt.perPage)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		if len(p.Items) != tt.items || p.TotalItems != 23 || p.TotalPages != tt.pages || p.Page != tt.page ||
+			p.PerPage != tt.perPage || p.HasNext != tt.hasNext || p.HasPrev != tt.hasPrev {
+			t.Errorf("Unexpected page %d of %d: %+v", tt.page, tt.perPage, p)
+		}
+		if tt.items > 0 && p.Items[0]["_id"] != tt.first {
+			t.Errorf("Expected page %d to start at %s, got %v", tt.page, tt.first, p.Items[0])
+		}
+	}
+
+	for _, perPage := range []int{0, -1} {
+		if _, err := items.Paginate(core.Query{}, 1, perPage); err == nil {
+			t.Errorf("Expected error for %d per page", perPage)
+		}
+		if _, err := items.PaginateAfter(core.Query{}, "", perPage); err == nil {
+			t.Errorf("Expected error for %d per page after", perPage)
+		}
+	}
+
+	// Keyset pages are not shifted by inserts before the cursor
+	p, _ := items.PaginateAfter(core.Query{}, "", 10)
+	last := core.DocumentID(fmt.Sprint(p.Items[len(p.Items)-1]["_id"]))
+	items.Insert(core.Document{"_id": "a00"})
+	p, err := items.PaginateAfter(core.Query{}, last, 10)
+	if err != nil {
+		t.Fatalf("Failed to paginate after %s: %v", last, err)
+	}
+	if p.Items[0]["_id"] != "i10" || p.TotalItems != 24 || p.Page != 2 || !p.HasPrev || !p.HasNext {
+		t.Errorf("Expected the keyset page to start at i10, got %+v", p)
+	}
+
+	sorted := core.Query{Sort: &core.SortOption{Field: "n", Descending: true}, Filters: []core.Filter{{Field: "n", Operator: core.OpGreaterThan, Value: 15}}}
+	p, _ = items.PaginateAfter(sorted, "i20", 10)
+	if len(p.Items) != 4 || p.Items[0]["_id"] != "i19" || p.TotalItems != 7 || p.HasNext {
+		t.Errorf("Expected the sorted keyset page to follow i20, got %+v", p)
+	}
+}
+
+func TestPaginateConsistentUnderWrites(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	items, _ := database.Collection("items")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			items.Insert(core.Document{"_id": fmt.Sprintf("i%03d", i)})
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		p, err := items.Paginate(core.Query{}, 1, 1000)
+		if err != nil {
+			t.Fatalf("Failed to paginate: %v", err)
+		}
+		if len(p.Items) != p.TotalItems {
+			t.Fatalf("Expected the items and the total to agree, got %d and %d", len(p.Items), p.TotalItems)
+		}
+	}
+	wg.Wait()
+}
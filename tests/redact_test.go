@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestExportRedacted(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	users, _ := database.Collection("users")
+	original := core.Document{
+		"_id":     "ada",
+		"name":    "Ada Lovelace",
+		"email":   "ada@example.com",
+		"ssn":     "123-45-6789",
+		"friends": []interface{}{map[string]interface{}{"email": "charles@example.com", "since": float64(1833)}},
+	}
+	users.Insert(original)
+
+	redaction := core.Redaction{
+		Rules: []core.RedactRule{
+			{Path: "ssn", Action: core.RedactDrop},
+			{Path: "email", Action: core.RedactHash},
+			{Path: "friends.email", Action: core.RedactMask},
+		},
+		Salt: "export-2024",
+	}
+	if err := database.SetRedaction("users", redaction); err != nil {
+		t.Fatalf("Failed to set redaction: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := users.ExportJSONL(&buf, db.ExportRedacted()); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	var exported core.Document
+	if err := json.NewDecoder(&buf).Decode(&exported); err != nil {
+		t.Fatalf("Failed to decode export: %v", err)
+	}
+	if _, ok := exported["ssn"]; ok {
+		t.Errorf("Expected ssn dropped, got %v", exported)
+	}
+	if exported["_id"] != "ada" || exported["name"] != "Ada Lovelace" {
+		t.Errorf("Expected the ID and unlisted fields kept, got %v", exported)
+	}
+	hashed, _ := core.RedactDocument(core.Document{"email": "ada@example.com"}, redaction)
+	if exported["email"] != hashed["email"] {
+		t.Errorf("Expected the stable hash %v, got %v", hashed["email"], exported["email"])
+	}
+	if friend := exported["friends"].([]interface{})[0].(map[string]interface{}); friend["email"] != "c***@***.com" || friend["since"] != float64(1833) {
+		t.Errorf("Expected the friend's email masked, got %v", friend)
+	}
+
+	// Reads and the collection file are untouched, apart from the stored
+	// redaction
+	if doc, _ := users.Get("ada"); !reflect.DeepEqual(doc, original) {
+		t.Errorf("Expected the stored document unredacted, got %v", doc)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "users.json"))
+	if err != nil {
+		t.Fatalf("Failed to read collection file: %v", err)
+	}
+	if !bytes.Contains(data, []byte("123-45-6789")) || !bytes.Contains(data, []byte("ada@example.com")) {
+		t.Errorf("Expected the original document on disk")
+	}
+
+	// The redaction survives reopening, and no rules removes it
+	database.Close()
+	database = openDB(t, dir)
+	stored, err := database.Redaction("users")
+	if err != nil || stored == nil || !reflect.DeepEqual(*stored, redaction) {
+		t.Fatalf("Expected the stored redaction, got %+v (%v)", stored, err)
+	}
+	if err := database.SetRedaction("users", core.Redaction{}); err != nil {
+		t.Fatalf("Failed to remove redaction: %v", err)
+	}
+	if stored, _ := database.Redaction("users"); stored != nil {
+		t.Errorf("Expected the redaction removed, got %+v", stored)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// declare declares a reference, failing the test on error
+func declare(t *testing.T, database *db.DB, from, field, to string, onDelete core.RefAction) {
+	t.Helper()
+	if err := database.DeclareReference(from, field, to, onDelete); err != nil {
+		t.Fatalf("Failed to declare reference %s.%s: %v", from, field, err)
+	}
+}
+
+func TestReferenceWrites(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	users, _ := database.Collection("users")
+	orders, _ := database.Collection("orders")
+	users.Insert(core.Document{"_id": "u1"})
+	declare(t, database, "orders", "user", "users", core.RefRestrict)
+
+	if _, err := orders.Insert(core.Document{"_id": "o1", "user": "u1"}); err != nil {
+		t.Fatalf("Failed to insert referencing document: %v", err)
+	}
+	if _, err := orders.Insert(core.Document{"_id": "o2"}); err != nil {
+		t.Errorf("Expected a missing reference to be allowed, got %v", err)
+	}
+	for _, doc := range []core.Document{{"_id": "o3", "user": "ghost"}, {"_id": "o3", "user": 7}} {
+		if _, err := orders.Insert(doc); !errors.Is(err, db.ErrReferenceViolation) {
+			t.Errorf("Expected ErrReferenceViolation for %v, got %v", doc, err)
+		}
+	}
+
+	if err := users.Delete("u1"); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Errorf("Expected the restricted delete to fail, got %v", err)
+	}
+	orders.Update("o1", core.Document{"_id": "o1"})
+	if err := users.Delete("u1"); err != nil {
+		t.Errorf("Failed to delete unreferenced document: %v", err)
+	}
+
+	// References are stored and enforced after reopening
+	database.Close()
+	database = openDB(t, dir)
+	orders, _ = database.Collection("orders")
+	if refs := database.References("orders"); len(refs) != 1 || refs[0].To != "users" {
+		t.Errorf("Expected the stored reference, got %v", refs)
+	}
+	if _, err := orders.Insert(core.Document{"user": "u1"}); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Errorf("Expected ErrReferenceViolation after reopening, got %v", err)
+	}
+
+	// Existing documents must satisfy a new reference
+	orders.Insert(core.Document{"_id": "o9", "owner": "nobody"})
+	if err := database.DeclareReference("orders", "owner", "users", core.RefCascade); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Errorf("Expected ErrReferenceViolation declaring over dangling data, got %v", err)
+	}
+}
+
+func TestReferenceDeleteActions(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	orders, _ := database.Collection("orders")
+	items, _ := database.Collection("items")
+	reviews, _ := database.Collection("reviews")
+
+	declare(t, database, "orders", "user", "users", core.RefCascade)
+	declare(t, database, "items", "order", "orders", core.RefCascade)
+	declare(t, database, "reviews", "author", "users", core.RefSetNull)
+
+	users.Insert(core.Document{"_id": "u1"})
+	users.Insert(core.Document{"_id": "u2"})
+	orders.Insert(core.Document{"_id": "o1", "user": "u1"})
+	orders.Insert(core.Document{"_id": "o2", "user": "u1"})
+	orders.Insert(core.Document{"_id": "o3", "user": "u2"})
+	for i, order := range []string{"o1", "o1", "o2", "o3"} {
+		items.Insert(core.Document{"_id": fmt.Sprintf("i%d", i), "order": order})
+	}
+	reviews.Insert(core.Document{"_id": "r1", "author": "u1", "text": "great"})
+
+	if err := users.Delete("u1"); err != nil {
+		t.Fatalf("Failed to delete with cascade: %v", err)
+	}
+
+	for collection, expected := range map[*db.Collection]int{orders: 1, items: 1, users: 1} {
+		if n, _ := collection.Count(core.Query{}); n != expected {
+			t.Errorf("Expected %d documents in %s, got %d", expected, collection.Name(), n)
+		}
+	}
+	if _, err := items.Get("i3"); err != nil {
+		t.Errorf("Expected the item of the other user's order to remain: %v", err)
+	}
+	review, _ := reviews.Get("r1")
+	if value, ok := review["author"]; !ok || value != nil || review["text"] != "great" {
+		t.Errorf("Expected the review's author to be nulled, got %v", review)
+	}
+
+	// A restrict further down the chain stops the whole cascade
+	database.DeclareReference("items", "order", "orders", core.RefRestrict)
+	if err := users.Delete("u2"); !errors.Is(err, db.ErrReferenceViolation) {
+		t.Fatalf("Expected ErrReferenceViolation, got %v", err)
+	}
+	if _, err := orders.Get("o3"); err != nil {
+		t.Errorf("Expected the failed cascade to change nothing: %v", err)
+	}
+}
+
+func TestRestrictUnderConcurrentInsert(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	orders, _ := database.Collection("orders")
+	declare(t, database, "orders", "user", "users", core.RefRestrict)
+
+	for i := 0; i < 30; i++ {
+		user := fmt.Sprintf("u%d", i)
+		users.Insert(core.Document{"_id": user})
+
+		var wg sync.WaitGroup
+		var deleteErr, insertErr error
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			deleteErr = users.Delete(core.DocumentID(user))
+		}()
+		go func() {
+			defer wg.Done()
+			_, insertErr = orders.Insert(core.Document{"user": user})
+		}()
+		wg.Wait()
+
+		if (deleteErr == nil) == (insertErr == nil) {
+			t.Fatalf("Expected exactly one of delete (%v) and insert (%v) to succeed", deleteErr, insertErr)
+		}
+		failed := deleteErr
+		if failed == nil {
+			failed = insertErr
+		}
+		if !errors.Is(failed, db.ErrReferenceViolation) {
+			t.Fatalf("Expected ErrReferenceViolation, got %v", failed)
+		}
+	}
+}
+
+func TestOpenChecksReferences(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	database.Collection("users")
+	declare(t, database, "orders", "user", "users", core.RefRestrict)
+	database.Close()
+
+	os.Remove(filepath.Join(dir, "users.json"))
+	if _, err := db.Open(dir); !errors.Is(err, db.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound for a dangling reference, got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+func TestDefaults(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	orders, _ := database.Collection("orders")
+
+	err := database.SetDefaults("orders", core.Document{"status": "pending", "tags": []interface{}{"new"}})
+	if err != nil {
+		t.Fatalf("Failed to set defaults: %v", err)
+	}
+
+	id, _ := orders.Insert(core.Document{"_id": "o1", "status": "paid"})
+	doc, _ := orders.Get(id)
+	if doc["status"] != "paid" || len(doc["tags"].([]interface{})) != 1 {
+		t.Errorf("Expected defaults only for missing fields, got %v", doc)
+	}
+
+	// Updates do not get defaults
+	if err := orders.Update("o1", core.Document{"_id": "o1"}); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+	if doc, _ := orders.Get("o1"); doc["status"] != nil || doc["tags"] != nil {
+		t.Errorf("Expected no defaults on update, got %v", doc)
+	}
+
+	// Defaults are stored with the collection
+	database.Close()
+	database = openDB(t, dir)
+	orders, _ = database.Collection("orders")
+	id, _ = orders.Insert(core.Document{})
+	if doc, _ := orders.Get(id); doc["status"] != "pending" {
+		t.Errorf("Expected the default after reopening, got %v", doc)
+	}
+
+	database.SetDefaults("orders", nil)
+	id, _ = orders.Insert(core.Document{})
+	if doc, _ := orders.Get(id); doc["status"] != nil {
+		t.Errorf("Expected no default once removed, got %v", doc)
+	}
+}
+
+func TestComputedFields(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	orders, _ := database.Collection("orders")
+
+	database.SetComputed("orders", "search_name", func(doc core.Document) interface{} {
+		name, _ := doc["name"].(string)
+		return strings.ToLower(name)
+	})
+	database.SetComputed("orders", "total", func(doc core.Document) interface{} {
+		total := 0.0
+		items, _ := doc["items"].([]interface{})
+		for _, item := range items {
+			price, _ := core.ToFloat64(item.(map[string]interface{})["price"])
+			total += price
+		}
+		return total
+	})
+
+	id, _ := orders.Insert(core.Document{"name": "Ada", "items": []interface{}{
+		map[string]interface{}{"price": 2.5},
+		map[string]interface{}{"price": 4},
+	}})
+	doc, _ := orders.Get(id)
+	if doc["search_name"] != "ada" || doc["total"] != 6.5 {
+		t.Errorf("Expected computed fields on insert, got %v", doc)
+	}
+
+	// Computed fields are re-evaluated on every update and cannot be
+	// overridden by the caller
+	orders.Update(id, core.Document{"name": "LOVELACE", "total": 100})
+	doc, _ = orders.Get(id)
+	if doc["search_name"] != "lovelace" || doc["total"] != 0.0 {
+		t.Errorf("Expected computed fields on update, got %v", doc)
+	}
+
+	database.SetComputed("orders", "total", nil)
+	orders.Update(id, core.Document{"name": "Ada"})
+	doc, _ = orders.Get(id)
+	if _, ok := doc["total"]; ok || doc["search_name"] != "ada" {
+		t.Errorf("Expected only search_name once total is removed, got %v", doc)
+	}
+}
+
+func TestRulesApplyBeforeSchema(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	tickets, _ := database.Collection("tickets")
+
+	err := database.SetSchema("tickets", []byte(`{
+		"required": ["status", "key"],
+		"properties": {"status": {"enum": ["open", "closed"]}, "key": {"type": "string"}}
+	}`), schema.Lenient)
+	if err != nil {
+		t.Fatalf("Failed to set schema: %v", err)
+	}
+	database.SetDefaults("tickets", core.Document{"status": "open"})
+	database.SetComputed("tickets", "key", func(doc core.Document) interface{} {
+		return strings.ToUpper(doc["title"].(string))
+	})
+
+	if _, err := tickets.Insert(core.Document{"title": "bug"}); err != nil {
+		t.Fatalf("Expected defaults and computed fields to satisfy the schema: %v", err)
+	}
+	if _, err := tickets.Insert(core.Document{"title": "bug", "status": "stale"}); !errors.Is(err, schema.ErrSchemaValidation) {
+		t.Errorf("Expected ErrSchemaValidation, got %v", err)
+	}
+
+	// A panicking rule aborts the write like a panicking hook
+	if _, err := tickets.Insert(core.Document{}); !errors.Is(err, db.ErrHookPanic) {
+		t.Errorf("Expected ErrHookPanic, got %v", err)
+	}
+}
+
+func TestMetadataWritesKeepIndexesCurrent(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	users, _ := database.Collection("users")
+	database.Collection("teams")
+	if err := database.Indexes().CreateSecondaryIndex("users", "team", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	users.Insert(core.Document{"_id": "u1", "team": "core"})
+	users.Insert(core.Document{"_id": "u2", "team": "web"})
+
+	key := make([]byte, 32)
+	tests := []struct {
+		name string
+		set  func() error
+	}{
+		{"defaults", func() error { return database.SetDefaults("users", core.Document{"active": true}) }},
+		{"encrypted fields", func() error { return database.EncryptFields("users", []string{"ssn"}, key) }},
+		{"references", func() error { return database.DeclareReference("users", "team_id", "teams", core.RefRestrict) }},
+		{"custom metadata", func() error {
+			return database.Storage().SetCollectionMeta("users", map[string]interface{}{"owner": "ops"})
+		}},
+		{"schema", func() error { return database.SetSchema("users", []byte(`{"type": "object"}`), schema.Strict) }},
+		{"key order", func() error { return database.SetPreserveKeyOrder("users", true) }},
+	}
+	q := core.Query{Collection: "users", Filters: []core.Filter{{Field: "team", Operator: core.OpEqual, Value: "core"}}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.set(); err != nil {
+				t.Fatalf("Failed to set %s: %v", tt.name, err)
+			}
+			plan, err := database.Executor().Explain(q)
+			if err != nil {
+				t.Fatalf("Failed to explain: %v", err)
+			}
+			if plan.Index != "team" {
+				t.Errorf("Expected the team index used after setting %s, got %s", tt.name, plan.Access)
+			}
+		})
+	}
+}
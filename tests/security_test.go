@@ -0,0 +1,265 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// tenantPolicy lets principals see the documents of their tenant
+func tenantPolicy(p db.Principal) core.FilterNode {
+	return core.Leaf(core.Filter{Field: "tenant_id", Operator: core.OpEqual, Value: p.Attributes["tenant_id"]})
+}
+
+// tenantCollection returns the orders collection as seen by a tenant
+func tenantCollection(t *testing.T, database *db.DB, tenant string) *db.Collection {
+	t.Helper()
+	c, err := database.WithPrincipal(db.Principal{ID: tenant, Attributes: map[string]string{"tenant_id": tenant}}).Collection("orders")
+	if err != nil {
+		t.Fatalf("Failed to get collection for %s: %v", tenant, err)
+	}
+	return c
+}
+
+// docIDs returns the sorted IDs of documents
+func docIDs(docs []core.Document) []string {
+	out := []string{}
+	for _, doc := range docs {
+		out = append(out, doc["_id"].(string))
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestRowLevelSecurityReads(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	orders, _ := database.Collection("orders")
+	for _, doc := range []core.Document{
+		{"_id": "a1", "tenant_id": "acme", "total": 10},
+		{"_id": "a2", "tenant_id": "acme", "total": 30},
+		{"_id": "g1", "tenant_id": "globex", "total": 20},
+	} {
+		if _, err := orders.Insert(doc); err != nil {
+			t.Fatalf("Failed to insert: %v", err)
+		}
+	}
+	database.RegisterPolicy("orders", tenantPolicy)
+
+	acme := tenantCollection(t, database, "acme")
+	docs, err := acme.Find(core.Query{})
+	if err != nil {
+		t.Fatalf("Failed to find: %v", err)
+	}
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"a1", "a2"}) {
+		t.Errorf("Expected acme's orders, got %v", got)
+	}
+	docs, _ = acme.Find(core.Query{Filters: []core.Filter{{Field: "total", Operator: core.OpGreaterThan, Value: 15}}})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"a2"}) {
+		t.Errorf("Expected the policy ANDed with the query, got %v", got)
+	}
+	if n, err := acme.Count(core.Query{}); err != nil || n != 2 {
+		t.Errorf("Expected 2 visible orders, got %d and %v", n, err)
+	}
+
+	// Another tenant's documents are not found rather than forbidden
+	if _, err := acme.Get("g1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for another tenant's order, got %v", err)
+	}
+	if _, _, err := acme.GetVersion("g1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound for another tenant's version, got %v", err)
+	}
+	page, err := acme.Paginate(core.Query{}, 1, 10)
+	if err != nil || len(page.Items) != 2 || page.TotalItems != 2 {
+		t.Errorf("Expected a page of 2 orders, got %v and %v", page.Items, err)
+	}
+
+	cur, err := acme.Iter(core.Query{})
+	if err != nil {
+		t.Fatalf("Failed to iterate: %v", err)
+	}
+	n := 0
+	for cur.Next() {
+		if _, doc := cur.Doc(); doc["tenant_id"] != "acme" {
+			t.Errorf("Expected only acme's orders, got %v", doc)
+		}
+		n++
+	}
+	cur.Close()
+	if n != 2 {
+		t.Errorf("Expected 2 orders iterated, got %d", n)
+	}
+
+	// The system principal sees everything
+	system, _ := database.WithPrincipal(db.SystemPrincipal).Collection("orders")
+	if n, _ := system.Count(core.Query{}); n != 3 {
+		t.Errorf("Expected the system principal to see 3 orders, got %d", n)
+	}
+	if _, err := system.Get("g1"); err != nil {
+		t.Errorf("Expected the system principal to get any order, got %v", err)
+	}
+
+	// Handles without a principal are refused
+	if _, err := orders.Find(core.Query{}); !errors.Is(err, db.ErrNoPrincipal) {
+		t.Errorf("Expected ErrNoPrincipal without a principal, got %v", err)
+	}
+	if _, err := orders.Get("a1"); !errors.Is(err, db.ErrNoPrincipal) {
+		t.Errorf("Expected ErrNoPrincipal getting without a principal, got %v", err)
+	}
+
+	database.RegisterPolicy("orders", nil)
+	if n, err := orders.Count(core.Query{}); err != nil || n != 3 {
+		t.Errorf("Expected every order after removing the policy, got %d and %v", n, err)
+	}
+}
+
+func TestRowLevelSecurityWrites(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	database.RegisterPolicy("orders", tenantPolicy)
+	acme := tenantCollection(t, database, "acme")
+	globex := tenantCollection(t, database, "globex")
+
+	if _, err := acme.Insert(core.Document{"_id": "a1", "tenant_id": "acme"}); err != nil {
+		t.Fatalf("Failed to insert own order: %v", err)
+	}
+	if _, err := globex.Insert(core.Document{"_id": "g1", "tenant_id": "globex"}); err != nil {
+		t.Fatalf("Failed to insert own order: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		write func() error
+		want  error
+	}{
+		{"insert for another tenant", func() error {
+			_, err := acme.Insert(core.Document{"_id": "a2", "tenant_id": "globex"})
+			return err
+		}, db.ErrPolicyViolation},
+		{"insert without a tenant", func() error {
+			_, err := acme.Insert(core.Document{"_id": "a3"})
+			return err
+		}, db.ErrPolicyViolation},
+		{"move to another tenant", func() error {
+			return acme.Update("a1", core.Document{"_id": "a1", "tenant_id": "globex"})
+		}, db.ErrPolicyViolation},
+		{"update another tenant's order", func() error {
+			return acme.Update("g1", core.Document{"_id": "g1", "tenant_id": "acme"})
+		}, core.ErrDocumentNotFound},
+		{"delete another tenant's order", func() error {
+			return acme.Delete("g1")
+		}, core.ErrDocumentNotFound},
+		{"batch over another tenant's order", func() error {
+			return acme.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+				return map[core.DocumentID]core.Document{"g1": nil}, nil
+			})
+		}, core.ErrDocumentNotFound},
+		{"batch update of another tenant's order", func() error {
+			return acme.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+				return map[core.DocumentID]core.Document{"g1": {"_id": "g1", "tenant_id": "acme"}}, nil
+			})
+		}, core.ErrDocumentNotFound},
+		{"insert over another tenant's ID", func() error {
+			_, err := acme.Insert(core.Document{"_id": "g1", "tenant_id": "acme"})
+			return err
+		}, core.ErrDocumentNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if err := acme.Update("a1", core.Document{"_id": "a1", "tenant_id": "acme", "total": 5}); err != nil {
+		t.Errorf("Failed to update own order: %v", err)
+	}
+	system, _ := database.WithPrincipal(db.SystemPrincipal).Collection("orders")
+	docs, _ := system.Find(core.Query{})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"a1", "g1"}) {
+		t.Errorf("Expected the rejected writes not to be applied, got %v", got)
+	}
+	if doc, _ := system.Get("g1"); doc["tenant_id"] != "globex" {
+		t.Errorf("Expected globex's order untouched, got %v", doc)
+	}
+}
+
+func TestRowLevelSecurityCountersAndArrays(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	orders, _ := database.Collection("orders")
+	orders.Insert(core.Document{"_id": "a1", "tenant_id": "acme", "items": 1, "tags": []interface{}{"new"}})
+	orders.Insert(core.Document{"_id": "g1", "tenant_id": "globex", "items": 1})
+	database.RegisterPolicy("orders", tenantPolicy)
+	acme := database.WithPrincipal(db.Principal{ID: "acme", Attributes: map[string]string{"tenant_id": "acme"}})
+
+	if n, err := acme.IncrementField("orders", "a1", "items", 2); err != nil || n != 3 {
+		t.Errorf("Expected 3 items, got %v and %v", n, err)
+	}
+	if err := acme.PushToArray("orders", "a1", "tags", "paid"); err != nil {
+		t.Errorf("Failed to push: %v", err)
+	}
+	if n, err := acme.AddToSet("orders", "a1", "tags", "paid", "sent"); err != nil || n != 1 {
+		t.Errorf("Expected 1 tag added, got %d and %v", n, err)
+	}
+	if n, err := acme.PullFromArray("orders", "a1", "tags", "new"); err != nil || n != 1 {
+		t.Errorf("Expected 1 tag pulled, got %d and %v", n, err)
+	}
+	c, _ := acme.Collection("orders")
+	doc, _ := c.Get("a1")
+	if doc["items"] != float64(3) || !reflect.DeepEqual(doc["tags"], []interface{}{"paid", "sent"}) {
+		t.Errorf("Expected the counter and array changed, got %v", doc)
+	}
+
+	// Another tenant's documents are not found
+	if _, err := acme.IncrementField("orders", "g1", "items", 1); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound incrementing another tenant's order, got %v", err)
+	}
+	if err := acme.PushToArray("orders", "g1", "tags", "x"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound pushing to another tenant's order, got %v", err)
+	}
+	if _, err := acme.IncrementFields("orders", "a1", map[string]float64{"tenant_id": 1}); !errors.Is(err, db.ErrNotNumeric) {
+		t.Errorf("Expected ErrNotNumeric incrementing a string, got %v", err)
+	}
+
+	// Without a principal they are refused
+	if _, err := database.IncrementField("orders", "a1", "items", 1); !errors.Is(err, db.ErrNoPrincipal) {
+		t.Errorf("Expected ErrNoPrincipal without a principal, got %v", err)
+	}
+	if _, err := database.AddToSet("orders", "a1", "tags", "x"); !errors.Is(err, db.ErrNoPrincipal) {
+		t.Errorf("Expected ErrNoPrincipal without a principal, got %v", err)
+	}
+}
+
+func TestRowLevelSecurityMaintenance(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	sessions, _ := database.Collection("sessions")
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sessions.Insert(core.Document{"_id": "a1", "tenant_id": "acme", "_expiresAt": core.Time(base)})
+	sessions.Insert(core.Document{"_id": "g1", "tenant_id": "globex", "_expiresAt": core.Time(base)})
+	sessions.Insert(core.Document{"_id": "g2", "tenant_id": "globex", "_expiresAt": core.Time(base.Add(time.Hour))})
+	if err := database.EnableTTL("sessions", ""); err != nil {
+		t.Fatalf("Failed to enable TTL: %v", err)
+	}
+	database.RegisterPolicy("sessions", func(p db.Principal) core.FilterNode {
+		return core.Leaf(core.Filter{Field: "tenant_id", Operator: core.OpEqual, Value: p.Attributes["tenant_id"]})
+	})
+
+	// The purge sees every tenant's documents
+	if n, err := database.PurgeExpired(base.Add(time.Minute)); err != nil || n != 2 {
+		t.Errorf("Expected 2 expired sessions purged, got %d and %v", n, err)
+	}
+	system, _ := database.WithPrincipal(db.SystemPrincipal).Collection("sessions")
+	docs, _ := system.Find(core.Query{})
+	if got := docIDs(docs); !reflect.DeepEqual(got, []string{"g2"}) {
+		t.Errorf("Expected only g2 left, got %v", got)
+	}
+
+	report, err := database.InferSchema("sessions", 0)
+	if err != nil || report.Documents != 1 {
+		t.Errorf("Expected the schema inferred from every document, got %+v and %v", report, err)
+	}
+}
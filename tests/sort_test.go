@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+func TestIterSortsBeyondBudgetOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir, db.WithSortBudget(2<<10))
+	events, _ := database.Collection("events")
+
+	err := events.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document)
+		for i := 0; i < 1000; i++ {
+			id := core.DocumentID(fmt.Sprintf("e%04d", i))
+			writes[id] = core.Document{"_id": string(id), "ts": float64((i * 7919) % 1000)}
+		}
+		return writes, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert events: %v", err)
+	}
+
+	q := core.Query{Sort: &core.SortOption{Field: "ts", Descending: true}}
+	expected, err := events.Find(q)
+	if err != nil {
+		t.Fatalf("Failed to find events: %v", err)
+	}
+
+	cursor, err := events.Iter(q)
+	if err != nil {
+		t.Fatalf("Failed to iterate events: %v", err)
+	}
+	defer cursor.Close()
+	spilled, _ := filepath.Glob(filepath.Join(dir, "_sort-*.tmp"))
+	if len(spilled) == 0 {
+		t.Errorf("Expected the sort to spill to the data directory")
+	}
+	collections, err := database.Collections()
+	if err != nil || !reflect.DeepEqual(collections, []string{"events"}) {
+		t.Errorf("Expected spill files not to be collections, got %v (%v)", collections, err)
+	}
+
+	var got []interface{}
+	for cursor.Next() {
+		_, doc := cursor.Doc()
+		got = append(got, doc["_id"])
+	}
+	if err := cursor.Err(); err != nil {
+		t.Fatalf("Cursor failed: %v", err)
+	}
+	var want []interface{}
+	for _, doc := range expected {
+		want = append(want, doc["_id"])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the cursor to match Find's order")
+	}
+	if spilled, _ := filepath.Glob(filepath.Join(dir, "_sort-*.tmp")); len(spilled) != 0 {
+		t.Errorf("Expected spill files removed, got %v", spilled)
+	}
+}
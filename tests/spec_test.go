@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/schema"
+)
+
+// ordersSpec returns a spec using every part of a CollectionSpec
+func ordersSpec() db.CollectionSpec {
+	return db.CollectionSpec{
+		Name:       "orders",
+		Schema:     json.RawMessage(`{"type":"object","required":["sku"],"properties":{"sku":{"type":"string"}}}`),
+		SchemaMode: schema.Lenient,
+		Indexes: []db.IndexSpec{
+			{Fields: []string{"sku"}, Kind: core.IndexHash, Unique: true, RejectDuplicateNulls: true},
+			{Fields: []string{"total"}, Kind: core.IndexOrdered, Sparse: true},
+			{Fields: []string{"tenant", "status"}, Kind: core.IndexComposite},
+			{Fields: []string{"note"}, Kind: core.IndexText, Text: &index.TextOptions{MinTokenLength: 3}},
+			{Fields: []string{"email"}, Kind: core.IndexHash, CaseInsensitive: true},
+		},
+		TTLField:         "expires",
+		Defaults:         core.Document{"status": "new"},
+		Redaction:        &core.Redaction{Rules: []core.RedactRule{{Path: "email", Action: core.RedactMask}}},
+		PreserveKeyOrder: true,
+		Meta:             map[string]interface{}{"owner": "billing"},
+	}
+}
+
+func TestCollectionSpecRoundTrip(t *testing.T) {
+	staging := openDB(t, t.TempDir())
+	spec := ordersSpec()
+	if err := staging.CreateCollectionWithSpec(spec); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	exported, err := staging.ExportSpec("orders")
+	if err != nil {
+		t.Fatalf("Failed to export spec: %v", err)
+	}
+	if exported.IDField != core.DefaultIDKey || exported.TTLField != "expires" || len(exported.Indexes) != len(spec.Indexes) {
+		t.Errorf("Unexpected exported spec: %+v", exported)
+	}
+	if !reflect.DeepEqual(exported.Redaction, spec.Redaction) || !reflect.DeepEqual(exported.Meta, spec.Meta) || !exported.PreserveKeyOrder {
+		t.Errorf("Expected the configuration exported, got %+v", exported)
+	}
+
+	// Replayed through JSON in another database, the spec gives the same
+	// collection
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("Failed to encode spec: %v", err)
+	}
+	var decoded db.CollectionSpec
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to decode spec: %v", err)
+	}
+	prod := openDB(t, t.TempDir())
+	if err := prod.CreateCollectionWithSpec(decoded); err != nil {
+		t.Fatalf("Failed to replay spec: %v", err)
+	}
+	replayed, err := prod.ExportSpec("orders")
+	if err != nil {
+		t.Fatalf("Failed to export replayed spec: %v", err)
+	}
+	if !reflect.DeepEqual(replayed, exported) {
+		t.Errorf("Expected the replayed spec\n%+v\nto equal\n%+v", replayed, exported)
+	}
+
+	// The configuration is in effect
+	orders, _ := prod.Collection("orders")
+	if _, err := orders.Insert(core.Document{"_id": "o1", "sku": "A1", "email": "X@Y.z"}); err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if doc, _ := orders.Get("o1"); doc["status"] != "new" {
+		t.Errorf("Expected the default status, got %v", doc)
+	}
+	if _, err := orders.Insert(core.Document{"_id": "o2", "sku": "A1"}); !errors.Is(err, index.ErrUniqueConstraintViolation) {
+		t.Errorf("Expected the unique index to reject a duplicate, got %v", err)
+	}
+	if _, err := orders.Insert(core.Document{"_id": "o3"}); err == nil {
+		t.Errorf("Expected the schema to reject a document without a sku")
+	}
+	if _, ok, err := prod.NextExpiry("orders"); err != nil || ok {
+		t.Errorf("Expected TTL enabled with nothing due, got %v, %v", ok, err)
+	}
+}
+
+func TestCreateCollectionWithSpecFailures(t *testing.T) {
+	database := openDB(t, t.TempDir(), db.WithAutoCreate(false))
+
+	tests := []struct {
+		name    string
+		mutate  func(*db.CollectionSpec)
+		invalid bool // Rejected before the collection is created
+	}{
+		{"composite with one field", func(s *db.CollectionSpec) { s.Indexes[2].Fields = []string{"tenant"} }, true},
+		{"unique ordered", func(s *db.CollectionSpec) { s.Indexes[1].Unique = true }, true},
+		{"expiry index", func(s *db.CollectionSpec) {
+			s.Indexes[0] = db.IndexSpec{Fields: []string{"at"}, Kind: core.IndexExpiry}
+		}, true},
+		{"other ID field", func(s *db.CollectionSpec) { s.IDField = "id" }, true},
+		{"bad redaction", func(s *db.CollectionSpec) {
+			s.Redaction = &core.Redaction{Rules: []core.RedactRule{{Action: core.RedactDrop}}}
+		}, true},
+		// Found only once the collection exists, so it is dropped again
+		{"bad schema", func(s *db.CollectionSpec) { s.Schema = json.RawMessage(`{"type": 5}`) }, false},
+		{"empty index field", func(s *db.CollectionSpec) { s.Indexes[4].Fields = []string{""} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := ordersSpec()
+			tt.mutate(&spec)
+			err := database.CreateCollectionWithSpec(spec)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if tt.invalid != errors.Is(err, db.ErrInvalidSpec) {
+				t.Errorf("Expected ErrInvalidSpec %v, got %v", tt.invalid, err)
+			}
+			if _, err := database.Collection("orders"); !errors.Is(err, db.ErrCollectionNotFound) {
+				t.Errorf("Expected no collection left behind, got %v", err)
+			}
+		})
+	}
+
+	if err := database.CreateCollectionWithSpec(db.CollectionSpec{Name: "orders", Defaults: core.Document{"a": 1}}); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+	if err := database.CreateCollectionWithSpec(db.CollectionSpec{Name: "orders"}); !errors.Is(err, db.ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+type address struct {
+	City    string `json:"city"`
+	Country string `json:"country,omitempty"`
+}
+
+type profile struct {
+	ID       string    `json:"_id,omitempty"`
+	Name     string    `json:"name"`
+	Age      int       `json:"age"`
+	Nickname string    `json:"nickname,omitempty"`
+	Joined   time.Time `json:"joined"`
+	Address  address   `json:"address"`
+	Manager  *address  `json:"manager,omitempty"`
+	Tags     []string  `json:"tags"`
+	Secret   string    `json:"-"`
+}
+
+// nameOnly is a partial view of a profile
+type nameOnly struct {
+	Name    string `json:"name"`
+	Address struct {
+		City string `json:"city"`
+	} `json:"address"`
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	people, _ := database.Collection("people")
+
+	joined := time.Date(2024, 3, 1, 9, 30, 15, 123456789, time.FixedZone("CET", 3600))
+	in := profile{
+		Name:    "Ada",
+		Age:     36,
+		Joined:  joined,
+		Address: address{City: "London", Country: "UK"},
+		Manager: &address{City: "Paris"},
+		Tags:    []string{"math", "code"},
+		Secret:  "not stored",
+	}
+
+	id, err := db.InsertStruct(people, in)
+	if err != nil {
+		t.Fatalf("Failed to insert struct: %v", err)
+	}
+
+	out, err := db.GetStruct[profile](people, id)
+	if err != nil {
+		t.Fatalf("Failed to get struct: %v", err)
+	}
+	if !out.Joined.Equal(joined) {
+		t.Errorf("Expected joined %v, got %v", joined, out.Joined)
+	}
+
+	expected := in
+	expected.ID = string(id)
+	expected.Secret = ""
+	out.Joined = joined
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, out)
+	}
+
+	// omitempty fields are absent from the stored document, ignored ones too
+	doc, _ := people.Get(id)
+	for _, key := range []string{"nickname", "Secret"} {
+		if _, ok := doc[key]; ok {
+			t.Errorf("Expected no %s key, got %v", key, doc)
+		}
+	}
+
+	// A nil pointer with omitempty is left out and decodes as nil
+	db.InsertStruct(people, profile{ID: "p2", Name: "Bob", Joined: joined})
+	bob, _ := db.GetStruct[profile](people, "p2")
+	if bob.Manager != nil || bob.Tags != nil {
+		t.Errorf("Expected nil manager and tags, got %+v", bob)
+	}
+}
+
+func TestFindStruct(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	people, _ := database.Collection("people")
+	for i, name := range []string{"Ada", "Bob", "Cy"} {
+		db.InsertStruct(people, profile{Name: name, Age: 30 + i, Address: address{City: "London"}})
+	}
+
+	found, err := db.FindStruct[nameOnly](people, core.Query{
+		Filters: []core.Filter{{Field: "age", Operator: core.OpGreaterThan, Value: 30}},
+		Sort:    &core.SortOption{Field: "age"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to find structs: %v", err)
+	}
+	if len(found) != 2 || found[0].Name != "Bob" || found[1].Name != "Cy" || found[0].Address.City != "London" {
+		t.Errorf("Expected Bob and Cy, got %+v", found)
+	}
+
+	if _, err := db.InsertStruct(people, []string{"not", "an", "object"}); err == nil {
+		t.Errorf("Expected error inserting a non-object")
+	}
+}
+
+func TestUpdateStructKeepsUnknownFields(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	people, _ := database.Collection("people")
+	id, _ := db.InsertStruct(people, profile{
+		Name:     "Ada",
+		Age:      36,
+		Nickname: "countess",
+		Address:  address{City: "London", Country: "UK"},
+	})
+
+	var patch nameOnly
+	patch.Name = "Ada Lovelace"
+	patch.Address.City = "Marylebone"
+	if err := db.UpdateStruct(people, id, patch); err != nil {
+		t.Fatalf("Failed to update struct: %v", err)
+	}
+
+	out, _ := db.GetStruct[profile](people, id)
+	if out.Name != "Ada Lovelace" || out.Address.City != "Marylebone" {
+		t.Errorf("Expected the patched fields, got %+v", out)
+	}
+	if out.Age != 36 || out.Nickname != "countess" || out.Address.Country != "UK" {
+		t.Errorf("Expected fields outside the struct to be kept, got %+v", out)
+	}
+
+	// Keys encoded as null are removed, as in any JSON merge patch
+	if err := db.UpdateStruct(people, id, struct {
+		Nickname *string `json:"nickname"`
+	}{}); err != nil {
+		t.Fatalf("Failed to update struct: %v", err)
+	}
+	doc, _ := people.Get(id)
+	if _, ok := doc["nickname"]; ok || doc["name"] != "Ada Lovelace" {
+		t.Errorf("Expected only the nickname removed, got %v", doc)
+	}
+
+	if err := db.UpdateStruct(people, "missing", patch); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttr returns the value of an attribute of a span
+func spanAttr(span tracetest.SpanStub, key string) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	database := openDB(t, t.TempDir(), db.WithTracer(tp))
+	users, _ := database.Collection("users")
+	for _, id := range []string{"u1", "u2", "u3"} {
+		users.Insert(core.Document{"_id": id, "name": id})
+	}
+	exporter.Reset()
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "request")
+	docs, err := users.FindContext(ctx, core.Query{Filters: []core.Filter{
+		{Field: core.DocumentIDField, Operator: core.OpIn, Value: []interface{}{"u1", "u3", "missing"}},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to find documents: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("Expected 2 documents, got %d", len(docs))
+	}
+
+	tx := database.Begin()
+	tx.Put("users", "u4", core.Document{"name": "u4"})
+	if _, err := tx.CommitContext(ctx); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	root.End()
+
+	spans := exporter.GetSpans()
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+
+	queries := byName["query.Execute"]
+	if len(queries) != 1 {
+		t.Fatalf("Expected one query span, got %d", len(queries))
+	}
+	query := queries[0]
+	if query.Parent.SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("Expected the query span to be a child of the caller's span")
+	}
+	if v, _ := spanAttr(query, core.AttrCollection); v.AsString() != "users" {
+		t.Errorf("Expected the query span to name the collection, got %q", v.AsString())
+	}
+	if v, _ := spanAttr(query, core.AttrDocuments); v.AsInt64() != 2 {
+		t.Errorf("Expected the query span to count 2 documents, got %d", v.AsInt64())
+	}
+	if v, _ := spanAttr(query, "db.access"); v.AsString() != "primary" {
+		t.Errorf("Expected the query span to record its access path, got %q", v.AsString())
+	}
+
+	reads := byName["storage.ReadDocument"]
+	if len(reads) != 3 {
+		t.Fatalf("Expected 3 read spans, got %d", len(reads))
+	}
+	for _, read := range reads {
+		if read.Parent.SpanID() != query.SpanContext.SpanID() {
+			t.Errorf("Expected read span %v to be a child of the query span", read.Attributes)
+		}
+		if read.SpanContext.TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("Expected read span to share the caller's trace")
+		}
+	}
+	failed := 0
+	for _, read := range reads {
+		if read.Status.Code != 0 {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected the read of the missing document to fail, got %d failures", failed)
+	}
+
+	commits := byName["txn.Commit"]
+	if len(commits) != 1 || commits[0].Parent.SpanID() != root.SpanContext().SpanID() {
+		t.Fatalf("Expected one commit span under the caller's span, got %d", len(commits))
+	}
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+)
+
+func TestPurgeExpiredRemovesOnlyDueDocuments(t *testing.T) {
+	const n = 3000
+	database := openDB(t, t.TempDir())
+	sessions, _ := database.Collection("sessions")
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	err := sessions.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+		writes := make(map[core.DocumentID]core.Document, n+1)
+		for i := 0; i < n; i++ {
+			id := core.DocumentID(fmt.Sprintf("s%04d", i))
+			writes[id] = core.Document{"_id": string(id), "_expiresAt": core.Time(base.Add(time.Duration(i%100) * time.Minute))}
+		}
+		writes["forever"] = core.Document{"_id": "forever"}
+		return writes, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert sessions: %v", err)
+	}
+
+	if _, err := sessions.PurgeExpired(base); !errors.Is(err, index.ErrIndexNotFound) {
+		t.Errorf("Expected ErrIndexNotFound before EnableTTL, got %v", err)
+	}
+	if err := database.EnableTTL("sessions", ""); err != nil {
+		t.Fatalf("Failed to enable TTL: %v", err)
+	}
+
+	// An extended session outlives its cohort
+	if err := sessions.Update("s0000", core.Document{"_id": "s0000", "_expiresAt": core.Time(base.Add(time.Hour + 30*time.Second))}); err != nil {
+		t.Fatalf("Failed to extend session: %v", err)
+	}
+
+	next, ok, err := database.NextExpiry("sessions")
+	if err != nil || !ok || !next.Equal(base) {
+		t.Fatalf("Expected next expiry %s, got %s (%v, %v)", base, next, ok, err)
+	}
+
+	revision := func() uint64 {
+		r, err := database.Storage().CollectionRevision("sessions")
+		if err != nil {
+			t.Fatalf("Failed to get revision: %v", err)
+		}
+		return r
+	}
+
+	remaining := n
+	for minute := 0; minute < 100; minute += 10 {
+		now := base.Add(time.Duration(minute) * time.Minute)
+		before := revision()
+		purged, err := sessions.PurgeExpired(now)
+		if err != nil {
+			t.Fatalf("Failed to purge at minute %d: %v", minute, err)
+		}
+
+		// Each cohort of 30 documents expires once, at its minute
+		expected := 30 * 10
+		if minute == 0 {
+			expected = 30 - 1
+		}
+		if minute == 70 {
+			expected++ // The extended session
+		}
+		if purged != expected {
+			t.Errorf("Expected %d purged at minute %d, got %d", expected, minute, purged)
+		}
+		if after := revision(); after != before+1 {
+			t.Errorf("Expected one write per purge, revision went from %d to %d", before, after)
+		}
+		remaining -= purged
+
+		count, err := sessions.Count(core.Query{})
+		if err != nil {
+			t.Fatalf("Failed to count sessions: %v", err)
+		}
+		if count != remaining+1 {
+			t.Errorf("Expected %d sessions at minute %d, got %d", remaining+1, minute, count)
+		}
+		next, ok, err := database.NextExpiry("sessions")
+		if err != nil || !ok || !next.After(now) {
+			t.Errorf("Expected next expiry after %s, got %s (%v, %v)", now, next, ok, err)
+		}
+	}
+
+	// Nothing due means no write at all
+	before := revision()
+	if purged, err := sessions.PurgeExpired(base.Add(90*time.Minute + time.Second)); err != nil || purged != 0 {
+		t.Errorf("Expected nothing purged, got %d (%v)", purged, err)
+	}
+	if revision() != before {
+		t.Errorf("Expected no write when nothing is due")
+	}
+}
+
+func TestTTLSurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.Open(dir)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	sessions, _ := database.Collection("sessions")
+	if err := database.EnableTTL("sessions", "expires"); err != nil {
+		t.Fatalf("Failed to enable TTL: %v", err)
+	}
+	past := core.Time(time.Now().Add(-time.Minute))
+	sessions.Insert(core.Document{"_id": "old", "expires": past})
+	sessions.Insert(core.Document{"_id": "new", "expires": core.Time(time.Now().Add(time.Hour))})
+	if err := database.Close(); err != nil {
+		t.Fatalf("Failed to close database: %v", err)
+	}
+
+	database = openDB(t, dir)
+	purged, err := database.PurgeExpired(time.Now())
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected 1 purged after reopening, got %d (%v)", purged, err)
+	}
+	sessions, _ = database.Collection("sessions")
+	if _, err := sessions.Get("old"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected the expired session to be gone, got %v", err)
+	}
+}
+
+func TestStartTTLPurge(t *testing.T) {
+	database := openDB(t, t.TempDir())
+	sessions, _ := database.Collection("sessions")
+	if err := database.EnableTTL("sessions", ""); err != nil {
+		t.Fatalf("Failed to enable TTL: %v", err)
+	}
+	sessions.Insert(core.Document{"_id": "soon", "_expiresAt": core.Time(time.Now().Add(50 * time.Millisecond))})
+	sessions.Insert(core.Document{"_id": "later", "_expiresAt": core.Time(time.Now().Add(time.Hour))})
+
+	stop := database.StartTTLPurge(10 * time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := sessions.Get("soon"); errors.Is(err, core.ErrDocumentNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the expired session to be purged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := sessions.Get("later"); err != nil {
+		t.Errorf("Expected the live session to remain, got %v", err)
+	}
+
+	report, err := database.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to check health: %v", err)
+	}
+	for _, check := range report.Checks {
+		if check.Name == "ttl_purge" && check.Status != db.HealthOK {
+			t.Errorf("Expected the ttl_purge check to pass, got %+v", check)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+// verifyKinds returns the kind and file name of each issue, sorted
+func verifyKinds(report storage.VerifyReport) []string {
+	var kinds []string
+	for _, issue := range report.Issues {
+		kinds = append(kinds, string(issue.Kind)+" "+filepath.Base(issue.Path))
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func TestVerifyDataDirIndexes(t *testing.T) {
+	dir := t.TempDir()
+	database := openDB(t, dir)
+	for _, name := range []string{"users", "orders", "events"} {
+		c, _ := database.Collection(name)
+		c.Insert(core.Document{"_id": "a", "status": "new"})
+		if err := database.Indexes().CreateSecondaryIndex(name, "status", core.IndexHash); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+	tenant, _ := database.Namespace("acme")
+	tenant.Collection("users")
+	database.Close()
+
+	if report, err := db.VerifyDataDir(dir, db.VerifyOptions{}); err != nil || len(report.Issues) != 0 {
+		t.Fatalf("Expected a clean database, got %v, %v", verifyKinds(report), err)
+	}
+
+	// A bad checksum, a file that does not parse, a write the index missed
+	// and indexes without a collection
+	path := filepath.Join(dir, "users.idx.json")
+	var file map[string]interface{}
+	json.Unmarshal([]byte(mustRead(t, path)), &file)
+	file["checksum"] = "bad"
+	data, _ := json.Marshal(file)
+	os.WriteFile(path, data, 0644)
+	os.WriteFile(filepath.Join(dir, "events.idx.json"), []byte("{"), 0644)
+
+	engine, _ := storage.NewFileStorageEngine(dir)
+	engine.WriteDocument("orders", "b", core.Document{"status": "paid"})
+	engine.Close()
+
+	os.WriteFile(filepath.Join(dir, "ghost.idx.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dir, storage.NamespaceDir, "acme", "ghost.idx.json"), []byte("{}"), 0644)
+
+	report, err := db.VerifyDataDir(dir, db.VerifyOptions{})
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	expected := []string{"corrupt_index events.idx.json", "corrupt_index users.idx.json", "orphan_file ghost.idx.json", "orphan_file ghost.idx.json", "stale_index orders.idx.json"}
+	if got := verifyKinds(report); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	// Rebuilding keeps the definitions; removing a file that does not parse
+	// loses them, so it needs AllowDestructive
+	report, _ = db.VerifyDataDir(dir, db.VerifyOptions{Repair: true})
+	for _, issue := range report.Issues {
+		if destructive := issue.Repair == storage.RepairDestructive; issue.Repaired == destructive {
+			t.Errorf("Expected %s to be repaired only if safe, got %+v", issue.Path, issue)
+		}
+	}
+	report, _ = db.VerifyDataDir(dir, db.VerifyOptions{Repair: true, AllowDestructive: true})
+	if len(report.Issues) != 1 || !report.Issues[0].Repaired {
+		t.Errorf("Expected the unparsable index file removed, got %+v", report.Issues)
+	}
+	database = openDB(t, dir)
+	if ids, _ := database.Indexes().LookupSecondaryIDs("orders", "status", "paid"); len(ids) != 1 {
+		t.Errorf("Expected the rebuilt index to find the missed write, got %v", ids)
+	}
+	database.Close()
+	if report, _ := db.VerifyDataDir(dir, db.VerifyOptions{}); len(report.Issues) != 0 {
+		t.Errorf("Expected a clean database after repair, got %v", verifyKinds(report))
+	}
+}
+
+// mustRead returns the content of a file
+func mustRead(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
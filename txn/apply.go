@@ -0,0 +1,82 @@
+package txn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+// ApplyOptions configures ApplyOperations
+type ApplyOptions struct {
+	// Upsert makes an insert of an existing document replace it and an update
+	// of a missing document insert it. Without it both fail the batch.
+	Upsert bool
+}
+
+// ApplyOperations applies a recorded batch of operations atomically: every
+// operation lands or none does, across all the collections involved.
+// Operations apply in order, so an insert followed by an update of the same
+// document succeeds. Deleting a missing document is not an error.
+func (m *TransactionManager) ApplyOperations(ops []core.Operation, opts ApplyOptions) error {
+	seen := make(map[string]struct{})
+	collections := []string{}
+	for i, op := range ops {
+		if err := validateOperation(op); err != nil {
+			return fmt.Errorf("invalid operation %d: %w", i, err)
+		}
+		if _, ok := seen[op.Collection]; !ok {
+			seen[op.Collection] = struct{}{}
+			collections = append(collections, op.Collection)
+		}
+	}
+	sort.Strings(collections)
+
+	return m.apply(context.Background(), collections, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		writes := make(map[string]map[core.DocumentID]core.Document, len(collections))
+		for i, op := range ops {
+			pending, ok := writes[op.Collection]
+			if !ok {
+				pending = make(map[core.DocumentID]core.Document)
+				writes[op.Collection] = pending
+			}
+
+			doc, written := pending[op.DocID]
+			if !written {
+				doc = docs[op.Collection][op.DocID]
+			}
+			exists := doc != nil
+
+			switch {
+			case op.Type == core.OpInsert && exists && !opts.Upsert:
+				return nil, fmt.Errorf("failed to apply operation %d on %s/%s: %w", i, op.Collection, op.DocID, core.ErrDocumentExists)
+			case op.Type == core.OpUpdate && !exists && !opts.Upsert:
+				return nil, fmt.Errorf("failed to apply operation %d on %s/%s: %w", i, op.Collection, op.DocID, core.ErrDocumentNotFound)
+			case op.Type == core.OpDelete:
+				pending[op.DocID] = nil
+			default:
+				pending[op.DocID] = op.Document.Clone()
+			}
+		}
+		return writes, nil
+	})
+}
+
+// validateOperation checks that an operation is complete and of a known type
+func validateOperation(op core.Operation) error {
+	if op.Collection == "" || op.DocID == "" {
+		return fmt.Errorf("missing collection or document ID")
+	}
+
+	switch op.Type {
+	case core.OpInsert, core.OpUpdate:
+		if op.Document == nil {
+			return fmt.Errorf("missing document for %s/%s", op.Collection, op.DocID)
+		}
+	case core.OpDelete:
+	default:
+		return fmt.Errorf("unknown operation type %d", op.Type)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package txn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestApplyOperations(t *testing.T) {
+	manager, engine, indexes := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"name": "ada"})
+	if err := indexes.CreateSecondaryIndex("orders", "user", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	ops := []core.Operation{
+		{Type: core.OpInsert, Collection: "users", DocID: "u2", Document: core.Document{"name": "bob"}},
+		{Type: core.OpUpdate, Collection: "users", DocID: "u2", Document: core.Document{"name": "bob", "vip": true}},
+		{Type: core.OpInsert, Collection: "orders", DocID: "o1", Document: core.Document{"user": "u2"}},
+		{Type: core.OpDelete, Collection: "users", DocID: "u1"},
+		{Type: core.OpDelete, Collection: "users", DocID: "missing"},
+	}
+	if err := manager.ApplyOperations(ops, ApplyOptions{}); err != nil {
+		t.Fatalf("Failed to apply operations: %v", err)
+	}
+
+	if doc, _ := engine.ReadDocument("users", "u2"); doc["vip"] != true {
+		t.Errorf("Expected the update after the insert to apply, got %v", doc)
+	}
+	if _, err := engine.ReadDocument("users", "u1"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected u1 deleted, got %v", err)
+	}
+	if ids, _ := indexes.LookupSecondaryIDs("orders", "user", "u2"); len(ids) != 1 {
+		t.Errorf("Expected o1 indexed, got %v", ids)
+	}
+}
+
+func TestApplyOperationsStrictAndUpsert(t *testing.T) {
+	tests := []struct {
+		name   string
+		op     core.Operation
+		strict error // Expected error without Upsert
+	}{
+		{
+			name:   "insert existing",
+			op:     core.Operation{Type: core.OpInsert, Collection: "users", DocID: "u1", Document: core.Document{"name": "new"}},
+			strict: core.ErrDocumentExists,
+		},
+		{
+			name:   "update missing",
+			op:     core.Operation{Type: core.OpUpdate, Collection: "users", DocID: "u9", Document: core.Document{"name": "new"}},
+			strict: core.ErrDocumentNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, engine, _ := setupTestManager(t)
+			engine.WriteDocument("users", "u1", core.Document{"name": "ada"})
+
+			// The failing operation rejects the whole batch
+			ops := []core.Operation{
+				{Type: core.OpInsert, Collection: "logs", DocID: "l1", Document: core.Document{"ok": true}},
+				tt.op,
+			}
+			if err := manager.ApplyOperations(ops, ApplyOptions{}); !errors.Is(err, tt.strict) {
+				t.Fatalf("Expected %v, got %v", tt.strict, err)
+			}
+			if _, err := engine.ReadDocument("logs", "l1"); !errors.Is(err, core.ErrDocumentNotFound) {
+				t.Errorf("Expected nothing applied, got %v", err)
+			}
+
+			if err := manager.ApplyOperations(ops, ApplyOptions{Upsert: true}); err != nil {
+				t.Fatalf("Failed to upsert: %v", err)
+			}
+			if doc, _ := engine.ReadDocument("users", tt.op.DocID); doc["name"] != "new" {
+				t.Errorf("Expected the upserted document, got %v", doc)
+			}
+		})
+	}
+}
+
+func TestApplyOperationsValidation(t *testing.T) {
+	manager, _, _ := setupTestManager(t)
+
+	tests := []struct {
+		name string
+		op   core.Operation
+	}{
+		{"unknown type", core.Operation{Type: core.OperationType(9), Collection: "users", DocID: "u1"}},
+		{"missing collection", core.Operation{Type: core.OpDelete, DocID: "u1"}},
+		{"missing document ID", core.Operation{Type: core.OpDelete, Collection: "users"}},
+		{"missing document", core.Operation{Type: core.OpInsert, Collection: "users", DocID: "u1"}},
+	}
+	for _, tt := range tests {
+		if err := manager.ApplyOperations([]core.Operation{tt.op}, ApplyOptions{}); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+
+	if err := manager.ApplyOperations(nil, ApplyOptions{}); err != nil {
+		t.Errorf("Expected an empty batch to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryOptions configures RunInTransaction
+type RetryOptions struct {
+	// MaxAttempts caps the number of times fn is run (default 10)
+	MaxAttempts int
+
+	// BaseDelay is the backoff before the second attempt, doubled after each
+	// further conflict (default 1ms)
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff between attempts (default 100ms)
+	MaxDelay time.Duration
+}
+
+// RunInTransaction runs fn in a snapshot transaction and commits it. When the
+// commit fails with ErrTxnConflict it waits with exponential backoff and
+// jitter, then runs fn again in a fresh transaction, up to MaxAttempts times.
+//
+// fn may therefore run several times and must have no effects outside the
+// transaction it is given. An error returned by fn rolls the transaction
+// back and is returned without retrying.
+func RunInTransaction(ctx context.Context, mgr *TransactionManager, fn func(tx *Txn) error, opts RetryOptions) error {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = time.Millisecond
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 100 * time.Millisecond
+	}
+
+	delay := opts.BaseDelay
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err = runOnce(mgr, fn); !errors.Is(err, ErrTxnConflict) {
+			return err
+		}
+		if attempt == opts.MaxAttempts {
+			return fmt.Errorf("failed after %d attempts: %w", attempt, err)
+		}
+
+		// Wait between delay/2 and delay so contending callers spread out
+		wait := delay/2 + rand.N(delay/2+1)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, opts.MaxDelay)
+	}
+}
+
+// runOnce runs fn in a new snapshot transaction and commits it, rolling back
+// on failure
+func runOnce(mgr *TransactionManager, fn func(tx *Txn) error) error {
+	tx := mgr.Begin(WithSnapshot())
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+)
+
+func TestRunInTransactionConcurrentIncrements(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("counters", "hits", core.Document{"n": 0})
+
+	increment := func(tx *Txn) error {
+		doc, err := tx.Read("counters", "hits")
+		if err != nil {
+			return err
+		}
+		n, _ := core.ToFloat64(doc["n"])
+		return tx.Put("counters", "hits", core.Document{"n": n + 1})
+	}
+
+	const workers, increments = 2, 500
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if err := RunInTransaction(context.Background(), manager, increment, RetryOptions{MaxAttempts: 100}); err != nil {
+					t.Errorf("Failed to increment: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	doc, err := engine.ReadDocument("counters", "hits")
+	if err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	if doc["n"] != float64(workers*increments) {
+		t.Errorf("Expected counter %d, got %v", workers*increments, doc["n"])
+	}
+}
+
+func TestRunInTransactionErrors(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("counters", "hits", core.Document{"n": 0})
+
+	// An error from fn aborts without retrying or writing
+	boom := errors.New("boom")
+	calls := 0
+	err := RunInTransaction(context.Background(), manager, func(tx *Txn) error {
+		calls++
+		tx.Put("counters", "hits", core.Document{"n": 1})
+		return boom
+	}, RetryOptions{})
+	if !errors.Is(err, boom) || calls != 1 {
+		t.Errorf("Expected boom after one call, got %v after %d", err, calls)
+	}
+	if doc, _ := engine.ReadDocument("counters", "hits"); doc["n"] != float64(0) {
+		t.Errorf("Expected counter untouched, got %v", doc)
+	}
+
+	// A conflict on every attempt gives up after MaxAttempts
+	calls = 0
+	err = RunInTransaction(context.Background(), manager, func(tx *Txn) error {
+		calls++
+		tx.Put("counters", "hits", core.Document{"n": calls})
+		return engine.WriteDocument("counters", "hits", core.Document{"n": -calls})
+	}, RetryOptions{MaxAttempts: 3})
+	if !errors.Is(err, ErrTxnConflict) || calls != 3 {
+		t.Errorf("Expected ErrTxnConflict after 3 calls, got %v after %d", err, calls)
+	}
+
+	// A cancelled context stops before the next attempt
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = RunInTransaction(ctx, manager, func(tx *Txn) error {
+		calls++
+		cancel()
+		tx.Put("counters", "hits", core.Document{"n": calls})
+		return engine.WriteDocument("counters", "hits", core.Document{"n": -calls})
+	}, RetryOptions{})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Expected context.Canceled after one call, got %v after %d", err, calls)
+	}
+}
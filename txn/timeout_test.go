@@ -0,0 +1,110 @@
+package txn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func TestCommitOppositeOrdersDoNotDeadlock(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("a", "doc", core.Document{"n": 0})
+	engine.WriteDocument("b", "doc", core.Document{"n": 0})
+
+	// Half the transactions write a then b, the other half b then a
+	const workers, rounds = 4, 25
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		first, second := "a", "b"
+		if i%2 == 1 {
+			first, second = "b", "a"
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rounds; j++ {
+				tx := manager.Begin()
+				tx.Put(first, "doc", core.Document{"n": j})
+				tx.Put(second, "doc", core.Document{"n": j})
+				if _, err := tx.Commit(); err != nil {
+					t.Errorf("Failed to commit: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Transactions locking in opposite orders deadlocked")
+	}
+}
+
+func TestCommitTimeout(t *testing.T) {
+	dir := t.TempDir()
+	engine, err := storage.NewFileStorageEngine(dir)
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	defer engine.Close()
+	indexes, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	manager := NewTransactionManager(engine, indexes)
+
+	// Another process holds the lock on collection b
+	lockFile, err := os.OpenFile(filepath.Join(dir, "b.lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open lock file: %v", err)
+	}
+	defer lockFile.Close()
+	if err := syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	tx := manager.Begin(WithTimeout(50 * time.Millisecond))
+	tx.Put("a", "doc", core.Document{"n": 1})
+	tx.Put("b", "doc", core.Document{"n": 1})
+
+	start := time.Now()
+	_, err = tx.Commit()
+	if !errors.Is(err, ErrTxnTimeout) {
+		t.Fatalf("Expected ErrTxnTimeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "collection b") {
+		t.Errorf("Expected the error to name collection b, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the commit to give up promptly, took %v", elapsed)
+	}
+
+	// The lock on a was released and nothing was written
+	if err := engine.WriteDocument("a", "other", core.Document{}); err != nil {
+		t.Errorf("Expected collection a to be writable: %v", err)
+	}
+	if _, err := engine.ReadDocument("a", "doc"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected nothing committed, got %v", err)
+	}
+
+	// An expired transaction still times out without waiting
+	syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	if _, err := tx.Commit(); !errors.Is(err, ErrTxnTimeout) {
+		t.Errorf("Expected ErrTxnTimeout once the deadline passed, got %v", err)
+	}
+}
@@ -0,0 +1,460 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrTxnCommitted is returned when a committed transaction is used again
+	ErrTxnCommitted = errors.New("transaction already committed")
+	// ErrTxnRolledBack is returned when a rolled-back transaction is used again
+	ErrTxnRolledBack = errors.New("transaction rolled back")
+	// ErrTxnConflict is returned when a snapshot transaction writes a document
+	// that was modified after its snapshot was taken
+	ErrTxnConflict = errors.New("transaction conflict")
+	// ErrSavepointNotFound is returned when rolling back to or releasing a
+	// savepoint that does not exist or was already released
+	ErrSavepointNotFound = errors.New("savepoint not found")
+	// ErrTxnTimeout is returned when a transaction's timeout expires while it
+	// waits for a lock
+	ErrTxnTimeout = errors.New("transaction timed out")
+)
+
+// TransactionManager runs transactions against a storage engine. The index
+// manager is optional; when set, commits keep its indexes up to date.
+type TransactionManager struct {
+	storage core.StorageEngine
+	indexes core.IndexManager
+	seq     atomic.Uint64
+	tracer  trace.Tracer // Set by SetTracerProvider; nil traces nothing
+}
+
+// NewTransactionManager creates a transaction manager. The storage engine
+// must support batch writes for commits to succeed.
+func NewTransactionManager(storage core.StorageEngine, indexes core.IndexManager) *TransactionManager {
+	return &TransactionManager{
+		storage: storage,
+		indexes: indexes,
+	}
+}
+
+// tracerName is the instrumentation scope of the manager's spans
+const tracerName = "github.com/HakashiKatake/Go-Json-Database/txn"
+
+// SetTracerProvider records commits as spans of tracers from tp. A nil tp
+// traces nothing.
+func (m *TransactionManager) SetTracerProvider(tp trace.TracerProvider) {
+	m.tracer = nil
+	if tp != nil {
+		m.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// txnState is the lifecycle state of a transaction
+type txnState int
+
+const (
+	txnActive txnState = iota
+	txnCommitted
+	txnRolledBack
+)
+
+// Txn buffers writes until they are committed or rolled back. Reads see the
+// transaction's own writes first. A Txn is safe for concurrent use.
+type Txn struct {
+	manager *TransactionManager
+	id      string
+
+	mu         sync.Mutex
+	state      txnState
+	ops        []core.Operation
+	writes     map[string]map[core.DocumentID]core.Document // Latest write per document; nil deletes
+	snapshots  map[string]map[core.DocumentID]core.Document // Collection state at first touch; nil reads live data
+	savepoints []savepoint                                  // Innermost last
+	deadline   time.Time                                    // Zero for no timeout
+}
+
+// savepoint marks a position in the buffered operations
+type savepoint struct {
+	name string
+	ops  int // Number of operations buffered when the savepoint was set
+}
+
+// Option configures a transaction
+type Option func(*Txn)
+
+// WithSnapshot gives the transaction snapshot isolation. Each collection is
+// captured the first time the transaction reads or writes it, and later reads
+// see that capture plus the transaction's own writes, whatever is committed
+// meanwhile. Commit fails with ErrTxnConflict if a document the transaction
+// writes was modified after its collection was captured, so the first
+// writer wins.
+//
+// Collections are captured one at a time, so the snapshots of two
+// collections may reflect different points in time.
+func WithSnapshot() Option {
+	return func(t *Txn) {
+		t.snapshots = make(map[string]map[core.DocumentID]core.Document)
+	}
+}
+
+// WithTimeout bounds how long the transaction may run. Once d has passed
+// since Begin, a commit waiting for collection locks gives up with
+// ErrTxnTimeout, releasing the locks it already holds.
+func WithTimeout(d time.Duration) Option {
+	return func(t *Txn) {
+		t.deadline = time.Now().Add(d)
+	}
+}
+
+// Begin starts a transaction
+func (m *TransactionManager) Begin(opts ...Option) *Txn {
+	t := &Txn{
+		manager: m,
+		id:      fmt.Sprintf("%d-%d", time.Now().UnixNano(), m.seq.Add(1)),
+		writes:  make(map[string]map[core.DocumentID]core.Document),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// ID returns the transaction's ID
+func (t *Txn) ID() string {
+	return t.id
+}
+
+// check returns the error for using a finished transaction. Callers must hold t.mu.
+func (t *Txn) check() error {
+	switch t.state {
+	case txnCommitted:
+		return ErrTxnCommitted
+	case txnRolledBack:
+		return ErrTxnRolledBack
+	}
+	return nil
+}
+
+// Put buffers a write of a document, inserting or replacing it on commit
+func (t *Txn) Put(collection string, docID core.DocumentID, doc core.Document) error {
+	if collection == "" || docID == "" {
+		return fmt.Errorf("missing collection or document ID - unable to write")
+	}
+	if doc == nil {
+		return fmt.Errorf("missing document for %s - use Delete to remove it", docID)
+	}
+	return t.buffer(collection, docID, doc.Clone())
+}
+
+// Delete buffers the deletion of a document. Deleting a document that does
+// not exist at commit time is not an error.
+func (t *Txn) Delete(collection string, docID core.DocumentID) error {
+	if collection == "" || docID == "" {
+		return fmt.Errorf("missing collection or document ID - unable to delete")
+	}
+	return t.buffer(collection, docID, nil)
+}
+
+// buffer records a write, with a nil document for a delete
+func (t *Txn) buffer(collection string, docID core.DocumentID, doc core.Document) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return err
+	}
+	if t.snapshots != nil {
+		if _, err := t.snapshot(collection); err != nil {
+			return err
+		}
+	}
+
+	writes, ok := t.writes[collection]
+	if !ok {
+		writes = make(map[core.DocumentID]core.Document)
+		t.writes[collection] = writes
+	}
+	writes[docID] = doc
+
+	op := core.Operation{Type: core.OpUpdate, Collection: collection, DocID: docID, Document: doc}
+	if doc == nil {
+		op.Type = core.OpDelete
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+// Read returns a document as the transaction sees it: its own latest write,
+// or else the stored document, as of the snapshot for snapshot transactions.
+// A document the transaction deleted is core.ErrDocumentNotFound.
+func (t *Txn) Read(collection string, docID core.DocumentID) (core.Document, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return nil, err
+	}
+
+	doc, found := t.writes[collection][docID]
+	if !found {
+		if t.snapshots == nil {
+			return t.manager.storage.ReadDocument(collection, docID)
+		}
+
+		docs, err := t.snapshot(collection)
+		if err != nil {
+			return nil, err
+		}
+		doc = docs[docID]
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", collection, docID, core.ErrDocumentNotFound)
+	}
+	return doc.Clone(), nil
+}
+
+// snapshot returns the captured documents of a collection, capturing them on
+// first use. Callers must hold t.mu.
+func (t *Txn) snapshot(collection string) (map[core.DocumentID]core.Document, error) {
+	if docs, ok := t.snapshots[collection]; ok {
+		return docs, nil
+	}
+
+	docs := make(map[core.DocumentID]core.Document)
+	err := t.manager.storage.ScanCollection(collection, func(docID core.DocumentID, doc core.Document) bool {
+		docs[docID] = doc.Clone()
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot collection %s: %w", collection, err)
+	}
+	t.snapshots[collection] = docs
+	return docs, nil
+}
+
+// checkConflicts returns ErrTxnConflict if a document the transaction writes
+// differs from its snapshot. Transactions without a snapshot never conflict.
+func (t *Txn) checkConflicts(docs map[string]map[core.DocumentID]core.Document) error {
+	if t.snapshots == nil {
+		return nil
+	}
+
+	for collection, writes := range t.writes {
+		for docID := range writes {
+			current, exists := docs[collection][docID]
+			captured, existed := t.snapshots[collection][docID]
+			if exists != existed || !reflect.DeepEqual(current, captured) {
+				return fmt.Errorf("%s/%s modified since snapshot: %w", collection, docID, ErrTxnConflict)
+			}
+		}
+	}
+	return nil
+}
+
+// Savepoint marks the current point in the transaction so that later writes
+// can be undone with RollbackTo. Savepoints nest; a name reused while the
+// earlier savepoint is still set hides it until the newer one is released.
+func (t *Txn) Savepoint(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return err
+	}
+	t.savepoints = append(t.savepoints, savepoint{name: name, ops: len(t.ops)})
+	return nil
+}
+
+// RollbackTo discards the writes buffered since the named savepoint and any
+// savepoints set after it. The savepoint itself stays set, so it can be
+// rolled back to again.
+func (t *Txn) RollbackTo(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return err
+	}
+	i, err := t.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+
+	t.ops = t.ops[:t.savepoints[i].ops]
+	t.savepoints = t.savepoints[:i+1]
+
+	// Rebuild the latest write per document from the remaining operations
+	t.writes = make(map[string]map[core.DocumentID]core.Document)
+	for _, op := range t.ops {
+		writes, ok := t.writes[op.Collection]
+		if !ok {
+			writes = make(map[core.DocumentID]core.Document)
+			t.writes[op.Collection] = writes
+		}
+		writes[op.DocID] = op.Document
+	}
+	return nil
+}
+
+// Release removes the named savepoint and any savepoints set after it,
+// keeping their writes
+func (t *Txn) Release(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return err
+	}
+	i, err := t.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	t.savepoints = t.savepoints[:i]
+	return nil
+}
+
+// findSavepoint returns the position of the innermost savepoint with a name.
+// Callers must hold t.mu.
+func (t *Txn) findSavepoint(name string) (int, error) {
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if t.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to find savepoint %q: %w", name, ErrSavepointNotFound)
+}
+
+// Rollback discards the buffered writes. Rolling back twice is a no-op, but a
+// committed transaction cannot be rolled back.
+func (t *Txn) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.state == txnCommitted {
+		return ErrTxnCommitted
+	}
+	t.state = txnRolledBack
+	t.ops, t.writes, t.snapshots, t.savepoints = nil, nil, nil, nil
+	return nil
+}
+
+// Commit applies every buffered write atomically and returns the record of
+// the committed transaction. Each Put is recorded as an insert or update
+// according to whether the document existed when it was applied.
+//
+// Writes to one collection are applied as a single batch under the
+// collection lock, so readers see all of them or none. Writes spanning
+// several collections are committed through the storage engine's batch
+// journal, so they land in every collection or none, even across a crash.
+// A transaction begun WithTimeout fails with ErrTxnTimeout if the locks are
+// not acquired in time.
+// On failure nothing is applied and the transaction stays open, to be
+// retried or rolled back. A snapshot transaction that fails with
+// ErrTxnConflict will keep conflicting, so it should be rolled back and
+// started again.
+func (t *Txn) Commit() (core.Transaction, error) {
+	return t.CommitContext(context.Background())
+}
+
+// CommitContext is Commit, traced as a child of the span in ctx. Waits for
+// collection locks also give up once ctx is done.
+func (t *Txn) CommitContext(ctx context.Context) (_ core.Transaction, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.check(); err != nil {
+		return core.Transaction{}, err
+	}
+
+	collections := make([]string, 0, len(t.writes))
+	for collection := range t.writes {
+		collections = append(collections, collection)
+	}
+	sort.Strings(collections)
+
+	if tracer := t.manager.tracer; tracer != nil {
+		var span trace.Span
+		ctx, span = tracer.Start(ctx, "txn.Commit", trace.WithAttributes(
+			attribute.String("db.transaction.id", t.id),
+			attribute.StringSlice("db.collections", collections),
+			attribute.Int(core.AttrDocuments, len(t.ops)),
+		))
+		defer func() { core.EndSpan(span, err) }()
+	}
+
+	if !t.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, t.deadline, ErrTxnTimeout)
+		defer cancel()
+		if ctx.Err() != nil {
+			return core.Transaction{}, fmt.Errorf("failed to commit transaction %s: %w", t.id, context.Cause(ctx))
+		}
+	}
+
+	var ops []core.Operation
+	err = t.manager.apply(ctx, collections, func(docs map[string]map[core.DocumentID]core.Document) (map[string]map[core.DocumentID]core.Document, error) {
+		if err := t.checkConflicts(docs); err != nil {
+			return nil, err
+		}
+		ops = resolveOps(t.ops, docs)
+		return t.writes, nil
+	})
+	if err != nil {
+		return core.Transaction{}, fmt.Errorf("failed to commit transaction %s: %w", t.id, err)
+	}
+
+	t.state = txnCommitted
+	t.writes, t.snapshots, t.savepoints = nil, nil, nil
+	return core.Transaction{ID: t.id, Operations: ops, Committed: true}, nil
+}
+
+// resolveOps types each Put as an insert or update by replaying the
+// operations over the existence of documents before the commit
+func resolveOps(buffered []core.Operation, docs map[string]map[core.DocumentID]core.Document) []core.Operation {
+	type key struct {
+		collection string
+		docID      core.DocumentID
+	}
+
+	exists := make(map[key]bool)
+	ops := make([]core.Operation, len(buffered))
+	for i, op := range buffered {
+		k := key{op.Collection, op.DocID}
+		present, seen := exists[k]
+		if !seen {
+			_, present = docs[op.Collection][op.DocID]
+		}
+
+		if op.Type != core.OpDelete && !present {
+			op.Type = core.OpInsert
+		}
+		exists[k] = op.Type != core.OpDelete
+		ops[i] = op
+	}
+	return ops
+}
+
+// apply applies writes to collections atomically, through the index manager
+// when it supports batches so indexes stay consistent. Locks are taken in
+// collection name order, so concurrent commits cannot deadlock; waits for
+// them give up once ctx is done.
+func (m *TransactionManager) apply(ctx context.Context, collections []string, fn core.MultiBatchFunc) error {
+	if len(collections) == 0 {
+		_, err := fn(nil)
+		return err
+	}
+	return index.WriteMultiBatch(ctx, m.storage, m.indexes, collections, fn)
+}
@@ -0,0 +1,416 @@
+package txn
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/index"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+func setupTestManager(t *testing.T) (*TransactionManager, *storage.FileStorageEngine, *index.FileIndexManager) {
+	engine, err := storage.NewFileStorageEngine(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	indexes, err := index.NewFileIndexManager(engine, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create index manager: %v", err)
+	}
+	return NewTransactionManager(engine, indexes), engine, indexes
+}
+
+func TestCommit(t *testing.T) {
+	manager, engine, indexes := setupTestManager(t)
+	engine.WriteDocument("accounts", "a1", core.Document{"owner": "ada", "balance": 100})
+	engine.WriteDocument("accounts", "a2", core.Document{"owner": "bob", "balance": 50})
+	if err := indexes.CreateSecondaryIndex("accounts", "owner", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	revision, _ := engine.CollectionRevision("accounts")
+
+	tx := manager.Begin()
+	tx.Put("accounts", "a1", core.Document{"owner": "ada", "balance": 70})
+	tx.Put("accounts", "a3", core.Document{"owner": "cy", "balance": 30})
+	tx.Delete("accounts", "a2")
+
+	// Nothing is visible before the commit
+	if _, err := engine.ReadDocument("accounts", "a3"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected a3 to be invisible before commit, got %v", err)
+	}
+
+	record, err := tx.Commit()
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if !record.Committed || record.ID != tx.ID() {
+		t.Errorf("Expected a committed record for %s, got %+v", tx.ID(), record)
+	}
+	types := []core.OperationType{}
+	for _, op := range record.Operations {
+		types = append(types, op.Type)
+	}
+	if expected := []core.OperationType{core.OpUpdate, core.OpInsert, core.OpDelete}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected operation types %v, got %v", expected, types)
+	}
+
+	// One atomic rewrite of the collection
+	if next, _ := engine.CollectionRevision("accounts"); next != revision+1 {
+		t.Errorf("Expected revision %d, got %d", revision+1, next)
+	}
+	doc, err := engine.ReadDocument("accounts", "a1")
+	if err != nil || doc["balance"] != 70.0 {
+		t.Errorf("Expected balance 70, got %v (%v)", doc, err)
+	}
+	if _, err := engine.ReadDocument("accounts", "a2"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected a2 deleted, got %v", err)
+	}
+
+	// Indexes follow the commit
+	docs, err := indexes.LookupSecondary("accounts", "owner", "cy")
+	if err != nil || len(docs) != 1 {
+		t.Errorf("Expected the index to hold a3, got %v (%v)", docs, err)
+	}
+	if docs, _ := indexes.LookupSecondary("accounts", "owner", "bob"); len(docs) != 0 {
+		t.Errorf("Expected bob removed from the index, got %v", docs)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("accounts", "a1", core.Document{"balance": 100})
+	engine.WriteDocument("accounts", "a2", core.Document{"balance": 50})
+
+	tx := manager.Begin()
+	doc := core.Document{"balance": 70}
+	tx.Put("accounts", "a1", doc)
+	tx.Delete("accounts", "a2")
+
+	// Later changes to the caller's document do not leak into the buffer
+	doc["balance"] = 0
+
+	got, err := tx.Read("accounts", "a1")
+	if err != nil || got["balance"] != 70 {
+		t.Errorf("Expected the buffered balance 70, got %v (%v)", got, err)
+	}
+	if _, err := tx.Read("accounts", "a2"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected a2 deleted within the transaction, got %v", err)
+	}
+
+	// Other readers still see the stored documents
+	stored, _ := engine.ReadDocument("accounts", "a1")
+	if stored["balance"] != 100.0 {
+		t.Errorf("Expected the stored balance 100, got %v", stored["balance"])
+	}
+
+	// Documents the transaction has not touched come from storage
+	other := manager.Begin()
+	if got, err := other.Read("accounts", "a2"); err != nil || got["balance"] != 50.0 {
+		t.Errorf("Expected the stored a2, got %v (%v)", got, err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("accounts", "a1", core.Document{"balance": 100})
+
+	tx := manager.Begin()
+	tx.Put("accounts", "a1", core.Document{"balance": 0})
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+
+	doc, _ := engine.ReadDocument("accounts", "a1")
+	if doc["balance"] != 100.0 {
+		t.Errorf("Expected the balance unchanged, got %v", doc["balance"])
+	}
+
+	if err := tx.Put("accounts", "a1", core.Document{}); !errors.Is(err, ErrTxnRolledBack) {
+		t.Errorf("Expected ErrTxnRolledBack from Put, got %v", err)
+	}
+	if _, err := tx.Read("accounts", "a1"); !errors.Is(err, ErrTxnRolledBack) {
+		t.Errorf("Expected ErrTxnRolledBack from Read, got %v", err)
+	}
+	if _, err := tx.Commit(); !errors.Is(err, ErrTxnRolledBack) {
+		t.Errorf("Expected ErrTxnRolledBack from Commit, got %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("Expected a second rollback to be a no-op, got %v", err)
+	}
+}
+
+func TestCommitTwice(t *testing.T) {
+	manager, _, _ := setupTestManager(t)
+
+	tx := manager.Begin()
+	tx.Put("accounts", "a1", core.Document{"balance": 1})
+	if _, err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	if _, err := tx.Commit(); !errors.Is(err, ErrTxnCommitted) {
+		t.Errorf("Expected ErrTxnCommitted, got %v", err)
+	}
+	if err := tx.Delete("accounts", "a1"); !errors.Is(err, ErrTxnCommitted) {
+		t.Errorf("Expected ErrTxnCommitted from Delete, got %v", err)
+	}
+	if err := tx.Rollback(); !errors.Is(err, ErrTxnCommitted) {
+		t.Errorf("Expected ErrTxnCommitted from Rollback, got %v", err)
+	}
+}
+
+func TestCommitFailureKeepsTransactionOpen(t *testing.T) {
+	manager, engine, indexes := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"email": "ada@example.com"})
+	if err := indexes.CreateUniqueIndex("users", "email"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	tx := manager.Begin()
+	tx.Put("users", "u2", core.Document{"email": "bob@example.com"})
+	tx.Put("users", "u3", core.Document{"email": "ada@example.com"})
+	if _, err := tx.Commit(); err == nil {
+		t.Fatalf("Expected a unique violation")
+	}
+
+	// Nothing was applied
+	if _, err := engine.ReadDocument("users", "u2"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected u2 not written, got %v", err)
+	}
+
+	// The transaction can be fixed and committed
+	if err := tx.Delete("users", "u3"); err != nil {
+		t.Fatalf("Expected the transaction to stay open: %v", err)
+	}
+	if _, err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if _, err := engine.ReadDocument("users", "u2"); err != nil {
+		t.Errorf("Expected u2 written: %v", err)
+	}
+}
+
+func TestCommitMultipleCollections(t *testing.T) {
+	manager, engine, indexes := setupTestManager(t)
+	engine.WriteDocument("accounts", "a1", core.Document{"balance": 100})
+	engine.WriteDocument("accounts", "a2", core.Document{"balance": 50})
+	if err := indexes.CreateSecondaryIndex("ledger", "from", core.IndexHash); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	tx := manager.Begin()
+	tx.Put("accounts", "a1", core.Document{"balance": 70})
+	tx.Put("accounts", "a2", core.Document{"balance": 80})
+	tx.Put("ledger", "l1", core.Document{"from": "a1", "to": "a2", "amount": 30})
+
+	record, err := tx.Commit()
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	types := []core.OperationType{}
+	for _, op := range record.Operations {
+		types = append(types, op.Type)
+	}
+	if expected := []core.OperationType{core.OpUpdate, core.OpUpdate, core.OpInsert}; !reflect.DeepEqual(types, expected) {
+		t.Errorf("Expected operation types %v, got %v", expected, types)
+	}
+
+	if doc, _ := engine.ReadDocument("accounts", "a1"); doc["balance"] != float64(70) {
+		t.Errorf("Expected a1 balance 70, got %v", doc)
+	}
+	ids, _ := indexes.LookupSecondaryIDs("ledger", "from", "a1")
+	if !reflect.DeepEqual(ids, []core.DocumentID{"l1"}) {
+		t.Errorf("Expected ledger index to hold l1, got %v", ids)
+	}
+}
+
+func TestCommitValidation(t *testing.T) {
+	manager, _, _ := setupTestManager(t)
+
+	tx := manager.Begin()
+	if err := tx.Put("", "a1", core.Document{}); err == nil {
+		t.Errorf("Expected error for a missing collection")
+	}
+	if err := tx.Put("accounts", "a1", nil); err == nil {
+		t.Errorf("Expected error for a nil document")
+	}
+
+	empty := manager.Begin()
+	if record, err := empty.Commit(); err != nil || len(record.Operations) != 0 {
+		t.Errorf("Expected an empty commit to succeed, got %+v (%v)", record, err)
+	}
+	if manager.Begin().ID() == manager.Begin().ID() {
+		t.Errorf("Expected distinct transaction IDs")
+	}
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("accounts", "a1", core.Document{"balance": 100})
+	engine.WriteDocument("accounts", "a2", core.Document{"balance": 50})
+
+	live := manager.Begin()
+	tx := manager.Begin(WithSnapshot())
+	if _, err := tx.Read("accounts", "a1"); err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	// A concurrent write after the snapshot was taken
+	done := make(chan error)
+	go func() {
+		done <- engine.WriteDocument("accounts", "a1", core.Document{"balance": 90})
+	}()
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	engine.WriteDocument("accounts", "a3", core.Document{"balance": 10})
+
+	if doc, _ := tx.Read("accounts", "a1"); doc["balance"] != float64(100) {
+		t.Errorf("Expected the snapshot balance 100, got %v", doc)
+	}
+	if _, err := tx.Read("accounts", "a3"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected a3 to be invisible to the snapshot, got %v", err)
+	}
+	if doc, _ := live.Read("accounts", "a1"); doc["balance"] != float64(90) {
+		t.Errorf("Expected a live transaction to see balance 90, got %v", doc)
+	}
+
+	// Own writes are still visible
+	tx.Put("accounts", "a2", core.Document{"balance": 60})
+	if doc, _ := tx.Read("accounts", "a2"); doc["balance"] != 60 {
+		t.Errorf("Expected own write, got %v", doc)
+	}
+}
+
+func TestSnapshotConflict(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    core.DocumentID // Written by the transaction
+		external core.DocumentID // Written concurrently after the snapshot
+		conflict bool
+	}{
+		{"same document", "a1", "a1", true},
+		{"disjoint documents", "a1", "a2", false},
+		{"concurrent insert", "a3", "a3", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, engine, _ := setupTestManager(t)
+			engine.WriteDocument("accounts", "a1", core.Document{"balance": 100})
+			engine.WriteDocument("accounts", "a2", core.Document{"balance": 50})
+
+			tx := manager.Begin(WithSnapshot())
+			tx.Put("accounts", tt.write, core.Document{"balance": 1})
+			engine.WriteDocument("accounts", tt.external, core.Document{"balance": 2})
+
+			_, err := tx.Commit()
+			if tt.conflict {
+				if !errors.Is(err, ErrTxnConflict) {
+					t.Fatalf("Expected ErrTxnConflict, got %v", err)
+				}
+				// The first writer wins
+				if doc, _ := engine.ReadDocument("accounts", tt.write); doc["balance"] != float64(2) {
+					t.Errorf("Expected the external write to survive, got %v", doc)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+			if doc, _ := engine.ReadDocument("accounts", tt.write); doc["balance"] != float64(1) {
+				t.Errorf("Expected the transaction's write, got %v", doc)
+			}
+			if doc, _ := engine.ReadDocument("accounts", tt.external); doc["balance"] != float64(2) {
+				t.Errorf("Expected the external write, got %v", doc)
+			}
+		})
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	manager, engine, _ := setupTestManager(t)
+	engine.WriteDocument("users", "u1", core.Document{"name": "ada"})
+	engine.WriteDocument("users", "u2", core.Document{"name": "bob"})
+
+	tx := manager.Begin()
+	tx.Put("users", "u3", core.Document{"name": "cy"})
+
+	if err := tx.Savepoint("outer"); err != nil {
+		t.Fatalf("Failed to set savepoint: %v", err)
+	}
+	tx.Delete("users", "u1")
+	tx.Put("users", "u3", core.Document{"name": "cy", "enriched": true})
+
+	tx.Savepoint("inner")
+	tx.Put("users", "u4", core.Document{"name": "dee"})
+	tx.Delete("users", "u2")
+
+	// Undo the inner part only
+	if err := tx.RollbackTo("inner"); err != nil {
+		t.Fatalf("Failed to roll back to savepoint: %v", err)
+	}
+	if _, err := tx.Read("users", "u4"); !errors.Is(err, core.ErrDocumentNotFound) {
+		t.Errorf("Expected u4 rolled back, got %v", err)
+	}
+	if _, err := tx.Read("users", "u2"); err != nil {
+		t.Errorf("Expected u2 restored to the stored document: %v", err)
+	}
+	if doc, _ := tx.Read("users", "u3"); doc["enriched"] != true {
+		t.Errorf("Expected u3 enrichment kept, got %v", doc)
+	}
+
+	// Rolling back to the outer savepoint discards the inner one too
+	tx.Put("users", "u5", core.Document{"name": "eve"})
+	if err := tx.RollbackTo("outer"); err != nil {
+		t.Fatalf("Failed to roll back to savepoint: %v", err)
+	}
+	if err := tx.RollbackTo("inner"); !errors.Is(err, ErrSavepointNotFound) {
+		t.Errorf("Expected ErrSavepointNotFound for a discarded savepoint, got %v", err)
+	}
+	if doc, _ := tx.Read("users", "u3"); doc["enriched"] != nil {
+		t.Errorf("Expected u3 without enrichment, got %v", doc)
+	}
+
+	// The savepoint survives its rollback and can be released
+	tx.Delete("users", "u2")
+	if err := tx.Release("outer"); err != nil {
+		t.Fatalf("Failed to release savepoint: %v", err)
+	}
+	if err := tx.RollbackTo("outer"); !errors.Is(err, ErrSavepointNotFound) {
+		t.Errorf("Expected ErrSavepointNotFound for a released savepoint, got %v", err)
+	}
+	if err := tx.Release("missing"); !errors.Is(err, ErrSavepointNotFound) {
+		t.Errorf("Expected ErrSavepointNotFound for an unknown savepoint, got %v", err)
+	}
+
+	record, err := tx.Commit()
+	if err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if len(record.Operations) != 2 {
+		t.Errorf("Expected 2 committed operations, got %v", record.Operations)
+	}
+
+	state := map[core.DocumentID]core.Document{}
+	engine.ScanCollection("users", func(docID core.DocumentID, doc core.Document) bool {
+		state[docID] = doc
+		return true
+	})
+	expected := map[core.DocumentID]core.Document{
+		"u1": {"name": "ada"},
+		"u3": {"name": "cy"},
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("Expected %v, got %v", expected, state)
+	}
+	if err := tx.Savepoint("late"); !errors.Is(err, ErrTxnCommitted) {
+		t.Errorf("Expected ErrTxnCommitted, got %v", err)
+	}
+}
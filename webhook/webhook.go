@@ -0,0 +1,580 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+	"github.com/HakashiKatake/Go-Json-Database/storage"
+)
+
+const (
+	// DeadLetterCollection holds the changes a webhook failed to deliver
+	// within its attempts
+	DeadLetterCollection = "_webhook_failures"
+
+	// CursorCollection holds the oplog sequence number up to which each
+	// webhook has acknowledged the changes of its collection, delivered or
+	// dead-lettered, so Start resumes after it
+	CursorCollection = "_webhook_cursors"
+
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// request body keyed with the webhook's secret
+	SignatureHeader = "X-JSONDB-Signature"
+
+	// defaultWatchBuffer is how many changes a webhook may fall behind
+	// before its watch is dropped and resumed. Changes are only queued
+	// while being read, so this is rarely reached.
+	defaultWatchBuffer = 4096
+
+	// checkpointInterval is how often a webhook's acknowledged sequence
+	// number is saved while it runs. It is saved on Stop too, so only a
+	// crash redelivers the changes since the last save.
+	checkpointInterval = time.Second
+)
+
+// opNames names the operation of each change in payloads
+var opNames = map[core.OperationType]string{
+	core.OpInsert: "insert",
+	core.OpUpdate: "update",
+	core.OpDelete: "delete",
+}
+
+// Webhook posts the changes of a collection to a URL
+type Webhook struct {
+	// Collection is the collection whose changes are posted. Required.
+	Collection string
+
+	// URL receives a POST of a JSON Payload for each change. Required.
+	URL string
+
+	// Events are the operations posted; all of them if empty
+	Events []core.OperationType
+
+	// Secret, if set, signs each request in SignatureHeader
+	Secret string
+
+	// MaxAttempts is how many times a change is posted before it is
+	// dead-lettered (default 5)
+	MaxAttempts int
+
+	// Backoff is the wait before the first retry, doubling for each
+	// further one up to MaxBackoff (defaults 500ms and 30s)
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// Timeout bounds each request (default 10s)
+	Timeout time.Duration
+}
+
+// Payload is the JSON body posted for a change. Seq is the oplog sequence
+// number, or zero when the oplog is disabled. Document is the document as
+// stored, with encrypted fields still wrapped, and is omitted for deletes.
+type Payload struct {
+	Collection string          `json:"collection"`
+	DocID      core.DocumentID `json:"docID"`
+	Op         string          `json:"op"`
+	Document   core.Document   `json:"document,omitempty"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Seq        uint64          `json:"seq"`
+}
+
+// Options configures a Dispatcher
+type Options struct {
+	// Client sends the requests (default http.DefaultClient)
+	Client *http.Client
+
+	// Buffer is how many changes a webhook may fall behind its collection
+	// before its watch is resumed (default 4096). See Stats.Resumed.
+	Buffer int
+
+	// OnError is called when a change is dead-lettered or lost
+	OnError func(err error)
+}
+
+// Stats reports a Dispatcher's progress
+type Stats struct {
+	Running      bool   `json:"running"`
+	Delivered    uint64 `json:"delivered"`
+	Retried      uint64 `json:"retried"`
+	DeadLettered uint64 `json:"dead_lettered"`
+	Pending      int64  `json:"pending"` // Changes queued or being delivered
+	Resumed      int    `json:"resumed"` // Times a watch fell behind and was resumed
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// Dispatcher delivers the changes of collections to webhooks in the
+// background between Start and Stop, and stops when the database is
+// closed. Writers never wait for deliveries: changes are queued as they
+// are committed and posted at least once, in commit order per document,
+// retrying with exponential backoff. A change that still fails after its
+// webhook's MaxAttempts, or is pending when the dispatcher stops, is
+// recorded in DeadLetterCollection. With the oplog enabled, Start resumes
+// each webhook after the last change it acknowledged, kept in
+// CursorCollection under its collection and URL, so changes committed
+// while no dispatcher ran are delivered too.
+type Dispatcher struct {
+	db    *db.DB
+	hooks []Webhook
+	opts  Options
+
+	delivered, retried, deadLettered atomic.Uint64
+	pending                          atomic.Int64
+
+	mu     sync.Mutex // Guards stats and the loop state
+	stats  Stats
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDispatcher creates a dispatcher delivering the changes of d to hooks
+func NewDispatcher(d *db.DB, hooks []Webhook, opts Options) (*Dispatcher, error) {
+	hooks = slices.Clone(hooks)
+	for i := range hooks {
+		h := &hooks[i]
+		if h.Collection == "" {
+			return nil, errors.New("webhook: collection is required")
+		}
+		if h.Collection == DeadLetterCollection || h.Collection == CursorCollection {
+			return nil, fmt.Errorf("webhook: cannot watch %s", h.Collection)
+		}
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhook: invalid URL %q", h.URL)
+		}
+		if h.MaxAttempts <= 0 {
+			h.MaxAttempts = 5
+		}
+		if h.Backoff <= 0 {
+			h.Backoff = 500 * time.Millisecond
+		}
+		if h.MaxBackoff <= 0 {
+			h.MaxBackoff = 30 * time.Second
+		}
+		if h.Timeout <= 0 {
+			h.Timeout = 10 * time.Second
+		}
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Buffer <= 0 {
+		opts.Buffer = defaultWatchBuffer
+	}
+
+	p := &Dispatcher{db: d, hooks: hooks, opts: opts}
+	d.OnClose(p.Stop)
+	return p, nil
+}
+
+// Start watches the webhooks' collections and delivers their changes until
+// Stop is called or the database is closed
+func (p *Dispatcher) Start() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runners := make([]*runner, len(p.hooks))
+	for i, hook := range p.hooks {
+		after, err := p.acknowledged(hook)
+		if err != nil {
+			cancel()
+			return err
+		}
+		watcher, err := p.db.Watch(ctx, hook.Collection, storage.WatchOptions{AfterSeq: after, Buffer: p.opts.Buffer})
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to watch %s: %w", hook.Collection, err)
+		}
+		runners[i] = &runner{
+			dispatcher: p,
+			hook:       hook,
+			watcher:    watcher,
+			queues:     make(map[core.DocumentID][]Payload),
+			acked:      make(map[uint64]struct{}),
+			ackedSeq:   after,
+			savedSeq:   after,
+		}
+	}
+
+	done := make(chan struct{})
+	p.cancel, p.done = cancel, done
+	p.stats.Running = true
+
+	var wg sync.WaitGroup
+	for _, r := range runners {
+		wg.Add(1)
+		go r.run(ctx, &wg)
+	}
+	go func() {
+		wg.Wait()
+		for _, r := range runners {
+			r.checkpoint()
+		}
+		close(done)
+	}()
+	return nil
+}
+
+// Stop stops watching and waits for the deliveries in progress to end.
+// Pending changes are dead-lettered rather than retried.
+func (p *Dispatcher) Stop() {
+	p.mu.Lock()
+	cancel, done := p.cancel, p.done
+	p.cancel, p.done = nil, nil
+	p.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+
+	p.mu.Lock()
+	p.stats.Running = false
+	p.mu.Unlock()
+}
+
+// Stats returns the dispatcher's progress
+func (p *Dispatcher) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.stats
+	stats.Delivered = p.delivered.Load()
+	stats.Retried = p.retried.Load()
+	stats.DeadLettered = p.deadLettered.Load()
+	stats.Pending = p.pending.Load()
+	return stats
+}
+
+// failed records and reports an error
+func (p *Dispatcher) failed(err error) {
+	p.mu.Lock()
+	p.stats.LastError = err.Error()
+	p.mu.Unlock()
+
+	if p.opts.OnError != nil {
+		p.opts.OnError(err)
+	}
+}
+
+// cursorID returns the ID of a webhook's document in CursorCollection
+func cursorID(h Webhook) core.DocumentID {
+	sum := sha256.Sum256([]byte(h.Collection + "\x00" + h.URL))
+	return core.DocumentID(hex.EncodeToString(sum[:16]))
+}
+
+// acknowledged returns the sequence number up to which a webhook has
+// acknowledged changes, or zero if it never has
+func (p *Dispatcher) acknowledged(h Webhook) (uint64, error) {
+	cursors, err := p.db.CreateCollection(CursorCollection)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read webhook cursors: %w", err)
+	}
+	doc, err := cursors.Get(cursorID(h))
+	if errors.Is(err, core.ErrDocumentNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cursor of webhook %s: %w", h.URL, err)
+	}
+	seq, _ := core.ToFloat64(doc["seq"])
+	return uint64(seq), nil
+}
+
+// runner delivers the changes of one webhook. Each document with pending
+// changes has a queue drained by its own goroutine, so a slow or failing
+// document holds back only its own later changes.
+type runner struct {
+	dispatcher *Dispatcher
+	hook       Webhook
+	watcher    *storage.Watcher
+
+	mu       sync.Mutex
+	queues   map[core.DocumentID][]Payload // The head of a queue is being delivered
+	seqs     []uint64                      // Read and not yet acknowledged, in order
+	acked    map[uint64]struct{}           // Acknowledged ahead of an earlier change
+	ackedSeq uint64                        // Every change up to it is acknowledged
+	savedSeq uint64                        // ackedSeq as last saved in CursorCollection
+}
+
+// run queues the watched changes until the watch ends, resuming a watch
+// that fell behind, then waits for the queues to drain
+func (r *runner) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+	lastSeq := r.ackedSeq
+	for {
+		var entry storage.OplogEntry
+		var ok bool
+		select {
+		case entry, ok = <-r.watcher.C:
+		case <-ticker.C:
+			r.checkpoint()
+			continue
+		}
+		if ok {
+			lastSeq = entry.Seq
+			r.track(entry.Seq)
+			if len(r.hook.Events) == 0 || slices.Contains(r.hook.Events, entry.Op) {
+				r.enqueue(ctx, wg, Payload{
+					Collection: entry.Collection,
+					DocID:      entry.DocID,
+					Op:         opNames[entry.Op],
+					Document:   entry.Document,
+					Timestamp:  entry.Timestamp,
+					Seq:        entry.Seq,
+				})
+			} else {
+				r.ack(entry.Seq)
+			}
+			continue
+		}
+
+		if !errors.Is(r.watcher.Err(), storage.ErrWatcherDropped) {
+			return
+		}
+		// With the oplog enabled the watch resumes without losing changes
+		p := r.dispatcher
+		p.mu.Lock()
+		p.stats.Resumed++
+		p.mu.Unlock()
+		if lastSeq == 0 {
+			p.failed(fmt.Errorf("webhook %s fell behind %s without the oplog; changes were lost", r.hook.URL, r.hook.Collection))
+		}
+		watcher, err := p.db.Watch(ctx, r.hook.Collection, storage.WatchOptions{AfterSeq: lastSeq, Buffer: p.opts.Buffer})
+		if err != nil {
+			if ctx.Err() == nil {
+				p.failed(fmt.Errorf("failed to resume watching %s: %w", r.hook.Collection, err))
+			}
+			return
+		}
+		r.watcher = watcher
+	}
+}
+
+// track records a change read from the watch, to be acknowledged once
+// delivered, dead-lettered or skipped. Changes without a sequence number,
+// read with the oplog disabled, are not tracked.
+func (r *runner) track(seq uint64) {
+	if seq == 0 {
+		return
+	}
+	r.mu.Lock()
+	r.seqs = append(r.seqs, seq)
+	r.mu.Unlock()
+}
+
+// ack acknowledges a tracked change, advancing ackedSeq over the changes
+// acknowledged without a gap
+func (r *runner) ack(seq uint64) {
+	if seq == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acked[seq] = struct{}{}
+	for len(r.seqs) > 0 {
+		if _, ok := r.acked[r.seqs[0]]; !ok {
+			return
+		}
+		delete(r.acked, r.seqs[0])
+		r.ackedSeq = r.seqs[0]
+		r.seqs = r.seqs[1:]
+	}
+}
+
+// checkpoint saves ackedSeq in CursorCollection if it advanced since last
+// saved
+func (r *runner) checkpoint() {
+	r.mu.Lock()
+	seq, saved := r.ackedSeq, r.savedSeq
+	r.mu.Unlock()
+	if seq == saved {
+		return
+	}
+
+	p := r.dispatcher
+	id := cursorID(r.hook)
+	cursors, err := p.db.CreateCollection(CursorCollection)
+	if err == nil {
+		err = cursors.Batch(func(map[core.DocumentID]core.Document) (map[core.DocumentID]core.Document, error) {
+			return map[core.DocumentID]core.Document{id: {
+				"url":        r.hook.URL,
+				"collection": r.hook.Collection,
+				"seq":        seq,
+			}}, nil
+		})
+	}
+	if err != nil {
+		p.failed(fmt.Errorf("failed to save cursor of webhook %s: %w", r.hook.URL, err))
+		return
+	}
+	r.mu.Lock()
+	r.savedSeq = seq
+	r.mu.Unlock()
+}
+
+// enqueue queues a change behind the pending ones of its document,
+// starting a goroutine to drain the queue if it was empty
+func (r *runner) enqueue(ctx context.Context, wg *sync.WaitGroup, payload Payload) {
+	r.dispatcher.pending.Add(1)
+	r.mu.Lock()
+	queue := r.queues[payload.DocID]
+	r.queues[payload.DocID] = append(queue, payload)
+	r.mu.Unlock()
+
+	if len(queue) == 0 {
+		wg.Add(1)
+		go r.drain(ctx, wg, payload.DocID)
+	}
+}
+
+// drain delivers the changes of a document in order until its queue is
+// empty
+func (r *runner) drain(ctx context.Context, wg *sync.WaitGroup, id core.DocumentID) {
+	defer wg.Done()
+	for {
+		r.mu.Lock()
+		payload := r.queues[id][0]
+		r.mu.Unlock()
+
+		r.deliver(ctx, payload)
+		r.dispatcher.pending.Add(-1)
+		r.ack(payload.Seq)
+
+		r.mu.Lock()
+		queue := r.queues[id][1:]
+		if len(queue) == 0 {
+			delete(r.queues, id)
+			r.mu.Unlock()
+			return
+		}
+		r.queues[id] = queue
+		r.mu.Unlock()
+	}
+}
+
+// deliver posts a change until it succeeds, retrying with exponential
+// backoff, and dead-letters it once its attempts are used up or ctx is
+// done
+func (r *runner) deliver(ctx context.Context, payload Payload) {
+	p := r.dispatcher
+	body, err := json.Marshal(payload)
+	if err != nil {
+		r.deadLetter(payload, 0, fmt.Errorf("failed to encode payload: %w", err))
+		return
+	}
+
+	backoff := r.hook.Backoff
+	attempts := 0
+	for {
+		if err = ctx.Err(); err != nil {
+			err = fmt.Errorf("dispatcher stopped before delivery: %w", err)
+			break
+		}
+		attempts++
+		var retry bool
+		if retry, err = r.post(ctx, body); err == nil {
+			p.delivered.Add(1)
+			return
+		}
+		if !retry || attempts >= r.hook.MaxAttempts {
+			break
+		}
+
+		p.retried.Add(1)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		backoff = min(2*backoff, r.hook.MaxBackoff)
+	}
+	r.deadLetter(payload, attempts, err)
+}
+
+// post sends one request, reporting whether a failure is worth retrying:
+// client errors other than timeouts and rate limiting are not
+func (r *runner) post(ctx context.Context, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.hook.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(r.hook.Secret, body))
+	}
+
+	resp, err := r.dispatcher.opts.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("failed to post to %s: %w", r.hook.URL, err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook %s responded %s", r.hook.URL, resp.Status)
+}
+
+// deadLetter records a change that could not be delivered
+func (r *runner) deadLetter(payload Payload, attempts int, cause error) {
+	p := r.dispatcher
+	p.deadLettered.Add(1)
+	p.failed(fmt.Errorf("failed to deliver %s of %s/%s: %w", payload.Op, payload.Collection, payload.DocID, cause))
+
+	// Stored as decoded JSON, as any document read back would be
+	var stored map[string]interface{}
+	if data, err := json.Marshal(payload); err == nil {
+		json.Unmarshal(data, &stored)
+	}
+	failures, err := p.db.CreateCollection(DeadLetterCollection)
+	if err == nil {
+		_, err = failures.Insert(core.Document{
+			"url":        r.hook.URL,
+			"collection": payload.Collection,
+			"doc_id":     string(payload.DocID),
+			"op":         payload.Op,
+			"seq":        payload.Seq,
+			"payload":    stored,
+			"attempts":   attempts,
+			"error":      cause.Error(),
+			"failed_at":  time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+	if err != nil {
+		p.failed(fmt.Errorf("failed to dead-letter %s of %s/%s: %w", payload.Op, payload.Collection, payload.DocID, err))
+	}
+}
+
+// Sign returns the SignatureHeader value of a body signed with secret, for
+// receivers to compare with hmac.Equal
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,378 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HakashiKatake/Go-Json-Database/core"
+	"github.com/HakashiKatake/Go-Json-Database/db"
+)
+
+// openDB opens a database with the oplog enabled, so payloads carry
+// sequence numbers
+func openDB(t *testing.T) *db.DB {
+	t.Helper()
+	database, err := db.Open(t.TempDir(), db.WithOplog())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+// receiver is a webhook endpoint recording the payloads it accepts. respond
+// chooses the status of each request, given how many came before it.
+type receiver struct {
+	mu       sync.Mutex
+	requests int
+	payloads []Payload
+	bodies   [][]byte
+	headers  []http.Header
+	respond  func(n int, p Payload) int
+}
+
+// serve starts an httptest server for a receiver
+func (rc *receiver) serve(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var p Payload
+		json.Unmarshal(body, &p)
+
+		rc.mu.Lock()
+		n := rc.requests
+		rc.requests++
+		rc.mu.Unlock()
+
+		status := http.StatusOK
+		if rc.respond != nil {
+			status = rc.respond(n, p)
+		}
+		if status == http.StatusOK {
+			rc.mu.Lock()
+			rc.payloads = append(rc.payloads, p)
+			rc.bodies = append(rc.bodies, body)
+			rc.headers = append(rc.headers, r.Header.Clone())
+			rc.mu.Unlock()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// accepted returns the payloads accepted so far
+func (rc *receiver) accepted() []Payload {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]Payload(nil), rc.payloads...)
+}
+
+// start creates and starts a dispatcher
+func start(t *testing.T, database *db.DB, hooks ...Webhook) *Dispatcher {
+	t.Helper()
+	p, err := NewDispatcher(database, hooks, Options{})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Failed to start dispatcher: %v", err)
+	}
+	t.Cleanup(p.Stop)
+	return p
+}
+
+// waitFor polls cond until it holds, failing the test after 5 seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDeliverSigned(t *testing.T) {
+	database := openDB(t)
+	rc := &receiver{}
+	srv := rc.serve(t)
+	deletes := &receiver{}
+	deleteSrv := deletes.serve(t)
+	start(t, database,
+		Webhook{Collection: "users", URL: srv.URL, Secret: "s3cret"},
+		Webhook{Collection: "users", URL: deleteSrv.URL, Events: []core.OperationType{core.OpDelete}},
+	)
+
+	users, _ := database.CreateCollection("users")
+	id, err := users.Insert(core.Document{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("Failed to insert: %v", err)
+	}
+	if err := users.Update(id, core.Document{"name": "Ada Lovelace"}); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if err := users.Delete(id); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	// Other collections are not posted
+	orders, _ := database.CreateCollection("orders")
+	orders.Insert(core.Document{"total": 1})
+
+	waitFor(t, "deliveries", func() bool { return len(rc.accepted()) == 3 && len(deletes.accepted()) == 1 })
+	payloads := rc.accepted()
+	for i, op := range []string{"insert", "update", "delete"} {
+		p := payloads[i]
+		if p.Op != op || p.Collection != "users" || p.DocID != id || p.Seq == 0 || p.Timestamp.IsZero() {
+			t.Errorf("Expected payload %d to be the %s of %s, got %+v", i, op, id, p)
+		}
+		if i > 0 && p.Seq <= payloads[i-1].Seq {
+			t.Errorf("Expected increasing sequence numbers, got %d after %d", p.Seq, payloads[i-1].Seq)
+		}
+		signature := rc.headers[i].Get(SignatureHeader)
+		if !hmac.Equal([]byte(signature), []byte(Sign("s3cret", rc.bodies[i]))) {
+			t.Errorf("Expected a valid signature of payload %d, got %q", i, signature)
+		}
+		if Sign("other", rc.bodies[i]) == signature {
+			t.Errorf("Expected the signature to depend on the secret")
+		}
+	}
+	if payloads[1].Document["name"] != "Ada Lovelace" || payloads[2].Document != nil {
+		t.Errorf("Expected the updated document and none for the delete, got %v and %v", payloads[1].Document, payloads[2].Document)
+	}
+
+	if p := deletes.accepted()[0]; p.Op != "delete" || p.DocID != id {
+		t.Errorf("Expected only the delete, got %+v", p)
+	}
+	if h := deletes.headers[0].Get(SignatureHeader); h != "" {
+		t.Errorf("Expected no signature without a secret, got %q", h)
+	}
+}
+
+func TestRetryOnServerError(t *testing.T) {
+	database := openDB(t)
+	rc := &receiver{respond: func(n int, p Payload) int {
+		if n < 2 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}}
+	srv := rc.serve(t)
+	p := start(t, database, Webhook{Collection: "users", URL: srv.URL, Backoff: time.Millisecond})
+
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"name": "Ada"})
+
+	waitFor(t, "delivery", func() bool { return p.Stats().Delivered == 1 })
+	stats := p.Stats()
+	if rc.requests != 3 || stats.Retried != 2 || stats.DeadLettered != 0 || stats.Pending != 0 {
+		t.Errorf("Expected 2 retries before the delivery, got %d requests and %+v", rc.requests, stats)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	database := openDB(t)
+	rc := &receiver{respond: func(int, Payload) int { return http.StatusServiceUnavailable }}
+	srv := rc.serve(t)
+	badRequest := &receiver{respond: func(int, Payload) int { return http.StatusBadRequest }}
+	badSrv := badRequest.serve(t)
+
+	var mu sync.Mutex
+	var errs []error
+	p, err := NewDispatcher(database, []Webhook{
+		{Collection: "users", URL: srv.URL, MaxAttempts: 3, Backoff: time.Millisecond},
+		{Collection: "users", URL: badSrv.URL, MaxAttempts: 3, Backoff: time.Millisecond},
+	}, Options{OnError: func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	if err := p.Start(); err != nil {
+		t.Fatalf("Failed to start dispatcher: %v", err)
+	}
+	defer p.Stop()
+
+	users, _ := database.CreateCollection("users")
+	id, _ := users.Insert(core.Document{"name": "Ada"})
+
+	waitFor(t, "dead letters", func() bool { return p.Stats().DeadLettered == 2 })
+	if rc.requests != 3 || badRequest.requests != 1 {
+		t.Errorf("Expected 3 attempts, and 1 for a client error, got %d and %d", rc.requests, badRequest.requests)
+	}
+
+	failures, err := database.Collection(DeadLetterCollection)
+	if err != nil {
+		t.Fatalf("Failed to open dead letters: %v", err)
+	}
+	letters, err := failures.Find(core.Query{})
+	if err != nil || len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %v: %v", letters, err)
+	}
+	for _, letter := range letters {
+		expectedAttempts := 3.0
+		if letter["url"] == badSrv.URL {
+			expectedAttempts = 1
+		}
+		payload, _ := letter["payload"].(map[string]interface{})
+		if letter["doc_id"] != string(id) || letter["op"] != "insert" || letter["collection"] != "users" ||
+			toFloat(letter["attempts"]) != expectedAttempts || !strings.Contains(letter["error"].(string), "responded") ||
+			payload["docID"] != string(id) {
+			t.Errorf("Expected a dead letter of the insert, got %v", letter)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 || p.Stats().LastError == "" {
+		t.Errorf("Expected the failures to be reported, got %v", errs)
+	}
+}
+
+// toFloat returns a stored number as a float64
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return -1
+}
+
+func TestDeliveryIsAsyncAndOrdered(t *testing.T) {
+	database := openDB(t)
+	release := make(chan struct{})
+	var once sync.Once
+	rc := &receiver{respond: func(n int, p Payload) int {
+		<-release
+		// Fail each document's first attempt so retries interleave
+		if n%3 == 0 {
+			return http.StatusInternalServerError
+		}
+		return http.StatusOK
+	}}
+	srv := rc.serve(t)
+	defer once.Do(func() { close(release) })
+	p := start(t, database, Webhook{Collection: "users", URL: srv.URL, Backoff: time.Millisecond, MaxAttempts: 100})
+
+	// Writes complete while every delivery is stuck
+	users, _ := database.CreateCollection("users")
+	ids := []core.DocumentID{"a", "b", "c"}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			for _, id := range ids {
+				if i == 0 {
+					users.Insert(core.Document{"_id": string(id), "n": i})
+				} else {
+					users.Update(id, core.Document{"n": i})
+				}
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected writes not to wait for deliveries")
+	}
+	if p.Stats().Delivered != 0 {
+		t.Fatalf("Expected no delivery while the receiver is blocked")
+	}
+
+	once.Do(func() { close(release) })
+	waitFor(t, "deliveries", func() bool { return len(rc.accepted()) == 60 })
+	last := map[core.DocumentID]uint64{}
+	n := map[core.DocumentID]float64{}
+	for _, payload := range rc.accepted() {
+		if payload.Seq <= last[payload.DocID] {
+			t.Fatalf("Expected the changes of %s in order, got %d after %d", payload.DocID, payload.Seq, last[payload.DocID])
+		}
+		if v := payload.Document["n"].(float64); v != n[payload.DocID] {
+			t.Fatalf("Expected change %v of %s, got %v", n[payload.DocID], payload.DocID, v)
+		}
+		last[payload.DocID] = payload.Seq
+		n[payload.DocID]++
+	}
+}
+
+func TestStopDeadLettersPending(t *testing.T) {
+	database := openDB(t)
+	rc := &receiver{respond: func(int, Payload) int { return http.StatusInternalServerError }}
+	srv := rc.serve(t)
+	p := start(t, database, Webhook{Collection: "users", URL: srv.URL, Backoff: time.Hour})
+
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"_id": "ada"})
+	users.Update("ada", core.Document{"name": "Ada"})
+	waitFor(t, "the first attempt", func() bool { return p.Stats().Retried == 1 })
+
+	p.Stop()
+	stats := p.Stats()
+	if stats.Running || stats.Pending != 0 || stats.DeadLettered != 2 {
+		t.Errorf("Expected the pending changes to be dead-lettered, got %+v", stats)
+	}
+	failures, _ := database.Collection(DeadLetterCollection)
+	if letters, _ := failures.Find(core.Query{}); len(letters) != 2 {
+		t.Errorf("Expected 2 dead letters, got %v", letters)
+	}
+}
+
+func TestResumeAfterAcknowledged(t *testing.T) {
+	database := openDB(t)
+	rc := &receiver{}
+	srv := rc.serve(t)
+	hook := Webhook{Collection: "users", URL: srv.URL}
+	p := start(t, database, hook)
+
+	users, _ := database.CreateCollection("users")
+	users.Insert(core.Document{"_id": "ada"})
+	users.Insert(core.Document{"_id": "bob"})
+	waitFor(t, "the first deliveries", func() bool { return len(rc.accepted()) == 2 })
+	p.Stop()
+
+	// Changes committed while stopped are delivered on the next start, and
+	// the acknowledged ones are not delivered again
+	users.Insert(core.Document{"_id": "cy"})
+	start(t, database, hook)
+	waitFor(t, "the missed change", func() bool { return len(rc.accepted()) == 3 })
+	time.Sleep(50 * time.Millisecond)
+	var ids []core.DocumentID
+	for _, payload := range rc.accepted() {
+		ids = append(ids, payload.DocID)
+	}
+	if len(ids) != 3 || ids[2] != "cy" {
+		t.Errorf("Expected ada, bob and then cy delivered once each, got %v", ids)
+	}
+
+	cursors, _ := database.Collection(CursorCollection)
+	doc, err := cursors.Get(cursorID(hook))
+	if seq, _ := core.ToFloat64(doc["seq"]); err != nil || seq != 2 {
+		t.Errorf("Expected the cursor saved at seq 2 by Stop, got %v and %v", doc, err)
+	}
+}
+
+func TestNewDispatcherValidates(t *testing.T) {
+	database := openDB(t)
+	for _, hook := range []Webhook{
+		{URL: "http://example.com"},
+		{Collection: DeadLetterCollection, URL: "http://example.com"},
+		{Collection: CursorCollection, URL: "http://example.com"},
+		{Collection: "users", URL: "ftp://example.com"},
+		{Collection: "users", URL: "not a url"},
+	} {
+		if _, err := NewDispatcher(database, []Webhook{hook}, Options{}); err == nil {
+			t.Errorf("Expected %+v to be rejected", hook)
+		}
+	}
+}